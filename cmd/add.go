@@ -4,24 +4,33 @@ Copyright © 2025 SubstantialCattle5, nilaysharan.com
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
 	"github.com/substantialcattle5/sietch/internal/chunk"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/hooks"
+	"github.com/substantialcattle5/sietch/internal/ignore"
 
 	// manifest raw storage removed in favor of transactional helper
 	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/quota"
 	"github.com/substantialcattle5/sietch/internal/ui"
 	"github.com/substantialcattle5/sietch/util"
 	"gopkg.in/yaml.v3"
@@ -51,29 +60,144 @@ Supports two usage patterns:
 2. Single destination: sietch add source1 source2 ... dest
 	  All source files are stored under the same destination directory.
 
+When adding directories with --recursive, paths matched by .sietchignore files
+(gitignore syntax) inside the tree are skipped. Use --no-ignore to add them anyway.
+--exclude skips paths matching a glob and --include only adds files matching
+one; both can be repeated and use the same syntax, relative to the directory
+added, except that patterns match at any depth unless they start with /.
+
+Symlinks are followed and the file they point to is stored. With
+--preserve-symlinks the link target is recorded instead and 'sietch get'
+recreates the symlink, which suits configuration trees.
+
+A source of - reads the file from stdin and stores it at its destination,
+which must name a file. The data is chunked as it arrives, so streams of any
+size can be stored; --size-hint gives the expected size for progress. Use
+--force to replace a file already stored there. Read the passphrase of an
+encrypted vault from --passphrase-file or SIETCH_PASSPHRASE instead of stdin.
+
+Chunks of each file are hashed, compressed and encrypted by a pool of workers,
+one per CPU by default. Use --workers to change the pool size; the result is
+the same whatever the number of workers. Several files are processed at once,
+--jobs at a time (one per CPU by default), sharing the workers between them;
+results are still reported in the order the files were given. Progress bars
+are only shown when one file is processed at a time.
+
+A file whose content is identical to a file already in the vault, or to one
+added earlier by the same add, reuses the stored chunks instead of being
+chunked, compressed and encrypted again, so only its manifest is written. Use
+--rechunk to process it anyway. With deduplication enabled, chunks repeated
+within one add, in one file or across files, are compressed, encrypted and
+written once.
+
+Adding a tree again only reads the files that changed: the size,
+modification time and content hash of every file added are kept in
+.sietch/change_index.json, and a file whose size and modification time are
+the same as when it was last added is skipped, provided its destination still
+holds that content with the same permissions. Use --checksum to hash every
+file anyway.
+
+The size of the chunk store can be limited with quota.soft and quota.hard in
+vault.yaml, for vaults on small disks. An add that grows the store past the
+soft quota warns, and one that would grow it past the hard quota is refused
+unless --force is given. 'sietch status' shows the usage.
+
+Files larger than 256MB are committed in batches as they are chunked. If an
+add is interrupted, adding the same unchanged file again resumes after the
+last committed batch instead of starting over.
+
+--files-from reads the files to add from a list, one per line, or from stdin
+for -, so any number of files can be added. A line holds a source path, stored
+under the destination argument with its own name, or a source and its
+destination separated by a tab. With --null, entries are separated by NUL bytes, as 'find -print0' writes
+them.
+
 Examples:
 	 sietch add document.txt vault/documents/
 	 sietch add file1.txt dest1/ file2.txt dest2/
-	 sietch add ~/photos/img1.jpg ~/photos/img2.jpg vault/photos/`,
-	Args: cobra.MinimumNArgs(2),
+	 sietch add ~/photos/img1.jpg ~/photos/img2.jpg vault/photos/
+	 sietch add -r ~/projects vault/code --exclude 'node_modules/**' --exclude '*.o'
+	 pg_dump mydb | sietch add - vault/backups/db.sql
+	 find ~/photos -name '*.jpg' -print0 | sietch add --files-from - --null vault/photos/`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// With a file list, only the destination of its sources is an argument
+		if filesFrom, _ := cmd.Flags().GetString("files-from"); filesFrom != "" {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate argument count (reasonable limit for batch operations)
-		if len(args) > 100 {
-			return fmt.Errorf("too many arguments: maximum 100 files per command (received %d)", len(args))
+		var filePairs []FilePair
+		var err error
+		if filesFrom, _ := cmd.Flags().GetString("files-from"); filesFrom != "" {
+			if passphraseStdin, _ := cmd.Flags().GetBool("passphrase-stdin"); passphraseStdin && filesFrom == stdinSource {
+				return fmt.Errorf("--passphrase-stdin cannot be used when reading --files-from stdin")
+			}
+			destination := ""
+			if len(args) == 1 {
+				destination = args[0]
+			}
+			null, _ := cmd.Flags().GetBool("null")
+			if filePairs, err = filesFromList(filesFrom, destination, null); err != nil {
+				return err
+			}
+		} else {
+			// Validate argument count (reasonable limit for batch operations)
+			if len(args) > 100 {
+				return fmt.Errorf("too many arguments: maximum 100 files per command (received %d), use --files-from for more", len(args))
+			}
+
+			// Parse file pairs from arguments
+			if filePairs, err = parseFileArguments(args); err != nil {
+				return err
+			}
 		}
 
-		// Parse file pairs from arguments
-		filePairs, err := parseFileArguments(args)
-		if err != nil {
-			return err
+		// Only one source can be read from stdin, and not along with the passphrase
+		stdinSources := 0
+		for _, pair := range filePairs {
+			if pair.Source == stdinSource {
+				stdinSources++
+			}
+		}
+		if stdinSources > 1 {
+			return fmt.Errorf("only one source can be read from stdin")
+		}
+		if passphraseStdin, _ := cmd.Flags().GetBool("passphrase-stdin"); passphraseStdin && stdinSources > 0 {
+			return fmt.Errorf("--passphrase-stdin cannot be used when adding data from stdin")
+		}
+		var sizeHint int64
+		if hint, _ := cmd.Flags().GetString("size-hint"); hint != "" {
+			if sizeHint, err = util.ParseChunkSize(hint); err != nil {
+				return fmt.Errorf("invalid --size-hint: %v", err)
+			}
 		}
 
 		// Get recursive and includeHidden flags
 		recursive, _ := cmd.Flags().GetBool("recursive")
 		includeHidden, _ := cmd.Flags().GetBool("include-hidden")
+		noIgnore, _ := cmd.Flags().GetBool("no-ignore")
+		preserveOwner, _ := cmd.Flags().GetBool("preserve-owner")
+		preserveXattrs, _ := cmd.Flags().GetBool("xattrs")
+		preserveSymlinks, _ := cmd.Flags().GetBool("preserve-symlinks")
+		metaOpts := metadataOptions{Owner: preserveOwner, Xattrs: preserveXattrs}
+		workers, _ := cmd.Flags().GetInt("workers")
+		rechunk, _ := cmd.Flags().GetBool("rechunk")
+		checksum, _ := cmd.Flags().GetBool("checksum")
+		if workers < 0 {
+			return fmt.Errorf("--workers must not be negative, got %d", workers)
+		}
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		if jobs < 0 {
+			return fmt.Errorf("--jobs must not be negative, got %d", jobs)
+		}
 
 		// Expand directories if needed
-		filePairs, err = expandDirectories(filePairs, recursive, includeHidden)
+		include, exclude, err := addFilters(cmd)
+		if err != nil {
+			return err
+		}
+		filePairs, err = expandDirectories(filePairs, recursive, includeHidden, !noIgnore, include, exclude)
 		if err != nil {
 			return err
 		}
@@ -108,6 +232,9 @@ Examples:
 		if err != nil {
 			return fmt.Errorf("failed to load vault configuration: %v", err)
 		}
+		if err := config.CheckWritable(vaultConfig); err != nil {
+			return err
+		}
 
 		// Parse chunk size
 		chunkSize, err := util.ParseChunkSize(vaultConfig.Chunking.ChunkSize)
@@ -118,6 +245,11 @@ Examples:
 			chunkSize = int64(constants.DefaultChunkSize) // Default to 4MB
 		}
 
+		// A dry run stops after planning, before a passphrase or transaction is needed
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return planAdd(context.Background(), vaultRoot, filePairs, chunkSize, vaultConfig.Chunking.HashAlgorithm, preserveSymlinks, rechunk, checksum)
+		}
+
 		// Get passphrase if needed for encryption
 		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
 		if err != nil {
@@ -134,11 +266,45 @@ Examples:
 		ctx := context.Background()
 		ctx = progressMgr.SetupCancellation(ctx)
 
+		// Files are prepared jobs at a time, sharing the chunk workers between them
+		if jobs == 0 {
+			jobs = chunk.DefaultWorkers()
+		}
+		jobs = min(jobs, len(filePairs))
+		fileWorkers := workers
+		if jobs > 1 {
+			if fileWorkers == 0 {
+				fileWorkers = chunk.DefaultWorkers()
+			}
+			fileWorkers = max(1, fileWorkers/jobs)
+		}
+		fileProgress := func() *progress.Manager { return progressMgr }
+		if jobs > 1 {
+			// Progress bars of files chunked at the same time would overwrite each other
+			fileProgress = func() *progress.Manager {
+				return progress.NewManager(progress.Options{Quiet: true, Verbose: verbose})
+			}
+		}
+
 		// Process each file pair
 		successCount := 0
+		unchangedCount := 0
 		var failedFiles []string
 		var totalSpaceSavings SpaceSavings
 
+		// Chunks of each file added so far, keyed by destination, for hard links
+		addedChunks := make(map[string][]config.ChunkRef)
+		var storedPaths []string // Vault paths of the files added, for the post_add hooks
+
+		// Stored files by content hash, for files identical to one already stored
+		contents := &contentIndex{files: make(map[string]config.FileManifest)}
+		stored := make(map[string]config.FileManifest)
+		if manager, err := config.NewManager(vaultRoot); err == nil {
+			contents.files = manager.ContentIndex()
+			stored = manager.PathIndex()
+		}
+		changes := chunk.LoadChangeIndex(vaultRoot)
+
 		// Show initial progress for multiple files
 		if len(filePairs) > 1 {
 			fmt.Printf("Starting batch processing of %d files...\n\n", len(filePairs))
@@ -158,6 +324,26 @@ Examples:
 			}
 		}()
 
+		// Chunks of every file share one deduplication index, saved before commit
+		batch, err := chunk.NewBatch(vaultRoot, passphrase, txn, fileProgress())
+		if err != nil {
+			return err
+		}
+		adder := &fileAdder{
+			batch:            batch,
+			contents:         contents,
+			hashAlgorithm:    vaultConfig.Chunking.HashAlgorithm,
+			chunkSize:        chunkSize,
+			workers:          fileWorkers,
+			preserveSymlinks: preserveSymlinks,
+			rechunk:          rechunk,
+			checksum:         checksum,
+			changes:          changes,
+			stored:           stored,
+			progress:         fileProgress,
+		}
+		prepared := prepareFiles(ctx, filePairs, jobs, adder.prepare)
+
 		for i, pair := range filePairs {
 			// Enhanced progress display for multiple files
 			if len(filePairs) > 1 {
@@ -166,115 +352,90 @@ Examples:
 			} else {
 				fmt.Printf("Processing: %s\n", pair.Source)
 			}
+			p := prepared(i)
 
-			// Determine path type and handle accordingly
-			fileInfo, pathType, err := fs.GetPathInfo(pair.Source)
-			if err != nil {
-				errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
-				fmt.Println(errorMsg)
-				failedFiles = append(failedFiles, errorMsg)
-				continue
-			}
-
-			// Handle different path types
-			var actualSourcePath string
-			switch pathType {
-			case fs.PathTypeFile:
-				// Regular file - use as is
-				actualSourcePath = pair.Source
-
-			case fs.PathTypeSymlink:
-				// Resolve symlink and verify target is a regular file
-				targetPath, targetInfo, targetType, err := fs.ResolveSymlink(pair.Source)
+			if pair.Source == stdinSource {
+				force, _ := cmd.Flags().GetBool("force")
+				opts := stdinOptions{chunkSize: chunkSize, workers: workers, sizeHint: sizeHint, force: force, tags: tags}
+				fileManifest, err := addFromStdin(ctx, os.Stdin, pair.Destination, vaultRoot, opts, batch, progressMgr, txn)
 				if err != nil {
-					errorMsg := fmt.Sprintf("✗ %s: %v", filepath.Base(pair.Source), err)
+					errorMsg := fmt.Sprintf("✗ stdin: %v", err)
 					fmt.Println(errorMsg)
 					failedFiles = append(failedFiles, errorMsg)
 					continue
 				}
+				fmt.Printf("✓ stdin → %s (%s, %d chunks)\n", fileManifest.Destination+fileManifest.FilePath,
+					util.HumanReadableSize(fileManifest.Size), len(fileManifest.Chunks))
+
+				successCount++
+				addedChunks[pair.Destination] = fileManifest.Chunks
+				storedPaths = append(storedPaths, fileManifest.Destination+fileManifest.FilePath)
+				fileSavings := calculateSpaceSavings(fileManifest.Chunks)
+				totalSpaceSavings.OriginalSize += fileSavings.OriginalSize
+				totalSpaceSavings.CompressedSize += fileSavings.CompressedSize
+				totalSpaceSavings.SpaceSaved += fileSavings.SpaceSaved
+				continue
+			}
 
-				if targetType != fs.PathTypeFile {
-					errorMsg := fmt.Sprintf("✗ %s: symlink target is not a regular file", filepath.Base(pair.Source))
-					fmt.Println(errorMsg)
-					failedFiles = append(failedFiles, errorMsg)
-					continue
-				}
-
-				// Use the resolved target path for processing
-				actualSourcePath = targetPath
-				fileInfo = targetInfo
-
-				if verbose {
-					fmt.Printf("  Resolved symlink: %s → %s\n", pair.Source, targetPath)
+			// A hard link to a file added earlier in this run reuses its stored
+			// content; if that file was not added, the link is stored on its own
+			isLink := false
+			if p.failure == "" && pair.LinkTo != "" {
+				if linkedChunks, ok := addedChunks[pair.LinkTo]; ok {
+					p.chunkRefs = linkedChunks
+					p.note("  Hard link to %s, reusing stored content\n", pair.LinkTo)
+					isLink = true
+				} else {
+					p = adder.store(ctx, p)
 				}
+			}
 
-			case fs.PathTypeDir:
-				// Directories should have been expanded already
-				errorMsg := fmt.Sprintf("✗ %s: unexpected directory in processing loop", filepath.Base(pair.Source))
-				fmt.Println(errorMsg)
-				failedFiles = append(failedFiles, errorMsg)
+			if p.failure != "" {
+				fmt.Println(p.failure)
+				failedFiles = append(failedFiles, p.failure)
 				continue
-
-			default:
-				errorMsg := fmt.Sprintf("✗ %s: unsupported file type", filepath.Base(pair.Source))
-				fmt.Println(errorMsg)
-				failedFiles = append(failedFiles, errorMsg)
+			}
+			if p.unchanged {
+				fmt.Printf("= %s (unchanged since the last add, skipped)\n", filepath.Base(pair.Source))
+				unchangedCount++
 				continue
 			}
-
-			// Get file size in human-readable format
-			sizeInBytes := fileInfo.Size()
-			sizeReadable := util.HumanReadableSize(sizeInBytes)
+			fileInfo, chunkRefs, symlinkTarget, identicalTo := p.fileInfo, p.chunkRefs, p.symlinkTarget, p.identicalTo
 
 			// Display file metadata for confirmation (only for single files or when verbose)
-			verbose, _ := cmd.Flags().GetBool("verbose")
 			if len(filePairs) == 1 || verbose {
-				fmt.Printf("  Size: %s (%d bytes)\n", sizeReadable, sizeInBytes)
+				sizeInBytes := fileInfo.Size()
+				fmt.Printf("  Size: %s (%d bytes)\n", util.HumanReadableSize(sizeInBytes), sizeInBytes)
 				fmt.Printf("  Modified: %s\n", fileInfo.ModTime().Format(time.RFC3339))
 				if len(tags) > 0 {
 					fmt.Printf("  Tags: %s\n", strings.Join(tags, ", "))
 				}
 			}
-
-			// Process the file and store chunks - using the appropriate chunking function
-			var chunkRefs []config.ChunkRef
-			// Use transactional chunking to stage new chunks
-			chunkRefs, err = chunk.ChunkFileTransactional(ctx, actualSourcePath, chunkSize, vaultRoot, passphrase, progressMgr, txn)
-
-			if err != nil {
-				errorMsg := fmt.Sprintf("✗ %s: chunking failed - %v", filepath.Base(pair.Source), err)
-				fmt.Println(errorMsg)
-				failedFiles = append(failedFiles, errorMsg)
-				continue
+			if verbose {
+				for _, note := range p.notes {
+					fmt.Print(note)
+				}
 			}
 
 			// Create and store the file manifest
-			// Separate directory from filename in destination
-			// If pair.Destination ends with a filename (from directory expansion),
-			// we need to extract the directory part and filename separately
-			destDir := filepath.Dir(pair.Destination)
-			destFileName := filepath.Base(pair.Destination)
-
-			// If the destination is just a filename (no directory), set destDir to empty
-			if destDir == "." {
-				destDir = ""
-			} else if destDir != "" && !strings.HasSuffix(destDir, "/") {
-				destDir = destDir + "/"
+			fileManifest := newFileManifest(pair.Destination, fileInfo, chunkRefs, tags)
+			fileManifest.ContentHash = p.contentHash
+			if isLink {
+				fileManifest.HardLink = filepath.ToSlash(pair.LinkTo)
 			}
-
-			fileManifest := &config.FileManifest{
-				FilePath:    destFileName,
-				Size:        sizeInBytes,
-				ModTime:     fileInfo.ModTime().Format(time.RFC3339),
-				Chunks:      chunkRefs,
-				Destination: destDir,
-				AddedAt:     time.Now().UTC(),
-				Tags:        tags, // Include tags in the manifest
+			if symlinkTarget != "" {
+				// Permissions and attributes of a link are those of its target, so none are kept
+				fileManifest.Symlink = symlinkTarget
+				fileManifest.Mode = 0
+				fileManifest.Holes = nil
+			} else if err := recordFileMetadata(fileManifest, p.sourcePath, fileInfo, metaOpts); err != nil {
+				fmt.Printf("  Warning: could not record metadata for %s: %v\n", filepath.Base(pair.Source), err)
 			}
 
 			// Save the manifest
 			// Store manifest via transaction (stage create)
-			if err := storeManifestTransactional(txn, vaultRoot, filepath.Base(pair.Source), fileManifest); err != nil {
+			manifestName, err := storeManifestTransactional(txn, vaultRoot, fileManifest.FilePath, fileManifest)
+			if err != nil {
 				if err.Error() == "skipped" {
 					errorMsg := fmt.Sprintf("✗ '%s': skipped", fileManifest.Destination+fileManifest.FilePath)
 					fmt.Println(errorMsg)
@@ -290,7 +451,15 @@ Examples:
 			spaceSavings := calculateSpaceSavings(chunkRefs)
 
 			// Success message
-			if len(filePairs) > 1 {
+			if symlinkTarget != "" {
+				fmt.Printf("✓ %s (symlink → %s)\n", filepath.Base(pair.Source), symlinkTarget)
+			} else if identicalTo != "" && len(filePairs) > 1 {
+				fmt.Printf("✓ %s (identical to %s, no new chunks)\n", filepath.Base(pair.Source), identicalTo)
+			} else if identicalTo != "" {
+				fmt.Printf("✓ File added to vault: %s\n", filepath.Base(pair.Source))
+				fmt.Printf("✓ Identical to %s, reused its %d chunks\n", identicalTo, len(chunkRefs))
+				fmt.Printf("✓ Manifest written to .sietch/manifests/%s\n", manifestName)
+			} else if len(filePairs) > 1 {
 				fmt.Printf("✓ %s (%d chunks", filepath.Base(pair.Source), len(chunkRefs))
 				if spaceSavings.SpaceSaved > 0 {
 					fmt.Printf(", %s saved", util.HumanReadableSize(spaceSavings.SpaceSaved))
@@ -304,10 +473,13 @@ Examples:
 						util.HumanReadableSize(spaceSavings.SpaceSaved),
 						spaceSavings.SpaceSavedPct)
 				}
-				fmt.Printf("✓ Manifest written to .sietch/manifests/%s.yaml\n", filepath.Base(pair.Source))
+				fmt.Printf("✓ Manifest written to .sietch/manifests/%s\n", manifestName)
 			}
 
 			successCount++
+			addedChunks[pair.Destination] = chunkRefs
+			storedPaths = append(storedPaths, fileManifest.Destination+fileManifest.FilePath)
+			changes.Record(p.sourcePath, fileInfo, vaultConfig.Chunking.HashAlgorithm, p.contentHash, fileManifest.Destination+fileManifest.FilePath)
 
 			// Add to total space savings
 			fileSavings := calculateSpaceSavings(chunkRefs)
@@ -323,6 +495,9 @@ Examples:
 		fmt.Printf("\n=== Batch Processing Summary ===\n")
 		fmt.Printf("Total files: %d\n", len(filePairs))
 		fmt.Printf("Successful: %d\n", successCount)
+		if unchangedCount > 0 {
+			fmt.Printf("Unchanged: %d\n", unchangedCount)
+		}
 
 		if len(failedFiles) > 0 {
 			fmt.Printf("Failed: %d\n", len(failedFiles))
@@ -371,22 +546,214 @@ Examples:
 		}
 
 		// Commit transaction if we had any successes
+		if successCount == 0 && unchangedCount > 0 && len(failedFiles) == 0 {
+			// Nothing was staged, so there is nothing to commit
+			_ = txn.Rollback()
+			committed = true
+			fmt.Println("\n✓ Vault already up to date, no files changed since the last add")
+			return nil
+		}
 		if successCount == 0 {
 			return fmt.Errorf("all files failed to process")
 		}
+		force, _ := cmd.Flags().GetBool("force")
+		if err := checkQuota(vaultRoot, vaultConfig, txn, force); err != nil {
+			if errors.Is(err, quota.ErrHardLimit) {
+				return fmt.Errorf("%v, or add with --force", err)
+			}
+			return err
+		}
+		if err := batch.Save(); err != nil {
+			return err
+		}
 		if err := txn.Commit(); err != nil {
 			return fmt.Errorf("commit transaction: %w", err)
 		}
 		committed = true
 		fmt.Println("txn successful; add committed")
+		if err := changes.Save(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+		addedPaths := make([]string, 0, len(addedChunks))
+		for dest := range addedChunks {
+			addedPaths = append(addedPaths, dest)
+		}
+		sort.Strings(addedPaths)
+		recordAudit(vaultRoot, audit.OpAdd, map[string]string{
+			"files": strconv.Itoa(successCount),
+			"paths": strings.Join(addedPaths, ", "),
+		})
+		hooks.Notify(vaultRoot, vaultConfig, hooks.PostAdd, addedFiles{Files: storedPaths})
+
+		// Keep the manifest index in step with the manifests just written
+		if manager, err := config.NewManager(vaultRoot); err == nil {
+			manager.RefreshIndex()
+		}
 		return nil
 	},
 }
 
+// addedFiles is the event data given to post_add hooks
+type addedFiles struct {
+	Files  []string `json:"files"`            // Vault paths of the files added
+	Source string   `json:"source,omitempty"` // "watch" for files added by sietch watch
+}
+
+// checkQuota measures the chunk store with the chunks txn stages before it
+// is committed. Growing it past its hard quota fails unless force, and past
+// its soft quota only warns.
+func checkQuota(vaultRoot string, vaultConfig *config.VaultConfig, txn *atomic.Transaction, force bool) error {
+	if soft, hard, err := quota.Limits(vaultConfig.Quota); err != nil || (soft == 0 && hard == 0) {
+		return err
+	}
+	usage, err := quota.Measure(vaultRoot, vaultConfig.Quota)
+	if err != nil {
+		return err
+	}
+	after, err := usage.Grow(txn.StagedBytes(".sietch/chunks/"))
+	if err != nil && !force {
+		return fmt.Errorf("%w; free space with 'sietch trash empty' or 'sietch dedup gc', or raise quota.hard", err)
+	}
+	switch {
+	case err != nil:
+		fmt.Printf("⚠️  %v, adding anyway (--force)\n", err)
+	case after.OverSoft():
+		fmt.Printf("⚠️  The chunk store holds %s, over its soft quota of %s (quota.soft)\n",
+			util.HumanReadableSize(after.Used), util.HumanReadableSize(after.Soft))
+	}
+	return nil
+}
+
 // FilePair represents a source file and its destination path
 type FilePair struct {
 	Source      string
 	Destination string
+	LinkTo      string // Destination of an earlier pair that is a hard link to the same inode
+}
+
+// planAdd reports what add would store for filePairs: the chunk boundaries of
+// each file and how many of those chunks are new to the vault. Nothing is written.
+func planAdd(ctx context.Context, vaultRoot string, filePairs []FilePair, chunkSize int64, hashAlgorithm string, preserveSymlinks bool, rechunk bool, checksum bool) error {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	manifest, err := manager.GetManifest()
+	if err != nil {
+		return fmt.Errorf("failed to get vault manifest: %v", err)
+	}
+
+	// Chunks already in the vault, plus those planned so far in this run
+	known := make(map[string]bool)
+	for _, file := range manifest.Files {
+		for _, ch := range file.Chunks {
+			known[ch.Hash] = true
+		}
+	}
+	contentIndex := manager.ContentIndex()
+	byPath := manager.PathIndex()
+	changes := chunk.LoadChangeIndex(vaultRoot)
+
+	var fileCount, unchangedCount, newChunks, reusedChunks int
+	var newBytes int64
+	for _, pair := range filePairs {
+		if pair.Source == stdinSource {
+			// Reading stdin would consume the data, so its size is unknown
+			fmt.Printf("[dry-run] would add stdin → %s\n", pair.Destination)
+			fileCount++
+			continue
+		}
+
+		fileInfo, pathType, err := fs.GetPathInfo(pair.Source)
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n", pair.Source, err)
+			continue
+		}
+
+		sourcePath := pair.Source
+		if pathType == fs.PathTypeSymlink {
+			if preserveSymlinks {
+				target, err := os.Readlink(pair.Source)
+				if err != nil {
+					fmt.Printf("✗ %s: failed to read symlink: %v\n", pair.Source, err)
+					continue
+				}
+				fmt.Printf("[dry-run] would add %s → %s (symlink → %s)\n", pair.Source, pair.Destination, target)
+				fileCount++
+				continue
+			}
+			targetPath, targetInfo, targetType, err := fs.ResolveSymlink(pair.Source)
+			if err != nil || targetType != fs.PathTypeFile {
+				fmt.Printf("✗ %s: symlink target is not a regular file\n", pair.Source)
+				continue
+			}
+			sourcePath, fileInfo = targetPath, targetInfo
+		}
+
+		if pair.LinkTo != "" {
+			fmt.Printf("[dry-run] would add %s → %s (hard link to %s)\n", pair.Source, pair.Destination, pair.LinkTo)
+			fileCount++
+			continue
+		}
+
+		var contentHash string
+		if entry, ok := changes.Lookup(sourcePath, fileInfo, hashAlgorithm); ok && !checksum {
+			contentHash = entry.ContentHash
+			if !rechunk && storedUnchanged(byPath, pair.Destination, contentHash, fileInfo) {
+				fmt.Printf("[dry-run] would skip %s (unchanged since the last add)\n", pair.Source)
+				unchangedCount++
+				continue
+			}
+		} else if contentHash, err = chunk.HashFile(ctx, sourcePath, hashAlgorithm); err != nil {
+			fmt.Printf("✗ %s: %v\n", pair.Source, err)
+			continue
+		}
+		if stored, ok := contentIndex[contentHash]; ok && !rechunk && stored.Size == fileInfo.Size() {
+			fmt.Printf("[dry-run] would add %s → %s (identical to %s, no new chunks)\n",
+				pair.Source, pair.Destination, stored.Destination+stored.FilePath)
+			reusedChunks += len(stored.Chunks)
+			fileCount++
+			continue
+		}
+
+		chunks, err := chunk.PlanFile(ctx, sourcePath, chunkSize, hashAlgorithm)
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n", pair.Source, err)
+			continue
+		}
+		contentIndex[contentHash] = config.FileManifest{
+			FilePath: pair.Destination,
+			Size:     fileInfo.Size(),
+			Chunks:   chunks,
+		}
+
+		fresh := 0
+		for _, ch := range chunks {
+			if known[ch.Hash] {
+				reusedChunks++
+				continue
+			}
+			known[ch.Hash] = true
+			fresh++
+			newBytes += ch.Size
+		}
+		newChunks += fresh
+		fileCount++
+
+		fmt.Printf("[dry-run] would add %s → %s (%s, %d chunks, %d new)\n",
+			pair.Source, pair.Destination, util.HumanReadableSize(fileInfo.Size()), len(chunks), fresh)
+	}
+
+	fmt.Printf("\n=== Dry Run Summary ===\n")
+	fmt.Printf("Files: %d of %d\n", fileCount, len(filePairs))
+	if unchangedCount > 0 {
+		fmt.Printf("Unchanged: %d\n", unchangedCount)
+	}
+	fmt.Printf("New chunks: %d (%s before compression)\n", newChunks, util.HumanReadableSize(newBytes))
+	fmt.Printf("Existing chunks reused: %d\n", reusedChunks)
+	fmt.Println("Nothing was written to the vault")
+	return nil
 }
 
 // calculateSpaceSavings calculates space savings for a file based on its chunks
@@ -434,7 +801,7 @@ func parseFileArguments(args []string) ([]FilePair, error) {
 		for i := 0; i < len(args); i += 2 {
 			pairs = append(pairs, FilePair{
 				Source:      args[i],
-				Destination: args[i+1],
+				Destination: fs.VaultPath(args[i+1]),
 			})
 		}
 		return pairs, nil
@@ -442,7 +809,7 @@ func parseFileArguments(args []string) ([]FilePair, error) {
 
 	// Odd number of arguments (single destination pattern)
 	// Last argument is the destination for all sources
-	destination := args[len(args)-1]
+	destination := fs.VaultPath(args[len(args)-1])
 	var pairs []FilePair
 
 	for i := 0; i < len(args)-1; i++ {
@@ -455,11 +822,43 @@ func parseFileArguments(args []string) ([]FilePair, error) {
 	return pairs, nil
 }
 
-// expandDirectories expands directories into file pairs if recursive flag is set
-func expandDirectories(pairs []FilePair, recursive bool, includeHidden bool) ([]FilePair, error) {
+// addFilters returns the matchers of the --include and --exclude patterns,
+// nil for flags that were not given
+func addFilters(cmd *cobra.Command) (*ignore.Matcher, *ignore.Matcher, error) {
+	var include, exclude *ignore.Matcher
+	if patterns, _ := cmd.Flags().GetStringArray("include"); len(patterns) > 0 {
+		m, err := ignore.Globs(patterns)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --include: %v", err)
+		}
+		include = m
+	}
+	if patterns, _ := cmd.Flags().GetStringArray("exclude"); len(patterns) > 0 {
+		m, err := ignore.Globs(patterns)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid --exclude: %v", err)
+		}
+		exclude = m
+	}
+	return include, exclude, nil
+}
+
+// expandDirectories expands directories into file pairs if recursive flag is set.
+// When useIgnore is set, .sietchignore files found in the tree exclude matching paths.
+// Paths inside a directory matching exclude are skipped, and when include is
+// set only files matching it are added. Files given directly are always added.
+func expandDirectories(pairs []FilePair, recursive bool, includeHidden bool, useIgnore bool, include, exclude *ignore.Matcher) ([]FilePair, error) {
 	var expandedPairs []FilePair
 
+	// First destination seen for each multiply-linked inode
+	linkTargets := make(map[fs.FileID]string)
+
 	for _, pair := range pairs {
+		if pair.Source == stdinSource {
+			expandedPairs = append(expandedPairs, pair)
+			continue
+		}
+
 		// Get path info to determine type
 		fileInfo, pathType, err := fs.GetPathInfo(pair.Source)
 		if err != nil {
@@ -481,6 +880,8 @@ func expandDirectories(pairs []FilePair, recursive bool, includeHidden bool) ([]
 				return nil, fmt.Errorf("'%s' is a directory. Use --recursive flag to add directories", pair.Source)
 			}
 
+			matcher := ignore.New()
+
 			// Walk the directory tree
 			err := filepath.WalkDir(pair.Source, func(path string, d os.DirEntry, err error) error {
 				if err != nil {
@@ -495,6 +896,36 @@ func expandDirectories(pairs []FilePair, recursive bool, includeHidden bool) ([]
 					return nil
 				}
 
+				if rel, err := filepath.Rel(pair.Source, path); err == nil && rel != "." && exclude.Match(filepath.ToSlash(rel), d.IsDir()) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+
+				if useIgnore {
+					rel, err := filepath.Rel(pair.Source, path)
+					if err != nil {
+						return fmt.Errorf("failed to compute relative path: %v", err)
+					}
+					rel = filepath.ToSlash(rel)
+					if rel != "." && matcher.Match(rel, d.IsDir()) {
+						if d.IsDir() {
+							return filepath.SkipDir
+						}
+						return nil
+					}
+					// Rules from a directory's ignore file apply to everything below it
+					if d.IsDir() {
+						if rel == "." {
+							rel = ""
+						}
+						if err := matcher.AddFile(filepath.Join(path, ignore.FileName), rel); err != nil {
+							return err
+						}
+					}
+				}
+
 				// Only add regular files and symlinks
 				if !d.IsDir() {
 					// Compute relative path from source directory
@@ -502,14 +933,34 @@ func expandDirectories(pairs []FilePair, recursive bool, includeHidden bool) ([]
 					if err != nil {
 						return fmt.Errorf("failed to compute relative path: %v", err)
 					}
+					if include != nil && !include.Match(filepath.ToSlash(relPath), false) {
+						return nil
+					}
 
 					// Preserve directory structure in destination
-					destPath := filepath.Join(pair.Destination, relPath)
+					destPath := fs.VaultPath(filepath.Join(pair.Destination, relPath))
 
-					expandedPairs = append(expandedPairs, FilePair{
+					expanded := FilePair{
 						Source:      path,
 						Destination: destPath,
-					})
+					}
+
+					// Later links to an inode already in the tree reuse its content
+					if d.Type().IsRegular() {
+						info, err := d.Info()
+						if err != nil {
+							return err
+						}
+						if id, links, ok := fs.FileIdentity(info); ok && links > 1 {
+							if target, seen := linkTargets[id]; seen {
+								expanded.LinkTo = target
+							} else {
+								linkTargets[id] = destPath
+							}
+						}
+					}
+
+					expandedPairs = append(expandedPairs, expanded)
 				}
 
 				return nil
@@ -533,23 +984,39 @@ func init() {
 	rootCmd.AddCommand(addCmd)
 
 	// Optional flags for the add command
-	addCmd.Flags().BoolP("force", "f", false, "Force add without confirmation")
+	addCmd.Flags().BoolP("force", "f", false, "Force add without confirmation, even past the hard quota (quota.hard)")
 	addCmd.Flags().StringP("tags", "t", "", "Comma-separated tags to associate with the file")
 	addCmd.Flags().BoolP("recursive", "r", false, "Recursively add directories")
 	addCmd.Flags().BoolP("include-hidden", "H", false, "Include hidden files and directories")
+	addCmd.Flags().Bool("no-ignore", false, "Do not honor .sietchignore files when adding directories")
+	addCmd.Flags().StringArray("include", nil, "Only add files matching this glob when adding directories (repeatable)")
+	addCmd.Flags().StringArray("exclude", nil, "Skip paths matching this glob when adding directories (repeatable)")
+	addCmd.Flags().Bool("preserve-owner", false, "Record numeric file owner and group (uid/gid)")
+	addCmd.Flags().Bool("xattrs", false, "Record extended attributes")
+	addCmd.Flags().Bool("preserve-symlinks", false, "Store symlinks as links instead of the files they point to")
 	addCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
 	addCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	addCmd.Flags().String("size-hint", "", "Expected size of data read from stdin (e.g. 2GB), for progress")
+	addCmd.Flags().String("files-from", "", "Read the files to add from a list, one per line (- for stdin)")
+	addCmd.Flags().BoolP("null", "0", false, "Entries of the --files-from list are separated by NUL bytes")
+	addCmd.Flags().Bool("rechunk", false, "Chunk files again even if identical content is already stored")
+	addCmd.Flags().Bool("checksum", false, "Hash every file, even those unchanged in size and modification time since the last add")
+	addCmd.Flags().Int("workers", 0, "Number of chunks to hash, compress and encrypt in parallel (default: number of CPUs)")
+	addCmd.Flags().IntP("jobs", "j", 0, "Number of files to process in parallel (default: number of CPUs)")
 }
 
-// storeManifestTransactional writes a manifest yaml via the transaction staging new file.
-func storeManifestTransactional(txn *atomic.Transaction, vaultRoot string, fileName string, m *config.FileManifest) error {
+// storeManifestTransactional writes a manifest yaml via the transaction staging new file
+// and returns the name of the manifest file.
+func storeManifestTransactional(txn *atomic.Transaction, vaultRoot string, fileName string, m *config.FileManifest) (string, error) {
 	// Mirror logic from manifest.StoreFileManifest but stage instead of direct write.
 	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
 	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
-		return fmt.Errorf("failed to create manifests directory: %v", err)
+		return "", fmt.Errorf("failed to create manifests directory: %v", err)
+	}
+	uniqueFileIdentifier, err := config.ManifestFileName(vaultRoot, m.Destination, fileName)
+	if err != nil {
+		return "", err
 	}
-	destination := strings.ReplaceAll(m.Destination, "/", ".")
-	uniqueFileIdentifier := destination + fileName + ".yaml"
 	relPath := filepath.ToSlash(filepath.Join(".sietch", "manifests", uniqueFileIdentifier))
 	// Prompt overwrite if exists in final location
 	finalPath := filepath.Join(manifestsDir, uniqueFileIdentifier)
@@ -557,31 +1024,106 @@ func storeManifestTransactional(txn *atomic.Transaction, vaultRoot string, fileN
 		message := fmt.Sprintf("'%s' exists. Overwrite? ", m.Destination+fileName)
 		response, err2 := util.ConfirmOverwrite(message, os.Stdin, os.Stdout)
 		if err2 != nil || !response {
-			return fmt.Errorf("skipped")
+			return "", fmt.Errorf("skipped")
 		}
 		// Stage replace instead of create
 		w, err2 := txn.StageReplace(relPath)
 		if err2 != nil {
-			return err2
+			return "", err2
 		}
 		defer w.Close()
-		return writeManifestYAML(w, m)
+		return uniqueFileIdentifier, writeManifestYAML(w, vaultRoot, m)
 	}
 	w, err := txn.StageCreate(relPath)
+	if err != nil {
+		return "", err
+	}
+	defer w.Close()
+	return uniqueFileIdentifier, writeManifestYAML(w, vaultRoot, m)
+}
+
+// newFileManifest builds the manifest for a file stored at destination inside the vault.
+// The destination is split into its directory part and file name, since directory
+// expansion produces destinations that already end with the file name.
+func newFileManifest(destination string, fileInfo os.FileInfo, chunkRefs []config.ChunkRef, tags []string) *config.FileManifest {
+	// Vault paths use forward slashes on every platform
+	destination = fs.VaultPath(destination)
+	destDir := path.Dir(destination)
+	destFileName := path.Base(destination)
+
+	// If the destination is just a filename (no directory), set destDir to empty
+	if destDir == "." {
+		destDir = ""
+	} else if destDir != "" && !strings.HasSuffix(destDir, "/") {
+		destDir = destDir + "/"
+	}
+
+	return &config.FileManifest{
+		FilePath:    destFileName,
+		Size:        fileInfo.Size(),
+		ModTime:     fileInfo.ModTime().Format(time.RFC3339),
+		Chunks:      chunkRefs,
+		Destination: destDir,
+		AddedAt:     time.Now().UTC(),
+		Tags:        tags, // Include tags in the manifest
+		Mode:        fs.PosixMode(fileInfo.Mode()),
+		Holes:       chunk.Holes(chunkRefs, fileInfo.Size()),
+	}
+}
+
+// upsertManifestTransactional stages a manifest create, or a replace if it already
+// exists, without prompting. Used by non-interactive callers such as watch.
+func upsertManifestTransactional(txn *atomic.Transaction, vaultRoot string, fileName string, m *config.FileManifest) error {
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create manifests directory: %v", err)
+	}
+	uniqueFileIdentifier, err := config.ManifestFileName(vaultRoot, m.Destination, fileName)
+	if err != nil {
+		return err
+	}
+	relPath := filepath.ToSlash(filepath.Join(".sietch", "manifests", uniqueFileIdentifier))
+
+	stage := txn.StageCreate
+	if _, err := os.Stat(filepath.Join(manifestsDir, uniqueFileIdentifier)); err == nil {
+		stage = txn.StageReplace
+	}
+	w, err := stage(relPath)
 	if err != nil {
 		return err
 	}
 	defer w.Close()
-	return writeManifestYAML(w, m)
+	return writeManifestYAML(w, vaultRoot, m)
 }
 
-func writeManifestYAML(w io.Writer, m *config.FileManifest) error {
-	enc := yaml.NewEncoder(w)
+// replaceManifestTransactional rewrites an existing manifest (given by its absolute path) through the transaction.
+func replaceManifestTransactional(txn *atomic.Transaction, vaultRoot string, manifestPath string, m *config.FileManifest) error {
+	rel, err := filepath.Rel(vaultRoot, manifestPath)
+	if err != nil {
+		return fmt.Errorf("resolve manifest path: %w", err)
+	}
+	w, err := txn.StageReplace(filepath.ToSlash(rel))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return writeManifestYAML(w, vaultRoot, m)
+}
+
+// writeManifestYAML encodes m and writes it to w, sealed if the vault encrypts its manifests
+func writeManifestYAML(w io.Writer, vaultRoot string, m *config.FileManifest) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
 	enc.SetIndent(2)
 	if err := enc.Encode(m); err != nil {
 		return fmt.Errorf("encode manifest: %w", err)
 	}
-	return nil
+	data, err := config.SealMetadata(vaultRoot, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
 }
 
 //TODO: Need to check how symlinks will be handled
@@ -0,0 +1,218 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+)
+
+// Adding a file happens in two steps. Preparing it stats the source and
+// stores its content, staging new chunks in the add's transaction; files are
+// prepared concurrently, --jobs at a time. Its manifest is then staged by
+// the add itself, one file at a time and in the order the files were given,
+// so output, overwrite prompts and hard links behave as in a sequential add.
+
+// preparedFile is a file whose content is stored, ready for its manifest
+type preparedFile struct {
+	pair          FilePair
+	fileInfo      os.FileInfo
+	sourcePath    string // The file read, the target of a followed symlink
+	symlinkTarget string
+	chunkRefs     []config.ChunkRef
+	contentHash   string
+	identicalTo   string   // Stored file whose chunks were reused
+	unchanged     bool     // Stored at its destination as it is now, so skipped
+	notes         []string // Verbose details, printed with the file's result
+	failure       string   // Why the file was not added, empty if it was
+}
+
+func (p *preparedFile) note(format string, args ...any) {
+	p.notes = append(p.notes, fmt.Sprintf(format, args...))
+}
+
+func (p *preparedFile) fail(format string, args ...any) *preparedFile {
+	p.failure = fmt.Sprintf(format, args...)
+	return p
+}
+
+// contentIndex is the stored files by content hash, shared by the files of
+// an add as they are prepared
+type contentIndex struct {
+	mu    sync.Mutex
+	files map[string]config.FileManifest
+}
+
+func (c *contentIndex) lookup(contentHash string) (config.FileManifest, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, ok := c.files[contentHash]
+	return m, ok
+}
+
+// add records m as the file stored with contentHash unless there is one
+func (c *contentIndex) add(contentHash string, m config.FileManifest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.files[contentHash]; !ok {
+		c.files[contentHash] = m
+	}
+}
+
+// fileAdder prepares the files of an add
+type fileAdder struct {
+	batch            *chunk.Batch
+	contents         *contentIndex
+	hashAlgorithm    string
+	chunkSize        int64
+	workers          int // Chunk workers per file
+	preserveSymlinks bool
+	rechunk          bool
+	checksum         bool                           // Hash every file, even those the change index has unchanged
+	changes          *chunk.ChangeIndex             // Content hashes of files added before
+	stored           map[string]config.FileManifest // Stored files by vault path
+	progress         func() *progress.Manager       // Progress of chunking one file
+}
+
+// prepare stats pair and stores its content. Data read from stdin and hard
+// links to files of the same add are left to when their manifest is staged.
+func (a *fileAdder) prepare(ctx context.Context, pair FilePair) *preparedFile {
+	p := &preparedFile{pair: pair}
+	if pair.Source == stdinSource {
+		return p
+	}
+
+	name := filepath.Base(pair.Source)
+	fileInfo, pathType, err := fs.GetPathInfo(pair.Source)
+	if err != nil {
+		return p.fail("✗ %s: %v", name, err)
+	}
+	p.fileInfo = fileInfo
+
+	switch pathType {
+	case fs.PathTypeFile:
+		p.sourcePath = pair.Source
+
+	case fs.PathTypeSymlink:
+		// Store the link itself rather than the file it points to
+		if a.preserveSymlinks {
+			target, err := os.Readlink(pair.Source)
+			if err != nil {
+				return p.fail("✗ %s: failed to read symlink: %v", name, err)
+			}
+			p.sourcePath, p.symlinkTarget = pair.Source, target
+			p.note("  Symlink → %s\n", target)
+			return p
+		}
+
+		// Resolve symlink and verify target is a regular file
+		targetPath, targetInfo, targetType, err := fs.ResolveSymlink(pair.Source)
+		if err != nil {
+			return p.fail("✗ %s: %v", name, err)
+		}
+		if targetType != fs.PathTypeFile {
+			return p.fail("✗ %s: symlink target is not a regular file", name)
+		}
+		p.sourcePath, p.fileInfo = targetPath, targetInfo
+		p.note("  Resolved symlink: %s → %s\n", pair.Source, targetPath)
+
+	case fs.PathTypeDir:
+		// Directories should have been expanded already
+		return p.fail("✗ %s: unexpected directory in processing loop", name)
+
+	default:
+		return p.fail("✗ %s: unsupported file type", name)
+	}
+
+	if pair.LinkTo != "" {
+		return p
+	}
+	return a.store(ctx, p)
+}
+
+// store stores the content of p, reusing the chunks of a stored file with
+// the same content. A file the change index has unchanged since it was
+// stored at the same destination is not read at all.
+func (a *fileAdder) store(ctx context.Context, p *preparedFile) *preparedFile {
+	var contentHash string
+	var err error
+	if entry, ok := a.changes.Lookup(p.sourcePath, p.fileInfo, a.hashAlgorithm); ok && !a.checksum {
+		contentHash = entry.ContentHash
+		if !a.rechunk && storedUnchanged(a.stored, p.pair.Destination, contentHash, p.fileInfo) {
+			p.contentHash, p.unchanged = contentHash, true
+			return p
+		}
+		p.note("  Unchanged since the last add, hash taken from the change index\n")
+	} else {
+		contentHash, err = chunk.HashFile(ctx, p.sourcePath, a.hashAlgorithm)
+	}
+	if err == nil {
+		p.contentHash = contentHash
+		if stored, ok := a.contents.lookup(contentHash); ok && !a.rechunk && stored.Size == p.fileInfo.Size() {
+			// Identical to a stored file; reference its chunks instead of chunking again
+			refs, reuseErr := a.batch.ReuseChunks(stored.Chunks)
+			if reuseErr == nil {
+				p.chunkRefs = refs
+				p.identicalTo = stored.Destination + stored.FilePath
+				p.note("  Identical to %s, reusing its %d chunks\n", p.identicalTo, len(refs))
+				return p
+			}
+			p.note("  Cannot reuse chunks of %s: %v\n", stored.Destination+stored.FilePath, reuseErr)
+		}
+		p.chunkRefs, err = a.batch.ChunkFile(ctx, p.sourcePath, a.chunkSize, a.workers, a.progress())
+	}
+	if err != nil {
+		return p.fail("✗ %s: chunking failed - %v", filepath.Base(p.pair.Source), err)
+	}
+	// Later files with the same content reuse the chunks just staged
+	a.contents.add(contentHash, *newFileManifest(p.pair.Destination, p.fileInfo, p.chunkRefs, nil))
+	return p
+}
+
+// storedUnchanged reports whether the file stored at destination has
+// contentHash and the size and permissions of info, so adding a file with
+// that content would store it again as it is
+func storedUnchanged(stored map[string]config.FileManifest, destination, contentHash string, info os.FileInfo) bool {
+	placed := newFileManifest(destination, info, nil, nil)
+	m, ok := stored[placed.Destination+placed.FilePath]
+	return ok && m.ContentHash == contentHash && m.Size == info.Size() &&
+		m.Mode == fs.PosixMode(info.Mode()) && m.Symlink == "" && m.HardLink == ""
+}
+
+// prepareFiles starts preparing pairs, up to jobs at a time and in order,
+// and returns a function that waits for the i-th of them. With a single job
+// each file is prepared only when it is waited for.
+func prepareFiles(ctx context.Context, pairs []FilePair, jobs int, prepare func(context.Context, FilePair) *preparedFile) func(i int) *preparedFile {
+	if jobs <= 1 {
+		return func(i int) *preparedFile { return prepare(ctx, pairs[i]) }
+	}
+
+	results := make([]chan *preparedFile, len(pairs))
+	for i := range results {
+		results[i] = make(chan *preparedFile, 1)
+	}
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range pairs {
+			next <- i
+		}
+	}()
+	for w := 0; w < jobs; w++ {
+		go func() {
+			for i := range next {
+				results[i] <- prepare(ctx, pairs[i])
+			}
+		}()
+	}
+	return func(i int) *preparedFile { return <-results[i] }
+}
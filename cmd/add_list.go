@@ -0,0 +1,85 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// readFileList parses a --files-from list: one source per line, optionally
+// followed by a tab and the destination to store it at. Sources without a
+// destination are stored under destination, keeping their names, so many
+// files can share it. With null set, entries are separated by NUL bytes
+// instead of newlines, as written by 'find -print0'. Blank entries are skipped.
+func readFileList(r io.Reader, destination string, null bool) ([]FilePair, error) {
+	separator := byte('\n')
+	if null {
+		separator = 0
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, separator); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	var pairs []FilePair
+	for entry := 1; scanner.Scan(); entry++ {
+		line := scanner.Text()
+		if !null {
+			line = strings.TrimSuffix(line, "\r")
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		source, dest, hasDest := strings.Cut(line, "\t")
+		switch {
+		case source == "":
+			return nil, fmt.Errorf("entry %d of file list: missing source path", entry)
+		case source == stdinSource:
+			return nil, fmt.Errorf("entry %d of file list: a listed source cannot be read from stdin", entry)
+		case hasDest && dest == "":
+			return nil, fmt.Errorf("entry %d of file list: missing destination for '%s'", entry, source)
+		case !hasDest && destination == "":
+			return nil, fmt.Errorf("entry %d of file list: no destination for '%s', give one after a tab or as an argument", entry, source)
+		case !hasDest:
+			dest = filepath.Join(destination, filepath.Base(source))
+		}
+		pairs = append(pairs, FilePair{Source: source, Destination: fs.VaultPath(dest)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %v", err)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("file list is empty")
+	}
+	return pairs, nil
+}
+
+// filesFromList reads the --files-from list at path, or stdin for -
+func filesFromList(path, destination string, null bool) ([]FilePair, error) {
+	if path == stdinSource {
+		return readFileList(os.Stdin, destination, null)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file list: %v", err)
+	}
+	defer f.Close()
+	return readFileList(f, destination, null)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/progress"
+)
+
+// stdinSource is the source argument that makes add read the file from stdin
+const stdinSource = "-"
+
+// streamInfo describes data read from a stream, which has no file of its own
+type streamInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (s streamInfo) Name() string       { return s.name }
+func (s streamInfo) Size() int64        { return s.size }
+func (s streamInfo) Mode() os.FileMode  { return 0o644 }
+func (s streamInfo) ModTime() time.Time { return s.modTime }
+func (s streamInfo) IsDir() bool        { return false }
+func (s streamInfo) Sys() any           { return nil }
+
+// stdinOptions are the settings of an add that reads from stdin
+type stdinOptions struct {
+	chunkSize int64
+	workers   int
+	sizeHint  int64
+	force     bool
+	tags      []string
+}
+
+// addFromStdin chunks in as it arrives into batch and stages a manifest for
+// it at destination, which must name a file. The manifest is synthesized: the file
+// is as large as the stream, modified when it was read and mode 0644.
+func addFromStdin(ctx context.Context, in io.Reader, destination, vaultRoot string, opts stdinOptions, batch *chunk.Batch, progressMgr *progress.Manager, txn *atomic.Transaction) (*config.FileManifest, error) {
+	name := filepath.Base(destination)
+	if strings.HasSuffix(destination, "/") || name == "." || name == "/" {
+		return nil, fmt.Errorf("destination of data read from stdin must name a file, got '%s'", destination)
+	}
+
+	// Check before reading, since stdin cannot be read twice
+	probe := newFileManifest(destination, streamInfo{name: name}, nil, nil)
+	manifestName, err := config.ManifestFileName(vaultRoot, probe.Destination, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(vaultRoot, ".sietch", "manifests", manifestName)); err == nil && !opts.force {
+		return nil, fmt.Errorf("'%s' already exists, use --force to replace it", probe.Destination+probe.FilePath)
+	}
+
+	chunkRefs, size, contentHash, err := batch.ChunkStream(ctx, in, opts.sizeHint, opts.chunkSize, opts.workers, progressMgr)
+	if err != nil {
+		return nil, err
+	}
+
+	fileManifest := newFileManifest(destination, streamInfo{name: name, size: size, modTime: time.Now()}, chunkRefs, opts.tags)
+	fileManifest.ContentHash = contentHash
+	if err := upsertManifestTransactional(txn, vaultRoot, name, fileManifest); err != nil {
+		return nil, err
+	}
+	return fileManifest, nil
+}
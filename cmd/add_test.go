@@ -1,10 +1,22 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	vaulttxn "github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/ignore"
 	"github.com/substantialcattle5/sietch/testutil"
 )
 
@@ -264,3 +276,271 @@ func TestAddCommandBatchProcessingOutput(t *testing.T) {
 		}
 	}
 }
+
+func TestExpandDirectoriesHonorsIgnoreFile(t *testing.T) {
+	dir := testutil.TempDir(t, "expand-ignore")
+	testutil.CreateTestFile(t, dir, ".sietchignore", "*.log\nbuild/\n")
+	testutil.CreateTestFile(t, dir, "keep.txt", "keep")
+	testutil.CreateTestFile(t, dir, "debug.log", "log")
+	testutil.CreateTestFile(t, dir+"/build", "out.bin", "bin")
+	testutil.CreateTestFile(t, dir+"/sub", ".sietchignore", "!important.log\nlocal.txt\n")
+	testutil.CreateTestFile(t, dir+"/sub", "important.log", "log")
+	testutil.CreateTestFile(t, dir+"/sub", "local.txt", "local")
+	testutil.CreateTestFile(t, dir+"/sub", "data.txt", "data")
+
+	destinations := func(pairs []FilePair) map[string]bool {
+		result := make(map[string]bool)
+		for _, p := range pairs {
+			result[p.Destination] = true
+		}
+		return result
+	}
+
+	pairs, err := expandDirectories([]FilePair{{Source: dir, Destination: "vault"}}, true, false, true, nil, nil)
+	if err != nil {
+		t.Fatalf("expandDirectories: %v", err)
+	}
+	got := destinations(pairs)
+	for _, want := range []string{"vault/keep.txt", "vault/sub/important.log", "vault/sub/data.txt"} {
+		if !got[want] {
+			t.Errorf("expected %s to be included, got %v", want, got)
+		}
+	}
+	for _, unwanted := range []string{"vault/debug.log", "vault/build/out.bin", "vault/sub/local.txt"} {
+		if got[unwanted] {
+			t.Errorf("expected %s to be ignored", unwanted)
+		}
+	}
+
+	// --no-ignore keeps everything (hidden files are still skipped)
+	pairs, err = expandDirectories([]FilePair{{Source: dir, Destination: "vault"}}, true, false, false, nil, nil)
+	if err != nil {
+		t.Fatalf("expandDirectories: %v", err)
+	}
+	if len(pairs) != 6 {
+		t.Errorf("expected 6 files without ignore rules, got %d: %v", len(pairs), destinations(pairs))
+	}
+}
+
+func TestExpandDirectoriesDetectsHardLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inode identity is not available on windows")
+	}
+	dir := testutil.TempDir(t, "expand-links")
+	original := testutil.CreateTestFile(t, dir+"/a", "one.txt", "shared")
+	testutil.CreateTestFile(t, dir, "other.txt", "other")
+	if err := os.Link(original, filepath.Join(dir, "z-link.txt")); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	pairs, err := expandDirectories([]FilePair{{Source: dir, Destination: "vault"}}, true, false, true, nil, nil)
+	if err != nil {
+		t.Fatalf("expandDirectories: %v", err)
+	}
+
+	links := make(map[string]string)
+	for _, p := range pairs {
+		links[p.Destination] = p.LinkTo
+	}
+	if links[filepath.Join("vault", "a", "one.txt")] != "" {
+		t.Error("first occurrence of an inode should not be a link")
+	}
+	if links[filepath.Join("vault", "other.txt")] != "" {
+		t.Error("unlinked file should not be a link")
+	}
+	if got := links[filepath.Join("vault", "z-link.txt")]; got != filepath.Join("vault", "a", "one.txt") {
+		t.Errorf("expected z-link.txt to link to vault/a/one.txt, got %q", got)
+	}
+}
+
+func TestAddFromStdinRequiresFileDestination(t *testing.T) {
+	for _, dest := range []string{"backups/", ".", "/"} {
+		_, err := addFromStdin(context.Background(), strings.NewReader("data"), dest, t.TempDir(), stdinOptions{chunkSize: 1024}, nil, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "must name a file") {
+			t.Errorf("expected destination %q to be rejected, got %v", dest, err)
+		}
+	}
+}
+
+func TestExpandDirectoriesIncludeExclude(t *testing.T) {
+	dir := testutil.TempDir(t, "expand-filters")
+	testutil.CreateTestFile(t, dir, "main.go", "package main")
+	testutil.CreateTestFile(t, dir, "main.o", "obj")
+	testutil.CreateTestFile(t, dir, "README.md", "readme")
+	testutil.CreateTestFile(t, dir+"/web/node_modules/lib", "index.go", "module")
+	testutil.CreateTestFile(t, dir+"/web", "app.go", "package web")
+
+	include, err := ignore.Globs([]string{"*.go", "*.o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := ignore.Globs([]string{"node_modules/**", "*.o"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs, err := expandDirectories([]FilePair{{Source: dir, Destination: "vault"}}, true, false, true, include, exclude)
+	if err != nil {
+		t.Fatalf("expandDirectories: %v", err)
+	}
+	var got []string
+	for _, p := range pairs {
+		got = append(got, filepath.ToSlash(p.Destination))
+	}
+	sort.Strings(got)
+	if want := []string{"vault/main.go", "vault/web/app.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPrepareFilesKeepsOrder(t *testing.T) {
+	var pairs []FilePair
+	for i := 0; i < 20; i++ {
+		pairs = append(pairs, FilePair{Source: strconv.Itoa(i)})
+	}
+
+	var running, peak atomic.Int32
+	prepare := func(ctx context.Context, pair FilePair) *preparedFile {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// Later files finish first
+		i, _ := strconv.Atoi(pair.Source)
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		return &preparedFile{pair: pair}
+	}
+
+	prepared := prepareFiles(context.Background(), pairs, 4, prepare)
+	for i, pair := range pairs {
+		if got := prepared(i); got.pair != pair {
+			t.Fatalf("file %d: expected %v, got %v", i, pair, got.pair)
+		}
+	}
+	if peak.Load() > 4 {
+		t.Errorf("expected at most 4 files prepared at once, got %d", peak.Load())
+	}
+}
+
+func TestReadFileList(t *testing.T) {
+	tests := []struct {
+		name        string
+		list        string
+		destination string
+		null        bool
+		expected    []FilePair
+		expectError string
+	}{
+		{
+			name:        "sources stored under the destination",
+			list:        "a.txt\n\nphotos/b.jpg\r\n",
+			destination: "vault/",
+			expected:    []FilePair{{Source: "a.txt", Destination: "vault/a.txt"}, {Source: "photos/b.jpg", Destination: "vault/b.jpg"}},
+		},
+		{
+			name:     "pairs with their own destination",
+			list:     "a.txt\tdocs/a.txt\nname with spaces.txt\tdocs/other.txt",
+			expected: []FilePair{{Source: "a.txt", Destination: "docs/a.txt"}, {Source: "name with spaces.txt", Destination: "docs/other.txt"}},
+		},
+		{
+			name:        "NUL separated",
+			list:        "odd\nname\x00b.txt\tdocs/b.txt\x00",
+			destination: "vault/",
+			null:        true,
+			expected:    []FilePair{{Source: "odd\nname", Destination: "vault/odd\nname"}, {Source: "b.txt", Destination: "docs/b.txt"}},
+		},
+		{name: "no destination", list: "a.txt\n", expectError: "no destination for 'a.txt'"},
+		{name: "empty destination", list: "a.txt\t\n", destination: "vault/", expectError: "missing destination"},
+		{name: "stdin source", list: "-\n", destination: "vault/", expectError: "cannot be read from stdin"},
+		{name: "empty list", list: "\n\n", destination: "vault/", expectError: "file list is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs, err := readFileList(strings.NewReader(tt.list), tt.destination, tt.null)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pairs, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, pairs)
+			}
+		})
+	}
+}
+
+func TestStoredUnchanged(t *testing.T) {
+	dir := testutil.TempDir(t, "stored-unchanged")
+	path := testutil.CreateTestFile(t, dir, "a.txt", "content")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := *newFileManifest("docs/a.txt", info, nil, nil)
+	m.ContentHash = "c1"
+	stored := map[string]config.FileManifest{"docs/a.txt": m}
+
+	if !storedUnchanged(stored, "docs/a.txt", "c1", info) {
+		t.Error("file stored with the same content should be unchanged")
+	}
+	if storedUnchanged(stored, "docs/a.txt", "c2", info) {
+		t.Error("file stored with other content should not be unchanged")
+	}
+	if storedUnchanged(stored, "other/a.txt", "c1", info) {
+		t.Error("file with nothing stored at its destination should not be unchanged")
+	}
+
+	m.Mode ^= 0o100
+	stored["docs/a.txt"] = m
+	if storedUnchanged(stored, "docs/a.txt", "c1", info) {
+		t.Error("file whose permissions changed should not be unchanged")
+	}
+}
+
+func TestStoreManifestNamedByVaultPath(t *testing.T) {
+	vaultRoot := testutil.TempDir(t, "add-manifest-names")
+	srcDir := testutil.TempDir(t, "add-manifest-sources")
+	// Two sources sharing a base name, stored under different vault names
+	pairs := []FilePair{
+		{Source: testutil.CreateTestFile(t, filepath.Join(srcDir, "x"), "report.txt", "x"), Destination: "docs/final.txt"},
+		{Source: testutil.CreateTestFile(t, filepath.Join(srcDir, "y"), "report.txt", "y"), Destination: "docs/other.txt"},
+	}
+
+	for _, pair := range pairs {
+		info, err := os.Stat(pair.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := newFileManifest(pair.Destination, info, nil, nil)
+		txn, err := vaulttxn.Begin(vaultRoot, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A name clash would prompt, and with nothing on stdin skip the file
+		name, err := storeManifestTransactional(txn, vaultRoot, m.FilePath, m)
+		if err != nil {
+			t.Fatalf("%s: %v", pair.Destination, err)
+		}
+		if err := txn.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		want, _ := config.ManifestFileName(vaultRoot, "docs/", path.Base(pair.Destination))
+		if name != want {
+			t.Errorf("%s stored as %s, want %s", pair.Destination, name, want)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(vaultRoot, ".sietch", "manifests"))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected two manifests, got %v (%v)", entries, err)
+	}
+}
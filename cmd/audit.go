@@ -0,0 +1,175 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Review the vault's audit log",
+	Long: `Review the log of operations performed on this vault.
+
+Every add, rm, sync, key exchange, garbage collection, trust change and
+passphrase change is appended to .sietch/audit.log. Each entry includes the hash of the entry
+before it, so editing or removing an entry breaks the chain and is reported
+by 'sietch audit verify'. Vaults that encrypt their manifests seal the
+details of each entry, which name the files involved, and show them only
+when the vault key can be loaded.
+
+Example:
+  sietch audit show
+  sietch audit show --operation sync --limit 5
+  sietch audit verify`,
+}
+
+var auditShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "List audit log entries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		entries, err := audit.Read(vaultRoot)
+		if err != nil {
+			return err
+		}
+
+		operation, _ := cmd.Flags().GetString("operation")
+		limit, _ := cmd.Flags().GetInt("limit")
+		entries = filterAuditEntries(entries, operation, limit)
+
+		if format != outputTable {
+			if entries == nil {
+				entries = []audit.Entry{}
+			}
+			return writeStructured(os.Stdout, format, entries)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No audit log entries")
+			return nil
+		}
+		return displayAuditEntries(os.Stdout, entries)
+	},
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the audit log has not been tampered with",
+	Long: `Check the hash chain of the audit log.
+
+Verification fails if any entry was modified, removed or reordered. Entries
+removed from the end of the log cannot be detected from the log alone, so the
+hash of the latest entry is printed; keep a copy outside the vault to compare
+against later.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		entries, err := audit.Read(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if err := audit.Verify(entries); err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("✓ Audit log is empty")
+			return nil
+		}
+		last := entries[len(entries)-1]
+		fmt.Printf("✓ Audit log verified: %d entries\n", len(entries))
+		fmt.Printf("  Latest entry: #%d at %s\n", last.Seq, last.Time.Local().Format(time.RFC3339))
+		fmt.Printf("  Latest hash:  %s\n", last.Hash)
+		return nil
+	},
+}
+
+// filterAuditEntries keeps the entries for operation (all if empty), then the last limit of them (all if limit <= 0)
+func filterAuditEntries(entries []audit.Entry, operation string, limit int) []audit.Entry {
+	if operation != "" {
+		var matched []audit.Entry
+		for _, entry := range entries {
+			if entry.Operation == operation {
+				matched = append(matched, entry)
+			}
+		}
+		entries = matched
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// displayAuditEntries prints entries as a table, one per line
+func displayAuditEntries(w io.Writer, entries []audit.Entry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEQ\tTIME\tOPERATION\tDETAILS")
+	for _, entry := range entries {
+		details := formatAuditDetails(entry.Details)
+		if entry.Details == nil && entry.Sealed != "" {
+			details = "(sealed)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", entry.Seq, entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Operation, details)
+	}
+	return tw.Flush()
+}
+
+// formatAuditDetails renders details as space-separated key=value pairs in key order
+func formatAuditDetails(details map[string]string) string {
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+details[k])
+	}
+	return strings.Join(parts, " ")
+}
+
+// recordAudit appends an entry to the vault's audit log. The operation has
+// already happened, so a failure is reported without failing the command.
+func recordAudit(vaultRoot, operation string, details map[string]string) {
+	if err := audit.Record(vaultRoot, operation, details); err != nil {
+		fmt.Printf("⚠️  Failed to record %s in audit log: %v\n", operation, err)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditShowCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+
+	auditShowCmd.Flags().String("operation", "", "Only show entries for this operation (add, rm, sync, key-exchange, gc, trust)")
+	auditShowCmd.Flags().IntP("limit", "n", 0, "Only show the most recent n entries")
+}
@@ -0,0 +1,571 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	mrand "math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure chunking, hashing, compression, encryption and disk throughput",
+	Long: `Measure how fast this machine chunks, hashes, compresses, encrypts and
+writes data, to choose the chunk size, hash, compression and cipher of a
+vault.
+
+The benchmark runs on synthetic data held in memory, so nothing in the vault
+is read or changed. Each stage is measured on its own for every setting
+being compared; the settings of the current vault are marked with '*'.
+Hashing, compression and encryption use the vault's chunk size, and
+encryption includes the base64 encoding chunks get before they are
+encrypted. Disk writes go to a temporary directory in the vault's chunk
+store, or in --dir, and are synced to disk like chunks added by 'sietch add'.
+
+The data is random, which does not compress, text, which compresses well,
+or mixed, alternating the two. With --jobs N the hashing, compression and
+encryption stages spread chunks over N workers as 'sietch add' does.
+
+Examples:
+  sietch bench                                 # Compare the common settings
+  sietch bench --size 1GB --data random        # A longer run on incompressible data
+  sietch bench --chunk-size 1MB,4MB,16MB       # Compare chunk sizes
+  sietch bench --cipher aes-gcm,chacha20 -j 8  # Compare ciphers on 8 workers
+  sietch bench --dir /mnt/bigdisk -o json      # Measure another disk`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		opts, err := benchOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		progressMgr := progress.NewManager(progress.Options{Quiet: true})
+		ctx := progressMgr.SetupCancellation(context.Background())
+		defer progressMgr.Cleanup()
+
+		if format == outputTable {
+			fmt.Printf("Benchmarking on %s of %s data...\n", util.HumanReadableSize(opts.Size), opts.Data)
+		}
+		data, err := benchData(opts.Data, opts.Size)
+		if err != nil {
+			return err
+		}
+		results, err := runBench(ctx, opts, data)
+		if err != nil {
+			if progressMgr.IsCancelled() {
+				return fmt.Errorf("benchmark interrupted")
+			}
+			return err
+		}
+
+		out := benchOutput{Size: opts.Size, Data: opts.Data, Jobs: opts.Jobs, Results: results}
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, out)
+		}
+		printBenchResults(out)
+		return nil
+	},
+}
+
+// Kinds of synthetic data a benchmark runs on
+const (
+	benchDataRandom = "random"
+	benchDataText   = "text"
+	benchDataMixed  = "mixed"
+)
+
+// Stages of a benchmark
+const (
+	benchChunking    = "chunking"
+	benchHashing     = "hashing"
+	benchCompression = "compression"
+	benchEncryption  = "encryption"
+	benchDiskWrite   = "disk write"
+)
+
+// benchOptions is what a benchmark measures
+type benchOptions struct {
+	Size         int64
+	Data         string
+	Jobs         int
+	ChunkSizes   []int64 // The first is the size the other stages use
+	Hashes       []string
+	Compressions []string
+	Ciphers      []string
+	Dir          string // Directory the disk write stage writes in
+
+	// Settings of the current vault, marked in the results
+	current map[string]string
+}
+
+// benchResult is the throughput of one stage with one setting
+type benchResult struct {
+	Stage       string  `json:"stage" yaml:"stage"`
+	Setting     string  `json:"setting" yaml:"setting"`
+	Current     bool    `json:"current" yaml:"current"`
+	Bytes       int64   `json:"bytes" yaml:"bytes"`
+	Seconds     float64 `json:"seconds" yaml:"seconds"`
+	BytesPerSec float64 `json:"bytes_per_second" yaml:"bytes_per_second"`
+	Ratio       float64 `json:"ratio,omitempty" yaml:"ratio,omitempty"` // Output size over input size, for compression
+}
+
+// benchOutput is the structured form of a benchmark run
+type benchOutput struct {
+	Size    int64         `json:"size" yaml:"size"`
+	Data    string        `json:"data" yaml:"data"`
+	Jobs    int           `json:"jobs" yaml:"jobs"`
+	Results []benchResult `json:"results" yaml:"results"`
+}
+
+// benchOptionsFromFlags returns the options of the bench command, comparing
+// the common settings, and those of the vault around the working directory,
+// for every stage whose flag is not given
+func benchOptionsFromFlags(cmd *cobra.Command) (*benchOptions, error) {
+	flags := cmd.Flags()
+	opts := &benchOptions{current: map[string]string{}}
+
+	sizeFlag, _ := flags.GetString("size")
+	size, err := util.ParseChunkSize(sizeFlag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --size: %v", err)
+	}
+	opts.Size = size
+	opts.Data, _ = flags.GetString("data")
+	if !slices.Contains([]string{benchDataRandom, benchDataText, benchDataMixed}, opts.Data) {
+		return nil, fmt.Errorf("invalid --data '%s' (must be one of: random, text, mixed)", opts.Data)
+	}
+	opts.Jobs, _ = flags.GetInt("jobs")
+	if opts.Jobs <= 0 {
+		opts.Jobs = 1
+	}
+
+	// The vault around the working directory, if any, provides the defaults
+	chunkSize := "4MB"
+	opts.Dir = os.TempDir()
+	if vaultRoot, err := fs.FindVaultRoot(); err == nil {
+		if vaultConfig, err := config.LoadVaultConfig(vaultRoot); err == nil {
+			if vaultConfig.Chunking.ChunkSize != "" {
+				chunkSize = vaultConfig.Chunking.ChunkSize
+			}
+			opts.current[benchHashing] = vaultConfig.Chunking.HashAlgorithm
+			if opts.current[benchHashing] == "" {
+				opts.current[benchHashing] = constants.HashAlgorithmSHA256
+			}
+			opts.current[benchCompression] = vaultConfig.Compression
+			opts.current[benchEncryption] = encryption.CipherOf(vaultConfig.Encryption)
+			opts.Dir = vaultConfig.ChunkDirectory(vaultRoot)
+		}
+	}
+	defaultSize, err := util.ParseChunkSize(chunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk size in vault.yaml: %v", err)
+	}
+	if len(opts.current) > 0 {
+		opts.current[benchChunking] = util.HumanReadableSize(defaultSize)
+		opts.current[benchDiskWrite] = util.HumanReadableSize(defaultSize)
+	}
+
+	if flags.Changed("chunk-size") {
+		sizes, _ := flags.GetStringSlice("chunk-size")
+		for _, s := range sizes {
+			n, err := util.ParseChunkSize(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --chunk-size %s: %v", s, err)
+			}
+			opts.ChunkSizes = append(opts.ChunkSizes, n)
+		}
+	} else {
+		opts.ChunkSizes = []int64{defaultSize}
+		for _, n := range []int64{1 << 20, 4 << 20, 16 << 20} {
+			if n != defaultSize {
+				opts.ChunkSizes = append(opts.ChunkSizes, n)
+			}
+		}
+	}
+
+	opts.Hashes = benchSettings(cmd, "hash", opts.current[benchHashing], constants.HashAlgorithmSHA256, constants.HashAlgorithmBLAKE3)
+	for _, h := range opts.Hashes {
+		if _, err := chunk.CreateHasher(h); err != nil {
+			return nil, fmt.Errorf("invalid --hash: %v", err)
+		}
+	}
+	// Storing chunks uncompressed costs nothing, so there is nothing to measure
+	currentCompression := opts.current[benchCompression]
+	if currentCompression == constants.CompressionTypeNone {
+		currentCompression = ""
+	}
+	opts.Compressions = benchSettings(cmd, "compression", currentCompression, constants.CompressionTypeGzip, constants.CompressionTypeZstd)
+	for _, c := range opts.Compressions {
+		if !slices.Contains([]string{constants.CompressionTypeNone, constants.CompressionTypeGzip, constants.CompressionTypeZstd}, c) {
+			return nil, fmt.Errorf("invalid --compression '%s' (must be one of: none, gzip, zstd)", c)
+		}
+	}
+	opts.Ciphers = benchSettings(cmd, "cipher", opts.current[benchEncryption], encryption.CipherAESGCM, encryption.CipherAESCBC, encryption.CipherChaCha20)
+	for _, c := range opts.Ciphers {
+		if _, err := benchEncryptionConfig(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if dir, _ := flags.GetString("dir"); dir != "" {
+		opts.Dir = dir
+	}
+	return opts, nil
+}
+
+// benchSettings returns the settings the flag name lists, or else current
+// followed by the other defaults
+func benchSettings(cmd *cobra.Command, name, current string, defaults ...string) []string {
+	if cmd.Flags().Changed(name) {
+		settings, _ := cmd.Flags().GetStringSlice(name)
+		return settings
+	}
+	var settings []string
+	if current != "" {
+		settings = append(settings, current)
+	}
+	for _, s := range defaults {
+		if s != current {
+			settings = append(settings, s)
+		}
+	}
+	return settings
+}
+
+// benchEncryptionConfig returns encryption settings that encrypt chunks with cipher
+func benchEncryptionConfig(cipher string) (config.EncryptionConfig, error) {
+	switch cipher {
+	case encryption.CipherAESGCM:
+		return config.EncryptionConfig{Type: constants.EncryptionTypeAES, AESConfig: &config.AESConfig{Mode: constants.AESModeGCM}}, nil
+	case encryption.CipherAESCBC:
+		return config.EncryptionConfig{Type: constants.EncryptionTypeAES, AESConfig: &config.AESConfig{Mode: constants.AESModeCBC}}, nil
+	case encryption.CipherChaCha20:
+		return config.EncryptionConfig{Type: constants.EncryptionTypeChaCha20}, nil
+	default:
+		return config.EncryptionConfig{}, fmt.Errorf("invalid --cipher '%s' (must be one of: %s, %s, %s)", cipher, encryption.CipherAESGCM, encryption.CipherAESCBC, encryption.CipherChaCha20)
+	}
+}
+
+// benchData returns size bytes of synthetic data of the given kind. Text is
+// words drawn from a small vocabulary, which compresses about as well as
+// source code or logs do.
+func benchData(kind string, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if kind == benchDataRandom {
+		_, err := io.ReadFull(rand.Reader, data)
+		return data, err
+	}
+
+	words := []string{"vault", "chunk", "sync", "peer", "manifest", "the", "of", "and", "data", "file",
+		"hash", "offline", "desert", "water", "spice", "sietch", "key", "store", "read", "write"}
+	r := mrand.New(mrand.NewSource(1))
+	const block = 64 << 10
+	for start := int64(0); start < size; start += block {
+		end := min(start+block, size)
+		if kind == benchDataMixed && (start/block)%2 == 1 {
+			if _, err := io.ReadFull(rand.Reader, data[start:end]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for i := start; i < end; {
+			i += int64(copy(data[i:end], words[r.Intn(len(words))]))
+			if i < end {
+				data[i] = ' '
+				i++
+			}
+		}
+	}
+	return data, nil
+}
+
+// splitBenchData returns data cut into chunks of chunkSize
+func splitBenchData(data []byte, chunkSize int64) [][]byte {
+	var chunks [][]byte
+	for start := int64(0); start < int64(len(data)); start += chunkSize {
+		chunks = append(chunks, data[start:min(start+chunkSize, int64(len(data)))])
+	}
+	return chunks
+}
+
+// runBench measures every stage of opts on data, stopping when ctx is done
+func runBench(ctx context.Context, opts *benchOptions, data []byte) ([]benchResult, error) {
+	if len(opts.ChunkSizes) == 0 {
+		return nil, fmt.Errorf("no chunk size to benchmark")
+	}
+	var results []benchResult
+	record := func(stage, setting string, elapsed time.Duration) *benchResult {
+		r := benchResult{
+			Stage:   stage,
+			Setting: setting,
+			Current: opts.current[stage] == setting,
+			Bytes:   int64(len(data)),
+			Seconds: elapsed.Seconds(),
+		}
+		if elapsed > 0 {
+			r.BytesPerSec = float64(len(data)) / elapsed.Seconds()
+		}
+		results = append(results, r)
+		return &results[len(results)-1]
+	}
+
+	for _, size := range opts.ChunkSizes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		elapsed, err := benchChunk(data, size)
+		if err != nil {
+			return nil, err
+		}
+		record(benchChunking, util.HumanReadableSize(size), elapsed)
+	}
+
+	chunks := splitBenchData(data, opts.ChunkSizes[0])
+	for _, algorithm := range opts.Hashes {
+		elapsed, err := benchEach(ctx, chunks, opts.Jobs, func(c []byte) error {
+			hasher, err := chunk.CreateHasher(algorithm)
+			if err != nil {
+				return err
+			}
+			hasher.Write(c)
+			hasher.Sum(nil)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		record(benchHashing, algorithm, elapsed)
+	}
+
+	for _, algorithm := range opts.Compressions {
+		var mu sync.Mutex
+		var compressed int64
+		elapsed, err := benchEach(ctx, chunks, opts.Jobs, func(c []byte) error {
+			out, err := compression.CompressData(c, algorithm)
+			mu.Lock()
+			compressed += int64(len(out))
+			mu.Unlock()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		r := record(benchCompression, algorithm, elapsed)
+		r.Ratio = math.Round(float64(compressed)/float64(r.Bytes)*1000) / 1000
+	}
+
+	for _, cipher := range opts.Ciphers {
+		enc, err := benchEncryptionConfig(cipher)
+		if err != nil {
+			return nil, err
+		}
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		elapsed, err := benchEach(ctx, chunks, opts.Jobs, func(c []byte) error {
+			_, err := encryption.EncryptWithKey(base64.StdEncoding.EncodeToString(c), key, enc)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		record(benchEncryption, cipher, elapsed)
+	}
+
+	for _, size := range opts.ChunkSizes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		elapsed, err := benchDisk(ctx, opts.Dir, splitBenchData(data, size))
+		if err != nil {
+			return nil, fmt.Errorf("disk write benchmark in %s failed: %v", opts.Dir, err)
+		}
+		record(benchDiskWrite, util.HumanReadableSize(size), elapsed)
+	}
+	return results, nil
+}
+
+// benchChunk times reading data in chunks of chunkSize, as files are read
+// when they are added
+func benchChunk(data []byte, chunkSize int64) (time.Duration, error) {
+	buffer := make([]byte, chunkSize)
+	reader := &benchReader{data: data}
+	start := time.Now()
+	for {
+		n, err := io.ReadFull(reader, buffer)
+		if n == 0 || err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+	}
+	return time.Since(start), nil
+}
+
+// benchReader reads data, without the shortcuts bytes.Reader takes when
+// copying, much as a file is read
+type benchReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *benchReader) Read(p []byte) (int, error) {
+	if r.offset >= len(r.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[r.offset:])
+	r.offset += n
+	return n, nil
+}
+
+// benchEach times fn on every chunk, spread over jobs workers
+func benchEach(ctx context.Context, chunks [][]byte, jobs int, fn func([]byte) error) (time.Duration, error) {
+	work := make(chan []byte)
+	errs := make(chan error, jobs)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				if err := fn(c); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for _, c := range chunks {
+		select {
+		case work <- c:
+		case err = <-errs:
+			break feed
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	elapsed := time.Since(start)
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return elapsed, err
+}
+
+// benchDisk times writing chunks as files in a new directory in dir, each
+// synced to disk, and removes them again
+func benchDisk(ctx context.Context, dir string, chunks [][]byte) (time.Duration, error) {
+	tmp, err := os.MkdirTemp(dir, ".sietch-bench-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+
+	start := time.Now()
+	for i, c := range chunks {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		f, err := os.Create(filepath.Join(tmp, strconv.Itoa(i)))
+		if err != nil {
+			return 0, err
+		}
+		_, err = f.Write(c)
+		if err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(start), nil
+}
+
+// printBenchResults prints the results of a benchmark as a table per stage
+func printBenchResults(out benchOutput) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nSTAGE\tSETTING\tTHROUGHPUT\tRATIO")
+	previous := ""
+	for _, r := range out.Results {
+		stage := r.Stage
+		if stage == previous {
+			stage = ""
+		}
+		previous = r.Stage
+		setting := r.Setting
+		if r.Current {
+			setting += " *"
+		}
+		ratio := ""
+		if r.Stage == benchCompression {
+			ratio = fmt.Sprintf("%.1f%%", r.Ratio*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s/s\t%s\n", stage, setting, util.HumanReadableSize(int64(r.BytesPerSec)), ratio)
+	}
+	_ = w.Flush()
+	if out.Jobs > 1 {
+		fmt.Printf("\nHashing, compression and encryption ran on %d workers\n", out.Jobs)
+	}
+	for _, r := range out.Results {
+		if r.Current {
+			fmt.Println("* setting of the current vault")
+			break
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().String("size", "64MB", "Amount of synthetic data to run each stage on")
+	benchCmd.Flags().String("data", benchDataMixed, "Synthetic data to use: random, text or mixed")
+	benchCmd.Flags().IntP("jobs", "j", 1, "Workers to spread hashing, compression and encryption over")
+	benchCmd.Flags().StringSlice("chunk-size", nil, "Chunk sizes to compare (default: the vault's, 1MB, 4MB and 16MB)")
+	benchCmd.Flags().StringSlice("hash", nil, "Hash algorithms to compare (default: sha256, blake3)")
+	benchCmd.Flags().StringSlice("compression", nil, "Compression algorithms to compare (default: gzip, zstd)")
+	benchCmd.Flags().StringSlice("cipher", nil, "Ciphers to compare (default: aes-gcm, aes-cbc, chacha20)")
+	benchCmd.Flags().String("dir", "", "Directory to measure disk writes in (default: the vault's chunk store)")
+}
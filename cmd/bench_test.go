@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestRunBench(t *testing.T) {
+	data, err := benchData(benchDataMixed, 300<<10)
+	if err != nil {
+		t.Fatalf("benchData: %v", err)
+	}
+	if len(data) != 300<<10 {
+		t.Fatalf("benchData returned %d bytes", len(data))
+	}
+
+	opts := &benchOptions{
+		Jobs:         2,
+		ChunkSizes:   []int64{64 << 10, 100 << 10},
+		Hashes:       []string{"sha256", "blake3"},
+		Compressions: []string{"zstd"},
+		Ciphers:      []string{"aes-gcm", "chacha20"},
+		Dir:          t.TempDir(),
+		current:      map[string]string{benchHashing: "blake3"},
+	}
+	results, err := runBench(context.Background(), opts, data)
+	if err != nil {
+		t.Fatalf("runBench: %v", err)
+	}
+
+	count := map[string]int{}
+	for _, r := range results {
+		count[r.Stage]++
+		if r.Bytes != int64(len(data)) || r.Seconds < 0 {
+			t.Errorf("%s %s: %d bytes in %fs", r.Stage, r.Setting, r.Bytes, r.Seconds)
+		}
+		if r.Current != (r.Stage == benchHashing && r.Setting == "blake3") {
+			t.Errorf("%s %s marked current %v", r.Stage, r.Setting, r.Current)
+		}
+		// Half the mixed data is text, so it compresses to well under its size
+		if r.Stage == benchCompression && (r.Ratio <= 0 || r.Ratio >= 0.9) {
+			t.Errorf("zstd ratio %f on mixed data", r.Ratio)
+		}
+	}
+	want := map[string]int{benchChunking: 2, benchHashing: 2, benchCompression: 1, benchEncryption: 2, benchDiskWrite: 2}
+	for stage, n := range want {
+		if count[stage] != n {
+			t.Errorf("%d %s results, want %d", count[stage], stage, n)
+		}
+	}
+
+	if entries, err := os.ReadDir(opts.Dir); err != nil || len(entries) != 0 {
+		t.Errorf("disk benchmark left %d entries behind: %v", len(entries), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := runBench(ctx, opts, data); err == nil {
+		t.Error("runBench ran with a cancelled context")
+	}
+}
+
+func TestSplitBenchData(t *testing.T) {
+	chunks := splitBenchData(make([]byte, 250), 100)
+	if len(chunks) != 3 || len(chunks[0]) != 100 || len(chunks[2]) != 50 {
+		t.Errorf("split 250 bytes into %d chunks", len(chunks))
+	}
+}
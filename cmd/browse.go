@@ -0,0 +1,323 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/manifoldco/promptui"
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	lsui "github.com/substantialcattle5/sietch/internal/ls"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// Marks that can be placed on a file while browsing
+const (
+	markRetrieve = "get"
+	markDelete   = "delete"
+)
+
+// Menu actions that are not tied to a single file
+const (
+	browseActionFile     = "file"
+	browseActionRetrieve = "retrieve"
+	browseActionDelete   = "delete"
+	browseActionSync     = "sync"
+	browseActionQuit     = "quit"
+)
+
+// browseItem is a single row in the browser list
+type browseItem struct {
+	Label   string
+	Details string
+	Action  string
+	Path    string
+}
+
+// browseCmd represents the browse command
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Interactively browse files in the Sietch vault",
+	Long: `Open an interactive browser over the files in your Sietch vault.
+
+Use the arrow keys to move through the file list and type '/' to search.
+Selecting a file shows its metadata and deduplication statistics and lets you
+mark it for retrieval or deletion. Marked files are processed in one go with
+the same logic as 'sietch get' and 'sietch delete', and a sync with peers on
+the local network can be started from the menu.
+
+Example:
+  sietch browse`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+
+		marks := make(map[string]string)
+		cursor := 0
+
+		for {
+			manifest, err := manager.GetManifest()
+			if err != nil {
+				return fmt.Errorf("failed to get vault manifest: %v", err)
+			}
+
+			files := filterAndSortFiles(manifest.Files, "", "path", lsFilterOptions{})
+			pruneBrowseMarks(marks, files)
+			items := buildBrowseItems(files, buildChunkIndex(manifest.Files), marks)
+
+			selectPrompt := promptui.Select{
+				Label:     fmt.Sprintf("Vault: %d files (%d marked)", len(files), len(marks)),
+				Items:     items,
+				Size:      15,
+				CursorPos: min(cursor, len(items)-1),
+				Templates: &promptui.SelectTemplates{
+					Label:    "{{ . }}",
+					Active:   "▸ {{ .Label | cyan }}",
+					Inactive: "  {{ .Label }}",
+					Selected: "{{ .Label }}",
+					Details:  "{{ .Details }}",
+				},
+				Searcher: func(input string, index int) bool {
+					return strings.Contains(strings.ToLower(items[index].Path), strings.ToLower(input))
+				},
+			}
+
+			index, _, err := selectPrompt.Run()
+			if err != nil {
+				if errors.Is(err, promptui.ErrInterrupt) || errors.Is(err, promptui.ErrEOF) {
+					return nil
+				}
+				return fmt.Errorf("browse failed: %v", err)
+			}
+			cursor = index
+
+			item := items[index]
+			switch item.Action {
+			case browseActionQuit:
+				return nil
+			case browseActionSync:
+				// Running sync directly skips the lock its own invocation would take
+				err := withVaultLock(cmd, vaultRoot, func() error { return syncCmd.RunE(syncCmd, nil) })
+				if err != nil {
+					fmt.Printf("✗ Sync failed: %v\n", err)
+				}
+			case browseActionRetrieve:
+				if err := retrieveMarkedFiles(marks); err != nil {
+					fmt.Printf("✗ %v\n", err)
+				}
+			case browseActionDelete:
+				if err := deleteMarkedFiles(cmd, vaultRoot, marks); err != nil {
+					fmt.Printf("✗ %v\n", err)
+				}
+			case browseActionFile:
+				if err := promptFileAction(item, marks); err != nil {
+					if errors.Is(err, promptui.ErrInterrupt) || errors.Is(err, promptui.ErrEOF) {
+						return nil
+					}
+					return err
+				}
+			}
+		}
+	},
+}
+
+// buildBrowseItems returns the menu entries followed by one row per file
+func buildBrowseItems(files []config.FileManifest, chunkRefs map[string][]string, marks map[string]string) []browseItem {
+	retrieveCount := len(markedPaths(marks, markRetrieve))
+	deleteCount := len(markedPaths(marks, markDelete))
+
+	items := []browseItem{
+		{Label: fmt.Sprintf("[Retrieve %d marked file(s)]", retrieveCount), Action: browseActionRetrieve},
+		{Label: fmt.Sprintf("[Delete %d marked file(s)]", deleteCount), Action: browseActionDelete},
+		{Label: "[Sync with peers]", Action: browseActionSync},
+		{Label: "[Quit]", Action: browseActionQuit},
+	}
+
+	for _, file := range files {
+		path := file.Destination + file.FilePath
+		items = append(items, browseItem{
+			Label:   formatBrowseLabel(file, marks[path]),
+			Details: formatBrowseDetails(file, chunkRefs),
+			Action:  browseActionFile,
+			Path:    path,
+		})
+	}
+	return items
+}
+
+// formatBrowseLabel renders a file row with its mark and size
+func formatBrowseLabel(file config.FileManifest, mark string) string {
+	indicator := " "
+	switch mark {
+	case markRetrieve:
+		indicator = "G"
+	case markDelete:
+		indicator = "D"
+	}
+	return fmt.Sprintf("[%s] %-10s %s", indicator, util.HumanReadableSize(file.Size), file.Destination+file.FilePath)
+}
+
+// formatBrowseDetails renders the metadata preview shown under the list
+func formatBrowseDetails(file config.FileManifest, chunkRefs map[string][]string) string {
+	var b strings.Builder
+
+	modified := file.ModTime
+	if t, err := time.Parse(time.RFC3339, file.ModTime); err == nil {
+		modified = t.Format("2006-01-02 15:04:05")
+	}
+
+	sharedChunks, savedBytes, sharedWith := deduplication.ComputeDedupStatsForFile(file, chunkRefs)
+
+	fmt.Fprintf(&b, "\n--------- %s ---------\n", file.FilePath)
+	fmt.Fprintf(&b, "Path:          %s\n", file.Destination+file.FilePath)
+	fmt.Fprintf(&b, "Size:          %s\n", util.HumanReadableSize(file.Size))
+	fmt.Fprintf(&b, "Modified:      %s\n", modified)
+	fmt.Fprintf(&b, "Chunks:        %d\n", len(file.Chunks))
+	if len(file.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags:          %s\n", strings.Join(file.Tags, ", "))
+	}
+	if origin := file.Origin(); origin != nil {
+		fmt.Fprintf(&b, "Origin:        %s, synced %s (session %s)\n",
+			describeOrigin(origin), origin.SyncedAt.Local().Format("2006-01-02 15:04:05"), origin.Session)
+		if earlier := len(file.Provenance) - 1; earlier > 0 {
+			fmt.Fprintf(&b, "Synced before: %d time(s) between other vaults\n", earlier)
+		}
+	} else {
+		fmt.Fprintf(&b, "Origin:        local\n")
+	}
+	fmt.Fprintf(&b, "Shared chunks: %d (saved %s)\n", sharedChunks, util.HumanReadableSize(savedBytes))
+	if len(sharedWith) > 0 {
+		fmt.Fprintf(&b, "Shared with:   %s\n", lsui.FormatSharedWith(sharedWith, 3))
+	}
+	return b.String()
+}
+
+// markedPaths returns the sorted vault paths carrying the given mark
+func markedPaths(marks map[string]string, mark string) []string {
+	var paths []string
+	for path, m := range marks {
+		if m == mark {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// pruneBrowseMarks drops marks for files that are no longer in the vault
+func pruneBrowseMarks(marks map[string]string, files []config.FileManifest) {
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file.Destination+file.FilePath] = true
+	}
+	for path := range marks {
+		if !present[path] {
+			delete(marks, path)
+		}
+	}
+}
+
+// promptFileAction lets the user mark or unmark a single file
+func promptFileAction(item browseItem, marks map[string]string) error {
+	actions := []string{"Mark for retrieval", "Mark for deletion", "Clear mark", "Back"}
+	actionPrompt := promptui.Select{
+		Label: item.Path,
+		Items: actions,
+	}
+
+	_, action, err := actionPrompt.Run()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "Mark for retrieval":
+		marks[item.Path] = markRetrieve
+	case "Mark for deletion":
+		marks[item.Path] = markDelete
+	case "Clear mark":
+		delete(marks, item.Path)
+	}
+	return nil
+}
+
+// retrieveMarkedFiles runs 'sietch get' for every file marked for retrieval
+func retrieveMarkedFiles(marks map[string]string) error {
+	paths := markedPaths(marks, markRetrieve)
+	if len(paths) == 0 {
+		return fmt.Errorf("no files marked for retrieval")
+	}
+
+	destPrompt := promptui.Prompt{
+		Label:   "Destination directory",
+		Default: ".",
+	}
+	destDir, err := destPrompt.Run()
+	if err != nil {
+		return fmt.Errorf("retrieval cancelled")
+	}
+
+	for _, path := range paths {
+		if err := getCmd.RunE(getCmd, []string{path, destDir}); err != nil {
+			fmt.Printf("✗ Failed to retrieve %s: %v\n", path, err)
+			continue
+		}
+		delete(marks, path)
+	}
+	return nil
+}
+
+// deleteMarkedFiles runs 'sietch delete' for every file marked for deletion
+// after one confirmation, holding the lock of the vault at vaultRoot
+func deleteMarkedFiles(cmd *cobra.Command, vaultRoot string, marks map[string]string) error {
+	paths := markedPaths(marks, markDelete)
+	if len(paths) == 0 {
+		return fmt.Errorf("no files marked for deletion")
+	}
+
+	confirmPrompt := promptui.Prompt{
+		Label:     fmt.Sprintf("Delete %d file(s) from the vault", len(paths)),
+		IsConfirm: true,
+	}
+	if _, err := confirmPrompt.Run(); err != nil {
+		fmt.Println("Operation canceled")
+		return nil
+	}
+
+	// Confirmation was already given for the whole batch
+	if err := deleteCmd.Flags().Set("force", "true"); err != nil {
+		return fmt.Errorf("failed to configure delete: %v", err)
+	}
+	defer func() { _ = deleteCmd.Flags().Set("force", "false") }()
+
+	return withVaultLock(cmd, vaultRoot, func() error {
+		for _, path := range paths {
+			if err := deleteCmd.RunE(deleteCmd, []string{path}); err != nil {
+				fmt.Printf("✗ Failed to delete %s: %v\n", path, err)
+				continue
+			}
+			delete(marks, path)
+		}
+		return nil
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(browseCmd)
+}
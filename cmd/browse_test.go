@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func TestMarkedPathsAndPrune(t *testing.T) {
+	marks := map[string]string{
+		"docs/b.txt": markRetrieve,
+		"docs/a.txt": markRetrieve,
+		"old.txt":    markDelete,
+	}
+
+	if got := markedPaths(marks, markRetrieve); !reflect.DeepEqual(got, []string{"docs/a.txt", "docs/b.txt"}) {
+		t.Fatalf("markedPaths(retrieve) = %v", got)
+	}
+	if got := markedPaths(marks, markDelete); !reflect.DeepEqual(got, []string{"old.txt"}) {
+		t.Fatalf("markedPaths(delete) = %v", got)
+	}
+
+	files := []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/"},
+		{FilePath: "b.txt", Destination: "docs/"},
+	}
+	pruneBrowseMarks(marks, files)
+	if _, ok := marks["old.txt"]; ok || len(marks) != 2 {
+		t.Fatalf("expected stale mark to be pruned, got %v", marks)
+	}
+}
+
+func TestBuildBrowseItems(t *testing.T) {
+	files := []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+		{FilePath: "b.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}, Tags: []string{"work"}},
+	}
+	marks := map[string]string{"docs/a.txt": markDelete}
+
+	items := buildBrowseItems(files, buildChunkIndex(files), marks)
+	if len(items) != 6 {
+		t.Fatalf("expected 4 menu entries and 2 files, got %d items", len(items))
+	}
+	if items[1].Action != browseActionDelete || !strings.Contains(items[1].Label, "1 marked") {
+		t.Errorf("unexpected delete menu entry: %+v", items[1])
+	}
+
+	fileItem := items[4]
+	if fileItem.Action != browseActionFile || fileItem.Path != "docs/a.txt" {
+		t.Fatalf("unexpected file item: %+v", fileItem)
+	}
+	if !strings.HasPrefix(fileItem.Label, "[D]") {
+		t.Errorf("expected delete mark in label, got %q", fileItem.Label)
+	}
+	if !strings.Contains(fileItem.Details, "Shared chunks: 1") || !strings.Contains(fileItem.Details, "docs/b.txt") {
+		t.Errorf("details missing dedup info: %s", fileItem.Details)
+	}
+	if !strings.Contains(items[5].Details, "Tags:          work") {
+		t.Errorf("details missing tags: %s", items[5].Details)
+	}
+	if !strings.HasPrefix(items[5].Label, "[ ]") {
+		t.Errorf("expected unmarked label, got %q", items[5].Label)
+	}
+}
+
+func TestBrowseActionsHoldVaultLock(t *testing.T) {
+	vaultRoot := testutil.TempDir(t, "browse-lock")
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var held *lock.Owner
+	err := withVaultLock(browseCmd, vaultRoot, func() error {
+		var err error
+		held, err = lock.Holder(vaultRoot)
+		return err
+	})
+	if err != nil || held == nil || held.PID != os.Getpid() {
+		t.Fatalf("expected the lock held during the action, got %+v (%v)", held, err)
+	}
+	if after, _ := lock.Holder(vaultRoot); after != nil {
+		t.Errorf("expected the lock released after the action, held by %s", after)
+	}
+}
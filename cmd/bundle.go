@@ -0,0 +1,323 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// bundleCmd groups the commands syncing vaults through files
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Sync with vaults that cannot be reached, through bundle files",
+	Long: `Sync vaults that never share a network by carrying files between them,
+for example on a USB stick.
+
+The receiving vault first writes a have-list of what it holds. The sending
+vault reads it and packs the files the receiver lacks, the chunks they need
+and its deletions into a bundle. Applying the bundle merges it like a sync.
+
+If the have-list comes from a trusted peer, the bundle only holds the files
+that peer may fetch under its allowed_paths.
+
+Every bundle created with --for is recorded, so later bundles can name the
+vault instead of a have-list: they only hold the manifests, deletions and
+chunks added since the last one, assuming earlier bundles are applied. If a
+bundle is lost, build the next one from a fresh have-list.
+
+Examples:
+  sietch bundle have /media/usb/laptop.have                  # On the receiving vault
+  sietch bundle create --for /media/usb/laptop.have /media/usb/out.sietchbundle
+  sietch bundle apply /media/usb/out.sietchbundle            # Back on the receiving vault
+  sietch bundle create --for laptop /media/usb/next.sietchbundle # Only what changed since
+  sietch bundle create full.sietchbundle                     # Everything, for an empty vault`,
+}
+
+var bundleHaveCmd = &cobra.Command{
+	Use:   "have <file>",
+	Short: "Write the have-list of this vault, for building a bundle for it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, syncService, err := openBundleVault()
+		if err != nil {
+			return err
+		}
+		have, err := syncService.HaveList()
+		if err != nil {
+			return err
+		}
+		vaultCfg, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault config: %v", err)
+		}
+		if vaultCfg.Sync.RSA != nil {
+			if id, err := vaultPeerID(vaultRoot, vaultCfg); err == nil {
+				have.PeerID = id.String()
+			} else {
+				fmt.Printf("Warning: have-list will not name this vault's peer ID: %v\n", err)
+			}
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would write a have-list of %d files and %d chunks to %s\n",
+				len(have.Files), len(have.Chunks), args[0])
+			return nil
+		}
+		if err := writeFileAtomic(args[0], have.Write); err != nil {
+			return fmt.Errorf("failed to write have-list: %v", err)
+		}
+		fmt.Printf("✓ Wrote have-list of %d files and %d chunks to %s\n", len(have.Files), len(have.Chunks), args[0])
+		return nil
+	},
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create [--for <have-list|vault>] <out.sietchbundle>",
+	Short: "Pack what another vault lacks into a bundle",
+	Long: `Pack the files and chunks the vault described by a have-list lacks, along
+with this vault's deletions, into a bundle. Without --for the bundle holds
+every file, for a vault starting empty.
+
+Giving --for the name or vault ID of a vault bundled for before builds on
+the last bundle for it: only what changed since is packed. --full repacks
+every file and deletion the vault is not known to hold.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, syncService, err := openBundleVault()
+		if err != nil {
+			return err
+		}
+		vaultCfg, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault config: %v", err)
+		}
+
+		syncService.FullSync, _ = cmd.Flags().GetBool("full")
+
+		var have *p2p.HaveList
+		var cursor string
+		var rules []string
+		target := "any vault"
+		if dest, _ := cmd.Flags().GetString("for"); dest != "" {
+			if info, statErr := os.Stat(dest); statErr == nil && info.Mode().IsRegular() {
+				if have, err = readHaveListFile(dest); err != nil {
+					return err
+				}
+			} else {
+				export, err := syncService.LoadBundleExport(dest)
+				if err != nil {
+					return err
+				}
+				have, cursor = &export.Have, export.Cursor
+				if !syncService.FullSync {
+					fmt.Printf("ℹ️  Bundling changes since the bundle of %s\n", export.Updated.Local().Format("2006-01-02 15:04"))
+				}
+			}
+			target = have.VaultName
+			if target == "" {
+				target = have.VaultID
+			}
+			if tp := trustedPeerByID(vaultCfg, have.PeerID); tp != nil {
+				rules = vaultCfg.Sync.AllowedPathsFor(*tp)
+				if tp.Name != "" {
+					target = tp.Name
+				}
+			} else {
+				fmt.Printf("⚠️  %s is not a trusted peer; no access rules apply to the bundle\n", target)
+			}
+		}
+
+		header, err := syncService.BundleContents(have, cursor, rules)
+		if err != nil {
+			return err
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would write %d files, %d deletions and %d chunks (%s) for %s to %s\n",
+				len(header.Manifest.Files), len(header.Manifest.Tombstones), len(header.Chunks),
+				util.HumanReadableSize(header.Bytes()), target, args[0])
+			return nil
+		}
+
+		write := func(w io.Writer) error { return syncService.WriteBundle(w, header) }
+		if err := writeFileAtomic(args[0], write); err != nil {
+			return fmt.Errorf("failed to write bundle: %v", err)
+		}
+		if have != nil {
+			if err := syncService.RecordBundleExport(have, header); err != nil {
+				fmt.Printf("Warning: the next bundle for %s will not be incremental: %v\n", target, err)
+			}
+		}
+		fmt.Printf("📦 Wrote bundle for %s to %s\n", target, args[0])
+		fmt.Printf("   Files:     %d\n", len(header.Manifest.Files))
+		fmt.Printf("   Deletions: %d\n", len(header.Manifest.Tombstones))
+		fmt.Printf("   Chunks:    %d (%s)\n", len(header.Chunks), util.HumanReadableSize(header.Bytes()))
+		return nil
+	},
+}
+
+var bundleApplyCmd = &cobra.Command{
+	Use:   "apply <file>",
+	Short: "Merge a bundle into this vault",
+	Long: `Merge the files, chunks and deletions of a bundle into this vault, as a
+sync with the vault that created it would. Existing files are never
+overwritten. Chunks that do not match the hashes in the bundle are skipped
+along with the files that use them.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, syncService, err := openBundleVault()
+		if err != nil {
+			return err
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		syncService.Verbose = verbose
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open bundle: %v", err)
+		}
+		defer f.Close()
+
+		// Progress goes to stderr so structured output stays parseable
+		out := os.Stdout
+		if format != outputTable {
+			out = os.Stderr
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			header, plan, err := syncService.PlanBundle(f)
+			if err != nil {
+				return err
+			}
+			describeBundle(out, vaultRoot, header)
+			if err := displaySyncPlan(os.Stdout, format, plan); err != nil {
+				return err
+			}
+			return pendingChangesError(plan)
+		}
+
+		header, result, err := syncService.ApplyBundle(f, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to apply bundle: %v", err)
+		}
+		describeBundle(out, vaultRoot, header)
+		if err := displaySyncResults(os.Stdout, format, result); err != nil {
+			return err
+		}
+		return incompleteSyncError(result)
+	},
+}
+
+// openBundleVault returns the vault in the working directory and a sync
+// service for it that needs no network
+func openBundleVault() (string, *p2p.SyncService, error) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return "", nil, fmt.Errorf("not inside a vault: %v", err)
+	}
+	vaultMgr, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load vault: %v", err)
+	}
+	return vaultRoot, p2p.NewLocalSyncService(vaultMgr), nil
+}
+
+// describeBundle notes where a bundle came from, and whether it was built
+// for another vault
+func describeBundle(w io.Writer, vaultRoot string, header *p2p.BundleHeader) {
+	source := header.VaultName
+	if source == "" {
+		source = header.VaultID
+	}
+	fmt.Fprintf(w, "📦 Bundle from %s, created %s\n", source, header.Created.Local().Format("2006-01-02 15:04"))
+	if header.For == "" {
+		return
+	}
+	if cfg, err := config.LoadVaultConfig(vaultRoot); err == nil && cfg.VaultID != header.For {
+		fmt.Fprintln(w, "⚠️  The bundle was built from another vault's have-list; files this vault lacks may be missing from it")
+	}
+}
+
+func readHaveListFile(path string) (*p2p.HaveList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open have-list: %v", err)
+	}
+	defer f.Close()
+	return p2p.ReadHaveList(f)
+}
+
+// trustedPeerByID returns the trusted peer with the given ID, or nil
+func trustedPeerByID(cfg *config.VaultConfig, id string) *config.TrustedPeer {
+	if cfg.Sync.RSA == nil || id == "" {
+		return nil
+	}
+	for i := range cfg.Sync.RSA.TrustedPeers {
+		if cfg.Sync.RSA.TrustedPeers[i].ID == id {
+			return &cfg.Sync.RSA.TrustedPeers[i]
+		}
+	}
+	return nil
+}
+
+// vaultPeerID returns the libp2p peer ID of the vault's sync key
+func vaultPeerID(vaultRoot string, cfg *config.VaultConfig) (peer.ID, error) {
+	privateKey, _, err := loadRSAKeys(vaultRoot, cfg)
+	if err != nil {
+		return "", err
+	}
+	libp2pKey, err := rsaToLibp2pPrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(libp2pKey)
+}
+
+// writeFileAtomic writes a file through write, replacing path only once the
+// whole file has been written
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleHaveCmd)
+	bundleCmd.AddCommand(bundleCreateCmd)
+	bundleCmd.AddCommand(bundleApplyCmd)
+
+	bundleCreateCmd.Flags().String("for", "", "Have-list of the vault the bundle is for, or the name or ID of a vault bundled for before")
+	bundleCreateCmd.Flags().Bool("full", false, "Consider every file and deletion instead of changes since the last bundle")
+	bundleApplyCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+}
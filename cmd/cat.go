@@ -0,0 +1,183 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// catPrefetch is how many decoded chunks may wait for a slow reader. Once the
+// buffer is full chunk decoding blocks, so memory stays bounded however large the file is.
+const catPrefetch = 2
+
+// catCmd represents the cat command
+var catCmd = &cobra.Command{
+	Use:   "cat <file_path>",
+	Short: "Stream a file from the Sietch vault to stdout",
+	Long: `Write the decrypted content of a stored file to stdout.
+
+Chunks are decoded in order and streamed as they become ready, so the file
+is never held in memory as a whole and the output can be piped straight into
+other tools. Prompts and messages go to stderr.
+
+Examples:
+  sietch cat notes/todo.txt
+  sietch cat backups/db.sql.gz | gunzip | psql
+  sietch cat --range 1GB-2GB vm/disk.img > part.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Only file content may reach stdout; everything else is redirected
+		out := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = out }()
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		fileManifest, err := findFileManifest(vaultRoot, args[0])
+		if err != nil {
+			return fmt.Errorf("file not found in vault: %v", err)
+		}
+		if fileManifest.Symlink != "" {
+			return fmt.Errorf("%s is a symlink to %s", args[0], fileManifest.Symlink)
+		}
+
+		start, end := int64(0), fileManifest.Size
+		if rangeSpec, _ := cmd.Flags().GetString("range"); rangeSpec != "" {
+			if start, end, err = parseByteRange(rangeSpec, fileManifest.Size); err != nil {
+				return err
+			}
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return fmt.Errorf("failed to get passphrase: %v", err)
+		}
+
+		skipVerify, _ := cmd.Flags().GetBool(skipVerification)
+		progressMgr := progress.NewManager(progress.Options{Quiet: true})
+		ctx := progressMgr.SetupCancellation(context.Background())
+
+		r := &retriever{
+			vaultRoot:   vaultRoot,
+			vaultConfig: vaultConfig,
+			passphrase:  passphrase,
+			skipVerify:  skipVerify,
+			quiet:       true,
+			progressMgr: progressMgr,
+			cache:       openChunkCache(vaultRoot, vaultConfig),
+		}
+
+		w := bufio.NewWriter(out)
+		if err := r.streamFile(ctx, fileManifest, w, start, end); err != nil {
+			return err
+		}
+		return w.Flush()
+	},
+}
+
+// streamedChunk is a decoded chunk handed from the decoder to the writer
+type streamedChunk struct {
+	offset int64
+	data   []byte
+	err    error
+}
+
+// streamFile writes bytes [start, end) of a stored file to w in order. Chunks
+// are decoded one step ahead of the writer through a bounded channel, and holes
+// of sparse files are written as zeros.
+func (r *retriever) streamFile(ctx context.Context, fileManifest *config.FileManifest, w io.Writer, start, end int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	offsets := chunkOffsets(fileManifest)
+	chunks := make(chan streamedChunk, catPrefetch)
+	go func() {
+		defer close(chunks)
+		for i, chunkRef := range fileManifest.Chunks {
+			chunkStart, chunkEnd := offsets[i], offsets[i]+chunkRef.Size
+			if chunkEnd <= start || chunkStart >= end {
+				continue
+			}
+			data, err := r.readChunk(ctx, chunkRef)
+			if err == nil && int64(len(data)) != chunkRef.Size {
+				err = fmt.Errorf("chunk %d has %d bytes, manifest records %d", i, len(data), chunkRef.Size)
+			}
+			select {
+			case chunks <- streamedChunk{offset: chunkStart, data: data, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	pos := start
+	for chunk := range chunks {
+		if chunk.err != nil {
+			return chunk.err
+		}
+		from, to := max(start, chunk.offset), min(end, chunk.offset+int64(len(chunk.data)))
+		if err := writeZeros(w, from-pos); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.data[from-chunk.offset : to-chunk.offset]); err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+		pos = to
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("operation cancelled")
+	}
+
+	// A trailing hole
+	return writeZeros(w, end-pos)
+}
+
+// writeZeros writes n zero bytes to w without allocating n bytes at once
+func writeZeros(w io.Writer, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	zeros := make([]byte, min(n, 64*1024))
+	for n > 0 {
+		written, err := w.Write(zeros[:min(n, int64(len(zeros)))])
+		if err != nil {
+			return fmt.Errorf("failed to write output: %v", err)
+		}
+		n -= int64(written)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(catCmd)
+
+	catCmd.ValidArgsFunction = completeVaultPaths
+
+	catCmd.Flags().String("range", "", "Stream only bytes START-END of the file (e.g. 100MB-200MB, END exclusive)")
+	catCmd.Flags().Bool(skipVerification, false, "Skip integrity verification (for recovery scenarios)")
+	catCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	catCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+// storeTestChunk writes an unencrypted, uncompressed chunk into the vault and returns its ref
+func storeTestChunk(t *testing.T, vaultRoot string, data []byte, offset int64) config.ChunkRef {
+	t.Helper()
+	hash := sha256Sum(data)
+	chunksDir := filepath.Join(vaultRoot, ".sietch", "chunks")
+	if err := os.MkdirAll(chunksDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(chunksDir, hash), data, 0o644); err != nil {
+		t.Fatalf("write chunk: %v", err)
+	}
+	return config.ChunkRef{Hash: hash, Size: int64(len(data)), Offset: offset}
+}
+
+func TestStreamFile(t *testing.T) {
+	vaultRoot := testutil.TempDir(t, "cat-stream")
+	r := &retriever{
+		vaultRoot:   vaultRoot,
+		vaultConfig: &config.VaultConfig{Encryption: config.EncryptionConfig{Type: "none"}},
+		quiet:       true,
+		progressMgr: progress.NewManager(progress.Options{Quiet: true}),
+	}
+
+	// A sparse file: 4 zero bytes, "abcd", 4 zero bytes, "efgh", 2 trailing zero bytes
+	m := &config.FileManifest{
+		Size: 18,
+		Chunks: []config.ChunkRef{
+			storeTestChunk(t, vaultRoot, []byte("abcd"), 4),
+			storeTestChunk(t, vaultRoot, []byte("efgh"), 12),
+		},
+		Holes: []config.HoleExtent{{Offset: 0, Length: 4}, {Offset: 8, Length: 4}, {Offset: 16, Length: 2}},
+	}
+	want := []byte("\x00\x00\x00\x00abcd\x00\x00\x00\x00efgh\x00\x00")
+
+	var buf bytes.Buffer
+	if err := r.streamFile(context.Background(), m, &buf, 0, m.Size); err != nil {
+		t.Fatalf("streamFile: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("streamFile = %q, want %q", buf.Bytes(), want)
+	}
+
+	buf.Reset()
+	if err := r.streamFile(context.Background(), m, &buf, 6, 14); err != nil {
+		t.Fatalf("streamFile range: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want[6:14]) {
+		t.Errorf("streamFile range = %q, want %q", buf.Bytes(), want[6:14])
+	}
+
+	// A missing chunk surfaces as an error
+	m.Chunks = append(m.Chunks, config.ChunkRef{Hash: "missing", Size: 1, Offset: 17})
+	if err := r.streamFile(context.Background(), m, &buf, 0, m.Size); err == nil {
+		t.Error("expected an error for a missing chunk")
+	}
+}
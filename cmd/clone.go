@@ -0,0 +1,289 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/internal/vault"
+)
+
+// cloneCmd represents the clone command
+var cloneCmd = &cobra.Command{
+	Use:   "clone <peer-address> <directory>",
+	Short: "Create a vault by copying another vault from a peer",
+	Long: `Create a new vault in directory from a vault served by a peer.
+
+The peer's vault configuration is copied without its encryption key or sync
+identity, the local vault structure is created with a new sync key pair, the
+peer is trusted and a full sync fetches every file. The peer must be running
+a command that serves its vault, such as 'sietch discover --continuous'.
+
+The peer only serves vaults it trusts, and the new vault's sync key is
+created by clone. Run 'sietch pair --invite --serve' on the peer and pass its
+token with --invite, so both vaults trust each other before the sync.
+
+Encrypted files can only be read once the vault's key is present. Pass it
+with --key-file or copy it to .sietch/keys/secret.key afterwards.
+
+If the peer syncs in a private network (sync.network_key), pass a copy of its
+swarm key with --network-key; without it the peer cannot be reached.
+
+With --replica the new vault is a read-only replica: add, delete, tag and
+watch are refused and sync only pulls from peers, so it never diverges from
+the source.
+
+Examples:
+  sietch clone /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID ./my-vault --invite sietch-invite1:...
+  sietch clone /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID ./my-vault --key-file secret.key
+  sietch clone /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID ./archive --replica`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return fmt.Errorf("clone does not support --dry-run; use 'sietch sync --dry-run' from an existing clone to preview transfers")
+		}
+
+		maddr, err := multiaddr.NewMultiaddr(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid peer address: %v", err)
+		}
+		info, err := peer.AddrInfoFromP2pAddr(maddr)
+		if err != nil {
+			return fmt.Errorf("failed to parse peer info: %v", err)
+		}
+
+		var inv *p2p.Invitation
+		if token, _ := cmd.Flags().GetString("invite"); token != "" {
+			if inv, err = p2p.ParseInvitation(token); err != nil {
+				return err
+			}
+			if inv.PeerID != info.ID {
+				return fmt.Errorf("the invitation is from peer %s, not %s", inv.PeerID, info.ID)
+			}
+		}
+
+		force, _ := cmd.Flags().GetBool("force")
+		absVaultPath, err := vault.PrepareVaultPath(filepath.Dir(args[1]), filepath.Base(args[1]), force)
+		if err != nil {
+			return err
+		}
+		_, statErr := os.Stat(absVaultPath)
+		existed := statErr == nil
+
+		keyFilePath, _ := cmd.Flags().GetString("key-file")
+		var keyMaterial []byte
+		if keyFilePath != "" {
+			if keyMaterial, err = os.ReadFile(keyFilePath); err != nil {
+				return fmt.Errorf("failed to read key file: %v", err)
+			}
+		}
+
+		networkKeyPath, _ := cmd.Flags().GetString("network-key")
+		var networkKey []byte
+		if networkKeyPath != "" {
+			if _, err := p2p.LoadNetworkKey(networkKeyPath); err != nil {
+				return err
+			}
+			if networkKey, err = os.ReadFile(networkKeyPath); err != nil {
+				return fmt.Errorf("failed to read network key: %v", err)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signalChan
+			fmt.Println("\nReceived interrupt signal, shutting down...")
+			cancel()
+		}()
+
+		port, _ := cmd.Flags().GetInt("port")
+		listen, err := listenAddrsFromFlags(cmd, nil)
+		if err != nil {
+			return err
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		forceTrust, _ := cmd.Flags().GetBool("force-trust")
+		replica, _ := cmd.Flags().GetBool("replica")
+		if err := runClone(ctx, info, inv, absVaultPath, keyMaterial, networkKey, port, listen, verbose, forceTrust, replica); err != nil {
+			// Only remove what clone created, never files already in the directory
+			if existed {
+				_ = os.RemoveAll(filepath.Join(absVaultPath, ".sietch"))
+				_ = os.Remove(filepath.Join(absVaultPath, "vault.yaml"))
+			} else {
+				cleanupOnError(absVaultPath)
+			}
+			return err
+		}
+		return nil
+	},
+}
+
+// runClone bootstraps a vault at absVaultPath from the peer described by
+// info, pairing with it first if inv is set
+func runClone(ctx context.Context, info *peer.AddrInfo, inv *p2p.Invitation, absVaultPath string, keyMaterial, networkKey []byte, port int, listen []string, verbose, forceTrust, replica bool) error {
+	if err := fs.CreateVaultStructure(absVaultPath); err != nil {
+		return fmt.Errorf("failed to create vault structure: %w", err)
+	}
+
+	// A minimal configuration gives the new vault a sync identity so it can
+	// talk to the peer; it is replaced by the peer's configuration below
+	bootstrap := &config.VaultConfig{
+		Name:          filepath.Base(absVaultPath),
+		VaultID:       uuid.New().String(),
+		SchemaVersion: config.CurrentSchemaVersion,
+	}
+	bootstrap.Encryption.Type = constants.EncryptionTypeNone
+	bootstrap.Sync.Enabled = true
+	bootstrap.Sync.RSA = &config.RSAConfig{
+		KeySize:      constants.DefaultRSAKeySize,
+		TrustedPeers: []config.TrustedPeer{},
+	}
+	if err := keys.GenerateRSAKeyPair(absVaultPath, bootstrap); err != nil {
+		return fmt.Errorf("failed to generate RSA keys for sync: %w", err)
+	}
+	if len(networkKey) > 0 {
+		keyPath := filepath.Join(absVaultPath, p2p.DefaultNetworkKeyPath)
+		if err := os.MkdirAll(filepath.Dir(keyPath), constants.SecureDirPerms); err != nil {
+			return fmt.Errorf("failed to create key directory: %v", err)
+		}
+		if err := os.WriteFile(keyPath, networkKey, constants.SecureFilePerms); err != nil {
+			return fmt.Errorf("failed to write network key: %v", err)
+		}
+		bootstrap.Sync.NetworkKey = p2p.DefaultNetworkKeyPath
+	}
+	if err := config.SaveVaultConfig(absVaultPath, bootstrap); err != nil {
+		return fmt.Errorf("failed to save vault configuration: %v", err)
+	}
+
+	host, syncService, err := startSyncNode(ctx, absVaultPath, bootstrap, port, listen, verbose)
+	if err != nil {
+		return err
+	}
+	defer host.Close()
+
+	fmt.Printf("🔄 Connecting to peer: %s\n", info.ID.String())
+	if err := host.Connect(ctx, *info); err != nil {
+		return fmt.Errorf("failed to connect to peer: %v", err)
+	}
+	if inv != nil {
+		// Saves the peer into the bootstrap configuration's trusted peers, and us into the peer's
+		if _, err := syncService.AcceptInvitation(ctx, inv); err != nil {
+			return fmt.Errorf("pairing failed: %v", err)
+		}
+		if fingerprint, err := syncService.GetPeerFingerprint(info.ID); err == nil {
+			fmt.Printf("✅ Paired with peer (fingerprint: %s)\n", fingerprint)
+		}
+	} else {
+		if _, err := syncService.VerifyAndExchangeKeys(ctx, info.ID); err != nil {
+			return fmt.Errorf("key exchange failed: %v", err)
+		}
+		if fingerprint, err := syncService.GetPeerFingerprint(info.ID); err == nil {
+			fmt.Printf("Peer fingerprint: %s\n", fingerprint)
+		}
+		if !forceTrust && !promptForTrust() {
+			return fmt.Errorf("clone canceled - peer not trusted")
+		}
+		// Saves the peer into the bootstrap configuration's trusted peers
+		if err := syncService.AddTrustedPeer(ctx, info.ID); err != nil {
+			return fmt.Errorf("failed to add trusted peer: %v", err)
+		}
+	}
+
+	remoteCfg, err := syncService.GetRemoteConfig(ctx, info.ID)
+	if err != nil {
+		if inv == nil {
+			return fmt.Errorf("failed to get vault configuration from peer: %v (run 'sietch pair --invite --serve' on the peer and clone with --invite)", err)
+		}
+		return fmt.Errorf("failed to get vault configuration from peer: %v", err)
+	}
+	if remoteCfg.SchemaVersion > config.CurrentSchemaVersion {
+		return fmt.Errorf("%w: peer vault uses schema v%d but this version of sietch supports up to v%d",
+			config.ErrUnsupportedSchema, remoteCfg.SchemaVersion, config.CurrentSchemaVersion)
+	}
+
+	vaultConfig := cloneConfig(remoteCfg, bootstrap, absVaultPath)
+	vaultConfig.Replica = replica
+	if len(keyMaterial) > 0 {
+		if vaultConfig.Encryption.KeyPath == "" {
+			return fmt.Errorf("--key-file given but the peer vault uses %s encryption without a key file", vaultConfig.Encryption.Type)
+		}
+		if err := os.MkdirAll(filepath.Dir(vaultConfig.Encryption.KeyPath), constants.SecureDirPerms); err != nil {
+			return fmt.Errorf("failed to create key directory: %v", err)
+		}
+		if err := os.WriteFile(vaultConfig.Encryption.KeyPath, keyMaterial, constants.SecureFilePerms); err != nil {
+			return fmt.Errorf("failed to write key file: %v", err)
+		}
+	}
+	if err := config.SaveVaultConfig(absVaultPath, vaultConfig); err != nil {
+		return fmt.Errorf("failed to save vault configuration: %v", err)
+	}
+	fmt.Printf("✅ Copied configuration of vault '%s'\n", vaultConfig.Name)
+
+	fmt.Println("📝 Starting initial synchronization...")
+	result, err := syncService.SyncWithPeer(ctx, info.ID)
+	if err != nil {
+		return fmt.Errorf("sync failed: %v", err)
+	}
+	if err := displaySyncResults(os.Stdout, outputTable, result); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✅ Cloned vault to %s\n", absVaultPath)
+	if vaultConfig.Encryption.KeyPath != "" && len(keyMaterial) == 0 {
+		fmt.Printf("⚠️  Copy the vault key to %s to read encrypted files\n", vaultConfig.Encryption.KeyPath)
+	}
+	return nil
+}
+
+// cloneConfig builds the configuration of a cloned vault from the peer's
+// shareable configuration, keeping the local sync identity and trusted peers
+// and pointing key files at the new vault
+func cloneConfig(remote, local *config.VaultConfig, absVaultPath string) *config.VaultConfig {
+	cfg := *p2p.ShareableConfig(remote)
+	cfg.Sync.RSA = local.Sync.RSA
+	cfg.Sync.NetworkKey = local.Sync.NetworkKey
+	cfg.Sync.Enabled = true
+
+	switch cfg.Encryption.Type {
+	case constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20:
+		cfg.Encryption.KeyPath = filepath.Join(absVaultPath, ".sietch", "keys", "secret.key")
+	default:
+		cfg.Encryption.KeyPath = ""
+	}
+	return &cfg
+}
+
+func init() {
+	rootCmd.AddCommand(cloneCmd)
+
+	cloneCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+	cloneCmd.Flags().StringSlice("listen", nil, "Multiaddrs to listen on while cloning (repeatable)")
+	cloneCmd.Flags().Bool("no-listen", false, "Accept no incoming connections, only dial out to the peer")
+	cloneCmd.Flags().String("key-file", "", "Copy this file into the new vault as its encryption key")
+	cloneCmd.Flags().String("network-key", "", "Copy this swarm key into the new vault to sync in the peer's private network")
+	cloneCmd.Flags().String("invite", "", "Pair with the peer using a token from its 'sietch pair --invite' before cloning")
+	cloneCmd.Flags().BoolP("force-trust", "f", false, "Trust the peer without prompting")
+	cloneCmd.Flags().Bool("force", false, "Overwrite an existing vault in directory")
+	cloneCmd.Flags().Bool("replica", false, "Make the new vault a read-only replica of the peer")
+	cloneCmd.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+}
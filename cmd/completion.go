@@ -0,0 +1,189 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// completeVaultPaths completes the first argument with file paths stored in the vault
+func completeVaultPaths(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	files, ok := loadCompletionFiles()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return vaultPathCandidates(files, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeVaultDirs completes the first argument with destination directories in the vault
+func completeVaultDirs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	files, ok := loadCompletionFiles()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return vaultDirCandidates(files, toComplete), cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// completeGetArgs completes a vault path first, then a local destination directory
+func completeGetArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 1 {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+	return completeVaultPaths(cmd, args, toComplete)
+}
+
+// completeRestoreArgs completes a vault directory first, then a local target directory
+func completeRestoreArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 1 {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+	return completeVaultDirs(cmd, args, toComplete)
+}
+
+// completeTagTarget completes the vault path of tag subcommands, switching to
+// directories when --prefix is set, and existing tag names for the tag argument
+func completeTagTarget(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 1 && cmd != tagListCmd {
+		files, ok := loadCompletionFiles()
+		if !ok {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return tagCandidates(files, toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	if prefix, _ := cmd.Flags().GetBool("prefix"); prefix {
+		return completeVaultDirs(cmd, args, toComplete)
+	}
+	return completeVaultPaths(cmd, args, toComplete)
+}
+
+// completePeers completes trusted peer names/IDs and known peer addresses for sync
+func completePeers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	vaultCfg, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return peerCandidates(vaultCfg, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// loadCompletionFiles reads the manifests of the current vault, silently
+// reporting failure since completion must never print errors
+func loadCompletionFiles() ([]config.FileManifest, bool) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return nil, false
+	}
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, false
+	}
+	manifest, err := manager.GetManifest()
+	if err != nil {
+		return nil, false
+	}
+	return manifest.Files, true
+}
+
+// vaultPathCandidates returns the vault paths starting with toComplete, with sizes as descriptions
+func vaultPathCandidates(files []config.FileManifest, toComplete string) []string {
+	var candidates []string
+	for _, file := range files {
+		fullPath := file.Destination + file.FilePath
+		if strings.HasPrefix(fullPath, toComplete) {
+			candidates = append(candidates, fmt.Sprintf("%s\t%s", fullPath, util.HumanReadableSize(file.Size)))
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// vaultDirCandidates returns every destination directory (including parents) starting with toComplete
+func vaultDirCandidates(files []config.FileManifest, toComplete string) []string {
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, file := range files {
+		parts := strings.Split(strings.Trim(file.Destination, "/"), "/")
+		dir := ""
+		for _, part := range parts {
+			if part == "" || part == "." {
+				continue
+			}
+			dir += part + "/"
+			if !seen[dir] && strings.HasPrefix(dir, toComplete) {
+				seen[dir] = true
+				candidates = append(candidates, dir)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// tagCandidates returns the tags used in the vault starting with toComplete
+func tagCandidates(files []config.FileManifest, toComplete string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		for _, tag := range file.Tags {
+			if !seen[tag] && strings.HasPrefix(tag, toComplete) {
+				seen[tag] = true
+				candidates = append(candidates, tag)
+			}
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// peerCandidates returns trusted peer names and IDs plus known peer addresses starting with toComplete
+func peerCandidates(cfg *config.VaultConfig, toComplete string) []string {
+	var candidates []string
+	seen := make(map[string]bool)
+	add := func(value, description string) {
+		if value == "" || seen[value] || !strings.HasPrefix(value, toComplete) {
+			return
+		}
+		seen[value] = true
+		if description != "" {
+			value += "\t" + description
+		}
+		candidates = append(candidates, value)
+	}
+
+	if cfg.Sync.RSA != nil {
+		for _, p := range cfg.Sync.RSA.TrustedPeers {
+			if p.Name != "" {
+				add(p.Name, "trusted peer "+p.ID)
+			}
+			add(p.ID, p.Name)
+		}
+	}
+	for _, addr := range cfg.Sync.KnownPeers {
+		add(addr, "known peer")
+	}
+	return candidates
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func completionTestFiles() []config.FileManifest {
+	return []config.FileManifest{
+		{FilePath: "report.pdf", Destination: "docs/2024/", Size: 2048, Tags: []string{"work"}},
+		{FilePath: "notes.txt", Destination: "docs/", Size: 10, Tags: []string{"work", "personal"}},
+		{FilePath: "photo.jpg", Destination: "pics/", Size: 1},
+	}
+}
+
+func TestVaultPathCandidates(t *testing.T) {
+	got := vaultPathCandidates(completionTestFiles(), "docs/")
+	want := []string{"docs/2024/report.pdf\t2.0 KB", "docs/notes.txt\t10 B"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("vaultPathCandidates = %q, want %q", got, want)
+	}
+
+	if got := vaultPathCandidates(completionTestFiles(), "missing"); len(got) != 0 {
+		t.Errorf("expected no candidates, got %v", got)
+	}
+}
+
+func TestVaultDirCandidates(t *testing.T) {
+	got := vaultDirCandidates(completionTestFiles(), "")
+	want := []string{"docs/", "docs/2024/", "pics/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("vaultDirCandidates = %v, want %v", got, want)
+	}
+
+	got = vaultDirCandidates(completionTestFiles(), "docs/2")
+	if !reflect.DeepEqual(got, []string{"docs/2024/"}) {
+		t.Errorf("vaultDirCandidates with prefix = %v", got)
+	}
+}
+
+func TestTagCandidates(t *testing.T) {
+	got := tagCandidates(completionTestFiles(), "")
+	if !reflect.DeepEqual(got, []string{"personal", "work"}) {
+		t.Errorf("tagCandidates = %v", got)
+	}
+}
+
+func TestPeerCandidatesAndResolve(t *testing.T) {
+	const peerID = "12D3KooWGzBvK8n7gqxHCGNYP3XHGz9pA99iVh6vQwzc1vvDLjkg"
+	cfg := &config.VaultConfig{
+		Sync: config.SyncConfig{
+			RSA: &config.RSAConfig{
+				TrustedPeers: []config.TrustedPeer{{ID: peerID, Name: "laptop"}},
+			},
+			KnownPeers: []string{"/ip4/10.0.0.2/tcp/4001/p2p/" + peerID},
+		},
+	}
+
+	got := peerCandidates(cfg, "")
+	want := []string{
+		"laptop\ttrusted peer " + peerID,
+		peerID + "\tlaptop",
+		"/ip4/10.0.0.2/tcp/4001/p2p/" + peerID + "\tknown peer",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("peerCandidates = %q, want %q", got, want)
+	}
+	if got := peerCandidates(cfg, "lap"); len(got) != 1 {
+		t.Errorf("expected one candidate for prefix, got %v", got)
+	}
+
+	expected, err := peer.Decode(peerID)
+	if err != nil {
+		t.Fatalf("decode test peer ID: %v", err)
+	}
+	for _, ref := range []string{"laptop", peerID} {
+		id, err := resolveTrustedPeer(cfg, ref)
+		if err != nil || id != expected {
+			t.Errorf("resolveTrustedPeer(%q) = %v, %v", ref, id, err)
+		}
+	}
+	if _, err := resolveTrustedPeer(cfg, "desktop"); err == nil {
+		t.Error("expected error for unknown peer")
+	}
+}
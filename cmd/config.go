@@ -0,0 +1,159 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read and change vault configuration",
+	Long: `Read and change individual keys in vault.yaml.
+
+Keys are dotted paths through vault.yaml, for example sync.auto_sync or
+deduplication.gc_threshold. Values are checked against the schema before
+vault.yaml is rewritten, and the file is replaced atomically.
+
+Example:
+  sietch config get sync.auto_sync
+  sietch config set sync.auto_sync true
+  sietch config set metadata.tags research,desert`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the value of a configuration key",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		value, err := config.GetValue(vaultConfig, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change the value of a configuration key",
+	Long: `Change the value of a configuration key in vault.yaml.
+
+Lists such as metadata.tags and sync.known_peers are given as comma-separated
+values. Identity, encryption and hashing settings cannot be changed because
+existing chunks depend on them.
+
+Settable keys:
+  ` + strings.Join(config.SettableKeys(), "\n  "),
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, value := args[0], args[1]
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		previous, err := config.GetValue(vaultConfig, key)
+		if err != nil {
+			return err
+		}
+		if err := config.SetValue(vaultConfig, key, value); err != nil {
+			return err
+		}
+		current, _ := config.GetValue(vaultConfig, key)
+
+		if previous == current {
+			fmt.Printf("%s is already %s\n", key, current)
+			return nil
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would set %s: %s → %s\n", key, previous, current)
+			return nil
+		}
+
+		if err := saveVaultConfigTransactional(vaultRoot, vaultConfig, key); err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s: %s → %s\n", key, previous, current)
+		return nil
+	},
+}
+
+// saveVaultConfigTransactional rewrites vault.yaml through the transaction
+// layer so an interrupted write never leaves a truncated configuration
+func saveVaultConfigTransactional(vaultRoot string, vaultConfig *config.VaultConfig, key string) error {
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "config set", "key": key})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+			fmt.Println("txn rollback; configuration was not changed")
+		}
+	}()
+
+	if err := stageVaultConfig(txn, vaultConfig); err != nil {
+		return err
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// stageVaultConfig stages vaultConfig as the new vault.yaml in txn
+func stageVaultConfig(txn *atomic.Transaction, vaultConfig *config.VaultConfig) error {
+	data, err := yaml.Marshal(vaultConfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal configuration: %v", err)
+	}
+	w, err := txn.StageReplace("vault.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to stage vault.yaml: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write vault.yaml: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write vault.yaml: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	rootCmd.AddCommand(configCmd)
+}
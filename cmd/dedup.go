@@ -5,13 +5,19 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
 
+	"github.com/substantialcattle5/sietch/internal/audit"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/deduplication"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/hooks"
 	"github.com/substantialcattle5/sietch/util"
 )
 
@@ -25,14 +31,18 @@ This command provides subcommands for:
 - Getting deduplication statistics
 - Running garbage collection
 - Optimizing storage
+- Finding duplicate files
+- Checking the reference counts of the index
 
 You can also configure deduplication settings interactively using the --setup flag.
 
 Example:
-  sietch dedup --setup   # Configure deduplication settings interactively
-  sietch dedup stats     # Show deduplication statistics
-  sietch dedup gc        # Run garbage collection
-  sietch dedup optimize  # Optimize storage
+  sietch dedup --setup      # Configure deduplication settings interactively
+  sietch dedup stats        # Show deduplication statistics
+  sietch dedup gc           # Run garbage collection
+  sietch dedup optimize     # Optimize storage
+  sietch dedup duplicates   # List files with identical content
+  sietch dedup verify       # Check reference counts against the manifests
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Check if --setup flag is set
@@ -141,10 +151,22 @@ This includes:
 - Space saved through deduplication
 - Number of unreferenced chunks
 
+With --by-path the stored bytes of every destination directory are split into
+unique data and data shared with other files, and --top N lists the files that
+contribute the most duplicated data.
+
 Example:
   sietch dedup stats
+  sietch dedup stats --by-path
+  sietch dedup stats --top 10
+  sietch dedup stats -o json
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
 		vaultRoot, err := fs.FindVaultRoot()
 		if err != nil {
 			return fmt.Errorf("not inside a vault: %v", err)
@@ -170,6 +192,38 @@ Example:
 		// Get statistics
 		stats := dedupManager.GetStats()
 
+		byPath, _ := cmd.Flags().GetBool("by-path")
+		top, _ := cmd.Flags().GetInt("top")
+		if top < 0 {
+			return fmt.Errorf("--top must not be negative")
+		}
+
+		var dirs []dedupPathStats
+		var topFiles []dedupFileStats
+		if byPath || top > 0 {
+			manager, err := config.NewManager(vaultRoot)
+			if err != nil {
+				return fmt.Errorf("failed to create vault manager: %v", err)
+			}
+			manifest, err := manager.GetManifest()
+			if err != nil {
+				return fmt.Errorf("failed to get vault manifest: %v", err)
+			}
+
+			allDirs, allFiles := buildPathDedupStats(manifest.Files)
+			if byPath {
+				dirs = allDirs
+			}
+			topFiles = topDuplicatedFiles(allFiles, top)
+		}
+
+		if format != outputTable {
+			out := buildDedupStatsOutput(vaultConfig.Deduplication.Enabled, stats)
+			out.ByPath = dirs
+			out.TopFiles = topFiles
+			return writeStructured(os.Stdout, format, out)
+		}
+
 		// Display statistics
 		fmt.Printf("\nDeduplication Statistics:\n")
 		fmt.Printf("========================\n")
@@ -180,8 +234,14 @@ Example:
 		fmt.Printf("Unreferenced chunks: %d\n", stats.UnreferencedChunks)
 
 		if stats.TotalSize > 0 {
-			percentage := float64(stats.SavedSpace) / float64(stats.TotalSize+stats.SavedSpace) * 100
-			fmt.Printf("Deduplication ratio: %.2f%%\n", percentage)
+			fmt.Printf("Deduplication ratio: %.2f%%\n", dedupRatio(stats))
+		}
+
+		if byPath {
+			displayPathDedupStats(dirs)
+		}
+		if top > 0 {
+			displayTopDuplicatedFiles(topFiles, top)
 		}
 
 		if stats.UnreferencedChunks > 0 {
@@ -203,8 +263,16 @@ This command will:
 - Remove these chunks from storage
 - Update the deduplication index
 
+With --orphans it instead scans .sietch/chunks for files that no manifest or
+index entry refers to (for example leftovers from an interrupted add) and
+removes them after confirmation, reporting the space reclaimed. This includes
+the second copy older releases kept of every encrypted chunk they synced,
+under its plaintext hash. This works whether or not deduplication is enabled.
+
 Example:
   sietch dedup gc
+  sietch dedup gc --orphans
+  sietch dedup gc --orphans --dry-run
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		vaultRoot, err := fs.FindVaultRoot()
@@ -223,6 +291,12 @@ Example:
 			return fmt.Errorf("failed to load vault configuration: %v", err)
 		}
 
+		if orphans, _ := cmd.Flags().GetBool("orphans"); orphans {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			force, _ := cmd.Flags().GetBool("force")
+			return collectOrphanedChunks(vaultRoot, vaultConfig, dryRun, force)
+		}
+
 		if !vaultConfig.Deduplication.Enabled {
 			return fmt.Errorf("deduplication is not enabled in this vault")
 		}
@@ -233,6 +307,13 @@ Example:
 			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
 		}
 
+		if err := checkGcSafe(vaultRoot, dedupManager); err != nil {
+			return err
+		}
+		if err := runPreGcHooks(vaultRoot, vaultConfig, gcPlan{Mode: "index", Chunks: dedupManager.GetStats().UnreferencedChunks}); err != nil {
+			return err
+		}
+
 		fmt.Println("Running garbage collection...")
 
 		// Run garbage collection
@@ -248,11 +329,126 @@ Example:
 
 		fmt.Printf("✓ Garbage collection completed\n")
 		fmt.Printf("✓ Removed %d unreferenced chunks\n", removedChunks)
+		recordAudit(vaultRoot, audit.OpGC, map[string]string{"removed_chunks": strconv.Itoa(removedChunks)})
 
 		return nil
 	},
 }
 
+// gcPlan is the event data given to pre_gc hooks
+type gcPlan struct {
+	Mode   string `json:"mode"`            // index, orphans, optimize or trash
+	Chunks int    `json:"chunks"`          // Chunks garbage collection is about to remove
+	Bytes  int64  `json:"bytes,omitempty"` // Their stored size, when known beforehand
+}
+
+// runPreGcHooks runs the pre_gc hooks; a failing hook stops garbage collection
+func runPreGcHooks(vaultRoot string, vaultConfig *config.VaultConfig, plan gcPlan) error {
+	if err := hooks.Run(vaultRoot, vaultConfig, hooks.PreGC, plan); err != nil {
+		return fmt.Errorf("garbage collection stopped: %v", err)
+	}
+	return nil
+}
+
+// checkGcSafe refuses garbage collection while the index counts no references
+// to chunks that manifests still use, since gc would delete them
+func checkGcSafe(vaultRoot string, dedupManager *deduplication.Manager) error {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	// Files in the trash keep their chunks until they expire
+	files, err := manager.ReferencingFiles()
+	if err != nil {
+		return fmt.Errorf("failed to get vault manifest: %v", err)
+	}
+
+	inUse := 0
+	for _, d := range dedupManager.VerifyRefCounts(files) {
+		if d.Unsafe() && d.Indexed <= 0 {
+			inUse++
+		}
+	}
+	if inUse > 0 {
+		return fmt.Errorf("%d chunk(s) without references in the deduplication index are still used by files; run 'sietch dedup verify --repair' before gc", inUse)
+	}
+	return nil
+}
+
+// collectOrphanedChunks removes chunk files that no manifest or index entry refers to
+func collectOrphanedChunks(vaultRoot string, vaultConfig *config.VaultConfig, dryRun, force bool) error {
+	dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+	if err != nil {
+		return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+	}
+
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	files, err := manager.ReferencingFiles()
+	if err != nil {
+		return fmt.Errorf("failed to get vault manifest: %v", err)
+	}
+
+	fmt.Println("Scanning for orphaned chunks...")
+	orphans, err := dedupManager.FindOrphanedChunks(files)
+	if err != nil {
+		return fmt.Errorf("orphan scan failed: %v", err)
+	}
+	if len(orphans) == 0 {
+		fmt.Println("✓ No orphaned chunks found")
+		return nil
+	}
+
+	var total int64
+	for _, orphan := range orphans {
+		total += orphan.Size
+	}
+
+	if dryRun {
+		for _, orphan := range orphans {
+			if orphan.CopyOf != "" {
+				fmt.Printf("[dry-run] would remove chunk %s (%s), a second copy of %s\n", orphan.Name, util.HumanReadableSize(orphan.Size), orphan.CopyOf)
+				continue
+			}
+			fmt.Printf("[dry-run] would remove chunk %s (%s)\n", orphan.Name, util.HumanReadableSize(orphan.Size))
+		}
+		fmt.Printf("[dry-run] %d orphaned chunk(s), %s would be reclaimed\n", len(orphans), util.HumanReadableSize(total))
+		return nil
+	}
+
+	fmt.Printf("Found %d orphaned chunk(s) using %s\n", len(orphans), util.HumanReadableSize(total))
+	if !force {
+		confirmPrompt := promptui.Prompt{
+			Label:     fmt.Sprintf("Remove %d orphaned chunk(s)", len(orphans)),
+			IsConfirm: true,
+		}
+		if _, err := confirmPrompt.Run(); err != nil {
+			fmt.Println("Operation canceled")
+			return nil
+		}
+	}
+
+	if err := runPreGcHooks(vaultRoot, vaultConfig, gcPlan{Mode: "orphans", Chunks: len(orphans), Bytes: total}); err != nil {
+		return err
+	}
+
+	removed, reclaimed, err := dedupManager.RemoveOrphanedChunks(orphans)
+	if err != nil {
+		return fmt.Errorf("failed to remove orphaned chunks: %v", err)
+	}
+
+	fmt.Printf("✓ Removed %d orphaned chunks\n", removed)
+	fmt.Printf("✓ Reclaimed %s\n", util.HumanReadableSize(reclaimed))
+	recordAudit(vaultRoot, audit.OpGC, map[string]string{
+		"mode":            "orphans",
+		"removed_chunks":  strconv.Itoa(removed),
+		"reclaimed_bytes": strconv.FormatInt(reclaimed, 10),
+	})
+	return nil
+}
+
 // dedupOptimizeCmd optimizes storage
 var dedupOptimizeCmd = &cobra.Command{
 	Use:   "optimize",
@@ -264,8 +460,15 @@ This command will:
 - Update and optimize the deduplication index
 - Display optimization results
 
+With --rechunk, files are first read back and split again by the vault's
+current chunk size, e.g. after changing chunking.chunk_size. Only files split
+differently are rewritten. Their new chunks and manifests are committed in
+one transaction, which also deletes the old chunks no file uses any more, so
+an interrupted rechunk leaves the vault as it was.
+
 Example:
   sietch dedup optimize
+  sietch dedup optimize --rechunk
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		vaultRoot, err := fs.FindVaultRoot()
@@ -294,6 +497,32 @@ Example:
 			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
 		}
 
+		if err := checkGcSafe(vaultRoot, dedupManager); err != nil {
+			return err
+		}
+
+		if rechunk, _ := cmd.Flags().GetBool("rechunk"); rechunk {
+			if err := config.CheckWritable(vaultConfig); err != nil {
+				return err
+			}
+			fmt.Printf("Rechunking files into %s chunks...\n", vaultConfig.Chunking.ChunkSize)
+			result, err := rechunkVault(cmd, vaultRoot, vaultConfig)
+			if err != nil {
+				return fmt.Errorf("rechunk failed: %v", err)
+			}
+			printRechunkResult(result, vaultConfig.Chunking.ChunkSize)
+			fmt.Println()
+
+			// The rechunk rewrote the index
+			if dedupManager, err = deduplication.NewManager(vaultRoot, vaultConfig.Deduplication); err != nil {
+				return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+			}
+		}
+
+		if err := runPreGcHooks(vaultRoot, vaultConfig, gcPlan{Mode: "optimize", Chunks: dedupManager.GetStats().UnreferencedChunks}); err != nil {
+			return err
+		}
+
 		fmt.Println("Optimizing vault storage...")
 
 		// Run optimization
@@ -320,6 +549,161 @@ Example:
 	},
 }
 
+// dedupStatsOutput is the structured (json/yaml) representation of dedup stats
+type dedupStatsOutput struct {
+	Enabled            bool             `json:"enabled" yaml:"enabled"`
+	TotalChunks        int              `json:"total_chunks" yaml:"total_chunks"`
+	TotalSize          int64            `json:"total_size" yaml:"total_size"`
+	SavedSpace         int64            `json:"saved_space" yaml:"saved_space"`
+	UnreferencedChunks int              `json:"unreferenced_chunks" yaml:"unreferenced_chunks"`
+	DedupRatio         float64          `json:"dedup_ratio" yaml:"dedup_ratio"`
+	ByPath             []dedupPathStats `json:"by_path,omitempty" yaml:"by_path,omitempty"`
+	TopFiles           []dedupFileStats `json:"top_files,omitempty" yaml:"top_files,omitempty"`
+}
+
+// dedupPathStats splits the stored bytes of one destination directory into
+// chunks referenced by a single file and chunks shared with other files
+type dedupPathStats struct {
+	Path        string `json:"path" yaml:"path"`
+	Files       int    `json:"files" yaml:"files"`
+	UniqueBytes int64  `json:"unique_bytes" yaml:"unique_bytes"`
+	SharedBytes int64  `json:"shared_bytes" yaml:"shared_bytes"`
+}
+
+// dedupFileStats is the duplicated data contributed by a single file
+type dedupFileStats struct {
+	Path         string `json:"path" yaml:"path"`
+	SharedChunks int    `json:"shared_chunks" yaml:"shared_chunks"`
+	SharedBytes  int64  `json:"shared_bytes" yaml:"shared_bytes"`
+	SharedWith   int    `json:"shared_with" yaml:"shared_with"`
+}
+
+// buildDedupStatsOutput converts index statistics into their structured representation
+func buildDedupStatsOutput(enabled bool, stats deduplication.DeduplicationStats) dedupStatsOutput {
+	out := dedupStatsOutput{
+		Enabled:            enabled,
+		TotalChunks:        stats.TotalChunks,
+		TotalSize:          stats.TotalSize,
+		SavedSpace:         stats.SavedSpace,
+		UnreferencedChunks: stats.UnreferencedChunks,
+	}
+	if stats.TotalSize > 0 {
+		out.DedupRatio = dedupRatio(stats)
+	}
+	return out
+}
+
+// dedupRatio returns the percentage of logical data saved by deduplication
+func dedupRatio(stats deduplication.DeduplicationStats) float64 {
+	return float64(stats.SavedSpace) / float64(stats.TotalSize+stats.SavedSpace) * 100
+}
+
+// buildPathDedupStats walks the chunk index used by ls and returns per-directory
+// unique/shared byte counts, sorted by path, along with per-file duplication.
+// A chunk counts as shared when more than one file (or one file more than once) references it.
+func buildPathDedupStats(files []config.FileManifest) ([]dedupPathStats, []dedupFileStats) {
+	chunkRefs := buildChunkIndex(files)
+
+	byDir := make(map[string]*dedupPathStats)
+	perFile := make([]dedupFileStats, 0, len(files))
+	for _, file := range files {
+		dir := file.Destination
+		if dir == "" {
+			dir = "./"
+		}
+		entry, ok := byDir[dir]
+		if !ok {
+			entry = &dedupPathStats{Path: dir}
+			byDir[dir] = entry
+		}
+		entry.Files++
+
+		fileStats := dedupFileStats{Path: file.Destination + file.FilePath}
+		for _, c := range file.Chunks {
+			chunkID := c.Hash
+			if chunkID == "" {
+				chunkID = c.EncryptedHash
+			}
+			if len(chunkRefs[chunkID]) > 1 {
+				entry.SharedBytes += storedSize(c)
+				fileStats.SharedChunks++
+				fileStats.SharedBytes += storedSize(c)
+			} else {
+				entry.UniqueBytes += storedSize(c)
+			}
+		}
+		_, _, sharedWith := deduplication.ComputeDedupStatsForFile(file, chunkRefs)
+		fileStats.SharedWith = len(sharedWith)
+		perFile = append(perFile, fileStats)
+	}
+
+	dirs := make([]dedupPathStats, 0, len(byDir))
+	for _, entry := range byDir {
+		dirs = append(dirs, *entry)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Path < dirs[j].Path })
+	return dirs, perFile
+}
+
+// topDuplicatedFiles returns up to n files with the most shared bytes, largest first.
+// Files without any shared chunks are left out.
+func topDuplicatedFiles(files []dedupFileStats, n int) []dedupFileStats {
+	if n <= 0 {
+		return nil
+	}
+	var ranked []dedupFileStats
+	for _, f := range files {
+		if f.SharedBytes > 0 {
+			ranked = append(ranked, f)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].SharedBytes != ranked[j].SharedBytes {
+			return ranked[i].SharedBytes > ranked[j].SharedBytes
+		}
+		return ranked[i].Path < ranked[j].Path
+	})
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// displayPathDedupStats prints the per-directory breakdown as a table
+func displayPathDedupStats(dirs []dedupPathStats) {
+	fmt.Printf("\nBy path:\n")
+	if len(dirs) == 0 {
+		fmt.Println("  (no files in vault)")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  PATH\tFILES\tUNIQUE\tSHARED\tSHARED %")
+	for _, d := range dirs {
+		percent := 0.0
+		if total := d.UniqueBytes + d.SharedBytes; total > 0 {
+			percent = float64(d.SharedBytes) / float64(total) * 100
+		}
+		fmt.Fprintf(w, "  %s\t%d\t%s\t%s\t%.1f%%\n", d.Path, d.Files,
+			util.HumanReadableSize(d.UniqueBytes), util.HumanReadableSize(d.SharedBytes), percent)
+	}
+	_ = w.Flush()
+}
+
+// displayTopDuplicatedFiles prints the files contributing the most duplicated data
+func displayTopDuplicatedFiles(files []dedupFileStats, n int) {
+	fmt.Printf("\nTop %d files by duplicated data:\n", n)
+	if len(files) == 0 {
+		fmt.Println("  (no shared chunks)")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  FILE\tSHARED\tCHUNKS\tSHARED WITH")
+	for _, f := range files {
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%d file(s)\n", f.Path, util.HumanReadableSize(f.SharedBytes), f.SharedChunks, f.SharedWith)
+	}
+	_ = w.Flush()
+}
+
 func init() {
 	rootCmd.AddCommand(dedupCmd)
 
@@ -328,6 +712,17 @@ func init() {
 
 	// Add subcommands
 	dedupCmd.AddCommand(dedupStatsCmd)
+	dedupStatsCmd.Flags().Bool("by-path", false, "Break down unique and shared bytes per destination directory")
+	dedupStatsCmd.Flags().Int("top", 0, "List the N files contributing the most duplicated data")
 	dedupCmd.AddCommand(dedupGcCmd)
+	dedupGcCmd.Flags().Bool("orphans", false, "Remove chunk files not referenced by any manifest or index entry")
+	dedupGcCmd.Flags().BoolP("force", "f", false, "Remove orphaned chunks without asking for confirmation")
 	dedupCmd.AddCommand(dedupOptimizeCmd)
+	dedupOptimizeCmd.Flags().Bool("rechunk", false, "Split files again by the vault's current chunk size before optimizing")
+	dedupOptimizeCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	dedupOptimizeCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	dedupCmd.AddCommand(dedupDuplicatesCmd)
+	dedupCmd.AddCommand(dedupVerifyCmd)
+	dedupVerifyCmd.Flags().Bool("repair", false, "Rewrite the deduplication index to match the manifests")
+	dedupDuplicatesCmd.Flags().String("min-size", "", "Only report files at least this size (e.g. 1MB)")
 }
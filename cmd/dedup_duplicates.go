@@ -0,0 +1,197 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// dedupDuplicatesCmd lists files with identical content
+var dedupDuplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "List files whose content is identical",
+	Long: `List groups of files with identical content stored under different names
+or paths.
+
+Files are identical when their content hashes match; files added before
+content hashes were recorded are compared by their chunk lists instead.
+
+For each group, DUPLICATE is the size of every copy but one. RECLAIMABLE is
+the chunk store space those copies still take, which converting all but
+one file to references would free. Copies whose chunks deduplication already
+shares take no extra space, so RECLAIMABLE can be far smaller than
+DUPLICATE. Groups are sorted by reclaimable space, largest first.
+
+Example:
+  sietch dedup duplicates
+  sietch dedup duplicates --min-size 1MB
+  sietch dedup duplicates -o json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		var minSize int64
+		if v, _ := cmd.Flags().GetString("min-size"); v != "" {
+			if minSize, err = util.ParseChunkSize(v); err != nil {
+				return fmt.Errorf("invalid --min-size: %v", err)
+			}
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		manifest, err := manager.GetManifest()
+		if err != nil {
+			return fmt.Errorf("failed to get vault manifest: %v", err)
+		}
+
+		report := findDuplicateFiles(manifest.Files, minSize)
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, report)
+		}
+		displayDuplicateFiles(os.Stdout, report)
+		return nil
+	},
+}
+
+// duplicateReport is the output of sietch dedup duplicates
+type duplicateReport struct {
+	Groups           []duplicateGroup `json:"groups" yaml:"groups"`
+	DuplicateBytes   int64            `json:"duplicate_bytes" yaml:"duplicate_bytes"`
+	ReclaimableBytes int64            `json:"reclaimable_bytes" yaml:"reclaimable_bytes"`
+}
+
+// duplicateGroup is a set of files with identical content
+type duplicateGroup struct {
+	ContentHash      string   `json:"content_hash,omitempty" yaml:"content_hash,omitempty"` // Empty for files compared by chunk list
+	Size             int64    `json:"size" yaml:"size"`
+	Paths            []string `json:"paths" yaml:"paths"`
+	DuplicateBytes   int64    `json:"duplicate_bytes" yaml:"duplicate_bytes"`     // Size of every copy but one
+	ReclaimableBytes int64    `json:"reclaimable_bytes" yaml:"reclaimable_bytes"` // Chunk store space those copies take
+}
+
+// findDuplicateFiles groups files of at least minSize bytes by content.
+// Empty files, symlinks and hard links are left out: they take no chunk
+// store space.
+func findDuplicateFiles(files []config.FileManifest, minSize int64) duplicateReport {
+	byContent := make(map[string][]config.FileManifest)
+	var keys []string
+	for _, file := range files {
+		if file.Size == 0 || file.Size < minSize || file.Symlink != "" || file.HardLink != "" {
+			continue
+		}
+		key := duplicateKey(file)
+		if _, ok := byContent[key]; !ok {
+			keys = append(keys, key)
+		}
+		byContent[key] = append(byContent[key], file)
+	}
+
+	report := duplicateReport{Groups: []duplicateGroup{}}
+	for _, key := range keys {
+		copies := byContent[key]
+		if len(copies) < 2 {
+			continue
+		}
+		sort.Slice(copies, func(i, j int) bool {
+			return copies[i].Destination+copies[i].FilePath < copies[j].Destination+copies[j].FilePath
+		})
+
+		group := duplicateGroup{
+			ContentHash:    copies[0].ContentHash,
+			Size:           copies[0].Size,
+			DuplicateBytes: int64(len(copies)-1) * copies[0].Size,
+		}
+		// Space the kept copy needs; whatever the others add on top is reclaimable
+		stored := make(map[string]bool)
+		for _, ref := range copies[0].Chunks {
+			stored[chunk.StorageName(ref)] = true
+		}
+		for i, file := range copies {
+			group.Paths = append(group.Paths, file.Destination+file.FilePath)
+			if i == 0 {
+				continue
+			}
+			for _, ref := range file.Chunks {
+				if name := chunk.StorageName(ref); !stored[name] {
+					stored[name] = true
+					group.ReclaimableBytes += storedSize(ref)
+				}
+			}
+		}
+
+		report.Groups = append(report.Groups, group)
+		report.DuplicateBytes += group.DuplicateBytes
+		report.ReclaimableBytes += group.ReclaimableBytes
+	}
+
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		a, b := report.Groups[i], report.Groups[j]
+		if a.ReclaimableBytes != b.ReclaimableBytes {
+			return a.ReclaimableBytes > b.ReclaimableBytes
+		}
+		if a.DuplicateBytes != b.DuplicateBytes {
+			return a.DuplicateBytes > b.DuplicateBytes
+		}
+		return a.Paths[0] < b.Paths[0]
+	})
+	return report
+}
+
+// duplicateKey identifies the content of file: its content hash, or its size
+// and chunk hashes in order if no content hash was recorded
+func duplicateKey(file config.FileManifest) string {
+	if file.ContentHash != "" {
+		return "content:" + file.ContentHash
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "chunks:%d", file.Size)
+	for _, ref := range file.Chunks {
+		b.WriteString(":" + ref.Hash)
+	}
+	return b.String()
+}
+
+// displayDuplicateFiles prints each group of identical files and the totals
+func displayDuplicateFiles(w io.Writer, report duplicateReport) {
+	if len(report.Groups) == 0 {
+		fmt.Fprintln(w, "No duplicate files found")
+		return
+	}
+	for _, group := range report.Groups {
+		hash := group.ContentHash
+		if hash == "" {
+			hash = "no content hash"
+		} else if len(hash) > 16 {
+			hash = hash[:16]
+		}
+		fmt.Fprintf(w, "%d files of %s (%s), duplicate %s, reclaimable %s\n",
+			len(group.Paths), util.HumanReadableSize(group.Size), hash,
+			util.HumanReadableSize(group.DuplicateBytes), util.HumanReadableSize(group.ReclaimableBytes))
+		for _, path := range group.Paths {
+			fmt.Fprintf(w, "  %s\n", path)
+		}
+	}
+	fmt.Fprintf(w, "\n%d group(s): %s duplicate, %s reclaimable\n",
+		len(report.Groups), util.HumanReadableSize(report.DuplicateBytes), util.HumanReadableSize(report.ReclaimableBytes))
+}
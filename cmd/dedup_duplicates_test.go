@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestFindDuplicateFiles(t *testing.T) {
+	// a.bin and c.bin share their chunk; b.bin has the same content but was
+	// stored again under another encrypted name
+	chunk := config.ChunkRef{Hash: "h", EncryptedHash: "e1", Size: 100, EncryptedSize: 120}
+	copied := config.ChunkRef{Hash: "h", EncryptedHash: "e2", Size: 100, EncryptedSize: 120}
+	file := func(path, dest, hash string, size int64, chunks ...config.ChunkRef) config.FileManifest {
+		f := createTestManifest(path, dest, size, chunks)
+		f.ContentHash = hash
+		return f
+	}
+	files := []config.FileManifest{
+		file("a.bin", "x/", "same", 100, chunk),
+		file("b.bin", "y/", "same", 100, copied),
+		file("c.bin", "z/", "same", 100, chunk),
+		file("small.txt", "x/", "tiny", 10, config.ChunkRef{Hash: "t", Size: 10}),
+		file("small.txt", "y/", "tiny", 10, config.ChunkRef{Hash: "t", Size: 10}),
+		file("unique.txt", "x/", "other", 50, config.ChunkRef{Hash: "u", Size: 50}),
+		file("empty1", "x/", "empty", 0),
+		file("empty2", "y/", "empty", 0),
+		// No content hash: compared by chunk list
+		file("old1.bin", "x/", "", 30, config.ChunkRef{Hash: "o", Size: 30}),
+		file("old2.bin", "y/", "", 30, config.ChunkRef{Hash: "o", Size: 30}),
+	}
+
+	report := findDuplicateFiles(files, 0)
+	if len(report.Groups) != 3 {
+		t.Fatalf("expected 3 groups, got %+v", report.Groups)
+	}
+	first := report.Groups[0]
+	if strings.Join(first.Paths, " ") != "x/a.bin y/b.bin z/c.bin" {
+		t.Errorf("unexpected first group %+v", first)
+	}
+	if first.DuplicateBytes != 200 || first.ReclaimableBytes != 120 {
+		t.Errorf("expected 200 duplicate and 120 reclaimable bytes, got %+v", first)
+	}
+	if report.Groups[1].ContentHash != "" || report.Groups[1].DuplicateBytes != 30 || report.Groups[1].ReclaimableBytes != 0 {
+		t.Errorf("expected the chunk-list group second, got %+v", report.Groups[1])
+	}
+	if report.DuplicateBytes != 240 || report.ReclaimableBytes != 120 {
+		t.Errorf("unexpected totals %+v", report)
+	}
+
+	if filtered := findDuplicateFiles(files, 50); len(filtered.Groups) != 1 {
+		t.Errorf("expected --min-size to leave one group, got %+v", filtered.Groups)
+	}
+	if none := findDuplicateFiles(nil, 0); none.Groups == nil || len(none.Groups) != 0 {
+		t.Errorf("expected an empty group list, got %#v", none.Groups)
+	}
+}
+
+func TestDisplayDuplicateFiles(t *testing.T) {
+	var buf bytes.Buffer
+	displayDuplicateFiles(&buf, duplicateReport{})
+	if !strings.Contains(buf.String(), "No duplicate files found") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	displayDuplicateFiles(&buf, duplicateReport{
+		Groups:           []duplicateGroup{{ContentHash: "0123456789abcdef0123", Size: 2048, Paths: []string{"a", "b"}, DuplicateBytes: 2048, ReclaimableBytes: 1024}},
+		DuplicateBytes:   2048,
+		ReclaimableBytes: 1024,
+	})
+	for _, want := range []string{"2 files of 2.0 KB (0123456789abcdef), duplicate 2.0 KB, reclaimable 1.0 KB", "  a\n  b\n", "1 group(s): 2.0 KB duplicate, 1.0 KB reclaimable"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
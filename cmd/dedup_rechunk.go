@@ -0,0 +1,228 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// rechunkResult summarizes a rechunk of the vault
+type rechunkResult struct {
+	Files         int   // Files chunked again
+	OldChunks     int   // Chunks of those files before
+	NewChunks     int   // Chunks of those files after
+	RemovedChunks int   // Chunk files no manifest uses any more
+	Reclaimed     int64 // Stored bytes of the removed chunk files
+}
+
+// needsRechunk reports whether file is split differently from how chunkSize
+// splits files now: every chunk but the last of each data range must be
+// exactly chunkSize bytes
+func needsRechunk(file *config.FileManifest, chunkSize int64) bool {
+	if file.Symlink != "" || len(file.Chunks) == 0 {
+		return false
+	}
+	offsets := chunkOffsets(file)
+	for i, ref := range file.Chunks {
+		if ref.Size > chunkSize {
+			return true
+		}
+		lastOfRange := i == len(file.Chunks)-1 || offsets[i+1] != offsets[i]+ref.Size
+		if ref.Size < chunkSize && !lastOfRange {
+			return true
+		}
+	}
+	return false
+}
+
+// rechunkVault reads back every file not split by the vault's current chunk
+// size, chunks it again and rewrites its manifest, all in one transaction.
+// Chunk files no manifest uses afterwards are deleted in the same
+// transaction and dropped from the deduplication index.
+func rechunkVault(cmd *cobra.Command, vaultRoot string, vaultConfig *config.VaultConfig) (*rechunkResult, error) {
+	chunkSize, err := util.ParseChunkSize(vaultConfig.Chunking.ChunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk size in vault configuration (%s): %v", vaultConfig.Chunking.ChunkSize, err)
+	}
+
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	entries, err := manager.GetManifestEntries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest entries: %v", err)
+	}
+
+	result := &rechunkResult{}
+	var stale []*config.ManifestEntry
+	for _, entry := range entries {
+		if needsRechunk(&entry.Manifest, chunkSize) {
+			stale = append(stale, entry)
+		}
+	}
+	if len(stale) == 0 {
+		return result, nil
+	}
+
+	passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passphrase: %v", err)
+	}
+
+	progressMgr := progress.NewManager(progress.Options{Quiet: true})
+	ctx := progressMgr.SetupCancellation(context.Background())
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "dedup optimize", "mode": "rechunk", "fileCount": len(stale)})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+			fmt.Println("txn rollback; rechunk did not complete")
+		}
+	}()
+
+	batch, err := chunk.NewBatch(vaultRoot, passphrase, txn, progressMgr)
+	if err != nil {
+		return nil, err
+	}
+	r := &retriever{
+		vaultRoot:   vaultRoot,
+		vaultConfig: vaultConfig,
+		passphrase:  passphrase,
+		quiet:       true,
+		progressMgr: progressMgr,
+	}
+
+	// Files with the same content, such as hard links, reuse the new chunks
+	rechunked := make(map[string][]config.ChunkRef)
+	var oldChunks []config.ChunkRef
+	for n, entry := range stale {
+		file := &entry.Manifest
+		path := file.Destination + file.FilePath
+		fmt.Printf("[%d/%d] Rechunking %s (%d chunks)\n", n+1, len(stale), path, len(file.Chunks))
+
+		var refs []config.ChunkRef
+		key := duplicateKey(*file)
+		if stored, ok := rechunked[key]; ok {
+			if refs, err = batch.ReuseChunks(stored); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		} else {
+			var contentHash string
+			if refs, contentHash, err = rechunkFile(ctx, r, batch, file, chunkSize); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			if file.ContentHash != "" && contentHash != file.ContentHash {
+				return nil, fmt.Errorf("%s: content hash changed while rechunking (%s, manifest records %s)", path, contentHash, file.ContentHash)
+			}
+			file.ContentHash = contentHash
+			rechunked[key] = refs
+		}
+
+		// Released only now, so chunks the new split keeps are never dropped
+		batch.ReleaseChunks(file.Chunks)
+		oldChunks = append(oldChunks, file.Chunks...)
+		result.OldChunks += len(file.Chunks)
+		result.NewChunks += len(refs)
+		result.Files++
+
+		file.Chunks = refs
+		file.Holes = chunk.Holes(refs, file.Size)
+		if err := replaceManifestTransactional(txn, vaultRoot, entry.Path, file); err != nil {
+			return nil, fmt.Errorf("%s: stage manifest: %v", path, err)
+		}
+	}
+
+	// Delete the chunk files of the old split that no manifest uses any more,
+	// nor any file in the trash
+	inUse := make(map[string]bool)
+	for _, entry := range entries {
+		for _, ref := range entry.Manifest.Chunks {
+			inUse[chunk.StorageName(ref)] = true
+		}
+	}
+	trashed, err := manager.TrashedFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range trashed {
+		for _, ref := range file.Chunks {
+			inUse[chunk.StorageName(ref)] = true
+		}
+	}
+	for _, ref := range oldChunks {
+		name := chunk.StorageName(ref)
+		if inUse[name] {
+			continue
+		}
+		inUse[name] = true
+		if err := txn.StageDelete(fs.ChunkRelPath(vaultRoot, name)); err != nil {
+			return nil, fmt.Errorf("stage chunk delete: %v", err)
+		}
+		result.RemovedChunks++
+		result.Reclaimed += storedSize(ref)
+	}
+
+	if err := batch.Save(); err != nil {
+		return nil, err
+	}
+	if err := txn.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %v", err)
+	}
+	committed = true
+	manager.RefreshIndex()
+
+	recordAudit(vaultRoot, audit.OpGC, map[string]string{
+		"mode":            "rechunk",
+		"files":           strconv.Itoa(result.Files),
+		"chunk_size":      vaultConfig.Chunking.ChunkSize,
+		"removed_chunks":  strconv.Itoa(result.RemovedChunks),
+		"reclaimed_bytes": strconv.FormatInt(result.Reclaimed, 10),
+	})
+	return result, nil
+}
+
+// rechunkFile streams the stored content of file into batch, split by
+// chunkSize, and returns its new chunks and content hash
+func rechunkFile(ctx context.Context, r *retriever, batch *chunk.Batch, file *config.FileManifest, chunkSize int64) ([]config.ChunkRef, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(r.streamFile(ctx, file, pw, 0, file.Size))
+	}()
+	refs, contentHash, err := batch.ChunkStored(ctx, pr, file.Size, file.Holes, chunkSize, 0, r.progressMgr)
+	// Unblocks the reader if chunking stopped early
+	pr.CloseWithError(io.ErrClosedPipe)
+	return refs, contentHash, err
+}
+
+// printRechunkResult reports what a rechunk changed
+func printRechunkResult(result *rechunkResult, chunkSize string) {
+	if result.Files == 0 {
+		fmt.Printf("✓ Every file is already split into %s chunks\n", chunkSize)
+		return
+	}
+	fmt.Printf("✓ Rechunked %d file(s) into %s chunks: %d chunks → %d\n", result.Files, chunkSize, result.OldChunks, result.NewChunks)
+	fmt.Printf("✓ Removed %d old chunks (%s)\n", result.RemovedChunks, util.HumanReadableSize(result.Reclaimed))
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestNeedsRechunk(t *testing.T) {
+	chunks := func(spans ...int64) []config.ChunkRef {
+		var refs []config.ChunkRef
+		for i := 0; i < len(spans); i += 2 {
+			refs = append(refs, config.ChunkRef{Hash: "h", Offset: spans[i], Size: spans[i+1]})
+		}
+		return refs
+	}
+	tests := []struct {
+		name string
+		file config.FileManifest
+		want bool
+	}{
+		{"current split", config.FileManifest{Size: 2500, Chunks: chunks(0, 1024, 1024, 1024, 2048, 452)}, false},
+		{"single small chunk", config.FileManifest{Size: 10, Chunks: chunks(0, 10)}, false},
+		{"larger chunks", config.FileManifest{Size: 4096, Chunks: chunks(0, 4096)}, true},
+		{"smaller chunks", config.FileManifest{Size: 1024, Chunks: chunks(0, 512, 512, 512)}, true},
+		{
+			"short chunk before a hole",
+			config.FileManifest{Size: 4000, Holes: []config.HoleExtent{{Offset: 1500, Length: 1500}}, Chunks: chunks(0, 1024, 1024, 476, 3000, 1000)},
+			false,
+		},
+		{"legacy manifest without offsets", config.FileManifest{Size: 1536, Chunks: chunks(0, 1024, 0, 512)}, false},
+		{"symlink", config.FileManifest{Symlink: "target"}, false},
+		{"empty file", config.FileManifest{}, false},
+	}
+	for _, tt := range tests {
+		if got := needsRechunk(&tt.file, 1024); got != tt.want {
+			t.Errorf("%s: needsRechunk = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestBuildPathDedupStats(t *testing.T) {
+	files := []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Chunks: []config.ChunkRef{{Hash: "x", Size: 100}, {Hash: "y", Size: 50}}},
+		{FilePath: "b.txt", Destination: "docs/", Chunks: []config.ChunkRef{{Hash: "x", Size: 100}}},
+		{FilePath: "c.bin", Destination: "backup/", Chunks: []config.ChunkRef{{Hash: "x", Size: 100, EncryptedSize: 120}, {Hash: "z", Size: 30}}},
+		{FilePath: "d.bin", Destination: "", Chunks: []config.ChunkRef{{Hash: "w", Size: 7}}},
+	}
+
+	dirs, perFile := buildPathDedupStats(files)
+
+	want := []dedupPathStats{
+		{Path: "./", Files: 1, UniqueBytes: 7},
+		{Path: "backup/", Files: 1, UniqueBytes: 30, SharedBytes: 120},
+		{Path: "docs/", Files: 2, UniqueBytes: 50, SharedBytes: 200},
+	}
+	if len(dirs) != len(want) {
+		t.Fatalf("expected %d directories, got %+v", len(want), dirs)
+	}
+	for i := range want {
+		if dirs[i] != want[i] {
+			t.Errorf("dir %d: expected %+v, got %+v", i, want[i], dirs[i])
+		}
+	}
+
+	if len(perFile) != len(files) {
+		t.Fatalf("expected %d file entries, got %d", len(files), len(perFile))
+	}
+	if a := perFile[0]; a.Path != "docs/a.txt" || a.SharedChunks != 1 || a.SharedBytes != 100 || a.SharedWith != 2 {
+		t.Errorf("unexpected stats for docs/a.txt: %+v", a)
+	}
+}
+
+func TestTopDuplicatedFiles(t *testing.T) {
+	files := []dedupFileStats{
+		{Path: "a", SharedBytes: 10},
+		{Path: "b", SharedBytes: 0},
+		{Path: "c", SharedBytes: 30},
+		{Path: "d", SharedBytes: 10},
+	}
+
+	tests := []struct {
+		name string
+		n    int
+		want []string
+	}{
+		{"disabled", 0, nil},
+		{"limited", 2, []string{"c", "a"}},
+		{"skips unshared", 10, []string{"c", "a", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := topDuplicatedFiles(files, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %+v", tt.want, got)
+			}
+			for i, path := range tt.want {
+				if got[i].Path != path {
+					t.Errorf("position %d: expected %s, got %s", i, path, got[i].Path)
+				}
+			}
+		})
+	}
+}
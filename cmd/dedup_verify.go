@@ -0,0 +1,167 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// dedupVerifyCmd checks the reference counts of the deduplication index
+var dedupVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the deduplication index against the manifests",
+	Long: `Recompute the reference count of every chunk from all file manifests and
+compare it with the deduplication index.
+
+Drift is reported per chunk:
+  undercounted  the index counts fewer references than files hold; gc or rm
+                could delete the chunk while files still need it
+  overcounted   the index counts more references; the chunk outlives its files
+  unreferenced  no file uses the chunk, but the index keeps it alive
+  unindexed     files use the chunk but the index does not know it, so the
+                same data is stored again when added
+  storage       the index points at a chunk file no manifest uses
+
+With --repair the index is rewritten to match the manifests. Unreferenced
+chunks drop to zero references and the next 'sietch dedup gc' removes them.
+Without --repair the command fails if it finds drift.
+
+Example:
+  sietch dedup verify
+  sietch dedup verify --repair
+  sietch dedup verify -o json
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		repair, _ := cmd.Flags().GetBool("repair")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		// Files in the trash still reference their chunks
+		files, err := manager.ReferencingFiles()
+		if err != nil {
+			return fmt.Errorf("failed to get vault manifest: %v", err)
+		}
+
+		drift := dedupManager.VerifyRefCounts(files)
+		if repair && len(drift) > 0 {
+			dedupManager.RepairRefCounts(files, drift)
+			if err := dedupManager.Save(); err != nil {
+				return fmt.Errorf("failed to save repaired index: %v", err)
+			}
+			recordAudit(vaultRoot, audit.OpGC, map[string]string{
+				"mode":     "repair-refcounts",
+				"repaired": strconv.Itoa(len(drift)),
+			})
+		}
+
+		var failure error
+		if len(drift) > 0 && !repair {
+			failure = fmt.Errorf("%d chunk(s) in the deduplication index disagree with the manifests, run 'sietch dedup verify --repair'", len(drift))
+		}
+
+		if format != outputTable {
+			out := dedupVerifyOutput{OK: len(drift) == 0, Repaired: repair && len(drift) > 0, Drift: drift}
+			if out.Drift == nil {
+				out.Drift = []deduplication.RefCountDrift{}
+			}
+			if err := writeStructured(os.Stdout, format, out); err != nil {
+				return err
+			}
+			if failure != nil {
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				return reportedError{failure}
+			}
+			return nil
+		}
+
+		if len(drift) == 0 {
+			fmt.Println("✓ Deduplication index matches the manifests")
+			return nil
+		}
+		displayRefCountDrift(os.Stdout, drift)
+		if repair {
+			fmt.Printf("\n✓ Repaired %d index entries\n", len(drift))
+			return nil
+		}
+		if unsafe := countUnsafeDrift(drift); unsafe > 0 {
+			fmt.Printf("\n⚠️  %d chunk(s) are undercounted and could be deleted while still in use\n", unsafe)
+		}
+		return failure
+	},
+}
+
+// dedupVerifyOutput is the structured output of sietch dedup verify
+type dedupVerifyOutput struct {
+	OK       bool                          `json:"ok" yaml:"ok"`
+	Repaired bool                          `json:"repaired" yaml:"repaired"`
+	Drift    []deduplication.RefCountDrift `json:"drift" yaml:"drift"`
+}
+
+// countUnsafeDrift returns how many chunks gc or rm could delete while in use
+func countUnsafeDrift(drift []deduplication.RefCountDrift) int {
+	unsafe := 0
+	for _, d := range drift {
+		if d.Unsafe() {
+			unsafe++
+		}
+	}
+	return unsafe
+}
+
+// displayRefCountDrift prints the chunks whose index entries disagree with the manifests
+func displayRefCountDrift(w io.Writer, drift []deduplication.RefCountDrift) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHUNK\tDRIFT\tINDEXED\tREFERENCED\tDETAIL")
+	for _, d := range drift {
+		detail := "-"
+		if d.WantStorageHash != "" && d.StorageHash != "" {
+			detail = fmt.Sprintf("stored as %s, files use %s", shortHash(d.StorageHash), shortHash(d.WantStorageHash))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", shortHash(d.Hash), d.Kind, d.Indexed, d.Referenced, detail)
+	}
+	_ = tw.Flush()
+}
+
+// shortHash abbreviates a chunk hash for tables
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+)
+
+func TestDisplayRefCountDrift(t *testing.T) {
+	drift := []deduplication.RefCountDrift{
+		{Hash: "0123456789abcdef", Kind: deduplication.DriftUndercounted, Indexed: 1, Referenced: 3, StorageHash: "0123456789abcdef"},
+		{Hash: "moved", Kind: deduplication.DriftStorage, Indexed: 1, Referenced: 1, StorageHash: "old", WantStorageHash: "new"},
+		{Hash: "fresh", Kind: deduplication.DriftUnindexed, Referenced: 2, WantStorageHash: "fresh"},
+	}
+
+	var buf bytes.Buffer
+	displayRefCountDrift(&buf, drift)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and 3 rows, got:\n%s", buf.String())
+	}
+	if fields := strings.Fields(lines[1]); fields[0] != "0123456789ab" || fields[1] != "undercounted" || fields[2] != "1" || fields[3] != "3" || fields[4] != "-" {
+		t.Errorf("Unexpected undercounted row: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "stored as old, files use new") {
+		t.Errorf("Expected the storage row to name both chunk files, got %q", lines[2])
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[3]), "-") {
+		t.Errorf("Expected no storage detail for an unindexed chunk, got %q", lines[3])
+	}
+
+	if got := countUnsafeDrift(drift); got != 1 {
+		t.Errorf("countUnsafeDrift = %d, want 1", got)
+	}
+}
@@ -8,31 +8,46 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
 )
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
-	Use:   "delete <file_path>",
-	Short: "Delete a file from the Sietch vault",
+	Use:     "delete <file_path>",
+	Aliases: []string{"rm"},
+	Short:   "Delete a file from the Sietch vault",
 	Long: `Delete a file from your Sietch vault.
 
-This command removes a file from your vault and cleans up any orphaned
-chunks that are no longer referenced by other files.
+This command moves a file from your vault to the trash, where it is kept
+for trash.retention (7 days by default) and can be restored with 'sietch
+undelete'. Its chunks are kept until it expires; the trash is emptied of
+expired files as others are deleted, or with 'sietch trash empty'. The
+deletion is recorded as a tombstone, so the next sync removes the file from
+peers too.
+
+With --purge the file is deleted at once, along with the chunks no longer
+referenced by other files.
 
 Examples:
-  sietch delete docs/report.pdf        # Delete a specific file
+  sietch delete docs/report.pdf        # Move a file to the trash
   sietch delete --force notes.txt      # Delete without confirmation
-  sietch delete --keep-chunks photo.jpg # Delete manifest but keep chunks`,
+  sietch delete --purge old.iso        # Delete now, skipping the trash
+  sietch delete --purge --keep-chunks photo.jpg # Delete manifest but keep chunks
+  sietch rm --dry-run docs/report.pdf   # Show what would be removed`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		filePath := args[0]
+		filePath := fs.VaultPath(args[0])
 
 		// Find vault root
 		vaultRoot, err := fs.FindVaultRoot()
@@ -46,6 +61,14 @@ Examples:
 			return fmt.Errorf("failed to create vault manager: %v", err)
 		}
 
+		vaultConfig, err := manager.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := config.CheckWritable(vaultConfig); err != nil {
+			return err
+		}
+
 		// Get the vault manifest to find the file
 		manifest, err := manager.GetManifest()
 		if err != nil {
@@ -69,6 +92,37 @@ Examples:
 			return fmt.Errorf("file not found in vault: %s", filePath)
 		}
 
+		keepChunks, _ := cmd.Flags().GetBool("keep-chunks")
+		purge, _ := cmd.Flags().GetBool("purge")
+		retention := vaultConfig.Trash.RetentionPeriod()
+		uniqueFileIdentifier, err := config.ManifestFileName(vaultRoot, targetFile.Destination, fileBaseName)
+		if err != nil {
+			return err
+		}
+
+		// A dry run reports the chunks no other file references, without staging anything
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if dryRun {
+			if !purge {
+				fmt.Printf("[dry-run] would move '%s' to the trash until %s\n",
+					targetFile.Destination+targetFile.FilePath, time.Now().Add(retention).Format("2006-01-02 15:04"))
+				fmt.Printf("  Manifest: .sietch/manifests/%s\n", uniqueFileIdentifier)
+				fmt.Printf("  Chunks:   %d kept until then\n", len(targetFile.Chunks))
+				return nil
+			}
+			var orphaned []config.ChunkRef
+			if !keepChunks {
+				trashed, err := manager.TrashedFiles()
+				if err != nil {
+					return fmt.Errorf("failed to read trash: %v", err)
+				}
+				remaining := &config.Manifest{Files: append(filesExcept(manifest.Files, targetFile), trashed...)}
+				orphaned = orphanedChunks(targetFile.Chunks, remaining)
+			}
+			printDeletePlan(targetFile, uniqueFileIdentifier, orphaned)
+			return nil
+		}
+
 		// Get confirmation unless --force is specified
 		force, _ := cmd.Flags().GetBool("force")
 		if !force {
@@ -97,24 +151,34 @@ Examples:
 		}()
 
 		// Step 1: Stage removal of the manifest file
-		destination := strings.ReplaceAll(targetFile.Destination, "/", ".")
-		uniqueFileIdentifier := destination + fileBaseName + ".yaml"
 		// relative manifest path inside vault root
 		relManifest := filepath.ToSlash(filepath.Join(".sietch", "manifests", uniqueFileIdentifier))
 		if err := txn.StageDelete(relManifest); err != nil {
 			return fmt.Errorf("stage manifest delete: %v", err)
 		}
 
-		// Step 2: Clean up orphaned chunks if --keep-chunks is not specified
-		keepChunks, _ := cmd.Flags().GetBool("keep-chunks")
-		if !keepChunks {
+		// Leave a tombstone so the next sync removes the file from peers
+		// instead of copying it back
+		if err := stageTombstone(txn, vaultRoot, targetFile); err != nil {
+			return fmt.Errorf("stage tombstone: %v", err)
+		}
+
+		// Step 2: Keep the file in the trash, or clean up orphaned chunks
+		// unless --keep-chunks is specified
+		var entry *config.TrashEntry
+		if !purge {
+			entry = config.NewTrashEntry(targetFile, retention)
+			if err := stageTrashEntry(txn, vaultRoot, entry); err != nil {
+				return fmt.Errorf("stage trash entry: %v", err)
+			}
+		} else if !keepChunks {
 			// Get the remaining manifests to check for chunk references
-			remainingManifest, err := manager.GetManifest()
+			remaining, err := manager.ReferencingFiles()
 			if err != nil {
 				fmt.Printf("Warning: Failed to check for orphaned chunks: %v\n", err)
 			} else {
 				// Find and remove orphaned chunks
-				if err := stageOrphanedChunkDeletes(txn, vaultRoot, targetFile.Chunks, remainingManifest); err != nil {
+				if err := stageOrphanedChunkDeletes(txn, vaultRoot, targetFile.Chunks, &config.Manifest{Files: remaining}); err != nil {
 					fmt.Printf("Warning: Failed to stage some orphaned chunks: %v\n", err)
 				}
 			}
@@ -125,36 +189,156 @@ Examples:
 		}
 		committed = true
 		fmt.Println("txn successful; delete committed")
-		fmt.Printf("✓ Successfully deleted '%s' from vault\n", filePath)
+		manager.RefreshIndex()
+		details := map[string]string{
+			"path":        targetFile.Destination + targetFile.FilePath,
+			"keep_chunks": strconv.FormatBool(keepChunks),
+		}
+		if entry != nil {
+			details["trash"] = entry.ID
+		}
+		recordAudit(vaultRoot, audit.OpDelete, details)
+
+		if entry == nil {
+			fmt.Printf("✓ Successfully deleted '%s' from vault\n", filePath)
+			return nil
+		}
+		fmt.Printf("✓ Moved '%s' to the trash until %s\n", filePath, entry.ExpiresAt.Local().Format("2006-01-02 15:04"))
+		fmt.Printf("  Restore it with 'sietch undelete %s'\n", entry.Path())
+
+		// Files whose retention is over leave the trash as others enter it
+		if removed, err := emptyExpiredTrash(vaultRoot, manager); err != nil {
+			fmt.Printf("Warning: failed to empty expired files from the trash: %v\n", err)
+		} else if removed > 0 {
+			fmt.Printf("✓ Emptied %d expired file(s) from the trash\n", removed)
+		}
 		return nil
 	},
 }
 
-// stageOrphanedChunkDeletes stages deletions for chunks no longer referenced.
-func stageOrphanedChunkDeletes(txn *atomic.Transaction, vaultRoot string, deletedChunks []config.ChunkRef, remainingManifest *config.Manifest) error {
+// filesExcept returns files without the entry for target
+func filesExcept(files []config.FileManifest, target *config.FileManifest) []config.FileManifest {
+	targetPath := target.Destination + target.FilePath
+	remaining := make([]config.FileManifest, 0, len(files))
+	for _, file := range files {
+		if file.Destination+file.FilePath != targetPath {
+			remaining = append(remaining, file)
+		}
+	}
+	return remaining
+}
+
+// orphanedChunks returns the deleted chunks that no remaining file references, each once
+func orphanedChunks(deletedChunks []config.ChunkRef, remainingManifest *config.Manifest) []config.ChunkRef {
 	chunksInUse := make(map[string]bool)
 	for _, file := range remainingManifest.Files {
 		for _, ch := range file.Chunks {
 			chunksInUse[ch.Hash] = true
 		}
 	}
-	var lastErr error
+	var orphaned []config.ChunkRef
 	for _, ch := range deletedChunks {
 		if chunksInUse[ch.Hash] {
 			continue
 		}
-		rel := filepath.ToSlash(filepath.Join(".sietch", "chunks", ch.Hash))
-		if err := txn.StageDelete(rel); err != nil {
-			lastErr = err
+		chunksInUse[ch.Hash] = true
+		orphaned = append(orphaned, ch)
+	}
+	return orphaned
+}
+
+// printDeletePlan reports what a delete would remove without touching the vault
+func printDeletePlan(target *config.FileManifest, manifestName string, orphaned []config.ChunkRef) {
+	var reclaimed int64
+	for _, ch := range orphaned {
+		reclaimed += storedSize(ch)
+	}
+
+	fmt.Printf("[dry-run] would delete '%s'\n", target.Destination+target.FilePath)
+	fmt.Printf("  Manifest: .sietch/manifests/%s\n", manifestName)
+	fmt.Printf("  Chunks:   %d of %d no longer referenced, %d still shared with other files\n",
+		len(orphaned), len(target.Chunks), len(target.Chunks)-len(orphaned))
+	fmt.Printf("  Space reclaimed: %s\n", util.HumanReadableSize(reclaimed))
+}
+
+// storedSize returns the size a chunk occupies in the vault's chunk store
+func storedSize(ch config.ChunkRef) int64 {
+	switch {
+	case ch.EncryptedSize > 0:
+		return ch.EncryptedSize
+	case ch.CompressedSize > 0:
+		return ch.CompressedSize
+	default:
+		return ch.Size
+	}
+}
+
+// stageOrphanedChunkDeletes stages deletions for chunks no longer referenced,
+// along with the second copy older releases kept of synced encrypted chunks
+// under their plaintext hash
+func stageOrphanedChunkDeletes(txn *atomic.Transaction, vaultRoot string, deletedChunks []config.ChunkRef, remainingManifest *config.Manifest) error {
+	var lastErr error
+	for _, ch := range orphanedChunks(deletedChunks, remainingManifest) {
+		names := []string{chunk.StorageName(ch)}
+		if ch.EncryptedHash != "" {
+			if _, err := os.Stat(fs.LocateChunk(vaultRoot, ch.Hash)); err == nil {
+				names = append(names, ch.Hash)
+			}
+		}
+		for _, name := range names {
+			if err := txn.StageDelete(fs.ChunkRelPath(vaultRoot, name)); err != nil {
+				lastErr = err
+			}
 		}
 	}
 	return lastErr
 }
 
+// stageTrashEntry stages the trash entry keeping a deleted file
+func stageTrashEntry(txn *atomic.Transaction, vaultRoot string, entry *config.TrashEntry) error {
+	data, err := config.EncodeTrashEntry(vaultRoot, entry)
+	if err != nil {
+		return err
+	}
+	w, err := txn.StageCreate(config.TrashRelPath(entry.ID))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// stageTombstone stages the tombstone recording the deletion of file
+func stageTombstone(txn *atomic.Transaction, vaultRoot string, file *config.FileManifest) error {
+	rel, err := config.TombstoneRelPath(vaultRoot, file.Destination, file.FilePath)
+	if err != nil {
+		return err
+	}
+	data, err := config.EncodeTombstone(vaultRoot, config.NewTombstone(file))
+	if err != nil {
+		return err
+	}
+	w, err := txn.StageReplace(rel)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
 func init() {
 	rootCmd.AddCommand(deleteCmd)
 
+	deleteCmd.ValidArgsFunction = completeVaultPaths
+
 	// Add flags
 	deleteCmd.Flags().BoolP("force", "f", false, "Force deletion without confirmation")
-	deleteCmd.Flags().Bool("keep-chunks", false, "Keep chunks, only delete manifest")
+	deleteCmd.Flags().Bool("purge", false, "Delete the file at once instead of moving it to the trash")
+	deleteCmd.Flags().Bool("keep-chunks", false, "With --purge, keep chunks and only delete the manifest")
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestOrphanedChunks(t *testing.T) {
+	target := config.FileManifest{
+		FilePath:    "report.pdf",
+		Destination: "docs/",
+		Chunks:      []config.ChunkRef{{Hash: "a", Size: 10}, {Hash: "b", Size: 20}, {Hash: "a", Size: 10}},
+	}
+	files := []config.FileManifest{
+		target,
+		{FilePath: "copy.pdf", Destination: "docs/", Chunks: []config.ChunkRef{{Hash: "b"}}},
+	}
+
+	remaining := &config.Manifest{Files: filesExcept(files, &target)}
+	if len(remaining.Files) != 1 || remaining.Files[0].FilePath != "copy.pdf" {
+		t.Fatalf("expected only copy.pdf to remain, got %v", remaining.Files)
+	}
+
+	orphaned := orphanedChunks(target.Chunks, remaining)
+	if len(orphaned) != 1 || orphaned[0].Hash != "a" {
+		t.Errorf("expected chunk a to be orphaned once, got %v", orphaned)
+	}
+
+	// Without removing the target from the list nothing is orphaned
+	if got := orphanedChunks(target.Chunks, &config.Manifest{Files: files}); len(got) != 0 {
+		t.Errorf("expected no orphans while the target is referenced, got %v", got)
+	}
+}
+
+func TestStoredSize(t *testing.T) {
+	tests := []struct {
+		chunk config.ChunkRef
+		want  int64
+	}{
+		{config.ChunkRef{Size: 100}, 100},
+		{config.ChunkRef{Size: 100, CompressedSize: 40}, 40},
+		{config.ChunkRef{Size: 100, CompressedSize: 40, EncryptedSize: 64}, 64},
+	}
+	for _, tt := range tests {
+		if got := storedSize(tt.chunk); got != tt.want {
+			t.Errorf("storedSize(%+v) = %d, want %d", tt.chunk, got, tt.want)
+		}
+	}
+}
@@ -32,7 +32,8 @@ Example:
   sietch discover                  # Run discovery with default settings
   sietch discover --timeout 30     # Run discovery for 30 seconds
   sietch discover --continuous     # Run discovery until interrupted
-  sietch discover --port 9001      # Use a specific port for the libp2p node`,
+  sietch discover --port 9001      # Use a specific port for the libp2p node
+  sietch discover --listen /ip4/192.168.1.5/tcp/4001  # Only listen on one interface`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get command flags
 		timeout, _ := cmd.Flags().GetInt("timeout")
@@ -63,18 +64,6 @@ Example:
 			cancel()
 		}()
 
-		// Create a libp2p host
-		host, err := p2p.CreateLibp2pHost(port)
-		if err != nil {
-			return fmt.Errorf("failed to create libp2p host: %v", err)
-		}
-		defer host.Close()
-
-		fmt.Printf("🔍 Starting peer discovery with node ID: %s\n", host.ID().String())
-		if verbose {
-			displayHostAddresses(host)
-		}
-
 		// Create a vault manager
 		vaultMgr, err := config.NewManager(vaultPath)
 		if err != nil {
@@ -87,6 +76,30 @@ Example:
 			return fmt.Errorf("failed to load vault configuration: %v", err)
 		}
 
+		// Create a libp2p host, in the vault's private network if it has one
+		networkKey, err := p2p.NetworkKeyOption(vaultPath, &vaultConfig.Sync)
+		if err != nil {
+			return err
+		}
+		listen, err := listenAddrsFromFlags(cmd, &vaultConfig.Sync)
+		if err != nil {
+			return err
+		}
+		listenOpt, err := p2p.ListenOption(listen)
+		if err != nil {
+			return err
+		}
+		host, err := p2p.CreateLibp2pHost(port, networkKey, listenOpt)
+		if err != nil {
+			return fmt.Errorf("failed to create libp2p host: %v", err)
+		}
+		defer host.Close()
+
+		fmt.Printf("🔍 Starting peer discovery with node ID: %s\n", host.ID().String())
+		if verbose {
+			displayHostAddresses(host)
+		}
+
 		// Create sync service (with or without RSA)
 		syncService, err := discover.CreateSyncService(host, vaultMgr, vaultConfig, vaultPath, verbose)
 		if err != nil {
@@ -120,6 +133,8 @@ func init() {
 	discoverCmd.Flags().IntP("timeout", "t", 60, "Discovery timeout in seconds (ignored with --continuous)")
 	discoverCmd.Flags().BoolP("continuous", "c", false, "Run discovery continuously until interrupted")
 	discoverCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+	discoverCmd.Flags().StringSlice("listen", nil, "Multiaddrs to listen on instead of sync.listen_addrs (repeatable)")
+	discoverCmd.Flags().Bool("no-listen", false, "Accept no incoming connections, only dial out to peers")
 	discoverCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
 	discoverCmd.Flags().StringP("vault-path", "V", "", "Path to the vault directory (defaults to current directory)")
 }
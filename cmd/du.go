@@ -0,0 +1,219 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// duRoot is the path du reports the whole vault under
+const duRoot = "."
+
+// duCmd represents the du command
+var duCmd = &cobra.Command{
+	Use:   "du [path]",
+	Short: "Show how much vault space each directory uses",
+	Long: `Report storage usage per destination directory, like du.
+
+Each directory counts the files below it:
+  STORED   bytes its distinct chunks take in the chunk store, after
+           compression and encryption
+  LOGICAL  total size of its files
+  SAVED    stored bytes deduplication avoids, because files in the
+           directory share chunks
+
+Directories are sorted by stored size, largest first, so the top of the list
+is what actually consumes the vault. A chunk shared between directories
+counts toward each of them, so the stored sizes of sibling directories can
+add up to more than their parent.
+
+Examples:
+  sietch du                # Every directory in the vault
+  sietch du --depth 1      # Top-level directories only
+  sietch du docs/          # Directories under docs/
+  sietch du -o json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		filterPath := ""
+		if len(args) > 0 {
+			filterPath = fs.VaultPath(args[0])
+		}
+		depth, _ := cmd.Flags().GetInt("depth")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+
+		usage := newDiskUsage(filterPath)
+		err = manager.WalkManifests(func(entry *config.ManifestEntry) error {
+			usage.add(entry.Manifest)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get vault manifest: %v", err)
+		}
+		entries := usage.entries(depth)
+
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, entries)
+		}
+		if len(entries) == 0 {
+			if filterPath != "" {
+				fmt.Printf("No files found in '%s'\n", filterPath)
+			} else {
+				fmt.Println("No files found in vault")
+			}
+			return nil
+		}
+		displayDiskUsage(os.Stdout, entries)
+		return nil
+	},
+}
+
+// duEntry is the storage usage of one directory
+type duEntry struct {
+	Path         string `json:"path" yaml:"path"`
+	Files        int    `json:"files" yaml:"files"`
+	LogicalBytes int64  `json:"logical_bytes" yaml:"logical_bytes"`
+	StoredBytes  int64  `json:"stored_bytes" yaml:"stored_bytes"`
+	SavedBytes   int64  `json:"saved_bytes" yaml:"saved_bytes"`
+}
+
+// duDir accumulates the usage of a directory and the directories below it
+type duDir struct {
+	files      int
+	logical    int64
+	referenced int64            // Stored size of every chunk reference, as if nothing were deduplicated
+	chunks     map[string]int64 // Stored size of each distinct chunk, by storage name
+}
+
+// diskUsage aggregates file manifests into per-directory usage
+type diskUsage struct {
+	filterPath string
+	dirs       map[string]*duDir
+}
+
+// newDiskUsage returns an empty report. With a filterPath only files whose
+// destination starts with it are counted, and the vault total is left out.
+func newDiskUsage(filterPath string) *diskUsage {
+	return &diskUsage{filterPath: filterPath, dirs: make(map[string]*duDir)}
+}
+
+// add counts file toward its directory and every directory above it
+func (u *diskUsage) add(file config.FileManifest) {
+	if !strings.HasPrefix(file.Destination, u.filterPath) {
+		return
+	}
+	for _, dir := range duAncestors(file.Destination) {
+		if u.filterPath != "" && !strings.HasPrefix(dir, u.filterPath) {
+			continue
+		}
+		d, ok := u.dirs[dir]
+		if !ok {
+			d = &duDir{chunks: make(map[string]int64)}
+			u.dirs[dir] = d
+		}
+		d.files++
+		d.logical += file.Size
+		for _, ref := range file.Chunks {
+			size := storedSize(ref)
+			d.referenced += size
+			d.chunks[chunk.StorageName(ref)] = size
+		}
+	}
+}
+
+// entries returns the usage of each directory at most depth levels below the
+// vault root, largest stored size first. A negative depth includes all.
+func (u *diskUsage) entries(depth int) []duEntry {
+	out := []duEntry{}
+	for path, d := range u.dirs {
+		if depth >= 0 && duDepth(path) > depth {
+			continue
+		}
+		var stored int64
+		for _, size := range d.chunks {
+			stored += size
+		}
+		out = append(out, duEntry{
+			Path:         path,
+			Files:        d.files,
+			LogicalBytes: d.logical,
+			StoredBytes:  stored,
+			SavedBytes:   d.referenced - stored,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].StoredBytes != out[j].StoredBytes {
+			return out[i].StoredBytes > out[j].StoredBytes
+		}
+		return out[i].Path < out[j].Path
+	})
+	return out
+}
+
+// duAncestors returns the vault root and every directory of destination,
+// outermost first: "a/b/" gives ".", "a/" and "a/b/"
+func duAncestors(destination string) []string {
+	dirs := []string{duRoot}
+	if destination != "" && !strings.HasSuffix(destination, "/") {
+		destination += "/"
+	}
+	for i, c := range destination {
+		if c == '/' && i > 0 {
+			dirs = append(dirs, destination[:i+1])
+		}
+	}
+	return dirs
+}
+
+// duDepth returns how many levels below the vault root path is
+func duDepth(path string) int {
+	if path == duRoot {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(path, "/"), "/") + 1
+}
+
+// displayDiskUsage prints the usage report as a table
+func displayDiskUsage(w io.Writer, entries []duEntry) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STORED\tLOGICAL\tSAVED\tFILES\tPATH")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n",
+			util.HumanReadableSize(e.StoredBytes), util.HumanReadableSize(e.LogicalBytes),
+			util.HumanReadableSize(e.SavedBytes), e.Files, e.Path)
+	}
+	_ = tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(duCmd)
+
+	duCmd.ValidArgsFunction = completeVaultDirs
+
+	duCmd.Flags().Int("depth", -1, "Only show directories this many levels below the vault root (-1 shows all)")
+}
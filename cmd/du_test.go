@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestDuAncestors(t *testing.T) {
+	tests := map[string]string{
+		"":        ".",
+		"a/":      ". a/",
+		"a/b/":    ". a/ a/b/",
+		"a/b":     ". a/ a/b/",
+		"a/b/c/d": ". a/ a/b/ a/b/c/ a/b/c/d/",
+	}
+	for destination, want := range tests {
+		if got := strings.Join(duAncestors(destination), " "); got != want {
+			t.Errorf("duAncestors(%q) = %q, want %q", destination, got, want)
+		}
+	}
+	for path, want := range map[string]int{".": 0, "a/": 1, "a/b/": 2} {
+		if got := duDepth(path); got != want {
+			t.Errorf("duDepth(%q) = %d, want %d", path, got, want)
+		}
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	shared := config.ChunkRef{Hash: "s", Size: 100, EncryptedSize: 120}
+	files := []config.FileManifest{
+		createTestManifest("a.bin", "media/video/", 300, []config.ChunkRef{{Hash: "v", Size: 300, CompressedSize: 200}, shared}),
+		createTestManifest("b.bin", "media/video/", 100, []config.ChunkRef{shared}),
+		createTestManifest("c.txt", "docs/", 100, []config.ChunkRef{shared}),
+		createTestManifest("top.txt", "", 10, []config.ChunkRef{{Hash: "t", Size: 10}}),
+	}
+	usage := newDiskUsage("")
+	for _, file := range files {
+		usage.add(file)
+	}
+
+	byPath := map[string]duEntry{}
+	entries := usage.entries(-1)
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+	want := map[string]duEntry{
+		".":            {Path: ".", Files: 4, LogicalBytes: 510, StoredBytes: 330, SavedBytes: 240},
+		"media/":       {Path: "media/", Files: 2, LogicalBytes: 400, StoredBytes: 320, SavedBytes: 120},
+		"media/video/": {Path: "media/video/", Files: 2, LogicalBytes: 400, StoredBytes: 320, SavedBytes: 120},
+		"docs/":        {Path: "docs/", Files: 1, LogicalBytes: 100, StoredBytes: 120, SavedBytes: 0},
+	}
+	if len(byPath) != len(want) {
+		t.Fatalf("expected %d directories, got %+v", len(want), entries)
+	}
+	for path, w := range want {
+		if byPath[path] != w {
+			t.Errorf("%s = %+v, want %+v", path, byPath[path], w)
+		}
+	}
+
+	// Largest stored size first, ties by path
+	var order []string
+	for _, e := range entries {
+		order = append(order, e.Path)
+	}
+	if got := strings.Join(order, " "); got != ". media/ media/video/ docs/" {
+		t.Errorf("unexpected order %q", got)
+	}
+
+	if top := usage.entries(1); len(top) != 3 {
+		t.Errorf("expected the root and top-level directories, got %+v", top)
+	}
+
+	filtered := newDiskUsage("media/")
+	for _, file := range files {
+		filtered.add(file)
+	}
+	if got := filtered.entries(-1); len(got) != 2 || got[0].Path != "media/" || got[1].Path != "media/video/" {
+		t.Errorf("expected only directories under media/, got %+v", got)
+	}
+}
+
+func TestDisplayDiskUsage(t *testing.T) {
+	var buf bytes.Buffer
+	displayDiskUsage(&buf, []duEntry{{Path: "docs/", Files: 2, LogicalBytes: 2048, StoredBytes: 1024, SavedBytes: 512}})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "STORED") {
+		t.Fatalf("unexpected table:\n%s", buf.String())
+	}
+	fields := strings.Fields(lines[1])
+	if strings.Join(fields, " ") != "1.0 KB 2.0 KB 512 B 2 docs/" {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+}
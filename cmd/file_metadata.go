@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// metadataOptions selects which optional POSIX metadata is recorded or restored.
+// Permission bits are always recorded; restoring them can be disabled.
+type metadataOptions struct {
+	Perms  bool
+	Owner  bool
+	Xattrs bool
+}
+
+// recordFileMetadata stores ownership and extended attributes of sourcePath in m
+func recordFileMetadata(m *config.FileManifest, sourcePath string, info os.FileInfo, opts metadataOptions) error {
+	if opts.Owner {
+		if uid, gid, ok := fs.FileOwner(info); ok {
+			m.Owner = &config.FileOwner{UID: uid, GID: gid}
+		}
+	}
+
+	if opts.Xattrs {
+		attrs, err := fs.ListXattrs(sourcePath)
+		if err != nil {
+			if errors.Is(err, fs.ErrMetadataUnsupported) {
+				return nil
+			}
+			return err
+		}
+		if len(attrs) > 0 {
+			m.Xattrs = make(map[string]string, len(attrs))
+			for name, value := range attrs {
+				m.Xattrs[name] = base64.StdEncoding.EncodeToString(value)
+			}
+		}
+	}
+	return nil
+}
+
+// restoreFileMetadata applies the recorded metadata in m to the retrieved file at path.
+// Every failure is collected so one unsupported attribute doesn't hide the others.
+func restoreFileMetadata(path string, m *config.FileManifest, opts metadataOptions) []error {
+	var errs []error
+
+	if opts.Owner && m.Owner != nil {
+		if err := os.Lchown(path, m.Owner.UID, m.Owner.GID); err != nil {
+			errs = append(errs, fmt.Errorf("restore owner: %v", err))
+		}
+	}
+
+	// Permissions are applied after chown, which may clear setuid/setgid bits.
+	// Those and the sticky bit are only restored along with the owner, so a
+	// retrieved file never becomes setuid for whoever runs get.
+	if opts.Perms && m.Mode != 0 {
+		mode := m.Mode
+		if !opts.Owner {
+			mode &= 0o777
+		}
+		if err := os.Chmod(path, fs.FileModeFromPosix(mode)); err != nil {
+			errs = append(errs, fmt.Errorf("restore permissions: %v", err))
+		}
+	}
+
+	if opts.Xattrs && len(m.Xattrs) > 0 {
+		attrs := make(map[string][]byte, len(m.Xattrs))
+		for name, encoded := range m.Xattrs {
+			value, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("decode xattr %s: %v", name, err))
+				continue
+			}
+			attrs[name] = value
+		}
+		if err := fs.SetXattrs(path, attrs); err != nil {
+			errs = append(errs, fmt.Errorf("restore xattrs: %v", err))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func TestNewFileManifestRecordsMode(t *testing.T) {
+	dir := testutil.TempDir(t, "meta-mode")
+	path := testutil.CreateTestFile(t, dir, "script.sh", "#!/bin/sh\n")
+	if err := os.Chmod(path, 0o750); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	m := newFileManifest("bin/script.sh", info, nil, nil)
+	if m.Mode != 0o750 {
+		t.Errorf("expected mode 0750, got %o", m.Mode)
+	}
+	if m.Destination != "bin/" || m.FilePath != "script.sh" {
+		t.Errorf("unexpected destination split: %q %q", m.Destination, m.FilePath)
+	}
+}
+
+func TestRecordAndRestoreFileMetadata(t *testing.T) {
+	dir := testutil.TempDir(t, "meta-restore")
+	src := testutil.CreateTestFile(t, dir, "src.txt", "data")
+	info, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	m := &config.FileManifest{Mode: 0o600}
+	if err := recordFileMetadata(m, src, info, metadataOptions{Owner: true}); err != nil {
+		t.Fatalf("recordFileMetadata: %v", err)
+	}
+	if _, _, ok := fs.FileOwner(info); ok && (m.Owner == nil || m.Owner.UID != os.Getuid()) {
+		t.Errorf("expected owner to be recorded, got %+v", m.Owner)
+	}
+
+	dst := testutil.CreateTestFile(t, dir, "dst.txt", "data")
+
+	// Permissions are left alone when disabled
+	if errs := restoreFileMetadata(dst, m, metadataOptions{}); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if st, _ := os.Stat(dst); st.Mode().Perm() == 0o600 {
+		t.Fatal("permissions should not be restored without the option")
+	}
+
+	if errs := restoreFileMetadata(dst, m, metadataOptions{Perms: true}); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if st, _ := os.Stat(dst); st.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600 after restore, got %o", st.Mode().Perm())
+	}
+
+	// Setuid, setgid and sticky bits need the owner restored too
+	m.Mode = 0o4755
+	if errs := restoreFileMetadata(dst, m, metadataOptions{Perms: true}); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if st, _ := os.Stat(dst); st.Mode()&os.ModeSetuid != 0 || st.Mode().Perm() != 0o755 {
+		t.Errorf("expected mode 0755 without setuid, got %v", st.Mode())
+	}
+	if errs := restoreFileMetadata(dst, m, metadataOptions{Perms: true, Owner: true}); len(errs) == 0 {
+		if st, _ := os.Stat(dst); st.Mode()&os.ModeSetuid == 0 {
+			t.Errorf("expected setuid restored along with the owner, got %v", st.Mode())
+		}
+	}
+
+	// Bad xattr encodings are reported rather than aborting the restore
+	m.Xattrs = map[string]string{"user.bad": "%%%"}
+	if errs := restoreFileMetadata(dst, m, metadataOptions{Xattrs: true}); len(errs) == 0 {
+		t.Error("expected an error for an invalid xattr encoding")
+	}
+}
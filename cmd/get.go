@@ -10,10 +10,14 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/substantialcattle5/sietch/internal/chunkcache"
 	"github.com/substantialcattle5/sietch/internal/compression"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/encryption"
@@ -72,8 +76,14 @@ func findFileManifest(vaultRoot, filePath string) (*config.FileManifest, error)
 		return nil, fmt.Errorf("failed to get vault manifest: %v", err)
 	}
 
+	return matchFileManifest(vaultManifest.Files, filePath)
+}
+
+// matchFileManifest finds the file filePath names among files, see findFileManifest
+func matchFileManifest(files []config.FileManifest, filePath string) (*config.FileManifest, error) {
+	filePath = fs.VaultPath(filePath)
 	// Search through all files to find a match
-	for _, fileManifest := range vaultManifest.Files {
+	for _, fileManifest := range files {
 		// Try multiple matching strategies:
 		// 1. Exact match with full path (Destination + FilePath)
 		fullPath := fileManifest.Destination + fileManifest.FilePath
@@ -87,26 +97,26 @@ func findFileManifest(vaultRoot, filePath string) (*config.FileManifest, error)
 		}
 
 		// 3. Match basename if user provided just filename
-		if filepath.Base(fileManifest.FilePath) == filePath {
+		if path.Base(fileManifest.FilePath) == filePath {
 			return &fileManifest, nil
 		}
 
 		// 4. Match basename of full path
-		if filepath.Base(fullPath) == filePath {
+		if path.Base(fullPath) == filePath {
 			return &fileManifest, nil
 		}
 	}
 
 	// If we get here, no file was found - provide helpful error message
-	if len(vaultManifest.Files) == 0 {
+	if len(files) == 0 {
 		return nil, fmt.Errorf("no files found in vault")
 	}
 
 	// Show similar files to help user
 	var suggestions []string
-	for _, fileManifest := range vaultManifest.Files {
+	for _, fileManifest := range files {
 		fullPath := fileManifest.Destination + fileManifest.FilePath
-		if filepath.Base(fullPath) == filepath.Base(filePath) {
+		if path.Base(fullPath) == path.Base(filePath) {
 			suggestions = append(suggestions, fullPath)
 		}
 	}
@@ -131,11 +141,18 @@ var getCmd = &cobra.Command{
 	Long: `Retrieve a file from your Sietch vault.
 
 This command retrieves a file from your vault, decrypts it if necessary,
-and writes it to the specified destination.
+and writes it to the specified destination. Passing a vault directory
+retrieves every file below it and recreates hard links recorded at add time.
+
+Symlinks are recreated after the other files, and nothing is written through
+a symlink below the destination. Symlinks with absolute or '..' targets are
+refused unless --unsafe-symlinks is given.
 
 Example:
   sietch get document.txt ~/Documents/
-  sietch get vault/photos/vacation.jpg ./retrieved_photos/`,
+  sietch get vault/photos/vacation.jpg ./retrieved_photos/
+  sietch get vault/photos/ ./retrieved_photos/  # Whole directory, hard links recreated
+  sietch get --range 100MB-200MB vm/disk.img ./  # Only the given byte range`,
 	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get global flags
@@ -155,7 +172,7 @@ Example:
 		}
 
 		// Parse arguments
-		filePath := args[0]
+		filePath := fs.VaultPath(args[0])
 		destPath := "."
 		if len(args) > 1 {
 			destPath = args[1]
@@ -164,35 +181,33 @@ Example:
 		// Get flags
 		force, _ := cmd.Flags().GetBool(force)
 		skipEncryption, _ := cmd.Flags().GetBool(skipDecryption)
+		skipVerify, _ := cmd.Flags().GetBool(skipVerification)
+		noPerms, _ := cmd.Flags().GetBool("no-perms")
+		restoreOwner, _ := cmd.Flags().GetBool("restore-owner")
+		restoreXattrs, _ := cmd.Flags().GetBool("xattrs")
+		unsafeLinks, _ := cmd.Flags().GetBool("unsafe-symlinks")
 
 		if !quiet {
 			fmt.Printf("Retrieving %s from vault\n", filePath)
 		}
 
-		// Find the file manifest by searching through all manifests
-		fileManifest, err := findFileManifest(vaultRoot, filePath)
-		if err != nil {
-			return fmt.Errorf("file not found in vault: %v", err)
+		// Find the file manifest by searching through all manifests. A path ending
+		// in "/", or one that only matches a directory, retrieves the whole tree.
+		var fileManifest *config.FileManifest
+		var treeFiles []config.FileManifest
+		if !strings.HasSuffix(filePath, "/") {
+			fileManifest, err = findFileManifest(vaultRoot, filePath)
 		}
-
-		// Determine output path
-		outputPath := filepath.Join(destPath, fileManifest.FilePath)
-		if _, err := os.Stat(outputPath); err == nil && !force {
-			return fmt.Errorf("file %s already exists, use --force to overwrite", outputPath)
-		}
-
-		// Ensure destination directory exists
-		destDir := filepath.Dir(outputPath)
-		if err := os.MkdirAll(destDir, 0o755); err != nil {
-			return fmt.Errorf("failed to create destination directory: %v", err)
-		}
-
-		// Create output file
-		outputFile, err := os.Create(outputPath)
-		if err != nil {
-			return fmt.Errorf("failed to create output file: %v", err)
+		if fileManifest == nil {
+			var dirErr error
+			treeFiles, dirErr = findDirectoryManifests(vaultRoot, filePath)
+			if dirErr != nil || len(treeFiles) == 0 {
+				if err == nil {
+					err = fmt.Errorf("no files found under '%s'", filePath)
+				}
+				return fmt.Errorf("file not found in vault: %v", err)
+			}
 		}
-		defer outputFile.Close()
 
 		// Get passphrase if needed for decryption
 		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
@@ -210,123 +225,59 @@ Example:
 		ctx := context.Background()
 		ctx = progressMgr.SetupCancellation(ctx)
 
-		// Process each chunk
-		chunkCount := len(fileManifest.Chunks)
-		totalSize := int64(0)
-		for _, chunkRef := range fileManifest.Chunks {
-			totalSize += chunkRef.Size
-		}
-
-		// Initialize progress bars
-		progressMgr.InitTotalProgress(totalSize, "Retrieving file")
-
-		if !quiet {
-			fmt.Printf("Reassembling file from %d chunks\n", chunkCount)
+		r := &retriever{
+			vaultRoot:      vaultRoot,
+			vaultConfig:    vaultConfig,
+			passphrase:     passphrase,
+			force:          force,
+			skipEncryption: skipEncryption,
+			skipVerify:     skipVerify,
+			quiet:          quiet,
+			metaOpts:       metadataOptions{Perms: !noPerms, Owner: restoreOwner, Xattrs: restoreXattrs},
+			root:           destPath,
+			unsafeLinks:    unsafeLinks,
+			progressMgr:    progressMgr,
+			cache:          openChunkCache(vaultRoot, vaultConfig),
 		}
+		defer r.printCacheStats()
 
-		for i, chunkRef := range fileManifest.Chunks {
-			// Check for cancellation
-			select {
-			case <-ctx.Done():
-				progressMgr.Cleanup()
-				return fmt.Errorf("operation cancelled")
-			default:
-			}
-
-			progressMgr.PrintVerbose("Processing chunk %d/%d\n", i+1, chunkCount)
+		rangeSpec, _ := cmd.Flags().GetString("range")
 
-			// Get the chunk hash to use - if encrypted, use the encrypted hash
-			chunkHash := chunkRef.Hash
-			if chunkRef.EncryptedHash != "" {
-				chunkHash = chunkRef.EncryptedHash
+		if fileManifest == nil {
+			if rangeSpec != "" {
+				return fmt.Errorf("--range can only be used when retrieving a single file")
 			}
+			err := r.retrieveTree(ctx, treeFiles, filePath, destPath)
+			progressMgr.Cleanup()
+			return err
+		}
 
-			// Get the chunk path
-			chunkPath := filepath.Join(vaultRoot, ".sietch", "chunks", chunkHash)
+		// Determine output path
+		outputPath := filepath.Join(destPath, fileManifest.FilePath)
 
-			// Check if chunk exists
-			if _, err := os.Stat(chunkPath); os.IsNotExist(err) {
-				return fmt.Errorf("chunk %s not found", chunkHash)
+		// Only the chunks covering the requested range are read
+		if rangeSpec != "" {
+			if skipEncryption {
+				return fmt.Errorf("--range cannot be combined with --%s", skipDecryption)
 			}
-
-			// Read the chunk data
-			chunkData, err := os.ReadFile(chunkPath)
+			start, end, err := parseByteRange(rangeSpec, fileManifest.Size)
 			if err != nil {
-				return fmt.Errorf("failed to read chunk: %v", err)
-			}
-
-			// Decrypt the chunk if encryption is enabled and not skipped
-			if !skipEncryption && vaultConfig.Encryption.Type != "none" {
-				if len(chunkData) == 0 {
-					return fmt.Errorf("chunk %s is empty", chunkHash)
-				}
-
-				// Decrypt the data using the appropriate method based on passphrase protection
-				var decryptedData string
-				if vaultConfig.Encryption.PassphraseProtected {
-					decryptedData, err = encryption.DecryptDataWithPassphrase(
-						string(chunkData),
-						vaultRoot,
-						passphrase,
-					)
-				} else {
-					decryptedData, err = encryption.DecryptData(
-						string(chunkData),
-						vaultRoot,
-					)
-				}
-				if err != nil {
-					return fmt.Errorf("failed to decrypt chunk %s: %v", chunkHash, err)
-				}
-
-				// The original data was base64-encoded before encryption. Decode back to bytes.
-				decodedBytes, err := base64.StdEncoding.DecodeString(decryptedData)
-				if err != nil {
-					return fmt.Errorf("failed to base64-decode decrypted chunk %s: %v", chunkHash, err)
-				}
-				chunkData = decodedBytes
+				return err
 			}
-
-			// Decompress the chunk if it was compressed
-			if chunkRef.Compressed {
-				// Use the compression type stored in the chunk ref, not the current vault config
-				// This handles cases where the vault compression setting changed after the file was added
-				compressionType := chunkRef.CompressionType
-				if compressionType == "" {
-					// Fallback to vault config for backwards compatibility with old manifests
-					compressionType = vaultConfig.Compression
-				}
-				decompressedData, err := compression.DecompressData(chunkData, compressionType)
-				if err != nil {
-					return fmt.Errorf("failed to decompress chunk %s: %v", chunkHash, err)
-				}
-				chunkData = decompressedData
-			}
-
-			skipVerify, _ := cmd.Flags().GetBool(skipVerification)
-			if !skipEncryption && !skipVerify && chunkRef.Hash != "" {
-				if err := verifyChunkWithRetry(ctx, chunkRef, string(chunkData), 3); err != nil {
-					progressMgr.PrintVerbose("Chunk %s failed integrity verification: %v\n", chunkHash, err)
-					return fmt.Errorf("chunk %s integrity verification failed after retries: %v", chunkHash, err)
-				}
-				progressMgr.PrintVerbose("Chunk %s integrity verified successfully\n", chunkHash)
-			} else if skipVerify {
-				progressMgr.PrintVerbose("Skipping integrity verification for chunk %s (--skip-verification flag used)\n", chunkHash)
-			}
-
-			// Write the chunk to the output file
-			bytesWritten, err := outputFile.Write(chunkData)
+			err = r.retrieveRange(ctx, fileManifest, outputPath, start, end)
+			progressMgr.Cleanup()
 			if err != nil {
-				progressMgr.Cleanup()
-				return fmt.Errorf("failed to write to output file: %v", err)
+				return err
 			}
-
-			// Update progress bars
-			progressMgr.UpdateTotalProgress(int64(bytesWritten))
+			progressMgr.PrintInfo("\nRetrieved bytes %d-%d of %s into %s\n", start, end, fileManifest.Destination+fileManifest.FilePath, outputPath)
+			progressMgr.PrintInfo("Size: %s\n", util.HumanReadableSize(end-start))
+			return nil
 		}
 
-		// Complete progress bars
-		progressMgr.FinishTotalProgress()
+		if err := r.retrieveFile(ctx, fileManifest, outputPath); err != nil {
+			progressMgr.Cleanup()
+			return err
+		}
 		progressMgr.Cleanup()
 
 		progressMgr.PrintInfo("\nFile retrieved successfully: %s\n", outputPath)
@@ -338,7 +289,6 @@ Example:
 		}
 
 		// Note about encryption and verification status
-		skipVerify, _ := cmd.Flags().GetBool(skipVerification)
 		if skipEncryption && vaultConfig.Encryption.Type != "none" {
 			progressMgr.PrintInfo("\nWarning: File retrieved without decryption (--skip-decryption flag used)")
 		} else if vaultConfig.Encryption.Type != "none" {
@@ -353,13 +303,581 @@ Example:
 	},
 }
 
+// retriever holds the settings shared by every file written during one get
+type retriever struct {
+	vaultRoot      string
+	vaultConfig    *config.VaultConfig
+	passphrase     string
+	force          bool
+	skipEncryption bool
+	skipVerify     bool
+	quiet          bool
+	metaOpts       metadataOptions
+	root           string // Directory every output must stay below
+	unsafeLinks    bool   // Restore symlinks with absolute or '..' targets
+	progressMgr    *progress.Manager
+	cache          *chunkcache.Cache // Decoded chunks; nil caches nothing
+}
+
+// openChunkCache returns the decoded-chunk cache sized by the vault's cache
+// settings. A cache that cannot be opened only costs speed, so it is reported
+// and reading continues without it.
+func openChunkCache(vaultRoot string, vaultConfig *config.VaultConfig) *chunkcache.Cache {
+	opts := chunkcache.Options{MemorySize: chunkcache.DefaultMemorySize}
+	if size := vaultConfig.Cache.MemorySize; size != "" {
+		n, err := util.ParseChunkSize(size)
+		if err != nil {
+			fmt.Printf("Warning: invalid cache.memory_size %q, using the default: %v\n", size, err)
+		} else {
+			opts.MemorySize = n
+		}
+	}
+	if size := vaultConfig.Cache.DiskSize; size != "" {
+		n, err := util.ParseChunkSize(size)
+		if err != nil {
+			fmt.Printf("Warning: invalid cache.disk_size %q, disk cache disabled: %v\n", size, err)
+		} else {
+			opts.DiskDir = filepath.Join(vaultRoot, ".sietch", "cache", "chunks")
+			opts.DiskSize = n
+		}
+	}
+
+	cache, err := chunkcache.New(opts)
+	if err != nil {
+		fmt.Printf("Warning: chunk cache disabled: %v\n", err)
+		return nil
+	}
+	return cache
+}
+
+// printCacheStats reports chunk cache hit rates in verbose output
+func (r *retriever) printCacheStats() {
+	if stats := r.cache.Stats(); stats.Hits+stats.Misses > 0 {
+		r.progressMgr.PrintVerbose("Chunk cache: %s\n", stats)
+	}
+}
+
+// findDirectoryManifests returns the manifests of every file stored under the vault directory dir
+func findDirectoryManifests(vaultRoot, dir string) ([]config.FileManifest, error) {
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	vaultManifest, err := manager.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vault manifest: %v", err)
+	}
+	return filesUnderDir(vaultManifest.Files, dir), nil
+}
+
+// filesUnderDir returns the files whose destination lies at or below dir, with
+// files carrying a hard link ordered after the files they link to
+func filesUnderDir(files []config.FileManifest, dir string) []config.FileManifest {
+	prefix := strings.Trim(dir, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var matched []config.FileManifest
+	for _, file := range files {
+		if strings.HasPrefix(file.Destination, prefix) {
+			matched = append(matched, file)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].HardLink == "" && matched[j].HardLink != ""
+	})
+	return matched
+}
+
+// retrieveTree writes every file in files below destPath, keeping their layout
+// relative to dir and recreating hard links between them
+func (r *retriever) retrieveTree(ctx context.Context, files []config.FileManifest, dir, destPath string) error {
+	prefix := strings.Trim(dir, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	// Symlinks are made after every other file, so none is written through one
+	ordered := make([]*config.FileManifest, 0, len(files))
+	var symlinks []*config.FileManifest
+	for i := range files {
+		if files[i].Symlink != "" {
+			symlinks = append(symlinks, &files[i])
+		} else {
+			ordered = append(ordered, &files[i])
+		}
+	}
+	ordered = append(ordered, symlinks...)
+
+	written := make(map[string]string) // Vault path -> output path
+	var failed int
+	var linked int
+	for _, file := range ordered {
+		vaultPath := file.Destination + file.FilePath
+		outputPath := filepath.Join(destPath, filepath.FromSlash(strings.TrimPrefix(vaultPath, prefix)))
+
+		if target, ok := written[file.HardLink]; ok && file.HardLink != "" {
+			err := r.linkFile(target, outputPath)
+			if err == nil {
+				written[vaultPath] = outputPath
+				linked++
+				continue
+			}
+			r.progressMgr.PrintVerbose("Could not link %s, writing a copy: %v\n", vaultPath, err)
+		}
+
+		if err := r.retrieveFile(ctx, file, outputPath); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			fmt.Printf("✗ %s: %v\n", vaultPath, err)
+			failed++
+			continue
+		}
+		written[vaultPath] = outputPath
+	}
+
+	r.progressMgr.PrintInfo("\nRetrieved %d of %d files into %s\n", len(written), len(files), destPath)
+	if linked > 0 {
+		r.progressMgr.PrintInfo("Recreated %d hard link(s)\n", linked)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) could not be retrieved", failed)
+	}
+	return nil
+}
+
+// checkOutput refuses an output path outside root or below a symlink in it,
+// so that neither a symlink made earlier in the run nor one already in the
+// destination can redirect where a file is written
+func checkOutput(root, outputPath string) error {
+	rel, err := filepath.Rel(root, outputPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("refusing to write %s outside %s", outputPath, root)
+	}
+	dir := root
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write %s through symlink %s", outputPath, dir)
+		}
+	}
+	return nil
+}
+
+// unsafeLinkTarget reports whether a symlink target is absolute or climbs
+// with '..', either of which can point outside the destination
+func unsafeLinkTarget(target string) bool {
+	if filepath.IsAbs(target) {
+		return true
+	}
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// linkFile recreates a hard link at outputPath pointing to an already retrieved file
+func (r *retriever) linkFile(target, outputPath string) error {
+	if err := checkOutput(r.root, outputPath); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(outputPath); err == nil {
+		if !r.force {
+			return fmt.Errorf("file %s already exists, use --force to overwrite", outputPath)
+		}
+		if err := os.Remove(outputPath); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+	return os.Link(target, outputPath)
+}
+
+// restoreSymlink creates a symlink to target at outputPath. Targets that can
+// point outside the destination are refused unless --unsafe-symlinks is set.
+func (r *retriever) restoreSymlink(target, outputPath string) error {
+	if unsafeLinkTarget(target) && !r.unsafeLinks {
+		return fmt.Errorf("refusing symlink %s → %s, which can point outside %s; use --unsafe-symlinks to restore it", outputPath, target, r.root)
+	}
+	if err := checkOutput(r.root, outputPath); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(outputPath); err == nil {
+		if !r.force {
+			return fmt.Errorf("file %s already exists, use --force to overwrite", outputPath)
+		}
+		if err := os.Remove(outputPath); err != nil {
+			return fmt.Errorf("failed to replace %s: %v", outputPath, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+	if err := os.Symlink(target, outputPath); err != nil {
+		return fmt.Errorf("failed to create symlink: %v", err)
+	}
+	if !r.quiet {
+		fmt.Printf("Restored symlink %s → %s\n", outputPath, target)
+	}
+	return nil
+}
+
+// parseByteRange parses START-END (sizes such as 100MB, END exclusive) against a
+// file of the given size. Either side may be omitted: "1GB-" reads to the end of
+// the file and "-10MB" reads the first 10MB.
+func parseByteRange(spec string, size int64) (int64, int64, error) {
+	startSpec, endSpec, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q: expected START-END", spec)
+	}
+
+	start, end := int64(0), size
+	var err error
+	if startSpec != "" {
+		if start, err = util.ParseChunkSize(startSpec); err != nil {
+			return 0, 0, fmt.Errorf("invalid range start %q: %v", startSpec, err)
+		}
+	}
+	if endSpec != "" {
+		if end, err = util.ParseChunkSize(endSpec); err != nil {
+			return 0, 0, fmt.Errorf("invalid range end %q: %v", endSpec, err)
+		}
+	}
+
+	end = min(end, size)
+	if start < 0 || start >= end {
+		return 0, 0, fmt.Errorf("range %q is empty or outside the file (size %d bytes)", spec, size)
+	}
+	return start, end, nil
+}
+
+// chunkOffsets returns the file offset of each chunk. Manifests written before
+// offsets were recorded store chunks back to back, so offsets are derived there.
+func chunkOffsets(m *config.FileManifest) []int64 {
+	offsets := make([]int64, len(m.Chunks))
+	var pos int64
+	for i, c := range m.Chunks {
+		if len(m.Holes) > 0 {
+			offsets[i] = c.Offset
+		} else {
+			offsets[i] = pos
+		}
+		pos += c.Size
+	}
+	return offsets
+}
+
+// prepareOutput checks that a regular file can be written at outputPath. An
+// existing symlink there is removed with --force rather than written through.
+func (r *retriever) prepareOutput(outputPath string) error {
+	if err := checkOutput(r.root, outputPath); err != nil {
+		return err
+	}
+	info, err := os.Lstat(outputPath)
+	if err != nil {
+		return nil
+	}
+	if !r.force {
+		return fmt.Errorf("file %s already exists, use --force to overwrite", outputPath)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(outputPath); err != nil {
+			return fmt.Errorf("failed to replace %s: %v", outputPath, err)
+		}
+	}
+	return nil
+}
+
+// retrieveRange writes bytes [start, end) of a stored file to outputPath,
+// reading only the chunks that overlap the range
+func (r *retriever) retrieveRange(ctx context.Context, fileManifest *config.FileManifest, outputPath string, start, end int64) error {
+	if fileManifest.Symlink != "" {
+		return fmt.Errorf("%s is a symlink and has no content to read", fileManifest.FilePath)
+	}
+	if err := r.prepareOutput(outputPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer outputFile.Close()
+
+	r.progressMgr.InitTotalProgress(end-start, "Retrieving range")
+
+	offsets := chunkOffsets(fileManifest)
+	used := 0
+	for i, chunkRef := range fileManifest.Chunks {
+		chunkStart, chunkEnd := offsets[i], offsets[i]+chunkRef.Size
+		if chunkEnd <= start || chunkStart >= end {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("operation cancelled")
+		default:
+		}
+
+		chunkData, err := r.readChunk(ctx, chunkRef)
+		if err != nil {
+			return err
+		}
+		if int64(len(chunkData)) != chunkRef.Size {
+			return fmt.Errorf("chunk %d has %d bytes, manifest records %d", i, len(chunkData), chunkRef.Size)
+		}
+
+		from, to := max(start, chunkStart), min(end, chunkEnd)
+		n, err := outputFile.WriteAt(chunkData[from-chunkStart:to-chunkStart], from-start)
+		if err != nil {
+			return fmt.Errorf("failed to write to output file: %v", err)
+		}
+		r.progressMgr.UpdateTotalProgress(int64(n))
+		used++
+	}
+
+	// Holes at the end of the range read as zeros
+	if err := outputFile.Truncate(end - start); err != nil {
+		return fmt.Errorf("failed to size output file: %v", err)
+	}
+
+	r.progressMgr.FinishTotalProgress()
+	r.progressMgr.PrintVerbose("Read %d of %d chunks for the range\n", used, len(fileManifest.Chunks))
+	return nil
+}
+
+// readChunk loads a chunk from the vault, then decrypts, decompresses and
+// verifies it according to the retriever settings
+func (r *retriever) readChunk(ctx context.Context, chunkRef config.ChunkRef) ([]byte, error) {
+	progressMgr := r.progressMgr
+	vaultConfig := r.vaultConfig
+
+	// Get the chunk hash to use - if encrypted, use the encrypted hash
+	chunkHash := chunkRef.Hash
+	if chunkRef.EncryptedHash != "" {
+		chunkHash = chunkRef.EncryptedHash
+	}
+
+	// Raw chunks read with --skip-decryption are never cached
+	useCache := r.cache != nil && !r.skipEncryption
+	if useCache {
+		if chunkData, ok := r.cache.Get(chunkHash); ok {
+			if !r.skipVerify && chunkRef.Hash != "" {
+				if err := verifyChunkWithRetry(ctx, chunkRef, string(chunkData), 1); err != nil {
+					return nil, fmt.Errorf("cached chunk %s integrity verification failed: %v", chunkHash, err)
+				}
+			}
+			progressMgr.PrintVerbose("Chunk %s read from cache\n", chunkHash)
+			return chunkData, nil
+		}
+	}
+
+	// Get the chunk path
+	chunkPath := fs.LocateChunk(r.vaultRoot, chunkHash)
+
+	// Check if chunk exists
+	if _, err := os.Stat(chunkPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("chunk %s not found", chunkHash)
+	}
+
+	// Read the chunk data
+	chunkData, err := os.ReadFile(chunkPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %v", err)
+	}
+
+	// Decrypt the chunk if encryption is enabled and not skipped
+	if !r.skipEncryption && vaultConfig.Encryption.Type != "none" {
+		if len(chunkData) == 0 {
+			return nil, fmt.Errorf("chunk %s is empty", chunkHash)
+		}
+
+		// Decrypt the data using the appropriate method based on passphrase protection
+		var decryptedData string
+		if vaultConfig.Encryption.PassphraseProtected {
+			decryptedData, err = encryption.DecryptDataWithPassphrase(
+				string(chunkData),
+				r.vaultRoot,
+				r.passphrase,
+			)
+		} else {
+			decryptedData, err = encryption.DecryptData(
+				string(chunkData),
+				r.vaultRoot,
+			)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt chunk %s: %v", chunkHash, err)
+		}
+
+		// The original data was base64-encoded before encryption. Decode back to bytes.
+		decodedBytes, err := base64.StdEncoding.DecodeString(decryptedData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to base64-decode decrypted chunk %s: %v", chunkHash, err)
+		}
+		chunkData = decodedBytes
+	}
+
+	// Decompress the chunk if it was compressed
+	if chunkRef.Compressed {
+		// Use the compression type stored in the chunk ref, not the current vault config
+		// This handles cases where the vault compression setting changed after the file was added
+		compressionType := chunkRef.CompressionType
+		if compressionType == "" {
+			// Fallback to vault config for backwards compatibility with old manifests
+			compressionType = vaultConfig.Compression
+		}
+		decompressedData, err := compression.DecompressData(chunkData, compressionType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress chunk %s: %v", chunkHash, err)
+		}
+		chunkData = decompressedData
+	}
+
+	if !r.skipEncryption && !r.skipVerify && chunkRef.Hash != "" {
+		if err := verifyChunkWithRetry(ctx, chunkRef, string(chunkData), 3); err != nil {
+			progressMgr.PrintVerbose("Chunk %s failed integrity verification: %v\n", chunkHash, err)
+			return nil, fmt.Errorf("chunk %s integrity verification failed after retries: %v", chunkHash, err)
+		}
+		progressMgr.PrintVerbose("Chunk %s integrity verified successfully\n", chunkHash)
+	} else if r.skipVerify {
+		progressMgr.PrintVerbose("Skipping integrity verification for chunk %s (--skip-verification flag used)\n", chunkHash)
+	}
+
+	// Only verified chunks are cached, so later reads can trust the cache
+	if useCache && !r.skipVerify {
+		r.cache.Put(chunkHash, chunkData)
+	}
+
+	return chunkData, nil
+}
+
+// retrieveFile reassembles a single file from its chunks at outputPath and
+// restores its recorded metadata
+func (r *retriever) retrieveFile(ctx context.Context, fileManifest *config.FileManifest, outputPath string) error {
+	progressMgr := r.progressMgr
+
+	if fileManifest.Symlink != "" {
+		return r.restoreSymlink(fileManifest.Symlink, outputPath)
+	}
+
+	if err := r.prepareOutput(outputPath); err != nil {
+		return err
+	}
+
+	// Ensure destination directory exists
+	destDir := filepath.Dir(outputPath)
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	// Create output file
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer outputFile.Close()
+
+	// Process each chunk
+	chunkCount := len(fileManifest.Chunks)
+	totalSize := int64(0)
+	for _, chunkRef := range fileManifest.Chunks {
+		totalSize += chunkRef.Size
+	}
+
+	// Initialize progress bars
+	progressMgr.InitTotalProgress(totalSize, "Retrieving file")
+
+	sparse := len(fileManifest.Holes) > 0
+	if !r.quiet {
+		fmt.Printf("Reassembling file from %d chunks\n", chunkCount)
+		if sparse {
+			fmt.Printf("Recreating sparse file with %d hole(s)\n", len(fileManifest.Holes))
+		}
+	}
+
+	for i, chunkRef := range fileManifest.Chunks {
+		// Check for cancellation
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("operation cancelled")
+		default:
+		}
+
+		progressMgr.PrintVerbose("Processing chunk %d/%d\n", i+1, chunkCount)
+
+		chunkData, err := r.readChunk(ctx, chunkRef)
+		if err != nil {
+			return err
+		}
+
+		// Write the chunk to the output file. Sparse files are written at each
+		// chunk's offset so the skipped ranges stay holes on disk.
+		var bytesWritten int
+		if sparse {
+			bytesWritten, err = outputFile.WriteAt(chunkData, chunkRef.Offset)
+		} else {
+			bytesWritten, err = outputFile.Write(chunkData)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write to output file: %v", err)
+		}
+
+		// Update progress bars
+		progressMgr.UpdateTotalProgress(int64(bytesWritten))
+	}
+
+	// Extend the file over a trailing hole without writing any data
+	if sparse {
+		if err := outputFile.Truncate(fileManifest.Size); err != nil {
+			return fmt.Errorf("failed to size sparse file: %v", err)
+		}
+	}
+
+	// Complete progress bars
+	progressMgr.FinishTotalProgress()
+
+	// Restore recorded POSIX metadata; failures are not fatal since not every target supports it
+	for _, metaErr := range restoreFileMetadata(outputPath, fileManifest, r.metaOpts) {
+		progressMgr.PrintInfo("Warning: %v\n", metaErr)
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(getCmd)
 
+	getCmd.ValidArgsFunction = completeGetArgs
+
 	// Add flags
 	getCmd.Flags().BoolP(force, "f", false, "Force overwrite if file exists at destination")
 	getCmd.Flags().Bool(skipDecryption, false, "Skip decryption and retrieve raw chunks (for recovery)")
 	getCmd.Flags().Bool(skipVerification, false, "Skip integrity verification (for recovery scenarios)")
+	getCmd.Flags().String("range", "", "Retrieve only bytes START-END of the file (e.g. 100MB-200MB, END exclusive)")
+	getCmd.Flags().Bool("no-perms", false, "Do not restore recorded file permissions")
+	getCmd.Flags().Bool("restore-owner", false, "Restore recorded file owner and group, and setuid, setgid and sticky bits (usually requires root)")
+	getCmd.Flags().Bool("xattrs", false, "Restore recorded extended attributes")
+	getCmd.Flags().Bool("unsafe-symlinks", false, "Restore symlinks with absolute or '..' targets, which can point outside the destination")
 	getCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
 	getCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 }
@@ -5,10 +5,12 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/progress"
 	"github.com/substantialcattle5/sietch/testutil"
 )
 
@@ -425,3 +427,160 @@ func TestChunkIntegrityVerificationEndToEnd(t *testing.T) {
 		// For this test, we just verify the logic is sound
 	})
 }
+
+func TestFilesUnderDir(t *testing.T) {
+	files := []config.FileManifest{
+		{FilePath: "link.txt", Destination: "docs/", HardLink: "docs/a/one.txt"},
+		{FilePath: "one.txt", Destination: "docs/a/"},
+		{FilePath: "note.txt", Destination: "docsextra/"},
+		{FilePath: "top.txt", Destination: ""},
+	}
+
+	got := filesUnderDir(files, "docs/")
+	if len(got) != 2 {
+		t.Fatalf("expected 2 files under docs/, got %d", len(got))
+	}
+	// Link targets come before the links that refer to them
+	if got[0].FilePath != "one.txt" || got[1].FilePath != "link.txt" {
+		t.Errorf("unexpected order: %s, %s", got[0].FilePath, got[1].FilePath)
+	}
+
+	if all := filesUnderDir(files, "/"); len(all) != len(files) {
+		t.Errorf("expected the vault root to include every file, got %d", len(all))
+	}
+}
+
+func TestRestoreSymlink(t *testing.T) {
+	dir := testutil.TempDir(t, "get-symlink")
+	link := dir + "/nested/current.conf"
+	r := &retriever{root: dir, quiet: true}
+
+	if err := r.restoreSymlink("real.conf", link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if target, err := os.Readlink(link); err != nil || target != "real.conf" {
+		t.Fatalf("expected link to real.conf, got %q (%v)", target, err)
+	}
+
+	if err := r.restoreSymlink("other.conf", link); err == nil {
+		t.Error("expected an error when the link exists without --force")
+	}
+
+	r.force = true
+	if err := r.restoreSymlink("other.conf", link); err != nil {
+		t.Fatalf("restore with force: %v", err)
+	}
+	if target, _ := os.Readlink(link); target != "other.conf" {
+		t.Errorf("expected link to be replaced, got %q", target)
+	}
+}
+
+func TestRetrieveTreeSymlinkTraversal(t *testing.T) {
+	vaultRoot := testutil.TempDir(t, "get-traversal-vault")
+	outside := testutil.TempDir(t, "get-traversal-outside")
+	r := &retriever{
+		vaultRoot:   vaultRoot,
+		vaultConfig: &config.VaultConfig{Encryption: config.EncryptionConfig{Type: "none"}},
+		quiet:       true,
+		progressMgr: progress.NewManager(progress.Options{Quiet: true}),
+	}
+	files := []config.FileManifest{
+		{Destination: "docs/", FilePath: "evil", Symlink: outside},
+		{Destination: "docs/", FilePath: "evil/x.txt", Size: 4, Chunks: []config.ChunkRef{storeTestChunk(t, vaultRoot, []byte("pwnd"), 0)}},
+	}
+
+	for _, unsafe := range []bool{false, true} {
+		out := testutil.TempDir(t, "get-traversal-out")
+		r.root, r.unsafeLinks = out, unsafe
+		_ = r.retrieveTree(context.Background(), files, "docs/", out)
+		if _, err := os.Lstat(filepath.Join(outside, "x.txt")); !os.IsNotExist(err) {
+			t.Fatalf("unsafe=%v: x.txt was written through the symlink", unsafe)
+		}
+		if got, err := os.ReadFile(filepath.Join(out, "evil", "x.txt")); err != nil || string(got) != "pwnd" {
+			t.Errorf("unsafe=%v: expected x.txt inside the destination, got %q (%v)", unsafe, got, err)
+		}
+	}
+
+	// A symlink already in the destination is not written through either
+	out := testutil.TempDir(t, "get-traversal-planted")
+	if err := os.Symlink(outside, filepath.Join(out, "evil")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	r.root = out
+	if err := r.retrieveFile(context.Background(), &files[1], filepath.Join(out, "evil", "x.txt")); err == nil || !strings.Contains(err.Error(), "through symlink") {
+		t.Errorf("expected a write through a planted symlink to be refused, got %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "x.txt")); !os.IsNotExist(err) {
+		t.Error("x.txt was written through the planted symlink")
+	}
+
+	r.unsafeLinks = false
+	for _, target := range []string{"/etc/passwd", "../up", "a/../../up"} {
+		if err := r.restoreSymlink(target, filepath.Join(out, "link")); err == nil {
+			t.Errorf("expected symlink to %s to be refused", target)
+		}
+	}
+	if err := r.restoreSymlink("sub/../real.conf", filepath.Join(out, "link")); err == nil {
+		t.Error("expected a '..' element to be refused even when it stays inside")
+	}
+	if err := r.restoreSymlink("real.conf", filepath.Join(out, "link")); err != nil {
+		t.Errorf("relative symlink refused: %v", err)
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	const size = 300 * 1024 * 1024
+	tests := []struct {
+		spec       string
+		start, end int64
+		wantErr    bool
+	}{
+		{"100MB-200MB", 100 * 1024 * 1024, 200 * 1024 * 1024, false},
+		{"0-10", 0, 10, false},
+		{"250MB-", 250 * 1024 * 1024, size, false},
+		{"-1KB", 0, 1024, false},
+		{"200MB-1GB", 200 * 1024 * 1024, size, false},
+		{"10-10", 0, 0, true},
+		{"400MB-500MB", 0, 0, true},
+		{"100MB", 0, 0, true},
+		{"abc-10", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		start, end, err := parseByteRange(tt.spec, size)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseByteRange(%q) expected an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseByteRange(%q) unexpected error: %v", tt.spec, err)
+			continue
+		}
+		if start != tt.start || end != tt.end {
+			t.Errorf("parseByteRange(%q) = %d-%d, want %d-%d", tt.spec, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestChunkOffsets(t *testing.T) {
+	// Older manifests do not record offsets; chunks are contiguous
+	legacy := &config.FileManifest{Chunks: []config.ChunkRef{{Size: 4}, {Size: 4}, {Size: 2}}}
+	got := chunkOffsets(legacy)
+	for i, want := range []int64{0, 4, 8} {
+		if got[i] != want {
+			t.Errorf("legacy chunk %d offset = %d, want %d", i, got[i], want)
+		}
+	}
+
+	// Sparse files use the recorded offsets
+	sparse := &config.FileManifest{
+		Chunks: []config.ChunkRef{{Size: 4, Offset: 100}, {Size: 4, Offset: 200}},
+		Holes:  []config.HoleExtent{{Offset: 0, Length: 100}, {Offset: 104, Length: 96}},
+	}
+	got = chunkOffsets(sparse)
+	if got[0] != 100 || got[1] != 200 {
+		t.Errorf("sparse offsets = %v, want [100 200]", got)
+	}
+}
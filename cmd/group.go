@@ -0,0 +1,253 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// syncGroupCmd groups the commands managing peer groups
+var syncGroupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Manage groups of trusted peers",
+	Long: `Manage named groups of trusted peers, such as "home" or "field-team".
+
+Groups are stored under sync.groups in vault.yaml. 'sietch sync --group <name>'
+syncs with every member of a group found on the local network at once.
+
+A group can carry default access rules: members without allowed_paths of
+their own may only fetch the files matched by their groups' allowed paths.
+
+Examples:
+  sietch sync group add field-team laptop tablet    # Add two trusted peers
+  sietch sync group allow field-team docs/ tag:maps # Limit what members fetch
+  sietch sync group list                            # Show groups and members
+  sietch sync group remove field-team tablet        # Remove one member
+  sietch sync group remove field-team               # Delete the group`,
+}
+
+var syncGroupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List peer groups and their members",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		_, vaultConfig, err := loadGroupConfig()
+		if err != nil {
+			return err
+		}
+
+		groups := groupOutputs(vaultConfig)
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, groups)
+		}
+		if len(groups) == 0 {
+			fmt.Println("No peer groups")
+			return nil
+		}
+		displayGroups(os.Stdout, groups)
+		return nil
+	},
+}
+
+var syncGroupAddCmd = &cobra.Command{
+	Use:   "add <group> <peer>...",
+	Short: "Add trusted peers to a group, creating it if needed",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := config.ValidateGroupName(name); err != nil {
+			return err
+		}
+		vaultRoot, vaultConfig, err := loadGroupConfig()
+		if err != nil {
+			return err
+		}
+
+		group := vaultConfig.Sync.GroupFor(name)
+		var added []string
+		for _, nameOrID := range args[1:] {
+			id, err := resolveTrustedPeer(vaultConfig, nameOrID)
+			if err != nil {
+				return err
+			}
+			if group.AddMember(id.String()) {
+				added = append(added, nameOrID)
+			}
+		}
+		if len(added) == 0 {
+			fmt.Printf("Every peer given is already in %s\n", name)
+			return nil
+		}
+		return saveGroupChange(cmd, vaultRoot, vaultConfig,
+			fmt.Sprintf("add %s to %s", strings.Join(added, ", "), name))
+	},
+}
+
+var syncGroupRemoveCmd = &cobra.Command{
+	Use:   "remove <group> [peer...]",
+	Short: "Remove peers from a group, or the group itself",
+	Long: `Remove the given peers from a group. Without peers the group itself is
+deleted; its members stay trusted.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		vaultRoot, vaultConfig, err := loadGroupConfig()
+		if err != nil {
+			return err
+		}
+		group := vaultConfig.Sync.Group(name)
+		if group == nil {
+			return fmt.Errorf("no peer group named %s", name)
+		}
+
+		if len(args) == 1 {
+			vaultConfig.Sync.RemoveGroup(name)
+			return saveGroupChange(cmd, vaultRoot, vaultConfig, "delete group "+name)
+		}
+
+		var removed []string
+		for _, nameOrID := range args[1:] {
+			// Peers no longer trusted can still be removed by ID
+			id := nameOrID
+			if resolved, err := resolveTrustedPeer(vaultConfig, nameOrID); err == nil {
+				id = resolved.String()
+			}
+			if !group.RemoveMember(id) {
+				return fmt.Errorf("%s is not in group %s", nameOrID, name)
+			}
+			removed = append(removed, nameOrID)
+		}
+		return saveGroupChange(cmd, vaultRoot, vaultConfig,
+			fmt.Sprintf("remove %s from %s", strings.Join(removed, ", "), name))
+	},
+}
+
+var syncGroupAllowCmd = &cobra.Command{
+	Use:   "allow <group> [path|tag:name...]",
+	Short: "Set the default access rules of a group's members",
+	Long: `Set the path prefixes and "tag:<name>" entries that members of a group may
+fetch from this vault, unless they have allowed_paths of their own. Without
+paths the group's default is cleared.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		vaultRoot, vaultConfig, err := loadGroupConfig()
+		if err != nil {
+			return err
+		}
+		group := vaultConfig.Sync.Group(name)
+		if group == nil {
+			return fmt.Errorf("no peer group named %s", name)
+		}
+
+		group.AllowedPaths = append([]string(nil), args[1:]...)
+		change := fmt.Sprintf("allow members of %s to fetch %s", name, strings.Join(group.AllowedPaths, ", "))
+		if len(group.AllowedPaths) == 0 {
+			change = "clear the access rules of " + name
+		}
+		return saveGroupChange(cmd, vaultRoot, vaultConfig, change)
+	},
+}
+
+// loadGroupConfig loads the configuration of the vault in the working directory
+func loadGroupConfig() (string, *config.VaultConfig, error) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return "", nil, fmt.Errorf("not inside a vault: %v", err)
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	return vaultRoot, vaultConfig, nil
+}
+
+// saveGroupChange writes the changed sync.groups to vault.yaml, or with
+// --dry-run only reports the change
+func saveGroupChange(cmd *cobra.Command, vaultRoot string, vaultConfig *config.VaultConfig, change string) error {
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		fmt.Printf("[dry-run] would %s\n", change)
+		return nil
+	}
+	if err := saveVaultConfigTransactional(vaultRoot, vaultConfig, "sync.groups"); err != nil {
+		return err
+	}
+	fmt.Printf("✓ %s\n", strings.ToUpper(change[:1])+change[1:])
+	return nil
+}
+
+// groupOutput is the structured form of a peer group
+type groupOutput struct {
+	Name         string              `json:"name" yaml:"name"`
+	Members      []groupMemberOutput `json:"members" yaml:"members"`
+	AllowedPaths []string            `json:"allowed_paths,omitempty" yaml:"allowed_paths,omitempty"`
+}
+
+type groupMemberOutput struct {
+	ID      string `json:"id" yaml:"id"`
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Trusted bool   `json:"trusted" yaml:"trusted"`
+}
+
+func groupOutputs(vaultConfig *config.VaultConfig) []groupOutput {
+	names := make(map[string]string)
+	if vaultConfig.Sync.RSA != nil {
+		for _, p := range vaultConfig.Sync.RSA.TrustedPeers {
+			names[p.ID] = p.Name
+		}
+	}
+
+	groups := []groupOutput{}
+	for _, g := range vaultConfig.Sync.Groups {
+		out := groupOutput{Name: g.Name, Members: []groupMemberOutput{}, AllowedPaths: g.AllowedPaths}
+		for _, id := range g.Members {
+			name, trusted := names[id]
+			out.Members = append(out.Members, groupMemberOutput{ID: id, Name: name, Trusted: trusted})
+		}
+		groups = append(groups, out)
+	}
+	return groups
+}
+
+func displayGroups(w io.Writer, groups []groupOutput) {
+	for i, g := range groups {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%d members)\n", g.Name, len(g.Members))
+		if len(g.AllowedPaths) > 0 {
+			fmt.Fprintf(w, "  Allowed: %s\n", strings.Join(g.AllowedPaths, ", "))
+		}
+		for _, m := range g.Members {
+			label := m.ID
+			if m.Name != "" {
+				label = fmt.Sprintf("%s (%s)", m.Name, m.ID)
+			}
+			if !m.Trusted {
+				label += " - no longer trusted"
+			}
+			fmt.Fprintf(w, "  - %s\n", label)
+		}
+	}
+}
+
+func init() {
+	syncCmd.AddCommand(syncGroupCmd)
+	syncGroupCmd.AddCommand(syncGroupListCmd)
+	syncGroupCmd.AddCommand(syncGroupAddCmd)
+	syncGroupCmd.AddCommand(syncGroupRemoveCmd)
+	syncGroupCmd.AddCommand(syncGroupAllowCmd)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func newTestPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestSyncTargets(t *testing.T) {
+	laptop, tablet, phone := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+	cfg := &config.VaultConfig{}
+	cfg.Sync.RSA = &config.RSAConfig{TrustedPeers: []config.TrustedPeer{
+		{ID: laptop.String(), Name: "laptop"},
+		{ID: tablet.String(), Name: "tablet"},
+		{ID: phone.String(), Name: "phone"},
+	}}
+	cfg.Sync.Groups = []config.PeerGroup{
+		{Name: "field-team", Members: []string{laptop.String(), tablet.String()}},
+		{Name: "gone", Members: []string{newTestPeerID(t).String()}},
+	}
+
+	all, err := syncTargets(cfg, "")
+	if err != nil || len(all) != 3 {
+		t.Errorf("syncTargets(all) = %v, %v; want all 3 trusted peers", all, err)
+	}
+	group, err := syncTargets(cfg, "field-team")
+	if err != nil || len(group) != 2 || !group[laptop] || !group[tablet] {
+		t.Errorf("syncTargets(field-team) = %v, %v; want laptop and tablet", group, err)
+	}
+	if _, err := syncTargets(cfg, "gone"); err == nil || !strings.Contains(err.Error(), "no trusted members") {
+		t.Errorf("expected an error for a group without trusted members, got %v", err)
+	}
+	if _, err := syncTargets(cfg, "missing"); err == nil || !strings.Contains(err.Error(), "no peer group") {
+		t.Errorf("expected an error for an unknown group, got %v", err)
+	}
+}
+
+func TestGroupOutputs(t *testing.T) {
+	laptop, gone := newTestPeerID(t), newTestPeerID(t)
+	cfg := &config.VaultConfig{}
+	cfg.Sync.RSA = &config.RSAConfig{TrustedPeers: []config.TrustedPeer{{ID: laptop.String(), Name: "laptop"}}}
+	cfg.Sync.Groups = []config.PeerGroup{{
+		Name:         "field-team",
+		Members:      []string{laptop.String(), gone.String()},
+		AllowedPaths: []string{"maps/"},
+	}}
+
+	groups := groupOutputs(cfg)
+	if len(groups) != 1 || len(groups[0].Members) != 2 {
+		t.Fatalf("groupOutputs = %+v", groups)
+	}
+	if m := groups[0].Members[0]; m.Name != "laptop" || !m.Trusted {
+		t.Errorf("first member = %+v, want trusted laptop", m)
+	}
+	if m := groups[0].Members[1]; m.Name != "" || m.Trusted {
+		t.Errorf("second member = %+v, want untrusted without a name", m)
+	}
+
+	var out strings.Builder
+	displayGroups(&out, groups)
+	for _, want := range []string{"field-team (2 members)", "Allowed: maps/", "laptop (" + laptop.String() + ")", "no longer trusted"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("displayGroups output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,416 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	lsui "github.com/substantialcattle5/sietch/internal/ls"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// infoCmd represents the info command
+var infoCmd = &cobra.Command{
+	Use:   "info <path>",
+	Short: "Show everything known about a stored file",
+	Long: `Print the manifest of one stored file in detail: size, timestamps,
+permissions, hashes, encryption, tags, a summary of its chunks and whether
+they are all stored locally, which other files share its chunks, and the
+syncs that copied it between vaults.
+
+Peers known to have the file are the peers it was synced from, directly or
+by the vaults it passed through before. Sietch does not record which peers
+have since copied it from this vault.
+
+The path is matched like 'sietch get' does: the full vault path, the file
+name, or its base name.
+
+Examples:
+  sietch info docs/report.pdf
+  sietch info report.pdf -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+
+		manifest, err := manager.GetManifest()
+		if err != nil {
+			return fmt.Errorf("failed to get vault manifest: %v", err)
+		}
+
+		file, err := matchFileManifest(manifest.Files, args[0])
+		if err != nil {
+			return fmt.Errorf("file not found in vault: %v", err)
+		}
+
+		tombstones, err := manager.Tombstones()
+		if err != nil {
+			return fmt.Errorf("failed to read tombstones: %v", err)
+		}
+		stored := func(name string) bool {
+			exists, _ := manager.ChunkExists(name)
+			return exists
+		}
+
+		out := buildInfoOutput(*file, vaultConfig, buildChunkIndex(manifest.Files), newStatusChecker(tombstones, stored).check(file))
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, out)
+		}
+		fmt.Print(formatInfo(out))
+		return nil
+	},
+}
+
+// infoOutput is everything sietch info reports about a file
+type infoOutput struct {
+	Path         string     `json:"path" yaml:"path"`
+	Size         int64      `json:"size" yaml:"size"`
+	ModTime      string     `json:"mtime" yaml:"mtime"`
+	Mode         string     `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Owner        string     `json:"owner,omitempty" yaml:"owner,omitempty"` // uid:gid
+	Symlink      string     `json:"symlink,omitempty" yaml:"symlink,omitempty"`
+	HardLink     string     `json:"hard_link,omitempty" yaml:"hard_link,omitempty"`
+	Xattrs       []string   `json:"xattrs,omitempty" yaml:"xattrs,omitempty"` // Attribute names
+	Holes        int        `json:"holes,omitempty" yaml:"holes,omitempty"`   // Unallocated ranges of a sparse file
+	Tags         []string   `json:"tags" yaml:"tags"`
+	ContentHash  string     `json:"content_hash,omitempty" yaml:"content_hash,omitempty"`
+	MerkleRoot   string     `json:"merkle_root,omitempty" yaml:"merkle_root,omitempty"`
+	AddedAt      time.Time  `json:"added_at" yaml:"added_at"`
+	LastSynced   *time.Time `json:"last_synced,omitempty" yaml:"last_synced,omitempty"`
+	LastVerified *time.Time `json:"last_verified,omitempty" yaml:"last_verified,omitempty"`
+
+	Encryption infoEncryptionOutput `json:"encryption" yaml:"encryption"`
+	Chunks     infoChunksOutput     `json:"chunks" yaml:"chunks"`
+	Dedup      lsDedupOutput        `json:"dedup" yaml:"dedup"`
+
+	// Local state of the file, see fileStatuses
+	Status        string `json:"status" yaml:"status"`
+	MissingChunks int    `json:"missing_chunks,omitempty" yaml:"missing_chunks,omitempty"`
+
+	Provenance []syncOriginOutput `json:"provenance,omitempty" yaml:"provenance,omitempty"`
+	Peers      []infoPeerOutput   `json:"peers" yaml:"peers"`
+}
+
+// infoEncryptionOutput describes how the file's chunks are encrypted
+type infoEncryptionOutput struct {
+	Type               string `json:"type" yaml:"type"`
+	Mode               string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	KeyReference       string `json:"key_reference,omitempty" yaml:"key_reference,omitempty"`
+	ManifestsEncrypted bool   `json:"manifests_encrypted" yaml:"manifests_encrypted"`
+}
+
+// infoChunksOutput summarizes the chunk list of a file
+type infoChunksOutput struct {
+	Count        int      `json:"count" yaml:"count"`
+	Distinct     int      `json:"distinct" yaml:"distinct"`         // Chunks repeated within the file count once
+	StoredBytes  int64    `json:"stored_bytes" yaml:"stored_bytes"` // Size of the distinct chunks in the chunk store
+	Smallest     int64    `json:"smallest" yaml:"smallest"`
+	Largest      int64    `json:"largest" yaml:"largest"`
+	Compression  []string `json:"compression" yaml:"compression"`
+	Deduplicated int      `json:"deduplicated" yaml:"deduplicated"` // Reused a chunk already stored when the file was added
+}
+
+// infoPeerOutput is a peer known to have a copy of the file
+type infoPeerOutput struct {
+	ID       string    `json:"id" yaml:"id"`
+	Name     string    `json:"name,omitempty" yaml:"name,omitempty"`
+	SyncedAt time.Time `json:"synced_at" yaml:"synced_at"` // Last sync that copied the file from the peer
+}
+
+// buildInfoOutput describes file, stored in a vault configured by vaultConfig.
+// chunkRefs is the chunk index of the whole vault and status the local state
+// of the file.
+func buildInfoOutput(file config.FileManifest, vaultConfig *config.VaultConfig, chunkRefs map[string][]string, status fileStatus) infoOutput {
+	out := infoOutput{
+		Path:          file.Destination + file.FilePath,
+		Size:          file.Size,
+		ModTime:       file.ModTime,
+		Symlink:       file.Symlink,
+		HardLink:      file.HardLink,
+		Holes:         len(file.Holes),
+		Tags:          file.Tags,
+		ContentHash:   file.ContentHash,
+		MerkleRoot:    file.MerkleRoot,
+		AddedAt:       file.AddedAt,
+		Encryption:    describeFileEncryption(file, vaultConfig),
+		Chunks:        summarizeChunks(file.Chunks),
+		Status:        status.State,
+		MissingChunks: status.MissingChunks,
+		Provenance:    newProvenanceOutput(file.Provenance),
+		Peers:         peersWithFile(file.Provenance),
+	}
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	if file.Mode != 0 {
+		out.Mode = fmt.Sprintf("%04o", file.Mode)
+	}
+	if file.Owner != nil {
+		out.Owner = fmt.Sprintf("%d:%d", file.Owner.UID, file.Owner.GID)
+	}
+	for name := range file.Xattrs {
+		out.Xattrs = append(out.Xattrs, name)
+	}
+	sort.Strings(out.Xattrs)
+	if !file.LastSynced.IsZero() {
+		out.LastSynced = &file.LastSynced
+	}
+	if !file.LastVerified.IsZero() {
+		out.LastVerified = &file.LastVerified
+	}
+
+	sharedChunks, savedBytes, sharedWith := deduplication.ComputeDedupStatsForFile(file, chunkRefs)
+	if sharedWith == nil {
+		sharedWith = []string{}
+	}
+	out.Dedup = lsDedupOutput{SharedChunks: sharedChunks, SavedBytes: savedBytes, SharedWith: sharedWith}
+	return out
+}
+
+// describeFileEncryption returns the encryption of file: its own settings
+// where it has them, otherwise the vault's
+func describeFileEncryption(file config.FileManifest, vaultConfig *config.VaultConfig) infoEncryptionOutput {
+	enc := vaultConfig.Encryption
+	out := infoEncryptionOutput{Type: enc.Type, ManifestsEncrypted: enc.EncryptManifests}
+	if file.Encryption != nil {
+		out.KeyReference = file.Encryption.KeyReference
+		if file.Encryption.Type != "" {
+			out.Type = file.Encryption.Type
+		}
+	}
+	switch out.Type {
+	case "":
+		out.Type = constants.EncryptionTypeNone
+	case constants.EncryptionTypeAES:
+		if enc.AESConfig != nil {
+			out.Mode = enc.AESConfig.Mode
+		}
+	case constants.EncryptionTypeChaCha20:
+		if enc.ChaChaConfig != nil {
+			out.Mode = enc.ChaChaConfig.Mode
+		}
+	}
+	return out
+}
+
+// summarizeChunks returns counts and sizes of a file's chunk list
+func summarizeChunks(chunks []config.ChunkRef) infoChunksOutput {
+	out := infoChunksOutput{Count: len(chunks), Compression: []string{}}
+	seen := make(map[string]bool)
+	for i, ref := range chunks {
+		if i == 0 || ref.Size < out.Smallest {
+			out.Smallest = ref.Size
+		}
+		if ref.Size > out.Largest {
+			out.Largest = ref.Size
+		}
+		if ref.Deduplicated {
+			out.Deduplicated++
+		}
+		compression := ref.CompressionType
+		if compression == "" {
+			compression = "none"
+		}
+		if !slices.Contains(out.Compression, compression) {
+			out.Compression = append(out.Compression, compression)
+		}
+
+		id := ref.Hash + "/" + ref.EncryptedHash
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		out.Distinct++
+		out.StoredBytes += storedSize(ref)
+	}
+	return out
+}
+
+// peersWithFile returns the peers the file was synced from, most recent sync
+// first. Every hop of the provenance counts: the peer a vault synced the file
+// from had a copy at the time.
+func peersWithFile(provenance []config.SyncOrigin) []infoPeerOutput {
+	peers := []infoPeerOutput{}
+	index := make(map[string]int)
+	for _, origin := range provenance {
+		if origin.Kind != "peer" {
+			continue
+		}
+		if i, ok := index[origin.Source]; ok {
+			if origin.SyncedAt.After(peers[i].SyncedAt) {
+				peers[i].SyncedAt = origin.SyncedAt
+			}
+			if origin.Name != "" {
+				peers[i].Name = origin.Name
+			}
+			continue
+		}
+		index[origin.Source] = len(peers)
+		peers = append(peers, infoPeerOutput{ID: origin.Source, Name: origin.Name, SyncedAt: origin.SyncedAt})
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return peers[i].SyncedAt.After(peers[j].SyncedAt)
+	})
+	return peers
+}
+
+// formatInfo renders the report of sietch info
+func formatInfo(out infoOutput) string {
+	var b strings.Builder
+	// An empty label continues the list above it
+	line := func(label, format string, args ...any) {
+		if label != "" {
+			label += ":"
+		}
+		fmt.Fprintf(&b, "%-15s %s\n", label, fmt.Sprintf(format, args...))
+	}
+	timestamp := func(t time.Time) string {
+		return t.Local().Format("2006-01-02 15:04:05")
+	}
+
+	line("Path", "%s", out.Path)
+	line("Size", "%s (%d bytes)", util.HumanReadableSize(out.Size), out.Size)
+	if t, err := time.Parse(time.RFC3339, out.ModTime); err == nil {
+		line("Modified", "%s", timestamp(t))
+	} else {
+		line("Modified", "%s", out.ModTime)
+	}
+	if out.Mode != "" {
+		line("Mode", "%s", out.Mode)
+	}
+	if out.Owner != "" {
+		line("Owner", "%s", out.Owner)
+	}
+	if out.Symlink != "" {
+		line("Symlink to", "%s", out.Symlink)
+	}
+	if out.HardLink != "" {
+		line("Hard link to", "%s", out.HardLink)
+	}
+	if len(out.Xattrs) > 0 {
+		line("Xattrs", "%s", strings.Join(out.Xattrs, ", "))
+	}
+	if out.Holes > 0 {
+		line("Sparse", "%d hole(s)", out.Holes)
+	}
+	if len(out.Tags) > 0 {
+		line("Tags", "%s", strings.Join(out.Tags, ", "))
+	} else {
+		line("Tags", "-")
+	}
+	line("Content hash", "%s", orDash(out.ContentHash))
+	line("Merkle root", "%s", orDash(out.MerkleRoot))
+
+	encryption := out.Encryption.Type
+	if out.Encryption.Mode != "" {
+		encryption += " (" + out.Encryption.Mode + ")"
+	}
+	if out.Encryption.KeyReference != "" {
+		encryption += ", key " + out.Encryption.KeyReference
+	}
+	if out.Encryption.ManifestsEncrypted {
+		encryption += ", manifests encrypted"
+	}
+	line("Encryption", "%s", encryption)
+
+	line("Added", "%s", timestamp(out.AddedAt))
+	if out.LastSynced != nil {
+		line("Last synced", "%s", timestamp(*out.LastSynced))
+	}
+	if out.LastVerified != nil {
+		line("Last verified", "%s", timestamp(*out.LastVerified))
+	}
+
+	chunks := out.Chunks
+	fmt.Fprintln(&b)
+	line("Chunks", "%d (%d distinct, %s stored)", chunks.Count, chunks.Distinct, util.HumanReadableSize(chunks.StoredBytes))
+	if chunks.Count > 0 {
+		line("Chunk sizes", "%s to %s", util.HumanReadableSize(chunks.Smallest), util.HumanReadableSize(chunks.Largest))
+		line("Compression", "%s", strings.Join(chunks.Compression, ", "))
+	}
+	if chunks.Deduplicated > 0 {
+		line("Deduplicated", "%d chunk(s) already stored when the file was added", chunks.Deduplicated)
+	}
+	line("Status", "%s", describeStatus(fileStatus{State: out.Status, MissingChunks: out.MissingChunks}, chunks.Count))
+	line("Shared chunks", "%d (saved %s)", out.Dedup.SharedChunks, util.HumanReadableSize(out.Dedup.SavedBytes))
+	if len(out.Dedup.SharedWith) > 0 {
+		line("Shared with", "%s", lsui.FormatSharedWith(out.Dedup.SharedWith, 10))
+	}
+
+	fmt.Fprintln(&b)
+	if len(out.Provenance) == 0 {
+		line("Origin", "local")
+	}
+	// Most recent sync first; the last one brought the file to this vault
+	for i := len(out.Provenance) - 1; i >= 0; i-- {
+		origin := out.Provenance[i]
+		label := ""
+		switch i {
+		case len(out.Provenance) - 1:
+			label = "Origin"
+		case len(out.Provenance) - 2:
+			label = "Synced before"
+		}
+		line(label, "%s, %s (session %s)",
+			describeOrigin(&config.SyncOrigin{Kind: origin.Kind, Source: origin.Source, Name: origin.Name}),
+			timestamp(origin.SyncedAt), origin.Session)
+	}
+	if len(out.Peers) == 0 {
+		line("Known peers", "none")
+	}
+	for i, peer := range out.Peers {
+		label := ""
+		if i == 0 {
+			label = "Known peers"
+		}
+		name := peer.ID
+		if peer.Name != "" {
+			name = peer.Name + " (" + peer.ID + ")"
+		}
+		line(label, "%s, synced %s", name, timestamp(peer.SyncedAt))
+	}
+	return b.String()
+}
+
+// orDash returns s, or "-" if it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+
+	infoCmd.ValidArgsFunction = completeVaultPaths
+}
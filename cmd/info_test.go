@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestSummarizeChunks(t *testing.T) {
+	chunks := []config.ChunkRef{
+		{Hash: "a", Size: 100, EncryptedSize: 120, CompressionType: "zstd"},
+		{Hash: "b", Size: 40, CompressedSize: 30, Deduplicated: true},
+		{Hash: "a", Size: 100, EncryptedSize: 120, CompressionType: "zstd"},
+	}
+	got := summarizeChunks(chunks)
+	if got.Count != 3 || got.Distinct != 2 || got.StoredBytes != 150 {
+		t.Errorf("unexpected counts %+v", got)
+	}
+	if got.Smallest != 40 || got.Largest != 100 || got.Deduplicated != 1 {
+		t.Errorf("unexpected sizes %+v", got)
+	}
+	if strings.Join(got.Compression, ",") != "zstd,none" {
+		t.Errorf("unexpected compression %v", got.Compression)
+	}
+
+	if empty := summarizeChunks(nil); empty.Count != 0 || empty.Compression == nil {
+		t.Errorf("unexpected summary of no chunks %+v", empty)
+	}
+}
+
+func TestPeersWithFile(t *testing.T) {
+	now := time.Now()
+	provenance := []config.SyncOrigin{
+		{Kind: "peer", Source: "QmOld", SyncedAt: now.Add(-3 * time.Hour)},
+		{Kind: "vault", Source: "/mnt/usb/vault", SyncedAt: now.Add(-2 * time.Hour)},
+		{Kind: "peer", Source: "QmLaptop", Name: "laptop", SyncedAt: now.Add(-time.Hour)},
+		{Kind: "peer", Source: "QmOld", Name: "desk", SyncedAt: now},
+	}
+	peers := peersWithFile(provenance)
+	if len(peers) != 2 {
+		t.Fatalf("expected 2 peers, got %+v", peers)
+	}
+	if peers[0].ID != "QmOld" || peers[0].Name != "desk" || !peers[0].SyncedAt.Equal(now) {
+		t.Errorf("expected the latest sync from QmOld first, got %+v", peers[0])
+	}
+	if peers[1].ID != "QmLaptop" || peers[1].Name != "laptop" {
+		t.Errorf("unexpected second peer %+v", peers[1])
+	}
+
+	if peers := peersWithFile(nil); peers == nil || len(peers) != 0 {
+		t.Errorf("expected an empty list, got %#v", peers)
+	}
+}
+
+func TestDescribeFileEncryption(t *testing.T) {
+	vaultConfig := &config.VaultConfig{}
+	vaultConfig.Encryption.Type = "aes"
+	vaultConfig.Encryption.AESConfig = &config.AESConfig{Mode: "gcm"}
+	vaultConfig.Encryption.EncryptManifests = true
+
+	got := describeFileEncryption(config.FileManifest{}, vaultConfig)
+	if got.Type != "aes" || got.Mode != "gcm" || !got.ManifestsEncrypted {
+		t.Errorf("expected the vault's encryption, got %+v", got)
+	}
+
+	file := config.FileManifest{Encryption: &config.FileEncryptionInfo{Type: "gpg", KeyReference: "work"}}
+	if got := describeFileEncryption(file, vaultConfig); got.Type != "gpg" || got.Mode != "" || got.KeyReference != "work" {
+		t.Errorf("expected the file's own encryption, got %+v", got)
+	}
+
+	if got := describeFileEncryption(config.FileManifest{}, &config.VaultConfig{}); got.Type != "none" {
+		t.Errorf("expected none for an unencrypted vault, got %+v", got)
+	}
+}
+
+func TestFormatInfo(t *testing.T) {
+	synced := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	file := createTestManifest("report.pdf", "docs/", 2048, []config.ChunkRef{{Hash: "a", Size: 1024}, {Hash: "b", Size: 1024}})
+	file.Tags = []string{"work"}
+	file.Mode = 0o640
+	file.Provenance = []config.SyncOrigin{
+		{Kind: "vault", Source: "/mnt/usb/vault", Session: "s1", SyncedAt: synced.Add(-time.Hour)},
+		{Kind: "peer", Source: "QmLaptop", Name: "laptop", Session: "s2", SyncedAt: synced},
+	}
+	other := createTestManifest("copy.pdf", "backup/", 1024, []config.ChunkRef{{Hash: "a", Size: 1024}})
+	vaultConfig := &config.VaultConfig{}
+	vaultConfig.Encryption.Type = "aes"
+
+	out := buildInfoOutput(file, vaultConfig, buildChunkIndex([]config.FileManifest{file, other}), fileStatus{State: fileStatusPartial, MissingChunks: 1})
+	report := formatInfo(out)
+	for _, want := range []string{
+		"Path:           docs/report.pdf",
+		"Mode:           0640",
+		"Tags:           work",
+		"Merkle root:    -",
+		"Encryption:     aes",
+		"Chunks:         2 (2 distinct, 2.0 KB stored)",
+		"Status:         partial (1/2)",
+		"Shared chunks:  1",
+		"Shared with:    backup/copy.pdf",
+		"Origin:         peer laptop",
+		"Synced before:  vault /mnt/usb/vault",
+		"Known peers:    laptop (QmLaptop)",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report is missing %q:\n%s", want, report)
+		}
+	}
+	if strings.Index(report, "Origin:") > strings.Index(report, "Synced before:") {
+		t.Errorf("expected the latest sync first:\n%s", report)
+	}
+
+	local := formatInfo(buildInfoOutput(other, vaultConfig, nil, fileStatus{State: fileStatusComplete}))
+	if !strings.Contains(local, "Origin:         local") || !strings.Contains(local, "Known peers:    none") {
+		t.Errorf("unexpected report of a local file:\n%s", local)
+	}
+}
@@ -5,9 +5,13 @@ package cmd
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
@@ -16,8 +20,10 @@ import (
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/encryption/mnemonic"
 	"github.com/substantialcattle5/sietch/internal/fs"
 	"github.com/substantialcattle5/sietch/internal/manifest"
+	"github.com/substantialcattle5/sietch/internal/scaffold"
 	"github.com/substantialcattle5/sietch/internal/ui"
 	"github.com/substantialcattle5/sietch/internal/validation"
 	"github.com/substantialcattle5/sietch/internal/vault"
@@ -28,9 +34,11 @@ var (
 	vaultPath string
 
 	// Security key generation
-	keyType       string
-	usePassphrase bool
-	keyFile       string
+	keyType          string
+	usePassphrase    bool
+	keyFile          string
+	encryptManifests bool
+	mnemonicFile     string
 
 	// aes specific keys
 	aesMode   string
@@ -60,9 +68,16 @@ var (
 	dedupMinChunkSize   string
 	dedupMaxChunkSize   string
 	dedupGCThreshold    int
+	dedupIndexEnabled   = true
+
+	// Directory to keep chunks in outside the vault, and the levels of
+	// directories they are spread over
+	chunkStore  string
+	chunkFanout int
 
 	// Other options
 	interactiveMode bool
+	nonInteractive  bool
 	forceInit       bool
 	templateName    string
 	configFile      string
@@ -129,20 +144,64 @@ Examples:
   # AES with key file
   sietch init --key-type aes --key-file path/to/key.bin
 
+  # Recover the key of a lost vault from its paper backup
+  sietch init --name "my-vault" --passphrase --from-mnemonic words.txt
+
+  # Also encrypt file names, tags and sizes, not just file contents
+  sietch init --name "my-vault" --key-type aes --encrypt-manifests
+
+  # Keep chunk data on a large disk, and manifests and config in the project
+  sietch init --name "my-vault" --chunk-store /mnt/bigdisk/sietch-chunks
+
   # Custom chunking and GPG encryption
   sietch init --chunking-strategy cdc --chunk-size 2MB --key-type gpg
 
-  # Use config file from template or backup
-  sietch init --from-config my-old-vault.yaml
+  # Recreate a vault with the settings exported from another, with new keys
+  sietch init --from-config my-old-vault.yaml --name "new-vault"
+
+  # Restore a vault from its exported settings and paper key backup
+  sietch init --from-config my-old-vault.yaml --from-mnemonic words.txt
 
   # Use predefined template
   sietch init --template photo-vault
 
+  # Scripted init: no prompts, result or error as JSON on stdout
+  sietch init --name "my-vault" --passphrase-file pass.txt -o json
+
   # Force re-initialization of an existing vault
-  sietch init --force`,
+  sietch init --force
+
+With --non-interactive, or -o json or yaml, init never prompts: a missing
+answer such as the passphrase is an error. --passphrase-stdin and
+--passphrase-file protect the key with the passphrase they give. All options
+are checked before anything is created, and any invalid one makes init exit
+with a non-zero status. With -o json or yaml, the vault ID, path and key
+fingerprints of the new vault are printed to stdout, or the error and whether
+it was an invalid option (kind invalid_options) or a failure (kind failed).`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runInit(cmd)
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		if format == outputTable {
+			return runInit(cmd, format, os.Stdout)
+		}
+
+		// With structured output init never prompts, and progress goes to
+		// stderr so that stdout carries only the result or the error
+		nonInteractive = true
+		resultOut := os.Stdout
+		os.Stdout = os.Stderr
+		defer func() { os.Stdout = resultOut }()
+		if err := runInit(cmd, format, resultOut); err != nil {
+			cmd.SilenceErrors, cmd.SilenceUsage = true, true
+			if werr := writeStructured(resultOut, format, newInitErrorOutput(err)); werr != nil {
+				return werr
+			}
+			return reportedError{err}
+		}
+		return nil
 	},
 }
 
@@ -157,6 +216,8 @@ func init() {
 	initCmd.Flags().StringVar(&keyType, "key-type", "aes", "Type of encryption key (aes, chacha20, gpg, none)")
 	initCmd.Flags().BoolVar(&usePassphrase, "passphrase", false, "Protect key with passphrase")
 	initCmd.Flags().StringVar(&keyFile, "key-file", "", "Path to key file (for importing an existing key)")
+	initCmd.Flags().StringVar(&mnemonicFile, "from-mnemonic", "", "Restore the vault key from a 'sietch keys export --mnemonic' backup in this file ('-' for stdin)")
+	initCmd.Flags().BoolVar(&encryptManifests, "encrypt-manifests", false, "Also encrypt file names, tags and sizes in manifests and indexes (aes, chacha20)")
 	initCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
 	initCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
 
@@ -171,6 +232,8 @@ func init() {
 	initCmd.Flags().StringVar(&chunkingStrategy, "chunking-strategy", "fixed", "Strategy for chunking (fixed, cdc)")
 	initCmd.Flags().StringVar(&chunkSize, "chunk-size", "4MB", "Size of chunks")
 	initCmd.Flags().StringVar(&hashAlgorithm, "hash", "sha256", "Hash algorithm (sha256, blake3)")
+	initCmd.Flags().StringVar(&chunkStore, "chunk-store", "", "Keep chunk data in this directory, such as on a larger disk, instead of inside the vault")
+	initCmd.Flags().IntVar(&chunkFanout, "chunk-fanout", config.MaxChunkFanout, "Levels of two-character directories to spread chunks over (0 keeps them in one directory)")
 
 	// Compression vars
 	initCmd.Flags().StringVar(&compressionType, "compression", "none", "Compression type (none, gzip, zstd)")
@@ -194,12 +257,13 @@ func init() {
 
 	// Other options
 	initCmd.Flags().BoolVar(&interactiveMode, "interactive", false, "Use interactive mode")
+	initCmd.Flags().BoolVar(&nonInteractive, "non-interactive", false, "Never prompt; fail if an answer such as the passphrase is not given by a flag")
 	initCmd.Flags().BoolVar(&forceInit, "force", false, "Force re-initialization of existing vault")
-	initCmd.Flags().StringVar(&templateName, "template", "", "Use a predefined template structure")
-	initCmd.Flags().StringVar(&configFile, "from-config", "", "Initialize from a configuration file")
+	initCmd.Flags().StringVar(&templateName, "template", "", "Pre-fill settings from a built-in or user template (photo-vault, docs-archive, code-backup)")
+	initCmd.Flags().StringVar(&configFile, "from-config", "", "Initialize with the settings of a vault.yaml exported from another vault, or of a .json template file")
 }
 
-func runInit(cmd *cobra.Command) error {
+func runInit(cmd *cobra.Command, format string, out io.Writer) error {
 
 	// Check if any flags were provided by the user
 	// If no flags were provided, show shorter version (just usage and short description)
@@ -220,16 +284,38 @@ func runInit(cmd *cobra.Command) error {
 		return cmd.Help()
 	}
 
+	// Apply the settings of an exported configuration or template; explicit
+	// flags and interactive answers override them
+	importedConfig, err := applyInitConfig(cmd)
+	if err != nil {
+		return invalidInit(err)
+	}
+	if err := applyInitTemplate(cmd); err != nil {
+		return invalidInit(err)
+	}
+
 	// Handle interactive mode first
+	if interactiveMode && nonInteractive {
+		return invalidInit(fmt.Errorf("--interactive cannot be used with --non-interactive or structured output"))
+	}
 	interactiveVaultConfig, err := handleInteractiveMode()
 	if err != nil {
-		return err
+		return invalidInit(err)
+	}
+
+	restoredKey, err := readMnemonicBackup(cmd)
+	if err != nil {
+		return invalidInit(err)
+	}
+
+	if err := validateInitOptions(cmd); err != nil {
+		return invalidInit(err)
 	}
 
 	// Validate and prepare inputs
 	authorValidated, tagsValidated, err := validation.ValidateAndPrepareInputs(author, tags, templateName, configFile)
 	if err != nil {
-		return err
+		return invalidInit(err)
 	}
 	// Update the original variables with validated values
 	author = authorValidated
@@ -238,13 +324,22 @@ func runInit(cmd *cobra.Command) error {
 	// Prepare vault path and check for existing vault
 	absVaultPath, err := vault.PrepareVaultPath(vaultPath, vaultName, forceInit)
 	if err != nil {
-		return err
+		return invalidInit(err)
+	}
+
+	absChunkStore, err := prepareChunkStore(chunkStore)
+	if err != nil {
+		return invalidInit(err)
 	}
 
 	// Create directory structure
 	if err := fs.CreateVaultStructure(absVaultPath); err != nil {
 		return fmt.Errorf("failed to create vault structure: %w", err)
 	}
+	if absChunkStore != "" {
+		// Nothing is kept in the default chunk directory
+		_ = os.Remove(fs.GetChunkDirectory(absVaultPath))
+	}
 
 	// Handle key generation or import
 	var keyConfig *config.KeyConfig
@@ -274,6 +369,7 @@ func runInit(cmd *cobra.Command) error {
 			ScryptR:          scryptR,
 			ScryptP:          scryptP,
 			PBKDF2Iterations: constants.DefaultPBKDF2Iters, // Default PBKDF2 iterations
+			KeyMaterial:      restoredKey,
 		}
 
 		var err error
@@ -345,8 +441,14 @@ func runInit(cmd *cobra.Command) error {
 		dedupMinChunkSize,
 		dedupMaxChunkSize,
 		dedupGCThreshold,
-		true, // index enabled
+		dedupIndexEnabled,
 	)
+	configuration.Encryption.EncryptManifests = encryptManifests
+	configuration.ChunkStore = absChunkStore
+	configuration.ChunkFanout = chunkFanout
+	if importedConfig != nil {
+		carryOverSettings(&configuration, importedConfig)
+	}
 
 	// Initialize RSA config if not present
 	if configuration.Sync.RSA == nil {
@@ -356,9 +458,8 @@ func runInit(cmd *cobra.Command) error {
 		}
 	}
 
-	// Get RSA key size from flags
-	rsaBits, err := cmd.Flags().GetInt("rsa-bits")
-	if err == nil && rsaBits >= constants.MinRSAKeySize {
+	// Get RSA key size from flags, checked by validateInitOptions
+	if rsaBits, err := cmd.Flags().GetInt("rsa-bits"); err == nil {
 		configuration.Sync.RSA.KeySize = rsaBits
 	}
 
@@ -369,24 +470,381 @@ func runInit(cmd *cobra.Command) error {
 		return fmt.Errorf("failed to generate RSA keys for sync: %w", err)
 	}
 
-	// Print the final configuration to verify it has the key
-	fmt.Println("\nFinal Vault Configuration:")
-	if configuration.Encryption.AESConfig != nil {
-		fmt.Printf("  AES Key exists: %v\n", configuration.Encryption.AESConfig.Key != "")
-	}
-
 	// Write configuration to manifest
 	if err := manifest.WriteManifest(absVaultPath, configuration); err != nil {
 		cleanupOnError(absVaultPath)
 		return fmt.Errorf("failed to write vault manifest: %w", err)
 	}
 
+	if format != outputTable {
+		return writeStructured(out, format, newInitOutput(&configuration, absVaultPath))
+	}
+
 	// Print success message
 	ui.PrintSuccessMessage(&configuration, vaultID, absVaultPath)
 
 	return nil
 }
 
+// validateInitOptions checks the options of init, however they were set,
+// before anything is created
+func validateInitOptions(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	useStdin, _ := flags.GetBool("passphrase-stdin")
+	passphraseFile, _ := flags.GetString("passphrase-file")
+	if useStdin && passphraseFile != "" {
+		return fmt.Errorf("--passphrase-stdin and --passphrase-file cannot be used together")
+	}
+	if useStdin || passphraseFile != "" {
+		// Giving a passphrase asks for the key to be protected with it
+		if flags.Changed("passphrase") && !usePassphrase {
+			return fmt.Errorf("a passphrase was given but --passphrase=false")
+		}
+		usePassphrase = true
+	}
+	if usePassphrase && keyType == constants.EncryptionTypeNone {
+		return fmt.Errorf("--passphrase requires an encrypted vault, not key type none")
+	}
+	if usePassphrase && nonInteractive && keyFile == "" && !useStdin && passphraseFile == "" && os.Getenv("SIETCH_PASSPHRASE") == "" {
+		return fmt.Errorf("passphrase required but cannot prompt for it: use --passphrase-stdin, --passphrase-file or SIETCH_PASSPHRASE")
+	}
+	if encryptManifests && keyType != constants.EncryptionTypeAES && keyType != constants.EncryptionTypeChaCha20 {
+		return fmt.Errorf("--encrypt-manifests requires aes or chacha20 encryption, not %s", keyType)
+	}
+	if chunkFanout < 0 || chunkFanout > config.MaxChunkFanout {
+		return fmt.Errorf("invalid --chunk-fanout %d: must be between 0 and %d", chunkFanout, config.MaxChunkFanout)
+	}
+	if useScrypt || keyType == constants.EncryptionTypeChaCha20 {
+		if scryptN < 2 || scryptN&(scryptN-1) != 0 {
+			return fmt.Errorf("invalid --scrypt-n %d: must be a power of two greater than 1", scryptN)
+		}
+		if scryptR <= 0 || scryptP <= 0 {
+			return fmt.Errorf("--scrypt-r and --scrypt-p must be positive")
+		}
+	}
+	rsaBits, _ := flags.GetInt("rsa-bits")
+
+	// The rest are the values vault.yaml will hold
+	cfg := config.VaultConfig{
+		Name:        vaultName,
+		Compression: compressionType,
+		Chunking: config.ChunkingConfig{
+			Strategy:      chunkingStrategy,
+			ChunkSize:     chunkSize,
+			HashAlgorithm: hashAlgorithm,
+		},
+		Deduplication: config.DeduplicationConfig{
+			Strategy:     dedupStrategy,
+			MinChunkSize: dedupMinChunkSize,
+			MaxChunkSize: dedupMaxChunkSize,
+			GCThreshold:  dedupGCThreshold,
+		},
+		Sync: config.SyncConfig{
+			Mode: syncMode,
+			RSA:  &config.RSAConfig{KeySize: rsaBits},
+		},
+	}
+	cfg.Encryption.Type = keyType
+	if keyType == constants.EncryptionTypeAES {
+		cfg.Encryption.AESConfig = &config.AESConfig{Mode: aesMode}
+	}
+	if strings.TrimSpace(vaultName) == "" {
+		return fmt.Errorf("--name cannot be empty")
+	}
+	if rsaBits == 0 {
+		return fmt.Errorf("invalid --rsa-bits 0: must be at least %d", constants.MinRSAKeySize)
+	}
+	return config.ValidateValues(&cfg)
+}
+
+// initValidationError is an init refused before anything was created
+type initValidationError struct{ err error }
+
+func (e *initValidationError) Error() string { return e.err.Error() }
+func (e *initValidationError) Unwrap() error { return e.err }
+
+func invalidInit(err error) error {
+	return &initValidationError{err: err}
+}
+
+// initErrorOutput is the structured form of a failed init
+type initErrorOutput struct {
+	Error string `json:"error" yaml:"error"`
+	// "invalid_options" if init was refused before anything was created,
+	// "failed" if creating the vault failed
+	Kind string `json:"kind" yaml:"kind"`
+}
+
+func newInitErrorOutput(err error) initErrorOutput {
+	out := initErrorOutput{Error: err.Error(), Kind: "failed"}
+	var invalid *initValidationError
+	if errors.As(err, &invalid) {
+		out.Kind = "invalid_options"
+	}
+	return out
+}
+
+// initOutput is the structured form of a new vault
+type initOutput struct {
+	VaultID             string `json:"vault_id" yaml:"vault_id"`
+	Name                string `json:"name" yaml:"name"`
+	Path                string `json:"path" yaml:"path"`
+	Encryption          string `json:"encryption" yaml:"encryption"`
+	PassphraseProtected bool   `json:"passphrase_protected" yaml:"passphrase_protected"`
+	KeyPath             string `json:"key_path,omitempty" yaml:"key_path,omitempty"`
+	KeyFingerprint      string `json:"key_fingerprint,omitempty" yaml:"key_fingerprint,omitempty"`
+	SyncKeyFingerprint  string `json:"sync_key_fingerprint,omitempty" yaml:"sync_key_fingerprint,omitempty"`
+	SyncPublicKey       string `json:"sync_public_key,omitempty" yaml:"sync_public_key,omitempty"`
+	ChunkStore          string `json:"chunk_store,omitempty" yaml:"chunk_store,omitempty"`
+}
+
+func newInitOutput(cfg *config.VaultConfig, absVaultPath string) initOutput {
+	out := initOutput{
+		VaultID:             cfg.VaultID,
+		Name:                cfg.Name,
+		Path:                absVaultPath,
+		Encryption:          cfg.Encryption.Type,
+		PassphraseProtected: cfg.Encryption.PassphraseProtected,
+		KeyPath:             cfg.Encryption.KeyPath,
+		KeyFingerprint:      cfg.Encryption.KeyHash,
+		ChunkStore:          cfg.ChunkStore,
+	}
+	if rsa := cfg.Sync.RSA; rsa != nil {
+		out.SyncKeyFingerprint = rsa.Fingerprint
+		if rsa.PublicKeyPath != "" {
+			out.SyncPublicKey = rsa.PublicKeyPath
+			if !filepath.IsAbs(out.SyncPublicKey) {
+				out.SyncPublicKey = filepath.Join(absVaultPath, out.SyncPublicKey)
+			}
+		}
+	}
+	return out
+}
+
+// readMnemonicBackup decodes the --from-mnemonic backup, if any, and returns
+// the key it holds. The key type and KDF recorded with the key are used unless
+// given explicitly.
+func readMnemonicBackup(cmd *cobra.Command) ([]byte, error) {
+	if mnemonicFile == "" {
+		return nil, nil
+	}
+	if interactiveMode || keyFile != "" {
+		return nil, fmt.Errorf("--from-mnemonic cannot be used with --interactive or --key-file")
+	}
+
+	var text []byte
+	var err error
+	if mnemonicFile == "-" {
+		if useStdin, _ := cmd.Flags().GetBool("passphrase-stdin"); useStdin {
+			return nil, fmt.Errorf("--from-mnemonic - and --passphrase-stdin cannot both read stdin")
+		}
+		text, err = io.ReadAll(os.Stdin)
+	} else {
+		text, err = os.ReadFile(mnemonicFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mnemonic: %w", err)
+	}
+	backup, err := mnemonic.Decode(string(text))
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd.Flags().Changed("key-type") && keyType != backup.KeyType {
+		return nil, fmt.Errorf("the mnemonic holds a %s key, not %s", backup.KeyType, keyType)
+	}
+	keyType = backup.KeyType
+	if !cmd.Flags().Changed("use-scrypt") && (backup.KDF == constants.KDFScrypt || keyType == constants.EncryptionTypeChaCha20) {
+		useScrypt = true
+	}
+	if backup.KDF != "" && !usePassphrase {
+		fmt.Println("⚠️  The backed up vault protected its key with a passphrase; add --passphrase to do the same")
+	}
+	fmt.Printf("Restoring %s key from mnemonic\n", keyType)
+	return backup.Key, nil
+}
+
+// applyInitTemplate copies the chunking, compression, sync, deduplication and
+// tag settings of the --template template into the init options, leaving any
+// option given explicitly on the command line alone
+func applyInitTemplate(cmd *cobra.Command) error {
+	if templateName == "" {
+		return nil
+	}
+
+	template, err := scaffold.ValidateTemplate(templateName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Applying template: %s - %s\n", templateName, template.Description)
+	applyTemplateSettings(cmd, template)
+	return nil
+}
+
+// setInitString sets target to value, unless value is empty or flag was given
+// explicitly on the command line
+func setInitString(cmd *cobra.Command, flag string, target *string, value string) {
+	if value != "" && !cmd.Flags().Changed(flag) {
+		*target = value
+	}
+}
+
+// applyTemplateSettings copies the settings of template into the init options
+func applyTemplateSettings(cmd *cobra.Command, template *scaffold.Template) {
+	flags := cmd.Flags()
+	setString := func(flag string, target *string, value string) {
+		setInitString(cmd, flag, target, value)
+	}
+	c := template.Config
+	setString("chunking-strategy", &chunkingStrategy, c.ChunkingStrategy)
+	setString("chunk-size", &chunkSize, c.ChunkSize)
+	setString("hash", &hashAlgorithm, c.HashAlgorithm)
+	setString("compression", &compressionType, c.Compression)
+	setString("sync-mode", &syncMode, c.SyncMode)
+	setString("dedup-strategy", &dedupStrategy, c.DedupStrategy)
+	setString("dedup-min-size", &dedupMinChunkSize, c.DedupMinSize)
+	setString("dedup-max-size", &dedupMaxChunkSize, c.DedupMaxSize)
+	if !flags.Changed("enable-dedup") {
+		enableDeduplication = c.EnableDedup
+	}
+	if c.DedupGCThreshold > 0 && !flags.Changed("dedup-gc-threshold") {
+		dedupGCThreshold = c.DedupGCThreshold
+	}
+	dedupIndexEnabled = c.DedupIndexEnabled
+	if len(template.Tags) > 0 && !flags.Changed("tags") {
+		tags = template.Tags
+	}
+}
+
+// applyInitConfig copies the settings of the --from-config file into the init
+// options, leaving any option given explicitly on the command line alone. The
+// file is a vault.yaml exported from another vault, or a template if it ends
+// in .json. Key material, key hashes and the vault ID are never copied; the
+// new vault always gets keys of its own. The exported vault configuration is
+// returned so its remaining settings can be carried over.
+func applyInitConfig(cmd *cobra.Command) (*config.VaultConfig, error) {
+	if configFile == "" {
+		return nil, nil
+	}
+	if templateName != "" || interactiveMode {
+		return nil, fmt.Errorf("--from-config cannot be used with --template or --interactive")
+	}
+
+	if strings.EqualFold(filepath.Ext(configFile), ".json") {
+		template, err := scaffold.LoadTemplateFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := template.Validate(); err != nil {
+			return nil, fmt.Errorf("template %s is invalid: %v", configFile, err)
+		}
+		fmt.Printf("Applying template from: %s\n", configFile)
+		applyTemplateSettings(cmd, template)
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	imported, err := config.ParseVaultConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", configFile, err)
+	}
+	fmt.Printf("Loading configuration from: %s\n", configFile)
+
+	flags := cmd.Flags()
+	setString := func(flag string, target *string, value string) {
+		setInitString(cmd, flag, target, value)
+	}
+	setInt := func(flag string, target *int, value int) {
+		if value > 0 && !flags.Changed(flag) {
+			*target = value
+		}
+	}
+
+	setString("name", &vaultName, imported.Name)
+
+	enc := imported.Encryption
+	setString("key-type", &keyType, enc.Type)
+	if !flags.Changed("passphrase") {
+		usePassphrase = enc.PassphraseProtected
+	}
+	if !flags.Changed("encrypt-manifests") {
+		encryptManifests = enc.EncryptManifests
+	}
+	var kdf string
+	var n, r, p int
+	switch {
+	case keyType == constants.EncryptionTypeAES && enc.AESConfig != nil:
+		setString("aes-mode", &aesMode, enc.AESConfig.Mode)
+		kdf, n, r, p = enc.AESConfig.KDF, enc.AESConfig.ScryptN, enc.AESConfig.ScryptR, enc.AESConfig.ScryptP
+	case keyType == constants.EncryptionTypeChaCha20 && enc.ChaChaConfig != nil:
+		kdf, n, r, p = enc.ChaChaConfig.KDF, enc.ChaChaConfig.ScryptN, enc.ChaChaConfig.ScryptR, enc.ChaChaConfig.ScryptP
+	}
+	if kdf == constants.KDFScrypt && !flags.Changed("use-scrypt") {
+		useScrypt = true
+	}
+	setInt("scrypt-n", &scryptN, n)
+	setInt("scrypt-r", &scryptR, r)
+	setInt("scrypt-p", &scryptP, p)
+
+	setString("chunking-strategy", &chunkingStrategy, imported.Chunking.Strategy)
+	setString("chunk-size", &chunkSize, imported.Chunking.ChunkSize)
+	setString("hash", &hashAlgorithm, imported.Chunking.HashAlgorithm)
+	setString("compression", &compressionType, imported.Compression)
+	setString("sync-mode", &syncMode, imported.Sync.Mode)
+	setString("author", &author, imported.Metadata.Author)
+	if !flags.Changed("tags") {
+		tags = imported.Metadata.Tags
+	}
+
+	dedup := imported.Deduplication
+	if !flags.Changed("enable-dedup") {
+		enableDeduplication = dedup.Enabled
+	}
+	setString("dedup-strategy", &dedupStrategy, dedup.Strategy)
+	setString("dedup-min-size", &dedupMinChunkSize, dedup.MinChunkSize)
+	setString("dedup-max-size", &dedupMaxChunkSize, dedup.MaxChunkSize)
+	setInt("dedup-gc-threshold", &dedupGCThreshold, dedup.GCThreshold)
+	dedupIndexEnabled = dedup.IndexEnabled
+
+	if imported.Sync.RSA != nil && imported.Sync.RSA.KeySize > 0 && !flags.Changed("rsa-bits") {
+		if err := flags.Lookup("rsa-bits").Value.Set(strconv.Itoa(imported.Sync.RSA.KeySize)); err != nil {
+			return nil, err
+		}
+	}
+
+	if enc.Type != constants.EncryptionTypeNone && mnemonicFile == "" && keyFile == "" {
+		fmt.Println("⚠️  A new encryption key is generated; files of the exported vault cannot be read with it unless its key is restored with --from-mnemonic or --key-file")
+	}
+	return imported, nil
+}
+
+// carryOverSettings copies the settings of an exported vault that init has
+// no options for into configuration. Trusted peers, peer groups and the
+// private network key belong to the exported vault's identity and are left out.
+func carryOverSettings(configuration, imported *config.VaultConfig) {
+	configuration.Replica = imported.Replica
+	configuration.Cache = imported.Cache
+
+	syncConfig := &configuration.Sync
+	syncConfig.Enabled = imported.Sync.Enabled
+	syncConfig.AutoSync = imported.Sync.AutoSync
+	syncConfig.SyncInterval = imported.Sync.SyncInterval
+	syncConfig.TombstoneRetentionPeriod = imported.Sync.TombstoneRetentionPeriod
+	syncConfig.MaxStreams = imported.Sync.MaxStreams
+	syncConfig.MaxPeerStreams = imported.Sync.MaxPeerStreams
+	syncConfig.PeerRequestRate = imported.Sync.PeerRequestRate
+	syncConfig.ListenAddrs = imported.Sync.ListenAddrs
+	syncConfig.TransportCompression = imported.Sync.TransportCompression
+	syncConfig.Timeouts = imported.Sync.Timeouts
+
+	if imported.Sync.RSA != nil && (len(imported.Sync.RSA.TrustedPeers) > 0 || len(imported.Sync.Groups) > 0) || imported.Sync.NetworkKey != "" {
+		fmt.Println("Trusted peers, peer groups and the network key of the exported vault are not restored; pair with peers again")
+	}
+}
+
 func handleInteractiveMode() (*config.VaultConfig, error) {
 	if !interactiveMode {
 		return nil, nil
@@ -461,7 +919,37 @@ func handleInteractiveMode() (*config.VaultConfig, error) {
 	return vaultConfig, nil
 }
 
+// prepareChunkStore creates the --chunk-store directory, if one was given,
+// and returns its absolute path. The directory must be new or empty, since
+// vaults cannot share a chunk store.
+func prepareChunkStore(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of chunk store: %w", err)
+	}
+	entries, err := os.ReadDir(absPath)
+	switch {
+	case err == nil && len(entries) > 0:
+		return "", fmt.Errorf("chunk store %s is not empty; give a new or empty directory, vaults cannot share one", absPath)
+	case err != nil && !os.IsNotExist(err):
+		return "", fmt.Errorf("failed to read chunk store %s: %w", absPath, err)
+	}
+	if err := os.MkdirAll(absPath, constants.StandardDirPerms); err != nil {
+		return "", fmt.Errorf("failed to create chunk store %s: %w", absPath, err)
+	}
+	return absPath, nil
+}
+
 func cleanupOnError(absVaultPath string) {
 	// Attempt to clean up partially created vault on error
 	_ = os.RemoveAll(absVaultPath)
+	if chunkStore != "" {
+		// Only removed while still empty
+		if absChunkStore, err := filepath.Abs(chunkStore); err == nil {
+			_ = os.Remove(absChunkStore)
+		}
+	}
 }
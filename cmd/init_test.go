@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// parseInitFlags resets the init options to their defaults and parses args
+func parseInitFlags(t *testing.T, args ...string) {
+	t.Helper()
+	flags := initCmd.Flags()
+	flags.VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	nonInteractive = false
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("parse %v: %v", args, err)
+	}
+}
+
+func TestValidateInitOptions(t *testing.T) {
+	t.Cleanup(func() { parseInitFlags(t) })
+	t.Setenv("SIETCH_PASSPHRASE", "")
+
+	valid := [][]string{
+		{"--name", "dune"},
+		{"--key-type", "chacha20", "--chunk-size", "1MB", "--compression", "zstd"},
+		{"--passphrase-file", "pass.txt", "--non-interactive"},
+	}
+	for _, args := range valid {
+		parseInitFlags(t, args...)
+		if err := validateInitOptions(initCmd); err != nil {
+			t.Errorf("%v: %v", args, err)
+		}
+	}
+
+	invalid := [][]string{
+		{"--chunk-size", "huge"},
+		{"--compression", "lzma"},
+		{"--key-type", "rot13"},
+		{"--aes-mode", "ecb"},
+		{"--rsa-bits", "1024"},
+		{"--use-scrypt", "--scrypt-n", "1000"},
+		{"--name", " "},
+		{"--key-type", "none", "--passphrase"},
+		{"--key-type", "gpg", "--encrypt-manifests"},
+		{"--passphrase-stdin", "--passphrase-file", "pass.txt"},
+		{"--passphrase", "--non-interactive"},
+	}
+	for _, args := range invalid {
+		parseInitFlags(t, args...)
+		if err := validateInitOptions(initCmd); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+
+	// A passphrase source asks for passphrase protection
+	parseInitFlags(t, "--passphrase-stdin")
+	if err := validateInitOptions(initCmd); err != nil || !usePassphrase {
+		t.Errorf("--passphrase-stdin: expected passphrase protection, got %v (%v)", usePassphrase, err)
+	}
+}
+
+func TestInitErrorOutput(t *testing.T) {
+	if out := newInitErrorOutput(invalidInit(errors.New("bad chunk size"))); out.Kind != "invalid_options" || out.Error != "bad chunk size" {
+		t.Errorf("unexpected output for an invalid option: %+v", out)
+	}
+	if out := newInitErrorOutput(errors.New("disk full")); out.Kind != "failed" || !strings.Contains(out.Error, "disk full") {
+		t.Errorf("unexpected output for a failure: %+v", out)
+	}
+}
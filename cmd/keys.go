@@ -0,0 +1,506 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/encryption/mnemonic"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// keysCmd groups the commands managing the vault's encryption key
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the vault's encryption and sync keys",
+	Long: `Manage the vault's keys: the key encrypting its chunks, created by init, and
+the RSA key pair identifying the vault to its sync peers.
+
+Subcommands:
+  show             Show the keys and their fingerprints
+  verify           Check that the keys load and still open the vault
+  export           Back the vault key up to a file or as a list of words
+  import           Restore the vault key from a backup file
+  rotate-transfer  Replace the short-lived key peers encrypt sync data to`,
+}
+
+var keysShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the vault's keys and their fingerprints",
+	Long: `Show the vault's encryption key and sync key pair with their fingerprints.
+
+No passphrase is needed: the fingerprints are those recorded in vault.yaml.
+Compare the sync key fingerprint with the one a peer shows when pairing. The
+transfer key, which peers encrypt sync data to, changes as it is rotated.
+
+Examples:
+  sietch keys show
+  sietch keys show -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		out := newKeysOutput(vaultRoot, vaultConfig)
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, out)
+		}
+		displayKeys(os.Stdout, out)
+		return nil
+	},
+}
+
+var keysVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that the vault's keys load and open the vault",
+	Long: `Check the vault's keys without changing anything:
+
+  vault key         the key file loads and, for passphrase protected vaults,
+                    the passphrase unlocks it
+  chunk decryption  the key decrypts chunks stored in the vault
+  sync keys         the RSA key pair loads, its halves match and its
+                    fingerprint is the one recorded in vault.yaml
+  transfer key      the sync key signed the current transfer key, which
+                    has not expired
+
+Checks that do not apply, such as chunk decryption in a vault without chunks,
+are skipped. The command fails if any check fails.
+
+Examples:
+  sietch keys verify
+  sietch keys verify --passphrase-file pass.txt -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		stdout := os.Stdout
+		if format != outputTable {
+			// Keep passphrase prompts out of structured output
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = stdout }()
+		}
+		checks := verifyVaultKeys(cmd, vaultRoot, vaultConfig)
+		failed := 0
+		for _, c := range checks {
+			if c.Status == keyCheckFailed {
+				failed++
+			}
+		}
+		var failure error
+		if failed > 0 {
+			failure = fmt.Errorf("%d of %d key checks failed", failed, len(checks))
+		}
+
+		if format != outputTable {
+			out := keysVerifyOutput{OK: failed == 0, Checks: checks}
+			if err := writeStructured(stdout, format, out); err != nil {
+				return err
+			}
+			if failure != nil {
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				return reportedError{failure}
+			}
+			return nil
+		}
+		for _, c := range checks {
+			fmt.Printf("%s %-17s %s\n", keyCheckSymbols[c.Status], c.Name, c.Detail)
+		}
+		return failure
+	},
+}
+
+var keysExportCmd = &cobra.Command{
+	Use:   "export (--mnemonic | --file <path>)",
+	Short: "Export the vault key as a backup file or a paper backup",
+	Long: `Export the vault's encryption key so it can be recovered if its key file is lost.
+
+With --file the key is written to a backup file, readable only by its owner,
+that 'sietch keys import' restores. The key stays wrapped: the key file of a
+passphrase protected vault is copied as it is, so the backup opens with the
+vault passphrase; the key of a vault without one is wrapped under a new
+passphrase, read from --new-passphrase-file, SIETCH_NEW_PASSPHRASE or a prompt.
+
+With --mnemonic the key is printed as a numbered list of words (25 for a
+256-bit key) from the BIP39 English word list, with its key type, KDF and a
+checksum. Write the words down and keep them somewhere safe: anyone holding
+them can decrypt the vault, without its passphrase.
+
+The words are printed to stdout and everything else to stderr, so
+redirecting stdout saves just the words. To recover, create a vault from the words and restore the data into it from a
+peer or a copy of the chunks:
+  sietch init --name my-vault --passphrase --from-mnemonic words.txt
+
+Words may be written in either case, abbreviated to their first four
+letters, and with or without their numbers.
+
+Examples:
+  sietch keys export --file vault-key.backup
+  sietch keys export --mnemonic
+  sietch keys export --mnemonic > words.txt
+  sietch keys export --mnemonic -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		useMnemonic, _ := cmd.Flags().GetBool("mnemonic")
+		backupFile, _ := cmd.Flags().GetString("file")
+		switch {
+		case useMnemonic && backupFile != "":
+			return fmt.Errorf("--mnemonic and --file cannot be used together")
+		case !useMnemonic && backupFile == "":
+			return fmt.Errorf("choose an export format: --mnemonic or --file")
+		}
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		key, err := encryption.LoadVaultKey(*vaultConfig, passphrase)
+		if err != nil {
+			return err
+		}
+		if backupFile != "" {
+			return exportKeyBackup(cmd, format, vaultConfig, key, backupFile)
+		}
+		backup := mnemonic.Backup{KeyType: vaultConfig.Encryption.Type, KDF: vaultKDF(vaultConfig), Key: key}
+		words, err := mnemonic.Encode(backup)
+		if err != nil {
+			return err
+		}
+
+		out := mnemonicOutput{KeyType: backup.KeyType, KDF: backup.KDF, Words: words}
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, out)
+		}
+		// Only the words go to stdout, so they can be redirected to a file
+		fmt.Fprintf(os.Stderr, "🔑 Mnemonic backup of the %s vault key (%d words)\n\n", out.KeyType, len(out.Words))
+		displayMnemonic(os.Stdout, out.Words)
+		fmt.Fprintln(os.Stderr, "\n⚠️  Anyone holding these words can decrypt the vault. Keep them offline.")
+		fmt.Fprintln(os.Stderr, "Restore with: sietch init --from-mnemonic <file with the words>")
+		return nil
+	},
+}
+
+// keysOutput describes the vault's keys, as 'keys show' prints them
+type keysOutput struct {
+	VaultID  string       `json:"vault_id" yaml:"vault_id"`
+	VaultKey vaultKeyInfo `json:"vault_key" yaml:"vault_key"`
+	SyncKey  *syncKeyInfo `json:"sync_key,omitempty" yaml:"sync_key,omitempty"`
+}
+
+// vaultKeyInfo describes the key encrypting the vault's chunks
+type vaultKeyInfo struct {
+	Type                string `json:"type" yaml:"type"`
+	Path                string `json:"path,omitempty" yaml:"path,omitempty"`
+	Fingerprint         string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	PassphraseProtected bool   `json:"passphrase_protected" yaml:"passphrase_protected"`
+	KDF                 string `json:"kdf,omitempty" yaml:"kdf,omitempty"`
+	GPGKeyID            string `json:"gpg_key_id,omitempty" yaml:"gpg_key_id,omitempty"`
+}
+
+// syncKeyInfo describes the RSA key pair identifying the vault to peers
+type syncKeyInfo struct {
+	KeySize        int    `json:"key_size" yaml:"key_size"`
+	PublicKeyPath  string `json:"public_key_path" yaml:"public_key_path"`
+	PrivateKeyPath string `json:"private_key_path" yaml:"private_key_path"`
+	Fingerprint    string `json:"fingerprint" yaml:"fingerprint"`
+	TrustedPeers   int    `json:"trusted_peers" yaml:"trusted_peers"`
+	// The short-lived key the identity key signs, which peers encrypt to
+	TransferKey *transferKeyInfo `json:"transfer_key,omitempty" yaml:"transfer_key,omitempty"`
+}
+
+func newKeysOutput(vaultRoot string, vaultConfig *config.VaultConfig) keysOutput {
+	enc := vaultConfig.Encryption
+	out := keysOutput{
+		VaultID: vaultConfig.VaultID,
+		VaultKey: vaultKeyInfo{
+			Type:                enc.Type,
+			PassphraseProtected: enc.PassphraseProtected,
+			KDF:                 vaultKDF(vaultConfig),
+		},
+	}
+	switch enc.Type {
+	case constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20:
+		out.VaultKey.Path, out.VaultKey.Fingerprint = enc.KeyPath, enc.KeyHash
+	case constants.EncryptionTypeGPG:
+		out.VaultKey.Fingerprint = enc.KeyHash
+		if enc.GPGConfig != nil {
+			out.VaultKey.GPGKeyID = enc.GPGConfig.KeyID
+		}
+	}
+	if rsaConfig := vaultConfig.Sync.RSA; rsaConfig != nil && rsaConfig.PrivateKeyPath != "" {
+		out.SyncKey = &syncKeyInfo{
+			KeySize:        rsaConfig.KeySize,
+			PublicKeyPath:  rsaConfig.PublicKeyPath,
+			PrivateKeyPath: rsaConfig.PrivateKeyPath,
+			Fingerprint:    rsaConfig.Fingerprint,
+			TrustedPeers:   len(rsaConfig.TrustedPeers),
+			TransferKey:    newTransferKeyInfo(vaultRoot),
+		}
+	}
+	return out
+}
+
+// displayKeys prints the vault's keys for 'keys show'
+func displayKeys(w io.Writer, out keysOutput) {
+	key := out.VaultKey
+	fmt.Fprintln(w, "🔑 Vault key")
+	fmt.Fprintf(w, "  Type:        %s\n", key.Type)
+	if key.Type == constants.EncryptionTypeNone {
+		fmt.Fprintln(w, "  The vault is not encrypted")
+	}
+	if key.Path != "" {
+		fmt.Fprintf(w, "  Key file:    %s\n", key.Path)
+	}
+	if key.GPGKeyID != "" {
+		fmt.Fprintf(w, "  GPG key:     %s\n", key.GPGKeyID)
+	}
+	if key.Fingerprint != "" {
+		fmt.Fprintf(w, "  Fingerprint: %s\n", key.Fingerprint)
+	}
+	if key.PassphraseProtected {
+		fmt.Fprintf(w, "  Passphrase:  yes (%s)\n", key.KDF)
+	} else if key.Type != constants.EncryptionTypeNone {
+		fmt.Fprintln(w, "  Passphrase:  no")
+	}
+
+	fmt.Fprintln(w, "\n🔐 Sync key")
+	if out.SyncKey == nil {
+		fmt.Fprintln(w, "  No sync key pair; the vault was created without sync")
+		return
+	}
+	fmt.Fprintf(w, "  Type:        RSA-%d\n", out.SyncKey.KeySize)
+	fmt.Fprintf(w, "  Public key:  %s\n", out.SyncKey.PublicKeyPath)
+	fmt.Fprintf(w, "  Fingerprint: %s\n", out.SyncKey.Fingerprint)
+	fmt.Fprintf(w, "  Trusted by:  %d peers\n", out.SyncKey.TrustedPeers)
+	if transfer := out.SyncKey.TransferKey; transfer != nil {
+		fmt.Fprintf(w, "  Transfer key: %s, expires %s\n", transfer.Fingerprint, transfer.Expires.Local().Format(time.RFC1123))
+	} else {
+		fmt.Fprintln(w, "  Transfer key: none yet; the next sync makes one")
+	}
+}
+
+// Outcomes of a key check
+const (
+	keyCheckOK      = "ok"
+	keyCheckFailed  = "failed"
+	keyCheckSkipped = "skipped"
+)
+
+var keyCheckSymbols = map[string]string{keyCheckOK: "✓", keyCheckFailed: "✗", keyCheckSkipped: "-"}
+
+// keyCheck is the outcome of one check of 'keys verify'
+type keyCheck struct {
+	Name   string `json:"name" yaml:"name"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+}
+
+// keysVerifyOutput is the structured result of 'keys verify'
+type keysVerifyOutput struct {
+	OK     bool       `json:"ok" yaml:"ok"`
+	Checks []keyCheck `json:"checks" yaml:"checks"`
+}
+
+// verifyVaultKeys runs the checks of 'keys verify' on the vault at vaultRoot
+func verifyVaultKeys(cmd *cobra.Command, vaultRoot string, vaultConfig *config.VaultConfig) []keyCheck {
+	vaultKey := keyCheck{Name: "vault key", Status: keyCheckSkipped}
+	chunks := keyCheck{Name: "chunk decryption", Status: keyCheckSkipped}
+
+	var key []byte
+	switch vaultConfig.Encryption.Type {
+	case constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20:
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err == nil {
+			key, err = encryption.LoadVaultKey(*vaultConfig, passphrase)
+		}
+		if err == nil {
+			err = checkKeySize(vaultConfig.Encryption.Type, key)
+		}
+		switch {
+		case err != nil:
+			vaultKey.Status, vaultKey.Detail = keyCheckFailed, err.Error()
+			chunks.Detail = "the vault key did not load"
+			key = nil
+		case vaultConfig.Encryption.PassphraseProtected:
+			vaultKey.Status, vaultKey.Detail = keyCheckOK, "unlocked with the passphrase"
+		default:
+			vaultKey.Status, vaultKey.Detail = keyCheckOK, "loaded"
+		}
+	case constants.EncryptionTypeGPG:
+		vaultKey.Detail = "the key is held by gpg"
+		chunks.Detail = vaultKey.Detail
+	default:
+		vaultKey.Detail = "the vault is not encrypted"
+		chunks.Detail = vaultKey.Detail
+	}
+
+	if key != nil {
+		probed, err := probeVaultKey(vaultRoot, key, vaultConfig.Encryption)
+		switch {
+		case err != nil:
+			chunks.Status, chunks.Detail = keyCheckFailed, err.Error()
+		case probed == "":
+			chunks.Detail = "no chunks stored yet"
+		default:
+			chunks.Status, chunks.Detail = keyCheckOK, "decrypts chunk "+probed
+		}
+	}
+	syncKeys, identity := verifySyncKeys(vaultRoot, vaultConfig)
+	checks := []keyCheck{vaultKey, chunks, syncKeys}
+	if syncKeys.Status != keyCheckSkipped {
+		checks = append(checks, verifyTransferKey(vaultRoot, identity))
+	}
+	return checks
+}
+
+// checkKeySize checks that key is a valid key for encryption of keyType
+func checkKeySize(keyType string, key []byte) error {
+	switch n := len(key); {
+	case keyType == constants.EncryptionTypeAES && n != constants.AESKeySize128 && n != constants.AESKeySize192 && n != constants.AESKeySize:
+		return fmt.Errorf("key is %d bytes, not a valid AES key size", n)
+	case keyType == constants.EncryptionTypeChaCha20 && n != chacha20poly1305.KeySize:
+		return fmt.Errorf("key is %d bytes, ChaCha20 keys are %d", n, chacha20poly1305.KeySize)
+	}
+	return nil
+}
+
+// verifySyncKeys checks the vault's RSA key pair against vault.yaml,
+// returning its public key unless the check fails
+func verifySyncKeys(vaultRoot string, vaultConfig *config.VaultConfig) (keyCheck, *rsa.PublicKey) {
+	check := keyCheck{Name: "sync keys", Status: keyCheckSkipped, Detail: "no sync key pair"}
+	rsaConfig := vaultConfig.Sync.RSA
+	if rsaConfig == nil || rsaConfig.PrivateKeyPath == "" {
+		return check, nil
+	}
+
+	check.Status = keyCheckFailed
+	privateKey, publicKey, _, err := keys.LoadRSAKeys(vaultRoot, rsaConfig)
+	if err != nil {
+		check.Detail = err.Error()
+		return check, nil
+	}
+	if err := keys.ValidateRSAKeyPair(privateKey, publicKey); err != nil {
+		check.Detail = err.Error()
+		return check, nil
+	}
+	fingerprint, err := keys.GetRSAPublicKeyFingerprint(publicKey)
+	if err != nil {
+		check.Detail = err.Error()
+		return check, nil
+	}
+	if rsaConfig.Fingerprint != "" && fingerprint != rsaConfig.Fingerprint {
+		check.Detail = fmt.Sprintf("public key fingerprint %s does not match %s recorded in vault.yaml", fingerprint, rsaConfig.Fingerprint)
+		return check, nil
+	}
+	check.Status, check.Detail = keyCheckOK, fmt.Sprintf("RSA-%d, fingerprint %s", publicKey.N.BitLen(), fingerprint)
+	return check, publicKey
+}
+
+// vaultKDF returns the KDF protecting the vault key, or "" if the key has no
+// passphrase
+func vaultKDF(vaultConfig *config.VaultConfig) string {
+	enc := vaultConfig.Encryption
+	if !enc.PassphraseProtected {
+		return ""
+	}
+	switch {
+	case enc.Type == constants.EncryptionTypeAES && enc.AESConfig != nil:
+		return enc.AESConfig.KDF
+	case enc.Type == constants.EncryptionTypeChaCha20 && enc.ChaChaConfig != nil:
+		return enc.ChaChaConfig.KDF
+	}
+	return ""
+}
+
+// mnemonicOutput is the structured form of a mnemonic backup
+type mnemonicOutput struct {
+	KeyType string   `json:"key_type" yaml:"key_type"`
+	KDF     string   `json:"kdf,omitempty" yaml:"kdf,omitempty"`
+	Words   []string `json:"words" yaml:"words"`
+}
+
+// displayMnemonic prints words numbered, four to a line, in reading order so
+// that the printed text can be fed back to init
+func displayMnemonic(w io.Writer, words []string) {
+	const columns = 4
+	for start := 0; start < len(words); start += columns {
+		var line strings.Builder
+		for i := start; i < len(words) && i < start+columns; i++ {
+			fmt.Fprintf(&line, "%3d. %-10s", i+1, words[i])
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysShowCmd)
+	keysCmd.AddCommand(keysVerifyCmd)
+	keysCmd.AddCommand(keysExportCmd)
+	keysCmd.AddCommand(keysImportCmd)
+	keysCmd.AddCommand(keysRotateTransferCmd)
+
+	keysVerifyCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	keysVerifyCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+
+	keysExportCmd.Flags().Bool("mnemonic", false, "Print the key as a list of words for a paper backup")
+	keysExportCmd.Flags().String("file", "", "Write the key to a backup file for 'sietch keys import'")
+	keysExportCmd.Flags().Bool("force", false, "Replace an existing backup file")
+	keysExportCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	keysExportCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	keysExportCmd.Flags().String("new-passphrase-file", "", "Read the passphrase protecting the backup of a vault without one from file")
+
+	keysImportCmd.Flags().Bool("force", false, "Import a backup of another vault or one whose key does not decrypt the stored chunks")
+	keysImportCmd.Flags().Bool("passphrase-stdin", false, "Read the backup passphrase from stdin (for automation)")
+	keysImportCmd.Flags().String("passphrase-file", "", "Read the backup passphrase from file (file should have 0600 permissions)")
+
+	keysRotateTransferCmd.Flags().Duration("lifetime", p2p.DefaultTransferKeyLifetime, "How long the new transfer key is valid")
+}
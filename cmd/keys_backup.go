@@ -0,0 +1,205 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// maxKeyProbes is how many stored chunks probeVaultKey tries to decrypt
+const maxKeyProbes = 3
+
+var keysImportCmd = &cobra.Command{
+	Use:   "import <backup-file>",
+	Short: "Restore the vault key from a backup file",
+	Long: `Restore the vault's encryption key from a backup written by
+'sietch keys export --file', replacing a lost or damaged key file.
+
+The backup is unwrapped with its passphrase: the vault passphrase at the time
+of the export for passphrase protected vaults, or the passphrase chosen for
+the backup otherwise. Before anything is written the key must decrypt chunks
+stored in the vault, and the backup must come from this vault. The key file
+and vault.yaml are then replaced together in one transaction.
+
+Examples:
+  sietch keys import vault-key.backup
+  sietch keys import vault-key.backup --passphrase-file pass.txt
+  sietch keys import other-vault.backup --force   # Skip the vault and chunk checks`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		keyRel, err := vaultKeyRel(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read key backup: %v", err)
+		}
+		backup, err := encryption.ParseKeyBackup(data)
+		if err != nil {
+			return err
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		if backup.VaultID != vaultConfig.VaultID && !force {
+			return fmt.Errorf("key backup is of vault %s (%s), not of this vault (%s); use --force to import it anyway",
+				backup.VaultName, backup.VaultID, vaultConfig.VaultID)
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, &config.VaultConfig{Encryption: backup.Encryption})
+		if err != nil {
+			return err
+		}
+		restored, err := backup.Restore(vaultConfig.Encryption, passphrase)
+		if err != nil {
+			return err
+		}
+		probed, probeErr := probeVaultKey(vaultRoot, restored.Key, restored.Encryption)
+		if probeErr != nil && !force {
+			return fmt.Errorf("the key in the backup does not open this vault: %v (use --force to import it anyway)", probeErr)
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would restore the vault key in %s and update vault.yaml\n", keyRel)
+			return nil
+		}
+		vaultConfig.Encryption = restored.Encryption
+		if err := replaceVaultKey(vaultRoot, "keys import", keyRel, restored.KeyFile, vaultConfig); err != nil {
+			return err
+		}
+		recordAudit(vaultRoot, audit.OpKeyImport, map[string]string{"key": filepath.ToSlash(keyRel), "backup_vault": backup.VaultID})
+
+		fmt.Printf("✓ Vault key restored from %s\n", args[0])
+		switch {
+		case probeErr != nil:
+			fmt.Printf("⚠️  Imported despite the failed check: %v\n", probeErr)
+		case probed != "":
+			fmt.Printf("  Verified against stored chunk %s\n", probed)
+		default:
+			fmt.Println("  The vault stores no chunks yet, so the key could not be checked against them")
+		}
+		return nil
+	},
+}
+
+// keyBackupOutput is the structured result of 'keys export --file'
+type keyBackupOutput struct {
+	File        string `json:"file" yaml:"file"`
+	VaultID     string `json:"vault_id" yaml:"vault_id"`
+	KeyType     string `json:"key_type" yaml:"key_type"`
+	KeyHash     string `json:"key_hash,omitempty" yaml:"key_hash,omitempty"`
+	WrappedWith string `json:"wrapped_with" yaml:"wrapped_with"` // "vault passphrase" or "backup passphrase"
+}
+
+// exportKeyBackup writes key, the vault key of vaultConfig, to a backup file
+// at path. Keys of vaults without a passphrase are wrapped under a new one.
+func exportKeyBackup(cmd *cobra.Command, format string, vaultConfig *config.VaultConfig, key []byte, path string) error {
+	if force, _ := cmd.Flags().GetBool("force"); !force {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists, use --force to replace it", path)
+		}
+	}
+
+	out := keyBackupOutput{File: path, VaultID: vaultConfig.VaultID, KeyType: vaultConfig.Encryption.Type,
+		KeyHash: vaultConfig.Encryption.KeyHash, WrappedWith: "vault passphrase"}
+	passphrase := ""
+	if !vaultConfig.Encryption.PassphraseProtected {
+		fmt.Fprintln(os.Stderr, "The vault key has no passphrase; choose one to protect the backup")
+		// Keep the prompts out of structured output
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		var err error
+		passphrase, err = ui.GetNewPassphrase(cmd)
+		os.Stdout = stdout
+		if err != nil {
+			return err
+		}
+		out.WrappedWith = "backup passphrase"
+	}
+
+	backup, err := encryption.NewKeyBackup(*vaultConfig, key, passphrase)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(backup)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key backup: %v", err)
+	}
+	if err := os.WriteFile(path, data, constants.SecureFilePerms); err != nil {
+		return fmt.Errorf("failed to write key backup: %v", err)
+	}
+	// WriteFile keeps the mode of a file it replaces
+	if err := os.Chmod(path, constants.SecureFilePerms); err != nil {
+		return fmt.Errorf("failed to restrict key backup permissions: %v", err)
+	}
+
+	if format != outputTable {
+		return writeStructured(os.Stdout, format, out)
+	}
+	fmt.Printf("✓ Vault key backed up to %s, wrapped with the %s\n", path, out.WrappedWith)
+	fmt.Println("Restore with: sietch keys import <file>")
+	return nil
+}
+
+// probeVaultKey decrypts up to maxKeyProbes stored chunks with key, returning
+// the name of the first one it opens, or "" if the vault stores no chunks
+func probeVaultKey(vaultRoot string, key []byte, enc config.EncryptionConfig) (string, error) {
+	var paths []string
+	err := fs.WalkChunks(vaultRoot, func(_, path string, entry os.DirEntry) error {
+		if entry.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list chunks: %v", err)
+	}
+
+	tried := 0
+	var lastErr error
+	for _, path := range paths {
+		name := filepath.Base(path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read chunk %s: %v", name, err)
+		}
+		tried++
+		decrypted, err := encryption.DecryptWithKey(string(data), key, enc)
+		if err == nil {
+			// Chunks are base64 encoded before they are encrypted
+			if _, err = base64.StdEncoding.DecodeString(decrypted); err == nil {
+				return name, nil
+			}
+		}
+		lastErr = err
+		if tried == maxKeyProbes {
+			break
+		}
+	}
+	if tried == 0 {
+		return "", nil
+	}
+	return "", fmt.Errorf("none of %d stored chunks decrypts: %v", tried, lastErr)
+}
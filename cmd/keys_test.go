@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/mnemonic"
+)
+
+func TestDisplayedMnemonicRestores(t *testing.T) {
+	backup := mnemonic.Backup{KeyType: constants.EncryptionTypeAES, KDF: constants.KDFScrypt, Key: bytes.Repeat([]byte{0x5a, 0x17}, 16)}
+	words, err := mnemonic.Encode(backup)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var out bytes.Buffer
+	displayMnemonic(&out, words)
+	restored, err := mnemonic.Decode(out.String())
+	if err != nil {
+		t.Fatalf("Decode of printed words: %v\n%s", err, out.String())
+	}
+	if !bytes.Equal(restored.Key, backup.Key) {
+		t.Fatal("printed words restore a different key")
+	}
+}
+
+func TestVaultKDF(t *testing.T) {
+	cfg := &config.VaultConfig{Encryption: config.EncryptionConfig{
+		Type:      constants.EncryptionTypeAES,
+		AESConfig: &config.AESConfig{KDF: constants.KDFPBKDF2},
+	}}
+	if kdf := vaultKDF(cfg); kdf != "" {
+		t.Errorf("vaultKDF without passphrase = %q, want empty", kdf)
+	}
+	cfg.Encryption.PassphraseProtected = true
+	if kdf := vaultKDF(cfg); kdf != constants.KDFPBKDF2 {
+		t.Errorf("vaultKDF = %q, want %q", kdf, constants.KDFPBKDF2)
+	}
+}
+
+func TestCheckKeySize(t *testing.T) {
+	if err := checkKeySize(constants.EncryptionTypeAES, make([]byte, 24)); err != nil {
+		t.Errorf("AES-192 key: %v", err)
+	}
+	if err := checkKeySize(constants.EncryptionTypeAES, make([]byte, 20)); err == nil {
+		t.Error("expected an error for a 20 byte AES key")
+	}
+	if err := checkKeySize(constants.EncryptionTypeChaCha20, make([]byte, 16)); err == nil {
+		t.Error("expected an error for a 16 byte ChaCha20 key")
+	}
+}
+
+func TestProbeVaultKey(t *testing.T) {
+	vaultRoot := t.TempDir()
+	chunkDir := filepath.Join(vaultRoot, ".sietch", "chunks")
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	enc := config.EncryptionConfig{Type: constants.EncryptionTypeChaCha20}
+	key := bytes.Repeat([]byte{1}, 32)
+
+	if probed, err := probeVaultKey(vaultRoot, key, enc); err != nil || probed != "" {
+		t.Errorf("empty vault: got %q, %v", probed, err)
+	}
+	if err := os.WriteFile(filepath.Join(chunkDir, "abc"), []byte("00ff00ff00ff00ff00ff00ff00ff00ff00ff"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := probeVaultKey(vaultRoot, key, enc); err == nil {
+		t.Error("expected an error for a chunk the key does not decrypt")
+	}
+}
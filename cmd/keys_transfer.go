@@ -0,0 +1,137 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption/keys"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+var keysRotateTransferCmd = &cobra.Command{
+	Use:   "rotate-transfer",
+	Short: "Replace the transfer key peers encrypt sync data to",
+	Long: `Replace the vault's transfer key with a new one.
+
+The sync key pair is the vault's long-lived identity: peers pin it when they
+pair, and it only signs. Chunks and session secrets that peers send are
+encrypted to a short-lived transfer key instead, which the identity key
+signs. Sync makes and rotates transfer keys by itself; this command rotates
+at once, for instance after a copy of the vault leaked. Peers accept the new
+key at the next sync without pairing again.
+
+The replaced key is kept until it expires, so sessions peers opened with it
+can still be used.
+
+Examples:
+  sietch keys rotate-transfer
+  sietch keys rotate-transfer --lifetime 48h`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		rsaConfig := vaultConfig.Sync.RSA
+		if rsaConfig == nil || rsaConfig.PrivateKeyPath == "" {
+			return fmt.Errorf("the vault has no sync key pair to sign a transfer key with")
+		}
+		lifetime, _ := cmd.Flags().GetDuration("lifetime")
+		if lifetime < time.Hour {
+			return fmt.Errorf("--lifetime must be at least 1h, got %s", lifetime)
+		}
+
+		privateKey, _, _, err := keys.LoadRSAKeys(vaultRoot, rsaConfig)
+		if err != nil {
+			return fmt.Errorf("failed to load sync keys: %v", err)
+		}
+		key, err := p2p.RotateTransferKey(vaultRoot, privateKey, lifetime)
+		if err != nil {
+			return fmt.Errorf("failed to rotate transfer key: %v", err)
+		}
+		recordAudit(vaultRoot, audit.OpKeyRotate, map[string]string{"key": "transfer", "fingerprint": key.Certificate.Fingerprint()})
+
+		info := newTransferKeyInfo(vaultRoot)
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, info)
+		}
+		fmt.Printf("✓ New transfer key %s\n", key.Certificate.Fingerprint())
+		fmt.Printf("  Expires: %s\n", key.Certificate.Expires.Local().Format(time.RFC1123))
+		if info != nil && info.Previous > 0 {
+			fmt.Printf("  %d earlier key(s) kept until they expire\n", info.Previous)
+		}
+		return nil
+	},
+}
+
+// transferKeyInfo describes the transfer key of the vault
+type transferKeyInfo struct {
+	Fingerprint string    `json:"fingerprint" yaml:"fingerprint"`
+	Issued      time.Time `json:"issued" yaml:"issued"`
+	Expires     time.Time `json:"expires" yaml:"expires"`
+	Previous    int       `json:"previous" yaml:"previous"` // Replaced keys kept until they expire
+}
+
+// newTransferKeyInfo describes the current transfer key of the vault at
+// vaultRoot, or returns nil if it has none
+func newTransferKeyInfo(vaultRoot string) *transferKeyInfo {
+	transferKeys, err := p2p.LoadTransferKeys(vaultRoot)
+	if err != nil || len(transferKeys) == 0 {
+		return nil
+	}
+	cert := transferKeys[0].Certificate
+	return &transferKeyInfo{
+		Fingerprint: cert.Fingerprint(),
+		Issued:      cert.Issued,
+		Expires:     cert.Expires,
+		Previous:    len(transferKeys) - 1,
+	}
+}
+
+// verifyTransferKey checks that identity, the vault's sync public key,
+// signed its current transfer key
+func verifyTransferKey(vaultRoot string, identity *rsa.PublicKey) keyCheck {
+	check := keyCheck{Name: "transfer key", Status: keyCheckSkipped}
+	if identity == nil {
+		check.Detail = "no valid sync key pair"
+		return check
+	}
+	transferKeys, err := p2p.LoadTransferKeys(vaultRoot)
+	switch {
+	case err != nil:
+		check.Status, check.Detail = keyCheckFailed, err.Error()
+		return check
+	case len(transferKeys) == 0:
+		check.Detail = "none yet; the next sync makes one"
+		return check
+	}
+	cert := transferKeys[0].Certificate
+	certified, err := cert.Verify(identity, time.Now())
+	if err == nil && !certified.Equal(&transferKeys[0].PrivateKey.PublicKey) {
+		err = fmt.Errorf("transfer key does not match its certificate")
+	}
+	if err != nil {
+		check.Status, check.Detail = keyCheckFailed, err.Error()
+		return check
+	}
+	check.Status, check.Detail = keyCheckOK, fmt.Sprintf("%s, expires %s", cert.Fingerprint(), cert.Expires.Local().Format(time.RFC1123))
+	return check
+}
@@ -0,0 +1,113 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/lock"
+)
+
+// defaultLockWait is how long a command waits for another command's vault
+// lock unless --wait or --no-wait is given
+const defaultLockWait = 10 * time.Second
+
+// heldLocks are the vault locks held for the rest of the running command
+var heldLocks []*lock.Lock
+
+// requiresVaultLock reports whether cmd changes the vault it runs in and must
+// hold its lock while it runs
+func requiresVaultLock(cmd *cobra.Command) bool {
+	switch cmd {
+	case addCmd, deleteCmd, undeleteCmd, trashEmptyCmd, moveCmd, copyCmd, tagAddCmd, tagRemoveCmd, configSetCmd, repairCmd,
+		dedupGcCmd, dedupOptimizeCmd, dedupVerifyCmd, reindexCmd, migrateCmd, recoverCmd, syncCmd, sneakCmd,
+		syncNetworkKeyCmd, syncGroupAddCmd, syncGroupRemoveCmd, syncGroupAllowCmd, pairCmd, passwdCmd, keysImportCmd, keysRotateTransferCmd, peersRepinCmd, peersCheckCmd,
+		bundleApplyCmd, muleFetchCmd, recompressCmd, reencryptCmd, reshardCmd, parityBuildCmd, parityRepairCmd, scrubCmd:
+		return true
+	}
+	return false
+}
+
+// lockWorkingVault takes the lock of the vault containing the working
+// directory for commands that change it. Dry runs change nothing and are not
+// serialized.
+func lockWorkingVault(cmd *cobra.Command) error {
+	if !requiresVaultLock(cmd) {
+		return nil
+	}
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		return nil
+	}
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil || !fs.IsVaultInitialized(vaultRoot) {
+		// Let the command report that it is not inside a vault
+		return nil
+	}
+	return lockVault(cmd, vaultRoot)
+}
+
+// lockVault takes the lock of the vault at vaultRoot until the command exits
+func lockVault(cmd *cobra.Command, vaultRoot string) error {
+	l, err := acquireVaultLock(cmd, vaultRoot)
+	if err != nil {
+		return err
+	}
+	heldLocks = append(heldLocks, l)
+	return nil
+}
+
+// withVaultLock runs fn holding the lock of the vault at vaultRoot, for
+// commands such as browse that change the vault in only some of their actions
+func withVaultLock(cmd *cobra.Command, vaultRoot string, fn func() error) error {
+	l, err := acquireVaultLock(cmd, vaultRoot)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := l.Release(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}()
+	return fn()
+}
+
+// acquireVaultLock takes the lock of the vault at vaultRoot, waiting for it as
+// the --wait and --no-wait flags ask
+func acquireVaultLock(cmd *cobra.Command, vaultRoot string) (*lock.Lock, error) {
+	wait := defaultLockWait
+	if w, _ := cmd.Flags().GetBool("wait"); w {
+		wait = -1
+	}
+	if noWait, _ := cmd.Flags().GetBool("no-wait"); noWait {
+		wait = 0
+	}
+
+	l, err := lock.Acquire(vaultRoot, lock.Options{
+		Command: cmd.CommandPath(),
+		Wait:    wait,
+		OnWait: func(holder lock.Owner) {
+			fmt.Fprintf(os.Stderr, "Waiting for %s to finish with the vault...\n", holder)
+		},
+	})
+	if errors.Is(err, lock.ErrLocked) && wait >= 0 {
+		return nil, fmt.Errorf("%v; use --wait to wait until it finishes", err)
+	}
+	return l, err
+}
+
+// releaseVaultLocks releases every lock taken with lockVault
+func releaseVaultLocks() {
+	for i := len(heldLocks) - 1; i >= 0; i-- {
+		if err := heldLocks[i].Release(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	heldLocks = nil
+}
@@ -5,8 +5,12 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -30,18 +34,49 @@ This command displays information about files stored in your vault.
 By default, it shows files at the vault root, but you can specify a
 path within the vault to list files in that directory.
 
+The long format shows where each file came from: "local" for files added to
+this vault, or the peer, vault or bundle a sync copied it from. Structured
+output lists every sync that copied a file between vaults.
+
+Each listed file is checked against the chunk store. The long format shows
+its status: complete, partial when some chunks are missing, missing when none
+are stored, or pending-delete when a deletion received from a peer has not
+been applied yet. --missing-only lists just the files missing chunks, which
+is what an interrupted sync or an unmounted chunk store leaves behind.
+
+--chunks prints each file's chunk table instead: index, offset, sizes,
+compression, hashes, and flags for chunks that were deduplicated when the
+file was added, are shared with other files, or are missing from the chunk
+store. It is meant for debugging deduplication and sync, and combines with
+-o json for scripts.
+
+--limit and --offset page through large vaults. Sorting needs every manifest,
+but only offset+limit files are held at a time; --sort none instead lists
+files in the order they are stored, printing each as it is read and stopping
+once the page is full.
+
 Examples:
   sietch ls              # List all files in the vault
   sietch ls docs/        # List files in the docs directory
   sietch ls --long       # Show detailed file information
   sietch ls --tags       # Show file tags
-  sietch ls --sort=size  # Sort files by size`,
+  sietch ls --sort=size  # Sort files by size
+  sietch ls --tree       # Show the vault as a directory tree
+  sietch ls -l --missing-only   # Files whose chunks are not all stored locally
+  sietch ls --chunks docs/   # Show the chunk table of each file in docs
+  sietch ls --tag work --min-size 1MB              # Filter by tag and size
+  sietch ls --name '*.pdf' --modified-since 7d     # PDFs modified in the last week
+  sietch ls --sort=size --reverse                  # Smallest files first
+  sietch ls --sort=size --limit 20                 # The 20 largest files
+  sietch ls --limit 50 --offset 50                 # The second page of 50 files
+  sietch ls --sort none -o json                    # Stream every file as JSON
+  sietch ls -o json      # Emit the listing as JSON`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get filter path
 		filterPath := ""
 		if len(args) > 0 {
-			filterPath = args[0]
+			filterPath = fs.VaultPath(args[0])
 		}
 
 		// Find vault root
@@ -56,30 +91,151 @@ Examples:
 			return fmt.Errorf("failed to create vault manager: %v", err)
 		}
 
-		// Get the vault manifest
-		manifest, err := manager.GetManifest()
-		if err != nil {
-			return fmt.Errorf("failed to get vault manifest: %v", err)
-		}
-
 		// Get display options
 		long, _ := cmd.Flags().GetBool("long")
 		showTags, _ := cmd.Flags().GetBool("tags")
 		sortBy, _ := cmd.Flags().GetString("sort")
 		showDedup, _ := cmd.Flags().GetBool("dedup-stats")
+		showTree, _ := cmd.Flags().GetBool("tree")
+		showChunks, _ := cmd.Flags().GetBool("chunks")
+		missingOnly, _ := cmd.Flags().GetBool("missing-only")
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
 
-		// Filter and sort files
-		files := filterAndSortFiles(manifest.Files, filterPath, sortBy)
+		filterOpts, err := lsFilterOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		page, err := lsPageFromFlags(cmd, sortBy, filterOpts.Reverse)
+		if err != nil {
+			return err
+		}
 
-		// Build chunk -> files index only if dedup stats requested
+		// Dedup stats are relative to the whole vault, so they take a first pass.
+		// Structured output always carries them so scripts don't need a second pass.
 		var chunkRefs map[string][]string
-		if showDedup {
-			chunkRefs = buildChunkIndex(manifest.Files)
+		if showDedup || showChunks || format != outputTable {
+			chunkRefs = make(map[string][]string)
+			err := manager.WalkManifests(func(entry *config.ManifestEntry) error {
+				addToChunkIndex(chunkRefs, entry.Manifest)
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get vault manifest: %v", err)
+			}
+		}
+
+		// Compare the listed files against the chunk store
+		tombstones, err := manager.Tombstones()
+		if err != nil {
+			return fmt.Errorf("failed to read tombstones: %v", err)
+		}
+		stored := func(name string) bool {
+			exists, _ := manager.ChunkExists(name)
+			return exists
+		}
+		checker := newStatusChecker(tombstones, stored)
+
+		match := func(file *config.FileManifest) bool {
+			if filterPath != "" && !strings.HasPrefix(file.Destination, filterPath) {
+				return false
+			}
+			if !matchesLsFilters(*file, filterOpts) {
+				return false
+			}
+			return !missingOnly || checker.check(file).incomplete()
+		}
+
+		// Each file is printed as soon as its page position is known
+		shown, incomplete := 0, 0
+		var show func(file config.FileManifest, status fileStatus) error
+		var finish func() error
+		var treeFiles []config.FileManifest
+		switch {
+		case format != outputTable:
+			list, err := newStructuredList(os.Stdout, format)
+			if err != nil {
+				return err
+			}
+			show = func(file config.FileManifest, status fileStatus) error {
+				if showChunks {
+					return list.Add(buildChunkTables([]config.FileManifest{file}, chunkRefs, stored)[0])
+				}
+				out := buildLsOutput([]config.FileManifest{file}, chunkRefs)[0]
+				out.Status, out.MissingChunks = status.State, status.MissingChunks
+				return list.Add(out)
+			}
+			finish = list.Close
+		case showChunks:
+			show = func(file config.FileManifest, _ fileStatus) error {
+				if shown > 1 {
+					fmt.Println()
+				}
+				displayChunkTables(os.Stdout, buildChunkTables([]config.FileManifest{file}, chunkRefs, stored))
+				return nil
+			}
+		case showTree:
+			show = func(file config.FileManifest, _ fileStatus) error {
+				treeFiles = append(treeFiles, file)
+				return nil
+			}
+			finish = func() error {
+				if len(treeFiles) > 0 {
+					lsui.DisplayTree(treeFiles, showTags)
+				}
+				return nil
+			}
+		case long:
+			// The header waits for the first row, in case the page is empty
+			var lw *longFormatWriter
+			show = func(file config.FileManifest, status fileStatus) error {
+				if lw == nil {
+					lw = newLongFormatWriter(os.Stdout, showTags, showDedup, chunkRefs)
+				}
+				lw.Write(file, status)
+				return nil
+			}
+			finish = func() error {
+				if lw != nil {
+					lw.Flush()
+				}
+				return nil
+			}
+		default:
+			show = func(file config.FileManifest, _ fileStatus) error {
+				lsui.DisplayShortFormat([]config.FileManifest{file}, showTags, showDedup, chunkRefs)
+				return nil
+			}
 		}
 
-		// Display the files
-		if len(files) == 0 {
-			if filterPath != "" {
+		err = walkPage(manager.WalkManifests, match, page, func(file config.FileManifest) error {
+			shown++
+			status := checker.check(&file)
+			if status.incomplete() {
+				incomplete++
+			}
+			return show(file, status)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list files: %v", err)
+		}
+		if finish != nil {
+			if err := finish(); err != nil {
+				return err
+			}
+		}
+		if format != outputTable {
+			return nil
+		}
+
+		if shown == 0 {
+			if page.Offset > 0 {
+				fmt.Printf("No files past offset %d\n", page.Offset)
+			} else if missingOnly {
+				fmt.Println("No files are missing chunks")
+			} else if filterPath != "" {
 				fmt.Printf("No files found in '%s'\n", filterPath)
 			} else {
 				fmt.Println("No files found in vault")
@@ -87,106 +243,402 @@ Examples:
 			return nil
 		}
 
-		if long {
-			displayLongFormat(files, showTags, showDedup, chunkRefs)
-		} else {
-			lsui.DisplayShortFormat(files, showTags, showDedup, chunkRefs)
+		if incomplete > 0 && !long && !showChunks {
+			fmt.Printf("\n⚠️  %d file(s) are missing chunks locally; 'sietch ls --long --missing-only' lists them\n", incomplete)
 		}
-
 		return nil
 	},
 }
 
+// lsPageFromFlags reads --offset and --limit for a listing sorted by sortBy
+func lsPageFromFlags(cmd *cobra.Command, sortBy string, reverse bool) (lsPage, error) {
+	page := lsPage{SortBy: sortBy, Reverse: reverse}
+	page.Offset, _ = cmd.Flags().GetInt("offset")
+	page.Limit, _ = cmd.Flags().GetInt("limit")
+	if page.Offset < 0 {
+		return page, fmt.Errorf("--offset cannot be negative")
+	}
+	if page.Limit < 0 {
+		return page, fmt.Errorf("--limit cannot be negative")
+	}
+	if page.streams() && reverse {
+		return page, fmt.Errorf("--reverse needs a sort order, it cannot be used with --sort none")
+	}
+	return page, nil
+}
+
+// lsFilterOptions holds the optional filters applied by filterAndSortFiles.
+// Zero values disable the corresponding filter.
+type lsFilterOptions struct {
+	Tags           []string  // File must carry every tag listed
+	MinSize        int64     // Minimum file size in bytes (inclusive)
+	MaxSize        int64     // Maximum file size in bytes (inclusive)
+	ModifiedSince  time.Time // File must be modified at or after this time
+	ModifiedBefore time.Time // File must be modified before this time
+	NamePattern    string    // Glob matched against the file name
+	Reverse        bool      // Reverse the final sort order
+}
+
 // Filter files by path and sort them according to the specified criteria
-func filterAndSortFiles(files []config.FileManifest, filterPath, sortBy string) []config.FileManifest {
+func filterAndSortFiles(files []config.FileManifest, filterPath, sortBy string, opts lsFilterOptions) []config.FileManifest {
 	// Filter files
 	var filtered []config.FileManifest
 	for _, file := range files {
-		if filterPath == "" || strings.HasPrefix(file.Destination, filterPath) {
-			filtered = append(filtered, file)
+		if filterPath != "" && !strings.HasPrefix(file.Destination, filterPath) {
+			continue
+		}
+		if !matchesLsFilters(file, opts) {
+			continue
 		}
+		filtered = append(filtered, file)
 	}
 
-	// Sort files
+	sortFiles(filtered, sortBy, opts.Reverse)
+	return filtered
+}
+
+// sortFiles sorts files in place by name, size, time, or by default path.
+// Files that compare equal are ordered by vault path, so that the files of
+// a page do not depend on the order manifests were read in. "none" keeps
+// the order.
+func sortFiles(files []config.FileManifest, sortBy string, reverse bool) {
+	var less func(a, b *config.FileManifest) bool
 	switch strings.ToLower(sortBy) {
+	case "none":
+		return
 	case "name":
-		sort.Slice(filtered, func(i, j int) bool {
-			return filtered[i].FilePath < filtered[j].FilePath
-		})
+		less = func(a, b *config.FileManifest) bool { return a.FilePath < b.FilePath }
 	case "size":
-		sort.Slice(filtered, func(i, j int) bool {
-			return filtered[i].Size > filtered[j].Size
-		})
+		less = func(a, b *config.FileManifest) bool { return a.Size > b.Size }
 	case "time":
-		sort.Slice(filtered, func(i, j int) bool {
-			timeI, _ := time.Parse(time.RFC3339, filtered[i].ModTime)
-			timeJ, _ := time.Parse(time.RFC3339, filtered[j].ModTime)
-			return timeI.After(timeJ)
-		})
+		less = func(a, b *config.FileManifest) bool {
+			timeA, _ := time.Parse(time.RFC3339, a.ModTime)
+			timeB, _ := time.Parse(time.RFC3339, b.ModTime)
+			return timeA.After(timeB)
+		}
 	default:
 		// Default sort by path
-		sort.Slice(filtered, func(i, j int) bool {
-			return filtered[i].Destination < filtered[j].Destination
-		})
+		less = func(a, b *config.FileManifest) bool { return a.Destination < b.Destination }
 	}
 
-	return filtered
+	sort.Slice(files, func(i, j int) bool {
+		a, b := &files[i], &files[j]
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.Destination+a.FilePath < b.Destination+b.FilePath
+	})
+	if reverse {
+		slices.Reverse(files)
+	}
+}
+
+// matchesLsFilters reports whether file passes every filter set in opts
+func matchesLsFilters(file config.FileManifest, opts lsFilterOptions) bool {
+	for _, tag := range opts.Tags {
+		if !slices.Contains(file.Tags, tag) {
+			return false
+		}
+	}
+
+	if opts.MinSize > 0 && file.Size < opts.MinSize {
+		return false
+	}
+	if opts.MaxSize > 0 && file.Size > opts.MaxSize {
+		return false
+	}
+
+	if !opts.ModifiedSince.IsZero() || !opts.ModifiedBefore.IsZero() {
+		modTime, err := time.Parse(time.RFC3339, file.ModTime)
+		if err != nil {
+			return false
+		}
+		if !opts.ModifiedSince.IsZero() && modTime.Before(opts.ModifiedSince) {
+			return false
+		}
+		if !opts.ModifiedBefore.IsZero() && !modTime.Before(opts.ModifiedBefore) {
+			return false
+		}
+	}
+
+	if opts.NamePattern != "" {
+		matched, err := path.Match(opts.NamePattern, path.Base(file.FilePath))
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lsFilterOptionsFromFlags builds filter options from the ls command flags
+func lsFilterOptionsFromFlags(cmd *cobra.Command) (lsFilterOptions, error) {
+	var opts lsFilterOptions
+
+	tags, _ := cmd.Flags().GetStringSlice("tag")
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			opts.Tags = append(opts.Tags, tag)
+		}
+	}
+
+	if v, _ := cmd.Flags().GetString("min-size"); v != "" {
+		size, err := util.ParseChunkSize(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --min-size: %v", err)
+		}
+		opts.MinSize = size
+	}
+	if v, _ := cmd.Flags().GetString("max-size"); v != "" {
+		size, err := util.ParseChunkSize(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --max-size: %v", err)
+		}
+		opts.MaxSize = size
+	}
+	if opts.MinSize > 0 && opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return opts, fmt.Errorf("--min-size cannot be greater than --max-size")
+	}
+
+	now := time.Now()
+	if v, _ := cmd.Flags().GetString("modified-since"); v != "" {
+		t, err := parseTimeFilter(v, now)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --modified-since: %v", err)
+		}
+		opts.ModifiedSince = t
+	}
+	if v, _ := cmd.Flags().GetString("modified-before"); v != "" {
+		t, err := parseTimeFilter(v, now)
+		if err != nil {
+			return opts, fmt.Errorf("invalid --modified-before: %v", err)
+		}
+		opts.ModifiedBefore = t
+	}
+
+	opts.NamePattern, _ = cmd.Flags().GetString("name")
+	if opts.NamePattern != "" {
+		if _, err := path.Match(opts.NamePattern, ""); err != nil {
+			return opts, fmt.Errorf("invalid --name pattern: %v", err)
+		}
+	}
+
+	opts.Reverse, _ = cmd.Flags().GetBool("reverse")
+	return opts, nil
+}
+
+// parseTimeFilter accepts an RFC3339 timestamp, a YYYY-MM-DD date, or a relative
+// age such as 36h or 7d (interpreted as that long before now)
+func parseTimeFilter(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized time '%s' (use RFC3339, YYYY-MM-DD, or a relative age like 7d or 12h)", value)
 }
 
 // Display files in long format with detailed information
 // showDedup = whether to include dedup stats; chunkRefs is map[chunkID][]filePaths
-func displayLongFormat(files []config.FileManifest, showTags, showDedup bool, chunkRefs map[string][]string) {
+// statuses holds the local state of each file by vault path, see fileStatuses
+func displayLongFormat(files []config.FileManifest, showTags, showDedup bool, chunkRefs map[string][]string, statuses map[string]fileStatus) {
+	lw := newLongFormatWriter(os.Stdout, showTags, showDedup, chunkRefs)
+	for _, file := range files {
+		lw.Write(file, statuses[file.Destination+file.FilePath])
+	}
+	lw.Flush()
+}
+
+// longFormatRows is how many rows the long format aligns at a time. Columns
+// may shift between blocks, but rows print without waiting for the whole
+// listing.
+const longFormatRows = 1000
+
+// longFormatWriter prints files in the long format as they are listed
+type longFormatWriter struct {
+	w                   *tabwriter.Writer
+	showTags, showDedup bool
+	chunkRefs           map[string][]string
+	rows                int
+}
+
+// newLongFormatWriter prints the long format header to out
+func newLongFormatWriter(out io.Writer, showTags, showDedup bool, chunkRefs map[string][]string) *longFormatWriter {
 	// Create a tabwriter for aligned columns
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	defer w.Flush()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
 
 	// Print header
 	if showTags {
-		fmt.Fprintln(w, "SIZE\tMODIFIED\tCHUNKS\tPATH\tTAGS")
+		fmt.Fprintln(w, "SIZE\tMODIFIED\tCHUNKS\tSTATUS\tORIGIN\tPATH\tTAGS")
 	} else {
-		fmt.Fprintln(w, "SIZE\tMODIFIED\tCHUNKS\tPATH")
+		fmt.Fprintln(w, "SIZE\tMODIFIED\tCHUNKS\tSTATUS\tORIGIN\tPATH")
 	}
+	return &longFormatWriter{w: w, showTags: showTags, showDedup: showDedup, chunkRefs: chunkRefs}
+}
 
-	// Print each file
-	for _, file := range files {
-		// Parse and format time
-		modTime, _ := time.Parse(time.RFC3339, file.ModTime)
-		timeFormat := modTime.Format("2006-01-02 15:04:05")
-
-		// Format output
-		if showTags {
-			tags := strings.Join(file.Tags, ", ")
-			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
-				util.HumanReadableSize(file.Size),
-				timeFormat,
-				len(file.Chunks),
-				file.Destination+file.FilePath,
-				tags)
+// Flush prints the rows that are still buffered for alignment
+func (lw *longFormatWriter) Flush() {
+	lw.w.Flush()
+}
+
+// Write prints the row of file, whose local state is fileStatus
+func (lw *longFormatWriter) Write(file config.FileManifest, fileStatus fileStatus) {
+	w, showTags, showDedup, chunkRefs := lw.w, lw.showTags, lw.showDedup, lw.chunkRefs
+	lw.rows++
+
+	// Parse and format time
+	modTime, _ := time.Parse(time.RFC3339, file.ModTime)
+	timeFormat := modTime.Format("2006-01-02 15:04:05")
+	status := describeStatus(fileStatus, len(file.Chunks))
+
+	// Format output
+	if showTags {
+		tags := strings.Join(file.Tags, ", ")
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			util.HumanReadableSize(file.Size),
+			timeFormat,
+			len(file.Chunks),
+			status,
+			describeOrigin(file.Origin()),
+			file.Destination+file.FilePath,
+			tags)
+	} else {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			util.HumanReadableSize(file.Size),
+			timeFormat,
+			len(file.Chunks),
+			status,
+			describeOrigin(file.Origin()),
+			file.Destination+file.FilePath)
+	}
+
+	// Dedup stats (print an indented stats line after the file line)
+	if showDedup && chunkRefs != nil {
+		sharedChunks, savedBytes, sharedWith := deduplication.ComputeDedupStatsForFile(file, chunkRefs)
+		// Format saved size
+		savedStr := util.HumanReadableSize(savedBytes)
+		// Format shared_with string with truncation
+		sharedWithStr := lsui.FormatSharedWith(sharedWith, 10)
+		// Print as indented info (not part of the tabwriter)
+		if len(sharedWith) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "", "", "", "", "", "") // ensure tabwriter alignment
+			fmt.Fprintf(w, "    shared_chunks: %d\t saved: %s\n", sharedChunks, savedStr)
 		} else {
-			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n",
-				util.HumanReadableSize(file.Size),
-				timeFormat,
-				len(file.Chunks),
-				file.Destination+file.FilePath)
-		}
-
-		// Dedup stats (print an indented stats line after the file line)
-		if showDedup && chunkRefs != nil {
-			sharedChunks, savedBytes, sharedWith := deduplication.ComputeDedupStatsForFile(file, chunkRefs)
-			// Format saved size
-			savedStr := util.HumanReadableSize(savedBytes)
-			// Format shared_with string with truncation
-			sharedWithStr := lsui.FormatSharedWith(sharedWith, 10)
-			// Print as indented info (not part of the tabwriter)
-			if len(sharedWith) == 0 {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "", "", "", "") // ensure tabwriter alignment
-				fmt.Fprintf(w, "    shared_chunks: %d\t saved: %s\n", sharedChunks, savedStr)
-			} else {
-				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "", "", "", "") // alignment spacer
-				fmt.Fprintf(w, "    shared_chunks: %d\t saved: %s\t shared_with: %s\n", sharedChunks, savedStr, sharedWithStr)
-			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", "", "", "", "", "", "") // alignment spacer
+			fmt.Fprintf(w, "    shared_chunks: %d\t saved: %s\t shared_with: %s\n", sharedChunks, savedStr, sharedWithStr)
 		}
 	}
+
+	if lw.rows%longFormatRows == 0 {
+		w.Flush()
+	}
+}
+
+// lsFileOutput is the structured (json/yaml) representation of a listed file
+type lsFileOutput struct {
+	Path        string        `json:"path" yaml:"path"`
+	Size        int64         `json:"size" yaml:"size"`
+	ModTime     string        `json:"mtime" yaml:"mtime"`
+	Chunks      int           `json:"chunks" yaml:"chunks"`
+	Tags        []string      `json:"tags" yaml:"tags"`
+	ContentHash string        `json:"content_hash,omitempty" yaml:"content_hash,omitempty"`
+	AddedAt     time.Time     `json:"added_at" yaml:"added_at"`
+	Dedup       lsDedupOutput `json:"dedup" yaml:"dedup"`
+
+	// Local state of the file, see fileStatuses
+	Status        string `json:"status" yaml:"status"`
+	MissingChunks int    `json:"missing_chunks,omitempty" yaml:"missing_chunks,omitempty"`
+
+	// Syncs that copied the file between vaults, oldest first; the last one
+	// brought it to this vault. Empty for files added here.
+	Provenance []syncOriginOutput `json:"provenance,omitempty" yaml:"provenance,omitempty"`
+}
+
+// syncOriginOutput is the structured representation of a sync that copied a file
+type syncOriginOutput struct {
+	Kind     string    `json:"kind" yaml:"kind"`
+	Source   string    `json:"source" yaml:"source"`
+	Name     string    `json:"name,omitempty" yaml:"name,omitempty"`
+	Session  string    `json:"session" yaml:"session"`
+	SyncedAt time.Time `json:"synced_at" yaml:"synced_at"`
+}
+
+// newProvenanceOutput converts the provenance of a manifest for structured output
+func newProvenanceOutput(provenance []config.SyncOrigin) []syncOriginOutput {
+	var out []syncOriginOutput
+	for _, origin := range provenance {
+		out = append(out, syncOriginOutput(origin))
+	}
+	return out
+}
+
+// describeOrigin names where a file came from for listings: "local" for
+// files added to this vault, otherwise the kind and source of the sync
+func describeOrigin(origin *config.SyncOrigin) string {
+	if origin == nil {
+		return "local"
+	}
+	source := origin.Name
+	if source == "" {
+		source = origin.Source
+	}
+	if origin.Kind == "peer" && origin.Name == "" && len(source) > 12 {
+		// Peer IDs share their first characters; the end tells them apart
+		source = "…" + source[len(source)-8:]
+	}
+	return origin.Kind + " " + source
+}
+
+// lsDedupOutput holds per-file deduplication statistics for structured output
+type lsDedupOutput struct {
+	SharedChunks int      `json:"shared_chunks" yaml:"shared_chunks"`
+	SavedBytes   int64    `json:"saved_bytes" yaml:"saved_bytes"`
+	SharedWith   []string `json:"shared_with" yaml:"shared_with"`
+}
+
+// buildLsOutput converts manifests into their structured representation
+func buildLsOutput(files []config.FileManifest, chunkRefs map[string][]string) []lsFileOutput {
+	out := make([]lsFileOutput, 0, len(files))
+	for _, file := range files {
+		sharedChunks, savedBytes, sharedWith := deduplication.ComputeDedupStatsForFile(file, chunkRefs)
+		if sharedWith == nil {
+			sharedWith = []string{}
+		}
+		tags := file.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		out = append(out, lsFileOutput{
+			Path:        file.Destination + file.FilePath,
+			Size:        file.Size,
+			ModTime:     file.ModTime,
+			Chunks:      len(file.Chunks),
+			Tags:        tags,
+			ContentHash: file.ContentHash,
+			AddedAt:     file.AddedAt,
+			Dedup: lsDedupOutput{
+				SharedChunks: sharedChunks,
+				SavedBytes:   savedBytes,
+				SharedWith:   sharedWith,
+			},
+			Provenance: newProvenanceOutput(file.Provenance),
+		})
+	}
+	return out
 }
 
 // buildChunkIndex creates a mapping chunkID -> []filePaths using the manifest file list.
@@ -194,31 +646,50 @@ func displayLongFormat(files []config.FileManifest, showTags, showDedup bool, ch
 func buildChunkIndex(files []config.FileManifest) map[string][]string {
 	chunkRefs := make(map[string][]string)
 	for _, f := range files {
-		fp := f.Destination + f.FilePath
-		for _, c := range f.Chunks {
-			// use the Hash field as the chunk identifier
-			chunkID := c.Hash
-			if chunkID == "" {
-				// fallback: if Hash is empty, use EncryptedHash
-				chunkID = c.EncryptedHash
-			}
-			if chunkID == "" {
-				// skip weird entries
-				continue
-			}
-			chunkRefs[chunkID] = append(chunkRefs[chunkID], fp)
-		}
+		addToChunkIndex(chunkRefs, f)
 	}
 	return chunkRefs
 }
 
+// addToChunkIndex adds the chunks of f to a chunk index, see buildChunkIndex
+func addToChunkIndex(chunkRefs map[string][]string, f config.FileManifest) {
+	fp := f.Destination + f.FilePath
+	for _, c := range f.Chunks {
+		// use the Hash field as the chunk identifier
+		chunkID := c.Hash
+		if chunkID == "" {
+			// fallback: if Hash is empty, use EncryptedHash
+			chunkID = c.EncryptedHash
+		}
+		if chunkID == "" {
+			// skip weird entries
+			continue
+		}
+		chunkRefs[chunkID] = append(chunkRefs[chunkID], fp)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(lsCmd)
 
+	lsCmd.ValidArgsFunction = completeVaultDirs
+
 	// Add flags
 	lsCmd.Flags().BoolP("long", "l", false, "Use long listing format")
+	lsCmd.Flags().Bool("missing-only", false, "Only show files with chunks missing from the local chunk store")
+	lsCmd.Flags().Bool("chunks", false, "Print the chunk table of each file, for debugging deduplication and sync")
 	lsCmd.Flags().BoolP("tags", "t", false, "Show file tags")
-	lsCmd.Flags().StringP("sort", "s", "path", "Sort by: name, size, time, path")
+	lsCmd.Flags().StringP("sort", "s", "path", "Sort by: name, size, time, path, or none to stream files in manifest order")
+	lsCmd.Flags().Int("limit", 0, "Show at most this many files (0 shows all)")
+	lsCmd.Flags().Int("offset", 0, "Skip this many files before showing any")
+	lsCmd.Flags().BoolP("reverse", "r", false, "Reverse the sort order")
+	lsCmd.Flags().StringSlice("tag", []string{}, "Only show files carrying all of these tags (repeatable or comma-separated)")
+	lsCmd.Flags().String("min-size", "", "Only show files at least this size (e.g. 10KB, 1MB)")
+	lsCmd.Flags().String("max-size", "", "Only show files at most this size (e.g. 500MB)")
+	lsCmd.Flags().String("modified-since", "", "Only show files modified since this time (RFC3339, YYYY-MM-DD, or age like 7d)")
+	lsCmd.Flags().String("modified-before", "", "Only show files modified before this time (RFC3339, YYYY-MM-DD, or age like 7d)")
+	lsCmd.Flags().String("name", "", "Only show files whose name matches this glob pattern (e.g. '*.pdf')")
+	lsCmd.Flags().Bool("tree", false, "Display files as a directory tree with per-directory sizes and counts")
 
 	// New dedup-stats flag
 	lsCmd.Flags().BoolP("dedup-stats", "d", false, "Show per-file deduplication statistics")
@@ -0,0 +1,125 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// lsChunkFileOutput is the structured representation of a file's chunk table
+type lsChunkFileOutput struct {
+	Path   string          `json:"path" yaml:"path"`
+	Size   int64           `json:"size" yaml:"size"`
+	Chunks []lsChunkOutput `json:"chunks" yaml:"chunks"`
+}
+
+// lsChunkOutput describes one chunk reference of a file
+type lsChunkOutput struct {
+	Index          int    `json:"index" yaml:"index"`
+	Offset         int64  `json:"offset" yaml:"offset"`
+	Hash           string `json:"hash" yaml:"hash"`
+	EncryptedHash  string `json:"encrypted_hash,omitempty" yaml:"encrypted_hash,omitempty"`
+	StorageName    string `json:"storage_name" yaml:"storage_name"` // File name in the chunk store
+	Size           int64  `json:"size" yaml:"size"`
+	CompressedSize int64  `json:"compressed_size,omitempty" yaml:"compressed_size,omitempty"`
+	EncryptedSize  int64  `json:"encrypted_size,omitempty" yaml:"encrypted_size,omitempty"`
+	Compression    string `json:"compression" yaml:"compression"`
+	Deduplicated   bool   `json:"deduplicated" yaml:"deduplicated"` // Reused a chunk already stored when the file was added
+	References     int    `json:"references" yaml:"references"`     // Chunk references across the vault, this one included
+	Stored         bool   `json:"stored" yaml:"stored"`             // Present in the chunk store
+}
+
+// buildChunkTables describes the chunks of files. chunkRefs is the chunk
+// index of the whole vault and stored reports whether a chunk is in the store.
+func buildChunkTables(files []config.FileManifest, chunkRefs map[string][]string, stored func(name string) bool) []lsChunkFileOutput {
+	out := make([]lsChunkFileOutput, 0, len(files))
+	for _, file := range files {
+		table := lsChunkFileOutput{Path: file.Destination + file.FilePath, Size: file.Size, Chunks: []lsChunkOutput{}}
+		for _, ref := range file.Chunks {
+			compression := ref.CompressionType
+			if compression == "" {
+				compression = "none"
+			}
+			id := ref.Hash
+			if id == "" {
+				id = ref.EncryptedHash
+			}
+			name := chunk.StorageName(ref)
+			table.Chunks = append(table.Chunks, lsChunkOutput{
+				Index:          ref.Index,
+				Offset:         ref.Offset,
+				Hash:           ref.Hash,
+				EncryptedHash:  ref.EncryptedHash,
+				StorageName:    name,
+				Size:           ref.Size,
+				CompressedSize: ref.CompressedSize,
+				EncryptedSize:  ref.EncryptedSize,
+				Compression:    compression,
+				Deduplicated:   ref.Deduplicated,
+				References:     len(chunkRefs[id]),
+				Stored:         name != "" && stored(name),
+			})
+		}
+		out = append(out, table)
+	}
+	return out
+}
+
+// displayChunkTables prints the chunk table of each file
+func displayChunkTables(w io.Writer, tables []lsChunkFileOutput) {
+	for i, table := range tables {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%d bytes, %d chunks)\n", table.Path, table.Size, len(table.Chunks))
+		if len(table.Chunks) == 0 {
+			continue
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  INDEX\tOFFSET\tSIZE\tCOMPRESSED\tENCRYPTED\tCOMPRESSION\tHASH\tENCRYPTED HASH\tFLAGS")
+		for _, c := range table.Chunks {
+			encryptedHash := c.EncryptedHash
+			if encryptedHash == "" {
+				encryptedHash = "-"
+			}
+			fmt.Fprintf(tw, "  %d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				c.Index, c.Offset, c.Size, optionalSize(c.CompressedSize), optionalSize(c.EncryptedSize),
+				c.Compression, c.Hash, encryptedHash, chunkFlags(c))
+		}
+		tw.Flush()
+	}
+}
+
+// optionalSize formats a size that is only recorded for some chunks
+func optionalSize(size int64) string {
+	if size == 0 {
+		return "-"
+	}
+	return fmt.Sprint(size)
+}
+
+// chunkFlags summarizes the dedup and storage state of a chunk
+func chunkFlags(c lsChunkOutput) string {
+	var flags []string
+	if c.Deduplicated {
+		flags = append(flags, "dedup")
+	}
+	if c.References > 1 {
+		flags = append(flags, fmt.Sprintf("shared(%d)", c.References))
+	}
+	if !c.Stored {
+		flags = append(flags, "missing")
+	}
+	if len(flags) == 0 {
+		return "-"
+	}
+	return strings.Join(flags, ",")
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestBuildChunkTables(t *testing.T) {
+	shared := config.ChunkRef{Hash: "shared", EncryptedHash: "enc-shared", Size: 10, Compressed: true, CompressionType: "zstd", CompressedSize: 6}
+	a := createTestManifest("a.txt", "docs/", 20, []config.ChunkRef{
+		shared,
+		{Hash: "only-a", Index: 1, Offset: 10, Size: 10},
+	})
+	b := createTestManifest("b.txt", "docs/", 10, []config.ChunkRef{shared})
+	b.Chunks[0].Deduplicated = true
+	files := []config.FileManifest{a, b}
+
+	stored := func(name string) bool { return name == "enc-shared" }
+	tables := buildChunkTables(files, buildChunkIndex(files), stored)
+	if len(tables) != 2 || tables[0].Path != "docs/a.txt" || len(tables[0].Chunks) != 2 {
+		t.Fatalf("unexpected tables %+v", tables)
+	}
+	first, second := tables[0].Chunks[0], tables[0].Chunks[1]
+	if first.StorageName != "enc-shared" || first.References != 2 || !first.Stored || first.Compression != "zstd" {
+		t.Errorf("unexpected shared chunk %+v", first)
+	}
+	if second.StorageName != "only-a" || second.References != 1 || second.Stored || second.Compression != "none" || second.Offset != 10 {
+		t.Errorf("unexpected unshared chunk %+v", second)
+	}
+	if !tables[1].Chunks[0].Deduplicated {
+		t.Error("expected the dedup flag of b.txt's chunk")
+	}
+
+	var out bytes.Buffer
+	displayChunkTables(&out, tables)
+	for _, want := range []string{"docs/a.txt (20 bytes, 2 chunks)", "ENCRYPTED HASH", "shared(2)", "missing", "dedup,shared(2)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
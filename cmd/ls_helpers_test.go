@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -74,19 +75,19 @@ func TestFilterAndSortFiles_Basic(t *testing.T) {
 	files := []config.FileManifest{f1, f2, f3}
 
 	// sort by name
-	out := filterAndSortFiles(files, "", "name")
+	out := filterAndSortFiles(files, "", "name", lsFilterOptions{})
 	if out[0].FilePath != "a.txt" || out[1].FilePath != "b.txt" || out[2].FilePath != "c.txt" {
 		t.Fatalf("unexpected order by name: %v", []string{out[0].FilePath, out[1].FilePath, out[2].FilePath})
 	}
 
 	// sort by size (desc)
-	out = filterAndSortFiles(files, "", "size")
+	out = filterAndSortFiles(files, "", "size", lsFilterOptions{})
 	if out[0].Size < out[1].Size || out[1].Size < out[2].Size {
 		t.Fatalf("unexpected order by size: %v", []int64{out[0].Size, out[1].Size, out[2].Size})
 	}
 
 	// filter by destination prefix
-	out = filterAndSortFiles(files, "docs/", "path")
+	out = filterAndSortFiles(files, "docs/", "path", lsFilterOptions{})
 	if len(out) != 2 {
 		t.Fatalf("expected 2 files in docs/, got %d", len(out))
 	}
@@ -202,7 +203,7 @@ func TestDisplayShortAndLongFormat_OutputContainsStats(t *testing.T) {
 
 	// long format capture
 	outLong := captureStdout(t, func() {
-		displayLongFormat(files, false, true, chunkRefs)
+		displayLongFormat(files, false, true, chunkRefs, nil)
 	})
 	if !strings.Contains(outLong, "SIZE") || !strings.Contains(outLong, "shared_chunks:") {
 		t.Fatalf("long output missing dedup info: %s", outLong)
@@ -252,7 +253,7 @@ func TestBuildChunkIndex_DeterministicOrder(t *testing.T) {
 
 func TestFilterAndSortFiles_EmptyInput(t *testing.T) {
 	var empty []config.FileManifest
-	out := filterAndSortFiles(empty, "", "path")
+	out := filterAndSortFiles(empty, "", "path", lsFilterOptions{})
 	if len(out) != 0 {
 		t.Fatalf("expected 0 files from empty input, got %d", len(out))
 	}
@@ -263,7 +264,7 @@ func TestFilterAndSortFiles_NoMatches(t *testing.T) {
 	f2 := createTestManifest("b.txt", "data/", 200, nil)
 	files := []config.FileManifest{f1, f2}
 
-	out := filterAndSortFiles(files, "images/", "path")
+	out := filterAndSortFiles(files, "images/", "path", lsFilterOptions{})
 	if len(out) != 0 {
 		t.Fatalf("expected 0 files matching 'images/', got %d", len(out))
 	}
@@ -293,25 +294,25 @@ func TestFilterAndSortFiles_AllSortTypes(t *testing.T) {
 	files := []config.FileManifest{f1, f2, f3}
 
 	// Test sort by name
-	byName := filterAndSortFiles(files, "", "name")
+	byName := filterAndSortFiles(files, "", "name", lsFilterOptions{})
 	if byName[0].FilePath != "alpha.txt" || byName[1].FilePath != "beta.txt" || byName[2].FilePath != "zebra.txt" {
 		t.Fatalf("sort by name failed: %v", []string{byName[0].FilePath, byName[1].FilePath, byName[2].FilePath})
 	}
 
 	// Test sort by size (descending)
-	bySize := filterAndSortFiles(files, "", "size")
+	bySize := filterAndSortFiles(files, "", "size", lsFilterOptions{})
 	if bySize[0].Size != 200 || bySize[1].Size != 100 || bySize[2].Size != 50 {
 		t.Fatalf("sort by size failed: %v", []int64{bySize[0].Size, bySize[1].Size, bySize[2].Size})
 	}
 
 	// Test sort by time (most recent first)
-	byTime := filterAndSortFiles(files, "", "time")
+	byTime := filterAndSortFiles(files, "", "time", lsFilterOptions{})
 	if byTime[0].FilePath != "beta.txt" || byTime[1].FilePath != "alpha.txt" || byTime[2].FilePath != "zebra.txt" {
 		t.Fatalf("sort by time failed: %v", []string{byTime[0].FilePath, byTime[1].FilePath, byTime[2].FilePath})
 	}
 
 	// Test default/path sort
-	byPath := filterAndSortFiles(files, "", "unknown")
+	byPath := filterAndSortFiles(files, "", "unknown", lsFilterOptions{})
 	// All have same destination, so order by destination comparison
 	if len(byPath) != 3 {
 		t.Fatalf("default sort failed, expected 3 files got %d", len(byPath))
@@ -325,7 +326,7 @@ func TestFilterAndSortFiles_PartialPathMatch(t *testing.T) {
 	files := []config.FileManifest{f1, f2, f3}
 
 	// Filter by "docs/" should match both docs/ and docs/subdir/
-	out := filterAndSortFiles(files, "docs/", "path")
+	out := filterAndSortFiles(files, "docs/", "path", lsFilterOptions{})
 	if len(out) != 2 {
 		t.Fatalf("expected 2 files with prefix 'docs/', got %d", len(out))
 	}
@@ -338,7 +339,7 @@ func TestFilterAndSortFiles_CaseInsensitiveSort(t *testing.T) {
 	// Test various case combinations for sort parameter
 	testCases := []string{"NAME", "Size", "TIME", "Path"}
 	for _, sortBy := range testCases {
-		out := filterAndSortFiles(files, "", sortBy)
+		out := filterAndSortFiles(files, "", sortBy, lsFilterOptions{})
 		if len(out) != 1 {
 			t.Fatalf("sort by '%s' failed, expected 1 file got %d", sortBy, len(out))
 		}
@@ -441,7 +442,7 @@ func TestBuildChunkIndex_FullPathConstruction(t *testing.T) {
 func TestDisplayLongFormat_EmptyFileList(t *testing.T) {
 	var empty []config.FileManifest
 	out := captureStdout(t, func() {
-		displayLongFormat(empty, false, false, nil)
+		displayLongFormat(empty, false, false, nil, nil)
 	})
 	// Should only contain header
 	if !strings.Contains(out, "SIZE") || !strings.Contains(out, "MODIFIED") {
@@ -459,7 +460,7 @@ func TestDisplayLongFormat_WithTags(t *testing.T) {
 	files := []config.FileManifest{f1}
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, true, false, nil)
+		displayLongFormat(files, true, false, nil, nil)
 	})
 
 	if !strings.Contains(out, "TAGS") {
@@ -470,12 +471,32 @@ func TestDisplayLongFormat_WithTags(t *testing.T) {
 	}
 }
 
+func TestDisplayLongFormat_Origin(t *testing.T) {
+	local := createTestManifest("local.txt", "test/", 100, nil)
+	synced := createTestManifest("synced.txt", "test/", 100, nil)
+	synced.Provenance = []config.SyncOrigin{
+		{Kind: "peer", Source: "12D3KooWFirstPeerIDAbcdefgh", Session: "s1"},
+		{Kind: "peer", Source: "12D3KooWSecondPeerID12345678", Name: "laptop", Session: "s2"},
+	}
+
+	out := captureStdout(t, func() {
+		displayLongFormat([]config.FileManifest{local, synced}, false, false, nil, nil)
+	})
+
+	if !strings.Contains(out, "ORIGIN") || !strings.Contains(out, "local") || !strings.Contains(out, "peer laptop") {
+		t.Fatalf("expected the origin of each file, got: %s", out)
+	}
+	if got := describeOrigin(&config.SyncOrigin{Kind: "peer", Source: "12D3KooWFirstPeerIDAbcdefgh"}); got != "peer …Abcdefgh" {
+		t.Errorf("describeOrigin of an unnamed peer = %q", got)
+	}
+}
+
 func TestDisplayLongFormat_WithoutTags(t *testing.T) {
 	f1 := createTestManifest("file.txt", "test/", 100, nil)
 	files := []config.FileManifest{f1}
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, false, nil)
+		displayLongFormat(files, false, false, nil, nil)
 	})
 
 	if strings.Contains(out, "TAGS") {
@@ -488,7 +509,7 @@ func TestDisplayLongFormat_HeaderVerification(t *testing.T) {
 	files := []config.FileManifest{f1}
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, false, nil)
+		displayLongFormat(files, false, false, nil, nil)
 	})
 
 	requiredHeaders := []string{"SIZE", "MODIFIED", "CHUNKS", "PATH"}
@@ -510,7 +531,7 @@ func TestDisplayLongFormat_TimeFormatting(t *testing.T) {
 	files := []config.FileManifest{f1}
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, false, nil)
+		displayLongFormat(files, false, false, nil, nil)
 	})
 
 	// Check for expected time format: "2006-01-02 15:04:05"
@@ -530,7 +551,7 @@ func TestDisplayLongFormat_ChunkCount(t *testing.T) {
 	files := []config.FileManifest{f1}
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, false, nil)
+		displayLongFormat(files, false, false, nil, nil)
 	})
 
 	// Should show chunk count of 3
@@ -546,7 +567,7 @@ func TestDisplayLongFormat_DedupWithNoSharing(t *testing.T) {
 	chunkRefs := buildChunkIndex(files)
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, true, chunkRefs)
+		displayLongFormat(files, false, true, chunkRefs, nil)
 	})
 
 	if !strings.Contains(out, "shared_chunks: 0") {
@@ -565,7 +586,7 @@ func TestDisplayLongFormat_DedupWithSharing(t *testing.T) {
 	chunkRefs := buildChunkIndex(files)
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, true, chunkRefs)
+		displayLongFormat(files, false, true, chunkRefs, nil)
 	})
 
 	if !strings.Contains(out, "shared_chunks:") {
@@ -582,7 +603,7 @@ func TestDisplayLongFormat_NilChunkRefsWithDedupFlag(t *testing.T) {
 
 	// Should not panic with nil chunkRefs
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, true, nil)
+		displayLongFormat(files, false, true, nil, nil)
 	})
 
 	// Should still show header but no dedup stats
@@ -598,7 +619,7 @@ func TestDisplayLongFormat_MultipleFiles(t *testing.T) {
 	files := []config.FileManifest{f1, f2, f3}
 
 	out := captureStdout(t, func() {
-		displayLongFormat(files, false, false, nil)
+		displayLongFormat(files, false, false, nil, nil)
 	})
 
 	lines := strings.Split(strings.TrimSpace(out), "\n")
@@ -618,3 +639,90 @@ func TestDisplayLongFormat_MultipleFiles(t *testing.T) {
 		t.Fatalf("expected 'dir3/c.txt' in output")
 	}
 }
+
+// ============================================================================
+// filterAndSortFiles - Advanced Filters
+// ============================================================================
+
+func TestFilterAndSortFiles_AdvancedFilters(t *testing.T) {
+	base := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	files := []config.FileManifest{
+		{FilePath: "report.pdf", Destination: "docs/", Size: 2048, ModTime: base.Format(time.RFC3339), Tags: []string{"work", "q3"}},
+		{FilePath: "notes.txt", Destination: "docs/", Size: 100, ModTime: base.AddDate(0, 0, -10).Format(time.RFC3339), Tags: []string{"work"}},
+		{FilePath: "photo.jpg", Destination: "pics/", Size: 5 * 1024 * 1024, ModTime: base.AddDate(0, 0, 1).Format(time.RFC3339)},
+	}
+
+	names := func(out []config.FileManifest) []string {
+		var result []string
+		for _, f := range out {
+			result = append(result, f.FilePath)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		opts     lsFilterOptions
+		sortBy   string
+		expected []string
+	}{
+		{name: "single tag", opts: lsFilterOptions{Tags: []string{"work"}}, sortBy: "name", expected: []string{"notes.txt", "report.pdf"}},
+		{name: "all tags required", opts: lsFilterOptions{Tags: []string{"work", "q3"}}, sortBy: "name", expected: []string{"report.pdf"}},
+		{name: "min size", opts: lsFilterOptions{MinSize: 1024}, sortBy: "name", expected: []string{"photo.jpg", "report.pdf"}},
+		{name: "size range", opts: lsFilterOptions{MinSize: 1024, MaxSize: 4096}, sortBy: "name", expected: []string{"report.pdf"}},
+		{name: "modified since", opts: lsFilterOptions{ModifiedSince: base}, sortBy: "name", expected: []string{"photo.jpg", "report.pdf"}},
+		{name: "modified before", opts: lsFilterOptions{ModifiedBefore: base}, sortBy: "name", expected: []string{"notes.txt"}},
+		{name: "glob pattern", opts: lsFilterOptions{NamePattern: "*.pdf"}, sortBy: "name", expected: []string{"report.pdf"}},
+		{name: "reverse sort", opts: lsFilterOptions{Reverse: true}, sortBy: "size", expected: []string{"notes.txt", "report.pdf", "photo.jpg"}},
+		{name: "no match", opts: lsFilterOptions{Tags: []string{"missing"}}, sortBy: "name", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(filterAndSortFiles(files, "", tt.sortBy, tt.opts))
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseTimeFilter(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input       string
+		expected    time.Time
+		expectError bool
+	}{
+		{input: "2025-01-02T03:04:05Z", expected: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{input: "7d", expected: now.AddDate(0, 0, -7)},
+		{input: "36h", expected: now.Add(-36 * time.Hour)},
+		{input: "yesterday", expectError: true},
+		{input: "-5d", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseTimeFilter(tt.input, now)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error for %q", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("parseTimeFilter(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	// Plain dates are interpreted in local time
+	got, err := parseTimeFilter("2025-03-01", now)
+	if err != nil || got.Year() != 2025 || got.Month() != time.March || got.Day() != 1 {
+		t.Errorf("unexpected date parse: %v, %v", got, err)
+	}
+}
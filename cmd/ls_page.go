@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	iofs "io/fs"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// lsPage selects the files of one page of a listing while the manifests are
+// walked, so that a huge vault is never held in memory as a whole. A zero
+// Limit shows every file from Offset on.
+type lsPage struct {
+	SortBy  string
+	Reverse bool
+	Offset  int
+	Limit   int
+}
+
+// streams reports whether the files are shown in the order the manifests are
+// read, as they are read
+func (p lsPage) streams() bool {
+	return strings.ToLower(p.SortBy) == "none"
+}
+
+// walkPage calls show with each file of the page, in order. walk visits every
+// manifest of the vault and match selects the files that are listed.
+//
+// Unsorted listings are shown as they are walked, and the walk stops once the
+// page is full. Sorted listings must see every file first; with a limit only
+// the best Offset+Limit files seen so far are kept.
+func walkPage(walk func(fn func(*config.ManifestEntry) error) error, match func(*config.FileManifest) bool, page lsPage, show func(config.FileManifest) error) error {
+	if page.streams() {
+		skipped, shown := 0, 0
+		return walk(func(entry *config.ManifestEntry) error {
+			if !match(&entry.Manifest) {
+				return nil
+			}
+			if skipped < page.Offset {
+				skipped++
+				return nil
+			}
+			if err := show(entry.Manifest); err != nil {
+				return err
+			}
+			if shown++; page.Limit > 0 && shown >= page.Limit {
+				return iofs.SkipAll
+			}
+			return nil
+		})
+	}
+
+	keep := page.Offset + page.Limit
+	var files []config.FileManifest
+	err := walk(func(entry *config.ManifestEntry) error {
+		if !match(&entry.Manifest) {
+			return nil
+		}
+		files = append(files, entry.Manifest)
+		// Sorting only when the buffer doubles keeps pruning cheap
+		if page.Limit > 0 && len(files) >= 2*keep {
+			sortFiles(files, page.SortBy, page.Reverse)
+			files = append(files[:0:0], files[:keep]...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sortFiles(files, page.SortBy, page.Reverse)
+	if page.Offset >= len(files) {
+		return nil
+	}
+	files = files[page.Offset:]
+	if page.Limit > 0 && len(files) > page.Limit {
+		files = files[:page.Limit]
+	}
+	for _, file := range files {
+		if err := show(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
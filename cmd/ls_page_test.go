@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// walkFiles returns a manifest walk over files that counts the manifests it visits
+func walkFiles(files []config.FileManifest, visited *int) func(fn func(*config.ManifestEntry) error) error {
+	return func(fn func(*config.ManifestEntry) error) error {
+		for _, file := range files {
+			*visited++
+			if err := fn(&config.ManifestEntry{Manifest: file}); err == fs.SkipAll {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func pageNames(t *testing.T, files []config.FileManifest, match func(*config.FileManifest) bool, page lsPage) ([]string, int) {
+	t.Helper()
+	var names []string
+	visited := 0
+	err := walkPage(walkFiles(files, &visited), match, page, func(file config.FileManifest) error {
+		names = append(names, file.FilePath)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkPage failed: %v", err)
+	}
+	return names, visited
+}
+
+func TestWalkPage(t *testing.T) {
+	var files []config.FileManifest
+	for _, i := range []int{7, 2, 9, 4, 0, 5, 8, 1, 6, 3} {
+		files = append(files, createTestManifest(fmt.Sprintf("f%d.txt", i), "docs/", int64(i), nil))
+	}
+	all := func(*config.FileManifest) bool { return true }
+
+	tests := []struct {
+		page lsPage
+		want string
+	}{
+		{lsPage{SortBy: "name"}, "[f0.txt f1.txt f2.txt f3.txt f4.txt f5.txt f6.txt f7.txt f8.txt f9.txt]"},
+		{lsPage{SortBy: "name", Limit: 3}, "[f0.txt f1.txt f2.txt]"},
+		{lsPage{SortBy: "name", Offset: 4, Limit: 2}, "[f4.txt f5.txt]"},
+		{lsPage{SortBy: "name", Offset: 8, Limit: 5}, "[f8.txt f9.txt]"},
+		{lsPage{SortBy: "name", Offset: 10}, "[]"},
+		{lsPage{SortBy: "size", Limit: 2}, "[f9.txt f8.txt]"},
+		{lsPage{SortBy: "size", Reverse: true, Offset: 1, Limit: 2}, "[f1.txt f2.txt]"},
+		{lsPage{SortBy: "none", Offset: 1, Limit: 3}, "[f2.txt f9.txt f4.txt]"},
+	}
+	for _, tt := range tests {
+		names, _ := pageNames(t, files, all, tt.page)
+		if got := fmt.Sprint(names); got != tt.want {
+			t.Errorf("page %+v = %s, want %s", tt.page, got, tt.want)
+		}
+	}
+
+	// Filters apply before the page is cut
+	even := func(f *config.FileManifest) bool { return f.Size%2 == 0 }
+	if names, _ := pageNames(t, files, even, lsPage{SortBy: "name", Offset: 1, Limit: 2}); fmt.Sprint(names) != "[f2.txt f4.txt]" {
+		t.Errorf("filtered page = %v", names)
+	}
+
+	// An unsorted page stops the walk once it is full
+	if _, visited := pageNames(t, files, all, lsPage{SortBy: "none", Limit: 2}); visited != 2 {
+		t.Errorf("expected the walk to stop after 2 manifests, visited %d", visited)
+	}
+}
+
+func TestWalkPageKeepsTiesStable(t *testing.T) {
+	// Every file sorts equal by the default path sort, so only the tie
+	// break decides which files a page holds
+	var files []config.FileManifest
+	for _, i := range []int{3, 1, 4, 0, 2, 5} {
+		files = append(files, createTestManifest(fmt.Sprintf("f%d.txt", i), "docs/", 1, nil))
+	}
+	all := func(*config.FileManifest) bool { return true }
+	first, _ := pageNames(t, files, all, lsPage{SortBy: "path", Limit: 2})
+	second, _ := pageNames(t, files, all, lsPage{SortBy: "path", Offset: 2, Limit: 2})
+	if fmt.Sprint(first, second) != "[f0.txt f1.txt] [f2.txt f3.txt]" {
+		t.Errorf("unexpected pages %v %v", first, second)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Local states of a listed file
+const (
+	fileStatusComplete = "complete"       // Every chunk is in the chunk store
+	fileStatusPartial  = "partial"        // Some chunks are missing
+	fileStatusMissing  = "missing"        // None of its chunks are stored
+	fileStatusDeleting = "pending-delete" // A tombstone covers the file, so the next sync removes it
+)
+
+// fileStatus is the local state of a file and how many of its chunks are missing
+type fileStatus struct {
+	State         string
+	MissingChunks int
+}
+
+// incomplete reports whether the file cannot be read in full from this vault
+func (s fileStatus) incomplete() bool {
+	return s.MissingChunks > 0
+}
+
+// maxPresenceCache bounds how many chunk names a statusChecker remembers, so
+// that checking a huge vault does not hold every chunk name in memory
+const maxPresenceCache = 1 << 16
+
+// statusChecker compares files against the chunk store one at a time.
+// stored reports whether a chunk is in the store; names shared between files
+// are checked once while they stay in the cache. Deletions that tombstones
+// record but that were not applied yet, as after an interrupted sync, take
+// precedence over missing chunks.
+type statusChecker struct {
+	tombstones []config.Tombstone
+	stored     func(name string) bool
+	present    map[string]bool
+}
+
+// newStatusChecker returns a statusChecker for a vault with tombstones
+func newStatusChecker(tombstones []config.Tombstone, stored func(name string) bool) *statusChecker {
+	return &statusChecker{tombstones: tombstones, stored: stored, present: make(map[string]bool)}
+}
+
+// check returns the local state of file
+func (c *statusChecker) check(file *config.FileManifest) fileStatus {
+	var status fileStatus
+	for _, ref := range file.Chunks {
+		name := chunk.StorageName(ref)
+		found, checked := c.present[name]
+		if !checked {
+			found = name != "" && c.stored(name)
+			if len(c.present) >= maxPresenceCache {
+				clear(c.present)
+			}
+			c.present[name] = found
+		}
+		if !found {
+			status.MissingChunks++
+		}
+	}
+
+	switch {
+	case status.MissingChunks == 0:
+		status.State = fileStatusComplete
+	case status.MissingChunks == len(file.Chunks):
+		status.State = fileStatusMissing
+	default:
+		status.State = fileStatusPartial
+	}
+	for i := range c.tombstones {
+		if c.tombstones[i].Covers(file) {
+			status.State = fileStatusDeleting
+			break
+		}
+	}
+	return status
+}
+
+// fileStatuses compares files against the chunk store, keyed by vault path,
+// see statusChecker
+func fileStatuses(files []config.FileManifest, tombstones []config.Tombstone, stored func(name string) bool) map[string]fileStatus {
+	checker := newStatusChecker(tombstones, stored)
+	statuses := make(map[string]fileStatus, len(files))
+	for i := range files {
+		statuses[files[i].Destination+files[i].FilePath] = checker.check(&files[i])
+	}
+	return statuses
+}
+
+// withMissingChunks returns the files that are missing chunks locally
+func withMissingChunks(files []config.FileManifest, statuses map[string]fileStatus) []config.FileManifest {
+	var missing []config.FileManifest
+	for _, file := range files {
+		if statuses[file.Destination+file.FilePath].incomplete() {
+			missing = append(missing, file)
+		}
+	}
+	return missing
+}
+
+// describeStatus formats the state of a file with chunks chunks for listings
+func describeStatus(status fileStatus, chunks int) string {
+	switch status.State {
+	case "":
+		return "-"
+	case fileStatusPartial:
+		return fmt.Sprintf("partial (%d/%d)", chunks-status.MissingChunks, chunks)
+	}
+	return status.State
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestFileStatuses(t *testing.T) {
+	complete := createTestManifest("complete.txt", "docs/", 20, []config.ChunkRef{{Hash: "a"}, {Hash: "b", EncryptedHash: "enc-b"}})
+	partial := createTestManifest("partial.txt", "docs/", 20, []config.ChunkRef{{Hash: "a"}, {Hash: "gone"}})
+	missing := createTestManifest("missing.txt", "docs/", 10, []config.ChunkRef{{Hash: "gone"}})
+	empty := createTestManifest("empty.txt", "docs/", 0, nil)
+	deleted := createTestManifest("deleted.txt", "docs/", 10, []config.ChunkRef{{Hash: "a"}})
+	files := []config.FileManifest{complete, partial, missing, empty, deleted}
+	tombstones := []config.Tombstone{{FilePath: "deleted.txt", Destination: "docs/", DeletedAt: time.Now().Add(time.Hour)}}
+
+	checks := map[string]int{}
+	stored := func(name string) bool {
+		checks[name]++
+		return name == "a" || name == "enc-b"
+	}
+	statuses := fileStatuses(files, tombstones, stored)
+
+	want := map[string]fileStatus{
+		"docs/complete.txt": {State: fileStatusComplete},
+		"docs/partial.txt":  {State: fileStatusPartial, MissingChunks: 1},
+		"docs/missing.txt":  {State: fileStatusMissing, MissingChunks: 1},
+		"docs/empty.txt":    {State: fileStatusComplete},
+		"docs/deleted.txt":  {State: fileStatusDeleting},
+	}
+	for path, status := range want {
+		if statuses[path] != status {
+			t.Errorf("%s: got %+v, want %+v", path, statuses[path], status)
+		}
+	}
+	for name, n := range checks {
+		if n != 1 {
+			t.Errorf("chunk %s checked %d times", name, n)
+		}
+	}
+
+	only := withMissingChunks(files, statuses)
+	if len(only) != 2 || only[0].FilePath != "partial.txt" || only[1].FilePath != "missing.txt" {
+		t.Errorf("unexpected files missing chunks: %+v", only)
+	}
+
+	out := captureStdout(t, func() {
+		displayLongFormat(files, false, false, nil, statuses)
+	})
+	if !strings.Contains(out, "STATUS") || !strings.Contains(out, "partial (1/2)") || !strings.Contains(out, "pending-delete") {
+		t.Errorf("expected file statuses in the long format, got:\n%s", out)
+	}
+}
@@ -0,0 +1,34 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// activeCmd is the command being executed, whose passphrase flags are used
+// when a vault's encrypted manifests need its key
+var activeCmd *cobra.Command
+
+// loadMetadataKey loads the key of a vault that encrypts its manifests,
+// asking for the passphrase the same way the running command would
+func loadMetadataKey(vaultRoot string, cfg *config.VaultConfig) ([]byte, error) {
+	cmd := activeCmd
+	if cmd == nil {
+		cmd = rootCmd
+	}
+	passphrase, err := ui.GetPassphraseForVault(cmd, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.LoadVaultKey(*cfg, passphrase)
+}
+
+func init() {
+	config.MetadataKeyLoader = loadMetadataKey
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/migrate"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the vault to the current schema version",
+	Long: `Upgrade a vault created by an older version of sietch to the current schema.
+
+Migrations run in order, one schema version at a time, after vault.yaml has
+been backed up to .sietch/backups. Other commands apply pending migrations
+automatically before they start; this command runs them explicitly and with
+--dry-run lists what would change. Vaults written by a newer sietch are
+refused rather than modified.
+
+Example:
+  sietch migrate
+  sietch migrate --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		pending := migrate.Pending(vaultConfig.SchemaVersion)
+		if len(pending) == 0 {
+			fmt.Printf("✓ Vault is at the current schema version (v%d)\n", vaultConfig.SchemaVersion)
+			return nil
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			for _, m := range pending {
+				fmt.Printf("[dry-run] would migrate v%d → v%d: %s\n", m.From, m.From+1, m.Description)
+			}
+			return nil
+		}
+
+		result, err := migrate.Run(vaultRoot)
+		if result != nil {
+			for _, m := range result.Applied {
+				fmt.Printf("✓ v%d → v%d: %s\n", m.From, m.From+1, m.Description)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ Vault migrated from schema v%d to v%d\n", result.FromVersion, result.ToVersion)
+		fmt.Printf("  Backup: %s\n", result.BackupDir)
+		return nil
+	},
+}
+
+// autoMigrate runs pending schema migrations for the vault containing the
+// working directory before a command starts, and refuses to continue on vaults
+// written by a newer sietch. Commands that do not operate on an existing vault
+// are left alone, as is anything run with --dry-run.
+func autoMigrate(cmd *cobra.Command) error {
+	switch cmd {
+	case migrateCmd, initCmd, cloneCmd:
+		return nil
+	}
+	switch cmd.Name() {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return nil
+	}
+
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil || !fs.IsVaultInitialized(vaultRoot) {
+		return nil
+	}
+
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		if errors.Is(err, config.ErrUnsupportedSchema) {
+			return err
+		}
+		// Let the command report configuration problems itself
+		return nil
+	}
+	if len(migrate.Pending(vaultConfig.SchemaVersion)) == 0 {
+		return nil
+	}
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		fmt.Fprintf(os.Stderr, "Note: vault schema v%d is out of date, run 'sietch migrate' to upgrade it\n", vaultConfig.SchemaVersion)
+		return nil
+	}
+
+	l, err := acquireVaultLock(cmd, vaultRoot)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	result, err := migrate.Run(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("vault schema migration failed: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Migrated vault schema from v%d to v%d (backup: %s)\n", result.FromVersion, result.ToVersion, result.BackupDir)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,366 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// moveCmd renames files inside the vault
+var moveCmd = &cobra.Command{
+	Use:     "move <source> <destination>",
+	Aliases: []string{"mv"},
+	Short:   "Move or rename files inside the vault",
+	Long: `Move or rename a file or directory stored in your Sietch vault.
+
+Only manifests are rewritten: the chunks stay where they are, so moving a
+large file or a whole directory is instant. A destination ending in '/', or
+naming a directory already in the vault, receives the source under its own
+name. The old path is recorded as a tombstone, so the next sync moves the
+file on peers too instead of copying it back. Existing files are never
+overwritten.
+
+Examples:
+  sietch mv notes.txt docs/notes.txt     # Move a file
+  sietch mv docs/report.pdf archive/     # Move into a directory
+  sietch mv photos/2024 archive/photos   # Rename a directory
+  sietch mv --dry-run docs archive/      # Show what would move`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVaultMove(cmd, args[0], args[1], false)
+	},
+}
+
+// copyCmd copies files inside the vault
+var copyCmd = &cobra.Command{
+	Use:     "copy <source> <destination>",
+	Aliases: []string{"cp"},
+	Short:   "Copy files inside the vault",
+	Long: `Copy a file or directory stored in your Sietch vault to another vault path.
+
+The copy is a new manifest referencing the same chunks as the original, so
+nothing is read or stored again and the copy takes no space until one of
+the two is changed. Destinations follow the same rules as 'sietch mv'.
+
+Examples:
+  sietch cp docs/report.pdf archive/report-2024.pdf
+  sietch cp photos/2024 backup/        # Copy a whole directory`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runVaultMove(cmd, args[0], args[1], true)
+	},
+}
+
+// vaultMove is a stored file placed at a new vault path by a move or copy
+type vaultMove struct {
+	entry *config.ManifestEntry
+	to    string
+}
+
+// from returns the vault path the file is stored at
+func (m vaultMove) from() string {
+	return m.entry.Manifest.Destination + m.entry.Manifest.FilePath
+}
+
+// runVaultMove moves, or with copyFiles copies, source to destination in the
+// vault containing the working directory
+func runVaultMove(cmd *cobra.Command, source, destination string, copyFiles bool) error {
+	verb, op := "move", audit.OpMove
+	if copyFiles {
+		verb, op = "copy", audit.OpCopy
+	}
+
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return fmt.Errorf("not inside a vault: %v", err)
+	}
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	vaultConfig, err := manager.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	if err := config.CheckWritable(vaultConfig); err != nil {
+		return err
+	}
+	entries, err := manager.GetManifestEntries()
+	if err != nil {
+		return fmt.Errorf("failed to get manifest entries: %v", err)
+	}
+
+	moves, err := planVaultMoves(entries, source, destination)
+	if err != nil {
+		return err
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if dryRun {
+		for _, m := range moves {
+			fmt.Printf("[dry-run] would %s '%s' to '%s'\n", verb, m.from(), m.to)
+		}
+		fmt.Printf("[dry-run] %d file(s), no chunks stored or moved\n", len(moves))
+		return nil
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": verb, "source": source, "destination": destination, "fileCount": len(moves)})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+			fmt.Printf("txn rollback; %s operation did not complete\n", verb)
+		}
+	}()
+
+	renamed := make(map[string]string, len(moves))
+	for _, m := range moves {
+		renamed[m.from()] = m.to
+	}
+
+	var dedupManager *deduplication.Manager
+	if copyFiles && vaultConfig.Deduplication.Enabled {
+		dedupManager, err = deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+		if err != nil {
+			return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, m := range moves {
+		placed := m.entry.Manifest
+		placed.Destination, placed.FilePath = splitVaultPath(m.to)
+		// Added at its new path now, later than any deletion a tombstone there
+		// may have taken to peers
+		placed.AddedAt = now
+		if to, ok := renamed[placed.HardLink]; ok {
+			placed.HardLink = to
+		}
+		if copyFiles {
+			placed.Chunks = make([]config.ChunkRef, len(m.entry.Manifest.Chunks))
+			for i, ref := range m.entry.Manifest.Chunks {
+				ref.Deduplicated = true
+				placed.Chunks[i] = ref
+			}
+		}
+		if err := stagePlacedManifest(txn, vaultRoot, &placed); err != nil {
+			return fmt.Errorf("failed to stage manifest for %s: %v", m.to, err)
+		}
+
+		if copyFiles {
+			if dedupManager != nil {
+				dedupManager.ReferenceChunks(placed.Chunks)
+			}
+		} else {
+			rel, err := filepath.Rel(vaultRoot, m.entry.Path)
+			if err != nil {
+				return fmt.Errorf("resolve manifest path: %v", err)
+			}
+			if err := txn.StageDelete(filepath.ToSlash(rel)); err != nil {
+				return fmt.Errorf("stage manifest delete: %v", err)
+			}
+			// Leave a tombstone so the next sync removes the old path from peers
+			if err := stageTombstone(txn, vaultRoot, &m.entry.Manifest); err != nil {
+				return fmt.Errorf("stage tombstone: %v", err)
+			}
+		}
+		fmt.Printf("✓ %s → %s\n", m.from(), m.to)
+	}
+
+	// Files left in place that are hard links to a moved file follow it
+	if !copyFiles {
+		for _, entry := range entries {
+			if _, moved := renamed[entry.Manifest.Destination+entry.Manifest.FilePath]; moved {
+				continue
+			}
+			to, ok := renamed[entry.Manifest.HardLink]
+			if !ok {
+				continue
+			}
+			linked := entry.Manifest
+			linked.HardLink = to
+			if err := replaceManifestTransactional(txn, vaultRoot, entry.Path, &linked); err != nil {
+				return fmt.Errorf("failed to update manifest for %s: %v", linked.Destination+linked.FilePath, err)
+			}
+		}
+	}
+
+	if dedupManager != nil {
+		if err := dedupManager.Save(); err != nil {
+			return fmt.Errorf("failed to save deduplication index: %v", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit %s transaction: %v", verb, err)
+	}
+	committed = true
+	manager.RefreshIndex()
+	recordAudit(vaultRoot, op, map[string]string{
+		"from":  fs.VaultPath(source),
+		"to":    fs.VaultPath(destination),
+		"files": strconv.Itoa(len(moves)),
+	})
+
+	if copyFiles {
+		fmt.Printf("\n✓ Copied %d file(s), sharing their chunks with the originals\n", len(moves))
+	} else {
+		fmt.Printf("\n✓ Moved %d file(s)\n", len(moves))
+	}
+	return nil
+}
+
+// planVaultMoves returns where each file a move or copy of source to
+// destination places. Source is a stored file or a directory of them;
+// destination is the new path, or a directory to place the source in when it
+// ends in '/' or already holds files. No existing file is ever a target.
+func planVaultMoves(entries []*config.ManifestEntry, source, destination string) ([]vaultMove, error) {
+	src, err := cleanVaultPath(source)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := cleanVaultPath(destination)
+	if err != nil {
+		return nil, err
+	}
+	if src == "" {
+		return nil, fmt.Errorf("cannot move the root of the vault")
+	}
+
+	byPath := make(map[string]*config.ManifestEntry, len(entries))
+	for _, entry := range entries {
+		byPath[entry.Manifest.Destination+entry.Manifest.FilePath] = entry
+	}
+	isDir := func(p string) bool {
+		for stored := range byPath {
+			if p == "" || strings.HasPrefix(stored, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+	intoDir := dst == "" || strings.HasSuffix(fs.VaultPath(destination), "/") || isDir(dst)
+	join := func(dir, name string) string {
+		if dir == "" {
+			return name
+		}
+		return dir + "/" + name
+	}
+
+	var moves []vaultMove
+	if entry, ok := byPath[src]; ok {
+		to := dst
+		if intoDir {
+			to = join(dst, path.Base(src))
+		}
+		moves = append(moves, vaultMove{entry: entry, to: to})
+	} else if isDir(src) {
+		if dst == src || strings.HasPrefix(dst, src+"/") {
+			return nil, fmt.Errorf("cannot move '%s' into itself", src)
+		}
+		base := dst
+		if intoDir {
+			base = join(dst, path.Base(src))
+		}
+		for stored, entry := range byPath {
+			if strings.HasPrefix(stored, src+"/") {
+				moves = append(moves, vaultMove{entry: entry, to: base + strings.TrimPrefix(stored, src)})
+			}
+		}
+		sort.Slice(moves, func(i, j int) bool { return moves[i].to < moves[j].to })
+	} else {
+		return nil, fmt.Errorf("file not found in vault: %s", src)
+	}
+
+	for _, m := range moves {
+		if m.to == m.from() {
+			return nil, fmt.Errorf("'%s' is already at '%s'", src, m.to)
+		}
+		if _, exists := byPath[m.to]; exists {
+			return nil, fmt.Errorf("'%s' already exists in the vault, delete it first", m.to)
+		}
+		if isDir(m.to) {
+			return nil, fmt.Errorf("'%s' is a directory in the vault", m.to)
+		}
+	}
+	return moves, nil
+}
+
+// cleanVaultPath returns p as a vault path without a leading or trailing
+// slash; the root of the vault is the empty path
+func cleanVaultPath(p string) (string, error) {
+	cleaned := path.Clean(fs.VaultPath(p))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("path '%s' is outside the vault", p)
+	}
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "." {
+		cleaned = ""
+	}
+	return cleaned, nil
+}
+
+// splitVaultPath splits a vault path into the Destination and FilePath of
+// its manifest
+func splitVaultPath(p string) (destination, fileName string) {
+	dir := path.Dir(p)
+	if dir == "." {
+		return "", path.Base(p)
+	}
+	return dir + "/", path.Base(p)
+}
+
+// stagePlacedManifest stages the manifest of a file placed at a new vault
+// path, dropping any tombstone of an earlier file deleted from it
+func stagePlacedManifest(txn *atomic.Transaction, vaultRoot string, file *config.FileManifest) error {
+	name, err := config.ManifestFileName(vaultRoot, file.Destination, file.FilePath)
+	if err != nil {
+		return err
+	}
+	w, err := txn.StageCreate(filepath.ToSlash(filepath.Join(".sietch", "manifests", name)))
+	if err != nil {
+		return err
+	}
+	if err := writeManifestYAML(w, vaultRoot, file); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	tombstone, err := config.TombstoneRelPath(vaultRoot, file.Destination, file.FilePath)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(vaultRoot, filepath.FromSlash(tombstone))); err == nil {
+		return txn.StageDelete(tombstone)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(moveCmd)
+	rootCmd.AddCommand(copyCmd)
+
+	moveCmd.ValidArgsFunction = completeVaultPaths
+	copyCmd.ValidArgsFunction = completeVaultPaths
+}
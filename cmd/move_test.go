@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestPlanVaultMoves(t *testing.T) {
+	entry := func(dest, name string) *config.ManifestEntry {
+		return &config.ManifestEntry{Path: dest + name, Manifest: config.FileManifest{Destination: dest, FilePath: name}}
+	}
+	entries := []*config.ManifestEntry{
+		entry("", "notes.txt"),
+		entry("docs/", "report.pdf"),
+		entry("docs/old/", "draft.txt"),
+		entry("archive/", "2023.tar"),
+	}
+	tests := []struct {
+		source, destination string
+		want                []string // from=to pairs
+		err                 string
+	}{
+		{"notes.txt", "docs/notes.md", []string{"notes.txt=docs/notes.md"}, ""},
+		{"notes.txt", "archive", []string{"notes.txt=archive/notes.txt"}, ""},
+		{"notes.txt", "new/", []string{"notes.txt=new/notes.txt"}, ""},
+		{"docs/report.pdf", "/", []string{"docs/report.pdf=report.pdf"}, ""},
+		{"docs", "papers", []string{"docs/old/draft.txt=papers/old/draft.txt", "docs/report.pdf=papers/report.pdf"}, ""},
+		{"docs/", "archive/", []string{"docs/old/draft.txt=archive/docs/old/draft.txt", "docs/report.pdf=archive/docs/report.pdf"}, ""},
+		{"docs/old", "docs", nil, "already at"},
+		{"docs", "docs/old", nil, "into itself"},
+		{"notes.txt", "docs/report.pdf", nil, "already exists"},
+		{"notes.txt", "docs/old/../report.pdf", nil, "already exists"},
+		{"missing.txt", "x", nil, "not found"},
+		{"notes.txt", "../outside", nil, "outside the vault"},
+		{"", "x", nil, "root of the vault"},
+	}
+	for _, tt := range tests {
+		moves, err := planVaultMoves(entries, tt.source, tt.destination)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("planVaultMoves(%q, %q) error = %v, want %q", tt.source, tt.destination, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("planVaultMoves(%q, %q): %v", tt.source, tt.destination, err)
+			continue
+		}
+		var got []string
+		for _, m := range moves {
+			got = append(got, m.from()+"="+m.to)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("planVaultMoves(%q, %q) = %v, want %v", tt.source, tt.destination, got, tt.want)
+		}
+	}
+}
+
+func TestSplitVaultPath(t *testing.T) {
+	tests := []struct{ path, dest, name string }{
+		{"notes.txt", "", "notes.txt"},
+		{"docs/report.pdf", "docs/", "report.pdf"},
+		{"a/b/c", "a/b/", "c"},
+	}
+	for _, tt := range tests {
+		dest, name := splitVaultPath(tt.path)
+		if dest != tt.dest || name != tt.name {
+			t.Errorf("splitVaultPath(%q) = %q, %q, want %q, %q", tt.path, dest, name, tt.dest, tt.name)
+		}
+	}
+}
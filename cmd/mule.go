@@ -0,0 +1,487 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// muleCmd groups the commands relaying bundles through a mule
+var muleCmd = &cobra.Command{
+	Use:   "mule",
+	Short: "Relay syncs through a peer that holds them without reading them",
+	Long: `Carry syncs between vaults that are never online at the same time through
+a mule: a third vault, trusted enough to hold data but not to read it, that
+stores bundles for others and forwards them when their destination connects.
+
+The sending vault packs what the destination lacks into a bundle, as
+'sietch bundle create' does, seals its manifests under the vault key and
+pushes it to the mule. Chunks are already encrypted, so the mule only learns
+the destination's vault ID and the size of each bundle. The destination
+later fetches the bundles held for it, applies them in order and tells the
+mule to drop them.
+
+Any vault can be a mule; it does not need, and never gets, the key of the
+vaults it relays for. It only serves peers it trusts, so pair both the
+sending and the receiving vault with it first. Vaults without encryption
+cannot send through a mule, since it could read their chunks.
+
+Examples:
+  sietch mule serve --quota 20GB                        # On the mule
+  sietch mule send --for laptop mule-box                # On the sending vault
+  sietch mule fetch mule-box                            # On the receiving vault
+  sietch mule ls                                        # On the mule: what it holds`,
+}
+
+var muleServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Hold bundles for other vaults until they collect them",
+	Long: `Run this vault as a mule until interrupted. Trusted peers can push bundles
+for other vaults to it and collect the bundles held for them. The vault's
+own files are served to trusted peers as 'sietch sync' would, and with
+sync.accept_replicas it fetches the copies they ask it to hold.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		quotaFlag, _ := cmd.Flags().GetString("quota")
+		var quota int64
+		if quotaFlag != "" {
+			var err error
+			if quota, err = util.ParseChunkSize(quotaFlag); err != nil || quota <= 0 {
+				return fmt.Errorf("invalid --quota %q", quotaFlag)
+			}
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return fmt.Errorf("mule serve does not support --dry-run")
+		}
+
+		vaultRoot, vaultCfg, err := openMuleVault()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := muleContext()
+		defer cancel()
+
+		port, _ := cmd.Flags().GetInt("port")
+		listen, err := listenAddrsFromFlags(cmd, &vaultCfg.Sync)
+		if err != nil {
+			return err
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		h, syncService, err := startSyncNode(ctx, vaultRoot, vaultCfg, port, listen, verbose)
+		if err != nil {
+			return err
+		}
+		defer h.Close()
+		syncService.EnableMule(quota)
+		if vaultCfg.Sync.AcceptReplicas {
+			syncService.EnableReplicas()
+		}
+
+		held, err := syncService.MuleBundles("")
+		if err != nil {
+			return fmt.Errorf("failed to list held bundles: %v", err)
+		}
+		fmt.Printf("🐫 Serving as a mule for trusted peers, holding %d bundles. Press Ctrl+C to stop.\n", len(held))
+		<-ctx.Done()
+		return nil
+	},
+}
+
+var muleSendCmd = &cobra.Command{
+	Use:   "send --for <have-list|vault> <mule>",
+	Short: "Push a sealed bundle of what another vault lacks to a mule",
+	Long: `Pack what the vault named by --for lacks into a bundle, as
+'sietch bundle create --for' does, seal it and push it to the mule. The mule
+is a multiaddress or the name or ID of a trusted peer on the local network.
+
+Like bundles, mule deliveries build on each other: each one only holds what
+changed since the previous one for the same vault. --full repacks every file
+and deletion the vault is not known to hold.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultCfg, err := openMuleVault()
+		if err != nil {
+			return err
+		}
+		if vaultCfg.Encryption.Type == "" || vaultCfg.Encryption.Type == constants.EncryptionTypeNone {
+			return fmt.Errorf("this vault does not encrypt its chunks, a mule could read them")
+		}
+		dest, _ := cmd.Flags().GetString("for")
+		if dest == "" {
+			return fmt.Errorf("--for is required: the mule needs to know which vault the bundle is for")
+		}
+
+		vaultMgr, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault: %v", err)
+		}
+		local := p2p.NewLocalSyncService(vaultMgr)
+		local.FullSync, _ = cmd.Flags().GetBool("full")
+
+		var have *p2p.HaveList
+		var cursor string
+		if info, statErr := os.Stat(dest); statErr == nil && info.Mode().IsRegular() {
+			if have, err = readHaveListFile(dest); err != nil {
+				return err
+			}
+		} else {
+			export, err := local.LoadBundleExport(dest)
+			if err != nil {
+				return err
+			}
+			have, cursor = &export.Have, export.Cursor
+		}
+		target := have.VaultName
+		if target == "" {
+			target = have.VaultID
+		}
+		var rules []string
+		if tp := trustedPeerByID(vaultCfg, have.PeerID); tp != nil {
+			rules = vaultCfg.Sync.AllowedPathsFor(*tp)
+		}
+
+		header, err := local.BundleContents(have, cursor, rules)
+		if err != nil {
+			return err
+		}
+		if len(header.Manifest.Files) == 0 && len(header.Manifest.Tombstones) == 0 {
+			fmt.Printf("✓ %s is up to date, nothing to send\n", target)
+			return nil
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would send %d files, %d deletions and %d chunks (%s) for %s to mule %s\n",
+				len(header.Manifest.Files), len(header.Manifest.Tombstones), len(header.Chunks),
+				util.HumanReadableSize(header.Bytes()), target, args[0])
+			return nil
+		}
+
+		if local.BundleKey, err = config.MetadataKeyLoader(vaultRoot, vaultCfg); err != nil {
+			return fmt.Errorf("failed to load the vault key to seal the bundle: %v", err)
+		}
+		tmp, err := os.CreateTemp(filepath.Join(vaultRoot, ".sietch"), "mule-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary bundle: %v", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if err := local.WriteBundle(tmp, header); err != nil {
+			return fmt.Errorf("failed to write bundle: %v", err)
+		}
+		size, err := tmp.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		ctx, cancel := muleContext()
+		defer cancel()
+		h, syncService, muleID, err := connectToMule(ctx, cmd, vaultRoot, vaultCfg, args[0])
+		if err != nil {
+			return err
+		}
+		defer h.Close()
+
+		fmt.Printf("📤 Pushing bundle of %s for %s...\n", util.HumanReadableSize(size), target)
+		if _, err := syncService.PushBundle(ctx, muleID, have.VaultID, tmp, size); err != nil {
+			return fmt.Errorf("failed to push bundle: %v", err)
+		}
+		if err := local.RecordBundleExport(have, header); err != nil {
+			fmt.Printf("Warning: the next bundle for %s will not be incremental: %v\n", target, err)
+		}
+		fmt.Printf("🐫 Mule %s holds the bundle for %s\n", args[0], target)
+		fmt.Printf("   Files:     %d\n", len(header.Manifest.Files))
+		fmt.Printf("   Deletions: %d\n", len(header.Manifest.Tombstones))
+		fmt.Printf("   Chunks:    %d (%s)\n", len(header.Chunks), util.HumanReadableSize(header.Bytes()))
+		return nil
+	},
+}
+
+var muleFetchCmd = &cobra.Command{
+	Use:   "fetch <mule>",
+	Short: "Collect and apply the bundles a mule holds for this vault",
+	Long: `Fetch the bundles the mule holds for this vault, oldest first, and merge
+each one as 'sietch bundle apply' would. The mule drops a bundle once it is
+applied. If one fails to apply, the rest are left on the mule, since later
+bundles build on earlier ones.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, vaultCfg, err := openMuleVault()
+		if err != nil {
+			return err
+		}
+
+		// Progress goes to stderr so structured output stays parseable
+		resultOut := os.Stdout
+		if format != outputTable {
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = resultOut }()
+		}
+
+		ctx, cancel := muleContext()
+		defer cancel()
+		h, syncService, muleID, err := connectToMule(ctx, cmd, vaultRoot, vaultCfg, args[0])
+		if err != nil {
+			return err
+		}
+		defer h.Close()
+
+		bundles, err := syncService.ListMuleBundles(ctx, muleID, vaultCfg.VaultID)
+		if err != nil {
+			return fmt.Errorf("failed to list bundles on the mule: %v", err)
+		}
+		if len(bundles) == 0 {
+			fmt.Println("✓ The mule holds no bundles for this vault")
+			return nil
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			for _, b := range bundles {
+				fmt.Printf("[dry-run] would fetch and apply bundle %s (%s), received %s\n",
+					b.ID, util.HumanReadableSize(b.Size), b.Received.Local().Format("2006-01-02 15:04"))
+			}
+			return nil
+		}
+
+		if syncService.BundleKey, err = config.MetadataKeyLoader(vaultRoot, vaultCfg); err != nil {
+			return fmt.Errorf("failed to load the vault key to open bundles: %v", err)
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		syncService.Verbose = verbose
+
+		var results []*p2p.SyncResult
+		for _, b := range bundles {
+			result, err := fetchMuleBundle(ctx, syncService, vaultRoot, muleID, b)
+			if err != nil {
+				return fmt.Errorf("bundle %s: %v", b.ID, err)
+			}
+			if err := displaySyncResults(resultOut, format, result); err != nil {
+				return err
+			}
+			results = append(results, result)
+			if len(result.FailedChunks) > 0 {
+				// Keep the bundle so its missing chunks can be fetched again
+				fmt.Printf("⚠️  Keeping bundle %s on the mule: some of its chunks were corrupt\n", b.ID)
+				continue
+			}
+			if err := syncService.DropMuleBundle(ctx, muleID, b); err != nil {
+				fmt.Printf("Warning: the mule still holds bundle %s: %v\n", b.ID, err)
+			}
+		}
+		return incompleteSyncError(results...)
+	},
+}
+
+var muleLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the bundles this vault holds as a mule",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, _, err := openMuleVault()
+		if err != nil {
+			return err
+		}
+		vaultMgr, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault: %v", err)
+		}
+		bundles, err := p2p.NewLocalSyncService(vaultMgr).MuleBundles("")
+		if err != nil {
+			return fmt.Errorf("failed to list held bundles: %v", err)
+		}
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, bundles)
+		}
+		if len(bundles) == 0 {
+			fmt.Println("No bundles held for other vaults")
+			return nil
+		}
+		var total int64
+		for _, b := range bundles {
+			fmt.Printf("%s  %-36s  %10s  %s\n", b.Received.Local().Format("2006-01-02 15:04"), b.For,
+				util.HumanReadableSize(b.Size), b.ID)
+			total += b.Size
+		}
+		fmt.Printf("\n%d bundles, %s\n", len(bundles), util.HumanReadableSize(total))
+		return nil
+	},
+}
+
+// openMuleVault returns the vault in the working directory, which must have
+// sync keys to identify itself to a mule or as one
+func openMuleVault() (string, *config.VaultConfig, error) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return "", nil, fmt.Errorf("not inside a vault: %v", err)
+	}
+	vaultCfg, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to load vault config: %v", err)
+	}
+	if vaultCfg.Sync.RSA == nil {
+		return "", nil, fmt.Errorf("sync is not configured for this vault, relaying through a mule needs its sync keys")
+	}
+	return vaultRoot, vaultCfg, nil
+}
+
+// muleContext returns a context canceled on interrupt
+func muleContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signalChan:
+			fmt.Println("\nReceived interrupt signal, shutting down...")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signalChan)
+	}()
+	return ctx, cancel
+}
+
+// connectToMule starts a node and connects it to the mule named by arg: a
+// multiaddress, or a trusted peer found on the local network
+func connectToMule(ctx context.Context, cmd *cobra.Command, vaultRoot string, vaultCfg *config.VaultConfig, arg string) (host.Host, *p2p.SyncService, peer.ID, error) {
+	return connectToPeer(ctx, cmd, vaultRoot, vaultCfg, arg, "mule")
+}
+
+// connectToPeer starts a node and connects it to the peer named by arg like
+// connectToMule does, naming it role in messages
+func connectToPeer(ctx context.Context, cmd *cobra.Command, vaultRoot string, vaultCfg *config.VaultConfig, arg, role string) (host.Host, *p2p.SyncService, peer.ID, error) {
+	var info *peer.AddrInfo
+	var target peer.ID
+	if strings.HasPrefix(arg, "/") {
+		maddr, err := multiaddr.NewMultiaddr(arg)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("invalid %s address: %v", role, err)
+		}
+		if info, err = peer.AddrInfoFromP2pAddr(maddr); err != nil {
+			return nil, nil, "", fmt.Errorf("failed to parse peer info: %v", err)
+		}
+	} else {
+		var err error
+		if target, err = resolveTrustedPeer(vaultCfg, arg); err != nil {
+			return nil, nil, "", err
+		}
+	}
+
+	port, _ := cmd.Flags().GetInt("port")
+	listen, err := listenAddrsFromFlags(cmd, &vaultCfg.Sync)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	h, syncService, err := startSyncNode(ctx, vaultRoot, vaultCfg, port, listen, verbose)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if info == nil {
+		discovery, err := p2p.NewFactory().CreateMDNS(h)
+		if err != nil {
+			h.Close()
+			return nil, nil, "", fmt.Errorf("failed to create mDNS discovery: %v", err)
+		}
+		if err := discovery.Start(ctx); err != nil {
+			h.Close()
+			return nil, nil, "", fmt.Errorf("failed to start mDNS discovery: %v", err)
+		}
+		defer func() { _ = discovery.Stop() }()
+
+		fmt.Printf("🔍 Looking for %s %s on the local network...\n", role, arg)
+		timeout, _ := cmd.Flags().GetInt("timeout")
+		timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer timeoutCancel()
+		select {
+		case found := <-filterDiscoveredPeers(timeoutCtx, discovery.DiscoveredPeers(), target):
+			info = &found
+		case <-timeoutCtx.Done():
+			h.Close()
+			return nil, nil, "", fmt.Errorf("%s %s not found after %d seconds", role, arg, timeout)
+		}
+	}
+
+	if err := h.Connect(ctx, *info); err != nil {
+		h.Close()
+		return nil, nil, "", fmt.Errorf("failed to connect to %s: %v", role, err)
+	}
+	fmt.Printf("✅ Connected to %s: %s\n", role, info.ID.String())
+	return h, syncService, info.ID, nil
+}
+
+// fetchMuleBundle downloads a bundle from the mule next to the vault and applies it
+func fetchMuleBundle(ctx context.Context, syncService *p2p.SyncService, vaultRoot string, muleID peer.ID, b p2p.MuleBundle) (*p2p.SyncResult, error) {
+	tmp, err := os.CreateTemp(filepath.Join(vaultRoot, ".sietch"), "mule-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary bundle: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	fmt.Printf("📥 Fetching bundle %s (%s)...\n", b.ID, util.HumanReadableSize(b.Size))
+	if err := syncService.FetchMuleBundle(ctx, muleID, b, tmp); err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header, result, err := syncService.ApplyBundle(tmp, "mule:"+muleID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply bundle: %v", err)
+	}
+	describeBundle(os.Stdout, vaultRoot, header)
+	return result, nil
+}
+
+func init() {
+	rootCmd.AddCommand(muleCmd)
+	muleCmd.AddCommand(muleServeCmd)
+	muleCmd.AddCommand(muleSendCmd)
+	muleCmd.AddCommand(muleFetchCmd)
+	muleCmd.AddCommand(muleLsCmd)
+
+	for _, c := range []*cobra.Command{muleServeCmd, muleSendCmd, muleFetchCmd} {
+		c.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+		c.Flags().StringSlice("listen", nil, "Multiaddrs to listen on instead of sync.listen_addrs (repeatable)")
+		c.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+	}
+	for _, c := range []*cobra.Command{muleSendCmd, muleFetchCmd} {
+		c.Flags().Bool("no-listen", false, "Accept no incoming connections, only dial out to the mule")
+		c.Flags().IntP("timeout", "t", 60, "Discovery timeout in seconds (for a mule given by name)")
+		c.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+		c.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+	}
+	muleServeCmd.Flags().String("quota", "", "Most space the bundles held for other vaults may take, e.g. 20GB")
+	muleSendCmd.Flags().String("for", "", "Have-list of the vault the bundle is for, or the name or ID of a vault sent to before")
+	muleSendCmd.Flags().Bool("full", false, "Consider every file and deletion instead of changes since the last bundle")
+}
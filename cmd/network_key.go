@@ -0,0 +1,129 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+// syncNetworkKeyCmd manages the swarm key of the vault's private network
+var syncNetworkKeyCmd = &cobra.Command{
+	Use:   "network-key",
+	Short: "Show, generate or import the vault's private network key",
+	Long: `Show, generate or import the swarm key of the vault's private network.
+
+A vault with a network key (sync.network_key in vault.yaml) syncs in a libp2p
+private network: its node only connects to nodes holding the same key, so
+other machines cannot even open a connection. Peers must still be trusted as
+usual once connected.
+
+Generate a key on one node, copy the key file to the others over a secure
+channel, and import it there. The fingerprint printed by this command is the
+same on every node with the same key.
+
+Examples:
+  sietch sync network-key                          # Show the key in use
+  sietch sync network-key --generate               # Create a new key
+  sietch sync network-key --import ~/swarm.key     # Use a key copied from another node`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		generate, _ := cmd.Flags().GetBool("generate")
+		importPath, _ := cmd.Flags().GetString("import")
+		if generate && importPath != "" {
+			return fmt.Errorf("--generate and --import cannot be used together")
+		}
+		if !generate && importPath == "" {
+			return showNetworkKey(vaultRoot, vaultConfig)
+		}
+
+		relPath := vaultConfig.Sync.NetworkKey
+		if relPath == "" {
+			relPath = p2p.DefaultNetworkKeyPath
+		}
+		keyPath := p2p.NetworkKeyPath(vaultRoot, &config.SyncConfig{NetworkKey: relPath})
+		force, _ := cmd.Flags().GetBool("force")
+		if _, err := os.Stat(keyPath); err == nil && !force {
+			return fmt.Errorf("network key %s already exists; use --force to replace it", relPath)
+		}
+
+		var key []byte
+		if importPath != "" {
+			if _, err := p2p.LoadNetworkKey(importPath); err != nil {
+				return err
+			}
+			if key, err = os.ReadFile(importPath); err != nil {
+				return fmt.Errorf("failed to read network key: %v", err)
+			}
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would write network key %s and set sync.network_key\n", relPath)
+			return nil
+		}
+
+		if generate {
+			err = p2p.GenerateNetworkKey(keyPath)
+		} else if err = os.MkdirAll(filepath.Dir(keyPath), 0o700); err == nil {
+			err = os.WriteFile(keyPath, key, 0o600)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write network key: %v", err)
+		}
+
+		if vaultConfig.Sync.NetworkKey != relPath {
+			vaultConfig.Sync.NetworkKey = relPath
+			if err := saveVaultConfigTransactional(vaultRoot, vaultConfig, "sync.network_key"); err != nil {
+				return err
+			}
+		}
+		if err := showNetworkKey(vaultRoot, vaultConfig); err != nil {
+			return err
+		}
+		if generate {
+			fmt.Printf("Copy %s to the other nodes and run 'sietch sync network-key --import <file>' there\n", relPath)
+		}
+		return nil
+	},
+}
+
+// showNetworkKey prints where the vault's network key is and its fingerprint
+func showNetworkKey(vaultRoot string, vaultConfig *config.VaultConfig) error {
+	path := p2p.NetworkKeyPath(vaultRoot, &vaultConfig.Sync)
+	if path == "" {
+		fmt.Println("No network key; this vault syncs in the public libp2p network")
+		return nil
+	}
+	psk, err := p2p.LoadNetworkKey(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔒 Network key: %s\n", vaultConfig.Sync.NetworkKey)
+	fmt.Printf("   Fingerprint: %s\n", p2p.NetworkKeyFingerprint(psk))
+	return nil
+}
+
+func init() {
+	syncCmd.AddCommand(syncNetworkKeyCmd)
+
+	syncNetworkKeyCmd.Flags().Bool("generate", false, "Generate a new network key")
+	syncNetworkKeyCmd.Flags().String("import", "", "Use the network key in this file")
+	syncNetworkKeyCmd.Flags().Bool("force", false, "Replace an existing network key")
+}
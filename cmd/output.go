@@ -0,0 +1,113 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported values for the global --output flag
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// getOutputFormat reads and validates the global --output flag
+func getOutputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	format = strings.ToLower(strings.TrimSpace(format))
+
+	switch format {
+	case "", outputTable:
+		return outputTable, nil
+	case outputJSON, outputYAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid output format '%s' (must be one of: table, json, yaml)", format)
+	}
+}
+
+// writeStructured encodes v to w in the given structured format (json or yaml)
+func writeStructured(w io.Writer, format string, v any) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unsupported structured output format: %s", format)
+	}
+}
+
+// structuredList writes a list in a structured format one item at a time, so
+// that long listings are not built in memory first. The output is the same as
+// writeStructured of the whole list.
+type structuredList struct {
+	w      io.Writer
+	format string
+	count  int
+}
+
+// newStructuredList starts a list written to w in format (json or yaml)
+func newStructuredList(w io.Writer, format string) (*structuredList, error) {
+	if format != outputJSON && format != outputYAML {
+		return nil, fmt.Errorf("unsupported structured output format: %s", format)
+	}
+	return &structuredList{w: w, format: format}, nil
+}
+
+// Add writes the next item of the list
+func (l *structuredList) Add(v any) error {
+	l.count++
+	if l.format == outputYAML {
+		// An item is a one-element sequence; encoded back to back they form the list
+		enc := yaml.NewEncoder(l.w)
+		enc.SetIndent(2)
+		if err := enc.Encode([]any{v}); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	data, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	sep := "[\n  "
+	if l.count > 1 {
+		sep = ",\n  "
+	}
+	if _, err := io.WriteString(l.w, sep); err != nil {
+		return err
+	}
+	_, err = l.w.Write(data)
+	return err
+}
+
+// Close ends the list
+func (l *structuredList) Close() error {
+	var end string
+	switch {
+	case l.count == 0:
+		end = "[]\n"
+	case l.format == outputJSON:
+		end = "\n]\n"
+	}
+	_, err := io.WriteString(l.w, end)
+	return err
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestGetOutputFormat(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    string
+		expectError bool
+	}{
+		{value: "", expected: outputTable},
+		{value: "table", expected: outputTable},
+		{value: "JSON", expected: outputJSON},
+		{value: " yaml ", expected: outputYAML},
+		{value: "xml", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("output", "", "")
+			if err := cmd.Flags().Set("output", tt.value); err != nil {
+				t.Fatalf("set flag: %v", err)
+			}
+
+			got, err := getOutputFormat(cmd)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error for %q", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("getOutputFormat(%q) = %q, want %q", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteStructuredLsOutput(t *testing.T) {
+	files := []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+		{FilePath: "b.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+	}
+	out := buildLsOutput(files, buildChunkIndex(files))
+
+	var buf bytes.Buffer
+	if err := writeStructured(&buf, outputJSON, out); err != nil {
+		t.Fatalf("json encode: %v", err)
+	}
+	var decoded []lsFileOutput
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("json decode: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0].Path != "docs/a.txt" {
+		t.Fatalf("unexpected decoded output: %+v", decoded)
+	}
+	if decoded[0].Dedup.SharedChunks != 1 || len(decoded[0].Dedup.SharedWith) != 1 || decoded[0].Dedup.SharedWith[0] != "docs/b.txt" {
+		t.Errorf("unexpected dedup stats: %+v", decoded[0].Dedup)
+	}
+	if decoded[0].Tags == nil {
+		t.Error("tags should encode as an empty list, not null")
+	}
+
+	buf.Reset()
+	if err := writeStructured(&buf, outputYAML, out); err != nil {
+		t.Fatalf("yaml encode: %v", err)
+	}
+	if !strings.Contains(buf.String(), "shared_with:") {
+		t.Errorf("yaml output missing shared_with: %s", buf.String())
+	}
+	var yamlDecoded []map[string]any
+	if err := yaml.Unmarshal(buf.Bytes(), &yamlDecoded); err != nil || len(yamlDecoded) != 2 {
+		t.Fatalf("yaml decode failed: %v (%d entries)", err, len(yamlDecoded))
+	}
+
+	if err := writeStructured(&buf, outputTable, out); err == nil {
+		t.Error("expected error for table format")
+	}
+}
+
+func TestStructuredListMatchesWriteStructured(t *testing.T) {
+	files := []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Size: 10, Tags: []string{"x"}, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+		{FilePath: "b.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+	}
+	for _, format := range []string{outputJSON, outputYAML} {
+		for _, out := range [][]lsFileOutput{{}, buildLsOutput(files[:1], nil), buildLsOutput(files, buildChunkIndex(files))} {
+			var want, got bytes.Buffer
+			if err := writeStructured(&want, format, out); err != nil {
+				t.Fatal(err)
+			}
+			list, err := newStructuredList(&got, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range out {
+				if err := list.Add(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := list.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("%s list of %d items:\n%s\nwant:\n%s", format, len(out), got.String(), want.String())
+			}
+		}
+	}
+
+	if _, err := newStructuredList(&bytes.Buffer{}, outputTable); err == nil {
+		t.Error("expected error for table format")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+// pairCmd represents the pair command
+var pairCmd = &cobra.Command{
+	Use:   "pair (--invite | --accept <token>)",
+	Short: "Pair with another vault using a one-time invitation",
+	Long: `Make two vaults trust each other without comparing fingerprints by hand.
+
+On the first machine, --invite prints a one-time token holding this node's
+peer ID, addresses and a random secret, signed with the vault's sync key, and
+waits for it to be used. On the second machine, --accept <token> connects to
+the inviting node and both prove they hold the secret. Each vault then saves
+the other as a trusted peer.
+
+With --serve the inviting node keeps serving the vault after pairing until
+interrupted, so a new vault can be made from it with 'sietch clone --invite'.
+
+A token can be used once and expires after --ttl. Send it over a channel you
+trust: anyone holding it before it is used can pair with the vault.
+
+Examples:
+  sietch pair --invite                # Print a token valid for 10 minutes
+  sietch pair --invite --ttl 2m       # Print a token valid for 2 minutes
+  sietch pair --invite --serve        # Then serve the vault to a clone until interrupted
+  sietch pair --accept sietch-invite1:...`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		invite, _ := cmd.Flags().GetBool("invite")
+		token, _ := cmd.Flags().GetString("accept")
+		if invite == (token != "") {
+			return fmt.Errorf("use exactly one of --invite and --accept")
+		}
+		if serve, _ := cmd.Flags().GetBool("serve"); serve && !invite {
+			return fmt.Errorf("--serve only applies to --invite")
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return fmt.Errorf("pair does not support --dry-run")
+		}
+
+		var inv *p2p.Invitation
+		if token != "" {
+			var err error
+			if inv, err = p2p.ParseInvitation(token); err != nil {
+				return err
+			}
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultCfg, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault config: %v", err)
+		}
+		if vaultCfg.Sync.RSA == nil {
+			return fmt.Errorf("sync is not configured for this vault, pairing needs its sync keys")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signalChan
+			fmt.Println("\nReceived interrupt signal, shutting down...")
+			cancel()
+		}()
+
+		port, _ := cmd.Flags().GetInt("port")
+		listen, err := listenAddrsFromFlags(cmd, &vaultCfg.Sync)
+		if err != nil {
+			return err
+		}
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		host, syncService, err := startSyncNode(ctx, vaultRoot, vaultCfg, port, listen, verbose)
+		if err != nil {
+			return err
+		}
+		defer host.Close()
+
+		if inv == nil {
+			ttl, _ := cmd.Flags().GetDuration("ttl")
+			if ttl <= 0 {
+				return fmt.Errorf("--ttl must be positive")
+			}
+			if inv, err = syncService.Invite(ttl); err != nil {
+				return err
+			}
+			fmt.Printf("\n🎟️  Invitation (valid until %s, one use):\n\n%s\n\n", inv.Expires.Format("15:04:05"), inv.Token())
+			fmt.Println("Run 'sietch pair --accept <token>' in the other vault. Waiting...")
+
+			peerID, err := inv.Wait(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✅ Paired with peer %s; both vaults now trust each other\n", peerID.String())
+			if serve, _ := cmd.Flags().GetBool("serve"); serve {
+				fmt.Println("Serving the vault to trusted peers until interrupted...")
+				<-ctx.Done()
+			}
+			return nil
+		}
+
+		label := inv.PeerID.String()
+		if inv.Name != "" {
+			label = fmt.Sprintf("%s (%s)", inv.Name, label)
+		}
+		fmt.Printf("🔄 Pairing with %s...\n", label)
+		peerID, err := syncService.AcceptInvitation(ctx, inv)
+		if err != nil {
+			return fmt.Errorf("pairing failed: %v", err)
+		}
+		fingerprint, _ := syncService.GetPeerFingerprint(peerID)
+		fmt.Printf("✅ Paired with %s\n   Fingerprint: %s\n", label, fingerprint)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pairCmd)
+
+	pairCmd.Flags().Bool("invite", false, "Print a one-time invitation token and wait for it to be accepted")
+	pairCmd.Flags().String("accept", "", "Pair using an invitation token from another vault")
+	pairCmd.Flags().Bool("serve", false, "Keep serving the vault after pairing, for 'sietch clone --invite' (only with --invite)")
+	pairCmd.Flags().Duration("ttl", p2p.DefaultInvitationTTL, "How long the invitation can be accepted")
+	pairCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+	pairCmd.Flags().StringSlice("listen", nil, "Multiaddrs to listen on instead of sync.listen_addrs (repeatable)")
+	pairCmd.Flags().Bool("no-listen", false, "Accept no incoming connections, only dial out (only with --accept)")
+	pairCmd.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+}
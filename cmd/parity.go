@@ -0,0 +1,525 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/parity"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// parityCmd groups the commands managing erasure-coded parity
+var parityCmd = &cobra.Command{
+	Use:   "parity",
+	Short: "Protect chunks with parity shards that rebuild them without peers",
+	Long: `Build, check and use Reed–Solomon parity over the chunks of the vault.
+
+Chunks are grouped, 10 to a group by default, and each group gets 2 parity
+shards kept in .sietch/parity. Any 2 chunks or parity shards of a group can
+then be lost or corrupted and rebuilt from the rest, with no peer reachable,
+for 20% more disk space. Set parity.data_shards and parity.parity_shards to
+trade space for protection.
+
+Parity covers the chunks stored when it was built. Run 'sietch parity build'
+again after adding files, or after 'sietch dedup gc', to protect new chunks
+and regroup those whose groups lost chunks the vault no longer needs.
+
+Examples:
+  sietch parity build                  # Protect every chunk not yet in a group
+  sietch parity build --parity 3       # Groups that survive losing 3 chunks
+  sietch parity verify                 # Check chunks and parity shards
+  sietch parity repair                 # Rebuild damaged chunks from parity`,
+}
+
+var parityBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Compute parity for the chunks that have none",
+	Long: `Group the chunks that are not protected yet and compute their parity shards.
+
+Only chunks that pass their hash check are grouped; damaged ones are skipped
+and reported, to be fixed with 'sietch repair' first. Groups holding chunks
+the vault no longer references are replaced. Existing groups keep their
+shape; --rebuild regroups every chunk with the current one.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, refs, err := loadParityVault()
+		if err != nil {
+			return err
+		}
+		dataShards, parityShards := vaultConfig.Parity.Shards()
+		if cmd.Flags().Changed("data") {
+			dataShards, _ = cmd.Flags().GetInt("data")
+		}
+		if cmd.Flags().Changed("parity") {
+			parityShards, _ = cmd.Flags().GetInt("parity")
+		}
+		if _, err := parity.NewCodec(dataShards, parityShards); err != nil {
+			return fmt.Errorf("invalid parity group shape: %v", err)
+		}
+		rebuild, _ := cmd.Flags().GetBool("rebuild")
+
+		groups, err := parity.LoadGroups(vaultRoot)
+		if err != nil {
+			return err
+		}
+		kept, stale := planParityGroups(groups, refs, rebuild)
+		covered := make(map[string]bool)
+		for _, g := range kept {
+			for _, c := range g.Chunks {
+				covered[c.Name] = true
+			}
+		}
+		var pending []string
+		for name := range refs {
+			if !covered[name] {
+				pending = append(pending, name)
+			}
+		}
+		sort.Strings(pending)
+
+		if len(pending) == 0 && len(stale) == 0 {
+			fmt.Printf("✓ Parity is up to date: %d group(s) cover every chunk\n", len(kept))
+			return nil
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would protect %d chunk(s) in groups of %d chunks and %d parity shards\n", len(pending), dataShards, parityShards)
+			if len(stale) > 0 {
+				fmt.Printf("[dry-run] would replace %d group(s)\n", len(stale))
+			}
+			return nil
+		}
+
+		// A damaged chunk may be rebuilt only from the group being replaced
+		for _, g := range stale {
+			status, err := g.Check(vaultRoot)
+			if err != nil {
+				return err
+			}
+			if len(parityRepairs(status, refs)) > 0 {
+				return fmt.Errorf("parity group %s is damaged, run 'sietch parity repair' before rebuilding it", g.ID)
+			}
+		}
+
+		txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "parity build", "chunks": len(pending)})
+		if err != nil {
+			return fmt.Errorf("begin transaction: %v", err)
+		}
+		committed := false
+		defer func() {
+			if !committed {
+				_ = txn.Rollback()
+				fmt.Println("txn rollback; parity build did not complete")
+			}
+		}()
+
+		for _, g := range stale {
+			if err := stageParityGroupDelete(txn, g); err != nil {
+				return err
+			}
+		}
+
+		var (
+			names                     []string
+			chunks                    [][]byte
+			built, protected, skipped int
+			parityBytes               int64
+		)
+		flush := func() error {
+			if len(names) == 0 {
+				return nil
+			}
+			g, shards, err := parity.NewGroup(names, chunks, parityShards)
+			if err != nil {
+				return fmt.Errorf("failed to compute parity: %v", err)
+			}
+			if err := stageParityGroup(txn, g, shards); err != nil {
+				return err
+			}
+			built++
+			protected += len(names)
+			parityBytes += g.ShardSize * int64(len(g.Parity))
+			names, chunks = nil, nil
+			return nil
+		}
+		for _, name := range pending {
+			data, err := os.ReadFile(fs.LocateChunk(vaultRoot, name))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read chunk %s: %v", name, err)
+			}
+			if err != nil || chunk.VerifyStored(data, refs[name], *vaultConfig) != nil {
+				skipped++
+				continue
+			}
+			names = append(names, name)
+			chunks = append(chunks, data)
+			if len(names) == dataShards {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		if err := txn.Commit(); err != nil {
+			return fmt.Errorf("commit parity build transaction: %v", err)
+		}
+		committed = true
+		recordAudit(vaultRoot, audit.OpParityBuild, map[string]string{
+			"groups":   strconv.Itoa(built),
+			"chunks":   strconv.Itoa(protected),
+			"replaced": strconv.Itoa(len(stale)),
+		})
+
+		fmt.Printf("✓ Built %d parity group(s) protecting %d chunk(s) with %s of parity\n", built, protected, util.HumanReadableSize(parityBytes))
+		if len(stale) > 0 {
+			fmt.Printf("✓ Replaced %d group(s) holding chunks no longer in the vault\n", len(stale))
+		}
+		if skipped > 0 {
+			fmt.Printf("⚠️  Skipped %d missing or corrupt chunk(s), run 'sietch repair' and build again\n", skipped)
+		}
+		return nil
+	},
+}
+
+var parityVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check chunks and parity shards against their parity groups",
+	Long: `Read every parity group with its chunks and parity shards and report damage.
+
+Each chunk and parity shard is checked against the SHA-256 recorded in its
+group, so no passphrase is needed. Exits with an error if anything needs
+'sietch parity repair'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, _, refs, err := loadParityVault()
+		if err != nil {
+			return err
+		}
+		groups, err := parity.LoadGroups(vaultRoot)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			fmt.Println("No parity groups yet, run 'sietch parity build'")
+			return nil
+		}
+
+		fmt.Printf("🔍 Checking %d parity group(s)...\n", len(groups))
+		covered := make(map[string]bool)
+		var repairable, unrecoverable int
+		for _, g := range groups {
+			for _, c := range g.Chunks {
+				covered[c.Name] = true
+			}
+			status, err := g.Check(vaultRoot)
+			if err != nil {
+				return err
+			}
+			repairs := parityRepairs(status, refs)
+			if len(repairs) == 0 {
+				continue
+			}
+			if status.Recoverable() {
+				repairable++
+				fmt.Printf("  group %s: %d damaged, can be rebuilt\n", g.ID, len(repairs))
+			} else {
+				unrecoverable++
+				fmt.Printf("  group %s: %d damaged, more than its %d parity shard(s) can rebuild\n", g.ID, len(status.Damage), len(g.Parity))
+			}
+			printParityDamage(repairs)
+		}
+
+		uncovered := 0
+		for name := range refs {
+			if !covered[name] {
+				uncovered++
+			}
+		}
+		if uncovered > 0 {
+			fmt.Printf("⚠️  %d chunk(s) have no parity, run 'sietch parity build'\n", uncovered)
+		}
+		if repairable+unrecoverable > 0 {
+			if unrecoverable > 0 {
+				return fmt.Errorf("%d parity group(s) damaged, %d beyond repair from parity; run 'sietch parity repair' and 'sietch repair'", repairable+unrecoverable, unrecoverable)
+			}
+			return fmt.Errorf("%d parity group(s) damaged; run 'sietch parity repair'", repairable)
+		}
+		fmt.Printf("✓ All %d parity group(s) are intact\n", len(groups))
+		return nil
+	},
+}
+
+var parityRepairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Rebuild missing or corrupt chunks and parity shards from parity",
+	Long: `Rebuild the damaged chunks and parity shards of every parity group that has
+no more damage than parity shards.
+
+Each rebuilt chunk is checked against the hash recorded in its manifest
+before it is written back, and everything is written in one transaction.
+Chunks in groups with more damage can still be fetched from trusted peers
+with 'sietch repair'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		vaultRoot, vaultConfig, refs, err := loadParityVault()
+		if err != nil {
+			return err
+		}
+		groups, err := parity.LoadGroups(vaultRoot)
+		if err != nil {
+			return err
+		}
+
+		var txn *atomic.Transaction
+		committed := false
+		defer func() {
+			if txn != nil && !committed {
+				_ = txn.Rollback()
+				fmt.Println("txn rollback; parity repair did not complete")
+			}
+		}()
+
+		var rebuiltChunks, rebuiltParity, unrecoverable int
+		for _, g := range groups {
+			status, err := g.Check(vaultRoot)
+			if err != nil {
+				return err
+			}
+			repairs := parityRepairs(status, refs)
+			if len(repairs) == 0 {
+				continue
+			}
+			if !status.Recoverable() {
+				unrecoverable++
+				fmt.Printf("✗ group %s: %d damaged, more than its %d parity shard(s) can rebuild\n", g.ID, len(status.Damage), len(g.Parity))
+				printParityDamage(repairs)
+				continue
+			}
+			if dryRun {
+				for _, d := range repairs {
+					fmt.Printf("[dry-run] would rebuild %s %s\n", parityShardKind(d), d.Shard.Name)
+				}
+				continue
+			}
+
+			rebuilt, err := status.Rebuild()
+			if err != nil {
+				return err
+			}
+			if txn == nil {
+				txn, err = atomic.Begin(vaultRoot, map[string]any{"command": "parity repair"})
+				if err != nil {
+					return fmt.Errorf("begin transaction: %v", err)
+				}
+			}
+			for i, d := range status.Damage {
+				if !needsParityRepair(d, refs) {
+					continue
+				}
+				if d.Parity {
+					if err := stageParityShard(txn, d.Shard.Name, rebuilt[i]); err != nil {
+						return err
+					}
+					rebuiltParity++
+				} else {
+					if err := chunk.VerifyStored(rebuilt[i], refs[d.Shard.Name], *vaultConfig); err != nil {
+						return fmt.Errorf("rebuilt chunk %s failed verification: %v", d.Shard.Name, err)
+					}
+					if err := stageChunk(txn, d.Shard.Name, rebuilt[i]); err != nil {
+						return err
+					}
+					rebuiltChunks++
+				}
+				fmt.Printf("✓ Rebuilt %s %s (%s)\n", parityShardKind(d), d.Shard.Name, d.Reason)
+			}
+		}
+
+		if txn != nil {
+			if err := txn.Commit(); err != nil {
+				return fmt.Errorf("commit parity repair transaction: %v", err)
+			}
+			committed = true
+			recordAudit(vaultRoot, audit.OpParityRepair, map[string]string{
+				"chunks": strconv.Itoa(rebuiltChunks),
+				"parity": strconv.Itoa(rebuiltParity),
+			})
+			fmt.Printf("\n✓ Rebuilt %d chunk(s) and %d parity shard(s)\n", rebuiltChunks, rebuiltParity)
+		}
+		if unrecoverable > 0 {
+			return fmt.Errorf("%d parity group(s) have more damage than their parity can rebuild; run 'sietch repair' to fetch the chunks from trusted peers", unrecoverable)
+		}
+		if txn == nil && !dryRun {
+			fmt.Printf("✓ All %d parity group(s) are intact\n", len(groups))
+		}
+		return nil
+	},
+}
+
+// loadParityVault returns the vault containing the working directory, its
+// configuration and the chunks it must keep by storage name
+func loadParityVault() (string, *config.VaultConfig, map[string]config.ChunkRef, error) {
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("not inside a vault: %v", err)
+	}
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create vault manager: %v", err)
+	}
+	vaultConfig, err := manager.GetConfig()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	if err := fs.CheckChunkStore(vaultRoot); err != nil {
+		return "", nil, nil, err
+	}
+	files, err := manager.ReferencingFiles()
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to get vault manifest: %v", err)
+	}
+	refs := make(map[string]config.ChunkRef)
+	for _, file := range files {
+		for _, ref := range file.Chunks {
+			if name := chunk.StorageName(ref); name != "" {
+				refs[name] = ref
+			}
+		}
+	}
+	return vaultRoot, vaultConfig, refs, nil
+}
+
+// planParityGroups splits groups into those kept and those to replace: the
+// groups holding a chunk the vault no longer references or another group
+// already covers, or every group with rebuild
+func planParityGroups(groups []*parity.Group, refs map[string]config.ChunkRef, rebuild bool) (kept, stale []*parity.Group) {
+	covered := make(map[string]bool)
+	for _, g := range groups {
+		keep := !rebuild
+		for _, c := range g.Chunks {
+			if _, ok := refs[c.Name]; !ok || covered[c.Name] {
+				keep = false
+			}
+		}
+		if !keep {
+			stale = append(stale, g)
+			continue
+		}
+		for _, c := range g.Chunks {
+			covered[c.Name] = true
+		}
+		kept = append(kept, g)
+	}
+	return kept, stale
+}
+
+// parityRepairs returns the damage of status that repair rebuilds
+func parityRepairs(status *parity.Status, refs map[string]config.ChunkRef) []parity.Damage {
+	var repairs []parity.Damage
+	for _, d := range status.Damage {
+		if needsParityRepair(d, refs) {
+			repairs = append(repairs, d)
+		}
+	}
+	return repairs
+}
+
+// needsParityRepair reports whether d is a parity shard or a chunk the vault
+// still references; chunks removed by garbage collection stay removed
+func needsParityRepair(d parity.Damage, refs map[string]config.ChunkRef) bool {
+	if d.Parity {
+		return true
+	}
+	_, ok := refs[d.Shard.Name]
+	return ok
+}
+
+func parityShardKind(d parity.Damage) string {
+	if d.Parity {
+		return "parity shard"
+	}
+	return "chunk"
+}
+
+// printParityDamage lists the damaged shards of a group
+func printParityDamage(damage []parity.Damage) {
+	for _, d := range damage {
+		fmt.Printf("    %-8s %s %s\n", d.Reason, parityShardKind(d), d.Shard.Name)
+	}
+}
+
+// stageParityGroup stages the group g and its parity shards
+func stageParityGroup(txn *atomic.Transaction, g *parity.Group, shards [][]byte) error {
+	data, err := g.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode parity group: %v", err)
+	}
+	if err := stageParityFile(txn, parity.GroupRelPath(g.ID), data); err != nil {
+		return err
+	}
+	for i, shard := range shards {
+		if err := stageParityShard(txn, g.Parity[i].Name, shard); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageParityGroupDelete stages the removal of the group g and its parity shards
+func stageParityGroupDelete(txn *atomic.Transaction, g *parity.Group) error {
+	if err := txn.StageDelete(parity.GroupRelPath(g.ID)); err != nil {
+		return fmt.Errorf("stage parity group delete: %v", err)
+	}
+	for _, p := range g.Parity {
+		if err := txn.StageDelete(parity.ShardRelPath(p.Name)); err != nil {
+			return fmt.Errorf("stage parity shard delete: %v", err)
+		}
+	}
+	return nil
+}
+
+// stageParityShard stages the parity shard name with data, replacing any
+// damaged copy
+func stageParityShard(txn *atomic.Transaction, name string, data []byte) error {
+	return stageParityFile(txn, parity.ShardRelPath(name), data)
+}
+
+func stageParityFile(txn *atomic.Transaction, rel string, data []byte) error {
+	w, err := txn.StageReplace(rel)
+	if err != nil {
+		return fmt.Errorf("stage %s: %v", rel, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("write staged %s: %v", rel, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close staged %s: %v", rel, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(parityCmd)
+	parityCmd.AddCommand(parityBuildCmd)
+	parityCmd.AddCommand(parityVerifyCmd)
+	parityCmd.AddCommand(parityRepairCmd)
+
+	parityBuildCmd.Flags().Int("data", config.DefaultParityDataShards, "Chunks per parity group, instead of parity.data_shards")
+	parityBuildCmd.Flags().Int("parity", config.DefaultParityShards, "Parity shards per group, instead of parity.parity_shards")
+	parityBuildCmd.Flags().Bool("rebuild", false, "Regroup every chunk, replacing existing groups")
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/parity"
+)
+
+func TestPlanParityGroups(t *testing.T) {
+	group := func(id string, chunks ...string) *parity.Group {
+		g := &parity.Group{ID: id}
+		for _, c := range chunks {
+			g.Chunks = append(g.Chunks, parity.Shard{Name: c})
+		}
+		return g
+	}
+	refs := map[string]config.ChunkRef{"a": {}, "b": {}, "c": {}}
+	groups := []*parity.Group{
+		group("intact", "a", "b"),
+		group("removed", "c", "gone"), // holds a chunk garbage collection removed
+		group("overlap", "b", "c"),    // b is already covered by the first group
+	}
+
+	kept, stale := planParityGroups(groups, refs, false)
+	if len(kept) != 1 || kept[0].ID != "intact" || len(stale) != 2 {
+		t.Fatalf("planParityGroups kept %v, replaced %v; want only 'intact' kept", kept, stale)
+	}
+	if kept, stale = planParityGroups(groups, refs, true); len(kept) != 0 || len(stale) != 3 {
+		t.Fatalf("planParityGroups with rebuild kept %d, want every group replaced", len(kept))
+	}
+
+	status := &parity.Status{Group: groups[1], Damage: []parity.Damage{
+		{Index: 1, Shard: parity.Shard{Name: "gone"}, Reason: parity.DamageMissing},
+		{Index: 2, Shard: parity.Shard{Name: "removed.p0"}, Parity: true, Reason: parity.DamageCorrupt},
+	}}
+	if repairs := parityRepairs(status, refs); len(repairs) != 1 || !repairs[0].Parity {
+		t.Fatalf("parityRepairs = %+v, want only the parity shard", repairs)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/ui"
+)
+
+// passwdCmd represents the passwd command
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "Change the passphrase protecting the vault key",
+	Long: `Change the passphrase that protects the vault's encryption key.
+
+The vault key is decrypted with the current passphrase and encrypted again
+under the new one, with a fresh salt and the current default KDF parameters.
+The key file and vault.yaml are replaced together in one transaction. The
+vault key itself does not change, so no chunk is re-encrypted and vaults that
+share the key keep syncing.
+
+The current passphrase is read like for any other command; the new one from
+--new-passphrase-file, SIETCH_NEW_PASSPHRASE or a prompt.
+
+Examples:
+  sietch passwd                                   # Prompt for both passphrases
+  sietch passwd --kdf pbkdf2                      # Also switch the KDF
+  sietch passwd --passphrase-file old.txt --new-passphrase-file new.txt`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if !vaultConfig.Encryption.PassphraseProtected {
+			return fmt.Errorf("the vault key is not protected by a passphrase")
+		}
+
+		keyRel, err := vaultKeyRel(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		oldPassphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return err
+		}
+		// Check the current passphrase before asking for a new one
+		if _, err := encryption.LoadVaultKey(*vaultConfig, oldPassphrase); err != nil {
+			return err
+		}
+		newPassphrase, err := ui.GetNewPassphrase(cmd)
+		if err != nil {
+			return err
+		}
+
+		kdf, _ := cmd.Flags().GetString("kdf")
+		wrapped, enc, err := encryption.RewrapVaultKey(*vaultConfig, oldPassphrase, newPassphrase, kdf)
+		if err != nil {
+			return err
+		}
+		vaultConfig.Encryption = enc
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would re-wrap the vault key in %s and update vault.yaml\n", keyRel)
+			return nil
+		}
+		if err := replaceVaultKey(vaultRoot, "passwd", keyRel, wrapped, vaultConfig); err != nil {
+			return err
+		}
+		recordAudit(vaultRoot, audit.OpPassphrase, map[string]string{"key": filepath.ToSlash(keyRel)})
+
+		fmt.Println("✓ Passphrase changed; the vault key and its chunks are unchanged")
+		return nil
+	},
+}
+
+// vaultKeyRel returns the path of the vault's key file relative to vaultRoot.
+// Key files kept outside the vault are refused, since they cannot be replaced
+// in a vault transaction.
+func vaultKeyRel(vaultRoot string, vaultConfig *config.VaultConfig) (string, error) {
+	keyPath, err := filepath.Abs(vaultConfig.Encryption.KeyPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve key path: %v", err)
+	}
+	keyRel, err := filepath.Rel(vaultRoot, keyPath)
+	if err != nil || keyRel == ".." || strings.HasPrefix(keyRel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("key file %s is outside the vault and cannot be replaced safely", keyPath)
+	}
+	return keyRel, nil
+}
+
+// replaceVaultKey writes the re-wrapped key file and vault.yaml in one
+// transaction, so a crash never leaves a key file the config cannot open.
+// command names the command replacing the key in the transaction.
+func replaceVaultKey(vaultRoot, command, keyRel string, wrapped []byte, vaultConfig *config.VaultConfig) error {
+	data, err := yaml.Marshal(vaultConfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal configuration: %v", err)
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": command})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+			fmt.Println("txn rollback; the key file and vault.yaml were not changed")
+		}
+	}()
+
+	files := []struct {
+		rel  string
+		data []byte
+	}{
+		{keyRel, wrapped},
+		{"vault.yaml", data},
+	}
+	for _, f := range files {
+		w, err := txn.StageReplace(filepath.ToSlash(f.rel))
+		if err != nil {
+			return fmt.Errorf("failed to stage %s: %v", f.rel, err)
+		}
+		if _, err := w.Write(f.data); err != nil {
+			w.Close()
+			return fmt.Errorf("failed to write %s: %v", f.rel, err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %v", f.rel, err)
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(passwdCmd)
+
+	passwdCmd.Flags().String("kdf", "", "Key derivation function for the new passphrase: scrypt or pbkdf2 (default: keep the current one)")
+	passwdCmd.Flags().Bool("passphrase-stdin", false, "Read the current passphrase from stdin (for automation)")
+	passwdCmd.Flags().String("passphrase-file", "", "Read the current passphrase from file (file should have 0600 permissions)")
+	passwdCmd.Flags().String("new-passphrase-file", "", "Read the new passphrase from file (file should have 0600 permissions)")
+}
@@ -0,0 +1,162 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// peersCmd groups the commands managing trusted peers and their pinned keys
+var peersCmd = &cobra.Command{
+	Use:   "peers",
+	Short: "Manage trusted peers and their pinned keys",
+	Long: `Manage the peers this vault trusts.
+
+Every trusted peer is pinned to the key it was first trusted with. When a
+pinned peer presents another key, syncs with it are refused with a warning
+and the new key is kept until you accept it with 'sietch peers repin'.
+Verify the new fingerprint with the peer's owner before repinning.
+
+Examples:
+  sietch peers list                                   # Show peers and key changes
+  sietch peers repin laptop                           # Accept laptop's new key
+  sietch peers repin laptop --fingerprint <expected>  # Only accept this key
+  sietch peers check laptop                           # Check laptop still holds its chunks`,
+}
+
+var peersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trusted peers and their pinned fingerprints",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		_, vaultConfig, err := loadGroupConfig()
+		if err != nil {
+			return err
+		}
+
+		peers := peerOutputs(vaultConfig)
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, peers)
+		}
+		if len(peers) == 0 {
+			fmt.Println("No trusted peers")
+			return nil
+		}
+		displayPeers(os.Stdout, peers)
+		return nil
+	},
+}
+
+var peersRepinCmd = &cobra.Command{
+	Use:   "repin <peer>",
+	Short: "Accept the new key a trusted peer presented",
+	Long: `Pin a trusted peer to the new key it presented, replacing the key it was
+pinned to. Only repin once the owner of the peer has confirmed the new
+fingerprint; with --fingerprint the key is only accepted if it matches.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completePeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, vaultConfig, err := loadGroupConfig()
+		if err != nil {
+			return err
+		}
+		id, err := resolveTrustedPeer(vaultConfig, args[0])
+		if err != nil {
+			return err
+		}
+		pinned := vaultConfig.Sync.RSA.TrustedPeer(id.String())
+		previous := pinned.Fingerprint
+		fingerprint, _ := cmd.Flags().GetString("fingerprint")
+		if err := pinned.Repin(fingerprint); err != nil {
+			return err
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would pin %s to %s instead of %s\n", args[0], pinned.Fingerprint, previous)
+			return nil
+		}
+		if err := saveVaultConfigTransactional(vaultRoot, vaultConfig, "sync.rsa.trusted_peers"); err != nil {
+			return err
+		}
+		recordAudit(vaultRoot, audit.OpTrust, map[string]string{
+			"action":      "repin",
+			"peer":        id.String(),
+			"fingerprint": pinned.Fingerprint,
+			"previous":    previous,
+		})
+		fmt.Printf("✓ Pinned %s to %s\n", args[0], pinned.Fingerprint)
+		return nil
+	},
+}
+
+// peerOutput is the structured form of a trusted peer
+type peerOutput struct {
+	ID                 string     `json:"id" yaml:"id"`
+	Name               string     `json:"name,omitempty" yaml:"name,omitempty"`
+	Fingerprint        string     `json:"fingerprint" yaml:"fingerprint"`
+	TrustedSince       time.Time  `json:"trusted_since" yaml:"trusted_since"`
+	PendingFingerprint string     `json:"pending_fingerprint,omitempty" yaml:"pending_fingerprint,omitempty"`
+	KeyChangedAt       *time.Time `json:"key_changed_at,omitempty" yaml:"key_changed_at,omitempty"`
+}
+
+func peerOutputs(vaultConfig *config.VaultConfig) []peerOutput {
+	peers := []peerOutput{}
+	if vaultConfig.Sync.RSA == nil {
+		return peers
+	}
+	for _, p := range vaultConfig.Sync.RSA.TrustedPeers {
+		out := peerOutput{
+			ID:                 p.ID,
+			Name:               p.Name,
+			Fingerprint:        p.Fingerprint,
+			TrustedSince:       p.TrustedSince,
+			PendingFingerprint: p.PendingFingerprint,
+		}
+		if p.KeyChanged() {
+			changed := p.KeyChangedAt
+			out.KeyChangedAt = &changed
+		}
+		peers = append(peers, out)
+	}
+	return peers
+}
+
+func displayPeers(w io.Writer, peers []peerOutput) {
+	for i, p := range peers {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		label := p.ID
+		if p.Name != "" {
+			label = fmt.Sprintf("%s (%s)", p.Name, p.ID)
+		}
+		fmt.Fprintln(w, label)
+		fmt.Fprintf(w, "  Fingerprint:   %s\n", p.Fingerprint)
+		fmt.Fprintf(w, "  Trusted since: %s\n", p.TrustedSince.Format("2006-01-02 15:04:05"))
+		if p.PendingFingerprint != "" {
+			fmt.Fprintf(w, "  ⚠️  KEY CHANGED %s, refused until repinned\n", p.KeyChangedAt.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(w, "  New fingerprint: %s\n", p.PendingFingerprint)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(peersCmd)
+	peersCmd.AddCommand(peersListCmd)
+	peersCmd.AddCommand(peersRepinCmd)
+
+	peersRepinCmd.Flags().String("fingerprint", "", "Only accept the new key if it has this fingerprint")
+}
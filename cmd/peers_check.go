@@ -0,0 +1,137 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+var peersCheckCmd = &cobra.Command{
+	Use:   "check <peer>",
+	Short: "Challenge a peer to prove it still holds its chunks",
+	Long: `Check that a peer still holds the data its manifest claims before relying
+on it as a replica.
+
+A sample of the chunks the peer's manifest references is chosen at random
+among those this vault holds too. The peer must answer a challenge for each
+with a hash over the chunk and a fresh random value, which it can only
+compute from the chunk itself. Chunks the peer no longer holds are reported
+as missing, chunks it holds with other content as corrupt. Chunks only the
+peer holds cannot be checked and are counted as unverifiable.
+
+The peer is given by the name or ID of a trusted peer found on the local
+network, or by its multiaddress. The command fails if any chunk checked is
+missing or corrupt.
+
+Examples:
+  sietch peers check laptop               # Check 32 random chunks
+  sietch peers check laptop --sample 200  # Check a larger sample
+  sietch peers check laptop --all         # Check every chunk that can be checked
+  sietch peers check /ip4/192.168.1.5/tcp/4001/p2p/QmPeer -o json`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completePeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		sample, _ := cmd.Flags().GetInt("sample")
+		if all, _ := cmd.Flags().GetBool("all"); all {
+			sample = 0
+		} else if sample <= 0 {
+			return fmt.Errorf("--sample must be positive, use --all to check every chunk")
+		}
+
+		vaultRoot, vaultCfg, err := loadGroupConfig()
+		if err != nil {
+			return err
+		}
+		if vaultCfg.Sync.RSA == nil {
+			return fmt.Errorf("sync is not configured for this vault, challenging a peer needs its sync keys")
+		}
+
+		// Progress goes to stderr so structured output stays parseable
+		resultOut := os.Stdout
+		if format != outputTable {
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = resultOut }()
+		}
+
+		ctx, cancel := muleContext()
+		defer cancel()
+		h, syncService, peerID, err := connectToPeer(ctx, cmd, vaultRoot, vaultCfg, args[0], "peer")
+		if err != nil {
+			return err
+		}
+		defer h.Close()
+
+		check, err := syncService.CheckPeerStorage(ctx, peerID, sample)
+		if err != nil {
+			return fmt.Errorf("storage check failed: %v", err)
+		}
+
+		var failure error
+		if !check.Healthy() {
+			failure = fmt.Errorf("peer %s failed %d of %d storage challenges", args[0], len(check.Missing)+len(check.Corrupt), check.Checked)
+		}
+		if format != outputTable {
+			if err := writeStructured(resultOut, format, check); err != nil {
+				return err
+			}
+			if failure != nil {
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				return reportedError{failure}
+			}
+			return nil
+		}
+		displayStorageCheck(resultOut, args[0], check)
+		return failure
+	},
+}
+
+// displayStorageCheck reports the outcome of a storage check of the peer
+// named name
+func displayStorageCheck(w io.Writer, name string, check *p2p.StorageCheck) {
+	fmt.Fprintf(w, "Storage check of %s\n", name)
+	fmt.Fprintf(w, "  Referenced:   %d chunks\n", check.Referenced)
+	fmt.Fprintf(w, "  Checked:      %d\n", check.Checked)
+	fmt.Fprintf(w, "  Held:         %d\n", check.Held)
+	fmt.Fprintf(w, "  Missing:      %d\n", len(check.Missing))
+	fmt.Fprintf(w, "  Corrupt:      %d\n", len(check.Corrupt))
+	fmt.Fprintf(w, "  Unverifiable: %d (not held by this vault)\n", check.Unverifiable)
+	for _, hash := range check.Missing {
+		fmt.Fprintf(w, "  ✗ missing %s\n", hash)
+	}
+	for _, hash := range check.Corrupt {
+		fmt.Fprintf(w, "  ✗ corrupt %s\n", hash)
+	}
+
+	switch {
+	case check.Checked == 0:
+		fmt.Fprintln(w, "⚠️  No chunk could be checked: this vault holds none of the peer's chunks")
+	case check.Healthy():
+		fmt.Fprintf(w, "✓ %s proved it holds all %d chunks checked\n", name, check.Checked)
+	default:
+		fmt.Fprintf(w, "⚠️  %s does not hold %d of %d chunks checked, do not rely on it as a replica\n",
+			name, len(check.Missing)+len(check.Corrupt), check.Checked)
+	}
+}
+
+func init() {
+	peersCmd.AddCommand(peersCheckCmd)
+
+	peersCheckCmd.Flags().Int("sample", 32, "Number of chunks to challenge the peer for, chosen at random")
+	peersCheckCmd.Flags().Bool("all", false, "Challenge the peer for every chunk this vault can check")
+	peersCheckCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+	peersCheckCmd.Flags().StringSlice("listen", nil, "Multiaddrs to listen on instead of sync.listen_addrs (repeatable)")
+	peersCheckCmd.Flags().Bool("no-listen", false, "Accept no incoming connections, only dial out to the peer")
+	peersCheckCmd.Flags().IntP("timeout", "t", 60, "Discovery timeout in seconds (for a peer given by name)")
+	peersCheckCmd.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+}
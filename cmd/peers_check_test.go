@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+func TestDisplayStorageCheck(t *testing.T) {
+	var healthy bytes.Buffer
+	displayStorageCheck(&healthy, "laptop", &p2p.StorageCheck{Referenced: 10, Checked: 4, Held: 4, Unverifiable: 6})
+	if !strings.Contains(healthy.String(), "✓ laptop proved it holds all 4 chunks checked") {
+		t.Errorf("expected a healthy summary, got:\n%s", healthy.String())
+	}
+
+	var failed bytes.Buffer
+	displayStorageCheck(&failed, "laptop", &p2p.StorageCheck{
+		Referenced: 3,
+		Checked:    3,
+		Held:       1,
+		Missing:    []string{"hash-a"},
+		Corrupt:    []string{"hash-b"},
+	})
+	out := failed.String()
+	for _, want := range []string{"✗ missing hash-a", "✗ corrupt hash-b", "does not hold 2 of 3 chunks checked"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+
+	var none bytes.Buffer
+	displayStorageCheck(&none, "laptop", &p2p.StorageCheck{Referenced: 2, Unverifiable: 2})
+	if !strings.Contains(none.String(), "No chunk could be checked") {
+		t.Errorf("expected a warning that nothing was checked, got:\n%s", none.String())
+	}
+}
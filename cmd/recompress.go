@@ -0,0 +1,312 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// recompressCmd represents the recompress command
+var recompressCmd = &cobra.Command{
+	Use:   "recompress",
+	Short: "Compress every stored chunk again with another algorithm",
+	Long: `Rewrite the chunks of the vault with another compression algorithm.
+
+Every chunk compressed differently from --to is read, decompressed,
+compressed with the new algorithm and encrypted again if the vault is
+encrypted. The chunk references of all manifests are updated to match and
+the vault's compression setting is changed, so files added later use the new
+algorithm too. Files are never re-added: their chunk boundaries, and so
+deduplication, stay the same.
+
+Chunks, manifests and vault.yaml are committed in one transaction, so an
+interrupted recompress leaves the vault as it was.
+
+Examples:
+  sietch recompress --to zstd
+  sietch recompress --to none            # Store chunks uncompressed
+  sietch recompress --to zstd --dry-run  # Count the chunks to rewrite`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, _ := cmd.Flags().GetString("to")
+		if to == "" {
+			return fmt.Errorf("--to is required (one of %s, %s, %s)", constants.CompressionTypeNone, constants.CompressionTypeGzip, constants.CompressionTypeZstd)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		vaultConfig, err := manager.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := config.CheckWritable(vaultConfig); err != nil {
+			return err
+		}
+
+		previous := vaultConfig.Compression
+		if err := config.SetValue(vaultConfig, "compression", to); err != nil {
+			return err
+		}
+
+		entries, err := manager.GetManifestEntries()
+		if err != nil {
+			return fmt.Errorf("failed to get manifest entries: %v", err)
+		}
+		// Files in the trash are converted too, so they can still be restored
+		trash, err := manager.Trash()
+		if err != nil {
+			return err
+		}
+		plan := planRecompress(append(entries, trashManifestEntries(trash)...), to, previous)
+		if len(plan) == 0 && previous == to {
+			fmt.Printf("✓ Every chunk is already compressed with %s\n", to)
+			return nil
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			var stored int64
+			for _, ref := range plan {
+				stored += storedSize(ref)
+			}
+			fmt.Printf("[dry-run] would recompress %d chunks (%s stored) with %s\n", len(plan), util.HumanReadableSize(stored), to)
+			if previous != to {
+				fmt.Printf("[dry-run] would set compression: %s → %s\n", previous, to)
+			}
+			return nil
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return fmt.Errorf("failed to get passphrase: %v", err)
+		}
+
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		progressMgr := progress.NewManager(progress.Options{Quiet: quiet, Verbose: verbose})
+		ctx := progressMgr.SetupCancellation(context.Background())
+
+		txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "recompress", "to": to, "chunkCount": len(plan)})
+		if err != nil {
+			return fmt.Errorf("begin transaction: %v", err)
+		}
+		committed := false
+		defer func() {
+			if !committed {
+				_ = txn.Rollback()
+				fmt.Println("txn rollback; recompress did not complete")
+			}
+		}()
+
+		r := &retriever{
+			vaultRoot:   vaultRoot,
+			vaultConfig: vaultConfig,
+			passphrase:  passphrase,
+			quiet:       true,
+			progressMgr: progressMgr,
+		}
+		moved, result, err := recompressChunks(ctx, txn, r, plan)
+		progressMgr.Cleanup()
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if !applyRecompressed(&entry.Manifest, moved) {
+				continue
+			}
+			if err := replaceManifestTransactional(txn, vaultRoot, entry.Path, &entry.Manifest); err != nil {
+				return fmt.Errorf("failed to update manifest for %s: %v", entry.Manifest.Destination+entry.Manifest.FilePath, err)
+			}
+			result.Files++
+		}
+		if err := stageRewrittenTrash(txn, vaultRoot, trash, moved); err != nil {
+			return err
+		}
+		if previous != to {
+			if err := stageVaultConfig(txn, vaultConfig); err != nil {
+				return err
+			}
+		}
+
+		if vaultConfig.Deduplication.Enabled {
+			dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+			if err != nil {
+				return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+			}
+			dedupManager.MoveChunks(moved)
+			if err := dedupManager.Save(); err != nil {
+				return fmt.Errorf("failed to save deduplication index: %v", err)
+			}
+		}
+
+		if err := txn.Commit(); err != nil {
+			return fmt.Errorf("commit transaction: %v", err)
+		}
+		committed = true
+		manager.RefreshIndex()
+
+		recordAudit(vaultRoot, audit.OpRecompress, map[string]string{
+			"from":        previous,
+			"to":          to,
+			"chunks":      strconv.Itoa(result.Chunks),
+			"files":       strconv.Itoa(result.Files),
+			"saved_bytes": strconv.FormatInt(result.Before-result.After, 10),
+		})
+		printRecompressResult(result, previous, to)
+		return nil
+	},
+}
+
+// recompressResult summarizes a recompress
+type recompressResult struct {
+	Chunks int   // Chunks rewritten
+	Files  int   // Manifests updated
+	Before int64 // Stored bytes of the rewritten chunks before
+	After  int64 // Stored bytes of the rewritten chunks after
+}
+
+// chunkCompression returns the algorithm ref was compressed with. Manifests
+// that predate per-chunk compression types use the vault's setting.
+func chunkCompression(ref config.ChunkRef, vaultCompression string) string {
+	if !ref.Compressed {
+		return constants.CompressionTypeNone
+	}
+	if ref.CompressionType != "" {
+		return ref.CompressionType
+	}
+	return vaultCompression
+}
+
+// planRecompress returns one reference to every stored chunk not compressed
+// with to, in the order manifests first use them
+func planRecompress(entries []*config.ManifestEntry, to, vaultCompression string) []config.ChunkRef {
+	seen := make(map[string]bool)
+	var plan []config.ChunkRef
+	for _, entry := range entries {
+		for _, ref := range entry.Manifest.Chunks {
+			name := chunk.StorageName(ref)
+			if seen[name] || chunkCompression(ref, vaultCompression) == to {
+				continue
+			}
+			seen[name] = true
+			plan = append(plan, ref)
+		}
+	}
+	return plan
+}
+
+// recompressChunks rewrites each chunk of plan in txn with the compression
+// of r's vault configuration. It returns the new reference of every chunk by
+// its old storage name. Chunk files whose name changes, as encrypted chunks'
+// do, are deleted once every chunk has been read.
+func recompressChunks(ctx context.Context, txn *atomic.Transaction, r *retriever, plan []config.ChunkRef) (map[string]config.ChunkRef, *recompressResult, error) {
+	result := &recompressResult{}
+	for _, ref := range plan {
+		result.Before += storedSize(ref)
+	}
+	r.progressMgr.InitTotalProgress(result.Before, "Recompressing chunks")
+
+	moved := make(map[string]config.ChunkRef, len(plan))
+	var renamed []string
+	for _, ref := range plan {
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("operation cancelled")
+		}
+		name := chunk.StorageName(ref)
+		data, err := r.readChunk(ctx, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		newRef, stored, err := chunk.EncodeChunk(data, *r.vaultConfig, r.passphrase)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to recompress chunk %s: %v", name, err)
+		}
+		if newRef.Hash != ref.Hash {
+			return nil, nil, fmt.Errorf("chunk %s hashes to %s with the vault's hash algorithm, manifests record %s", name, newRef.Hash, ref.Hash)
+		}
+		newName := chunk.StorageName(newRef)
+		if err := stageChunk(txn, newName, stored); err != nil {
+			return nil, nil, err
+		}
+		if newName != name {
+			renamed = append(renamed, name)
+		}
+		moved[name] = newRef
+		result.Chunks++
+		result.After += storedSize(newRef)
+		r.progressMgr.UpdateTotalProgress(storedSize(ref))
+	}
+	r.progressMgr.FinishTotalProgress()
+
+	for _, name := range renamed {
+		if err := txn.StageDelete(fs.ChunkRelPath(r.vaultRoot, name)); err != nil {
+			return nil, nil, fmt.Errorf("stage chunk delete: %v", err)
+		}
+	}
+	return moved, result, nil
+}
+
+// applyRecompressed updates the chunks of file rewritten by recompressChunks
+// and reports whether any changed
+func applyRecompressed(file *config.FileManifest, moved map[string]config.ChunkRef) bool {
+	changed := false
+	for i, ref := range file.Chunks {
+		newRef, ok := moved[chunk.StorageName(ref)]
+		if !ok {
+			continue
+		}
+		ref.Compressed = newRef.Compressed
+		ref.CompressionType = newRef.CompressionType
+		ref.CompressedSize = newRef.CompressedSize
+		ref.EncryptedHash = newRef.EncryptedHash
+		ref.EncryptedSize = newRef.EncryptedSize
+		file.Chunks[i] = ref
+		changed = true
+	}
+	return changed
+}
+
+// printRecompressResult reports what a recompress changed
+func printRecompressResult(result *recompressResult, from, to string) {
+	if from != to {
+		fmt.Printf("✓ compression: %s → %s\n", from, to)
+	}
+	fmt.Printf("✓ Recompressed %d chunks of %d file(s) with %s\n", result.Chunks, result.Files, to)
+	saved := result.Before - result.After
+	if saved >= 0 {
+		fmt.Printf("✓ Stored size: %s → %s (saved %s)\n", util.HumanReadableSize(result.Before), util.HumanReadableSize(result.After), util.HumanReadableSize(saved))
+	} else {
+		fmt.Printf("✓ Stored size: %s → %s (grew by %s)\n", util.HumanReadableSize(result.Before), util.HumanReadableSize(result.After), util.HumanReadableSize(-saved))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(recompressCmd)
+
+	recompressCmd.Flags().String("to", "", "Compression algorithm to rewrite chunks with (none, gzip, zstd)")
+	recompressCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	recompressCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
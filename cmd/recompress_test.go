@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestPlanRecompress(t *testing.T) {
+	gzip := config.ChunkRef{Hash: "a", EncryptedHash: "ea", Compressed: true, CompressionType: "gzip"}
+	legacy := config.ChunkRef{Hash: "b", Compressed: true} // Compressed with the vault's setting
+	plain := config.ChunkRef{Hash: "c"}
+	zstd := config.ChunkRef{Hash: "d", Compressed: true, CompressionType: "zstd"}
+	entries := []*config.ManifestEntry{
+		{Manifest: config.FileManifest{FilePath: "one", Chunks: []config.ChunkRef{gzip, legacy, zstd}}},
+		{Manifest: config.FileManifest{FilePath: "two", Chunks: []config.ChunkRef{plain, gzip}}},
+	}
+
+	plan := planRecompress(entries, "zstd", "gzip")
+	var names []string
+	for _, ref := range plan {
+		names = append(names, ref.Hash)
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "c" {
+		t.Errorf("expected chunks a, b and c once each in order of use, got %v", names)
+	}
+
+	if plan := planRecompress(entries, "none", "gzip"); len(plan) != 3 {
+		t.Errorf("expected every compressed chunk to be planned for none, got %d", len(plan))
+	}
+}
+
+func TestApplyRecompressed(t *testing.T) {
+	file := config.FileManifest{Chunks: []config.ChunkRef{
+		{Hash: "a", EncryptedHash: "ea", Size: 100, Index: 0, Offset: 0, Deduplicated: true, Compressed: true, CompressionType: "gzip", CompressedSize: 80, EncryptedSize: 120},
+		{Hash: "b", Size: 50, Index: 1, Offset: 100},
+	}}
+	moved := map[string]config.ChunkRef{
+		"ea": {Hash: "a", EncryptedHash: "ea2", Size: 100, Compressed: true, CompressionType: "zstd", CompressedSize: 60, EncryptedSize: 100},
+	}
+
+	if !applyRecompressed(&file, moved) {
+		t.Fatal("expected the file to change")
+	}
+	want := config.ChunkRef{Hash: "a", EncryptedHash: "ea2", Size: 100, Index: 0, Offset: 0, Deduplicated: true, Compressed: true, CompressionType: "zstd", CompressedSize: 60, EncryptedSize: 100}
+	if file.Chunks[0] != want {
+		t.Errorf("expected %+v, got %+v", want, file.Chunks[0])
+	}
+	if file.Chunks[1].Hash != "b" || file.Chunks[1].Compressed {
+		t.Errorf("expected the untouched chunk to stay as it was, got %+v", file.Chunks[1])
+	}
+	if applyRecompressed(&config.FileManifest{Chunks: []config.ChunkRef{{Hash: "b"}}}, moved) {
+		t.Error("expected a file without moved chunks to stay unchanged")
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -13,17 +14,55 @@ import (
 var recoverCmd = &cobra.Command{
 	Use:   "recover",
 	Short: "Recover incomplete or failed vault transactions",
+	Long: `Resolve transactions interrupted by a crash or power loss.
+
+Commands that change the vault journal their changes under .txn before making
+them. A transaction that was committing when it was interrupted is finished;
+one that had not started committing is rolled back, restoring any files it
+had moved aside. Other commands do this automatically before they start, so
+running recover by hand is only needed to inspect journals with --dry-run or
+to resolve transactions that look like they are still running.
+
+Transactions whose process is still running are skipped. Use --force when a
+process ID has been reused and a stale transaction is reported as running.
+
+Example:
+  sietch recover
+  sietch recover --dry-run
+  sietch recover --force --retention 0`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		vaultRoot, err := fs.FindVaultRoot()
 		if err != nil {
 			return fmt.Errorf("not inside a vault: %v", err)
 		}
+		force, _ := cmd.Flags().GetBool("force")
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			incomplete, err := atomic.Incomplete(vaultRoot)
+			if err != nil {
+				return err
+			}
+			if len(incomplete) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No interrupted transactions")
+				return nil
+			}
+			for _, j := range incomplete {
+				fmt.Fprintf(cmd.OutOrStdout(), "[dry-run] %s\n", describeTransaction(j, force))
+			}
+			return nil
+		}
+
 		retention, _ := cmd.Flags().GetDuration("retention")
-		res, err := atomic.Recover(vaultRoot, retention)
+		recoverFn := atomic.Recover
+		if force {
+			recoverFn = atomic.RecoverAll
+		}
+		res, err := recoverFn(vaultRoot, retention)
 		if err != nil {
 			return err
 		}
-		fmt.Fprintf(cmd.OutOrStdout(), "Recovery complete. Resumed=%d RolledBack=%d Purged=%d Errors=%d\n", res.ResumedCommits, res.RolledBack, res.Purged, len(res.Errors))
+		fmt.Fprintf(cmd.OutOrStdout(), "Recovery complete. Resumed=%d RolledBack=%d Purged=%d InProgress=%d Errors=%d\n", res.ResumedCommits, res.RolledBack, res.Purged, res.InProgress, len(res.Errors))
 		for _, e := range res.Errors {
 			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\n", e)
 		}
@@ -31,7 +70,73 @@ var recoverCmd = &cobra.Command{
 	},
 }
 
+// describeTransaction explains what recover would do with an interrupted transaction
+func describeTransaction(j *atomic.Journal, force bool) string {
+	action := "would roll back"
+	switch {
+	case j.Running() && !force:
+		action = fmt.Sprintf("would skip, process %d is still running", j.PID)
+	case j.State == atomic.StateCommitting:
+		action = "would finish committing"
+	}
+	command, _ := j.Metadata["command"].(string)
+	if command == "" {
+		command = "unknown command"
+	}
+	return fmt.Sprintf("%s (%s, %s, %d files, started %s): %s",
+		j.ID, command, j.State, len(j.Entries), j.StartedAt.Local().Format(time.RFC3339), action)
+}
+
+// autoRecover resolves transactions left behind by an interrupted command
+// before another command touches the vault. Commands that do not operate on
+// an existing vault are left alone, as is anything run with --dry-run.
+func autoRecover(cmd *cobra.Command) error {
+	switch cmd {
+	case recoverCmd, initCmd, cloneCmd:
+		return nil
+	}
+	switch cmd.Name() {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return nil
+	}
+
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil || !fs.IsVaultInitialized(vaultRoot) {
+		return nil
+	}
+
+	incomplete, err := atomic.Incomplete(vaultRoot)
+	if err != nil || len(incomplete) == 0 {
+		// Unreadable journals are reported by 'sietch recover'
+		return nil
+	}
+
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		fmt.Fprintf(os.Stderr, "Note: %d interrupted transaction(s) found, run 'sietch recover' to resolve them\n", len(incomplete))
+		return nil
+	}
+
+	l, err := acquireVaultLock(cmd, vaultRoot)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	res, err := atomic.Recover(vaultRoot, 0)
+	if err != nil {
+		return fmt.Errorf("failed to recover interrupted transactions: %v", err)
+	}
+	if res.ResumedCommits > 0 || res.RolledBack > 0 {
+		fmt.Fprintf(os.Stderr, "Recovered interrupted transactions: %d finished, %d rolled back\n", res.ResumedCommits, res.RolledBack)
+	}
+	for _, e := range res.Errors {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", e)
+	}
+	return nil
+}
+
 func init() {
 	recoverCmd.Flags().Duration("retention", 24*time.Hour, "Retention window before purging finished transaction journals")
+	recoverCmd.Flags().Bool("force", false, "Also resolve transactions whose process appears to still be running")
 	rootCmd.AddCommand(recoverCmd)
 }
@@ -0,0 +1,333 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// reencryptCmd represents the reencrypt command
+var reencryptCmd = &cobra.Command{
+	Use:   "reencrypt",
+	Short: "Encrypt every stored chunk again with a new key and cipher",
+	Long: `Migrate the vault to another cipher: from AES-CBC to AES-GCM, or from AES
+to ChaCha20-Poly1305.
+
+A new random vault key is generated for the cipher and, in passphrase
+protected vaults, wrapped under the current passphrase. Every chunk is then
+decrypted with the old key and encrypted with the new one, --batch-size
+chunks at a time. Manifests are updated to the new chunk names, and the key
+file and vault.yaml are replaced only after all chunks are converted. All of
+it is committed in one transaction, so an interrupted reencrypt leaves the
+vault as it was.
+
+The vault key changes, so:
+  - key backups and mnemonic words made before no longer open the vault;
+    export the key again afterwards
+  - peers that share the old key cannot read the new chunks until they are
+    migrated too
+
+Vaults that encrypt their manifests cannot be migrated yet.
+
+Examples:
+  sietch reencrypt --to aes-gcm             # Leave AES-CBC
+  sietch reencrypt --to chacha20
+  sietch reencrypt --to chacha20 --dry-run  # Count the chunks to convert`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		to, _ := cmd.Flags().GetString("to")
+		if to != encryption.CipherAESGCM && to != encryption.CipherChaCha20 {
+			return fmt.Errorf("--to must be %s or %s", encryption.CipherAESGCM, encryption.CipherChaCha20)
+		}
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		if batchSize < 1 {
+			return fmt.Errorf("--batch-size must be at least 1")
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		vaultConfig, err := manager.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := config.CheckWritable(vaultConfig); err != nil {
+			return err
+		}
+
+		from := encryption.CipherOf(vaultConfig.Encryption)
+		switch {
+		case from == "":
+			return fmt.Errorf("reencrypt migrates aes and chacha20 vaults, this vault uses %s encryption", vaultConfig.Encryption.Type)
+		case from == to:
+			fmt.Printf("✓ The vault is already encrypted with %s\n", to)
+			return nil
+		case vaultConfig.Encryption.EncryptManifests:
+			return fmt.Errorf("vaults that encrypt their manifests cannot be re-encrypted yet")
+		}
+		keyRel, err := vaultKeyRel(vaultRoot, vaultConfig)
+		if err != nil {
+			return err
+		}
+
+		entries, err := manager.GetManifestEntries()
+		if err != nil {
+			return fmt.Errorf("failed to get manifest entries: %v", err)
+		}
+		// Files in the trash are converted too, so they can still be restored
+		trash, err := manager.Trash()
+		if err != nil {
+			return err
+		}
+		plan := planReencrypt(append(entries, trashManifestEntries(trash)...))
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			var stored int64
+			for _, ref := range plan {
+				stored += storedSize(ref)
+			}
+			fmt.Printf("[dry-run] would re-encrypt %d chunks (%s stored) with %s\n", len(plan), util.HumanReadableSize(stored), to)
+			fmt.Printf("[dry-run] would replace the vault key in %s and set the cipher: %s → %s\n", keyRel, from, to)
+			return nil
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return fmt.Errorf("failed to get passphrase: %v", err)
+		}
+		// Check the passphrase before any chunk is read
+		if _, err := encryption.LoadVaultKey(*vaultConfig, passphrase); err != nil {
+			return err
+		}
+		key, keyFile, enc, err := encryption.NewVaultKey(vaultConfig.Encryption, to, passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to generate the new vault key: %v", err)
+		}
+		newConfig := *vaultConfig
+		newConfig.Encryption = enc
+
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		progressMgr := progress.NewManager(progress.Options{Quiet: quiet, Verbose: verbose})
+		ctx := progressMgr.SetupCancellation(context.Background())
+
+		txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "reencrypt", "from": from, "to": to, "chunkCount": len(plan)})
+		if err != nil {
+			return fmt.Errorf("begin transaction: %v", err)
+		}
+		committed := false
+		defer func() {
+			if !committed {
+				_ = txn.Rollback()
+				fmt.Println("txn rollback; reencrypt did not complete")
+			}
+		}()
+
+		// Chunks are read with the configuration on disk, which keeps the
+		// old key until the transaction commits
+		r := &retriever{
+			vaultRoot:   vaultRoot,
+			vaultConfig: vaultConfig,
+			passphrase:  passphrase,
+			quiet:       true,
+			progressMgr: progressMgr,
+		}
+		moved, result, err := reencryptChunks(ctx, txn, r, plan, newConfig, key, batchSize)
+		progressMgr.Cleanup()
+		if err != nil {
+			return err
+		}
+
+		// Only the chunk names and encrypted sizes change
+		for _, entry := range entries {
+			if !applyRecompressed(&entry.Manifest, moved) {
+				continue
+			}
+			if err := replaceManifestTransactional(txn, vaultRoot, entry.Path, &entry.Manifest); err != nil {
+				return fmt.Errorf("failed to update manifest for %s: %v", entry.Manifest.Destination+entry.Manifest.FilePath, err)
+			}
+			result.Files++
+		}
+		if err := stageRewrittenTrash(txn, vaultRoot, trash, moved); err != nil {
+			return err
+		}
+
+		// The key and the settings that open it go last, once every chunk is converted
+		w, err := txn.StageReplace(filepath.ToSlash(keyRel))
+		if err != nil {
+			return fmt.Errorf("failed to stage %s: %v", keyRel, err)
+		}
+		if _, err := w.Write(keyFile); err != nil {
+			w.Close()
+			return fmt.Errorf("failed to write %s: %v", keyRel, err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %v", keyRel, err)
+		}
+		if err := stageVaultConfig(txn, &newConfig); err != nil {
+			return err
+		}
+
+		if vaultConfig.Deduplication.Enabled {
+			dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+			if err != nil {
+				return fmt.Errorf("failed to initialize deduplication manager: %v", err)
+			}
+			dedupManager.MoveChunks(moved)
+			if err := dedupManager.Save(); err != nil {
+				return fmt.Errorf("failed to save deduplication index: %v", err)
+			}
+		}
+
+		if err := txn.Commit(); err != nil {
+			return fmt.Errorf("commit transaction: %v", err)
+		}
+		committed = true
+		manager.RefreshIndex()
+
+		recordAudit(vaultRoot, audit.OpReencrypt, map[string]string{
+			"from":   from,
+			"to":     to,
+			"chunks": strconv.Itoa(result.Chunks),
+			"files":  strconv.Itoa(result.Files),
+			"key":    filepath.ToSlash(keyRel),
+		})
+		fmt.Printf("✓ cipher: %s → %s\n", from, to)
+		fmt.Printf("✓ Re-encrypted %d chunks of %d file(s) under a new vault key\n", result.Chunks, result.Files)
+		fmt.Println("⚠️  Key backups made before no longer open this vault; run 'sietch keys export' again")
+		return nil
+	},
+}
+
+// reencryptResult summarizes a reencrypt
+type reencryptResult struct {
+	Chunks int // Chunks re-encrypted
+	Files  int // Manifests updated
+}
+
+// planReencrypt returns one reference to every stored chunk, in the order
+// manifests first use them
+func planReencrypt(entries []*config.ManifestEntry) []config.ChunkRef {
+	seen := make(map[string]bool)
+	var plan []config.ChunkRef
+	for _, entry := range entries {
+		for _, ref := range entry.Manifest.Chunks {
+			name := chunk.StorageName(ref)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			plan = append(plan, ref)
+		}
+	}
+	return plan
+}
+
+// reencryptChunks decrypts each chunk of plan with r and encrypts it with
+// key, the vault key of newConfig, staging the result in txn. Chunks are
+// converted batchSize at a time, a few concurrently within a batch. It returns the
+// new reference of every chunk by its old storage name; the old chunk files
+// are deleted once every chunk has been converted.
+func reencryptChunks(ctx context.Context, txn *atomic.Transaction, r *retriever, plan []config.ChunkRef, newConfig config.VaultConfig, key []byte, batchSize int) (map[string]config.ChunkRef, *reencryptResult, error) {
+	var total int64
+	for _, ref := range plan {
+		total += storedSize(ref)
+	}
+	r.progressMgr.InitTotalProgress(total, "Re-encrypting chunks")
+
+	type converted struct {
+		ref    config.ChunkRef
+		stored []byte
+		err    error
+	}
+	// Reading a chunk of a passphrase protected vault derives its key again,
+	// which takes a lot of memory, so only a few chunks are read at once
+	workers := make(chan struct{}, min(batchSize, runtime.NumCPU()))
+	result := &reencryptResult{}
+	moved := make(map[string]config.ChunkRef, len(plan))
+	for start := 0; start < len(plan); start += batchSize {
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("operation cancelled")
+		}
+		batch := plan[start:min(start+batchSize, len(plan))]
+		out := make([]converted, len(batch))
+		var wg sync.WaitGroup
+		for i, ref := range batch {
+			wg.Add(1)
+			workers <- struct{}{}
+			go func() {
+				defer func() { <-workers; wg.Done() }()
+				data, err := r.readChunk(ctx, ref)
+				if err != nil {
+					out[i].err = err
+					return
+				}
+				out[i].ref, out[i].stored, out[i].err = chunk.EncodeChunkWithKey(data, newConfig, key)
+			}()
+		}
+		wg.Wait()
+
+		// Staged in plan order, so a failure always names the first bad chunk
+		for i, ref := range batch {
+			name := chunk.StorageName(ref)
+			if out[i].err != nil {
+				return nil, nil, fmt.Errorf("failed to re-encrypt chunk %s: %v", name, out[i].err)
+			}
+			newRef := out[i].ref
+			if newRef.Hash != ref.Hash {
+				return nil, nil, fmt.Errorf("chunk %s hashes to %s with the vault's hash algorithm, manifests record %s", name, newRef.Hash, ref.Hash)
+			}
+			if err := stageChunk(txn, chunk.StorageName(newRef), out[i].stored); err != nil {
+				return nil, nil, err
+			}
+			moved[name] = newRef
+			result.Chunks++
+			r.progressMgr.UpdateTotalProgress(storedSize(ref))
+		}
+	}
+	r.progressMgr.FinishTotalProgress()
+
+	for name, newRef := range moved {
+		if chunk.StorageName(newRef) == name {
+			continue
+		}
+		if err := txn.StageDelete(fs.ChunkRelPath(r.vaultRoot, name)); err != nil {
+			return nil, nil, fmt.Errorf("stage chunk delete: %v", err)
+		}
+	}
+	return moved, result, nil
+}
+
+func init() {
+	rootCmd.AddCommand(reencryptCmd)
+
+	reencryptCmd.Flags().String("to", "", "Cipher to migrate the vault to (aes-gcm, chacha20)")
+	reencryptCmd.Flags().Int("batch-size", 64, "Number of chunks to convert at a time")
+	reencryptCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	reencryptCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
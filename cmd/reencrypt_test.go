@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestPlanReencrypt(t *testing.T) {
+	a := config.ChunkRef{Hash: "a", EncryptedHash: "ea"}
+	aAgain := config.ChunkRef{Hash: "a", EncryptedHash: "ea2"} // Same data stored twice
+	b := config.ChunkRef{Hash: "b", EncryptedHash: "eb"}
+	entries := []*config.ManifestEntry{
+		{Manifest: config.FileManifest{FilePath: "one", Chunks: []config.ChunkRef{a, b}}},
+		{Manifest: config.FileManifest{FilePath: "two", Chunks: []config.ChunkRef{b, aAgain, a}}},
+	}
+
+	var names []string
+	for _, ref := range planReencrypt(entries) {
+		names = append(names, ref.EncryptedHash)
+	}
+	if len(names) != 3 || names[0] != "ea" || names[1] != "eb" || names[2] != "ea2" {
+		t.Errorf("expected every chunk file once in order of use, got %v", names)
+	}
+}
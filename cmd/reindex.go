@@ -0,0 +1,53 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// reindexCmd represents the reindex command
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Rebuild the manifest index from the manifest files",
+	Long: `Discard the manifest index and rebuild it from the YAML manifests.
+
+Listing commands such as ls read file metadata from an index in
+.sietch/manifest_index.db instead of parsing every manifest. The index is kept
+up to date automatically and re-reads any manifest whose file changed, so this
+command is only needed if the index file is damaged or after restoring
+manifests with their original timestamps.
+
+Example:
+  sietch reindex`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+
+		count, err := manager.Reindex()
+		if err != nil {
+			return fmt.Errorf("reindex failed: %v", err)
+		}
+
+		fmt.Printf("✓ Indexed %d manifest(s)\n", count)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reindexCmd)
+}
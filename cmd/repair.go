@@ -0,0 +1,292 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	lsui "github.com/substantialcattle5/sietch/internal/ls"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair [peer-address|peer-name|peer-id]",
+	Short: "Restore missing or corrupt chunks from trusted peers",
+	Long: `Check every chunk referenced by the vault and heal damaged ones from peers.
+
+Each chunk is checked against the hash recorded in its manifest. Chunks that
+are missing or fail the check are requested from trusted peers over the chunk
+protocol, validated against the same hash and written back into the vault.
+Chunks are validated without decrypting them, so no passphrase is needed.
+
+Without an argument trusted peers are discovered on the local network until
+everything is repaired or the timeout expires. A peer can also be given by
+multiaddress, trusted name or ID. Untrusted peers are never used.
+
+Examples:
+  sietch repair                 # Check and repair from any trusted peer nearby
+  sietch repair laptop          # Repair from a specific trusted peer
+  sietch repair --dry-run       # Only report damaged chunks`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completePeers,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		// Create a context with cancellation
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Handle interrupts gracefully
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signalChan
+			fmt.Println("\nReceived interrupt signal, shutting down...")
+			cancel()
+		}()
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		vaultCfg, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault config: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		manifest, err := manager.GetManifest()
+		if err != nil {
+			return fmt.Errorf("failed to get vault manifest: %v", err)
+		}
+
+		fmt.Println("🔍 Checking chunks...")
+		damaged, err := chunk.FindDamaged(vaultRoot, manifest.Files, *vaultCfg)
+		if err != nil {
+			return fmt.Errorf("chunk check failed: %v", err)
+		}
+		if len(damaged) == 0 {
+			fmt.Println("✓ All chunks are intact")
+			return nil
+		}
+		printDamagedChunks(damaged)
+
+		if dryRun {
+			fmt.Printf("[dry-run] would fetch %d chunk(s) from trusted peers\n", len(damaged))
+			return nil
+		}
+
+		if vaultCfg.Sync.RSA == nil {
+			return fmt.Errorf("sync is not configured for this vault, repair needs trusted peers")
+		}
+
+		port, _ := cmd.Flags().GetInt("port")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		listen, err := listenAddrsFromFlags(cmd, &vaultCfg.Sync)
+		if err != nil {
+			return err
+		}
+		host, syncService, err := startSyncNode(ctx, vaultRoot, vaultCfg, port, listen, verbose)
+		if err != nil {
+			return err
+		}
+		defer host.Close()
+		if err := applyTimeoutFlags(cmd, syncService); err != nil {
+			return err
+		}
+
+		txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "repair"})
+		if err != nil {
+			return fmt.Errorf("begin transaction: %v", err)
+		}
+		committed := false
+		defer func() {
+			if !committed {
+				_ = txn.Rollback()
+				fmt.Println("txn rollback; repair did not complete")
+			}
+		}()
+
+		remaining := damaged
+		repairFrom := func(peerID peer.ID) error {
+			trusted, err := syncService.VerifyAndExchangeKeys(ctx, peerID)
+			if err != nil {
+				fmt.Printf("✗ Key exchange with %s failed: %v\n", peerID.String(), err)
+				return nil
+			}
+			if !trusted {
+				fmt.Printf("⚠️  Skipping untrusted peer %s\n", peerID.String())
+				return nil
+			}
+			fmt.Printf("🔄 Requesting %d chunk(s) from %s\n", len(remaining), peerID.String())
+			remaining, err = repairFromPeer(ctx, syncService, txn, *vaultCfg, peerID, remaining)
+			return err
+		}
+
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
+			maddr, err := multiaddr.NewMultiaddr(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid peer address: %v", err)
+			}
+			info, err := peer.AddrInfoFromP2pAddr(maddr)
+			if err != nil {
+				return fmt.Errorf("failed to parse peer info: %v", err)
+			}
+			if err := host.Connect(ctx, *info); err != nil {
+				return fmt.Errorf("failed to connect to peer: %v", err)
+			}
+			if err := repairFrom(info.ID); err != nil {
+				return err
+			}
+		} else {
+			var targetPeer peer.ID
+			if len(args) > 0 {
+				targetPeer, err = resolveTrustedPeer(vaultCfg, args[0])
+				if err != nil {
+					return err
+				}
+			}
+
+			discovery, err := p2p.NewFactory().CreateMDNS(host)
+			if err != nil {
+				return fmt.Errorf("failed to create mDNS discovery: %v", err)
+			}
+			if err := discovery.Start(ctx); err != nil {
+				return fmt.Errorf("failed to start mDNS discovery: %v", err)
+			}
+			defer func() { _ = discovery.Stop() }()
+
+			fmt.Println("📡 Searching for trusted peers on local network...")
+
+			timeout, _ := cmd.Flags().GetInt("timeout")
+			timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+			defer timeoutCancel()
+
+			peers := discovery.DiscoveredPeers()
+			if targetPeer != "" {
+				peers = filterDiscoveredPeers(timeoutCtx, peers, targetPeer)
+			}
+
+			tried := make(map[peer.ID]bool)
+		discover:
+			for len(remaining) > 0 {
+				select {
+				case info := <-peers:
+					if info.ID == host.ID() || tried[info.ID] || !syncService.HasPeer(info.ID) {
+						continue
+					}
+					tried[info.ID] = true
+					if err := host.Connect(ctx, info); err != nil {
+						fmt.Printf("✗ Failed to connect to %s: %v\n", info.ID.String(), err)
+						continue
+					}
+					if err := repairFrom(info.ID); err != nil {
+						return err
+					}
+				case <-timeoutCtx.Done():
+					break discover
+				}
+			}
+		}
+
+		if len(remaining) < len(damaged) {
+			if err := txn.Commit(); err != nil {
+				return fmt.Errorf("commit repair: %v", err)
+			}
+		} else {
+			_ = txn.Rollback()
+		}
+		committed = true
+
+		fmt.Printf("\n✓ Repaired %d of %d damaged chunk(s)\n", len(damaged)-len(remaining), len(damaged))
+		if len(remaining) > 0 {
+			fmt.Println("\nStill damaged:")
+			printDamagedChunks(remaining)
+			return fmt.Errorf("%d chunk(s) could not be repaired", len(remaining))
+		}
+		return nil
+	},
+}
+
+// repairFromPeer fetches each damaged chunk from peerID, validates it against its
+// recorded hash and stages it into the transaction. It returns the chunks that
+// the peer could not supply.
+func repairFromPeer(ctx context.Context, syncService *p2p.SyncService, txn *atomic.Transaction, vaultCfg config.VaultConfig, peerID peer.ID, damaged []chunk.DamagedChunk) ([]chunk.DamagedChunk, error) {
+	var remaining []chunk.DamagedChunk
+	for _, d := range damaged {
+		name := chunk.StorageName(d.Ref)
+
+		data, err := syncService.FetchChunk(ctx, peerID, d.Ref)
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n", name, err)
+			remaining = append(remaining, d)
+			continue
+		}
+		if err := chunk.VerifyStored(data, d.Ref, vaultCfg); err != nil {
+			fmt.Printf("✗ %s: peer sent invalid data: %v\n", name, err)
+			remaining = append(remaining, d)
+			continue
+		}
+
+		if err := stageChunk(txn, name, data); err != nil {
+			return nil, err
+		}
+		fmt.Printf("✓ Repaired chunk %s\n", name)
+	}
+	return remaining, nil
+}
+
+// stageChunk stages data as the new content of the named chunk file
+func stageChunk(txn *atomic.Transaction, name string, data []byte) error {
+	rel := fs.ChunkRelPath(txn.VaultRoot(), name)
+	w, err := txn.StageReplace(rel)
+	if err != nil {
+		return fmt.Errorf("stage chunk %s: %v", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("write staged chunk %s: %v", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close staged chunk %s: %v", name, err)
+	}
+	return nil
+}
+
+// printDamagedChunks lists damaged chunks with the files that use them
+func printDamagedChunks(damaged []chunk.DamagedChunk) {
+	for _, d := range damaged {
+		fmt.Printf("  %-8s %s (used by %s)\n", d.Reason, chunk.StorageName(d.Ref), lsui.FormatSharedWith(d.Files, 3))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+
+	repairCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+	repairCmd.Flags().StringSlice("listen", nil, "Multiaddrs to listen on instead of sync.listen_addrs (repeatable)")
+	repairCmd.Flags().Bool("no-listen", false, "Accept no incoming connections, only dial out to peers")
+	repairCmd.Flags().IntP("timeout", "t", 60, "Discovery timeout in seconds (for auto-discovery)")
+	repairCmd.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+	addTimeoutFlags(repairCmd)
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// reshardCmd represents the reshard command
+var reshardCmd = &cobra.Command{
+	Use:   "reshard",
+	Short: "Move stored chunks to another chunk store directory layout",
+	Long: `Spread the chunks of the vault over another number of directory levels.
+
+Many filesystems slow down badly once a directory holds more than about a
+hundred thousand files. With a fanout of 2, the default for new vaults, the
+chunk abcdef... is kept in ab/cd/abcdef..., so no directory holds more than
+a few thousand chunks even in very large vaults. A fanout of 0 keeps every
+chunk in one directory, as vaults created by older versions of sietch do.
+
+The new fanout is saved to vault.yaml first and each chunk is then renamed
+into place; nothing is copied. Chunks are found in either layout while they
+move, so an interrupted reshard leaves a working vault and running the
+command again finishes it.
+
+Examples:
+  sietch reshard                    # Move a flat chunk store to aa/bb/<hash>
+  sietch reshard --fanout 1         # Use one level, aa/<hash>
+  sietch reshard --dry-run          # Count the chunks that would move`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fanout, _ := cmd.Flags().GetInt("fanout")
+		if fanout < 0 || fanout > config.MaxChunkFanout {
+			return fmt.Errorf("invalid --fanout %d: must be between 0 and %d", fanout, config.MaxChunkFanout)
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := fs.CheckChunkStore(vaultRoot); err != nil {
+			return err
+		}
+
+		chunkDir := vaultConfig.ChunkDirectory(vaultRoot)
+		moves, err := planReshard(chunkDir, fanout)
+		if err != nil {
+			return fmt.Errorf("failed to list chunks: %v", err)
+		}
+		previous := vaultConfig.ChunkFanout
+		if len(moves) == 0 && previous == fanout {
+			fmt.Printf("✓ Every chunk is already stored with fanout %d\n", fanout)
+			return nil
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would move %d chunks to fanout %d\n", len(moves), fanout)
+			if previous != fanout {
+				fmt.Printf("[dry-run] would set chunk_fanout: %d → %d\n", previous, fanout)
+			}
+			return nil
+		}
+
+		// Saved first, so chunks written while the rest move already go to the
+		// new layout, and an interrupted reshard is finished by running it again
+		if previous != fanout {
+			vaultConfig.ChunkFanout = fanout
+			if err := saveReshardConfig(vaultRoot, vaultConfig); err != nil {
+				return err
+			}
+		}
+
+		moved, err := applyReshard(moves)
+		removeEmptyShardDirs(chunkDir)
+		if err != nil {
+			return fmt.Errorf("moved %d of %d chunks: %v; run 'sietch reshard' again to finish", moved, len(moves), err)
+		}
+
+		recordAudit(vaultRoot, audit.OpReshard, map[string]string{
+			"from":   strconv.Itoa(previous),
+			"to":     strconv.Itoa(fanout),
+			"chunks": strconv.Itoa(moved),
+		})
+		fmt.Printf("✓ Moved %d chunks to fanout %d\n", moved, fanout)
+		return nil
+	},
+}
+
+// chunkMove is a chunk file renamed by a reshard
+type chunkMove struct {
+	from string
+	to   string
+}
+
+// planReshard returns the renames that lay the chunk store dir out with
+// fanout, ordered by destination
+func planReshard(dir string, fanout int) ([]chunkMove, error) {
+	var moves []chunkMove
+	err := config.WalkChunks(dir, func(name, path string, _ os.DirEntry) error {
+		to := filepath.Join(dir, filepath.FromSlash(config.ShardedChunkName(name, fanout)))
+		if to != path {
+			moves = append(moves, chunkMove{from: path, to: to})
+		}
+		return nil
+	})
+	sort.Slice(moves, func(i, j int) bool { return moves[i].to < moves[j].to })
+	return moves, err
+}
+
+// applyReshard renames each chunk of moves into place and returns how many
+// moved. Chunks are named by their content, so a chunk already stored at its
+// destination is the same chunk and the other copy is removed.
+func applyReshard(moves []chunkMove) (int, error) {
+	moved := 0
+	for _, m := range moves {
+		if _, err := os.Lstat(m.to); err == nil {
+			if err := os.Remove(m.from); err != nil && !os.IsNotExist(err) {
+				return moved, err
+			}
+			moved++
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(m.to), 0o755); err != nil {
+			return moved, err
+		}
+		if err := os.Rename(m.from, m.to); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// removeEmptyShardDirs removes the fanout directories of the chunk store dir
+// that a reshard left empty
+func removeEmptyShardDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || len(entry.Name()) != 2 {
+			continue
+		}
+		shard := filepath.Join(dir, entry.Name())
+		if subEntries, err := os.ReadDir(shard); err == nil {
+			for _, sub := range subEntries {
+				if sub.IsDir() && len(sub.Name()) == 2 {
+					_ = os.Remove(filepath.Join(shard, sub.Name()))
+				}
+			}
+		}
+		// Fails, leaving the directory, unless it is empty
+		_ = os.Remove(shard)
+	}
+}
+
+// saveReshardConfig writes vaultConfig, with its new fanout, to vault.yaml
+func saveReshardConfig(vaultRoot string, vaultConfig *config.VaultConfig) error {
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "reshard", "fanout": vaultConfig.ChunkFanout})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %v", err)
+	}
+	if err := stageVaultConfig(txn, vaultConfig); err != nil {
+		_ = txn.Rollback()
+		return err
+	}
+	if err := txn.Commit(); err != nil {
+		_ = txn.Rollback()
+		return fmt.Errorf("commit transaction: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(reshardCmd)
+
+	reshardCmd.Flags().Int("fanout", config.MaxChunkFanout, "Levels of two-character directories to spread chunks over (0 to 2)")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReshard(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"aabbccdd", "aabb1234", "ff001122"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("write chunk: %v", err)
+		}
+	}
+
+	moves, err := planReshard(dir, 2)
+	if err != nil {
+		t.Fatalf("planReshard: %v", err)
+	}
+	if len(moves) != len(names) {
+		t.Fatalf("planned %d moves, want %d", len(moves), len(names))
+	}
+	// A copy already at its destination, as after an interrupted reshard
+	if err := os.MkdirAll(filepath.Join(dir, "ff", "00"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ff", "00", "ff001122"), []byte("ff001122"), 0o644); err != nil {
+		t.Fatalf("write chunk: %v", err)
+	}
+	if moved, err := applyReshard(moves); err != nil || moved != len(names) {
+		t.Fatalf("applyReshard = %d, %v", moved, err)
+	}
+	for _, rel := range []string{"aa/bb/aabbccdd", "aa/bb/aabb1234", "ff/00/ff001122"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("chunk not moved to %s: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ff001122")); !os.IsNotExist(err) {
+		t.Errorf("flat copy of a chunk already moved was kept: %v", err)
+	}
+	if moves, _ := planReshard(dir, 2); len(moves) != 0 {
+		t.Errorf("resharding again plans %d moves", len(moves))
+	}
+
+	// Back to a flat store, leaving no shard directories behind
+	moves, err = planReshard(dir, 0)
+	if err != nil {
+		t.Fatalf("planReshard: %v", err)
+	}
+	if moved, err := applyReshard(moves); err != nil || moved != len(names) {
+		t.Fatalf("applyReshard = %d, %v", moved, err)
+	}
+	removeEmptyShardDirs(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read chunk store: %v", err)
+	}
+	if len(entries) != len(names) {
+		t.Errorf("flat chunk store holds %d entries, want %d", len(entries), len(names))
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			t.Errorf("shard directory %s left behind", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,676 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// Ways restore handles files that already exist in the target directory
+const (
+	conflictFail      = "fail"
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+// restoreLogName is the progress log restore keeps in the target directory
+// until every file is restored
+const restoreLogName = ".sietch-restore.jsonl"
+
+// partialSuffix marks a file whose chunks are still being written
+const partialSuffix = ".sietch-partial"
+
+// restoreCmd rebuilds a tree of the vault in a local directory
+var restoreCmd = &cobra.Command{
+	Use:   "restore <vault-prefix> <target-dir>",
+	Short: "Restore every file under a vault directory into a local directory",
+	Long: `Restore every file stored under a vault directory into a local directory tree.
+
+Files keep their layout below the vault prefix ('/' restores the whole
+vault), along with their permissions, modification times, symlinks and hard
+links. Chunks are read, decrypted and verified in parallel across files, and
+each file is written under a temporary name until it is complete, so an
+interrupted restore never leaves a truncated file behind.
+
+Restore keeps a progress log in the target directory. Running the same
+command again after an interruption or a failure skips the files already
+restored; the log is removed once every file is restored.
+
+Files that already exist in the target directory are handled as --conflict
+says: fail (the default) stops before writing anything, skip keeps them,
+overwrite replaces them and rename restores next to them as
+name.restored.ext. Nothing is written through a symlink below the target
+directory: symlinks are restored after every other file, and restore stops
+before writing anything if the target already has a symlink where a restored
+directory goes. Symlinks with absolute or '..' targets are refused unless
+--unsafe-symlinks is given.
+
+Examples:
+  sietch restore photos/2024 ~/Pictures/2024
+  sietch restore / /mnt/recovery --jobs 16        # The whole vault
+  sietch restore docs ./docs --conflict skip      # Only fill in missing files
+  sietch restore --dry-run docs ./docs            # Show what would be written`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		conflict, _ := cmd.Flags().GetString("conflict")
+		jobs, _ := cmd.Flags().GetInt("jobs")
+		restart, _ := cmd.Flags().GetBool("restart")
+		skipVerify, _ := cmd.Flags().GetBool(skipVerification)
+		noPerms, _ := cmd.Flags().GetBool("no-perms")
+		restoreOwner, _ := cmd.Flags().GetBool("restore-owner")
+		restoreXattrs, _ := cmd.Flags().GetBool("xattrs")
+		unsafeLinks, _ := cmd.Flags().GetBool("unsafe-symlinks")
+
+		switch conflict {
+		case conflictFail, conflictSkip, conflictOverwrite, conflictRename:
+		default:
+			return fmt.Errorf("invalid --conflict %q: expected fail, skip, overwrite or rename", conflict)
+		}
+		if jobs <= 0 {
+			jobs = runtime.NumCPU()
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		prefix, err := cleanVaultPath(args[0])
+		if err != nil {
+			return err
+		}
+		target := args[1]
+		files, err := findDirectoryManifests(vaultRoot, prefix)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no files found under '%s'", args[0])
+		}
+
+		log, err := loadRestoreLog(target)
+		if err != nil {
+			return err
+		}
+		if restart {
+			log.done = map[string]restoreRecord{}
+		}
+		plan := planRestore(files, prefix, target, conflict, log.done)
+		if len(plan.refused) > 0 {
+			for _, msg := range plan.refused[:min(len(plan.refused), 10)] {
+				fmt.Printf("✗ %s\n", msg)
+			}
+			return fmt.Errorf("%d file(s) would be written through symlinks in %s", len(plan.refused), target)
+		}
+		if len(plan.conflicts) > 0 {
+			shown := plan.conflicts[:min(len(plan.conflicts), 10)]
+			for _, p := range shown {
+				fmt.Printf("✗ %s already exists\n", p)
+			}
+			if more := len(plan.conflicts) - len(shown); more > 0 {
+				fmt.Printf("  ... and %d more\n", more)
+			}
+			return fmt.Errorf("%d file(s) already exist in %s, choose --conflict skip, overwrite or rename", len(plan.conflicts), target)
+		}
+
+		if dryRun {
+			for _, item := range plan.items {
+				fmt.Printf("[dry-run] would restore %s → %s\n", item.vaultPath, item.output)
+			}
+			printRestoreSummary(plan, "[dry-run] would restore", len(plan.items), plan.bytes(), target)
+			return nil
+		}
+
+		passphrase, err := ui.GetPassphraseForVault(cmd, vaultConfig)
+		if err != nil {
+			return fmt.Errorf("failed to get passphrase: %v", err)
+		}
+		progressMgr := progress.NewManager(progress.Options{Quiet: quiet, Verbose: verbose})
+		ctx := progressMgr.SetupCancellation(context.Background())
+
+		r := &retriever{
+			vaultRoot:   vaultRoot,
+			vaultConfig: vaultConfig,
+			passphrase:  passphrase,
+			force:       conflict == conflictOverwrite,
+			skipVerify:  skipVerify,
+			quiet:       true,
+			metaOpts:    metadataOptions{Perms: !noPerms, Owner: restoreOwner, Xattrs: restoreXattrs},
+			root:        target,
+			unsafeLinks: unsafeLinks,
+			progressMgr: progressMgr,
+			cache:       openChunkCache(vaultRoot, vaultConfig),
+		}
+		defer r.printCacheStats()
+
+		if err := log.open(restart); err != nil {
+			return err
+		}
+		defer log.close()
+
+		var mu sync.Mutex
+		restored, failed := 0, 0
+		var restoredBytes int64
+		finished := func(item *restoreItem, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Printf("✗ %s: %v\n", item.vaultPath, err)
+				}
+				failed++
+				return
+			}
+			if err := log.record(item); err != nil {
+				progressMgr.PrintInfo("Warning: failed to update the restore log: %v\n", err)
+			}
+			plan.written[item.vaultPath] = item.output
+			progressMgr.PrintVerbose("✓ %s\n", item.vaultPath)
+			restored++
+			restoredBytes += item.file.Size
+		}
+
+		progressMgr.InitTotalProgress(plan.bytes(), "Restoring")
+		var copies []*restoreItem
+		var linked int
+		items, symlinks := splitSymlinks(plan.items)
+		regular, links := splitHardLinks(items)
+		r.restoreItems(ctx, regular, jobs, finished)
+		// Hard links are made once the files they link to are restored; one
+		// that cannot be made is restored as a copy
+		for _, item := range links {
+			if ctx.Err() != nil {
+				break
+			}
+			if target, ok := plan.written[item.file.HardLink]; ok {
+				if err := r.linkFile(target, item.output); err == nil {
+					finished(item, nil)
+					linked++
+					continue
+				}
+			}
+			copies = append(copies, item)
+		}
+		r.restoreItems(ctx, copies, jobs, finished)
+		// Symlinks come last, so that no file is written through one
+		for _, item := range symlinks {
+			if ctx.Err() != nil {
+				break
+			}
+			finished(item, r.restoreSymlink(item.file.Symlink, item.output))
+		}
+		progressMgr.FinishTotalProgress()
+		progressMgr.Cleanup()
+
+		if progressMgr.IsCancelled() {
+			return fmt.Errorf("restore interrupted after %d file(s); run the same command again to resume", restored)
+		}
+		printRestoreSummary(plan, "Restored", restored, restoredBytes, target)
+		if linked > 0 {
+			fmt.Printf("Recreated %d hard link(s)\n", linked)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d file(s) could not be restored; run the same command again to retry them", failed)
+		}
+		if err := log.remove(); err != nil {
+			fmt.Printf("Warning: failed to remove the restore log: %v\n", err)
+		}
+		return nil
+	},
+}
+
+// restoreItem is a stored file restore writes
+type restoreItem struct {
+	file      *config.FileManifest
+	vaultPath string
+	output    string
+}
+
+// restorePlan is what a restore writes, and what it leaves alone
+type restorePlan struct {
+	items     []*restoreItem    // Files to write, with hard links after the files they link to
+	written   map[string]string // Vault path -> output path of restored files, for linking
+	resumed   int               // Restored by an earlier run
+	skipped   int               // Already existing and kept with --conflict skip
+	renamed   int               // Restored next to an existing file with --conflict rename
+	conflicts []string          // Already existing outputs with --conflict fail
+	refused   []string          // Outputs below a symlink already in the target
+}
+
+// bytes returns the size of the files the plan writes
+func (p *restorePlan) bytes() int64 {
+	var total int64
+	for _, item := range p.items {
+		total += item.file.Size
+	}
+	return total
+}
+
+// planRestore decides where each of files under the vault directory prefix
+// is restored below target, skipping those an earlier run recorded in done
+// and handling existing outputs as conflict says. A symlink whose path is a
+// directory other restored files go in conflicts as if it already existed.
+func planRestore(files []config.FileManifest, prefix, target, conflict string, done map[string]restoreRecord) *restorePlan {
+	if prefix != "" {
+		prefix += "/"
+	}
+	plan := &restorePlan{written: make(map[string]string)}
+	root := filepath.Clean(target)
+	dirs := make(map[string]bool) // Parent directories of restored files
+	for i := range files {
+		if files[i].Symlink != "" {
+			continue
+		}
+		output := filepath.Join(target, filepath.FromSlash(strings.TrimPrefix(files[i].Destination+files[i].FilePath, prefix)))
+		for dir := filepath.Dir(output); dir != root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	seen := make(map[string]bool, len(files))
+	for i := range files {
+		file := &files[i]
+		vaultPath := file.Destination + file.FilePath
+		// Vaults from before manifests were named by path can hold several
+		// manifests for one path; the first is the one get retrieves
+		if seen[vaultPath] {
+			continue
+		}
+		seen[vaultPath] = true
+		if rec, ok := done[vaultPath]; ok {
+			if output := filepath.Join(target, filepath.FromSlash(rec.Output)); rec.restores(file, output) {
+				plan.written[vaultPath] = output
+				plan.resumed++
+				continue
+			}
+		}
+
+		output := filepath.Join(target, filepath.FromSlash(strings.TrimPrefix(vaultPath, prefix)))
+		if err := checkOutput(target, output); err != nil {
+			plan.refused = append(plan.refused, err.Error())
+			continue
+		}
+		// Conflicts are checked against the path itself, not what a symlink there points to
+		if _, err := os.Lstat(output); err == nil || (file.Symlink != "" && dirs[output]) {
+			switch conflict {
+			case conflictSkip:
+				plan.skipped++
+				continue
+			case conflictFail:
+				plan.conflicts = append(plan.conflicts, output)
+				continue
+			case conflictRename:
+				output = renamedOutput(output)
+				plan.renamed++
+			}
+		}
+		plan.items = append(plan.items, &restoreItem{file: file, vaultPath: vaultPath, output: output})
+	}
+	return plan
+}
+
+// renamedOutput returns a free path next to output for a restored file that
+// would replace it: name.restored.ext, then name.restored-2.ext and so on
+func renamedOutput(output string) string {
+	ext := filepath.Ext(output)
+	base := strings.TrimSuffix(output, ext)
+	for n := 1; ; n++ {
+		candidate := base + ".restored" + ext
+		if n > 1 {
+			candidate = fmt.Sprintf("%s.restored-%d%s", base, n, ext)
+		}
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// splitSymlinks separates the items recreated as symlinks from the rest
+func splitSymlinks(items []*restoreItem) (files, symlinks []*restoreItem) {
+	for _, item := range items {
+		if item.file.Symlink != "" {
+			symlinks = append(symlinks, item)
+		} else {
+			files = append(files, item)
+		}
+	}
+	return files, symlinks
+}
+
+// splitHardLinks separates the items recreated as hard links from the rest
+func splitHardLinks(items []*restoreItem) (regular, links []*restoreItem) {
+	for _, item := range items {
+		if item.file.HardLink != "" {
+			links = append(links, item)
+		} else {
+			regular = append(regular, item)
+		}
+	}
+	return regular, links
+}
+
+// printRestoreSummary reports how many files a restore wrote and what it left alone
+func printRestoreSummary(plan *restorePlan, verb string, files int, bytes int64, target string) {
+	fmt.Printf("\n%s %d file(s) (%s) into %s\n", verb, files, util.HumanReadableSize(bytes), target)
+	if plan.resumed > 0 {
+		fmt.Printf("Already restored by an earlier run: %d\n", plan.resumed)
+	}
+	if plan.skipped > 0 {
+		fmt.Printf("Existing files kept: %d\n", plan.skipped)
+	}
+	if plan.renamed > 0 {
+		fmt.Printf("Restored under a new name next to an existing file: %d\n", plan.renamed)
+	}
+}
+
+// restoringFile is a file whose chunks are being written to its partial file
+type restoringFile struct {
+	item    *restoreItem
+	out     *os.File
+	offsets []int64
+
+	mu        sync.Mutex
+	remaining int
+	err       error
+}
+
+// failed returns the first error writing the file, if any
+func (f *restoringFile) failed() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// chunkDone records that one chunk was written, or failed with err, and
+// reports whether it was the last
+func (f *restoringFile) chunkDone(err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	f.remaining--
+	return f.remaining == 0
+}
+
+// restoreJob is one chunk of a file being restored
+type restoreJob struct {
+	file  *restoringFile
+	index int
+}
+
+// restoreItems writes items with jobs workers reading chunks in parallel,
+// across files so that trees of small files are restored as fast as large
+// ones. finished is called, from any of the workers, once per item.
+func (r *retriever) restoreItems(ctx context.Context, items []*restoreItem, jobs int, finished func(item *restoreItem, err error)) {
+	queue := make(chan restoreJob, jobs*2)
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				f := job.file
+				var err error
+				// The remaining chunks of a file that failed are not read
+				if f.failed() == nil {
+					err = r.writeRestoredChunk(ctx, f, job.index)
+				}
+				if f.chunkDone(err) {
+					finished(f.item, r.finishRestoredFile(f))
+				}
+			}
+		}()
+	}
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		f, err := r.startRestoredFile(item)
+		if err != nil {
+			finished(item, err)
+			continue
+		}
+		if f.remaining == 0 {
+			finished(item, r.finishRestoredFile(f))
+			continue
+		}
+		for i := range item.file.Chunks {
+			queue <- restoreJob{file: f, index: i}
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// startRestoredFile creates the partial file item is written to
+func (r *retriever) startRestoredFile(item *restoreItem) (*restoringFile, error) {
+	if err := checkOutput(r.root, item.output); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(item.output), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %v", err)
+	}
+	// A partial file left by an interrupted run is replaced, never followed
+	partial := item.output + partialSuffix
+	if err := os.Remove(partial); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove partial file: %v", err)
+	}
+	out, err := os.OpenFile(partial, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %v", err)
+	}
+	return &restoringFile{
+		item:      item,
+		out:       out,
+		offsets:   chunkOffsets(item.file),
+		remaining: len(item.file.Chunks),
+	}, nil
+}
+
+// writeRestoredChunk reads chunk index of f and writes it at its offset
+func (r *retriever) writeRestoredChunk(ctx context.Context, f *restoringFile, index int) error {
+	chunkRef := f.item.file.Chunks[index]
+	data, err := r.readChunk(ctx, chunkRef)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != chunkRef.Size {
+		return fmt.Errorf("chunk %d has %d bytes, manifest records %d", index, len(data), chunkRef.Size)
+	}
+	n, err := f.out.WriteAt(data, f.offsets[index])
+	if err != nil {
+		return fmt.Errorf("failed to write to output file: %v", err)
+	}
+	r.progressMgr.UpdateTotalProgress(int64(n))
+	return nil
+}
+
+// finishRestoredFile moves a completely written file into place and restores
+// its metadata, or removes the partial file of one that failed
+func (r *retriever) finishRestoredFile(f *restoringFile) error {
+	partial := f.out.Name()
+	err := f.failed()
+	if err == nil {
+		// Sizing the file also extends it over a trailing hole
+		if truncErr := f.out.Truncate(f.item.file.Size); truncErr != nil {
+			err = fmt.Errorf("failed to size output file: %v", truncErr)
+		}
+	}
+	if closeErr := f.out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write output file: %v", closeErr)
+	}
+	if err == nil {
+		err = os.Rename(partial, f.item.output)
+	}
+	if err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+
+	for _, metaErr := range restoreFileMetadata(f.item.output, f.item.file, r.metaOpts) {
+		r.progressMgr.PrintInfo("Warning: %s: %v\n", f.item.vaultPath, metaErr)
+	}
+	if modTime, err := time.Parse(time.RFC3339, f.item.file.ModTime); err == nil {
+		_ = os.Chtimes(f.item.output, modTime, modTime)
+	}
+	return nil
+}
+
+// restoreRecord is a file a restore finished, one JSON line of its log
+type restoreRecord struct {
+	Path        string `json:"path"`
+	Output      string `json:"output"` // Relative to the target directory, with forward slashes
+	Size        int64  `json:"size"`
+	ContentHash string `json:"content_hash,omitempty"`
+	Symlink     string `json:"symlink,omitempty"`
+}
+
+// restores reports whether the record shows file already restored at output:
+// the stored file is unchanged since and the output is still there
+func (rec restoreRecord) restores(file *config.FileManifest, output string) bool {
+	if rec.Size != file.Size || rec.ContentHash != file.ContentHash || rec.Symlink != file.Symlink {
+		return false
+	}
+	info, err := os.Lstat(output)
+	if err != nil {
+		return false
+	}
+	return file.Symlink != "" || (info.Mode().IsRegular() && info.Size() == file.Size)
+}
+
+// restoreLog is the progress log of a restore into one target directory
+type restoreLog struct {
+	target string
+	done   map[string]restoreRecord // By vault path
+	mu     sync.Mutex
+	f      *os.File
+}
+
+// loadRestoreLog reads the progress log of earlier restores into target. A
+// line that cannot be decoded, as the last one may be after a crash, is
+// skipped.
+func loadRestoreLog(target string) (*restoreLog, error) {
+	l := &restoreLog{target: target, done: make(map[string]restoreRecord)}
+	f, err := os.Open(l.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open restore log: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec restoreRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil && rec.Path != "" {
+			l.done[rec.Path] = rec
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read restore log: %v", err)
+	}
+	return l, nil
+}
+
+func (l *restoreLog) path() string {
+	return filepath.Join(l.target, restoreLogName)
+}
+
+// open starts appending to the log, or with truncate a new one
+func (l *restoreLog) open(truncate bool) error {
+	if err := os.MkdirAll(l.target, 0o755); err != nil {
+		return fmt.Errorf("failed to create target directory: %v", err)
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(l.path(), flags, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open restore log: %v", err)
+	}
+	l.f = f
+	return nil
+}
+
+// record appends a restored file to the log
+func (l *restoreLog) record(item *restoreItem) error {
+	output, err := filepath.Rel(l.target, item.output)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(restoreRecord{
+		Path:        item.vaultPath,
+		Output:      filepath.ToSlash(output),
+		Size:        item.file.Size,
+		ContentHash: item.file.ContentHash,
+		Symlink:     item.file.Symlink,
+	})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(append(line, '\n'))
+	return err
+}
+
+func (l *restoreLog) close() {
+	if l.f != nil {
+		_ = l.f.Close()
+		l.f = nil
+	}
+}
+
+// remove deletes the log of a restore that completed
+func (l *restoreLog) remove() error {
+	l.close()
+	return os.Remove(l.path())
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.ValidArgsFunction = completeRestoreArgs
+
+	restoreCmd.Flags().String("conflict", conflictFail, "How to handle files that already exist: fail, skip, overwrite or rename")
+	restoreCmd.Flags().IntP("jobs", "j", 0, "Number of chunks to read in parallel (default: number of CPUs)")
+	restoreCmd.Flags().Bool("restart", false, "Ignore the progress log of an earlier restore and restore every file again (with --conflict overwrite to replace them)")
+	restoreCmd.Flags().Bool(skipVerification, false, "Skip integrity verification (for recovery scenarios)")
+	restoreCmd.Flags().Bool("no-perms", false, "Do not restore recorded file permissions")
+	restoreCmd.Flags().Bool("restore-owner", false, "Restore recorded file owner and group, and setuid, setgid and sticky bits (usually requires root)")
+	restoreCmd.Flags().Bool("xattrs", false, "Restore recorded extended attributes")
+	restoreCmd.Flags().Bool("unsafe-symlinks", false, "Restore symlinks with absolute or '..' targets, which can point outside the target directory")
+	restoreCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	restoreCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
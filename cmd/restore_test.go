@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func TestRestoreItems(t *testing.T) {
+	vaultRoot := testutil.TempDir(t, "restore-vault")
+	target := testutil.TempDir(t, "restore-target")
+	r := &retriever{
+		vaultRoot:   vaultRoot,
+		vaultConfig: &config.VaultConfig{Encryption: config.EncryptionConfig{Type: "none"}},
+		root:        target,
+		quiet:       true,
+		progressMgr: progress.NewManager(progress.Options{Quiet: true}),
+	}
+
+	plain := &config.FileManifest{Size: 8, Chunks: []config.ChunkRef{
+		storeTestChunk(t, vaultRoot, []byte("abcd"), 0),
+		storeTestChunk(t, vaultRoot, []byte("efgh"), 4),
+	}}
+	sparse := &config.FileManifest{
+		Size:   10,
+		Chunks: []config.ChunkRef{storeTestChunk(t, vaultRoot, []byte("xy"), 4)},
+		Holes:  []config.HoleExtent{{Offset: 0, Length: 4}, {Offset: 6, Length: 4}},
+	}
+	broken := &config.FileManifest{Size: 5, Chunks: []config.ChunkRef{
+		storeTestChunk(t, vaultRoot, []byte("ok"), 0),
+		{Hash: "missing", Size: 3, Offset: 2},
+	}}
+	items := []*restoreItem{
+		{file: plain, vaultPath: "plain", output: filepath.Join(target, "a", "plain")},
+		{file: sparse, vaultPath: "sparse", output: filepath.Join(target, "sparse")},
+		{file: &config.FileManifest{}, vaultPath: "empty", output: filepath.Join(target, "empty")},
+		{file: broken, vaultPath: "broken", output: filepath.Join(target, "broken")},
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]error)
+	r.restoreItems(context.Background(), items, 3, func(item *restoreItem, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[item.vaultPath] = err
+	})
+
+	if len(results) != len(items) {
+		t.Fatalf("finished called for %d items, want %d", len(results), len(items))
+	}
+	want := map[string]string{"plain": "abcdefgh", "sparse": "\x00\x00\x00\x00xy\x00\x00\x00\x00", "empty": ""}
+	for _, item := range items[:3] {
+		if err := results[item.vaultPath]; err != nil {
+			t.Errorf("%s: %v", item.vaultPath, err)
+			continue
+		}
+		got, err := os.ReadFile(item.output)
+		if err != nil || string(got) != want[item.vaultPath] {
+			t.Errorf("%s = %q (%v), want %q", item.vaultPath, got, err, want[item.vaultPath])
+		}
+	}
+	if results["broken"] == nil {
+		t.Error("expected an error for a file with a missing chunk")
+	}
+	for _, name := range []string{"broken", "broken" + partialSuffix} {
+		if _, err := os.Lstat(filepath.Join(target, name)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind by a failed restore", name)
+		}
+	}
+}
+
+func TestPlanRestore(t *testing.T) {
+	target := testutil.TempDir(t, "restore-plan")
+	files := []config.FileManifest{
+		{Destination: "docs/", FilePath: "new.txt", Size: 1},
+		{Destination: "docs/", FilePath: "exists.txt", Size: 1},
+		{Destination: "docs/sub/", FilePath: "done.txt", Size: 4, ContentHash: "h"},
+	}
+	for name, data := range map[string]string{"exists.txt": "x", "sub/done.txt": "done"} {
+		path := filepath.Join(target, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := map[string]restoreRecord{"docs/sub/done.txt": {Path: "docs/sub/done.txt", Output: "sub/done.txt", Size: 4, ContentHash: "h"}}
+
+	outputs := func(plan *restorePlan) []string {
+		var out []string
+		for _, item := range plan.items {
+			rel, _ := filepath.Rel(target, item.output)
+			out = append(out, filepath.ToSlash(rel))
+		}
+		return out
+	}
+
+	plan := planRestore(files, "docs", target, conflictFail, done)
+	if len(plan.conflicts) != 1 || plan.resumed != 1 || len(plan.items) != 1 {
+		t.Errorf("fail: conflicts %v, resumed %d, items %v", plan.conflicts, plan.resumed, outputs(plan))
+	}
+	if plan.written["docs/sub/done.txt"] != filepath.Join(target, "sub", "done.txt") {
+		t.Errorf("resumed file not recorded as written: %v", plan.written)
+	}
+
+	plan = planRestore(files, "docs", target, conflictSkip, done)
+	if got := outputs(plan); plan.skipped != 1 || len(got) != 1 || got[0] != "new.txt" {
+		t.Errorf("skip: skipped %d, items %v", plan.skipped, got)
+	}
+
+	plan = planRestore(files, "docs", target, conflictRename, done)
+	if got := outputs(plan); plan.renamed != 1 || len(got) != 2 || got[1] != "exists.restored.txt" {
+		t.Errorf("rename: renamed %d, items %v", plan.renamed, got)
+	}
+
+	plan = planRestore(files, "docs", target, conflictOverwrite, done)
+	if got := outputs(plan); len(got) != 2 || got[1] != "exists.txt" {
+		t.Errorf("overwrite: items %v", got)
+	}
+
+	// A file changed in the vault since it was restored is restored again
+	files[2].ContentHash = "changed"
+	plan = planRestore(files, "docs", target, conflictOverwrite, done)
+	if plan.resumed != 0 || len(plan.items) != 3 {
+		t.Errorf("changed file: resumed %d, items %v", plan.resumed, outputs(plan))
+	}
+
+	// The whole vault keeps the vault layout
+	plan = planRestore(files[:1], "", target, conflictFail, nil)
+	if got := outputs(plan); len(got) != 1 || got[0] != "docs/new.txt" {
+		t.Errorf("whole vault: items %v", got)
+	}
+}
+
+func TestPlanRestoreSymlinks(t *testing.T) {
+	target := testutil.TempDir(t, "restore-symlinks")
+	outside := testutil.TempDir(t, "restore-symlinks-outside")
+	files := []config.FileManifest{
+		{Destination: "docs/", FilePath: "evil", Symlink: outside},
+		{Destination: "docs/", FilePath: "evil/x.txt", Size: 1},
+	}
+
+	// A restored symlink where restored files need a directory is a conflict
+	plan := planRestore(files, "docs", target, conflictFail, nil)
+	if len(plan.conflicts) != 1 || plan.conflicts[0] != filepath.Join(target, "evil") {
+		t.Errorf("expected the symlink to conflict with the directory, got %v", plan.conflicts)
+	}
+
+	// Files below a symlink already in the target are refused, whatever --conflict says
+	if err := os.Symlink(outside, filepath.Join(target, "evil")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	for _, conflict := range []string{conflictFail, conflictOverwrite} {
+		plan = planRestore(files[1:], "docs", target, conflict, nil)
+		if len(plan.refused) != 1 || len(plan.items) != 0 {
+			t.Errorf("%s: expected evil/x.txt to be refused, got refused %v, items %d", conflict, plan.refused, len(plan.items))
+		}
+	}
+
+	r := &retriever{root: target, quiet: true}
+	item := &restoreItem{file: &files[1], vaultPath: "docs/evil/x.txt", output: filepath.Join(target, "evil", "x.txt")}
+	if _, err := r.startRestoredFile(item); err == nil {
+		t.Error("expected writing through a symlink to be refused")
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("restore wrote outside the target: %v", entries)
+	}
+}
+
+func TestRestoreLog(t *testing.T) {
+	target := filepath.Join(testutil.TempDir(t, "restore-log"), "out")
+	log, err := loadRestoreLog(target)
+	if err != nil || len(log.done) != 0 {
+		t.Fatalf("loadRestoreLog of a new target = %v, %v", log.done, err)
+	}
+	if err := log.open(false); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	item := &restoreItem{
+		file:      &config.FileManifest{Size: 3, ContentHash: "h"},
+		vaultPath: "docs/a.txt",
+		output:    filepath.Join(target, "a.txt"),
+	}
+	if err := log.record(item); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	log.close()
+
+	// A torn last line is skipped
+	f, err := os.OpenFile(filepath.Join(target, restoreLogName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"path":"docs/b`)
+	f.Close()
+
+	log, err = loadRestoreLog(target)
+	if err != nil {
+		t.Fatalf("loadRestoreLog: %v", err)
+	}
+	rec, ok := log.done["docs/a.txt"]
+	if !ok || rec.Output != "a.txt" || rec.Size != 3 || rec.ContentHash != "h" || len(log.done) != 1 {
+		t.Errorf("log = %+v", log.done)
+	}
+	if err := log.remove(); err != nil {
+		t.Errorf("remove: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, restoreLogName)); !os.IsNotExist(err) {
+		t.Error("restore log not removed")
+	}
+}
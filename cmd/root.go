@@ -4,6 +4,7 @@ Copyright © 2025 SubstantialCattle5, nilaysharan.com
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -19,17 +20,38 @@ encrypted data across machines, even with limited connectivity.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		activeCmd = cmd
+		if err := lockWorkingVault(cmd); err != nil {
+			return err
+		}
+		if err := autoRecover(cmd); err != nil {
+			return err
+		}
+		return autoMigrate(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	err := rootCmd.Execute()
+	releaseVaultLocks()
+	if err != nil {
+		if !errors.As(err, new(reportedError)) {
+			fmt.Println(err)
+		}
 		os.Exit(1)
 	}
 }
 
+// reportedError is an error a command has already reported in its output, such
+// as in its structured result, so Execute only exits with a failure status
+type reportedError struct{ err error }
+
+func (e reportedError) Error() string { return e.err.Error() }
+func (e reportedError) Unwrap() error { return e.err }
+
 func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -42,4 +64,9 @@ func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Disable progress bars and reduce output")
+	rootCmd.PersistentFlags().StringP("output", "o", outputTable, "Output format for supported commands: table, json, yaml")
+	rootCmd.PersistentFlags().Bool("dry-run", false, "Show what the command would store, remove, repair or transfer without writing anything")
+	rootCmd.PersistentFlags().Bool("wait", false, "Wait for other sietch commands changing the vault to finish instead of giving up after 10s")
+	rootCmd.PersistentFlags().Bool("no-wait", false, "Fail immediately if another sietch command is changing the vault")
+	rootCmd.MarkFlagsMutuallyExclusive("wait", "no-wait")
 }
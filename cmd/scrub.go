@@ -0,0 +1,259 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/scrub"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// scrubCmd verifies a share of the vault's chunks on each run
+var scrubCmd = &cobra.Command{
+	Use:   "scrub",
+	Short: "Verify a share of the stored chunks, so the whole vault is checked over several runs",
+	Long: `Read a share of the chunks of the vault's files back from the chunk store
+and check them against the hashes in their manifests, to find bit rot and
+lost chunks before the files are needed.
+
+Each run verifies scrub.percent of the chunks (10% by default, rounded up),
+those never verified or verified longest ago first, so every chunk is checked
+once every 100/percent runs. When each chunk was last verified is kept in
+.sietch/scrub/state.json, and the last_verified time of a file, shown by
+'sietch info', is moved forward once all its chunks have been verified.
+Chunks are checked without decrypting them, so no passphrase is needed.
+
+Scrubbing is meant to run unattended, such as from cron:
+  0 3 * * * cd /srv/vault && sietch scrub --quiet
+
+The command fails when it finds damaged chunks; damaged chunks are checked
+again on the next run. Run 'sietch repair' to restore them from trusted
+peers, or 'sietch parity repair' to rebuild them from parity groups.
+
+Examples:
+  sietch scrub                # Verify scrub.percent of the chunks
+  sietch scrub --percent 25   # Verify a quarter of the chunks this run
+  sietch scrub --all          # Verify every chunk
+  sietch scrub --dry-run      # Show how many chunks would be verified
+  sietch scrub -o json        # For scripts`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		vaultConfig, err := manager.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		percent := vaultConfig.Scrub.Share()
+		if cmd.Flags().Changed("percent") {
+			if percent, _ = cmd.Flags().GetInt("percent"); percent < 1 || percent > 100 {
+				return fmt.Errorf("--percent must be between 1 and 100")
+			}
+		}
+		if all, _ := cmd.Flags().GetBool("all"); all {
+			percent = 100
+		}
+
+		entries, err := manager.GetManifestEntries()
+		if err != nil {
+			return fmt.Errorf("failed to get manifest entries: %v", err)
+		}
+		files := make([]config.FileManifest, len(entries))
+		for i, entry := range entries {
+			files[i] = entry.Manifest
+		}
+
+		state, err := scrub.LoadState(vaultRoot)
+		if err != nil {
+			return err
+		}
+		targets := state.Targets(files)
+		picked := state.Select(targets, percent)
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			var stored int64
+			for _, t := range picked {
+				stored += storedSize(t.Ref)
+			}
+			verified, _ := state.Coverage(targets)
+			fmt.Printf("[dry-run] would verify %d of %d chunks (%s stored); %d verified before\n",
+				len(picked), len(targets), util.HumanReadableSize(stored), verified)
+			return nil
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		now := time.Now().UTC()
+		result, err := state.Verify(ctx, vaultRoot, picked, *vaultConfig, now)
+		interrupted := errors.Is(err, context.Canceled)
+		if err != nil && !interrupted {
+			return err
+		}
+
+		// Keep what was verified before an interrupt, so the next run goes on from there
+		stamped, err := stampVerified(manager, vaultRoot, entries, state)
+		if err != nil {
+			return err
+		}
+		state.LastRun = now
+		if err := state.Save(vaultRoot); err != nil {
+			return err
+		}
+
+		out := newScrubOutput(result, state, targets, percent, stamped)
+		recordAudit(vaultRoot, audit.OpScrub, map[string]string{
+			"checked": strconv.Itoa(out.Checked),
+			"total":   strconv.Itoa(out.Total),
+			"damaged": strconv.Itoa(len(out.Damaged)),
+		})
+
+		var failure error
+		switch {
+		case len(out.Damaged) > 0:
+			failure = fmt.Errorf("%d damaged chunk(s) found, run 'sietch repair' to restore them from peers or 'sietch parity repair' to rebuild them from parity", len(out.Damaged))
+		case interrupted:
+			failure = fmt.Errorf("scrub interrupted after %d of %d chunks", out.Checked, len(picked))
+		}
+
+		if format != outputTable {
+			if err := writeStructured(os.Stdout, format, out); err != nil {
+				return err
+			}
+			if failure != nil {
+				cmd.SilenceErrors, cmd.SilenceUsage = true, true
+				return reportedError{failure}
+			}
+			return nil
+		}
+		if quiet, _ := cmd.Flags().GetBool("quiet"); !quiet || len(out.Damaged) > 0 {
+			displayScrub(os.Stdout, out)
+		}
+		return failure
+	},
+}
+
+// stampVerified moves the last_verified time of every file whose chunks have
+// all been verified forward in one transaction and returns how many changed
+func stampVerified(manager *config.Manager, vaultRoot string, entries []*config.ManifestEntry, state *scrub.State) (int, error) {
+	var changed []*config.ManifestEntry
+	for _, entry := range entries {
+		if state.Stamp(&entry.Manifest) {
+			changed = append(changed, entry)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "scrub", "fileCount": len(changed)})
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %v", err)
+	}
+	for _, entry := range changed {
+		if err := replaceManifestTransactional(txn, vaultRoot, entry.Path, &entry.Manifest); err != nil {
+			_ = txn.Rollback()
+			return 0, fmt.Errorf("failed to update manifest for %s: %v", entry.Manifest.Destination+entry.Manifest.FilePath, err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		_ = txn.Rollback()
+		return 0, fmt.Errorf("commit transaction: %v", err)
+	}
+	manager.RefreshIndex()
+	return len(changed), nil
+}
+
+// scrubOutput is the outcome of sietch scrub
+type scrubOutput struct {
+	Percent  int             `json:"percent" yaml:"percent"`
+	Checked  int             `json:"checked" yaml:"checked"`
+	Bytes    int64           `json:"bytes" yaml:"bytes"`
+	Total    int             `json:"total" yaml:"total"`       // Chunks referenced by the vault's files
+	Verified int             `json:"verified" yaml:"verified"` // Of Total, chunks verified by this or earlier runs
+	Oldest   *time.Time      `json:"oldest,omitempty" yaml:"oldest,omitempty"`
+	Stamped  int             `json:"stamped" yaml:"stamped"` // Files whose last_verified time moved forward
+	Damaged  []damagedOutput `json:"damaged" yaml:"damaged"`
+}
+
+// damagedOutput is a damaged chunk found by a scrub
+type damagedOutput struct {
+	Chunk  string   `json:"chunk" yaml:"chunk"`
+	Reason string   `json:"reason" yaml:"reason"`
+	Files  []string `json:"files" yaml:"files"`
+}
+
+// newScrubOutput summarizes a scrub run and the coverage of the vault after it
+func newScrubOutput(result *scrub.Result, state *scrub.State, targets []scrub.Target, percent, stamped int) *scrubOutput {
+	out := &scrubOutput{Percent: percent, Checked: result.Checked, Bytes: result.Bytes, Total: len(targets), Stamped: stamped, Damaged: []damagedOutput{}}
+	var oldest time.Time
+	if out.Verified, oldest = state.Coverage(targets); !oldest.IsZero() {
+		out.Oldest = &oldest
+	}
+	for _, d := range result.Damaged {
+		out.Damaged = append(out.Damaged, damagedOutput{Chunk: chunk.StorageName(d.Ref), Reason: d.Reason, Files: d.Files})
+	}
+	return out
+}
+
+// displayScrub prints the outcome of a scrub run
+func displayScrub(w io.Writer, out *scrubOutput) {
+	fmt.Fprintf(w, "Verified %d of %d chunks (%s, %d%% per run)\n", out.Checked, out.Total, util.HumanReadableSize(out.Bytes), out.Percent)
+	if out.Oldest != nil {
+		fmt.Fprintf(w, "Every chunk verified since %s\n", out.Oldest.Local().Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Fprintf(w, "%d of %d chunks verified so far\n", out.Verified, out.Total)
+	}
+	if out.Stamped > 0 {
+		fmt.Fprintf(w, "Updated the last verified time of %d files\n", out.Stamped)
+	}
+	if len(out.Damaged) == 0 {
+		fmt.Fprintln(w, "✓ No damaged chunks found")
+		return
+	}
+
+	fmt.Fprintf(w, "\n⚠️  %d damaged chunk(s):\n", len(out.Damaged))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHUNK\tREASON\tFILES")
+	for _, d := range out.Damaged {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", shortHash(d.Chunk), d.Reason, strings.Join(d.Files, ","))
+	}
+	_ = tw.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(scrubCmd)
+
+	scrubCmd.Flags().Int("percent", config.DefaultScrubPercent, "Percentage of chunks to verify this run, instead of scrub.percent")
+	scrubCmd.Flags().Bool("all", false, "Verify every chunk")
+}
@@ -54,6 +54,12 @@ Examples:
 			return fmt.Errorf("destination is not a valid vault: %s", destPath)
 		}
 
+		if !dryRun {
+			if err := lockVault(cmd, destPath); err != nil {
+				return err
+			}
+		}
+
 		fmt.Printf("🎯 Destination vault: %s\n", destPath)
 
 		// Source vault discovery or validation
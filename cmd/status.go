@@ -0,0 +1,266 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/internal/quota"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// statusCmd summarizes the vault and, with --replication, the copies of its
+// files known to exist on trusted peers
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show an overview of the vault and how widely its files are replicated",
+	Long: `Show the vault's name and ID, the files it holds and their size, its trusted
+peers and when it last synced. When quota.soft or quota.hard is set, the size
+of the chunk store is shown against them.
+
+With --replication, also show how many copies of each file are known to
+exist, counting this vault and every trusted peer known to hold all of the
+file's chunks. What peers hold is learnt from their file lists and have-lists
+during syncs, from 'sietch peers check' and from 'sietch sync
+--ensure-replicas', and is kept in .sietch/sync/replicas.json. It can be out
+of date when a peer removed files since.
+
+Files with fewer copies than --replicas (sync.replication_factor, 2 by default)
+are listed, along with the files each trusted peer holds. Run 'sietch sync
+--ensure-replicas' to have peers fetch copies of them.
+
+Examples:
+  sietch status                             # Overview of the vault
+  sietch status --replication               # Files with fewer than 2 copies
+  sietch status --replication --replicas 3  # Files with fewer than 3 copies
+  sietch status --replication -o json       # For scripts`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		mgr, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault: %v", err)
+		}
+		manifest, err := mgr.GetManifest()
+		if err != nil {
+			return fmt.Errorf("failed to load manifest: %v", err)
+		}
+		runs, err := p2p.ReadSyncHistory(vaultRoot)
+		if err != nil {
+			return err
+		}
+		out := newStatusOutput(vaultConfig, manifest, runs)
+		usage, err := quota.Measure(vaultRoot, vaultConfig.Quota)
+		if err != nil {
+			return err
+		}
+		if usage.Limited() {
+			out.Quota = usage
+		}
+
+		if replication, _ := cmd.Flags().GetBool("replication"); replication {
+			want := vaultConfig.Sync.Replicas()
+			if cmd.Flags().Changed("replicas") {
+				if want, _ = cmd.Flags().GetInt("replicas"); want < 1 {
+					return fmt.Errorf("--replicas must be at least 1")
+				}
+			}
+			replicas, err := p2p.LoadReplicaMap(vaultRoot)
+			if err != nil {
+				return err
+			}
+			out.Replication = newReplicationOutput(vaultConfig, replicas, manifest.Files, want)
+		}
+
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, out)
+		}
+		return displayStatus(os.Stdout, out, trustedPeerNames(vaultConfig))
+	},
+}
+
+// statusOutput is the overview shown by sietch status
+type statusOutput struct {
+	Name         string             `json:"name" yaml:"name"`
+	VaultID      string             `json:"vault_id" yaml:"vault_id"`
+	Files        int                `json:"files" yaml:"files"`
+	Size         int64              `json:"size" yaml:"size"`
+	Chunks       int                `json:"chunks" yaml:"chunks"`
+	TrustedPeers int                `json:"trusted_peers" yaml:"trusted_peers"`
+	LastSync     *time.Time         `json:"last_sync,omitempty" yaml:"last_sync,omitempty"`
+	Quota        *quota.Usage       `json:"quota,omitempty" yaml:"quota,omitempty"` // Set when quota.soft or quota.hard is
+	Replication  *replicationOutput `json:"replication,omitempty" yaml:"replication,omitempty"`
+}
+
+// replicationOutput is what status --replication adds
+type replicationOutput struct {
+	Want  int                `json:"want" yaml:"want"`
+	Below []p2p.FileReplicas `json:"below" yaml:"below"` // Files with fewer than Want copies
+	Peers []peerReplicas     `json:"peers" yaml:"peers"`
+}
+
+// peerReplicas is what a trusted peer is known to hold of this vault
+type peerReplicas struct {
+	ID      string     `json:"id" yaml:"id"`
+	Name    string     `json:"name,omitempty" yaml:"name,omitempty"`
+	Files   int        `json:"files" yaml:"files"`
+	Size    int64      `json:"size" yaml:"size"`
+	Updated *time.Time `json:"updated,omitempty" yaml:"updated,omitempty"`
+}
+
+// newStatusOutput summarizes the vault from its config, manifest and sync history
+func newStatusOutput(vaultConfig *config.VaultConfig, manifest *config.Manifest, runs []p2p.SyncRun) *statusOutput {
+	out := &statusOutput{Name: vaultConfig.Name, VaultID: vaultConfig.VaultID, Files: len(manifest.Files)}
+	chunks := make(map[string]bool)
+	for _, file := range manifest.Files {
+		out.Size += file.Size
+		for _, ref := range file.Chunks {
+			chunks[ref.Hash] = true
+		}
+	}
+	out.Chunks = len(chunks)
+	if vaultConfig.Sync.RSA != nil {
+		out.TrustedPeers = len(vaultConfig.Sync.RSA.TrustedPeers)
+	}
+	if len(runs) > 0 {
+		last := runs[len(runs)-1].Time
+		out.LastSync = &last
+	}
+	return out
+}
+
+// newReplicationOutput reports the copies of files known to exist in this
+// vault and on its trusted peers
+func newReplicationOutput(vaultConfig *config.VaultConfig, replicas *p2p.ReplicaMap, files []config.FileManifest, want int) *replicationOutput {
+	out := &replicationOutput{Want: want, Below: []p2p.FileReplicas{}, Peers: []peerReplicas{}}
+	var ids []string
+	if vaultConfig.Sync.RSA != nil {
+		for _, p := range vaultConfig.Sync.RSA.TrustedPeers {
+			ids = append(ids, p.ID)
+			held := peerReplicas{ID: p.ID, Name: p.Name}
+			if known := replicas.Peers[p.ID]; known != nil {
+				updated := known.Updated
+				held.Updated = &updated
+			}
+			out.Peers = append(out.Peers, held)
+		}
+	}
+
+	byPeer := make(map[string]*peerReplicas, len(out.Peers))
+	for i := range out.Peers {
+		byPeer[out.Peers[i].ID] = &out.Peers[i]
+	}
+	copies := replicas.Replication(files, ids)
+	for _, fr := range copies {
+		for _, id := range fr.Peers {
+			byPeer[id].Files++
+			byPeer[id].Size += fr.Size
+		}
+	}
+	out.Below = append(out.Below, p2p.UnderReplicated(copies, want)...)
+	return out
+}
+
+// displayStatus prints the overview of the vault, with trusted peers shown by
+// their name in names
+func displayStatus(w io.Writer, out *statusOutput, names map[string]string) error {
+	fmt.Fprintf(w, "Vault:  %s (%s)\n", out.Name, out.VaultID)
+	fmt.Fprintf(w, "Files:  %d (%s in %d chunks)\n", out.Files, util.HumanReadableSize(out.Size), out.Chunks)
+	fmt.Fprintf(w, "Peers:  %d trusted\n", out.TrustedPeers)
+	if out.LastSync != nil {
+		fmt.Fprintf(w, "Synced: %s\n", out.LastSync.Local().Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Fprintln(w, "Synced: never")
+	}
+	if out.Quota != nil {
+		fmt.Fprintf(w, "Quota:  %s\n", formatQuota(out.Quota))
+	}
+	if out.Replication == nil {
+		return nil
+	}
+
+	r := out.Replication
+	displayName := func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return id
+	}
+	fmt.Fprintf(w, "\nReplication: %d of %d files have fewer than %d copies\n", len(r.Below), out.Files, r.Want)
+	if len(r.Below) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tSIZE\tCOPIES\tPEERS")
+		for _, fr := range r.Below {
+			holders := make([]string, len(fr.Peers))
+			for i, id := range fr.Peers {
+				holders[i] = displayName(id)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", fr.Path, util.HumanReadableSize(fr.Size), fr.Copies, orDash(strings.Join(holders, ",")))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(r.Peers) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w, "\nHeld by trusted peers:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PEER\tFILES\tSIZE\tUPDATED")
+	for _, p := range r.Peers {
+		updated := "never"
+		if p.Updated != nil {
+			updated = p.Updated.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", displayName(p.ID), p.Files, util.HumanReadableSize(p.Size), updated)
+	}
+	return tw.Flush()
+}
+
+// formatQuota describes the usage of the chunk store against its limits
+func formatQuota(u *quota.Usage) string {
+	text := util.HumanReadableSize(u.Used) + " used"
+	if u.Soft > 0 {
+		text += ", soft limit " + util.HumanReadableSize(u.Soft)
+	}
+	if u.Hard > 0 {
+		text += fmt.Sprintf(", hard limit %s (%.0f%% used)", util.HumanReadableSize(u.Hard), float64(u.Used)/float64(u.Hard)*100)
+	}
+	switch {
+	case u.OverHard():
+		text += " ⚠️  over the hard limit"
+	case u.OverSoft():
+		text += " ⚠️  over the soft limit"
+	}
+	return text
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().Bool("replication", false, "Show files with fewer copies than --replicas on this vault and its trusted peers")
+	statusCmd.Flags().Int("replicas", config.DefaultReplicationFactor, "Copies each file should have, instead of sync.replication_factor")
+}
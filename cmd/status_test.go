@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/internal/quota"
+)
+
+func TestStatusReplication(t *testing.T) {
+	cfg := &config.VaultConfig{Name: "notes", VaultID: "v1"}
+	cfg.Sync.RSA = &config.RSAConfig{TrustedPeers: []config.TrustedPeer{{ID: "QmLaptop", Name: "laptop"}, {ID: "QmDesk"}}}
+	manifest := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Size: 10, Chunks: []config.ChunkRef{{Hash: "h1"}, {Hash: "h2"}}},
+		{FilePath: "b.txt", Destination: "docs/", Size: 20, Chunks: []config.ChunkRef{{Hash: "h3"}}},
+	}}
+	replicas := &p2p.ReplicaMap{Peers: map[string]*p2p.PeerReplicas{
+		"QmLaptop": {Chunks: []string{"h1", "h2", "h3"}},
+		"QmDesk":   {Chunks: []string{"h1", "h3"}},
+		"QmOld":    {Chunks: []string{"h1", "h2"}}, // No longer trusted
+	}}
+
+	out := newStatusOutput(cfg, manifest, nil)
+	out.Replication = newReplicationOutput(cfg, replicas, manifest.Files, 3)
+	if out.Files != 2 || out.Size != 30 || out.Chunks != 3 || out.TrustedPeers != 2 {
+		t.Errorf("unexpected overview %+v", out)
+	}
+	below := out.Replication.Below
+	if len(below) != 1 || below[0].Path != "docs/a.txt" || below[0].Copies != 2 {
+		t.Fatalf("expected only docs/a.txt below 3 copies, got %+v", below)
+	}
+	if peers := out.Replication.Peers; peers[0].Files != 2 || peers[0].Size != 30 || peers[1].Files != 1 {
+		t.Errorf("unexpected peer holdings %+v", peers)
+	}
+
+	var text bytes.Buffer
+	if err := displayStatus(&text, out, trustedPeerNames(cfg)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"1 of 2 files have fewer than 3 copies", "docs/a.txt", "laptop", "Synced: never"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, text.String())
+		}
+	}
+}
+
+func TestFormatQuota(t *testing.T) {
+	for _, tc := range []struct {
+		usage quota.Usage
+		want  string
+	}{
+		{quota.Usage{Used: 512, Hard: 2048}, "512 B used, hard limit 2.0 KB (25% used)"},
+		{quota.Usage{Used: 1536, Soft: 1024, Hard: 2048}, "over the soft limit"},
+		{quota.Usage{Used: 4096, Hard: 2048}, "over the hard limit"},
+	} {
+		if got := formatQuota(&tc.usage); !strings.Contains(got, tc.want) {
+			t.Errorf("formatQuota(%+v) = %q, want it to contain %q", tc.usage, got, tc.want)
+		}
+	}
+}
@@ -10,19 +10,25 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/spf13/cobra"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/fs"
 	"github.com/substantialcattle5/sietch/internal/p2p"
 	"github.com/substantialcattle5/sietch/util"
@@ -30,17 +36,107 @@ import (
 
 // syncCmd represents the sync command
 var syncCmd = &cobra.Command{
-	Use:   "sync [peer-address]",
+	Use:   "sync [peer-address|peer-name|peer-id]",
 	Short: "Synchronize with another Sietch vault",
 	Long: `Synchronize files with another Sietch vault over the network.
 
 This command syncs your vault with another vault, either by auto-discovering
 peers on the local network or by connecting to a specified peer address.
+A trusted peer can also be given by name or ID, in which case it is located
+on the local network via discovery.
+
+With --local, the other vault is a directory on this machine or a mounted
+drive. Missing chunks and file manifests are copied in both directions (only
+into this vault with --read-only) without any networking. Both vaults must use
+the same encryption key.
+
+A replica vault (replica: true in vault.yaml) only ever receives: local syncs
+from a replica are one-way, and nothing is sent into another vault that is a
+replica. Replicas still serve their files to peers that sync from them.
+
+A trusted peer can be limited to part of this vault by listing path prefixes,
+or "tag:<name>" entries, under its allowed_paths in sync.rsa.trusted_peers.
+It is then only sent the matching files and their chunks.
+
+Peers syncing from this vault may only open so many streams at once and per
+second (sync.max_streams, sync.max_peer_streams and sync.peer_request_rate in
+vault.yaml). Requests over the limits are refused with a busy error, and
+chunk requests are retried by the peer with backoff.
+
+A vault with a swarm key (sync.network_key, see 'sietch sync network-key')
+syncs in a libp2p private network and only connects to nodes holding the same
+key. Peers in it must still be trusted as usual.
+
+The node listens on all interfaces on --port, or on the multiaddrs in
+sync.listen_addrs. --listen overrides both for one run, and --no-listen (or
+sync.listen_addrs: [none]) makes a client-only node that dials peers but
+accepts no incoming connections.
+
+With --all, every trusted peer found on the local network within --timeout is
+synced at once. Their file lists are merged and each missing chunk is
+downloaded only once, from the fastest peer that has it. --group does the same
+for the members of one peer group (see 'sietch sync group').
+
+After a complete sync, the peer's sync cursor is stored in .sietch/sync, and
+the next sync only asks the peer for files changed since. Use --full to
+request the peer's whole file list again, for example to restore files
+removed from this vault by hand.
+
+On slow links, --compress (or sync.transport_compression: zstd) asks peers
+that support it to compress file lists, and chunks they store uncompressed,
+with zstd in transit. Chunks are stored as received either way.
+
+--dry-run prints the plan without transferring anything: the files that would
+be added or deleted, files that differ on both sides (the local version is
+kept), and the chunks and bytes to download from each peer, along with what
+the peer would fetch from this vault. The command exits with an error when the
+sync would change anything, so it can serve as a scheduled health check.
+
+Files deleted with 'sietch delete' leave a tombstone that sync passes on, so
+peers move the file to their trash instead of copying it back. Tombstones are
+kept for sync.tombstone_retention (30 days by default); a peer that has not
+synced for longer than that may bring a deleted file back.
+
+With --ensure-replicas N, nothing is synced into this vault. Instead the
+trusted peers found (every one, the members of --group, or the given peer)
+are asked which files they hold, and peers that enabled sync.accept_replicas
+are asked to fetch the files of this vault with fewer than N copies, this
+vault included, from it. Copies go to the peers asked to hold the least data
+so far. See 'sietch status --replication' for the copies known to exist.
+The command fails if files are left with fewer than N copies.
+
+A chunk that fails to download is retried with exponential backoff (see
+--retries and --retry-backoff). If it still fails, the sync continues without
+it and skips the files that need it; those files are fetched by the next sync.
 
 Examples:
   sietch sync                               # Auto-discover and sync with peers
-  sietch sync /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID  # Sync with a specific peer`,
+  sietch sync /ip4/192.168.1.5/tcp/4001/p2p/QmPeerID  # Sync with a specific peer
+  sietch sync laptop                        # Discover and sync with a trusted peer
+  sietch sync -o json <peer-address>        # Emit the sync result as JSON
+  sietch sync --dry-run laptop              # Show what would be transferred
+  sietch sync --all                         # Sync with every trusted peer at once
+  sietch sync --compress laptop             # Compress traffic on a slow link
+  sietch sync --group field-team            # Sync with the members of a peer group
+  sietch sync --ensure-replicas 3           # Have peers hold 3 copies of every file
+  sietch sync --local /media/usb/vault      # Sync with a vault on a mounted drive
+  sietch sync --local ../backup --read-only # Only copy files from ../backup`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		// With structured output, progress and prompts go to stderr so that
+		// stdout carries only the encoded result
+		resultOut := os.Stdout
+		if format != outputTable {
+			os.Stdout = os.Stderr
+			defer func() { os.Stdout = resultOut }()
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
 		// Create a context with cancellation
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
@@ -50,7 +146,9 @@ Examples:
 		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 		go func() {
 			<-signalChan
-			fmt.Println("\nReceived interrupt signal, shutting down...")
+			// A second interrupt quits at once
+			signal.Stop(signalChan)
+			fmt.Println("\nReceived interrupt signal, stopping the sync and keeping what was transferred...")
 			cancel()
 		}()
 
@@ -66,66 +164,107 @@ Examples:
 			return fmt.Errorf("failed to load vault config: %v", err)
 		}
 
-		// Load RSA keys for secure communication
-		privateKey, publicKey, err := loadRSAKeys(vaultRoot, vaultCfg)
+		port, _ := cmd.Flags().GetInt("port")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		retry, err := retryPolicyFromFlags(cmd)
 		if err != nil {
-			return fmt.Errorf("failed to load RSA keys: %v", err)
+			return err
 		}
 
-		// Convert RSA private key to libp2p format
-		libp2pPrivKey, err := rsaToLibp2pPrivateKey(privateKey)
-		if err != nil {
-			return fmt.Errorf("failed to convert RSA key to libp2p format: %v", err)
+		syncAll, _ := cmd.Flags().GetBool("all")
+		if syncAll && len(args) > 0 {
+			return fmt.Errorf("--all cannot be combined with a peer argument")
 		}
-
-		// Create a libp2p host with our identity key
-		port, _ := cmd.Flags().GetInt("port")
-		var opts []libp2p.Option
-
-		// Use our RSA key as the node identity
-		opts = append(opts, libp2p.Identity(libp2pPrivKey))
-
-		if port > 0 {
-			opts = append(opts, libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port)))
-		} else {
-			opts = append(opts, libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"))
+		group, _ := cmd.Flags().GetString("group")
+		if group != "" && (syncAll || len(args) > 0) {
+			return fmt.Errorf("--group cannot be combined with a peer argument or --all")
 		}
-
-		host, err := libp2p.New(opts...)
-		if err != nil {
-			return fmt.Errorf("failed to create libp2p host: %v", err)
+		ensureReplicas, _ := cmd.Flags().GetInt("ensure-replicas")
+		if cmd.Flags().Changed("ensure-replicas") && ensureReplicas < 1 {
+			return fmt.Errorf("--ensure-replicas must be at least 1")
 		}
-		defer host.Close()
 
-		fmt.Printf("🔌 Started Sietch node with ID: %s\n", host.ID().String())
+		// A local vault is synced directly from disk without starting a node
+		if localPath, _ := cmd.Flags().GetString("local"); localPath != "" {
+			if len(args) > 0 || syncAll || group != "" || ensureReplicas > 0 {
+				return fmt.Errorf("--local cannot be combined with a peer argument, --all, --group or --ensure-replicas")
+			}
+			readOnly, _ := cmd.Flags().GetBool("read-only")
+			// Both vaults are written to, so the other one is locked as well
+			if !dryRun && !readOnly && fs.IsVaultInitialized(localPath) {
+				if err := lockVault(cmd, localPath); err != nil {
+					return err
+				}
+			}
+			return runLocalSync(vaultRoot, localPath, readOnly, dryRun, verbose, resultOut, format)
+		}
 
-		// Print our listen addresses
-		fmt.Println("📡 Listening on:")
-		for _, addr := range host.Addrs() {
-			fmt.Printf("   %s/p2p/%s\n", addr.String(), host.ID().String())
+		// Check the peers to sync with before starting a node
+		var wanted map[peer.ID]bool
+		if syncAll || group != "" || (ensureReplicas > 0 && len(args) == 0) {
+			if wanted, err = syncTargets(vaultCfg, group); err != nil {
+				return err
+			}
+		} else if ensureReplicas > 0 && !strings.HasPrefix(args[0], "/") {
+			id, err := resolveTrustedPeer(vaultCfg, args[0])
+			if err != nil {
+				return err
+			}
+			wanted = map[peer.ID]bool{id: true}
 		}
 
-		// Load the vault manager
-		vaultMgr, err := config.NewManager(vaultRoot)
+		listen, err := listenAddrsFromFlags(cmd, &vaultCfg.Sync)
 		if err != nil {
-			return fmt.Errorf("failed to load vault: %v", err)
+			return err
 		}
-
-		// Create the sync service with RSA key information
-		syncService, err := p2p.NewSecureSyncService(host, vaultMgr, privateKey, publicKey, vaultCfg.Sync.RSA)
+		host, syncService, err := startSyncNode(ctx, vaultRoot, vaultCfg, port, listen, verbose)
 		if err != nil {
-			return fmt.Errorf("failed to create sync service: %v", err)
+			return err
+		}
+		defer host.Close()
+		syncService.Retry = retry
+		if err := applyTimeoutFlags(cmd, syncService); err != nil {
+			return err
+		}
+		syncService.FullSync, _ = cmd.Flags().GetBool("full")
+		if compress, _ := cmd.Flags().GetBool("compress"); compress {
+			syncService.TransportCompression = constants.CompressionTypeZstd
+		}
+		if vaultCfg.Sync.AcceptReplicas {
+			syncService.EnableReplicas()
 		}
 
-		// Set verbose flag
-		verbose, _ := cmd.Flags().GetBool("verbose")
-		syncService.Verbose = verbose
+		if ensureReplicas > 0 {
+			var peers []peer.ID
+			if wanted != nil {
+				timeout, _ := cmd.Flags().GetInt("timeout")
+				if peers, err = discoverPeers(ctx, host, wanted, time.Duration(timeout)*time.Second); err != nil {
+					return err
+				}
+			} else {
+				maddr, err := multiaddr.NewMultiaddr(args[0])
+				if err != nil {
+					return fmt.Errorf("invalid peer address: %v", err)
+				}
+				info, err := peer.AddrInfoFromP2pAddr(maddr)
+				if err != nil {
+					return fmt.Errorf("failed to parse peer info: %v", err)
+				}
+				if err := host.Connect(ctx, *info); err != nil {
+					return fmt.Errorf("failed to connect to peer: %v", err)
+				}
+				peers = []peer.ID{info.ID}
+			}
+			return runEnsureReplicas(ctx, cmd, syncService, peers, ensureReplicas, dryRun, resultOut, format)
+		}
 
-		// Start secure protocol handlers
-		syncService.RegisterProtocols(ctx)
+		if wanted != nil {
+			timeout, _ := cmd.Flags().GetInt("timeout")
+			return runSyncAll(ctx, host, syncService, wanted, time.Duration(timeout)*time.Second, dryRun, resultOut, format)
+		}
 
 		// Specific peer address provided
-		if len(args) > 0 {
+		if len(args) > 0 && strings.HasPrefix(args[0], "/") {
 			peerAddr := args[0]
 			fmt.Printf("🔄 Connecting to peer: %s\n", peerAddr)
 
@@ -164,6 +303,11 @@ Examples:
 					fmt.Printf("Fingerprint: %s\n", fingerprint)
 				}
 
+				// Trusting a peer writes the vault config, which a dry run must not do
+				if dryRun {
+					return fmt.Errorf("dry run: peer is not trusted yet; run sync without --dry-run to review and trust it")
+				}
+
 				if !promptForTrust() {
 					return fmt.Errorf("sync canceled - peer not trusted")
 				}
@@ -176,21 +320,22 @@ Examples:
 			}
 
 			fmt.Println("📝 Starting vault synchronization...")
+			return runSync(ctx, syncService, info.ID, dryRun, resultOut, format)
+		}
 
-			// Sync with the peer
-			result, err := syncService.SyncWithPeer(ctx, info.ID)
+		// A trusted peer name or ID restricts discovery to that peer
+		var targetPeer peer.ID
+		if len(args) > 0 {
+			targetPeer, err = resolveTrustedPeer(vaultCfg, args[0])
 			if err != nil {
-				return fmt.Errorf("sync failed: %v", err)
+				return err
 			}
-
-			// Display sync results
-			displaySyncResults(result)
-			return nil
+			fmt.Printf("🔍 Looking for trusted peer %s on the local network...\n", args[0])
+		} else {
+			// Auto-discovery mode
+			fmt.Println("🔍 No peer specified, starting auto-discovery...")
 		}
 
-		// Auto-discovery mode
-		fmt.Println("🔍 No peer specified, starting auto-discovery...")
-
 		// Create the discovery factory
 		factory := p2p.NewFactory()
 
@@ -212,15 +357,20 @@ Examples:
 		timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 		defer timeoutCancel()
 
+		peers := discovery.DiscoveredPeers()
+		if targetPeer != "" {
+			peers = filterDiscoveredPeers(timeoutCtx, peers, targetPeer)
+		}
+
 		// Wait for peers
 		select {
-		case peerInfo := <-discovery.DiscoveredPeers():
+		case peerInfo := <-peers:
 			// Check if it's our own peer ID
 			if peerInfo.ID == host.ID() {
 				fmt.Println("🔄 Found our own peer, continuing discovery...")
 				// Continue waiting for other peers
 				select {
-				case peerInfo = <-discovery.DiscoveredPeers():
+				case peerInfo = <-peers:
 					if peerInfo.ID == host.ID() {
 						return fmt.Errorf("only found our own peer, no others on network")
 					}
@@ -252,6 +402,11 @@ Examples:
 					fmt.Printf("Fingerprint: %s\n", fingerprint)
 				}
 
+				// Trusting a peer writes the vault config, which a dry run must not do
+				if dryRun {
+					return fmt.Errorf("dry run: peer is not trusted yet; run sync without --dry-run to review and trust it")
+				}
+
 				if !promptForTrust() {
 					return fmt.Errorf("sync canceled - peer not trusted")
 				}
@@ -264,22 +419,336 @@ Examples:
 			}
 
 			fmt.Printf("🔄 Starting sync with peer: %s\n", peerInfo.ID.String())
+			return runSync(ctx, syncService, peerInfo.ID, dryRun, resultOut, format)
 
-			// Sync with the peer
-			result, err := syncService.SyncWithPeer(ctx, peerInfo.ID)
-			if err != nil {
-				return fmt.Errorf("sync failed: %v", err)
+		case <-timeoutCtx.Done():
+			return fmt.Errorf("discovery timed out after %d seconds, no peers found", timeout)
+		}
+	},
+}
+
+// syncTargets returns the trusted peers to sync with: every one for --all, or
+// the trusted members of group for --group
+func syncTargets(vaultCfg *config.VaultConfig, group string) (map[peer.ID]bool, error) {
+	var members []string
+	if group != "" {
+		g := vaultCfg.Sync.Group(group)
+		if g == nil {
+			return nil, fmt.Errorf("no peer group named %s; create it with 'sietch sync group add'", group)
+		}
+		members = g.Members
+	}
+
+	wanted := make(map[peer.ID]bool)
+	if vaultCfg.Sync.RSA != nil {
+		for _, p := range vaultCfg.Sync.RSA.TrustedPeers {
+			if group != "" && !slices.Contains(members, p.ID) {
+				continue
+			}
+			if id, err := peer.Decode(p.ID); err == nil {
+				wanted[id] = true
 			}
+		}
+	}
+	if len(wanted) == 0 && group != "" {
+		return nil, fmt.Errorf("peer group %s has no trusted members", group)
+	}
+	if len(wanted) == 0 {
+		return nil, fmt.Errorf("no trusted peers; sync with each peer once to trust it before using --all")
+	}
+	return wanted, nil
+}
 
-			// Display sync results
-			displaySyncResults(result)
+// runSyncAll discovers the wanted peers on the local network and syncs with
+// all of them at once, fetching each missing chunk only once
+func runSyncAll(ctx context.Context, h host.Host, syncService *p2p.SyncService, wanted map[peer.ID]bool,
+	timeout time.Duration, dryRun bool, w io.Writer, format string,
+) error {
+	found, err := discoverPeers(ctx, h, wanted, timeout)
+	if err != nil {
+		return err
+	}
 
-		case <-timeoutCtx.Done():
-			return fmt.Errorf("discovery timed out after %d seconds, no peers found", timeout)
+	if dryRun {
+		plan, err := syncService.PlanSyncWithPeers(ctx, found)
+		if err != nil {
+			return fmt.Errorf("sync planning failed: %v", err)
+		}
+		if err := displaySyncPlan(w, format, plan); err != nil {
+			return err
 		}
+		return pendingChangesError(plan)
+	}
+
+	fmt.Printf("🔄 Starting sync with %d peers\n", len(found))
+	result, err := syncService.SyncWithPeers(ctx, found)
+	if err != nil {
+		return syncFailedError(w, format, result, err)
+	}
+	if err := displaySyncResults(w, format, result); err != nil {
+		return err
+	}
+	return incompleteSyncError(result)
+}
 
+// runEnsureReplicas has peers fetch copies of the files of this vault with
+// fewer than want copies, or only shows which would be asked with dryRun
+func runEnsureReplicas(ctx context.Context, cmd *cobra.Command, syncService *p2p.SyncService, peers []peer.ID,
+	want int, dryRun bool, w io.Writer, format string,
+) error {
+	plan, err := syncService.PlanReplicas(ctx, peers, want)
+	if err != nil {
+		return fmt.Errorf("replica planning failed: %v", err)
+	}
+	if !dryRun {
+		fmt.Printf("📤 Asking %d peers to hold copies of %d files\n", len(plan.Requests), len(plan.Below))
+		if err := syncService.EnsureReplicas(ctx, plan); err != nil {
+			return err
+		}
+	}
+
+	var failure error
+	if below := replicasStillBelow(plan, dryRun); below > 0 {
+		failure = fmt.Errorf("%d files have fewer than %d copies", below, want)
+	}
+	if format != outputTable {
+		if err := writeStructured(w, format, plan); err != nil {
+			return err
+		}
+		if failure != nil {
+			cmd.SilenceErrors, cmd.SilenceUsage = true, true
+			return reportedError{failure}
+		}
 		return nil
-	},
+	}
+	if err := displayReplicaPlan(w, plan, dryRun); err != nil {
+		return err
+	}
+	return failure
+}
+
+// replicasStillBelow counts the files of plan left with too few copies: all
+// of them before the plan is carried out, then those no peer could take and
+// those a peer failed to store
+func replicasStillBelow(plan *p2p.ReplicaPlan, dryRun bool) int {
+	if dryRun {
+		return len(plan.Below)
+	}
+	below := make(map[string]bool)
+	for _, path := range plan.Short {
+		below[path] = true
+	}
+	for _, request := range plan.Requests {
+		for _, path := range request.Files {
+			if !slices.Contains(request.Stored, path) {
+				below[path] = true
+			}
+		}
+	}
+	return len(below)
+}
+
+// displayReplicaPlan prints what each peer was asked to hold and, unless
+// dryRun, what it stored
+func displayReplicaPlan(w io.Writer, plan *p2p.ReplicaPlan, dryRun bool) error {
+	fmt.Fprintf(w, "%d of %d files have fewer than %d copies\n", len(plan.Below), plan.Files, plan.Want)
+	if len(plan.Requests) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		if dryRun {
+			fmt.Fprintln(tw, "PEER\tFILES\tSIZE")
+		} else {
+			fmt.Fprintln(tw, "PEER\tFILES\tSIZE\tSTORED\tCHUNKS\tDATA\tSTATUS")
+		}
+		for _, r := range plan.Requests {
+			if dryRun {
+				fmt.Fprintf(tw, "%s\t%d\t%s\n", r.Peer, len(r.Files), util.HumanReadableSize(r.Size))
+				continue
+			}
+			status := "ok"
+			switch {
+			case r.Error != "":
+				status = r.Error
+			case len(r.Stored) < len(r.Files):
+				status = fmt.Sprintf("%d incomplete", len(r.Files)-len(r.Stored))
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\t%s\t%s\n", r.Peer, len(r.Files), util.HumanReadableSize(r.Size),
+				len(r.Stored), r.Chunks, util.HumanReadableSize(r.Bytes), status)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(plan.Short) > 0 {
+		fmt.Fprintf(w, "⚠️  %d files cannot reach %d copies: too few of the peers found accept replicas (sync.accept_replicas), may see them and lack them\n",
+			len(plan.Short), plan.Want)
+		for _, path := range plan.Short {
+			fmt.Fprintf(w, "  %s\n", path)
+		}
+	}
+	return nil
+}
+
+// discoverPeers searches the local network for the wanted peers and returns
+// those it connected to, once all are found or timeout expires
+func discoverPeers(ctx context.Context, h host.Host, wanted map[peer.ID]bool, timeout time.Duration) ([]peer.ID, error) {
+	discovery, err := p2p.NewFactory().CreateMDNS(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mDNS discovery: %v", err)
+	}
+	if err := discovery.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start mDNS discovery: %v", err)
+	}
+	defer func() { _ = discovery.Stop() }()
+
+	fmt.Printf("📡 Searching for %d trusted peers on local network...\n", len(wanted))
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, timeout)
+	defer timeoutCancel()
+
+	// Stop searching once every trusted peer is found or the timeout expires
+	var found []peer.ID
+	peers := discovery.DiscoveredPeers()
+search:
+	for len(found) < len(wanted) {
+		select {
+		case info, ok := <-peers:
+			if !ok {
+				break search
+			}
+			if !wanted[info.ID] || slices.Contains(found, info.ID) {
+				continue
+			}
+			if err := h.Connect(ctx, info); err != nil {
+				fmt.Printf("⚠️  Failed to connect to peer %s: %v\n", info.ID.String(), err)
+				continue
+			}
+			fmt.Printf("✅ Found peer: %s\n", info.ID.String())
+			found = append(found, info.ID)
+		case <-timeoutCtx.Done():
+			break search
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("discovery timed out after %v, no trusted peers found", timeout)
+	}
+	return found, nil
+}
+
+// resolveTrustedPeer maps a trusted peer name or ID from the vault config to its peer ID
+func resolveTrustedPeer(cfg *config.VaultConfig, nameOrID string) (peer.ID, error) {
+	if cfg.Sync.RSA != nil {
+		for _, p := range cfg.Sync.RSA.TrustedPeers {
+			if p.ID == nameOrID || (p.Name != "" && p.Name == nameOrID) {
+				id, err := peer.Decode(p.ID)
+				if err != nil {
+					return "", fmt.Errorf("invalid ID for trusted peer %s: %v", nameOrID, err)
+				}
+				return id, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("'%s' is not a multiaddress or a trusted peer name/ID", nameOrID)
+}
+
+// filterDiscoveredPeers forwards only discoveries of the target peer
+func filterDiscoveredPeers(ctx context.Context, in <-chan peer.AddrInfo, target peer.ID) <-chan peer.AddrInfo {
+	out := make(chan peer.AddrInfo, 1)
+	go func() {
+		for {
+			select {
+			case info, ok := <-in:
+				if !ok {
+					return
+				}
+				if info.ID == target {
+					out <- info
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// startSyncNode creates a libp2p host using the vault's RSA identity and
+// starts a secure sync service on it. The host listens on listen when given,
+// otherwise on port. The caller must close the host.
+func startSyncNode(ctx context.Context, vaultRoot string, vaultCfg *config.VaultConfig, port int, listen []string, verbose bool) (host.Host, *p2p.SyncService, error) {
+	// Load RSA keys for secure communication
+	privateKey, publicKey, err := loadRSAKeys(vaultRoot, vaultCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load RSA keys: %v", err)
+	}
+
+	// Convert RSA private key to libp2p format
+	libp2pPrivKey, err := rsaToLibp2pPrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to convert RSA key to libp2p format: %v", err)
+	}
+
+	// Use our RSA key as the node identity
+	opts := []libp2p.Option{libp2p.Identity(libp2pPrivKey)}
+	if port > 0 {
+		opts = append(opts, libp2p.ListenAddrStrings(fmt.Sprintf("/ip4/0.0.0.0/tcp/%d", port)))
+	} else {
+		opts = append(opts, libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"))
+	}
+	listenOpt, err := p2p.ListenOption(listen)
+	if err != nil {
+		return nil, nil, err
+	}
+	if listenOpt != nil {
+		opts = append(opts, listenOpt)
+	}
+
+	// With a swarm key, only nodes holding the same key can connect
+	networkKey, err := p2p.NetworkKeyOption(vaultRoot, &vaultCfg.Sync)
+	if err != nil {
+		return nil, nil, err
+	}
+	if networkKey != nil {
+		opts = append(opts, networkKey)
+	}
+
+	h, err := libp2p.New(opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create libp2p host: %v", err)
+	}
+
+	fmt.Printf("🔌 Started Sietch node with ID: %s\n", h.ID().String())
+	if networkKey != nil {
+		fmt.Println("🔒 Private network: only nodes with this vault's network key can connect")
+	}
+
+	// Print our listen addresses
+	if len(h.Addrs()) == 0 {
+		fmt.Println("📡 Not listening: peers cannot connect to this node, it only dials out")
+	} else {
+		fmt.Println("📡 Listening on:")
+		for _, addr := range h.Addrs() {
+			fmt.Printf("   %s/p2p/%s\n", addr.String(), h.ID().String())
+		}
+	}
+
+	// Load the vault manager
+	vaultMgr, err := config.NewManager(vaultRoot)
+	if err != nil {
+		h.Close()
+		return nil, nil, fmt.Errorf("failed to load vault: %v", err)
+	}
+
+	// Create the sync service with RSA key information
+	syncService, err := p2p.NewSecureSyncService(h, vaultMgr, privateKey, publicKey, vaultCfg.Sync.RSA)
+	if err != nil {
+		h.Close()
+		return nil, nil, fmt.Errorf("failed to create sync service: %v", err)
+	}
+	syncService.Verbose = verbose
+
+	// Start secure protocol handlers
+	syncService.RegisterProtocols(ctx)
+	return h, syncService, nil
 }
 
 // loadRSAKeys loads the RSA key pair from the vault
@@ -325,23 +794,449 @@ func promptForTrust() bool {
 	return response == "y" || response == "Y" || response == "yes" || response == "Yes"
 }
 
+// runSync syncs with a connected, trusted peer, or in dry-run mode only reports
+// what the sync would transfer
+func runSync(ctx context.Context, syncService *p2p.SyncService, peerID peer.ID, dryRun bool, w io.Writer, format string) error {
+	if dryRun {
+		plan, err := syncService.PlanSyncWithPeer(ctx, peerID)
+		if err != nil {
+			return fmt.Errorf("sync planning failed: %v", err)
+		}
+		if err := displaySyncPlan(w, format, plan); err != nil {
+			return err
+		}
+		return pendingChangesError(plan)
+	}
+
+	// Sync with the peer
+	result, err := syncService.SyncWithPeer(ctx, peerID)
+	if err != nil {
+		return syncFailedError(w, format, result, err)
+	}
+
+	// Display sync results
+	if err := displaySyncResults(w, format, result); err != nil {
+		return err
+	}
+	return incompleteSyncError(result)
+}
+
+// syncFailedError reports a failed sync, showing what an interrupted one
+// transferred before it stopped
+func syncFailedError(w io.Writer, format string, result *p2p.SyncResult, err error) error {
+	if result != nil && result.Interrupted {
+		if displayErr := displaySyncResults(w, format, result); displayErr != nil {
+			return displayErr
+		}
+	}
+	return fmt.Errorf("sync failed: %v", err)
+}
+
+// incompleteSyncError reports chunks a sync could not fetch, so the command
+// exits with an error even though the rest of the vault was synced
+func incompleteSyncError(results ...*p2p.SyncResult) error {
+	failed := 0
+	for _, result := range results {
+		if result != nil {
+			failed += len(result.FailedChunks)
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("sync incomplete: %d chunks could not be fetched; run sync again to retry them", failed)
+}
+
+// pendingChangesError makes a dry run exit with an error when the sync would
+// change either vault, so a scheduled check can tell when one is due
+func pendingChangesError(plans ...*p2p.SyncPlan) error {
+	files, deletions, chunks := 0, 0, 0
+	for _, plan := range plans {
+		if plan != nil && plan.HasChanges() {
+			files += len(plan.Files)
+			deletions += len(plan.Deletions)
+			chunks += plan.ChunksToTransfer
+		}
+	}
+	if files+deletions+chunks == 0 {
+		return nil
+	}
+	return fmt.Errorf("sync would make changes: %d files to add, %d to delete, %d chunks to transfer", files, deletions, chunks)
+}
+
+// retryPolicyFromFlags builds the chunk fetch retry policy from --retries and --retry-backoff
+func retryPolicyFromFlags(cmd *cobra.Command) (p2p.RetryPolicy, error) {
+	policy := p2p.DefaultRetryPolicy
+	policy.Retries, _ = cmd.Flags().GetInt("retries")
+	policy.BaseDelay, _ = cmd.Flags().GetDuration("retry-backoff")
+	if policy.Retries < 0 {
+		return policy, fmt.Errorf("--retries cannot be negative")
+	}
+	if policy.BaseDelay < 0 {
+		return policy, fmt.Errorf("--retry-backoff cannot be negative")
+	}
+	return policy, nil
+}
+
+// timeoutFlags are the flags overriding each of sync.timeouts
+var timeoutFlags = []struct {
+	name, usage string
+	field       func(*p2p.Timeouts) *time.Duration
+}{
+	{"handshake-timeout", "Time to wait for each handshake, key exchange and authentication message", func(t *p2p.Timeouts) *time.Duration { return &t.Handshake }},
+	{"manifest-timeout", "Time to wait for each manifest exchange", func(t *p2p.Timeouts) *time.Duration { return &t.Manifest }},
+	{"chunk-timeout", "Time to wait for each chunk transfer", func(t *p2p.Timeouts) *time.Duration { return &t.Chunk }},
+	{"sync-timeout", "Time a whole sync may take", func(t *p2p.Timeouts) *time.Duration { return &t.Sync }},
+}
+
+// addTimeoutFlags adds the flags of timeoutFlags to cmd
+func addTimeoutFlags(cmd *cobra.Command) {
+	for _, f := range timeoutFlags {
+		cmd.Flags().Duration(f.name, 0, f.usage+" (default: sync.timeouts or "+f.field(&p2p.DefaultTimeouts).String()+")")
+	}
+}
+
+// applyTimeoutFlags overrides the timeouts of s with those given as flags
+func applyTimeoutFlags(cmd *cobra.Command, s *p2p.SyncService) error {
+	for _, f := range timeoutFlags {
+		if !cmd.Flags().Changed(f.name) {
+			continue
+		}
+		d, _ := cmd.Flags().GetDuration(f.name)
+		if d <= 0 {
+			return fmt.Errorf("--%s must be positive", f.name)
+		}
+		*f.field(&s.Timeouts) = d
+	}
+	return nil
+}
+
+// listenAddrsFromFlags returns the addresses given with --listen or
+// --no-listen, falling back to sync.listen_addrs in cfg unless --port is set.
+// It returns nil when the node should listen on its default addresses.
+func listenAddrsFromFlags(cmd *cobra.Command, cfg *config.SyncConfig) ([]string, error) {
+	listen, _ := cmd.Flags().GetStringSlice("listen")
+	noListen, _ := cmd.Flags().GetBool("no-listen")
+	switch {
+	case noListen && len(listen) > 0:
+		return nil, fmt.Errorf("--no-listen cannot be combined with --listen")
+	case noListen:
+		return []string{config.NoListenAddrs}, nil
+	case len(listen) > 0:
+		return listen, nil
+	case cmd.Flags().Changed("port") || cfg == nil:
+		return nil, nil
+	}
+	return cfg.ListenAddrs, nil
+}
+
+// runLocalSync syncs with the vault at otherPath on the local filesystem,
+// receiving its missing files and, unless readOnly, sending ours to it
+func runLocalSync(vaultRoot, otherPath string, readOnly, dryRun, verbose bool, w io.Writer, format string) error {
+	otherRoot, err := filepath.Abs(otherPath)
+	if err != nil {
+		return fmt.Errorf("invalid vault path: %v", err)
+	}
+
+	localMgr, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to load vault: %v", err)
+	}
+	otherMgr, err := config.NewManager(otherRoot)
+	if err != nil {
+		return fmt.Errorf("failed to load vault at %s: %v", otherRoot, err)
+	}
+	receive := p2p.NewLocalSyncService(localMgr)
+	receive.Verbose = verbose
+	send := p2p.NewLocalSyncService(otherMgr)
+	send.Verbose = verbose
+
+	// A replica only ever receives, and is never written to as the other side
+	if !readOnly {
+		if cfg, err := localMgr.GetConfig(); err == nil && cfg.Replica {
+			fmt.Println("ℹ️  This vault is a replica; only receiving changes")
+			readOnly = true
+		} else if cfg, err := otherMgr.GetConfig(); err == nil && cfg.Replica {
+			fmt.Printf("ℹ️  %s is a replica; not sending changes to it\n", otherRoot)
+			readOnly = true
+		}
+	}
+
+	fmt.Printf("🔄 Syncing with local vault: %s\n", otherRoot)
+
+	if dryRun {
+		received, err := receive.PlanSyncWithVault(otherRoot)
+		if err != nil {
+			return fmt.Errorf("sync planning failed: %v", err)
+		}
+		var sent *p2p.SyncPlan
+		if !readOnly {
+			if sent, err = send.PlanSyncWithVault(vaultRoot); err != nil {
+				return fmt.Errorf("sync planning failed: %v", err)
+			}
+		}
+		if err := displayLocalSyncPlan(w, format, received, sent); err != nil {
+			return err
+		}
+		return pendingChangesError(received, sent)
+	}
+
+	received, err := receive.SyncWithVault(otherRoot)
+	if err != nil {
+		return fmt.Errorf("sync failed: %v", err)
+	}
+	var sent *p2p.SyncResult
+	if !readOnly {
+		if sent, err = send.SyncWithVault(vaultRoot); err != nil {
+			return fmt.Errorf("sync failed while sending to %s: %v", otherRoot, err)
+		}
+	}
+	if err := displayLocalSyncResults(w, format, received, sent); err != nil {
+		return err
+	}
+	return incompleteSyncError(received, sent)
+}
+
+// localSyncPlanOutput is the structured representation of a dry-run local sync
+type localSyncPlanOutput struct {
+	Received syncPlanOutput  `json:"received" yaml:"received"`
+	Sent     *syncPlanOutput `json:"sent,omitempty" yaml:"sent,omitempty"`
+}
+
+// displayLocalSyncPlan shows what a local sync would copy in each direction
+func displayLocalSyncPlan(w io.Writer, format string, received, sent *p2p.SyncPlan) error {
+	if format != outputTable {
+		out := localSyncPlanOutput{Received: newSyncPlanOutput(received)}
+		if sent != nil {
+			s := newSyncPlanOutput(sent)
+			out.Sent = &s
+		}
+		return writeStructured(w, format, out)
+	}
+
+	fmt.Fprint(w, "\n⬇ Receive")
+	if err := displaySyncPlan(w, format, received); err != nil {
+		return err
+	}
+	if sent != nil {
+		fmt.Fprint(w, "\n⬆ Send")
+		return displaySyncPlan(w, format, sent)
+	}
+	return nil
+}
+
+// localSyncResultOutput is the structured representation of a local sync
+type localSyncResultOutput struct {
+	Received syncResultOutput  `json:"received" yaml:"received"`
+	Sent     *syncResultOutput `json:"sent,omitempty" yaml:"sent,omitempty"`
+}
+
+// displayLocalSyncResults shows what a local sync copied in each direction
+func displayLocalSyncResults(w io.Writer, format string, received, sent *p2p.SyncResult) error {
+	if format != outputTable {
+		out := localSyncResultOutput{Received: newSyncResultOutput(received)}
+		if sent != nil {
+			s := newSyncResultOutput(sent)
+			out.Sent = &s
+		}
+		return writeStructured(w, format, out)
+	}
+
+	fmt.Fprint(w, "\n⬇ Receive")
+	if err := displaySyncResults(w, format, received); err != nil {
+		return err
+	}
+	if sent != nil {
+		fmt.Fprint(w, "\n⬆ Send")
+		return displaySyncResults(w, format, sent)
+	}
+	return nil
+}
+
+// syncPlanOutput is the structured (json/yaml) representation of a dry-run sync
+type syncPlanOutput struct {
+	DryRun             bool     `json:"dry_run" yaml:"dry_run"`
+	Files              []string `json:"files" yaml:"files"`
+	Deletions          []string `json:"deletions,omitempty" yaml:"deletions,omitempty"`
+	Conflicts          []string `json:"conflicts,omitempty" yaml:"conflicts,omitempty"`
+	Rejected           []string `json:"rejected,omitempty" yaml:"rejected,omitempty"`
+	ChunksToTransfer   int      `json:"chunks_to_transfer" yaml:"chunks_to_transfer"`
+	ChunksDeduplicated int      `json:"chunks_deduplicated" yaml:"chunks_deduplicated"`
+	BytesToTransfer    int64    `json:"bytes_to_transfer" yaml:"bytes_to_transfer"`
+	Changes            bool     `json:"changes" yaml:"changes"`
+
+	Peers []peerPlanOutput `json:"peers,omitempty" yaml:"peers,omitempty"`
+}
+
+// peerPlanOutput is the structured representation of the transfers with one peer
+type peerPlanOutput struct {
+	Peer             string `json:"peer" yaml:"peer"`
+	ChunksToDownload int    `json:"chunks_to_download" yaml:"chunks_to_download"`
+	BytesToDownload  int64  `json:"bytes_to_download" yaml:"bytes_to_download"`
+	FilesToUpload    int    `json:"files_to_upload" yaml:"files_to_upload"`
+	ChunksToUpload   int    `json:"chunks_to_upload" yaml:"chunks_to_upload"`
+	BytesToUpload    int64  `json:"bytes_to_upload" yaml:"bytes_to_upload"`
+}
+
+func newSyncPlanOutput(plan *p2p.SyncPlan) syncPlanOutput {
+	files := plan.Files
+	if files == nil {
+		files = []string{}
+	}
+	out := syncPlanOutput{
+		DryRun:             true,
+		Files:              files,
+		Deletions:          plan.Deletions,
+		Conflicts:          plan.Conflicts,
+		Rejected:           plan.Rejected,
+		ChunksToTransfer:   plan.ChunksToTransfer,
+		ChunksDeduplicated: plan.ChunksDeduplicated,
+		BytesToTransfer:    plan.BytesToTransfer,
+		Changes:            plan.HasChanges(),
+	}
+	for _, p := range plan.Peers {
+		out.Peers = append(out.Peers, peerPlanOutput(p))
+	}
+	return out
+}
+
+// displaySyncPlan shows what a sync would transfer
+func displaySyncPlan(w io.Writer, format string, plan *p2p.SyncPlan) error {
+	if format != outputTable {
+		return writeStructured(w, format, newSyncPlanOutput(plan))
+	}
+
+	fmt.Fprintln(w, "\n[dry-run] Nothing was transferred")
+	fmt.Fprintf(w, "   Files to add:         %d\n", len(plan.Files))
+	for _, file := range plan.Files {
+		fmt.Fprintf(w, "     + %s\n", file)
+	}
+	if len(plan.Deletions) > 0 {
+		fmt.Fprintf(w, "   Files to delete:      %d\n", len(plan.Deletions))
+		for _, file := range plan.Deletions {
+			fmt.Fprintf(w, "     - %s\n", file)
+		}
+	}
+	if len(plan.Conflicts) > 0 {
+		fmt.Fprintf(w, "   Conflicts:            %d (local version kept)\n", len(plan.Conflicts))
+		for _, file := range plan.Conflicts {
+			fmt.Fprintf(w, "     ! %s\n", file)
+		}
+	}
+	if len(plan.Rejected) > 0 {
+		fmt.Fprintf(w, "   Unsafe paths:         %d (ignored)\n", len(plan.Rejected))
+		for _, file := range plan.Rejected {
+			fmt.Fprintf(w, "     ✗ %s\n", file)
+		}
+	}
+	fmt.Fprintf(w, "   Chunks to transfer:   %d\n", plan.ChunksToTransfer)
+	fmt.Fprintf(w, "   Chunks already local: %d\n", plan.ChunksDeduplicated)
+	fmt.Fprintf(w, "   Data to transfer:     %s\n", util.HumanReadableSize(plan.BytesToTransfer))
+	for _, p := range plan.Peers {
+		fmt.Fprintf(w, "   Peer %s\n", p.Peer)
+		fmt.Fprintf(w, "     ⬇ %d chunks, %s\n", p.ChunksToDownload, util.HumanReadableSize(p.BytesToDownload))
+		fmt.Fprintf(w, "     ⬆ %d files, %d chunks, %s when it syncs from this vault\n",
+			p.FilesToUpload, p.ChunksToUpload, util.HumanReadableSize(p.BytesToUpload))
+	}
+	return nil
+}
+
+// syncResultOutput is the structured (json/yaml) representation of a sync result
+type syncResultOutput struct {
+	FileCount          int      `json:"file_count" yaml:"file_count"`
+	ChunksTransferred  int      `json:"chunks_transferred" yaml:"chunks_transferred"`
+	ChunksDeduplicated int      `json:"chunks_deduplicated" yaml:"chunks_deduplicated"`
+	BytesTransferred   int64    `json:"bytes_transferred" yaml:"bytes_transferred"`
+	DurationMs         int64    `json:"duration_ms" yaml:"duration_ms"`
+	FailedChunks       []string `json:"failed_chunks,omitempty" yaml:"failed_chunks,omitempty"`
+	CorruptChunks      []string `json:"corrupt_chunks,omitempty" yaml:"corrupt_chunks,omitempty"`
+	IncompleteFiles    []string `json:"incomplete_files,omitempty" yaml:"incomplete_files,omitempty"`
+	FilesDeleted       []string `json:"files_deleted,omitempty" yaml:"files_deleted,omitempty"`
+	RejectedFiles      []string `json:"rejected_files,omitempty" yaml:"rejected_files,omitempty"`
+	Interrupted        bool     `json:"interrupted,omitempty" yaml:"interrupted,omitempty"`
+	ChunksRemaining    int      `json:"chunks_remaining,omitempty" yaml:"chunks_remaining,omitempty"`
+}
+
+func newSyncResultOutput(result *p2p.SyncResult) syncResultOutput {
+	return syncResultOutput{
+		FileCount:          result.FileCount,
+		ChunksTransferred:  result.ChunksTransferred,
+		ChunksDeduplicated: result.ChunksDeduplicated,
+		BytesTransferred:   result.BytesTransferred,
+		DurationMs:         result.Duration.Milliseconds(),
+		FailedChunks:       result.FailedChunks,
+		CorruptChunks:      result.CorruptChunks,
+		IncompleteFiles:    result.IncompleteFiles,
+		FilesDeleted:       result.FilesDeleted,
+		RejectedFiles:      result.RejectedFiles,
+		Interrupted:        result.Interrupted,
+		ChunksRemaining:    result.ChunksRemaining,
+	}
+}
+
 // displaySyncResults shows the results of a sync operation
-func displaySyncResults(result *p2p.SyncResult) {
-	fmt.Println("\n✅ Synchronization complete!")
-	fmt.Printf("   Files transferred:    %d\n", result.FileCount)
-	fmt.Printf("   Chunks transferred:   %d\n", result.ChunksTransferred)
-	fmt.Printf("   Chunks deduplicated:  %d\n", result.ChunksDeduplicated)
-	fmt.Printf("   Data transferred:     %s\n", util.HumanReadableSize(result.BytesTransferred))
-	fmt.Printf("   Duration:             %s\n", result.Duration.Round(time.Millisecond))
+func displaySyncResults(w io.Writer, format string, result *p2p.SyncResult) error {
+	if format != outputTable {
+		return writeStructured(w, format, newSyncResultOutput(result))
+	}
+
+	if result.Interrupted {
+		fmt.Fprintln(w, "\n⏸️  Synchronization interrupted")
+	} else {
+		fmt.Fprintln(w, "\n✅ Synchronization complete!")
+	}
+	fmt.Fprintf(w, "   Files transferred:    %d\n", result.FileCount)
+	if len(result.FilesDeleted) > 0 {
+		fmt.Fprintf(w, "   Files deleted:        %d\n", len(result.FilesDeleted))
+	}
+	fmt.Fprintf(w, "   Chunks transferred:   %d\n", result.ChunksTransferred)
+	fmt.Fprintf(w, "   Chunks deduplicated:  %d\n", result.ChunksDeduplicated)
+	fmt.Fprintf(w, "   Data transferred:     %s\n", util.HumanReadableSize(result.BytesTransferred))
+	fmt.Fprintf(w, "   Duration:             %s\n", result.Duration.Round(time.Millisecond))
+	switch {
+	case result.Interrupted:
+		fmt.Fprintf(w, "\n⚠️  %d chunks were not fetched; run sync again to resume. These files were not saved yet:\n", result.ChunksRemaining+len(result.FailedChunks))
+	case len(result.FailedChunks) > 0:
+		fmt.Fprintf(w, "\n⚠️  %d chunks could not be fetched; these files were skipped and will be retried on the next sync:\n", len(result.FailedChunks))
+	}
+	for _, file := range result.IncompleteFiles {
+		fmt.Fprintf(w, "     ! %s\n", file)
+	}
+	if len(result.CorruptChunks) > 0 {
+		fmt.Fprintf(w, "\n⚠️  %d chunks were rejected because their data did not match their hash:\n", len(result.CorruptChunks))
+		for _, hash := range result.CorruptChunks {
+			fmt.Fprintf(w, "     ✗ %s\n", hash)
+		}
+	}
+	if len(result.RejectedFiles) > 0 {
+		fmt.Fprintf(w, "\n⚠️  %d remote files were ignored because their paths are unsafe:\n", len(result.RejectedFiles))
+		for _, file := range result.RejectedFiles {
+			fmt.Fprintf(w, "     ✗ %s\n", file)
+		}
+	}
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(syncCmd)
 
+	syncCmd.ValidArgsFunction = completePeers
+
 	// Add command flags
 	syncCmd.Flags().IntP("port", "p", 0, "Port to use for libp2p (0 for random port)")
+	syncCmd.Flags().StringSlice("listen", nil, "Multiaddrs to listen on instead of sync.listen_addrs (repeatable)")
+	syncCmd.Flags().Bool("no-listen", false, "Accept no incoming connections, only dial out to peers")
 	syncCmd.Flags().IntP("timeout", "t", 60, "Discovery timeout in seconds (for auto-discovery)")
 	syncCmd.Flags().BoolP("force-trust", "f", false, "Automatically trust new peers without prompting")
 	syncCmd.Flags().BoolP("read-only", "r", false, "Only receive files, don't send")
 	syncCmd.Flags().BoolP("verbose", "v", false, "Enable verbose debug output")
+	syncCmd.Flags().Bool("full", false, "Request the peer's whole file list instead of changes since the last sync")
+	syncCmd.Flags().Bool("compress", false, "Ask peers to compress manifests and uncompressed chunks with zstd in transit (see sync.transport_compression)")
+	syncCmd.Flags().Bool("all", false, "Sync with all trusted peers found on the local network at once")
+	syncCmd.Flags().String("group", "", "Sync with the members of this peer group found on the local network at once")
+	syncCmd.Flags().String("local", "", "Sync with a vault at this path instead of a network peer")
+	syncCmd.Flags().Int("ensure-replicas", 0, "Have trusted peers fetch copies of files with fewer than this many copies, this vault included")
+	syncCmd.Flags().Int("retries", p2p.DefaultRetryPolicy.Retries, "Times to retry a failed chunk fetch before skipping it")
+	syncCmd.Flags().Duration("retry-backoff", p2p.DefaultRetryPolicy.BaseDelay, "Delay before the first retry, doubled for each retry after")
+	addTimeoutFlags(syncCmd)
 }
@@ -0,0 +1,181 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/p2p"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// syncHistoryCmd shows the syncs recorded in .sietch/sync/history.jsonl
+var syncHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show recent syncs and transfer totals per peer",
+	Long: `Show the syncs this vault has run and what each transferred.
+
+Every sync with a peer, a group of peers, another vault or a bundle is
+appended to .sietch/sync/history.jsonl with its duration, the files, chunks
+and bytes it transferred and the chunks it failed to fetch. The most recent
+runs are listed newest first, followed by the totals of every source over the
+whole history. Peers are shown by their trusted name when they have one.
+
+Examples:
+  sietch sync history                 # The last 20 syncs and totals per peer
+  sietch sync history --peer laptop   # Only syncs with one peer
+  sietch sync history -n 0 -o json    # Every sync, for scripts`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+
+		runs, err := p2p.ReadSyncHistory(vaultRoot)
+		if err != nil {
+			return err
+		}
+		names := trustedPeerNames(vaultConfig)
+		if peer, _ := cmd.Flags().GetString("peer"); peer != "" {
+			runs = filterSyncRuns(runs, resolvePeerName(names, peer))
+		}
+		totals := p2p.SummarizeSyncHistory(runs)
+
+		// Newest first, then the most recent limit of them
+		recent := make([]p2p.SyncRun, len(runs))
+		for i, run := range runs {
+			recent[len(runs)-1-i] = run
+		}
+		if limit, _ := cmd.Flags().GetInt("limit"); limit > 0 && len(recent) > limit {
+			recent = recent[:limit]
+		}
+
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, syncHistoryOutput{Runs: recent, Totals: totals})
+		}
+		if len(runs) == 0 {
+			fmt.Println("No syncs recorded")
+			return nil
+		}
+		return displaySyncHistory(os.Stdout, recent, totals, names)
+	},
+}
+
+// syncHistoryOutput is the structured form of sync history
+type syncHistoryOutput struct {
+	Runs   []p2p.SyncRun    `json:"runs" yaml:"runs"`
+	Totals []p2p.SyncTotals `json:"totals" yaml:"totals"`
+}
+
+// trustedPeerNames maps the ID of every named trusted peer to its name
+func trustedPeerNames(vaultConfig *config.VaultConfig) map[string]string {
+	names := make(map[string]string)
+	if vaultConfig.Sync.RSA == nil {
+		return names
+	}
+	for _, peer := range vaultConfig.Sync.RSA.TrustedPeers {
+		if peer.Name != "" {
+			names[peer.ID] = peer.Name
+		}
+	}
+	return names
+}
+
+// resolvePeerName returns the ID of the trusted peer named name, or name
+// itself if no peer has that name
+func resolvePeerName(names map[string]string, name string) string {
+	for id, peerName := range names {
+		if peerName == name {
+			return id
+		}
+	}
+	return name
+}
+
+// filterSyncRuns keeps the runs source took part in
+func filterSyncRuns(runs []p2p.SyncRun, source string) []p2p.SyncRun {
+	var matched []p2p.SyncRun
+	for _, run := range runs {
+		if run.Involves(source) {
+			matched = append(matched, run)
+		}
+	}
+	return matched
+}
+
+// displaySyncHistory prints recent runs and the totals per source as tables
+func displaySyncHistory(w io.Writer, recent []p2p.SyncRun, totals []p2p.SyncTotals, names map[string]string) error {
+	displayName := func(source string) string {
+		if name, ok := names[source]; ok {
+			return name
+		}
+		return source
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tKIND\tSOURCE\tFILES\tCHUNKS\tDATA\tDURATION\tSTATUS")
+	for _, run := range recent {
+		sources := strings.Split(run.Source, ",")
+		for i, source := range sources {
+			sources[i] = displayName(source)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			run.Time.Local().Format("2006-01-02 15:04:05"), run.Kind, strings.Join(sources, ","),
+			run.Files, run.Chunks, util.HumanReadableSize(run.Bytes),
+			run.Duration().Round(time.Millisecond), syncRunStatus(run))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nTotals:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tSOURCE\tRUNS\tFAILED\tFILES\tCHUNKS\tDATA\tLAST SYNC")
+	for _, t := range totals {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			t.Kind, displayName(t.Source), t.Runs, t.Failures, t.Files, t.Chunks,
+			util.HumanReadableSize(t.Bytes), t.LastSync.Local().Format("2006-01-02 15:04:05"))
+	}
+	return tw.Flush()
+}
+
+// syncRunStatus summarizes how a run ended
+func syncRunStatus(run p2p.SyncRun) string {
+	switch {
+	case run.Interrupted:
+		return "interrupted"
+	case run.Corrupt > 0:
+		return fmt.Sprintf("%d failed, %d corrupt", run.Failed, run.Corrupt)
+	case run.Failed > 0:
+		return fmt.Sprintf("%d failed", run.Failed)
+	default:
+		return "ok"
+	}
+}
+
+func init() {
+	syncCmd.AddCommand(syncHistoryCmd)
+
+	syncHistoryCmd.Flags().IntP("limit", "n", 20, "Number of recent syncs to list (0 for all)")
+	syncHistoryCmd.Flags().String("peer", "", "Only show syncs with this peer (trusted name or ID), vault or bundle")
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/p2p"
+)
+
+func TestDisplaySyncHistory(t *testing.T) {
+	names := map[string]string{"QmLaptop": "laptop"}
+	runs := []p2p.SyncRun{
+		{Time: time.Now(), Kind: "peers", Source: "QmLaptop,QmOther", Files: 2, Chunks: 3, Bytes: 2048, DurationMS: 1500,
+			Peers: []p2p.PeerTransfer{{Peer: "QmLaptop", Chunks: 3, Bytes: 2048}}},
+		{Time: time.Now(), Kind: "peer", Source: "QmLaptop", Files: 1, Chunks: 1, Failed: 2},
+		{Time: time.Now(), Kind: "bundle", Source: "/tmp/b.sietch", Interrupted: true},
+	}
+
+	var out bytes.Buffer
+	if err := displaySyncHistory(&out, runs, p2p.SummarizeSyncHistory(runs), names); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	for _, want := range []string{"laptop,QmOther", "2 failed", "interrupted", "1.5s", "Totals:"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in output:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "QmLaptop") {
+		t.Errorf("expected the trusted peer to be shown by name:\n%s", text)
+	}
+}
+
+func TestFilterSyncRuns(t *testing.T) {
+	runs := []p2p.SyncRun{
+		{Session: "1", Kind: "peer", Source: "QmA"},
+		{Session: "2", Kind: "peers", Source: "QmA,QmB", Peers: []p2p.PeerTransfer{{Peer: "QmA"}, {Peer: "QmB"}}},
+		{Session: "3", Kind: "peer", Source: "QmC"},
+	}
+	matched := filterSyncRuns(runs, resolvePeerName(map[string]string{"QmB": "desk"}, "desk"))
+	if len(matched) != 1 || matched[0].Session != "2" {
+		t.Errorf("expected only the multi-peer run, got %+v", matched)
+	}
+	if matched := filterSyncRuns(runs, "QmA"); len(matched) != 2 {
+		t.Errorf("expected both runs with QmA, got %+v", matched)
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// tagCmd represents the tag command
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage tags on files stored in the vault",
+	Long: `Manage tags on files already stored in your Sietch vault.
+
+Tags are normally set with 'sietch add --tags'. This command lets you add,
+remove, or list tags on existing files without re-adding them. Changes are
+applied transactionally, so either every matching manifest is updated or none are.
+
+Use --prefix to operate on every file whose vault path starts with the given
+destination prefix.
+
+Examples:
+  sietch tag list                               # List all tags with file counts
+  sietch tag list docs/report.pdf               # List tags of a single file
+  sietch tag add docs/report.pdf work,q3        # Add tags to a file
+  sietch tag remove docs/report.pdf q3          # Remove a tag from a file
+  sietch tag add --prefix photos/2024/ holiday  # Tag everything under a prefix`,
+}
+
+// tagAddCmd adds tags to existing files
+var tagAddCmd = &cobra.Command{
+	Use:   "add <vault-path> <tag>[,<tag>...]",
+	Short: "Add tags to files in the vault",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefix, _ := cmd.Flags().GetBool("prefix")
+		return runTagUpdate(args[0], parseTagList(args[1]), prefix, addTags)
+	},
+}
+
+// tagRemoveCmd removes tags from existing files
+var tagRemoveCmd = &cobra.Command{
+	Use:   "remove <vault-path> <tag>[,<tag>...]",
+	Short: "Remove tags from files in the vault",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefix, _ := cmd.Flags().GetBool("prefix")
+		return runTagUpdate(args[0], parseTagList(args[1]), prefix, removeTags)
+	},
+}
+
+// tagListCmd lists tags in the vault
+var tagListCmd = &cobra.Command{
+	Use:   "list [vault-path]",
+	Short: "List tags in the vault",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefix, _ := cmd.Flags().GetBool("prefix")
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+
+		entries, err := manager.GetManifestEntries()
+		if err != nil {
+			return fmt.Errorf("failed to get manifest entries: %v", err)
+		}
+
+		// Without a path, summarise every tag in the vault
+		if len(args) == 0 {
+			counts := countTags(entries)
+			if len(counts) == 0 {
+				fmt.Println("No tags found in vault")
+				return nil
+			}
+
+			names := make([]string, 0, len(counts))
+			for name := range counts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			defer w.Flush()
+			fmt.Fprintln(w, "TAG\tFILES")
+			for _, name := range names {
+				fmt.Fprintf(w, "%s\t%d\n", name, counts[name])
+			}
+			return nil
+		}
+
+		matched := matchManifestEntries(entries, args[0], prefix)
+		if len(matched) == 0 {
+			return fmt.Errorf("no files found matching '%s'", args[0])
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		defer w.Flush()
+		fmt.Fprintln(w, "PATH\tTAGS")
+		for _, entry := range matched {
+			fmt.Fprintf(w, "%s\t%s\n",
+				entry.Manifest.Destination+entry.Manifest.FilePath,
+				strings.Join(entry.Manifest.Tags, ", "))
+		}
+		return nil
+	},
+}
+
+// runTagUpdate applies a tag operation to every manifest matching target inside one transaction
+func runTagUpdate(target string, tagList []string, prefix bool, op func(existing, changes []string) []string) error {
+	if len(tagList) == 0 {
+		return fmt.Errorf("no tags specified")
+	}
+
+	vaultRoot, err := fs.FindVaultRoot()
+	if err != nil {
+		return fmt.Errorf("not inside a vault: %v", err)
+	}
+
+	manager, err := config.NewManager(vaultRoot)
+	if err != nil {
+		return fmt.Errorf("failed to create vault manager: %v", err)
+	}
+
+	vaultConfig, err := manager.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	if err := config.CheckWritable(vaultConfig); err != nil {
+		return err
+	}
+
+	entries, err := manager.GetManifestEntries()
+	if err != nil {
+		return fmt.Errorf("failed to get manifest entries: %v", err)
+	}
+
+	matched := matchManifestEntries(entries, target, prefix)
+	if len(matched) == 0 {
+		return fmt.Errorf("no files found matching '%s'", target)
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "tag", "target": target, "fileCount": len(matched)})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+			fmt.Println("txn rollback; tag operation did not complete")
+		}
+	}()
+
+	updated := 0
+	for _, entry := range matched {
+		newTags := op(entry.Manifest.Tags, tagList)
+		if slices.Equal(entry.Manifest.Tags, newTags) {
+			continue
+		}
+
+		m := entry.Manifest
+		m.Tags = newTags
+		if err := replaceManifestTransactional(txn, vaultRoot, entry.Path, &m); err != nil {
+			return fmt.Errorf("failed to update manifest for %s: %v", m.Destination+m.FilePath, err)
+		}
+		fmt.Printf("✓ %s [%s]\n", m.Destination+m.FilePath, strings.Join(m.Tags, ", "))
+		updated++
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	committed = true
+	manager.RefreshIndex()
+
+	fmt.Printf("\n✓ Updated tags on %d of %d matching file(s)\n", updated, len(matched))
+	return nil
+}
+
+// matchManifestEntries returns the manifest entries addressed by target.
+// With prefix set, every file whose vault path starts with target is returned;
+// otherwise target must equal the full vault path or the bare file name.
+func matchManifestEntries(entries []*config.ManifestEntry, target string, prefix bool) []*config.ManifestEntry {
+	target = fs.VaultPath(target)
+	var matched []*config.ManifestEntry
+	for _, entry := range entries {
+		fullPath := entry.Manifest.Destination + entry.Manifest.FilePath
+		if prefix {
+			if strings.HasPrefix(fullPath, target) {
+				matched = append(matched, entry)
+			}
+			continue
+		}
+		if fullPath == target || entry.Manifest.FilePath == target {
+			matched = append(matched, entry)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Manifest.Destination+matched[i].Manifest.FilePath <
+			matched[j].Manifest.Destination+matched[j].Manifest.FilePath
+	})
+	return matched
+}
+
+// parseTagList splits a comma-separated tag argument, dropping blanks and duplicates
+func parseTagList(raw string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// addTags returns existing with any missing tags from changes appended
+func addTags(existing, changes []string) []string {
+	result := append([]string{}, existing...)
+	for _, tag := range changes {
+		if !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// removeTags returns existing without any of the tags in changes
+func removeTags(existing, changes []string) []string {
+	result := []string{}
+	for _, tag := range existing {
+		if !slices.Contains(changes, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// countTags returns the number of files carrying each tag
+func countTags(entries []*config.ManifestEntry) map[string]int {
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		for _, tag := range entry.Manifest.Tags {
+			counts[tag]++
+		}
+	}
+	return counts
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+
+	tagCmd.AddCommand(tagAddCmd)
+	tagCmd.AddCommand(tagRemoveCmd)
+	tagCmd.AddCommand(tagListCmd)
+
+	tagAddCmd.ValidArgsFunction = completeTagTarget
+	tagRemoveCmd.ValidArgsFunction = completeTagTarget
+	tagListCmd.ValidArgsFunction = completeTagTarget
+
+	tagCmd.PersistentFlags().Bool("prefix", false, "Treat the vault path as a destination prefix and apply to all files under it")
+}
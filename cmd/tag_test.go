@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestParseTagList(t *testing.T) {
+	got := parseTagList(" work, q3,,work ,personal")
+	want := []string{"work", "q3", "personal"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseTagList = %v, want %v", got, want)
+	}
+
+	if got := parseTagList(" , "); len(got) != 0 {
+		t.Fatalf("expected no tags, got %v", got)
+	}
+}
+
+func TestAddAndRemoveTags(t *testing.T) {
+	existing := []string{"a", "b"}
+
+	added := addTags(existing, []string{"b", "c"})
+	if !reflect.DeepEqual(added, []string{"a", "b", "c"}) {
+		t.Fatalf("addTags = %v", added)
+	}
+	if !reflect.DeepEqual(existing, []string{"a", "b"}) {
+		t.Fatalf("addTags mutated input: %v", existing)
+	}
+
+	removed := removeTags(added, []string{"a", "missing"})
+	if !reflect.DeepEqual(removed, []string{"b", "c"}) {
+		t.Fatalf("removeTags = %v", removed)
+	}
+
+	if got := removeTags([]string{"x"}, []string{"x"}); got == nil || len(got) != 0 {
+		t.Fatalf("removeTags should return an empty, non-nil slice, got %#v", got)
+	}
+}
+
+func TestMatchManifestEntries(t *testing.T) {
+	entries := []*config.ManifestEntry{
+		{Path: "1", Manifest: config.FileManifest{FilePath: "b.jpg", Destination: "photos/2024/"}},
+		{Path: "2", Manifest: config.FileManifest{FilePath: "a.jpg", Destination: "photos/2024/"}},
+		{Path: "3", Manifest: config.FileManifest{FilePath: "notes.txt", Destination: "docs/"}},
+	}
+
+	exact := matchManifestEntries(entries, "docs/notes.txt", false)
+	if len(exact) != 1 || exact[0].Path != "3" {
+		t.Fatalf("exact match failed: %+v", exact)
+	}
+
+	byName := matchManifestEntries(entries, "notes.txt", false)
+	if len(byName) != 1 || byName[0].Path != "3" {
+		t.Fatalf("file name match failed: %+v", byName)
+	}
+
+	prefixed := matchManifestEntries(entries, "photos/", true)
+	if len(prefixed) != 2 || prefixed[0].Manifest.FilePath != "a.jpg" || prefixed[1].Manifest.FilePath != "b.jpg" {
+		t.Fatalf("prefix match failed or unsorted: %+v", prefixed)
+	}
+
+	if got := matchManifestEntries(entries, "photos/", false); len(got) != 0 {
+		t.Fatalf("non-prefix match should not match a directory, got %d", len(got))
+	}
+}
+
+func TestCountTags(t *testing.T) {
+	entries := []*config.ManifestEntry{
+		{Manifest: config.FileManifest{Tags: []string{"work", "q3"}}},
+		{Manifest: config.FileManifest{Tags: []string{"work"}}},
+		{Manifest: config.FileManifest{}},
+	}
+	counts := countTags(entries)
+	if counts["work"] != 2 || counts["q3"] != 1 || len(counts) != 2 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
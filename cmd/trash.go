@@ -0,0 +1,482 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// trashCmd groups the commands managing deleted files
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List or empty the files deleted from the vault",
+	Long: `List or empty the trash, where 'sietch delete' keeps deleted files.
+
+A deleted file stays in .sietch/trash for trash.retention (7 days by
+default). Until then its chunks are kept by garbage collection and it can be
+restored with 'sietch undelete'. Emptying the trash deletes its files for good,
+with the chunks no other file uses.
+
+Examples:
+  sietch trash list                    # Show deleted files and when they expire
+  sietch trash empty --expired         # Drop the files whose retention is over
+  sietch trash empty docs/report.pdf   # Drop one file now
+  sietch trash empty --force           # Drop everything without confirmation`,
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the files in the trash",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := getOutputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		entries, err := manager.Trash()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		items := make([]trashItem, 0, len(entries))
+		for _, e := range entries {
+			items = append(items, trashItem{
+				ID: e.ID, Path: e.Path(), Size: e.Manifest.Size, Chunks: len(e.Manifest.Chunks),
+				DeletedAt: e.DeletedAt, ExpiresAt: e.ExpiresAt, Expired: e.Expired(now),
+			})
+		}
+		if format != outputTable {
+			return writeStructured(os.Stdout, format, items)
+		}
+		if len(items) == 0 {
+			fmt.Println("Trash is empty")
+			return nil
+		}
+		return displayTrash(os.Stdout, items)
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty [file_path]...",
+	Short: "Delete files in the trash for good",
+	Long: `Delete files in the trash for good, along with the chunks no other file
+uses. Without arguments every file in the trash is deleted; with paths, only
+the files deleted from them; with --expired, only those past their retention.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		vaultConfig, err := manager.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := config.CheckWritable(vaultConfig); err != nil {
+			return err
+		}
+
+		expired, _ := cmd.Flags().GetBool("expired")
+		paths := make(map[string]bool)
+		for _, arg := range args {
+			paths[fs.VaultPath(arg)] = true
+		}
+		selected := func(e *config.TrashEntry, now time.Time) bool {
+			if expired && !e.Expired(now) {
+				return false
+			}
+			return len(paths) == 0 || paths[e.Path()] || paths[e.ID]
+		}
+
+		entries, remaining, err := planEmptyTrash(manager, selected)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("Nothing to empty from the trash")
+			return nil
+		}
+		orphaned := orphanedChunks(trashChunks(entries), remaining)
+		var reclaimed int64
+		for _, ch := range orphaned {
+			reclaimed += storedSize(ch)
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			for _, e := range entries {
+				fmt.Printf("[dry-run] would delete '%s' (deleted %s) for good\n", e.Path(), e.DeletedAt.Local().Format("2006-01-02 15:04"))
+			}
+			fmt.Printf("[dry-run] %d chunk(s) no longer referenced, %s would be reclaimed\n", len(orphaned), util.HumanReadableSize(reclaimed))
+			return nil
+		}
+
+		if force, _ := cmd.Flags().GetBool("force"); !force {
+			fmt.Printf("Delete %d file(s) in the trash for good? They cannot be restored afterwards. (y/N): ", len(entries))
+			response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			response = strings.TrimSpace(strings.ToLower(response))
+			if response != "y" && response != "yes" {
+				fmt.Println("Operation canceled")
+				return nil
+			}
+		}
+		if err := runPreGcHooks(vaultRoot, vaultConfig, gcPlan{Mode: "trash", Chunks: len(orphaned), Bytes: reclaimed}); err != nil {
+			return err
+		}
+
+		if err := emptyTrash(vaultRoot, entries, remaining); err != nil {
+			return err
+		}
+		recordAudit(vaultRoot, audit.OpGC, map[string]string{
+			"mode":            "trash",
+			"files":           strconv.Itoa(len(entries)),
+			"removed_chunks":  strconv.Itoa(len(orphaned)),
+			"reclaimed_bytes": strconv.FormatInt(reclaimed, 10),
+		})
+		fmt.Printf("✓ Deleted %d file(s) from the trash\n", len(entries))
+		fmt.Printf("✓ Removed %d chunks, reclaimed %s\n", len(orphaned), util.HumanReadableSize(reclaimed))
+		return nil
+	},
+}
+
+// undeleteCmd restores a file from the trash
+var undeleteCmd = &cobra.Command{
+	Use:   "undelete <file_path>",
+	Short: "Restore a deleted file from the trash",
+	Long: `Restore a file that 'sietch delete' moved to the trash, at the path it was
+deleted from. If the path was deleted several times the most recent deletion
+is restored; pick another with --id, as listed by 'sietch trash list'.
+
+The restored file counts as added again, so the next sync sends it to peers
+that removed it on the deletion's tombstone.
+
+Examples:
+  sietch undelete docs/report.pdf
+  sietch undelete docs/report.pdf --id 3fa2c901`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath := fs.VaultPath(args[0])
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+		vaultConfig, err := manager.GetConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := config.CheckWritable(vaultConfig); err != nil {
+			return err
+		}
+
+		entries, err := manager.Trash()
+		if err != nil {
+			return err
+		}
+		id, _ := cmd.Flags().GetString("id")
+		matches := matchTrashEntries(entries, filePath, id)
+		if len(matches) == 0 {
+			return fmt.Errorf("no file deleted from %s in the trash; see 'sietch trash list'", filePath)
+		}
+		entry := matches[0]
+		if len(matches) > 1 {
+			fmt.Printf("%s was deleted %d times; restoring the deletion of %s (see --id)\n",
+				filePath, len(matches), entry.DeletedAt.Local().Format("2006-01-02 15:04"))
+		}
+
+		manifest, err := manager.GetManifest()
+		if err != nil {
+			return fmt.Errorf("failed to get vault manifest: %v", err)
+		}
+		for _, file := range manifest.Files {
+			if file.Destination+file.FilePath == entry.Path() {
+				return fmt.Errorf("'%s' exists in the vault; delete it before restoring the deleted file", entry.Path())
+			}
+		}
+		missing := 0
+		for _, ch := range entry.Manifest.Chunks {
+			if !fs.ChunkExists(vaultRoot, chunk.StorageName(ch)) {
+				missing++
+			}
+		}
+		if missing > 0 {
+			return fmt.Errorf("%d chunk(s) of '%s' are no longer stored, so it cannot be restored", missing, entry.Path())
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("[dry-run] would restore '%s' (deleted %s)\n", entry.Path(), entry.DeletedAt.Local().Format("2006-01-02 15:04"))
+			return nil
+		}
+
+		if err := restoreTrashEntry(vaultRoot, &entry); err != nil {
+			return err
+		}
+		manager.RefreshIndex()
+		recordAudit(vaultRoot, audit.OpUndelete, map[string]string{"path": entry.Path(), "trash": entry.ID})
+		fmt.Printf("✓ Restored '%s' from the trash\n", entry.Path())
+		return nil
+	},
+}
+
+// trashItem is the listed form of a trash entry
+type trashItem struct {
+	ID        string    `json:"id" yaml:"id"`
+	Path      string    `json:"path" yaml:"path"`
+	Size      int64     `json:"size" yaml:"size"`
+	Chunks    int       `json:"chunks" yaml:"chunks"`
+	DeletedAt time.Time `json:"deleted_at" yaml:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at" yaml:"expires_at"`
+	Expired   bool      `json:"expired" yaml:"expired"`
+}
+
+// displayTrash prints the files in the trash as a table
+func displayTrash(w io.Writer, items []trashItem) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPATH\tSIZE\tDELETED\tEXPIRES")
+	for _, item := range items {
+		expires := item.ExpiresAt.Local().Format("2006-01-02 15:04")
+		if item.Expired {
+			expires = "expired"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.ID, item.Path, util.HumanReadableSize(item.Size),
+			item.DeletedAt.Local().Format("2006-01-02 15:04"), expires)
+	}
+	return tw.Flush()
+}
+
+// matchTrashEntries returns the entries of files deleted from filePath, or
+// the entry with id if one is given, most recently deleted first. As with
+// delete, a bare file name matches wherever it was stored.
+func matchTrashEntries(entries []config.TrashEntry, filePath, id string) []config.TrashEntry {
+	var matches []config.TrashEntry
+	for _, e := range entries {
+		if e.Path() != filePath && e.Manifest.FilePath != filePath {
+			continue
+		}
+		if id != "" && e.ID != id {
+			continue
+		}
+		matches = append(matches, e)
+	}
+	return matches
+}
+
+// expiredTrash selects the trash entries past their retention
+func expiredTrash(e *config.TrashEntry, now time.Time) bool {
+	return e.Expired(now)
+}
+
+// planEmptyTrash returns the trash entries selected for deletion and the
+// files that still hold chunks once they are gone: every stored file and the
+// other trash entries that have not expired
+func planEmptyTrash(manager *config.Manager, selected func(e *config.TrashEntry, now time.Time) bool) ([]config.TrashEntry, *config.Manifest, error) {
+	entries, err := manager.Trash()
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest, err := manager.GetManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get vault manifest: %v", err)
+	}
+
+	now := time.Now()
+	var purged []config.TrashEntry
+	remaining := &config.Manifest{Files: manifest.Files}
+	for i := range entries {
+		switch {
+		case selected(&entries[i], now):
+			purged = append(purged, entries[i])
+		case !entries[i].Expired(now):
+			remaining.Files = append(remaining.Files, entries[i].Manifest)
+		}
+	}
+	return purged, remaining, nil
+}
+
+// trashChunks returns the chunks of every file in entries
+func trashChunks(entries []config.TrashEntry) []config.ChunkRef {
+	var chunks []config.ChunkRef
+	for _, e := range entries {
+		chunks = append(chunks, e.Manifest.Chunks...)
+	}
+	return chunks
+}
+
+// emptyTrash deletes entries from the trash in one transaction, with the
+// chunks none of the remaining files reference
+func emptyTrash(vaultRoot string, entries []config.TrashEntry, remaining *config.Manifest) error {
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "trash-empty", "files": len(entries)})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+		}
+	}()
+
+	for _, e := range entries {
+		if err := txn.StageDelete(config.TrashRelPath(e.ID)); err != nil {
+			return fmt.Errorf("stage trash entry delete: %v", err)
+		}
+	}
+	if err := stageOrphanedChunkDeletes(txn, vaultRoot, trashChunks(entries), remaining); err != nil {
+		return fmt.Errorf("stage chunk delete: %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit trash transaction: %v", err)
+	}
+	committed = true
+	return nil
+}
+
+// emptyExpiredTrash deletes the files whose retention is over from the
+// trash and returns how many there were
+func emptyExpiredTrash(vaultRoot string, manager *config.Manager) (int, error) {
+	entries, remaining, err := planEmptyTrash(manager, expiredTrash)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	if err := emptyTrash(vaultRoot, entries, remaining); err != nil {
+		return 0, err
+	}
+	recordAudit(vaultRoot, audit.OpGC, map[string]string{
+		"mode":  "trash-expired",
+		"files": strconv.Itoa(len(entries)),
+	})
+	return len(entries), nil
+}
+
+// restoreTrashEntry puts the file of entry back in the vault in one
+// transaction, removing the entry and the tombstone of the deletion
+func restoreTrashEntry(vaultRoot string, entry *config.TrashEntry) error {
+	restored := entry.Manifest
+	// Added again now, later than the deletion its tombstone may have taken to peers
+	restored.AddedAt = time.Now().UTC()
+
+	name, err := config.ManifestFileName(vaultRoot, restored.Destination, restored.FilePath)
+	if err != nil {
+		return err
+	}
+	tombstone, err := config.TombstoneRelPath(vaultRoot, restored.Destination, restored.FilePath)
+	if err != nil {
+		return err
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "undelete", "file": entry.Path()})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+			fmt.Println("txn rollback; undelete operation did not complete")
+		}
+	}()
+
+	w, err := txn.StageCreate(filepath.ToSlash(filepath.Join(".sietch", "manifests", name)))
+	if err != nil {
+		return fmt.Errorf("stage manifest: %v", err)
+	}
+	if err := writeManifestYAML(w, vaultRoot, &restored); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("stage manifest: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("stage manifest: %v", err)
+	}
+	if err := txn.StageDelete(config.TrashRelPath(entry.ID)); err != nil {
+		return fmt.Errorf("stage trash entry delete: %v", err)
+	}
+	if err := txn.StageDelete(tombstone); err != nil {
+		return fmt.Errorf("stage tombstone delete: %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit undelete transaction: %v", err)
+	}
+	committed = true
+	return nil
+}
+
+// trashManifestEntries wraps the manifests of the files in the trash as
+// manifest entries, so that commands rewriting every stored chunk convert
+// theirs too and the files can still be restored afterwards
+func trashManifestEntries(trash []config.TrashEntry) []*config.ManifestEntry {
+	entries := make([]*config.ManifestEntry, len(trash))
+	for i := range trash {
+		entries[i] = &config.ManifestEntry{Path: config.TrashRelPath(trash[i].ID), Manifest: trash[i].Manifest}
+	}
+	return entries
+}
+
+// stageRewrittenTrash stages the trash entries whose chunks were rewritten
+// as moved records
+func stageRewrittenTrash(txn *atomic.Transaction, vaultRoot string, trash []config.TrashEntry, moved map[string]config.ChunkRef) error {
+	for i := range trash {
+		if !applyRecompressed(&trash[i].Manifest, moved) {
+			continue
+		}
+		data, err := config.EncodeTrashEntry(vaultRoot, &trash[i])
+		if err != nil {
+			return err
+		}
+		w, err := txn.StageReplace(config.TrashRelPath(trash[i].ID))
+		if err != nil {
+			return fmt.Errorf("failed to update trash entry for %s: %v", trash[i].Path(), err)
+		}
+		if _, err := w.Write(data); err != nil {
+			_ = w.Close()
+			return fmt.Errorf("failed to update trash entry for %s: %v", trash[i].Path(), err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to update trash entry for %s: %v", trash[i].Path(), err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(trashCmd)
+	rootCmd.AddCommand(undeleteCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashEmptyCmd)
+
+	trashEmptyCmd.Flags().Bool("expired", false, "Only delete the files past their retention")
+	trashEmptyCmd.Flags().BoolP("force", "f", false, "Delete without confirmation")
+	undeleteCmd.Flags().String("id", "", "Restore the trash entry with this ID, when the path was deleted several times")
+}
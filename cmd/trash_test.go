@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestMatchTrashEntries(t *testing.T) {
+	entry := func(id, dest, name string) config.TrashEntry {
+		return config.TrashEntry{ID: id, Manifest: config.FileManifest{Destination: dest, FilePath: name}}
+	}
+	entries := []config.TrashEntry{
+		entry("aaaa0001", "docs/", "a.txt"),
+		entry("aaaa0002", "docs/", "a.txt"),
+		entry("bbbb0001", "notes/", "b.txt"),
+	}
+	tests := []struct {
+		path, id string
+		want     []string
+	}{
+		{"docs/a.txt", "", []string{"aaaa0001", "aaaa0002"}},
+		{"docs/a.txt", "aaaa0002", []string{"aaaa0002"}},
+		{"b.txt", "", []string{"bbbb0001"}},
+		{"docs/b.txt", "", nil},
+		{"docs/a.txt", "bbbb0001", nil},
+	}
+	for _, tt := range tests {
+		got := matchTrashEntries(entries, tt.path, tt.id)
+		if len(got) != len(tt.want) {
+			t.Errorf("matchTrashEntries(%q, %q) = %d entries, want %v", tt.path, tt.id, len(got), tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].ID != tt.want[i] {
+				t.Errorf("matchTrashEntries(%q, %q)[%d] = %s, want %s", tt.path, tt.id, i, got[i].ID, tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,533 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cobra"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/hooks"
+	"github.com/substantialcattle5/sietch/internal/ignore"
+	"github.com/substantialcattle5/sietch/internal/lock"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/internal/ui"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// watchTarget maps a watched source directory to its destination in the vault
+type watchTarget struct {
+	Source      string
+	Destination string
+}
+
+// watchSession holds the state shared by every batch added while watching
+type watchSession struct {
+	vaultRoot      string
+	vaultConfig    *config.VaultConfig
+	manager        *config.Manager
+	chunkSize      int64
+	passphrase     string
+	progressMgr    *progress.Manager
+	targets        []watchTarget
+	ignorePatterns []string
+	ignoreFiles    map[string]*ignore.Matcher // .sietchignore rules per target source; nil with --no-ignore
+	includeHidden  bool
+	tags           []string
+	dryRun         bool
+}
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch <source_dir> <destination_path> [source_dir2] [destination_path2]...",
+	Short: "Watch directories and automatically add new or changed files",
+	Long: `Watch one or more source directories and automatically add new or changed
+files to the vault.
+
+Each source directory is mapped to a destination in the vault, using the same
+argument patterns as 'sietch add'. Subdirectories are watched recursively and
+the directory structure is preserved under the destination. Events are
+debounced so that a burst of writes results in a single add, and each batch is
+committed in one transaction. Paths matched by .sietchignore files (gitignore
+syntax) in the watched trees are skipped unless --no-ignore is given.
+
+Deletions and renames in the source directories are not propagated to the vault.
+
+Examples:
+  sietch watch ~/Documents docs/
+  sietch watch ~/photos photos/ ~/notes notes/
+  sietch watch --ignore '*.tmp' --ignore node_modules ~/projects projects/
+  sietch watch --dry-run ~/Documents docs/     # Only report what would be added
+  sietch watch --debounce 10s ~/Downloads inbox/`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pairs, err := parseFileArguments(args)
+		if err != nil {
+			return err
+		}
+
+		targets, err := resolveWatchTargets(pairs)
+		if err != nil {
+			return err
+		}
+
+		debounce, _ := cmd.Flags().GetDuration("debounce")
+		if debounce <= 0 {
+			return fmt.Errorf("--debounce must be positive")
+		}
+		ignorePatterns, _ := cmd.Flags().GetStringSlice("ignore")
+		includeHidden, _ := cmd.Flags().GetBool("include-hidden")
+		noIgnore, _ := cmd.Flags().GetBool("no-ignore")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		initialScan, _ := cmd.Flags().GetBool("initial-scan")
+		tagsFlag, _ := cmd.Flags().GetString("tags")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		tags := []string{}
+		if tagsFlag != "" {
+			tags = strings.Split(tagsFlag, ",")
+		}
+
+		vaultRoot, err := fs.FindVaultRoot()
+		if err != nil {
+			return fmt.Errorf("not inside a vault: %v", err)
+		}
+
+		// Check if vault is initialized
+		if !fs.IsVaultInitialized(vaultRoot) {
+			return fmt.Errorf("vault not initialized, run 'sietch init' first")
+		}
+
+		vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to load vault configuration: %v", err)
+		}
+		if err := config.CheckWritable(vaultConfig); err != nil {
+			return err
+		}
+
+		chunkSize, err := util.ParseChunkSize(vaultConfig.Chunking.ChunkSize)
+		if err != nil {
+			fmt.Printf("Warning: Invalid chunk size in configuration (%s). Using default (4MB).\n",
+				vaultConfig.Chunking.ChunkSize)
+			chunkSize = int64(constants.DefaultChunkSize)
+		}
+
+		manager, err := config.NewManager(vaultRoot)
+		if err != nil {
+			return fmt.Errorf("failed to create vault manager: %v", err)
+		}
+
+		// The passphrase is requested once up front so batches can run unattended
+		passphrase := ""
+		if !dryRun {
+			passphrase, err = ui.GetPassphraseForVault(cmd, vaultConfig)
+			if err != nil {
+				return err
+			}
+		}
+
+		session := &watchSession{
+			vaultRoot:      vaultRoot,
+			vaultConfig:    vaultConfig,
+			manager:        manager,
+			chunkSize:      chunkSize,
+			passphrase:     passphrase,
+			progressMgr:    progress.NewManager(progress.Options{Quiet: quiet, Verbose: verbose}),
+			targets:        targets,
+			ignorePatterns: ignorePatterns,
+			includeHidden:  includeHidden,
+			tags:           tags,
+			dryRun:         dryRun,
+		}
+		if !noIgnore {
+			session.ignoreFiles = make(map[string]*ignore.Matcher, len(targets))
+			for _, target := range targets {
+				session.ignoreFiles[target.Source] = ignore.New()
+			}
+		}
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("failed to create file watcher: %v", err)
+		}
+		defer watcher.Close()
+
+		var initial []string
+		for _, target := range targets {
+			files, err := session.watchTree(watcher, target.Source)
+			if err != nil {
+				return err
+			}
+			if initialScan {
+				initial = append(initial, files...)
+			}
+			fmt.Printf("👀 Watching %s → %s\n", target.Source, target.Destination)
+		}
+		if dryRun {
+			fmt.Println("Dry run: no changes will be written to the vault")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(signalChan)
+
+		if len(initial) > 0 {
+			session.processBatch(ctx, initial)
+		}
+
+		pending := make(map[string]struct{})
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-signalChan:
+				fmt.Println("\nReceived interrupt signal, stopping watch...")
+				if len(pending) > 0 {
+					session.processBatch(ctx, sortedPending(pending))
+				}
+				return nil
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return nil
+				}
+				if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+					continue
+				}
+
+				info, err := os.Stat(event.Name)
+				if err != nil {
+					continue
+				}
+
+				// New directories are watched too and their current contents queued
+				if info.IsDir() {
+					if session.isIgnored(event.Name, true) {
+						continue
+					}
+					files, err := session.watchTree(watcher, event.Name)
+					if err != nil {
+						fmt.Printf("Warning: %v\n", err)
+					}
+					for _, f := range files {
+						pending[f] = struct{}{}
+					}
+				} else if info.Mode().IsRegular() && !session.isIgnored(event.Name, false) {
+					pending[event.Name] = struct{}{}
+				}
+
+				if len(pending) > 0 {
+					timer.Reset(debounce)
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return nil
+				}
+				fmt.Printf("Warning: watch error: %v\n", err)
+
+			case <-timer.C:
+				batch := sortedPending(pending)
+				pending = make(map[string]struct{})
+				session.processBatch(ctx, batch)
+			}
+		}
+	},
+}
+
+// resolveWatchTargets validates that every source is a directory and makes its path absolute
+func resolveWatchTargets(pairs []FilePair) ([]watchTarget, error) {
+	targets := make([]watchTarget, 0, len(pairs))
+	for _, pair := range pairs {
+		abs, err := filepath.Abs(pair.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve '%s': %v", pair.Source, err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot watch '%s': %v", pair.Source, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("'%s' is not a directory", pair.Source)
+		}
+		targets = append(targets, watchTarget{Source: abs, Destination: pair.Destination})
+	}
+	return targets, nil
+}
+
+// watchTree adds watches for root and every non-ignored subdirectory, returning the regular
+// files found. Any .sietchignore files encountered are loaded for later events.
+func (s *watchSession) watchTree(watcher *fsnotify.Watcher, root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if s.isIgnored(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if err := s.loadIgnoreFile(path); err != nil {
+				return err
+			}
+			if err := watcher.Add(path); err != nil {
+				return fmt.Errorf("failed to watch '%s': %v", path, err)
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory '%s': %v", root, err)
+	}
+	return files, nil
+}
+
+// loadIgnoreFile adds the .sietchignore in dir (if any) to the rules of its target
+func (s *watchSession) loadIgnoreFile(dir string) error {
+	if s.ignoreFiles == nil {
+		return nil
+	}
+	target, rel, ok := s.targetFor(dir)
+	if !ok {
+		if _, isRoot := s.ignoreFiles[dir]; !isRoot {
+			return nil
+		}
+		target, rel = watchTarget{Source: dir}, ""
+	}
+	return s.ignoreFiles[target.Source].AddFile(filepath.Join(dir, ignore.FileName), rel)
+}
+
+// isIgnored reports whether path should not be added to the vault. Target roots are never ignored.
+func (s *watchSession) isIgnored(path string, isDir bool) bool {
+	// Never feed the vault back into itself
+	if rel, err := filepath.Rel(s.vaultRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+		top := strings.Split(filepath.ToSlash(rel), "/")[0]
+		if top == ".sietch" || top == ".txn" {
+			return true
+		}
+	}
+
+	target, rel, ok := s.targetFor(path)
+	if !ok {
+		for _, t := range s.targets {
+			if t.Source == path {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, part := range strings.Split(rel, "/") {
+		if fs.ShouldSkipHidden(part, s.includeHidden) {
+			return true
+		}
+	}
+	if s.ignoreFiles != nil && s.ignoreFiles[target.Source].Match(rel, isDir) {
+		return true
+	}
+	return matchesWatchIgnore(rel, s.ignorePatterns)
+}
+
+// targetFor returns the watch target containing path and path relative to it (slash separated)
+func (s *watchSession) targetFor(path string) (watchTarget, string, bool) {
+	for _, target := range s.targets {
+		rel, err := filepath.Rel(target.Source, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return target, filepath.ToSlash(rel), true
+	}
+	return watchTarget{}, "", false
+}
+
+// matchesWatchIgnore matches patterns against the file name, every path component and the
+// full relative path, so 'node_modules' excludes a whole subtree and '*.tmp' any temp file
+func matchesWatchIgnore(rel string, patterns []string) bool {
+	parts := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		for _, part := range parts {
+			if ok, _ := filepath.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// processBatch adds every changed file in paths to the vault in a single transaction
+func (s *watchSession) processBatch(ctx context.Context, paths []string) {
+	// Hold the vault lock only while a batch is stored, so other commands can
+	// run between batches
+	if !s.dryRun {
+		l, err := lock.Acquire(s.vaultRoot, lock.Options{
+			Command: "sietch watch",
+			Wait:    -1,
+			OnWait: func(holder lock.Owner) {
+				fmt.Printf("⏳ Waiting for %s to finish with the vault...\n", holder)
+			},
+		})
+		if err != nil {
+			fmt.Printf("✗ Failed to lock vault: %v\n", err)
+			return
+		}
+		defer l.Release()
+	}
+
+	manifest, err := s.manager.GetManifest()
+	if err != nil {
+		fmt.Printf("✗ Failed to read vault manifests: %v\n", err)
+		return
+	}
+	existing := make(map[string]config.FileManifest, len(manifest.Files))
+	for _, f := range manifest.Files {
+		existing[f.Destination+f.FilePath] = f
+	}
+
+	type change struct {
+		source      string
+		destination string
+		info        os.FileInfo
+	}
+	var changes []change
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		target, rel, ok := s.targetFor(path)
+		if !ok {
+			continue
+		}
+		destination := filepath.ToSlash(filepath.Join(target.Destination, rel))
+		if prev, ok := existing[destination]; ok && watchFileUnchanged(prev, info) {
+			continue
+		}
+		changes = append(changes, change{source: path, destination: destination, info: info})
+	}
+
+	if len(changes) == 0 {
+		return
+	}
+
+	if s.dryRun {
+		for _, c := range changes {
+			fmt.Printf("[dry-run] would add %s → %s (%s)\n", c.source, c.destination, util.HumanReadableSize(c.info.Size()))
+		}
+		return
+	}
+
+	txn, err := atomic.Begin(s.vaultRoot, map[string]any{"command": "watch", "fileCount": len(changes)})
+	if err != nil {
+		fmt.Printf("✗ begin transaction: %v\n", err)
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txn.Rollback()
+			fmt.Println("txn rollback; watch batch did not complete")
+		}
+	}()
+
+	var added []string
+	for _, c := range changes {
+		chunkRefs, err := chunk.ChunkFileTransactional(ctx, c.source, s.chunkSize, s.vaultRoot, s.passphrase, 0, s.progressMgr, txn)
+		if err != nil {
+			fmt.Printf("✗ %s: chunking failed - %v\n", c.source, err)
+			continue
+		}
+
+		fileManifest := newFileManifest(c.destination, c.info, chunkRefs, s.tags)
+		if err := upsertManifestTransactional(txn, s.vaultRoot, fileManifest.FilePath, fileManifest); err != nil {
+			fmt.Printf("✗ %s: manifest storage failed - %v\n", c.source, err)
+			continue
+		}
+		fmt.Printf("✓ %s → %s (%d chunks)\n", c.source, c.destination, len(chunkRefs))
+		added = append(added, c.destination)
+	}
+	s.progressMgr.Cleanup()
+
+	if len(added) == 0 {
+		return
+	}
+	if err := checkQuota(s.vaultRoot, s.vaultConfig, txn, false); err != nil {
+		fmt.Printf("✗ %v\n", err)
+		return
+	}
+	if err := txn.Commit(); err != nil {
+		fmt.Printf("✗ commit transaction: %v\n", err)
+		return
+	}
+	committed = true
+	s.manager.RefreshIndex()
+	fmt.Printf("txn successful; %d file(s) added\n", len(added))
+	recordAudit(s.vaultRoot, audit.OpAdd, map[string]string{
+		"files":  strconv.Itoa(len(added)),
+		"source": "watch",
+	})
+	hooks.Notify(s.vaultRoot, s.vaultConfig, hooks.PostAdd, addedFiles{Files: added, Source: "watch"})
+}
+
+// watchFileUnchanged reports whether the stored manifest already matches the file on disk
+func watchFileUnchanged(m config.FileManifest, info os.FileInfo) bool {
+	return m.Size == info.Size() && m.ModTime == info.ModTime().Format(time.RFC3339)
+}
+
+// sortedPending returns the pending paths in a stable order
+func sortedPending(pending map[string]struct{}) []string {
+	paths := make([]string, 0, len(pending))
+	for path := range pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().Duration("debounce", 2*time.Second, "Wait this long after the last change before adding a batch")
+	watchCmd.Flags().StringSlice("ignore", []string{}, "Glob patterns to ignore (matched against names and relative paths)")
+	watchCmd.Flags().BoolP("include-hidden", "H", false, "Include hidden files and directories")
+	watchCmd.Flags().Bool("no-ignore", false, "Do not honor .sietchignore files in watched directories")
+	watchCmd.Flags().Bool("initial-scan", false, "Add existing new or changed files when the watch starts")
+	watchCmd.Flags().StringP("tags", "t", "", "Comma-separated tags to associate with added files")
+	watchCmd.Flags().Bool("passphrase-stdin", false, "Read passphrase from stdin (for automation)")
+	watchCmd.Flags().String("passphrase-file", "", "Read passphrase from file (file should have 0600 permissions)")
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/ignore"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func TestMatchesWatchIgnore(t *testing.T) {
+	tests := []struct {
+		rel      string
+		patterns []string
+		expected bool
+	}{
+		{rel: "notes.txt", patterns: nil, expected: false},
+		{rel: "build/out.tmp", patterns: []string{"*.tmp"}, expected: true},
+		{rel: "src/node_modules/pkg/index.js", patterns: []string{"node_modules"}, expected: true},
+		{rel: "logs/app.log", patterns: []string{"logs/*.log"}, expected: true},
+		{rel: "docs/app.log", patterns: []string{"logs/*.log"}, expected: false},
+		{rel: "a.txt", patterns: []string{""}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := matchesWatchIgnore(tt.rel, tt.patterns); got != tt.expected {
+				t.Errorf("matchesWatchIgnore(%q, %v) = %v, want %v", tt.rel, tt.patterns, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveWatchTargets(t *testing.T) {
+	dir := testutil.TempDir(t, "watch-targets")
+	file := testutil.CreateTestFile(t, dir, "file.txt", "content")
+
+	targets, err := resolveWatchTargets([]FilePair{{Source: dir, Destination: "docs/"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(targets) != 1 || !filepath.IsAbs(targets[0].Source) || targets[0].Destination != "docs/" {
+		t.Fatalf("unexpected targets: %+v", targets)
+	}
+
+	if _, err := resolveWatchTargets([]FilePair{{Source: file, Destination: "docs/"}}); err == nil {
+		t.Error("expected error when watching a regular file")
+	}
+	if _, err := resolveWatchTargets([]FilePair{{Source: filepath.Join(dir, "missing"), Destination: "docs/"}}); err == nil {
+		t.Error("expected error when watching a missing directory")
+	}
+}
+
+func TestWatchSessionIgnoreAndTree(t *testing.T) {
+	vaultRoot := testutil.TempDir(t, "watch-vault")
+	source := filepath.Join(vaultRoot, "src")
+	testutil.CreateTestFile(t, source, "keep.txt", "a")
+	testutil.CreateTestFile(t, source, "skip.tmp", "b")
+	testutil.CreateTestFile(t, source, ".hidden", "c")
+	testutil.CreateTestFile(t, filepath.Join(source, "sub"), "nested.txt", "d")
+	testutil.CreateTestFile(t, filepath.Join(source, "cache"), "blob.bin", "e")
+	testutil.CreateTestFile(t, source, ignore.FileName, "*.bak\n")
+	testutil.CreateTestFile(t, source, "old.bak", "f")
+	testutil.CreateTestFile(t, filepath.Join(source, "sub"), ignore.FileName, "generated/\n")
+	testutil.CreateTestFile(t, filepath.Join(source, "sub", "generated"), "out.txt", "g")
+
+	session := &watchSession{
+		vaultRoot:      vaultRoot,
+		targets:        []watchTarget{{Source: source, Destination: "docs/"}},
+		ignorePatterns: []string{"*.tmp", "cache"},
+		ignoreFiles:    map[string]*ignore.Matcher{source: ignore.New()},
+	}
+
+	if !session.isIgnored(filepath.Join(vaultRoot, ".sietch", "chunks", "abc"), false) {
+		t.Error("vault internals must always be ignored")
+	}
+	if !session.isIgnored(filepath.Join(vaultRoot, "elsewhere.txt"), false) {
+		t.Error("paths outside every target should be ignored")
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	files, err := session.watchTree(watcher, source)
+	if err != nil {
+		t.Fatalf("watchTree: %v", err)
+	}
+	expected := map[string]bool{
+		filepath.Join(source, "keep.txt"):          true,
+		filepath.Join(source, "sub", "nested.txt"): true,
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("watchTree returned %v", files)
+	}
+	for _, f := range files {
+		if !expected[f] {
+			t.Errorf("unexpected file %s", f)
+		}
+	}
+
+	_, rel, ok := session.targetFor(filepath.Join(source, "sub", "nested.txt"))
+	if !ok || rel != "sub/nested.txt" {
+		t.Errorf("targetFor = %q, %v", rel, ok)
+	}
+
+	// Later events are checked against the loaded ignore files
+	if !session.isIgnored(filepath.Join(source, "new.bak"), false) {
+		t.Error("expected .sietchignore rules to apply to new files")
+	}
+	if !session.isIgnored(filepath.Join(source, "sub", "generated", "late.txt"), false) {
+		t.Error("expected nested .sietchignore rules to apply to new files")
+	}
+}
+
+func TestWatchSessionNoIgnore(t *testing.T) {
+	source := testutil.TempDir(t, "watch-noignore")
+	testutil.CreateTestFile(t, source, ignore.FileName, "*.bak\n")
+	testutil.CreateTestFile(t, source, "old.bak", "a")
+
+	session := &watchSession{
+		vaultRoot: testutil.TempDir(t, "watch-noignore-vault"),
+		targets:   []watchTarget{{Source: source, Destination: "docs/"}},
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatalf("create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	files, err := session.watchTree(watcher, source)
+	if err != nil {
+		t.Fatalf("watchTree: %v", err)
+	}
+	if len(files) != 1 || filepath.Base(files[0]) != "old.bak" {
+		t.Errorf("expected ignore file to be disregarded, got %v", files)
+	}
+}
+
+func TestWatchFileUnchanged(t *testing.T) {
+	dir := testutil.TempDir(t, "watch-unchanged")
+	path := testutil.CreateTestFile(t, dir, "file.txt", "content")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	m := config.FileManifest{Size: info.Size(), ModTime: info.ModTime().Format(time.RFC3339)}
+	if !watchFileUnchanged(m, info) {
+		t.Error("expected identical size and mtime to be unchanged")
+	}
+	m.Size++
+	if watchFileUnchanged(m, info) {
+		t.Error("expected a size difference to count as a change")
+	}
+}
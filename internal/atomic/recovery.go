@@ -5,54 +5,60 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
+
+	"github.com/substantialcattle5/sietch/internal/lock"
 )
 
 type RecoveryResult struct {
 	ResumedCommits int
 	RolledBack     int
 	Purged         int
-	Errors         []error
+	// InProgress counts transactions skipped because the process that started them is still running
+	InProgress int
+	Errors     []error
 }
 
+// Recover resolves transactions interrupted by a crash. A transaction that was
+// committing is finished, one that had not started committing is rolled back,
+// and journals of finished transactions older than retention are removed.
+// Transactions whose process is still running are left alone.
 func Recover(vaultRoot string, retention time.Duration) (*RecoveryResult, error) {
-	txnRoot := filepath.Join(vaultRoot, ".txn")
+	return recoverTransactions(vaultRoot, retention, false)
+}
+
+// RecoverAll is Recover without the running-process check, for journals left
+// behind by a process whose ID has since been reused
+func RecoverAll(vaultRoot string, retention time.Duration) (*RecoveryResult, error) {
+	return recoverTransactions(vaultRoot, retention, true)
+}
+
+func recoverTransactions(vaultRoot string, retention time.Duration, force bool) (*RecoveryResult, error) {
 	res := &RecoveryResult{}
-	entries, err := os.ReadDir(txnRoot)
+	journals, errs, err := loadJournals(vaultRoot)
+	res.Errors = errs
 	if err != nil {
-		if os.IsNotExist(err) {
-			return res, nil
-		}
-		return res, fmt.Errorf("read txn root: %w", err)
+		return res, err
 	}
 	now := time.Now()
-	for _, e := range entries {
-		if !e.IsDir() {
-			continue
-		}
-		dir := filepath.Join(txnRoot, e.Name())
-		jpath := filepath.Join(dir, "journal.json")
-		data, err := os.ReadFile(jpath)
-		if err != nil {
-			res.Errors = append(res.Errors, fmt.Errorf("read %s: %w", jpath, err))
+	for _, j := range journals {
+		txn := &Transaction{j: j}
+		switch j.State {
+		case StateCommitted, StateRolledBack:
+			if retention > 0 && now.Sub(j.StartedAt) > retention {
+				j.remove()
+				res.Purged++
+			}
 			continue
 		}
-		var j Journal
-		if err := json.Unmarshal(data, &j); err != nil {
-			res.Errors = append(res.Errors, fmt.Errorf("unmarshal %s: %w", jpath, err))
+		if !force && j.Running() {
+			res.InProgress++
 			continue
 		}
-		j.dir = dir
-		j.vaultRoot = vaultRoot
-		txn := &Transaction{j: &j}
 		switch j.State {
-		case StateCommitted:
-			if retention > 0 && now.Sub(j.StartedAt) > retention {
-				_ = os.RemoveAll(dir)
-				res.Purged++
-			}
-		case StatePending, StateCommitting, StateFailed:
-			if err := txn.Commit(); err != nil {
+		case StateCommitting:
+			if err := txn.promote(true); err != nil {
 				if rerr := txn.Rollback(); rerr != nil {
 					res.Errors = append(res.Errors, fmt.Errorf("rollback %s: %v (commit err: %v)", j.ID, rerr, err))
 				} else {
@@ -61,18 +67,82 @@ func Recover(vaultRoot string, retention time.Duration) (*RecoveryResult, error)
 			} else {
 				res.ResumedCommits++
 			}
-		case StateRollingBack:
+		case StatePending, StateFailed, StateRollingBack:
 			if err := txn.Rollback(); err != nil {
 				res.Errors = append(res.Errors, fmt.Errorf("finish rollback %s: %v", j.ID, err))
 			} else {
 				res.RolledBack++
 			}
-		case StateRolledBack:
-			if retention > 0 && now.Sub(j.StartedAt) > retention {
-				_ = os.RemoveAll(dir)
-				res.Purged++
-			}
 		}
 	}
 	return res, nil
 }
+
+// Incomplete returns the journals of transactions that were neither committed
+// nor rolled back, oldest first
+func Incomplete(vaultRoot string) ([]*Journal, error) {
+	journals, errs, err := loadJournals(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %v", ErrTxnCorrupt, errs[0])
+	}
+	var incomplete []*Journal
+	for _, j := range journals {
+		if j.State != StateCommitted && j.State != StateRolledBack {
+			incomplete = append(incomplete, j)
+		}
+	}
+	return incomplete, nil
+}
+
+// Running reports whether the process that started the transaction is still
+// running. Journals written on another host are never considered running.
+func (j *Journal) Running() bool {
+	if j.PID == 0 || j.PID == os.Getpid() {
+		return false
+	}
+	if host, _ := os.Hostname(); j.Host != "" && j.Host != host {
+		return false
+	}
+	return lock.ProcessRunning(j.PID)
+}
+
+// loadJournals reads every journal under .txn, ordered by ID. Journals that
+// cannot be read are reported in the returned error list.
+func loadJournals(vaultRoot string) ([]*Journal, []error, error) {
+	txnRoot := filepath.Join(vaultRoot, ".txn")
+	entries, err := os.ReadDir(txnRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("read txn root: %w", err)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Name() < entries[b].Name() })
+
+	var journals []*Journal
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(txnRoot, e.Name())
+		jpath := filepath.Join(dir, "journal.json")
+		data, err := os.ReadFile(jpath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read %s: %w", jpath, err))
+			continue
+		}
+		j := &Journal{}
+		if err := json.Unmarshal(data, j); err != nil {
+			errs = append(errs, fmt.Errorf("unmarshal %s: %w", jpath, err))
+			continue
+		}
+		j.dir = dir
+		j.vaultRoot = vaultRoot
+		journals = append(journals, j)
+	}
+	return journals, errs, nil
+}
@@ -1,6 +1,7 @@
 package atomic
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -30,3 +31,155 @@ func TestRecoveryPurgesOldCommitted(t *testing.T) {
 		t.Fatalf("txn dir should be removed")
 	}
 }
+
+// interruptCommit stages a replacement of a.txt and a new b.txt, then leaves
+// the transaction as a crash after promoting only a.txt would
+func interruptCommit(t *testing.T, root string) *Transaction {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	txn, err := Begin(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"a.txt": "new", "b.txt": "created"} {
+		var w io.WriteCloser
+		if name == "a.txt" {
+			w, err = txn.StageReplace(name)
+		} else {
+			w, err = txn.StageCreate(name)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txn.j.State = StateCommitting
+	if err := txn.j.persist(); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range txn.j.Entries {
+		if e.FinalPath == "a.txt" {
+			if err := os.Rename(e.StagedPath, filepath.Join(root, "a.txt")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return txn
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func TestRecoveryFinishesInterruptedCommit(t *testing.T) {
+	root := t.TempDir()
+	interruptCommit(t, root)
+
+	res, err := Recover(root, time.Hour)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if res.ResumedCommits != 1 || len(res.Errors) != 0 {
+		t.Fatalf("expected one resumed commit, got %+v", res)
+	}
+	if got := readFile(t, filepath.Join(root, "a.txt")); got != "new" {
+		t.Errorf("a.txt = %q, want new", got)
+	}
+	if got := readFile(t, filepath.Join(root, "b.txt")); got != "created" {
+		t.Errorf("b.txt = %q, want created", got)
+	}
+}
+
+func TestRecoveryRollsBackCorruptInterruptedCommit(t *testing.T) {
+	root := t.TempDir()
+	txn := interruptCommit(t, root)
+	for _, e := range txn.j.Entries {
+		if e.FinalPath == "b.txt" {
+			if err := os.WriteFile(e.StagedPath, []byte("torn"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	res, err := Recover(root, time.Hour)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if res.RolledBack != 1 {
+		t.Fatalf("expected rollback, got %+v", res)
+	}
+	if got := readFile(t, filepath.Join(root, "a.txt")); got != "old" {
+		t.Errorf("a.txt = %q, want original restored", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("b.txt should not exist after rollback")
+	}
+}
+
+func TestRecoveryRestoresPendingReplace(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	txn, _ := Begin(root, nil)
+	w, err := txn.StageReplace("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("half"))
+	// crash before Close: the original is in trash but the journal knows it
+
+	res, err := Recover(root, 0)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if res.RolledBack != 1 {
+		t.Fatalf("expected rollback, got %+v", res)
+	}
+	if got := readFile(t, filepath.Join(root, "a.txt")); got != "old" {
+		t.Errorf("a.txt = %q, want original restored", got)
+	}
+}
+
+func TestRecoverySkipsRunningTransaction(t *testing.T) {
+	root := t.TempDir()
+	txn, _ := Begin(root, nil)
+	w, _ := txn.StageCreate("c.txt")
+	w.Write([]byte("data"))
+	w.Close()
+	// Pretend the transaction belongs to the test runner, which is running
+	txn.j.PID = os.Getppid()
+	if err := txn.j.persist(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Recover(root, 0)
+	if err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if res.InProgress != 1 || res.RolledBack != 0 {
+		t.Fatalf("expected running transaction to be skipped, got %+v", res)
+	}
+	if incomplete, err := Incomplete(root); err != nil || len(incomplete) != 1 {
+		t.Fatalf("expected one incomplete transaction, got %d (%v)", len(incomplete), err)
+	}
+
+	res, err = RecoverAll(root, 0)
+	if err != nil || res.RolledBack != 1 {
+		t.Fatalf("expected RecoverAll to roll back, got %+v (%v)", res, err)
+	}
+	if incomplete, _ := Incomplete(root); len(incomplete) != 0 {
+		t.Errorf("expected no incomplete transactions, got %d", len(incomplete))
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/substantialcattle5/sietch/internal/fs"
 )
 
 type State string
@@ -41,6 +44,9 @@ type JournalEntry struct {
 	Checksum           string    `json:"checksum,omitempty"`
 }
 
+// Journal is the write-ahead record of a transaction. Every entry is persisted
+// before the file it describes is moved, and the journal is fsynced on each
+// change, so after a crash Recover can always finish or undo the transaction.
 type Journal struct {
 	Version   int            `json:"version"`
 	ID        string         `json:"id"`
@@ -48,6 +54,8 @@ type Journal struct {
 	State     State          `json:"state"`
 	Entries   []JournalEntry `json:"entries"`
 	Metadata  map[string]any `json:"metadata,omitempty"`
+	PID       int            `json:"pid,omitempty"`
+	Host      string         `json:"host,omitempty"`
 
 	dir       string
 	vaultRoot string
@@ -71,7 +79,8 @@ func Begin(vaultRoot string, metadata map[string]any) (*Transaction, error) {
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("create txn dir: %w", err)
 	}
-	j := &Journal{Version: 1, ID: id, StartedAt: time.Now().UTC(), State: StatePending, Entries: []JournalEntry{}, Metadata: metadata, dir: dir, vaultRoot: vaultRoot}
+	host, _ := os.Hostname()
+	j := &Journal{Version: 1, ID: id, StartedAt: time.Now().UTC(), State: StatePending, Entries: []JournalEntry{}, Metadata: metadata, PID: os.Getpid(), Host: host, dir: dir, vaultRoot: vaultRoot}
 	if err := j.persist(); err != nil {
 		return nil, err
 	}
@@ -80,10 +89,28 @@ func Begin(vaultRoot string, metadata map[string]any) (*Transaction, error) {
 	return &Transaction{j: j}, nil
 }
 
+// VaultRoot returns the root of the vault the transaction changes
+func (t *Transaction) VaultRoot() string { return t.j.vaultRoot }
+
+// StagedBytes returns the size of the files staged for creation under the
+// vault-relative prefix, such as ".sietch/chunks/"
+func (t *Transaction) StagedBytes(prefix string) int64 {
+	t.j.mu.Lock()
+	defer t.j.mu.Unlock()
+	var size int64
+	for _, e := range t.j.Entries {
+		if e.Type == EntryCreate && strings.HasPrefix(e.FinalPath, prefix) {
+			size += e.Size
+		}
+	}
+	return size
+}
+
 func (t *Transaction) StageCreate(finalRelPath string) (io.WriteCloser, error) {
 	t.j.mu.Lock()
 	defer t.j.mu.Unlock()
-	staged := filepath.Join(t.j.dir, "new", filepath.FromSlash(finalRelPath))
+	_, dir, rel := t.j.locate(finalRelPath)
+	staged := filepath.Join(dir, "new", rel)
 	if err := os.MkdirAll(filepath.Dir(staged), 0o755); err != nil {
 		return nil, fmt.Errorf("stage create mkdir: %w", err)
 	}
@@ -107,7 +134,7 @@ type createWriter struct {
 
 func (cw *createWriter) Write(b []byte) (int, error) { return cw.multi.Write(b) }
 func (cw *createWriter) Close() error {
-	if err := cw.f.Close(); err != nil {
+	if err := closeSynced(cw.f); err != nil {
 		return err
 	}
 	fi, err := os.Stat(cw.staged)
@@ -124,7 +151,7 @@ func (cw *createWriter) Close() error {
 func (t *Transaction) StageDelete(finalRelPath string) error {
 	t.j.mu.Lock()
 	defer t.j.mu.Unlock()
-	abs := filepath.Join(t.j.vaultRoot, filepath.FromSlash(finalRelPath))
+	abs, dir, rel := t.j.locate(finalRelPath)
 	if _, err := os.Stat(abs); err != nil {
 		if os.IsNotExist(err) {
 			t.j.Entries = append(t.j.Entries, JournalEntry{Type: EntryDelete, FinalPath: filepath.ToSlash(finalRelPath)})
@@ -132,40 +159,70 @@ func (t *Transaction) StageDelete(finalRelPath string) error {
 		}
 		return fmt.Errorf("stage delete stat: %w", err)
 	}
-	trash := filepath.Join(t.j.dir, "trash", filepath.FromSlash(finalRelPath))
+	trash := filepath.Join(dir, "trash", rel)
 	if err := os.MkdirAll(filepath.Dir(trash), 0o755); err != nil {
 		return fmt.Errorf("stage delete mkdir: %w", err)
 	}
+	// Journal the move before making it, so a crash never strands the original in trash
+	t.j.Entries = append(t.j.Entries, JournalEntry{Type: EntryDelete, FinalPath: filepath.ToSlash(finalRelPath), OriginalBackupPath: trash})
+	if err := t.j.persistLocked(); err != nil {
+		t.j.Entries = t.j.Entries[:len(t.j.Entries)-1]
+		return err
+	}
 	if err := os.Rename(abs, trash); err != nil {
+		t.j.Entries = t.j.Entries[:len(t.j.Entries)-1]
+		_ = t.j.persistLocked()
 		return fmt.Errorf("stage delete move: %w", err)
 	}
-	t.j.Entries = append(t.j.Entries, JournalEntry{Type: EntryDelete, FinalPath: filepath.ToSlash(finalRelPath), OriginalBackupPath: trash})
-	return t.j.persistLocked()
+	return syncDir(filepath.Dir(abs))
 }
 
 func (t *Transaction) StageReplace(finalRelPath string) (io.WriteCloser, error) {
 	t.j.mu.Lock()
 	defer t.j.mu.Unlock()
-	abs := filepath.Join(t.j.vaultRoot, filepath.FromSlash(finalRelPath))
-	trash := filepath.Join(t.j.dir, "trash", filepath.FromSlash(finalRelPath))
-	if _, err := os.Stat(abs); err == nil {
+	abs, dir, rel := t.j.locate(finalRelPath)
+	trash := filepath.Join(dir, "trash", rel)
+	staged := filepath.Join(dir, "new", rel)
+	if err := os.MkdirAll(filepath.Dir(staged), 0o755); err != nil {
+		return nil, fmt.Errorf("stage replace mkdir new: %w", err)
+	}
+
+	// Journal the intent before moving the original; Close fills in the checksum
+	entry := JournalEntry{Type: EntryReplace, FinalPath: filepath.ToSlash(finalRelPath), StagedPath: staged}
+	original, statErr := os.Stat(abs)
+	if statErr == nil {
 		if err := os.MkdirAll(filepath.Dir(trash), 0o755); err != nil {
 			return nil, fmt.Errorf("stage replace mkdir trash: %w", err)
 		}
+		entry.OriginalBackupPath = trash
+	}
+	index := len(t.j.Entries)
+	t.j.Entries = append(t.j.Entries, entry)
+	if err := t.j.persistLocked(); err != nil {
+		t.j.Entries = t.j.Entries[:index]
+		return nil, err
+	}
+	if statErr == nil {
 		if err := os.Rename(abs, trash); err != nil {
+			t.j.Entries = t.j.Entries[:index]
+			_ = t.j.persistLocked()
 			return nil, fmt.Errorf("stage replace move: %w", err)
 		}
 	}
-	staged := filepath.Join(t.j.dir, "new", filepath.FromSlash(finalRelPath))
-	if err := os.MkdirAll(filepath.Dir(staged), 0o755); err != nil {
-		return nil, fmt.Errorf("stage replace mkdir new: %w", err)
-	}
+
 	f, err := os.Create(staged)
 	if err != nil {
 		return nil, fmt.Errorf("stage replace open: %w", err)
 	}
+	// The replacement keeps the original's permissions, so a key file stays private
+	if statErr == nil {
+		if err := f.Chmod(original.Mode().Perm()); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("stage replace chmod: %w", err)
+		}
+	}
 	h := sha256.New()
-	w := &replaceWriter{multi: io.MultiWriter(f, h), f: f, t: t, staged: staged, rel: filepath.ToSlash(finalRelPath), trash: trash, hsh: h}
+	w := &replaceWriter{multi: io.MultiWriter(f, h), f: f, t: t, staged: staged, index: index, hsh: h}
 	return w, nil
 }
 
@@ -174,14 +231,13 @@ type replaceWriter struct {
 	f      *os.File
 	t      *Transaction
 	staged string
-	rel    string
-	trash  string
+	index  int
 	hsh    interface{ Sum([]byte) []byte }
 }
 
 func (rw *replaceWriter) Write(b []byte) (int, error) { return rw.multi.Write(b) }
 func (rw *replaceWriter) Close() error {
-	if err := rw.f.Close(); err != nil {
+	if err := closeSynced(rw.f); err != nil {
 		return err
 	}
 	fi, err := os.Stat(rw.staged)
@@ -191,7 +247,8 @@ func (rw *replaceWriter) Close() error {
 	sum := rw.hsh.Sum(nil)
 	rw.t.j.mu.Lock()
 	defer rw.t.j.mu.Unlock()
-	rw.t.j.Entries = append(rw.t.j.Entries, JournalEntry{Type: EntryReplace, FinalPath: rw.rel, StagedPath: rw.staged, OriginalBackupPath: rw.trash, Size: fi.Size(), Checksum: "sha256:" + hex.EncodeToString(sum)})
+	rw.t.j.Entries[rw.index].Size = fi.Size()
+	rw.t.j.Entries[rw.index].Checksum = "sha256:" + hex.EncodeToString(sum)
 	return rw.t.j.persistLocked()
 }
 
@@ -206,20 +263,46 @@ func (t *Transaction) Commit() error {
 		t.j.mu.Unlock()
 		return err
 	}
+	t.j.mu.Unlock()
+	return t.promote(false)
+}
+
+// promote moves every staged file into place and marks the transaction
+// committed. It can be repeated after an interruption: files promoted before
+// the interruption are recognised by their checksum. With verify set, staged
+// files are checked against their checksum before they are promoted.
+func (t *Transaction) promote(verify bool) error {
+	t.j.mu.Lock()
 	entries := append([]JournalEntry(nil), t.j.Entries...)
 	t.j.mu.Unlock()
+	dirs := map[string]bool{}
 	for _, e := range entries {
 		if e.Type == EntryCreate || e.Type == EntryReplace {
 			if e.StagedPath == "" {
 				return t.fail(fmt.Errorf("missing staged path for %s", e.FinalPath))
 			}
-			finalAbs := filepath.Join(t.j.vaultRoot, filepath.FromSlash(e.FinalPath))
+			finalAbs, _, _ := t.j.locate(e.FinalPath)
+			if _, err := os.Stat(e.StagedPath); os.IsNotExist(err) {
+				if e.Checksum != "" && fileChecksum(finalAbs) == e.Checksum {
+					continue // promoted before an interruption
+				}
+				return t.fail(fmt.Errorf("commit promote %s: staged file is missing", e.FinalPath))
+			}
+			if verify && (e.Checksum == "" || fileChecksum(e.StagedPath) != e.Checksum) {
+				return t.fail(fmt.Errorf("commit promote %s: staged file is incomplete", e.FinalPath))
+			}
 			if err := os.MkdirAll(filepath.Dir(finalAbs), 0o755); err != nil {
 				return t.fail(fmt.Errorf("commit mkdir: %w", err))
 			}
 			if err := os.Rename(e.StagedPath, finalAbs); err != nil {
 				return t.fail(fmt.Errorf("commit promote %s: %w", e.FinalPath, err))
 			}
+			dirs[filepath.Dir(finalAbs)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return t.fail(fmt.Errorf("commit sync %s: %w", dir, err))
 		}
 	}
 	for _, e := range entries {
@@ -249,17 +332,27 @@ func (t *Transaction) Rollback() error {
 	t.j.mu.Unlock()
 	for _, e := range entries {
 		if (e.Type == EntryCreate || e.Type == EntryReplace) && e.StagedPath != "" {
-			_ = os.Remove(e.StagedPath)
+			if _, err := os.Stat(e.StagedPath); err == nil {
+				_ = os.Remove(e.StagedPath)
+				continue
+			}
+			// Undo a promotion made before a commit was interrupted
+			finalAbs, _, _ := t.j.locate(e.FinalPath)
+			if e.Checksum != "" && fileChecksum(finalAbs) == e.Checksum {
+				_ = os.Remove(finalAbs)
+			}
 		}
 	}
 	for _, e := range entries {
 		if (e.Type == EntryDelete || e.Type == EntryReplace) && e.OriginalBackupPath != "" {
-			finalAbs := filepath.Join(t.j.vaultRoot, filepath.FromSlash(e.FinalPath))
+			finalAbs, _, _ := t.j.locate(e.FinalPath)
 			if _, err := os.Stat(finalAbs); err == nil {
 				continue
 			}
 			_ = os.MkdirAll(filepath.Dir(finalAbs), 0o755)
-			_ = os.Rename(e.OriginalBackupPath, finalAbs)
+			if err := os.Rename(e.OriginalBackupPath, finalAbs); err == nil {
+				_ = syncDir(filepath.Dir(finalAbs))
+			}
 		}
 	}
 	t.j.mu.Lock()
@@ -269,6 +362,38 @@ func (t *Transaction) Rollback() error {
 	return err
 }
 
+// chunkPrefix is the vault-relative directory of chunks, which may be kept
+// outside the vault
+const chunkPrefix = ".sietch/chunks/"
+
+// locate returns where the file at the vault-relative path finalRelPath
+// lives, the directory its staged and trashed copies are kept in, and their
+// path relative to that directory. Chunks of a vault with a chunk store
+// outside the vault are staged inside the chunk store, so they are moved into
+// place without crossing filesystems.
+func (j *Journal) locate(finalRelPath string) (abs, dir, rel string) {
+	finalRelPath = filepath.ToSlash(finalRelPath)
+	if name, ok := strings.CutPrefix(finalRelPath, chunkPrefix); ok {
+		if store := fs.ChunkStore(j.vaultRoot); store != "" {
+			return filepath.Join(store, filepath.FromSlash(name)), j.storeDir(store), filepath.FromSlash(name)
+		}
+	}
+	return filepath.Join(j.vaultRoot, filepath.FromSlash(finalRelPath)), j.dir, filepath.FromSlash(finalRelPath)
+}
+
+// storeDir is the directory of the transaction inside the chunk store
+func (j *Journal) storeDir(store string) string {
+	return filepath.Join(store, ".txn", j.ID)
+}
+
+// remove deletes the journal and anything the transaction left in the chunk store
+func (j *Journal) remove() {
+	if store := fs.ChunkStore(j.vaultRoot); store != "" {
+		_ = os.RemoveAll(j.storeDir(store))
+	}
+	_ = os.RemoveAll(j.dir)
+}
+
 func (t *Transaction) fail(err error) error {
 	t.j.mu.Lock()
 	t.j.State = StateFailed
@@ -285,8 +410,54 @@ func (j *Journal) persistLocked() error {
 		return err
 	}
 	tmp := filepath.Join(j.dir, "journal.json.tmp")
-	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := closeSynced(f); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(j.dir, "journal.json")); err != nil {
+		return err
+	}
+	return syncDir(j.dir)
+}
+
+// closeSynced flushes f to stable storage and closes it
+func closeSynced(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes a directory so renames into or out of it survive a crash.
+// Some platforms cannot sync directories; there the rename is left to the OS.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
 		return err
 	}
-	return os.Rename(tmp, filepath.Join(j.dir, "journal.json"))
+	_ = d.Sync()
+	return d.Close()
+}
+
+// fileChecksum returns the checksum of the file at path in journal format, or
+// "" if it cannot be read
+func fileChecksum(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
 }
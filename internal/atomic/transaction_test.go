@@ -3,6 +3,7 @@ package atomic
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -23,6 +24,12 @@ func TestTransactionCommit(t *testing.T) {
 	if err := w.Close(); err != nil {
 		t.Fatalf("close: %v", err)
 	}
+	if got := txn.StagedBytes("data/"); got != 5 {
+		t.Fatalf("staged bytes under data/ = %d, want 5", got)
+	}
+	if got := txn.StagedBytes("other/"); got != 0 {
+		t.Fatalf("staged bytes under other/ = %d, want 0", got)
+	}
 	if err := txn.Commit(); err != nil {
 		t.Fatalf("commit: %v", err)
 	}
@@ -136,6 +143,29 @@ func TestStageReplaceCommit(t *testing.T) {
 	}
 }
 
+func TestStageReplaceKeepsPermissions(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "secret.key")
+	os.WriteFile(path, []byte("old"), 0o600)
+	txn, _ := Begin(root, nil)
+	w, err := txn.StageReplace("secret.key")
+	if err != nil {
+		t.Fatalf("stage replace: %v", err)
+	}
+	w.Write([]byte("new"))
+	w.Close()
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected replaced file to keep mode 0600, got %o", perm)
+	}
+}
+
 func TestStageReplaceRollback(t *testing.T) {
 	root := t.TempDir()
 	path := filepath.Join(root, "file.txt")
@@ -215,3 +245,55 @@ func TestRecoveryResumesCommit(t *testing.T) {
 		t.Fatalf("expected resume or rollback action")
 	}
 }
+
+func TestChunksStagedInChunkStore(t *testing.T) {
+	root := t.TempDir()
+	store := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "vault.yaml"), []byte("chunk_store: "+store+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(store, "old"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	txn, err := Begin(root, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	w, err := txn.StageCreate(".sietch/chunks/new")
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	w.Write([]byte("chunk"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := txn.StageDelete(".sietch/chunks/old"); err != nil {
+		t.Fatalf("stage delete: %v", err)
+	}
+	// Staged next to the chunk store, not in the vault
+	if staged := txn.j.Entries[0].StagedPath; !strings.HasPrefix(staged, store) {
+		t.Fatalf("chunk staged at %s, outside the chunk store", staged)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(store, "new")); got != "chunk" {
+		t.Errorf("expected the chunk in the chunk store, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(store, "old")); !os.IsNotExist(err) {
+		t.Error("expected the deleted chunk to be gone")
+	}
+	if _, err := os.Stat(filepath.Join(root, ".sietch", "chunks")); !os.IsNotExist(err) {
+		t.Error("expected nothing to be written to .sietch/chunks")
+	}
+
+	// Purging the journal clears its directory in the chunk store too
+	if _, err := Recover(root, time.Nanosecond); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store, ".txn", txn.j.ID)); !os.IsNotExist(err) {
+		t.Error("expected the transaction's directory in the chunk store to be removed")
+	}
+}
@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Operations recorded in the audit log
+const (
+	OpAdd          = "add"
+	OpDelete       = "rm"
+	OpUndelete     = "undelete"
+	OpMove         = "mv"
+	OpCopy         = "cp"
+	OpSync         = "sync"
+	OpKeyExchange  = "key-exchange"
+	OpGC           = "gc"
+	OpTrust        = "trust"
+	OpPassphrase   = "passwd"
+	OpKeyImport    = "key-import"
+	OpKeyRotate    = "key-rotate"
+	OpRecompress   = "recompress"
+	OpReencrypt    = "reencrypt"
+	OpReshard      = "reshard"
+	OpParityBuild  = "parity-build"
+	OpParityRepair = "parity-repair"
+	OpScrub        = "scrub"
+	OpMuleReceive  = "mule-receive"
+	OpMuleDeliver  = "mule-deliver"
+)
+
+// ErrChainBroken is returned by Verify when an entry was modified, removed or reordered
+var ErrChainBroken = errors.New("audit log hash chain broken")
+
+// Entry is one record of the audit log. Hash covers every other field,
+// including the previous entry's hash, so changing any entry breaks the chain
+// from that point on. Vaults that encrypt their manifests keep the details,
+// which name vault paths, sealed; Read opens them when the vault key is
+// available, and the hash covers the sealed form so the chain can be
+// verified without it.
+type Entry struct {
+	Seq       int               `json:"seq" yaml:"seq"`
+	Time      time.Time         `json:"time" yaml:"time"`
+	Operation string            `json:"operation" yaml:"operation"`
+	Details   map[string]string `json:"details,omitempty" yaml:"details,omitempty"`
+	Sealed    string            `json:"sealed,omitempty" yaml:"sealed,omitempty"` // Details sealed with the vault's metadata key, base64
+	PrevHash  string            `json:"prev_hash" yaml:"prev_hash"`
+	Hash      string            `json:"hash" yaml:"hash"`
+}
+
+// mu serializes appends from one process so entries chain in order
+var mu sync.Mutex
+
+// LogPath returns the location of the audit log of the vault at vaultRoot
+func LogPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "audit.log")
+}
+
+// Record appends an entry for operation to the vault's audit log
+func Record(vaultRoot, operation string, details map[string]string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entries, err := readEntries(vaultRoot)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{
+		Seq:       1,
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Details:   details,
+	}
+	if len(details) > 0 && config.MetadataEncrypted(vaultRoot) {
+		data, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		sealed, err := config.SealMetadata(vaultRoot, data)
+		if err != nil {
+			return fmt.Errorf("failed to seal audit details: %w", err)
+		}
+		entry.Details, entry.Sealed = nil, base64.StdEncoding.EncodeToString(sealed)
+	}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+	}
+	entry.Hash = entry.computeHash()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	f, err := os.OpenFile(LogPath(vaultRoot), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// Read returns every entry of the vault's audit log, oldest first, with
+// sealed details opened. Details that cannot be opened, because the vault
+// key is not available, are left sealed. A vault without an audit log has no
+// entries.
+func Read(vaultRoot string) ([]Entry, error) {
+	entries, err := readEntries(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].open(vaultRoot)
+	}
+	return entries, nil
+}
+
+// open fills in the details of a sealed entry, if they can be opened
+func (e *Entry) open(vaultRoot string) {
+	if e.Sealed == "" {
+		return
+	}
+	sealed, err := base64.StdEncoding.DecodeString(e.Sealed)
+	if err != nil {
+		return
+	}
+	data, err := config.OpenMetadata(vaultRoot, sealed)
+	if err != nil {
+		return
+	}
+	var details map[string]string
+	if json.Unmarshal(data, &details) == nil {
+		e.Details = details
+	}
+}
+
+// readEntries returns the entries of the vault's audit log as stored
+func readEntries(vaultRoot string) ([]Entry, error) {
+	f, err := os.Open(LogPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%w: line %d is not a valid entry: %v", ErrChainBroken, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Verify checks that entries form an unbroken hash chain starting at the
+// first entry ever written. Entries removed from the end cannot be detected
+// this way; compare the last hash with a copy kept outside the vault for that.
+func Verify(entries []Entry) error {
+	prev := ""
+	for i, entry := range entries {
+		if entry.Seq != i+1 {
+			return fmt.Errorf("%w: entry %d has sequence number %d", ErrChainBroken, i+1, entry.Seq)
+		}
+		if entry.PrevHash != prev {
+			return fmt.Errorf("%w: entry %d does not follow the entry before it", ErrChainBroken, entry.Seq)
+		}
+		if entry.Hash != entry.computeHash() {
+			return fmt.Errorf("%w: entry %d was modified", ErrChainBroken, entry.Seq)
+		}
+		prev = entry.Hash
+	}
+	return nil
+}
+
+// computeHash returns the hex SHA-256 of the entry with its Hash field
+// cleared, and for sealed entries the opened details left out
+func (e Entry) computeHash() string {
+	e.Hash = ""
+	if e.Sealed != "" {
+		e.Details = nil
+	}
+	// Marshaling a struct of strings, ints, a time and a map cannot fail, and
+	// map keys are sorted so the encoding is stable
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// newTestVault returns a directory with the .sietch folder the log lives in
+func newTestVault(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestRecordAndVerify(t *testing.T) {
+	root := newTestVault(t)
+
+	entries, err := Read(root)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected no entries before anything is recorded, got %v (%v)", entries, err)
+	}
+
+	if err := Record(root, OpAdd, map[string]string{"paths": "docs/a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Record(root, OpSync, map[string]string{"peer": "p1", "files": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Record(root, OpDelete, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err = Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].PrevHash != "" || entries[1].PrevHash != entries[0].Hash || entries[2].Seq != 3 {
+		t.Errorf("entries are not chained: %+v", entries)
+	}
+	if entries[1].Operation != OpSync || entries[1].Details["peer"] != "p1" {
+		t.Errorf("unexpected second entry %+v", entries[1])
+	}
+	if err := Verify(entries); err != nil {
+		t.Errorf("expected untouched log to verify: %v", err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	root := newTestVault(t)
+	for _, path := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := Record(root, OpAdd, map[string]string{"paths": path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified := append([]Entry(nil), entries...)
+	modified[1].Details = map[string]string{"paths": "other.txt"}
+
+	removed := []Entry{entries[0], entries[2]}
+
+	rehashed := append([]Entry(nil), entries...)
+	rehashed[1].Operation = OpGC
+	rehashed[1].Hash = rehashed[1].computeHash()
+
+	tests := []struct {
+		name    string
+		entries []Entry
+		errPart string
+	}{
+		{"modified entry", modified, "entry 2 was modified"},
+		{"removed entry", removed, "sequence number 3"},
+		{"modified and rehashed entry", rehashed, "entry 3 does not follow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.entries)
+			if !errors.Is(err, ErrChainBroken) || !strings.Contains(err.Error(), tt.errPart) {
+				t.Errorf("Verify() = %v, want ErrChainBroken containing %q", err, tt.errPart)
+			}
+		})
+	}
+}
+
+func TestReadRejectsCorruptLine(t *testing.T) {
+	root := newTestVault(t)
+	if err := os.WriteFile(LogPath(root), []byte("not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(root); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("expected ErrChainBroken for a corrupt line, got %v", err)
+	}
+}
+
+func TestRecordSealsDetailsOfEncryptedVaults(t *testing.T) {
+	root := newTestVault(t)
+	cfg := "name: test\nencryption:\n  type: aes\n  encrypt_manifests: true\n"
+	if err := os.WriteFile(filepath.Join(root, "vault.yaml"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	previous := config.MetadataKeyLoader
+	config.MetadataKeyLoader = func(string, *config.VaultConfig) ([]byte, error) {
+		return bytes.Repeat([]byte{7}, 32), nil
+	}
+	t.Cleanup(func() { config.MetadataKeyLoader = previous })
+
+	if err := Record(root, OpAdd, map[string]string{"paths": "docs/secret-plans.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Record(root, OpDelete, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(LogPath(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-plans") {
+		t.Error("audit log holds a vault path in plaintext")
+	}
+
+	// The chain verifies without the key
+	stored, err := readEntries(root)
+	if err != nil || len(stored) != 2 || stored[0].Details != nil || stored[0].Sealed == "" {
+		t.Fatalf("expected the details stored sealed, got %+v (%v)", stored, err)
+	}
+	if err := Verify(stored); err != nil {
+		t.Errorf("sealed log failed to verify: %v", err)
+	}
+
+	entries, err := Read(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Details["paths"] != "docs/secret-plans.txt" {
+		t.Errorf("expected the details opened, got %v", entries[0].Details)
+	}
+	if err := Verify(entries); err != nil {
+		t.Errorf("opened log failed to verify: %v", err)
+	}
+}
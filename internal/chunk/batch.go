@@ -0,0 +1,269 @@
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// Batch stages the chunks of several files in one transaction. All files
+// share one deduplication index, which is saved once with Save, so files
+// can be chunked concurrently without losing each other's references.
+// Chunks staged by the batch are remembered, so later copies of them, in the
+// same file or another, are only hashed: they are never compressed,
+// encrypted or written again. Its methods are safe for concurrent use.
+type Batch struct {
+	vaultRoot   string
+	vaultConfig *config.VaultConfig
+	passphrase  string
+	txn         *atomic.Transaction
+	dedup       *deduplication.Manager
+
+	mu     sync.Mutex
+	staged map[string]config.ChunkRef // Chunks staged in txn by content hash
+}
+
+// NewBatch starts a batch staging chunks in txn. Deduplication messages are
+// printed through progressMgr.
+func NewBatch(vaultRoot string, passphrase string, txn *atomic.Transaction, progressMgr *progress.Manager) (*Batch, error) {
+	if txn == nil {
+		return nil, fmt.Errorf("transaction required")
+	}
+	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+	if err := fs.CheckChunkStore(vaultRoot); err != nil {
+		return nil, err
+	}
+	if vaultConfig.Encryption.Type == constants.EncryptionTypeAES && vaultConfig.Encryption.PassphraseProtected && passphrase == "" {
+		return nil, fmt.Errorf("passphrase required for encrypted vault but not provided")
+	}
+	dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize deduplication manager: %v", err)
+	}
+	if progressMgr != nil {
+		dedupManager.SetProgressManager(progressMgr)
+	}
+	return &Batch{
+		vaultRoot:   vaultRoot,
+		vaultConfig: vaultConfig,
+		passphrase:  passphrase,
+		txn:         txn,
+		dedup:       dedupManager,
+		staged:      make(map[string]config.ChunkRef),
+	}, nil
+}
+
+// lookup returns the chunk with hash staged earlier in the batch
+func (b *Batch) lookup(hash string) (config.ChunkRef, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ref, ok := b.staged[hash]
+	return ref, ok
+}
+
+// store stages a chunk in txn, remembering it if later copies of it are to
+// be deduplicated against it
+func (b *Batch) store(txn *atomic.Transaction, ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+	ref, deduplicated, err := b.dedup.ProcessChunkTransactional(txn, ref, data, storageHash)
+	if err != nil || deduplicated || txn != b.txn || !b.dedup.Deduplicates(ref.Size) {
+		// Chunks committed with a checkpoint are left out, since the
+		// checkpoint's transaction may still be rolled back
+		return ref, deduplicated, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.staged[ref.Hash]; !ok {
+		b.staged[ref.Hash] = ref
+	}
+	return ref, false, nil
+}
+
+// Save saves the deduplication index with the references of every file
+// chunked in the batch
+func (b *Batch) Save() error {
+	if err := b.dedup.Save(); err != nil {
+		return fmt.Errorf("failed to save deduplication index: %v", err)
+	}
+	return nil
+}
+
+// ChunkFile splits filePath into chunks, staging new ones in the batch's
+// transaction. Files larger than checkpointInterval are committed in
+// batches of their own so an interrupted add can resume.
+func (b *Batch) ChunkFile(ctx context.Context, filePath string, chunkSize int64, workers int, progressMgr *progress.Manager) ([]config.ChunkRef, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got: %d", chunkSize)
+	}
+	file, err := fs.VerifyFileAndReturnFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+	progressMgr.InitTotalProgress(fileInfo.Size(), "Chunking file (txn)")
+	reader, err := newExtentReader(file, fileInfo.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to map file extents: %v", err)
+	}
+
+	// Large files are committed in batches, resuming after the last batch
+	// an interrupted add of the same file committed
+	var checkpoints *checkpointer
+	var resumed []config.ChunkRef
+	if fileInfo.Size() > checkpointInterval {
+		fresh, err := newCheckpoint(filePath, fileInfo, chunkSize, b.vaultConfig)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = &checkpointer{vaultRoot: b.vaultRoot, cp: resumeCheckpoint(b.vaultRoot, fresh)}
+		if resumed = append(resumed, checkpoints.cp.Chunks...); len(resumed) > 0 {
+			offset := checkpoints.cp.next()
+			progressMgr.PrintInfo("Resuming interrupted add at %s of %s (%d chunks already stored)\n",
+				util.HumanReadableSize(offset), util.HumanReadableSize(fileInfo.Size()), len(resumed))
+			b.dedup.ReferenceChunks(resumed)
+			reader.SkipTo(offset)
+			progressMgr.UpdateTotalProgress(offset)
+		}
+	}
+
+	store := func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+		if checkpoints == nil {
+			return b.store(b.txn, ref, data, storageHash)
+		}
+		batch, err := checkpoints.transaction()
+		if err != nil {
+			return ref, false, err
+		}
+		ref, deduplicated, err := b.store(batch, ref, data, storageHash)
+		if err != nil {
+			return ref, false, err
+		}
+		return ref, deduplicated, checkpoints.stored(ref)
+	}
+	chunkRefs, err := processChunks(ctx, reader, len(resumed), chunkSize, *b.vaultConfig, b.passphrase, workers, b.lookup, store, progressMgr)
+	if err != nil {
+		if checkpoints != nil {
+			checkpoints.abort()
+		}
+		return nil, err
+	}
+	if checkpoints != nil {
+		if err := checkpoints.finish(b.txn); err != nil {
+			return nil, err
+		}
+		chunkRefs = append(resumed, chunkRefs...)
+	}
+	return chunkRefs, nil
+}
+
+// ChunkStream chunks r as it arrives, staging new chunks in the batch's
+// transaction. sizeHint, if positive, is the expected length of the stream
+// and only sizes the progress bar. It returns the chunks along with the
+// length and content hash of the stream.
+func (b *Batch) ChunkStream(ctx context.Context, r io.Reader, sizeHint int64, chunkSize int64, workers int, progressMgr *progress.Manager) ([]config.ChunkRef, int64, string, error) {
+	if chunkSize <= 0 {
+		return nil, 0, "", fmt.Errorf("chunk size must be positive, got: %d", chunkSize)
+	}
+	hasher, err := CreateHasher(b.vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("failed to create hasher: %v", err)
+	}
+	if sizeHint <= 0 {
+		sizeHint = -1 // Unknown length
+	}
+	progressMgr.InitTotalProgress(sizeHint, "Chunking stream (txn)")
+
+	reader := &streamReader{r: io.TeeReader(r, hasher)}
+	store := func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+		return b.store(b.txn, ref, data, storageHash)
+	}
+	chunkRefs, err := processChunks(ctx, reader, 0, chunkSize, *b.vaultConfig, b.passphrase, workers, b.lookup, store, progressMgr)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	progressMgr.FinishTotalProgress()
+	return chunkRefs, reader.Offset(), fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// ChunkStored chunks a stored file of size bytes again as it is read back
+// from r, whole and with its holes as zeros, staging new chunks in the
+// batch's transaction. The holes are skipped, as when the file was added. It
+// returns the chunks along with the content hash of the stream.
+func (b *Batch) ChunkStored(ctx context.Context, r io.Reader, size int64, holes []config.HoleExtent, chunkSize int64, workers int, progressMgr *progress.Manager) ([]config.ChunkRef, string, error) {
+	if chunkSize <= 0 {
+		return nil, "", fmt.Errorf("chunk size must be positive, got: %d", chunkSize)
+	}
+	hasher, err := CreateHasher(b.vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create hasher: %v", err)
+	}
+	progressMgr.InitTotalProgress(size, "Rechunking file (txn)")
+
+	tee := io.TeeReader(r, hasher)
+	reader := &holeReader{r: tee, extents: dataExtents(holes, size)}
+	store := func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+		return b.store(b.txn, ref, data, storageHash)
+	}
+	chunkRefs, err := processChunks(ctx, reader, 0, chunkSize, *b.vaultConfig, b.passphrase, workers, b.lookup, store, progressMgr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// A trailing hole
+	trailing, err := io.Copy(io.Discard, tee)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading file: %v", err)
+	}
+	if read := reader.offset + trailing; read != size {
+		return nil, "", fmt.Errorf("read %d bytes, expected %d", read, size)
+	}
+	progressMgr.FinishTotalProgress()
+	return chunkRefs, fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// ReleaseChunks drops one reference to each of chunks, as when a file's
+// chunks are replaced. Chunk files are left for the caller to delete.
+func (b *Batch) ReleaseChunks(chunks []config.ChunkRef) {
+	b.dedup.ReleaseChunks(chunks)
+}
+
+// ReuseChunks references the stored chunks of another file for a new file
+// with the same content, so nothing is read, compressed or encrypted again.
+// Chunks staged earlier in the batch count as stored. It fails without
+// changing anything if any of the chunks is missing.
+func (b *Batch) ReuseChunks(chunks []config.ChunkRef) ([]config.ChunkRef, error) {
+	for _, ref := range chunks {
+		storageHash := ref.Hash
+		if ref.EncryptedHash != "" {
+			storageHash = ref.EncryptedHash
+		}
+		if staged, ok := b.lookup(ref.Hash); ok && staged.EncryptedHash == ref.EncryptedHash {
+			continue
+		}
+		if !fs.ChunkExists(b.vaultRoot, storageHash) {
+			return nil, fmt.Errorf("chunk %s is not stored", ref.Hash)
+		}
+	}
+	b.dedup.ReferenceChunks(chunks)
+	refs := make([]config.ChunkRef, len(chunks))
+	for i, ref := range chunks {
+		ref.Deduplicated = true
+		refs[i] = ref
+	}
+	return refs, nil
+}
@@ -0,0 +1,160 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/deduplication"
+	"github.com/substantialcattle5/sietch/internal/progress"
+)
+
+// newDedupTestVault creates a vault like newChunkTestVault that deduplicates chunks
+func newDedupTestVault(t *testing.T) string {
+	t.Helper()
+	vaultRoot := newChunkTestVault(t)
+	cfg, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Deduplication.Enabled = true
+	if err := config.SaveVaultConfig(vaultRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return vaultRoot
+}
+
+func TestBatchChunksFilesConcurrently(t *testing.T) {
+	vaultRoot := newDedupTestVault(t)
+
+	path := writeRandomFile(t, 8*1024)
+	progressMgr := progress.NewManager(progress.Options{Quiet: true})
+	txn, err := atomic.Begin(vaultRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := NewBatch(vaultRoot, "", txn, progressMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const copies = 8
+	results := make([][]config.ChunkRef, copies)
+	errs := make([]error, copies)
+	var wg sync.WaitGroup
+	for i := 0; i < copies; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = batch.ChunkFile(context.Background(), path, 1024, 2, progressMgr)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("copy %d: %v", i, err)
+		}
+	}
+	if err := batch.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every copy is split the same way, and each chunk is stored once
+	stored := 0
+	for i, refs := range results {
+		if len(refs) != len(results[0]) {
+			t.Fatalf("copy %d has %d chunks, expected %d", i, len(refs), len(results[0]))
+		}
+		for j, ref := range refs {
+			if ref.Hash != results[0][j].Hash {
+				t.Fatalf("copy %d chunk %d is %s, expected %s", i, j, ref.Hash, results[0][j].Hash)
+			}
+			if !ref.Deduplicated {
+				stored++
+			}
+		}
+	}
+	if stored != len(results[0]) {
+		t.Errorf("expected %d chunks to be stored, %d were", len(results[0]), stored)
+	}
+
+	// No file's references are lost to another's
+	index, err := deduplication.NewDeduplicationIndex(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range results[0] {
+		entry, ok := index.GetChunk(ref.Hash)
+		if !ok || entry.RefCount != copies {
+			t.Fatalf("expected chunk %s to be referenced %d times, got %+v", ref.Hash, copies, entry)
+		}
+	}
+}
+
+func TestBatchStagesRepeatedChunksOnce(t *testing.T) {
+	vaultRoot := newDedupTestVault(t)
+	block := make([]byte, 1024)
+	rand.New(rand.NewSource(2)).Read(block)
+	other := bytes.Repeat([]byte{7}, 1024)
+
+	// A block repeated within one file and across two files
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first")
+	second := filepath.Join(dir, "second")
+	if err := os.WriteFile(first, bytes.Repeat(block, 4), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, append(append([]byte{}, other...), block...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	progressMgr := progress.NewManager(progress.Options{Quiet: true})
+	txn, err := atomic.Begin(vaultRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = txn.Rollback() }()
+	batch, err := NewBatch(vaultRoot, "", txn, progressMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs []config.ChunkRef
+	for _, path := range []string{first, second} {
+		got, err := batch.ChunkFile(context.Background(), path, 1024, 1, progressMgr)
+		if err != nil {
+			t.Fatalf("ChunkFile(%s): %v", path, err)
+		}
+		refs = append(refs, got...)
+	}
+	if len(refs) != 6 {
+		t.Fatalf("expected 6 chunks, got %d", len(refs))
+	}
+
+	journals, err := atomic.Incomplete(vaultRoot)
+	if err != nil || len(journals) != 1 {
+		t.Fatalf("expected the batch's transaction, got %d (%v)", len(journals), err)
+	}
+	if staged := len(journals[0].Entries); staged != 2 {
+		t.Errorf("expected the 2 distinct chunks to be staged once each, %d were staged", staged)
+	}
+	for i, ref := range refs {
+		if fresh := i == 0 || i == 4; ref.Deduplicated == fresh {
+			t.Errorf("chunk %d: expected deduplicated to be %v", i, !fresh)
+		}
+	}
+
+	// A file identical to one chunked earlier in the batch reuses its chunks
+	reused, err := batch.ReuseChunks(refs[:4])
+	if err != nil || len(reused) != 4 {
+		t.Fatalf("expected the staged chunks to be reused, got %d (%v)", len(reused), err)
+	}
+}
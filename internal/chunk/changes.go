@@ -0,0 +1,144 @@
+package chunk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// The change index remembers the content hash of every file added from
+// outside the vault together with the size and modification time the file
+// had when it was hashed, so adding the same tree again only reads the files
+// that changed. It is a cache: a file whose size or modification time differ
+// is hashed again, and an add only skips a file when the manifest at its
+// destination still records the hash, so an index that is missing, stale or
+// unreadable costs time but never produces a wrong vault. In vaults that
+// encrypt their manifests the index is sealed the same way, since it names
+// the files added.
+
+// changeIndexFile is the change index, in .sietch
+const changeIndexFile = "change_index.json"
+
+// racyChangeWindow is how long after a file was modified its hash is kept
+// from being trusted: a write within the same timestamp tick as the stat
+// before hashing leaves the modification time unchanged
+const racyChangeWindow = 2 * time.Second
+
+// ChangeEntry is what the change index knows of one source file
+type ChangeEntry struct {
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"mtime"`
+	HashAlgorithm string    `json:"hash_algorithm,omitempty"`
+	ContentHash   string    `json:"content_hash"`
+	Destination   string    `json:"destination"` // Vault path the file was last stored at
+	HashedAt      time.Time `json:"hashed_at"`
+}
+
+// ChangeIndex is the change index of a vault, keyed by the absolute path of
+// each source file. Its methods are safe for concurrent use.
+type ChangeIndex struct {
+	path      string
+	vaultRoot string
+
+	mu      sync.Mutex
+	entries map[string]ChangeEntry
+	dirty   bool
+}
+
+// LoadChangeIndex returns the change index of the vault at vaultRoot. An
+// index that is missing or cannot be read is replaced by an empty one, so
+// every file is hashed.
+func LoadChangeIndex(vaultRoot string) *ChangeIndex {
+	c := &ChangeIndex{
+		path:      filepath.Join(vaultRoot, ".sietch", changeIndexFile),
+		vaultRoot: vaultRoot,
+		entries:   make(map[string]ChangeEntry),
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	if data, err = config.OpenMetadata(vaultRoot, data); err != nil {
+		return c
+	}
+	var entries map[string]ChangeEntry
+	if json.Unmarshal(data, &entries) == nil && entries != nil {
+		c.entries = entries
+	}
+	return c
+}
+
+// Lookup returns the entry of source if info, the file's current stat,
+// shows it unchanged since it was hashed with hashAlgorithm
+func (c *ChangeIndex) Lookup(source string, info os.FileInfo, hashAlgorithm string) (ChangeEntry, bool) {
+	key, err := filepath.Abs(source)
+	if err != nil {
+		return ChangeEntry{}, false
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || entry.Size != info.Size() || !entry.ModTime.Equal(info.ModTime()) ||
+		entry.HashAlgorithm != hashAlgorithm || entry.HashedAt.Sub(entry.ModTime) < racyChangeWindow {
+		return ChangeEntry{}, false
+	}
+	return entry, true
+}
+
+// Record remembers that source, with the stat info taken before hashing it,
+// has contentHash and was stored at destination
+func (c *ChangeIndex) Record(source string, info os.FileInfo, hashAlgorithm, contentHash, destination string) {
+	key, err := filepath.Abs(source)
+	if err != nil || contentHash == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = ChangeEntry{
+		Size:          info.Size(),
+		ModTime:       info.ModTime(),
+		HashAlgorithm: hashAlgorithm,
+		ContentHash:   contentHash,
+		Destination:   destination,
+		HashedAt:      time.Now(),
+	}
+	c.dirty = true
+}
+
+// Save writes the index if anything was recorded, dropping the entries of
+// source files that no longer exist
+func (c *ChangeIndex) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	for source := range c.entries {
+		if _, err := os.Lstat(source); os.IsNotExist(err) {
+			delete(c.entries, source)
+		}
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode change index: %w", err)
+	}
+	if data, err = config.SealMetadata(c.vaultRoot, data); err != nil {
+		return fmt.Errorf("failed to encrypt change index: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write change index: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write change index: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
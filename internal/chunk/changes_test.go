@@ -0,0 +1,72 @@
+package chunk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChangeIndexSkipsOnlyUnchangedFiles(t *testing.T) {
+	vaultRoot := newChunkTestVault(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	gone := filepath.Join(dir, "gone.txt")
+	for _, p := range []string{path, gone} {
+		if err := os.WriteFile(p, []byte("content"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stat := func(p string) os.FileInfo {
+		t.Helper()
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	changes := LoadChangeIndex(vaultRoot)
+	changes.Record(path, stat(path), "sha256", "c1", "docs/a.txt")
+	changes.Record(gone, stat(gone), "sha256", "c2", "docs/gone.txt")
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	if err := changes.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reloaded := LoadChangeIndex(vaultRoot)
+	entry, ok := reloaded.Lookup(path, stat(path), "sha256")
+	if !ok || entry.ContentHash != "c1" || entry.Destination != "docs/a.txt" {
+		t.Fatalf("expected the unchanged file to be found, got %+v, %v", entry, ok)
+	}
+	if len(reloaded.entries) != 1 {
+		t.Errorf("expected the removed source to be dropped, got %d entries", len(reloaded.entries))
+	}
+	if _, ok := reloaded.Lookup(path, stat(path), "blake3"); ok {
+		t.Error("hash from another algorithm must not be used")
+	}
+
+	// A file modified since is hashed again
+	later := time.Now().Add(-30 * time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Lookup(path, stat(path), "sha256"); ok {
+		t.Error("file with a new modification time must not be found")
+	}
+
+	// So is one hashed right after it was written, which may change again unnoticed
+	if err := os.WriteFile(path, []byte("new content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded.Record(path, stat(path), "sha256", "c3", "docs/a.txt")
+	if _, ok := reloaded.Lookup(path, stat(path), "sha256"); ok {
+		t.Error("file hashed within the racy window must not be trusted")
+	}
+}
@@ -0,0 +1,210 @@
+package chunk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// Chunking a large file is checkpointed so that an add that fails part way
+// can resume instead of starting over. Every checkpointInterval bytes the
+// chunks stored since the last checkpoint are committed in a transaction of
+// their own, together with a checkpoint listing every chunk of the file so
+// far. Chunks are content addressed, so committing them before the manifest
+// that uses them is harmless. A later add of the same unchanged file picks up
+// after the last committed chunk; the checkpoint is removed by the
+// transaction that saves the file's manifest.
+
+// checkpointInterval is how much of a file is chunked between checkpoints.
+// Files no larger than this are never checkpointed.
+var checkpointInterval int64 = 256 << 20
+
+// fileCheckpoint is the progress of chunking one file
+type fileCheckpoint struct {
+	Source        string            `json:"source"`
+	Size          int64             `json:"size"`
+	ModTime       time.Time         `json:"mtime"`
+	ChunkSize     int64             `json:"chunk_size"`
+	HashAlgorithm string            `json:"hash_algorithm,omitempty"`
+	Compression   string            `json:"compression,omitempty"`
+	Encryption    string            `json:"encryption,omitempty"`
+	Chunks        []config.ChunkRef `json:"chunks"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// checkpointPath returns the vault-relative path of the checkpoint of source
+func checkpointPath(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return filepath.ToSlash(filepath.Join(".sietch", "checkpoints", hex.EncodeToString(sum[:8])+".json"))
+}
+
+// newCheckpoint describes chunking filePath with the current vault settings
+func newCheckpoint(filePath string, info os.FileInfo, chunkSize int64, vaultConfig *config.VaultConfig) (*fileCheckpoint, error) {
+	source, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &fileCheckpoint{
+		Source:        source,
+		Size:          info.Size(),
+		ModTime:       info.ModTime().UTC(),
+		ChunkSize:     chunkSize,
+		HashAlgorithm: vaultConfig.Chunking.HashAlgorithm,
+		Compression:   vaultConfig.Compression,
+		Encryption:    vaultConfig.Encryption.Type,
+		Chunks:        []config.ChunkRef{},
+	}, nil
+}
+
+// matches reports whether other was made chunking the same, unchanged file
+// with the same settings as c
+func (c *fileCheckpoint) matches(other *fileCheckpoint) bool {
+	return c.Source == other.Source && c.Size == other.Size && c.ModTime.Equal(other.ModTime) &&
+		c.ChunkSize == other.ChunkSize && c.HashAlgorithm == other.HashAlgorithm &&
+		c.Compression == other.Compression && c.Encryption == other.Encryption
+}
+
+// next returns the file offset chunking resumes at
+func (c *fileCheckpoint) next() int64 {
+	if len(c.Chunks) == 0 {
+		return 0
+	}
+	last := c.Chunks[len(c.Chunks)-1]
+	return last.Offset + last.Size
+}
+
+// loadCheckpoint returns the checkpoint left in vaultRoot by an interrupted
+// add of filePath, or nil if there is none
+func loadCheckpoint(vaultRoot, filePath string) (*fileCheckpoint, error) {
+	source, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(vaultRoot, filepath.FromSlash(checkpointPath(source))))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	var cp fileCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %v", err)
+	}
+	return &cp, nil
+}
+
+// resumeCheckpoint returns the checkpoint to continue chunking from: the
+// stored one if it was made for the same file and all its chunks are still
+// stored, or a fresh one
+func resumeCheckpoint(vaultRoot string, fresh *fileCheckpoint) *fileCheckpoint {
+	stored, err := loadCheckpoint(vaultRoot, fresh.Source)
+	if err != nil || stored == nil || !fresh.matches(stored) {
+		return fresh
+	}
+	for _, ref := range stored.Chunks {
+		storageHash := ref.Hash
+		if ref.EncryptedHash != "" {
+			storageHash = ref.EncryptedHash
+		}
+		if !fs.ChunkExists(vaultRoot, storageHash) {
+			return fresh
+		}
+	}
+	return stored
+}
+
+// checkpointer commits the chunks of a large file in batches, each with the
+// checkpoint of everything stored so far
+type checkpointer struct {
+	vaultRoot string
+	cp        *fileCheckpoint
+	txn       *atomic.Transaction // Holds the chunks stored since the last commit
+	pending   int64               // Bytes stored since the last commit
+}
+
+// transaction returns the transaction the next chunk is staged in
+func (c *checkpointer) transaction() (*atomic.Transaction, error) {
+	if c.txn == nil {
+		txn, err := atomic.Begin(c.vaultRoot, map[string]any{"command": "add-checkpoint", "file": c.cp.Source})
+		if err != nil {
+			return nil, fmt.Errorf("begin checkpoint transaction: %w", err)
+		}
+		c.txn = txn
+	}
+	return c.txn, nil
+}
+
+// stored records a chunk staged in the current transaction, committing the
+// transaction once checkpointInterval bytes have been stored in it
+func (c *checkpointer) stored(ref config.ChunkRef) error {
+	c.cp.Chunks = append(c.cp.Chunks, ref)
+	c.pending += ref.Size
+	if c.pending < checkpointInterval {
+		return nil
+	}
+	return c.commit()
+}
+
+// commit commits the chunks staged since the last checkpoint along with a
+// new checkpoint
+func (c *checkpointer) commit() error {
+	txn, err := c.transaction()
+	if err != nil {
+		return err
+	}
+	c.cp.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(c.cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	rel := checkpointPath(c.cp.Source)
+	stage := txn.StageCreate
+	if _, err := os.Stat(filepath.Join(c.vaultRoot, filepath.FromSlash(rel))); err == nil {
+		stage = txn.StageReplace
+	}
+	w, err := stage(rel)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	c.txn = nil
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("commit checkpoint: %w", err)
+	}
+	c.pending = 0
+	return nil
+}
+
+// abort drops the chunks staged since the last checkpoint
+func (c *checkpointer) abort() {
+	if c.txn != nil {
+		_ = c.txn.Rollback()
+		c.txn = nil
+	}
+}
+
+// finish commits the last chunks of the file and stages the removal of its
+// checkpoint in txn, the transaction that saves the file's manifest
+func (c *checkpointer) finish(txn *atomic.Transaction) error {
+	if c.txn != nil {
+		if err := c.commit(); err != nil {
+			return err
+		}
+	}
+	return txn.StageDelete(checkpointPath(c.cp.Source))
+}
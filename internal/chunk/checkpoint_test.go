@@ -0,0 +1,88 @@
+package chunk
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/progress"
+)
+
+// newChunkTestVault creates an unencrypted, uncompressed vault
+func newChunkTestVault(t *testing.T) string {
+	t.Helper()
+	vaultRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch", "chunks"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.VaultConfig{Name: "test", SchemaVersion: config.CurrentSchemaVersion, Compression: "none"}
+	cfg.Encryption.Type = "none"
+	if err := config.SaveVaultConfig(vaultRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return vaultRoot
+}
+
+func TestChunkFileTransactionalResumesFromCheckpoint(t *testing.T) {
+	defer func(interval int64) { checkpointInterval = interval }(checkpointInterval)
+	checkpointInterval = 4 * 1024
+
+	vaultRoot := newChunkTestVault(t)
+	path := writeRandomFile(t, 20*1024+17)
+	progressMgr := progress.NewManager(progress.Options{Quiet: true})
+
+	chunkFile := func() ([]config.ChunkRef, *atomic.Transaction) {
+		t.Helper()
+		txn, err := atomic.Begin(vaultRoot, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs, err := ChunkFileTransactional(context.Background(), path, 1024, vaultRoot, "", 2, progressMgr, txn)
+		if err != nil {
+			t.Fatalf("ChunkFileTransactional: %v", err)
+		}
+		return refs, txn
+	}
+
+	// The manifest never committed, so the checkpoint of the whole file stays
+	want, txn := chunkFile()
+	if len(want) != 21 {
+		t.Fatalf("expected 21 chunks, got %d", len(want))
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := loadCheckpoint(vaultRoot, path)
+	if err != nil || cp == nil || len(cp.Chunks) != len(want) {
+		t.Fatalf("expected a checkpoint of every chunk, got %+v (%v)", cp, err)
+	}
+
+	// Pretend the add was interrupted after the first checkpoint, marking a
+	// checkpointed chunk to tell it was not chunked again
+	cp.Chunks = cp.Chunks[:4]
+	cp.Chunks[0].CompressionType = "from-checkpoint"
+	want[0].CompressionType = "from-checkpoint"
+	data, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultRoot, filepath.FromSlash(checkpointPath(cp.Source))), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, txn := chunkFile()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("a resumed add must produce the same chunks\ngot  %+v\nwant %+v", got, want)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err := loadCheckpoint(vaultRoot, path); err != nil || cp != nil {
+		t.Fatalf("expected the checkpoint to be removed with the manifest commit, got %+v (%v)", cp, err)
+	}
+}
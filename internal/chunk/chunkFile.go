@@ -1,23 +1,16 @@
 package chunk
 
 import (
-	// #nosec G401
-
 	"context"
-	"encoding/base64"
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/substantialcattle5/sietch/internal/atomic"
-	"github.com/substantialcattle5/sietch/internal/compression"
 	"github.com/substantialcattle5/sietch/internal/config"
 	"github.com/substantialcattle5/sietch/internal/constants"
 	"github.com/substantialcattle5/sietch/internal/deduplication"
-	"github.com/substantialcattle5/sietch/internal/encryption"
 	"github.com/substantialcattle5/sietch/internal/fs"
 	"github.com/substantialcattle5/sietch/internal/progress"
-	"github.com/substantialcattle5/sietch/util"
 )
 
 const (
@@ -25,7 +18,9 @@ const (
 	HashDisplayLength = 12 // Length of hash to display in logs
 )
 
-func ChunkFile(ctx context.Context, filePath string, chunkSize int64, vaultRoot string, passphrase string, progressMgr *progress.Manager) ([]config.ChunkRef, error) {
+// ChunkFile splits the file into chunks and stores them in the vault, processing
+// chunks with workers parallel workers (DefaultWorkers if zero or less)
+func ChunkFile(ctx context.Context, filePath string, chunkSize int64, vaultRoot string, passphrase string, workers int, progressMgr *progress.Manager) ([]config.ChunkRef, error) {
 	// Validate input parameters
 	if chunkSize <= 0 {
 		return nil, fmt.Errorf("chunk size must be positive, got: %d", chunkSize)
@@ -53,7 +48,10 @@ func ChunkFile(ctx context.Context, filePath string, chunkSize int64, vaultRoot
 		return nil, fmt.Errorf("failed to load vault configuration: %v", err)
 	}
 
-	// Ensure chunks directory exists
+	// Ensure chunks directory exists, unless it is on a disk that is missing
+	if err := fs.CheckChunkStore(vaultRoot); err != nil {
+		return nil, err
+	}
 	chunksDir := fs.GetChunkDirectory(vaultRoot)
 	if err := os.MkdirAll(chunksDir, constants.StandardDirPerms); err != nil {
 		return nil, fmt.Errorf("failed to create chunks directory: %v", err)
@@ -73,7 +71,13 @@ func ChunkFile(ctx context.Context, filePath string, chunkSize int64, vaultRoot
 	// Set progress manager for coordinated output
 	dedupManager.SetProgressManager(progressMgr)
 
-	chunkRefs, err := processFileChunks(ctx, file, chunkSize, *vaultConfig, passphrase, dedupManager, progressMgr)
+	// Only read data extents so holes in sparse files are skipped
+	reader, err := newExtentReader(file, fileSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map file extents: %v", err)
+	}
+
+	chunkRefs, err := processChunks(ctx, reader, 0, chunkSize, *vaultConfig, passphrase, workers, nil, dedupManager.ProcessChunk, progressMgr)
 	if err != nil {
 		return nil, err
 	}
@@ -90,247 +94,17 @@ func ChunkFile(ctx context.Context, filePath string, chunkSize int64, vaultRoot
 }
 
 // ChunkFileTransactional performs the same chunking but writes new chunk content through the provided transaction.
-func ChunkFileTransactional(ctx context.Context, filePath string, chunkSize int64, vaultRoot string, passphrase string, progressMgr *progress.Manager, txn *atomic.Transaction) ([]config.ChunkRef, error) {
-	if txn == nil {
-		return nil, fmt.Errorf("transaction required")
-	}
-	if chunkSize <= 0 {
-		return nil, fmt.Errorf("chunk size must be positive, got: %d", chunkSize)
-	}
-	file, err := fs.VerifyFileAndReturnFile(filePath)
+func ChunkFileTransactional(ctx context.Context, filePath string, chunkSize int64, vaultRoot string, passphrase string, workers int, progressMgr *progress.Manager, txn *atomic.Transaction) ([]config.ChunkRef, error) {
+	batch, err := NewBatch(vaultRoot, passphrase, txn, progressMgr)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %v", err)
-	}
-	progressMgr.InitTotalProgress(fileInfo.Size(), "Chunking file (txn)")
-	vaultConfig, err := config.LoadVaultConfig(vaultRoot)
+	chunkRefs, err := batch.ChunkFile(ctx, filePath, chunkSize, workers, progressMgr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load vault configuration: %v", err)
-	}
-	if vaultConfig.Encryption.Type == constants.EncryptionTypeAES && vaultConfig.Encryption.PassphraseProtected && passphrase == "" {
-		return nil, fmt.Errorf("passphrase required for encrypted vault but not provided")
-	}
-	dedupManager, err := deduplication.NewManager(vaultRoot, vaultConfig.Deduplication)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize deduplication manager: %v", err)
-	}
-	dedupManager.SetProgressManager(progressMgr)
-	buffer := make([]byte, chunkSize)
-	var chunkRefs []config.ChunkRef
-	chunkCount := 0
-	totalBytes := int64(0)
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("operation cancelled")
-		default:
-		}
-		bytesRead, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, fmt.Errorf("error reading file: %v", err)
-		}
-		if bytesRead == 0 {
-			break
-		}
-		chunkCount++
-		totalBytes += int64(bytesRead)
-		progressMgr.UpdateTotalProgress(int64(bytesRead))
-		hasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create hasher for chunk %d: %v", chunkCount, err)
-		}
-		hasher.Write(buffer[:bytesRead])
-		chunkHash := fmt.Sprintf("%x", hasher.Sum(nil))
-		compressedData, err := compression.CompressData(buffer[:bytesRead], vaultConfig.Compression)
-		if err != nil {
-			return nil, fmt.Errorf("failed to compress chunk %d: %v", chunkCount, err)
-		}
-		chunkRef := config.ChunkRef{Hash: chunkHash, Size: int64(bytesRead), CompressedSize: int64(len(compressedData)), Index: chunkCount - 1, Compressed: vaultConfig.Compression != "none", CompressionType: vaultConfig.Compression}
-		chunkDataToProcess := compressedData
-		if vaultConfig.Encryption.Type != "" && vaultConfig.Encryption.Type != "none" {
-			encoded := base64.StdEncoding.EncodeToString(chunkDataToProcess)
-			var encryptedData string
-			if vaultConfig.Encryption.PassphraseProtected {
-				encryptedData, err = encryption.EncryptDataWithPassphrase(encoded, *vaultConfig, passphrase)
-			} else {
-				encryptedData, err = encryption.EncryptData(encoded, *vaultConfig)
-			}
-			if err != nil {
-				return nil, fmt.Errorf("failed to encrypt chunk %d: %v", chunkCount, err)
-			}
-			encHasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create encrypted hasher: %v", err)
-			}
-			encHasher.Write([]byte(encryptedData))
-			encryptedHash := fmt.Sprintf("%x", encHasher.Sum(nil))
-			chunkRef.EncryptedHash = encryptedHash
-			chunkRef.EncryptedSize = int64(len(encryptedData))
-			updated, deduped, err := dedupManager.ProcessChunkTransactional(txn, chunkRef, []byte(encryptedData), encryptedHash)
-			if err != nil {
-				return nil, fmt.Errorf("dedup (enc) failed chunk %d: %v", chunkCount, err)
-			}
-			chunkRef = updated
-			progressMgr.PrintVerbose("%s", FormatChunkInfoString(chunkCount, bytesRead, chunkHash, *vaultConfig, chunkDataToProcess, deduped, true))
-		} else {
-			updated, deduped, err := dedupManager.ProcessChunkTransactional(txn, chunkRef, chunkDataToProcess, chunkHash)
-			if err != nil {
-				return nil, fmt.Errorf("dedup failed chunk %d: %v", chunkCount, err)
-			}
-			chunkRef = updated
-			progressMgr.PrintVerbose("%s", FormatChunkInfoString(chunkCount, bytesRead, chunkHash, *vaultConfig, chunkDataToProcess, deduped, false))
-		}
-		chunkRefs = append(chunkRefs, chunkRef)
-		if err == io.EOF {
-			break
-		}
-	}
-	progressMgr.PrintInfo("Total chunks processed: %d\n", chunkCount)
-	progressMgr.PrintInfo("Total bytes processed: %s\n", util.HumanReadableSize(totalBytes))
-	if err := dedupManager.Save(); err != nil {
-		return nil, fmt.Errorf("failed to save deduplication index: %v", err)
+		return nil, err
 	}
-	return chunkRefs, nil
-}
-
-// Helper to avoid import cycle (re-expose functions we reused inside transactional variant)
-// Reuse existing exported helpers from this package itself (already defined above for regular flow)
-
-func processFileChunks(ctx context.Context, file *os.File, chunkSize int64, vaultConfig config.VaultConfig, passphrase string, dedupManager *deduplication.Manager, progressMgr *progress.Manager) ([]config.ChunkRef, error) {
-	// Create a buffer for reading chunks
-	buffer := make([]byte, chunkSize)
-	chunkCount := 0
-	totalBytes := int64(0)
-	chunkRefs := []config.ChunkRef{}
-
-	// Read the file in chunks
-	for {
-		// Check for cancellation
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("operation cancelled")
-		default:
-		}
-
-		bytesRead, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, fmt.Errorf("error reading file: %v", err)
-		}
-
-		if bytesRead == 0 {
-			// End of file
-			break
-		}
-
-		chunkCount++
-		totalBytes += int64(bytesRead)
-
-		// Update progress bars
-		progressMgr.UpdateTotalProgress(int64(bytesRead))
-
-		// Calculate chunk hash (pre-encryption) using configured algorithm
-		hasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create hasher for chunk %d (algorithm: %s): %v", chunkCount, vaultConfig.Chunking.HashAlgorithm, err)
-		}
-		hasher.Write(buffer[:bytesRead])
-		chunkHash := fmt.Sprintf("%x", hasher.Sum(nil))
-
-		// Store original chunk data for processing
-		originalChunkData := buffer[:bytesRead]
-
-		// Apply compression if configured
-		compressedData, err := compression.CompressData(originalChunkData, vaultConfig.Compression)
-		if err != nil {
-			return nil, fmt.Errorf("failed to compress chunk %d (size: %d bytes, algorithm: %s): %v", chunkCount, bytesRead, vaultConfig.Compression, err)
-		}
-
-		// Create chunk reference
-		chunkRef := config.ChunkRef{
-			Hash:            chunkHash,
-			Size:            int64(bytesRead),
-			CompressedSize:  int64(len(compressedData)),
-			Index:           chunkCount - 1, // Convert 1-based chunkCount to 0-based index
-			Compressed:      vaultConfig.Compression != "none",
-			CompressionType: vaultConfig.Compression,
-		}
-
-		// Use compressed data for further processing
-		chunkDataToProcess := compressedData
-
-		// Encrypt the chunk if encryption is enabled
-		if vaultConfig.Encryption.Type != "" && vaultConfig.Encryption.Type != "none" {
-			// Encode binary data to base64 string for safe encryption (use compressed data)
-			chunkData := base64.StdEncoding.EncodeToString(chunkDataToProcess)
-
-			var encryptedData string
-			var encryptErr error
-
-			// Choose encryption method based on passphrase protection
-			if vaultConfig.Encryption.PassphraseProtected {
-				encryptedData, encryptErr = encryption.EncryptDataWithPassphrase(
-					chunkData,
-					vaultConfig,
-					passphrase,
-				)
-			} else {
-				encryptedData, encryptErr = encryption.EncryptData(
-					chunkData,
-					vaultConfig,
-				)
-			}
-
-			if encryptErr != nil {
-				return nil, fmt.Errorf("failed to encrypt chunk %d (size: %d bytes, type: %s): %v", chunkCount, len(chunkDataToProcess), vaultConfig.Encryption.Type, encryptErr)
-			}
-
-			// Calculate hash of encrypted data for storage filename using configured algorithm
-			encHasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create encrypted hasher for chunk %d (algorithm: %s): %v", chunkCount, vaultConfig.Chunking.HashAlgorithm, err)
-			}
-			encHasher.Write([]byte(encryptedData))
-			encryptedHash := fmt.Sprintf("%x", encHasher.Sum(nil))
-
-			// Update chunk reference with encryption info
-			chunkRef.EncryptedHash = encryptedHash
-			chunkRef.EncryptedSize = int64(len(encryptedData))
-
-			// Process chunk with deduplication manager
-			updatedChunkRef, deduplicated, err := dedupManager.ProcessChunk(chunkRef, []byte(encryptedData), encryptedHash)
-			if err != nil {
-				return nil, fmt.Errorf("failed to process chunk %d with deduplication (encrypted, hash: %s): %v", chunkCount, encryptedHash[:HashDisplayLength], err)
-			}
-			chunkRef = updatedChunkRef
-
-			// Display chunk information using helper function
-			progressMgr.PrintVerbose("%s", FormatChunkInfoString(chunkCount, bytesRead, chunkHash, vaultConfig, chunkDataToProcess, deduplicated, true))
-		} else {
-			// If no encryption, process chunk with deduplication manager
-			updatedChunkRef, deduplicated, err := dedupManager.ProcessChunk(chunkRef, chunkDataToProcess, chunkHash)
-			if err != nil {
-				return nil, fmt.Errorf("failed to process chunk %d with deduplication (unencrypted, hash: %s): %v", chunkCount, chunkHash[:HashDisplayLength], err)
-			}
-			chunkRef = updatedChunkRef
-
-			// Display chunk information using helper function
-			progressMgr.PrintVerbose("%s", FormatChunkInfoString(chunkCount, bytesRead, chunkHash, vaultConfig, chunkDataToProcess, deduplicated, false))
-		}
-
-		// Add the chunk reference to our list
-		chunkRefs = append(chunkRefs, chunkRef)
-
-		if err == io.EOF {
-			break
-		}
+	if err := batch.Save(); err != nil {
+		return nil, err
 	}
-
-	progressMgr.PrintInfo("Total chunks processed: %d\n", chunkCount)
-	progressMgr.PrintInfo("Total bytes processed: %s\n", util.HumanReadableSize(totalBytes))
-
 	return chunkRefs, nil
 }
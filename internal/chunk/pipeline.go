@@ -0,0 +1,317 @@
+package chunk
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/progress"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// Files are chunked by a pipeline: one goroutine reads chunks in order, a pool
+// of workers hashes, compresses and encrypts them in parallel, and the calling
+// goroutine stores the results strictly in chunk order. Storing in order keeps
+// the deduplication index and the manifest identical to a serial run, whatever
+// the number of workers.
+
+// chunkStore stores a processed chunk under storageHash and returns its final
+// reference and whether an identical chunk was already stored
+type chunkStore func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error)
+
+// chunkLookup returns the stored reference of an earlier chunk with hash,
+// if a chunk with that content needs no storing again
+type chunkLookup func(hash string) (config.ChunkRef, bool)
+
+// chunkReader reads the data to chunk, one chunk at most per Read
+type chunkReader interface {
+	io.Reader
+	// Offset returns the file offset the next Read starts at
+	Offset() int64
+}
+
+// chunkJob is a chunk read from the file, waiting to be processed
+type chunkJob struct {
+	index  int
+	offset int64
+	data   []byte
+	err    error
+}
+
+// chunkResult is a processed chunk, ready to be stored
+type chunkResult struct {
+	index       int
+	ref         config.ChunkRef
+	compressed  []byte
+	stored      []byte
+	storageHash string
+	encrypted   bool
+	duplicate   bool // Found by lookup, so neither compressed nor encrypted
+	err         error
+}
+
+// DefaultWorkers returns the number of chunk workers used when none is configured
+func DefaultWorkers() int {
+	return runtime.NumCPU()
+}
+
+// processChunks chunks the file read by reader with workers parallel workers,
+// calling store for every chunk in order. Chunks are numbered from firstIndex,
+// which is not zero when resuming a file. Workers of zero or less use DefaultWorkers.
+// Chunks lookup finds, if it is not nil, are passed to store as they were
+// stored before, with no data.
+func processChunks(ctx context.Context, reader chunkReader, firstIndex int, chunkSize int64, vaultConfig config.VaultConfig, passphrase string, workers int, lookup chunkLookup, store chunkStore, progressMgr *progress.Manager) ([]config.ChunkRef, error) {
+	if workers <= 0 {
+		workers = DefaultWorkers()
+	}
+
+	pipelineCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan chunkJob, workers)
+	results := make(chan chunkResult, workers)
+	// Every chunk takes a slot from being read until it is stored, which bounds
+	// memory use to a few chunks per worker however far ahead the reader gets
+	slots := make(chan struct{}, 2*workers)
+
+	go readChunks(pipelineCtx, reader, firstIndex, chunkSize, jobs, slots)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				result := processChunk(job, vaultConfig, passphrase, lookup)
+				select {
+				case results <- result:
+				case <-pipelineCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// fail stops the pipeline and waits for its goroutines to exit
+	fail := func(err error) ([]config.ChunkRef, error) {
+		cancel()
+		for range results {
+		}
+		return nil, err
+	}
+
+	chunkRefs := []config.ChunkRef{}
+	totalBytes := int64(0)
+	pending := make(map[int]chunkResult)
+	next := firstIndex
+	for result := range results {
+		pending[result.index] = result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if r.err != nil {
+				return fail(r.err)
+			}
+
+			ref, deduplicated, err := store(r.ref, r.stored, r.storageHash)
+			if err != nil {
+				return fail(fmt.Errorf("failed to process chunk %d with deduplication (hash: %s): %v", next+1, r.storageHash[:HashDisplayLength], err))
+			}
+			chunkRefs = append(chunkRefs, ref)
+			totalBytes += r.ref.Size
+
+			progressMgr.UpdateTotalProgress(r.ref.Size)
+			if r.duplicate {
+				progressMgr.PrintVerbose("Chunk %d: %s bytes, hash: %s [duplicate, not processed again]\n",
+					next+1, util.HumanReadableSize(r.ref.Size), r.ref.Hash[:HashDisplayLength])
+			} else {
+				progressMgr.PrintVerbose("%s", FormatChunkInfoString(next+1, int(r.ref.Size), r.ref.Hash, vaultConfig, r.compressed, deduplicated, r.encrypted))
+			}
+
+			next++
+			<-slots
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("operation cancelled")
+	}
+
+	progressMgr.PrintInfo("Total chunks processed: %d\n", len(chunkRefs))
+	progressMgr.PrintInfo("Total bytes processed: %s\n", util.HumanReadableSize(totalBytes))
+
+	return chunkRefs, nil
+}
+
+// readChunks reads the file one chunk at a time and queues the chunks in order,
+// numbering them from firstIndex. A read error is queued as a job of its own
+// and ends reading.
+func readChunks(ctx context.Context, reader chunkReader, firstIndex int, chunkSize int64, jobs chan<- chunkJob, slots chan<- struct{}) {
+	defer close(jobs)
+
+	for index := firstIndex; ; index++ {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		job := chunkJob{index: index, offset: reader.Offset()}
+		buffer := make([]byte, chunkSize)
+		bytesRead, err := reader.Read(buffer)
+		if err != nil && err != io.EOF {
+			job.err = fmt.Errorf("error reading file: %v", err)
+		} else if bytesRead == 0 {
+			return
+		}
+		job.data = buffer[:bytesRead]
+
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			return
+		}
+		if job.err != nil || err == io.EOF {
+			return
+		}
+	}
+}
+
+// processChunk hashes, compresses and, if the vault is encrypted, encrypts one
+// chunk. A chunk lookup finds is only hashed.
+func processChunk(job chunkJob, vaultConfig config.VaultConfig, passphrase string, lookup chunkLookup) chunkResult {
+	result := chunkResult{index: job.index}
+	if job.err != nil {
+		result.err = job.err
+		return result
+	}
+	chunkNumber := job.index + 1
+
+	// Calculate chunk hash (pre-encryption) using configured algorithm
+	hasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		result.err = fmt.Errorf("failed to create hasher for chunk %d (algorithm: %s): %v", chunkNumber, vaultConfig.Chunking.HashAlgorithm, err)
+		return result
+	}
+	hasher.Write(job.data)
+	chunkHash := fmt.Sprintf("%x", hasher.Sum(nil))
+
+	if lookup != nil {
+		if ref, ok := lookup(chunkHash); ok && ref.Size == int64(len(job.data)) {
+			ref.Index = job.index
+			ref.Offset = job.offset
+			ref.Deduplicated = true
+			result.ref = ref
+			result.storageHash = ref.Hash
+			if ref.EncryptedHash != "" {
+				result.storageHash = ref.EncryptedHash
+			}
+			result.duplicate = true
+			return result
+		}
+	}
+
+	return encodeChunk(job, chunkHash, vaultConfig, passphrase, nil)
+}
+
+// EncodeChunk compresses data as the vault configures and, if the vault is
+// encrypted, encrypts it. It returns the reference of the chunk, without its
+// position in a file, and the bytes to store under StorageName of it.
+func EncodeChunk(data []byte, vaultConfig config.VaultConfig, passphrase string) (config.ChunkRef, []byte, error) {
+	return encodeChunkData(data, vaultConfig, passphrase, nil)
+}
+
+// EncodeChunkWithKey is like EncodeChunk but encrypts with key, a vault key
+// for the encryption settings of vaultConfig, instead of loading the key
+// from the vault's key file
+func EncodeChunkWithKey(data []byte, vaultConfig config.VaultConfig, key []byte) (config.ChunkRef, []byte, error) {
+	return encodeChunkData(data, vaultConfig, "", key)
+}
+
+func encodeChunkData(data []byte, vaultConfig config.VaultConfig, passphrase string, key []byte) (config.ChunkRef, []byte, error) {
+	hasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		return config.ChunkRef{}, nil, fmt.Errorf("failed to create hasher (algorithm: %s): %v", vaultConfig.Chunking.HashAlgorithm, err)
+	}
+	hasher.Write(data)
+	result := encodeChunk(chunkJob{data: data}, fmt.Sprintf("%x", hasher.Sum(nil)), vaultConfig, passphrase, key)
+	return result.ref, result.stored, result.err
+}
+
+// encodeChunk compresses and, if the vault is encrypted, encrypts the chunk
+// of job, whose content hashes to chunkHash. A non-nil key is used in place
+// of the vault's key file.
+func encodeChunk(job chunkJob, chunkHash string, vaultConfig config.VaultConfig, passphrase string, key []byte) chunkResult {
+	result := chunkResult{index: job.index}
+	chunkNumber := job.index + 1
+
+	// Apply compression if configured
+	compressedData, err := compression.CompressData(job.data, vaultConfig.Compression)
+	if err != nil {
+		result.err = fmt.Errorf("failed to compress chunk %d (size: %d bytes, algorithm: %s): %v", chunkNumber, len(job.data), vaultConfig.Compression, err)
+		return result
+	}
+
+	result.ref = config.ChunkRef{
+		Hash:            chunkHash,
+		Size:            int64(len(job.data)),
+		CompressedSize:  int64(len(compressedData)),
+		Index:           job.index,
+		Offset:          job.offset,
+		Compressed:      vaultConfig.Compression != "none",
+		CompressionType: vaultConfig.Compression,
+	}
+	result.compressed = compressedData
+
+	if vaultConfig.Encryption.Type == "" || vaultConfig.Encryption.Type == "none" {
+		result.stored = compressedData
+		result.storageHash = chunkHash
+		return result
+	}
+
+	// Encode binary data to base64 string for safe encryption (use compressed data)
+	chunkData := base64.StdEncoding.EncodeToString(compressedData)
+
+	// Choose encryption method based on passphrase protection
+	var encryptedData string
+	if key != nil {
+		encryptedData, err = encryption.EncryptWithKey(chunkData, key, vaultConfig.Encryption)
+	} else if vaultConfig.Encryption.PassphraseProtected {
+		encryptedData, err = encryption.EncryptDataWithPassphrase(chunkData, vaultConfig, passphrase)
+	} else {
+		encryptedData, err = encryption.EncryptData(chunkData, vaultConfig)
+	}
+	if err != nil {
+		result.err = fmt.Errorf("failed to encrypt chunk %d (size: %d bytes, type: %s): %v", chunkNumber, len(compressedData), vaultConfig.Encryption.Type, err)
+		return result
+	}
+
+	// Calculate hash of encrypted data for storage filename using configured algorithm
+	encHasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		result.err = fmt.Errorf("failed to create encrypted hasher for chunk %d (algorithm: %s): %v", chunkNumber, vaultConfig.Chunking.HashAlgorithm, err)
+		return result
+	}
+	encHasher.Write([]byte(encryptedData))
+	encryptedHash := fmt.Sprintf("%x", encHasher.Sum(nil))
+
+	result.ref.EncryptedHash = encryptedHash
+	result.ref.EncryptedSize = int64(len(encryptedData))
+	result.stored = []byte(encryptedData)
+	result.storageHash = encryptedHash
+	result.encrypted = true
+	return result
+}
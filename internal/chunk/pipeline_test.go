@@ -0,0 +1,196 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption"
+	"github.com/substantialcattle5/sietch/internal/progress"
+)
+
+// runPipeline chunks path in 1KB chunks with the given number of workers
+func runPipeline(t *testing.T, path string, workers int, store chunkStore) ([]config.ChunkRef, error) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := newExtentReader(file, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vaultConfig := config.VaultConfig{Compression: constants.CompressionTypeGzip}
+	progressMgr := progress.NewManager(progress.Options{Quiet: true})
+	return processChunks(context.Background(), reader, 0, 1024, vaultConfig, "", workers, nil, store, progressMgr)
+}
+
+func writeRandomFile(t *testing.T, size int) string {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProcessChunksOrderIndependentOfWorkers(t *testing.T) {
+	path := writeRandomFile(t, 100*1024+17)
+
+	var want []config.ChunkRef
+	var wantStored []string
+	for _, workers := range []int{1, 2, 8, 32} {
+		var stored []string
+		store := func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+			stored = append(stored, storageHash)
+			return ref, false, nil
+		}
+		refs, err := runPipeline(t, path, workers, store)
+		if err != nil {
+			t.Fatalf("workers=%d: %v", workers, err)
+		}
+		if len(refs) != 101 {
+			t.Fatalf("workers=%d: expected 101 chunks, got %d", workers, len(refs))
+		}
+		for i, ref := range refs {
+			if ref.Index != i || ref.Offset != int64(i*1024) {
+				t.Fatalf("workers=%d: chunk %d has index %d and offset %d", workers, i, ref.Index, ref.Offset)
+			}
+		}
+
+		if want == nil {
+			want, wantStored = refs, stored
+			continue
+		}
+		if !reflect.DeepEqual(refs, want) || !reflect.DeepEqual(stored, wantStored) {
+			t.Errorf("workers=%d: chunks differ from a single worker run", workers)
+		}
+	}
+}
+
+func TestProcessChunksStopsAtFirstStoreError(t *testing.T) {
+	path := writeRandomFile(t, 64*1024)
+
+	stored := 0
+	store := func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+		if ref.Index == 10 {
+			return ref, false, errors.New("disk full")
+		}
+		stored++
+		return ref, false, nil
+	}
+	refs, err := runPipeline(t, path, 4, store)
+	if err == nil || !strings.Contains(err.Error(), "chunk 11") || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("expected error for chunk 11, got %v", err)
+	}
+	if refs != nil || stored != 10 {
+		t.Errorf("expected the 10 chunks before the failure to be stored and no result, got %d stored and %d refs", stored, len(refs))
+	}
+}
+
+func TestProcessChunksSkipsKnownChunks(t *testing.T) {
+	path := writeRandomFile(t, 4*1024)
+	var known config.ChunkRef
+	var storedData [][]byte
+	store := func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+		storedData = append(storedData, data)
+		return ref, false, nil
+	}
+	refs, err := runPipeline(t, path, 2, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known = refs[2]
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := newExtentReader(file, 4*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(hash string) (config.ChunkRef, bool) {
+		return known, hash == known.Hash
+	}
+	storedData = nil
+	vaultConfig := config.VaultConfig{Compression: constants.CompressionTypeGzip}
+	got, err := processChunks(context.Background(), reader, 0, 1024, vaultConfig, "", 2, lookup, store, progress.NewManager(progress.Options{Quiet: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storedData[2] != nil || storedData[1] == nil {
+		t.Errorf("expected only the known chunk to be passed without data")
+	}
+	if got[2].Index != 2 || got[2].Offset != 2048 || !got[2].Deduplicated || got[2].CompressedSize != known.CompressedSize {
+		t.Errorf("expected the known chunk's reference at its own position, got %+v", got[2])
+	}
+}
+
+func TestEncodeChunkMatchesPipeline(t *testing.T) {
+	path := writeRandomFile(t, 1024)
+	var stored [][]byte
+	refs, err := runPipeline(t, path, 1, func(ref config.ChunkRef, data []byte, storageHash string) (config.ChunkRef, bool, error) {
+		stored = append(stored, data)
+		return ref, false, nil
+	})
+	if err != nil || len(refs) != 1 {
+		t.Fatalf("expected one chunk, got %d (%v)", len(refs), err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, encoded, err := EncodeChunk(data, config.VaultConfig{Compression: constants.CompressionTypeGzip}, "")
+	if err != nil {
+		t.Fatalf("EncodeChunk: %v", err)
+	}
+	if !reflect.DeepEqual(ref, refs[0]) || !reflect.DeepEqual(encoded, stored[0]) {
+		t.Errorf("expected EncodeChunk to encode like the pipeline\ngot  %+v\nwant %+v", ref, refs[0])
+	}
+}
+
+func TestEncodeChunkWithKey(t *testing.T) {
+	data := bytes.Repeat([]byte("sietch"), 100)
+	key := bytes.Repeat([]byte{7}, 32)
+	vaultConfig := config.VaultConfig{
+		Compression: constants.CompressionTypeNone,
+		Encryption:  config.EncryptionConfig{Type: constants.EncryptionTypeChaCha20, PassphraseProtected: true},
+	}
+
+	ref, stored, err := EncodeChunkWithKey(data, vaultConfig, key)
+	if err != nil {
+		t.Fatalf("EncodeChunkWithKey: %v", err)
+	}
+	if ref.EncryptedHash == "" || StorageName(ref) != ref.EncryptedHash || ref.EncryptedSize != int64(len(stored)) {
+		t.Errorf("expected an encrypted reference matching the stored bytes, got %+v", ref)
+	}
+
+	decrypted, err := encryption.DecryptWithKey(string(stored), key, vaultConfig.Encryption)
+	if err != nil {
+		t.Fatalf("DecryptWithKey: %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(decrypted)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("expected the chunk to decrypt to its data with key (%v)", err)
+	}
+}
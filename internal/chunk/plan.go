@@ -0,0 +1,98 @@
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// PlanFile computes the chunk boundaries and plaintext hashes ChunkFile would
+// produce for filePath, without compressing, encrypting or storing anything.
+// The returned refs only carry Hash, Size, Index and Offset.
+func PlanFile(ctx context.Context, filePath string, chunkSize int64, hashAlgorithm string) ([]config.ChunkRef, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got: %d", chunkSize)
+	}
+	file, err := fs.VerifyFileAndReturnFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %v", err)
+	}
+	reader, err := newExtentReader(file, fileInfo.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to map file extents: %v", err)
+	}
+
+	buffer := make([]byte, chunkSize)
+	var chunkRefs []config.ChunkRef
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("operation cancelled")
+		default:
+		}
+
+		offset := reader.Offset()
+		bytesRead, err := reader.Read(buffer)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading file: %v", err)
+		}
+		if bytesRead == 0 {
+			break
+		}
+
+		hasher, err := CreateHasher(hashAlgorithm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create hasher for chunk %d: %v", len(chunkRefs)+1, err)
+		}
+		hasher.Write(buffer[:bytesRead])
+		chunkRefs = append(chunkRefs, config.ChunkRef{
+			Hash:   fmt.Sprintf("%x", hasher.Sum(nil)),
+			Size:   int64(bytesRead),
+			Index:  len(chunkRefs),
+			Offset: offset,
+		})
+	}
+	return chunkRefs, nil
+}
+
+// HashFile returns the hash of the whole content of filePath, the
+// ContentHash recorded in its manifest. Holes read as zeros, so a sparse
+// file hashes the same as its dense copy.
+func HashFile(ctx context.Context, filePath string, hashAlgorithm string) (string, error) {
+	file, err := fs.VerifyFileAndReturnFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher, err := CreateHasher(hashAlgorithm)
+	if err != nil {
+		return "", fmt.Errorf("failed to create hasher: %v", err)
+	}
+	buffer := make([]byte, 1<<20)
+	for {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("operation cancelled")
+		default:
+		}
+		n, err := file.Read(buffer)
+		hasher.Write(buffer[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error reading file: %v", err)
+		}
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
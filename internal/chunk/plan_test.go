@@ -0,0 +1,73 @@
+package chunk
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanFile(t *testing.T) {
+	content := strings.Repeat("a", 10) + strings.Repeat("b", 10) + "c"
+	path := filepath.Join(t.TempDir(), "plan.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	refs, err := PlanFile(context.Background(), path, 10, "sha256")
+	if err != nil {
+		t.Fatalf("PlanFile: %v", err)
+	}
+	if len(refs) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(refs))
+	}
+
+	for i, want := range []string{content[:10], content[10:20], content[20:]} {
+		ref := refs[i]
+		if ref.Index != i || ref.Offset != int64(i*10) || ref.Size != int64(len(want)) {
+			t.Errorf("chunk %d has unexpected layout: %+v", i, ref)
+		}
+		if ref.Hash != fmt.Sprintf("%x", sha256.Sum256([]byte(want))) {
+			t.Errorf("chunk %d hash mismatch", i)
+		}
+	}
+
+	if _, err := PlanFile(context.Background(), path, 0, "sha256"); err == nil {
+		t.Error("expected an error for a zero chunk size")
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	content := strings.Repeat("sietch", 1<<18)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dense.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	hash, err := HashFile(context.Background(), path, "sha256")
+	if err != nil {
+		t.Fatalf("HashFile: %v", err)
+	}
+	if hash != fmt.Sprintf("%x", sha256.Sum256([]byte(content))) {
+		t.Errorf("unexpected content hash %s", hash)
+	}
+
+	// A sparse file hashes like the zeros it reads as
+	sparse := filepath.Join(dir, "sparse.bin")
+	f, err := os.Create(sparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(3 << 20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	hash, err = HashFile(context.Background(), sparse, "sha256")
+	if err != nil || hash != fmt.Sprintf("%x", sha256.Sum256(make([]byte, 3<<20))) {
+		t.Errorf("sparse file hashed to %s (%v)", hash, err)
+	}
+}
@@ -0,0 +1,92 @@
+package chunk
+
+import (
+	"io"
+	"os"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// extentReader reads only the data extents of a file so holes in sparse files
+// are never chunked. A single Read never crosses an extent boundary, which keeps
+// every chunk inside one contiguous data range.
+type extentReader struct {
+	file    *os.File
+	extents []fs.Extent
+	current int   // Index of the extent being read
+	pos     int64 // Offset within the current extent
+}
+
+func newExtentReader(file *os.File, size int64) (*extentReader, error) {
+	extents, err := fs.DataExtents(file, size)
+	if err != nil {
+		return nil, err
+	}
+	return &extentReader{file: file, extents: extents}, nil
+}
+
+// Offset returns the file offset the next Read starts at
+func (r *extentReader) Offset() int64 {
+	if r.current >= len(r.extents) {
+		return 0
+	}
+	return r.extents[r.current].Offset + r.pos
+}
+
+// SkipTo makes the next Read start at offset, the end of a chunk of an earlier
+// read of the same file, so chunking resumes at the same boundaries
+func (r *extentReader) SkipTo(offset int64) {
+	r.current, r.pos = 0, 0
+	for ; r.current < len(r.extents); r.current++ {
+		ext := r.extents[r.current]
+		if offset < ext.Offset+ext.Length {
+			if offset > ext.Offset {
+				r.pos = offset - ext.Offset
+			}
+			return
+		}
+	}
+}
+
+func (r *extentReader) Read(p []byte) (int, error) {
+	for r.current < len(r.extents) && r.pos >= r.extents[r.current].Length {
+		r.current++
+		r.pos = 0
+	}
+	if r.current >= len(r.extents) {
+		return 0, io.EOF
+	}
+
+	ext := r.extents[r.current]
+	if remaining := ext.Length - r.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := r.file.ReadAt(p, ext.Offset+r.pos)
+	r.pos += int64(n)
+	if err == io.EOF {
+		// The file shrank while reading; make the next call report the end
+		r.current = len(r.extents)
+		if n > 0 {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+// Holes returns the ranges of a file of the given size that no chunk covers
+func Holes(chunks []config.ChunkRef, size int64) []config.HoleExtent {
+	var holes []config.HoleExtent
+	pos := int64(0)
+	for _, c := range chunks {
+		if c.Offset > pos {
+			holes = append(holes, config.HoleExtent{Offset: pos, Length: c.Offset - pos})
+		}
+		pos = c.Offset + c.Size
+	}
+	if size > pos {
+		holes = append(holes, config.HoleExtent{Offset: pos, Length: size - pos})
+	}
+	return holes
+}
@@ -0,0 +1,126 @@
+package chunk
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestHoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []config.ChunkRef
+		size   int64
+		want   []config.HoleExtent
+	}{
+		{
+			name:   "contiguous file has no holes",
+			chunks: []config.ChunkRef{{Offset: 0, Size: 10}, {Offset: 10, Size: 5}},
+			size:   15,
+		},
+		{
+			name:   "empty file has no holes",
+			chunks: nil,
+			size:   0,
+		},
+		{
+			name:   "hole between chunks",
+			chunks: []config.ChunkRef{{Offset: 0, Size: 10}, {Offset: 30, Size: 10}},
+			size:   40,
+			want:   []config.HoleExtent{{Offset: 10, Length: 20}},
+		},
+		{
+			name:   "leading and trailing holes",
+			chunks: []config.ChunkRef{{Offset: 100, Size: 10}},
+			size:   200,
+			want:   []config.HoleExtent{{Offset: 0, Length: 100}, {Offset: 110, Length: 90}},
+		},
+		{
+			name: "fully sparse file",
+			size: 64,
+			want: []config.HoleExtent{{Offset: 0, Length: 64}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Holes(tt.chunks, tt.size)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Holes() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("hole %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtentReaderSkipsHoles(t *testing.T) {
+	const blockSize = 1 << 20
+	path := filepath.Join(t.TempDir(), "sparse.img")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	data := bytes.Repeat([]byte("x"), 4096)
+	if _, err := f.WriteAt(data, 2*blockSize); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := f.Truncate(4 * blockSize); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	reader, err := newExtentReader(f, 4*blockSize)
+	if err != nil {
+		t.Fatalf("newExtentReader: %v", err)
+	}
+
+	var refs []config.ChunkRef
+	var content []byte
+	buf := make([]byte, 64*1024)
+	for {
+		offset := reader.Offset()
+		n, err := reader.Read(buf)
+		if n > 0 {
+			refs = append(refs, config.ChunkRef{Offset: offset, Size: int64(n)})
+			content = append(content, buf[:n]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+
+	// Whatever the filesystem reports, reading the extents plus the holes must
+	// reproduce the original file
+	rebuilt := make([]byte, 4*blockSize)
+	pos := 0
+	for _, r := range refs {
+		copy(rebuilt[r.Offset:], content[pos:pos+int(r.Size)])
+		pos += int(r.Size)
+	}
+	if !bytes.Equal(rebuilt[2*blockSize:2*blockSize+4096], data) {
+		t.Fatal("data extent was not read back at its offset")
+	}
+	if bytes.Count(rebuilt, []byte("x")) != len(data) {
+		t.Fatal("rebuilt file contains unexpected data")
+	}
+
+	holes := Holes(refs, 4*blockSize)
+	if int64(len(content)) == 4*blockSize {
+		t.Skip("filesystem does not report holes")
+	}
+	if len(holes) == 0 {
+		t.Error("expected holes for a sparse file")
+	}
+}
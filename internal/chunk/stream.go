@@ -0,0 +1,117 @@
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/internal/progress"
+)
+
+// streamReader reads a stream in whole chunks however the data arrives, so a
+// stream is split at the same boundaries as a file with the same content
+type streamReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func (s *streamReader) Offset() int64 { return s.offset }
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(s.r, p)
+	s.offset += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ChunkStreamTransactional chunks r as it arrives, staging new chunks in txn
+// like ChunkFileTransactional. sizeHint, if positive, is the expected length
+// of the stream and only sizes the progress bar. It returns the chunks along
+// with the length and content hash of the stream.
+func ChunkStreamTransactional(ctx context.Context, r io.Reader, sizeHint int64, chunkSize int64, vaultRoot string, passphrase string, workers int, progressMgr *progress.Manager, txn *atomic.Transaction) ([]config.ChunkRef, int64, string, error) {
+	batch, err := NewBatch(vaultRoot, passphrase, txn, progressMgr)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	chunkRefs, size, contentHash, err := batch.ChunkStream(ctx, r, sizeHint, chunkSize, workers, progressMgr)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if err := batch.Save(); err != nil {
+		return nil, 0, "", err
+	}
+	return chunkRefs, size, contentHash, nil
+}
+
+// holeReader reads the data ranges of a stream holding a whole sparse file,
+// its holes as zeros, and discards the holes, so the stream is split at the
+// same boundaries as the file itself read through an extentReader
+type holeReader struct {
+	r       io.Reader
+	extents []fs.Extent
+	current int   // Index of the extent being read
+	offset  int64 // Bytes consumed from r
+}
+
+// advance moves past the extents read to their end
+func (h *holeReader) advance() {
+	for h.current < len(h.extents) && h.offset >= h.extents[h.current].Offset+h.extents[h.current].Length {
+		h.current++
+	}
+}
+
+// Offset returns the file offset the next Read starts at
+func (h *holeReader) Offset() int64 {
+	h.advance()
+	if h.current < len(h.extents) {
+		return max(h.offset, h.extents[h.current].Offset)
+	}
+	return h.offset
+}
+
+func (h *holeReader) Read(p []byte) (int, error) {
+	h.advance()
+	if h.current >= len(h.extents) {
+		return 0, io.EOF
+	}
+
+	ext := h.extents[h.current]
+	if h.offset < ext.Offset {
+		skipped, err := io.CopyN(io.Discard, h.r, ext.Offset-h.offset)
+		h.offset += skipped
+		if err != nil {
+			return 0, fmt.Errorf("stream ended at offset %d: %v", h.offset, err)
+		}
+	}
+	if remaining := ext.Offset + ext.Length - h.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := io.ReadFull(h.r, p)
+	h.offset += int64(n)
+	if err != nil {
+		return n, fmt.Errorf("stream ended at offset %d: %v", h.offset, err)
+	}
+	return n, nil
+}
+
+// dataExtents returns the ranges of a file of the given size outside holes
+func dataExtents(holes []config.HoleExtent, size int64) []fs.Extent {
+	var extents []fs.Extent
+	pos := int64(0)
+	for _, hole := range holes {
+		if hole.Offset > pos {
+			extents = append(extents, fs.Extent{Offset: pos, Length: hole.Offset - pos})
+		}
+		pos = max(pos, hole.Offset+hole.Length)
+	}
+	if size > pos {
+		extents = append(extents, fs.Extent{Offset: pos, Length: size - pos})
+	}
+	return extents
+}
@@ -0,0 +1,115 @@
+package chunk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/progress"
+)
+
+func TestChunkStreamMatchesFile(t *testing.T) {
+	vaultRoot := newChunkTestVault(t)
+	path := writeRandomFile(t, 10*1024+5)
+	progressMgr := progress.NewManager(progress.Options{Quiet: true})
+	txn, err := atomic.Begin(vaultRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = txn.Rollback() }()
+
+	want, err := ChunkFileTransactional(context.Background(), path, 1024, vaultRoot, "", 2, progressMgr, txn)
+	if err != nil {
+		t.Fatalf("ChunkFileTransactional: %v", err)
+	}
+	wantHash, err := HashFile(context.Background(), path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Data arriving a byte at a time is still split into whole chunks
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, size, hash, err := ChunkStreamTransactional(context.Background(), iotest.OneByteReader(f), 0, 1024, vaultRoot, "", 2, progressMgr, txn)
+	if err != nil {
+		t.Fatalf("ChunkStreamTransactional: %v", err)
+	}
+	if size != 10*1024+5 || hash != wantHash {
+		t.Errorf("expected %d bytes hashing to %s, got %d bytes hashing to %s", 10*1024+5, wantHash, size, hash)
+	}
+	for i := range got {
+		got[i].Deduplicated = want[i].Deduplicated
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("a stream must be chunked like a file with its content\ngot  %+v\nwant %+v", got, want)
+	}
+
+	if refs, size, _, err := ChunkStreamTransactional(context.Background(), io.LimitReader(f, 0), 0, 1024, vaultRoot, "", 2, progressMgr, txn); err != nil || len(refs) != 0 || size != 0 {
+		t.Errorf("expected an empty stream to have no chunks, got %d chunks of %d bytes (%v)", len(refs), size, err)
+	}
+}
+
+func TestChunkStoredSkipsHoles(t *testing.T) {
+	vaultRoot := newChunkTestVault(t)
+	progressMgr := progress.NewManager(progress.Options{Quiet: true})
+	txn, err := atomic.Begin(vaultRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = txn.Rollback() }()
+	batch, err := NewBatch(vaultRoot, "", txn, progressMgr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2500 bytes of data, a 3000 byte hole, 1500 bytes of data and a
+	// trailing 1000 byte hole, read back with the holes as zeros
+	content := make([]byte, 8000)
+	for i := range content[:2500] {
+		content[i] = byte(i%251 + 1)
+	}
+	for i := 5500; i < 7000; i++ {
+		content[i] = byte(i%241 + 1)
+	}
+	holes := []config.HoleExtent{{Offset: 2500, Length: 3000}, {Offset: 7000, Length: 1000}}
+	hasher, _ := CreateHasher("")
+	hasher.Write(content)
+	wantHash := fmt.Sprintf("%x", hasher.Sum(nil))
+
+	refs, hash, err := batch.ChunkStored(context.Background(), iotest.HalfReader(bytes.NewReader(content)), int64(len(content)), holes, 1024, 2, progressMgr)
+	if err != nil {
+		t.Fatalf("ChunkStored: %v", err)
+	}
+	if hash != wantHash {
+		t.Errorf("expected content hash %s, got %s", wantHash, hash)
+	}
+	type span struct{ offset, size int64 }
+	want := []span{{0, 1024}, {1024, 1024}, {2048, 452}, {5500, 1024}, {6524, 476}}
+	var got []span
+	for _, ref := range refs {
+		got = append(got, span{ref.Offset, ref.Size})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected chunks %v, got %v", want, got)
+	}
+	if gotHoles := Holes(refs, int64(len(content))); !reflect.DeepEqual(gotHoles, holes) {
+		t.Errorf("expected the holes to be kept, got %v", gotHoles)
+	}
+
+	if _, _, err := batch.ChunkStored(context.Background(), bytes.NewReader(content[:6000]), int64(len(content)), holes, 1024, 2, progressMgr); err == nil {
+		t.Error("expected a stream shorter than the file to fail")
+	}
+	if _, _, err := batch.ChunkStored(context.Background(), bytes.NewReader(append(content, 0)), int64(len(content)), holes, 1024, 2, progressMgr); err == nil {
+		t.Error("expected a stream longer than the file to fail")
+	}
+}
@@ -0,0 +1,107 @@
+package chunk
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// Reasons a stored chunk can be reported as damaged
+const (
+	DamageMissing = "missing"
+	DamageCorrupt = "corrupt"
+)
+
+// DamagedChunk is a chunk whose stored copy is missing or does not match its recorded hash
+type DamagedChunk struct {
+	Ref    config.ChunkRef
+	Reason string
+	Files  []string // Vault paths of the files that reference the chunk
+}
+
+// StorageName returns the name a chunk is stored under in the chunk store.
+// Encrypted chunks are stored under the hash of their ciphertext.
+func StorageName(ref config.ChunkRef) string {
+	if ref.EncryptedHash != "" {
+		return ref.EncryptedHash
+	}
+	return ref.Hash
+}
+
+// VerifyStored checks the stored bytes of a chunk against the hashes recorded in its
+// reference. Encrypted chunks are checked against EncryptedHash, so no key is needed;
+// plain chunks are decompressed and checked against Hash.
+func VerifyStored(data []byte, ref config.ChunkRef, vaultConfig config.VaultConfig) error {
+	expected := ref.EncryptedHash
+	if expected == "" {
+		expected = ref.Hash
+		if ref.Compressed {
+			compressionType := ref.CompressionType
+			if compressionType == "" {
+				compressionType = vaultConfig.Compression
+			}
+			decompressed, err := compression.DecompressData(data, compressionType)
+			if err != nil {
+				return fmt.Errorf("failed to decompress: %v", err)
+			}
+			data = decompressed
+		}
+	}
+
+	hasher, err := CreateHasher(vaultConfig.Chunking.HashAlgorithm)
+	if err != nil {
+		return err
+	}
+	hasher.Write(data)
+	if actual := fmt.Sprintf("%x", hasher.Sum(nil)); actual != expected {
+		return fmt.Errorf("hash mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// FindDamaged checks every chunk referenced by files and returns those that are
+// missing from the chunk store or fail VerifyStored, ordered by storage name.
+// Each chunk is read once no matter how many files share it.
+func FindDamaged(vaultRoot string, files []config.FileManifest, vaultConfig config.VaultConfig) ([]DamagedChunk, error) {
+	damaged := make(map[string]*DamagedChunk)
+	checked := make(map[string]bool)
+	for _, file := range files {
+		filePath := file.Destination + file.FilePath
+		for _, ref := range file.Chunks {
+			name := StorageName(ref)
+			if name == "" {
+				continue
+			}
+			if checked[name] {
+				if d, ok := damaged[name]; ok && d.Files[len(d.Files)-1] != filePath {
+					d.Files = append(d.Files, filePath)
+				}
+				continue
+			}
+			checked[name] = true
+
+			data, err := os.ReadFile(fs.LocateChunk(vaultRoot, name))
+			switch {
+			case os.IsNotExist(err):
+				damaged[name] = &DamagedChunk{Ref: ref, Reason: DamageMissing, Files: []string{filePath}}
+			case err != nil:
+				return nil, fmt.Errorf("failed to read chunk %s: %v", name, err)
+			case VerifyStored(data, ref, vaultConfig) != nil:
+				damaged[name] = &DamagedChunk{Ref: ref, Reason: DamageCorrupt, Files: []string{filePath}}
+			}
+		}
+	}
+
+	result := make([]DamagedChunk, 0, len(damaged))
+	for _, d := range damaged {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return StorageName(result[i].Ref) < StorageName(result[j].Ref)
+	})
+	return result, nil
+}
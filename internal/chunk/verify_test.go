@@ -0,0 +1,90 @@
+package chunk
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/compression"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+func sha(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+func TestVerifyStored(t *testing.T) {
+	plain := []byte("chunk contents")
+	compressed, err := compression.CompressData(plain, constants.CompressionTypeGzip)
+	if err != nil {
+		t.Fatalf("compress: %v", err)
+	}
+	ciphertext := []byte("opaque ciphertext")
+
+	vaultConfig := config.VaultConfig{}
+	tests := []struct {
+		name    string
+		data    []byte
+		ref     config.ChunkRef
+		wantErr bool
+	}{
+		{"plain", plain, config.ChunkRef{Hash: sha(plain)}, false},
+		{"plain mismatch", []byte("tampered"), config.ChunkRef{Hash: sha(plain)}, true},
+		{"compressed", compressed, config.ChunkRef{Hash: sha(plain), Compressed: true, CompressionType: constants.CompressionTypeGzip}, false},
+		{"compressed garbage", plain, config.ChunkRef{Hash: sha(plain), Compressed: true, CompressionType: constants.CompressionTypeGzip}, true},
+		{"encrypted", ciphertext, config.ChunkRef{Hash: sha(plain), EncryptedHash: sha(ciphertext)}, false},
+		{"encrypted mismatch", plain, config.ChunkRef{Hash: sha(plain), EncryptedHash: sha(ciphertext)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyStored(tt.data, tt.ref, vaultConfig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyStored() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindDamaged(t *testing.T) {
+	vaultRoot := t.TempDir()
+	chunkDir := filepath.Join(vaultRoot, ".sietch", "chunks")
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	good, bad, gone := []byte("good"), []byte("bad"), []byte("gone")
+	if err := os.WriteFile(filepath.Join(chunkDir, sha(good)), good, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chunkDir, sha(bad)), []byte("bitrot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []config.FileManifest{
+		{FilePath: "a", Destination: "x/", Chunks: []config.ChunkRef{{Hash: sha(good)}, {Hash: sha(bad)}}},
+		{FilePath: "b", Destination: "x/", Chunks: []config.ChunkRef{{Hash: sha(bad)}, {Hash: sha(gone)}}},
+	}
+
+	damaged, err := FindDamaged(vaultRoot, files, config.VaultConfig{})
+	if err != nil {
+		t.Fatalf("FindDamaged: %v", err)
+	}
+	if len(damaged) != 2 {
+		t.Fatalf("expected 2 damaged chunks, got %+v", damaged)
+	}
+
+	reasons := map[string]DamagedChunk{}
+	for _, d := range damaged {
+		reasons[StorageName(d.Ref)] = d
+	}
+	if d := reasons[sha(bad)]; d.Reason != DamageCorrupt || len(d.Files) != 2 {
+		t.Errorf("expected corrupt chunk shared by both files, got %+v", d)
+	}
+	if d := reasons[sha(gone)]; d.Reason != DamageMissing || len(d.Files) != 1 || d.Files[0] != "x/b" {
+		t.Errorf("expected missing chunk used by x/b, got %+v", d)
+	}
+}
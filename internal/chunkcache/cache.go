@@ -0,0 +1,285 @@
+// Package chunkcache keeps recently decoded chunks so reading the same chunk
+// again skips decryption and decompression. Chunks are kept in a bounded
+// in-memory LRU and, optionally, in a bounded directory on disk that outlives
+// the process.
+//
+// Entries are keyed by the name a chunk is stored under, which is derived from
+// its content, so an entry never goes stale. Chunks in the disk cache are
+// stored decrypted; it should only be enabled where that is acceptable.
+package chunkcache
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMemorySize is the in-memory cache size used when none is configured
+const DefaultMemorySize = 64 * 1024 * 1024
+
+// Options configures a Cache
+type Options struct {
+	// MemorySize bounds the bytes of chunk data kept in memory; 0 disables the memory cache
+	MemorySize int64
+	// DiskDir is the directory of the disk cache; empty disables it
+	DiskDir string
+	// DiskSize bounds the bytes of chunk data kept in DiskDir; 0 disables the disk cache
+	DiskSize int64
+}
+
+// Stats counts cache lookups
+type Stats struct {
+	Hits      int64 // Lookups served from memory or disk
+	DiskHits  int64 // Hits served from the disk cache
+	Misses    int64
+	Evictions int64 // Entries dropped from memory or disk to stay within size
+}
+
+// HitRate returns the fraction of lookups that were hits
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d hits (%d from disk), %d misses, %.0f%% hit rate", s.Hits, s.DiskHits, s.Misses, s.HitRate()*100)
+}
+
+type entry struct {
+	key  string
+	data []byte
+}
+
+// Cache is a decoded-chunk cache safe for concurrent use. A nil *Cache is
+// valid and caches nothing.
+type Cache struct {
+	mu         sync.Mutex
+	memorySize int64
+	memoryUsed int64
+	order      *list.List // Most recently used at the front
+	entries    map[string]*list.Element
+
+	diskDir  string
+	diskSize int64
+	diskUsed int64
+
+	stats Stats
+}
+
+// New returns a cache with the given options. The disk cache directory is
+// created if needed and its current contents are counted against DiskSize.
+func New(opts Options) (*Cache, error) {
+	c := &Cache{
+		memorySize: max(opts.MemorySize, 0),
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+	if opts.DiskDir == "" || opts.DiskSize <= 0 {
+		return c, nil
+	}
+
+	if err := os.MkdirAll(opts.DiskDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create chunk cache directory: %v", err)
+	}
+	c.diskDir = opts.DiskDir
+	c.diskSize = opts.DiskSize
+	files, err := c.diskFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		c.diskUsed += f.size
+	}
+	if err := c.trimDiskLocked(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the cached chunk stored under key. The returned slice is shared
+// with the cache and must not be modified.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		c.stats.Hits++
+		return el.Value.(*entry).data, true
+	}
+
+	if c.diskDir != "" && validKey(key) {
+		path := filepath.Join(c.diskDir, key)
+		if data, err := os.ReadFile(path); err == nil {
+			// Touch the file so the disk cache also evicts least recently used first
+			now := time.Now()
+			_ = os.Chtimes(path, now, now)
+			c.addMemoryLocked(key, data)
+			c.stats.Hits++
+			c.stats.DiskHits++
+			return data, true
+		}
+	}
+
+	c.stats.Misses++
+	return nil, false
+}
+
+// Put caches data under key. The cache keeps data, so the caller must not
+// modify it afterwards. Failing to write the disk cache only loses the entry.
+func (c *Cache) Put(key string, data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addMemoryLocked(key, data)
+	if c.diskDir != "" && validKey(key) && int64(len(data)) <= c.diskSize {
+		_ = c.writeDiskLocked(key, data)
+	}
+}
+
+// Stats returns the lookup counters since the cache was created
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// addMemoryLocked inserts or refreshes an entry and evicts the least recently
+// used entries until the memory cache fits. Chunks larger than the whole
+// cache are not kept.
+func (c *Cache) addMemoryLocked(key string, data []byte) {
+	size := int64(len(data))
+	if size > c.memorySize {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry{key: key, data: data})
+	c.memoryUsed += size
+	for c.memoryUsed > c.memorySize {
+		oldest := c.order.Back()
+		e := oldest.Value.(*entry)
+		c.order.Remove(oldest)
+		delete(c.entries, e.key)
+		c.memoryUsed -= int64(len(e.data))
+		c.stats.Evictions++
+	}
+}
+
+// writeDiskLocked stores data in the disk cache through a temporary file, so
+// a crash never leaves a truncated entry, then trims the cache to size
+func (c *Cache) writeDiskLocked(key string, data []byte) error {
+	path := filepath.Join(c.diskDir, key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(c.diskDir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	c.diskUsed += int64(len(data))
+	return c.trimDiskLocked()
+}
+
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// diskFiles lists the entries of the disk cache
+func (c *Cache) diskFiles() ([]diskFile, error) {
+	dirEntries, err := os.ReadDir(c.diskDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk cache directory: %v", err)
+	}
+	var files []diskFile
+	for _, de := range dirEntries {
+		if !de.Type().IsRegular() || !validKey(de.Name()) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, diskFile{path: filepath.Join(c.diskDir, de.Name()), size: info.Size(), modTime: info.ModTime()})
+	}
+	return files, nil
+}
+
+// trimDiskLocked removes the least recently used disk entries until the disk
+// cache fits
+func (c *Cache) trimDiskLocked() error {
+	if c.diskUsed <= c.diskSize {
+		return nil
+	}
+	files, err := c.diskFiles()
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	c.diskUsed = 0
+	for _, f := range files {
+		c.diskUsed += f.size
+	}
+	for _, f := range files {
+		if c.diskUsed <= c.diskSize {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to evict cached chunk: %v", err)
+		}
+		c.diskUsed -= f.size
+		c.stats.Evictions++
+	}
+	return nil
+}
+
+// validKey reports whether key can be used as a file name in the disk cache.
+// Chunks are stored under hex hashes, so anything else is kept in memory only.
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
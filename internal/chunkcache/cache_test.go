@@ -0,0 +1,87 @@
+package chunkcache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryLRU(t *testing.T) {
+	c, err := New(Options{MemorySize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Put("aa", []byte("1234"))
+	c.Put("bb", []byte("5678"))
+	if _, ok := c.Get("aa"); !ok { // aa is now the most recently used
+		t.Fatal("expected aa to be cached")
+	}
+	c.Put("cc", []byte("9012")) // Evicts bb
+	c.Put("dd", []byte("too large for the cache"))
+
+	for key, want := range map[string]bool{"aa": true, "bb": false, "cc": true, "dd": false} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("Get(%q) cached = %v, want %v", key, ok, want)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if rate := stats.HitRate(); rate != 0.6 {
+		t.Errorf("HitRate() = %v, want 0.6", rate)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	c, err := New(Options{MemorySize: 0, DiskDir: dir, DiskSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put("aa", []byte("1234"))
+	c.Put("not-a-hash", []byte("5678"))
+
+	// A new cache, as in a later process, finds the entry on disk
+	c, err = New(Options{MemorySize: 100, DiskDir: dir, DiskSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := c.Get("aa"); !ok || !bytes.Equal(data, []byte("1234")) {
+		t.Fatalf("expected aa from disk, got %q (%v)", data, ok)
+	}
+	if _, ok := c.Get("not-a-hash"); ok {
+		t.Error("keys that are not hashes must not reach the disk cache")
+	}
+	if stats := c.Stats(); stats.DiskHits != 1 {
+		t.Errorf("expected one disk hit, got %+v", stats)
+	}
+
+	// Older entries are removed once the disk cache is over size
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "aa"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	c.Put("bb", []byte("5678"))
+	c.Put("cc", []byte("9012"))
+	for key, want := range map[string]bool{"aa": false, "bb": true, "cc": true} {
+		if _, err := os.Stat(filepath.Join(dir, key)); (err == nil) != want {
+			t.Errorf("disk entry %s present = %v, want %v", key, err == nil, want)
+		}
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	c.Put("aa", []byte("x"))
+	if _, ok := c.Get("aa"); ok {
+		t.Error("a nil cache must not cache anything")
+	}
+	if stats := c.Stats(); stats != (Stats{}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
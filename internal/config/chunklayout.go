@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxChunkFanout is the deepest chunk store layout, with chunks kept in
+// aa/bb/<name>
+const MaxChunkFanout = 2
+
+// ShardedChunkName returns the slash-separated path of the chunk name below
+// a chunk store spread over fanout levels of directories, each named by the
+// next two characters of the name. Names too short to shard stay at the top.
+func ShardedChunkName(name string, fanout int) string {
+	if fanout <= 0 || len(name) < 2*fanout {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < fanout; i++ {
+		b.WriteString(name[2*i : 2*i+2])
+		b.WriteByte('/')
+	}
+	b.WriteString(name)
+	return b.String()
+}
+
+// LocateChunk returns the path of the chunk name in the chunk store dir laid
+// out with fanout. A chunk not found there is looked for in the other
+// layouts, where it stays until a reshard that was interrupted moves it; a
+// chunk stored nowhere is where fanout would put it.
+func LocateChunk(dir string, fanout int, name string) string {
+	path := filepath.Join(dir, filepath.FromSlash(ShardedChunkName(name, fanout)))
+	if _, err := os.Lstat(path); err == nil {
+		return path
+	}
+	for other := 0; other <= MaxChunkFanout; other++ {
+		if other == fanout {
+			continue
+		}
+		candidate := filepath.Join(dir, filepath.FromSlash(ShardedChunkName(name, other)))
+		if _, err := os.Lstat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return path
+}
+
+// WalkChunks calls fn with the name and path of every chunk in the chunk
+// store dir, whatever its layout. Transactions and temporary files kept in
+// the store are skipped, and a missing store holds no chunks.
+func WalkChunks(dir string, fn func(name, path string, entry os.DirEntry) error) error {
+	return walkChunkDir(dir, 0, fn)
+}
+
+func walkChunkDir(dir string, depth int, fn func(name, path string, entry os.DirEntry) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) && depth == 0 {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if entry.IsDir() {
+			if depth < MaxChunkFanout && isShardDir(name) {
+				if err := walkChunkDir(path, depth+1, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := fn(name, path, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isShardDir reports whether name is a fanout directory of a chunk store
+func isShardDir(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestShardedChunkName(t *testing.T) {
+	tests := []struct {
+		name   string
+		fanout int
+		want   string
+	}{
+		{"abcdef12", 0, "abcdef12"},
+		{"abcdef12", 1, "ab/abcdef12"},
+		{"abcdef12", 2, "ab/cd/abcdef12"},
+		{"abc", 2, "abc"},
+		{"abcd", 2, "ab/cd/abcd"},
+	}
+	for _, tt := range tests {
+		if got := ShardedChunkName(tt.name, tt.fanout); got != tt.want {
+			t.Errorf("ShardedChunkName(%q, %d) = %q, want %q", tt.name, tt.fanout, got, tt.want)
+		}
+	}
+}
+
+func TestLocateAndWalkChunks(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(rel), 0o644); err != nil {
+			t.Fatalf("write %s: %v", rel, err)
+		}
+	}
+	write("aabbcc")          // Left flat by an interrupted reshard
+	write("dd/ee/ddeeff")    // Where fanout 2 keeps it
+	write(".txn/1/new/ffff") // Staged by a transaction, not stored
+	write("notes/readme")    // Not a shard directory
+
+	if got, want := LocateChunk(dir, 2, "aabbcc"), filepath.Join(dir, "aabbcc"); got != want {
+		t.Errorf("LocateChunk of flat chunk = %s, want %s", got, want)
+	}
+	if got, want := LocateChunk(dir, 0, "ddeeff"), filepath.Join(dir, "dd", "ee", "ddeeff"); got != want {
+		t.Errorf("LocateChunk of sharded chunk = %s, want %s", got, want)
+	}
+	if got, want := LocateChunk(dir, 2, "112233"), filepath.Join(dir, "11", "22", "112233"); got != want {
+		t.Errorf("LocateChunk of missing chunk = %s, want %s", got, want)
+	}
+
+	var names []string
+	err := WalkChunks(dir, func(name, path string, _ os.DirEntry) error {
+		if filepath.Base(path) != name {
+			t.Errorf("chunk %s at %s", name, path)
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkChunks: %v", err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "aabbcc" || names[1] != "ddeeff" {
+		t.Errorf("WalkChunks found %v, want [aabbcc ddeeff]", names)
+	}
+
+	if err := WalkChunks(filepath.Join(dir, "missing"), func(string, string, os.DirEntry) error { return nil }); err != nil {
+		t.Errorf("WalkChunks of missing store: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// PeerGroup is a named set of trusted peers, such as "home" or "field-team",
+// that can be synced with together
+type PeerGroup struct {
+	Name    string   `yaml:"name"`
+	Members []string `yaml:"members,omitempty"` // Trusted peer IDs
+	// AllowedPaths is the default allowed_paths of members that have none of
+	// their own. Empty sets no default.
+	AllowedPaths []string `yaml:"allowed_paths,omitempty"`
+}
+
+var groupNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateGroupName checks that name can be used as a peer group name
+func ValidateGroupName(name string) error {
+	if !groupNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid group name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// Group returns the peer group called name, or nil if there is none
+func (s *SyncConfig) Group(name string) *PeerGroup {
+	for i := range s.Groups {
+		if s.Groups[i].Name == name {
+			return &s.Groups[i]
+		}
+	}
+	return nil
+}
+
+// GroupFor returns the peer group called name, creating it if needed
+func (s *SyncConfig) GroupFor(name string) *PeerGroup {
+	if g := s.Group(name); g != nil {
+		return g
+	}
+	s.Groups = append(s.Groups, PeerGroup{Name: name})
+	return &s.Groups[len(s.Groups)-1]
+}
+
+// RemoveGroup deletes the peer group called name, reporting whether it existed
+func (s *SyncConfig) RemoveGroup(name string) bool {
+	n := len(s.Groups)
+	s.Groups = slices.DeleteFunc(s.Groups, func(g PeerGroup) bool { return g.Name == name })
+	return len(s.Groups) != n
+}
+
+// PeerGroups returns the names of the groups the peer with peerID belongs to
+func (s *SyncConfig) PeerGroups(peerID string) []string {
+	var names []string
+	for _, g := range s.Groups {
+		if slices.Contains(g.Members, peerID) {
+			names = append(names, g.Name)
+		}
+	}
+	return names
+}
+
+// AllowedPathsFor returns the access rules of a trusted peer: its own
+// allowed_paths or, when it has none, those of its groups combined. Empty
+// means the peer can fetch everything.
+func (s *SyncConfig) AllowedPathsFor(p TrustedPeer) []string {
+	if len(p.AllowedPaths) > 0 {
+		return p.AllowedPaths
+	}
+	var paths []string
+	for _, g := range s.Groups {
+		if !slices.Contains(g.Members, p.ID) {
+			continue
+		}
+		for _, path := range g.AllowedPaths {
+			if !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// AddMember adds the peer with peerID to the group, reporting whether it was
+// not a member yet
+func (g *PeerGroup) AddMember(peerID string) bool {
+	if slices.Contains(g.Members, peerID) {
+		return false
+	}
+	g.Members = append(g.Members, peerID)
+	return true
+}
+
+// RemoveMember removes the peer with peerID from the group, reporting
+// whether it was a member
+func (g *PeerGroup) RemoveMember(peerID string) bool {
+	n := len(g.Members)
+	g.Members = slices.DeleteFunc(g.Members, func(id string) bool { return id == peerID })
+	return len(g.Members) != n
+}
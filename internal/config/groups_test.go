@@ -0,0 +1,74 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPeerGroups(t *testing.T) {
+	var s SyncConfig
+	if s.Group("home") != nil {
+		t.Fatal("expected no group before one is created")
+	}
+
+	home := s.GroupFor("home")
+	if !home.AddMember("peer-a") || !home.AddMember("peer-b") || home.AddMember("peer-a") {
+		t.Error("AddMember must add each peer once")
+	}
+	field := s.GroupFor("field-team")
+	field.AddMember("peer-b")
+	if s.GroupFor("home") != &s.Groups[0] || len(s.Groups) != 2 {
+		t.Errorf("GroupFor must return the existing group, got groups %+v", s.Groups)
+	}
+
+	if got := s.PeerGroups("peer-b"); !reflect.DeepEqual(got, []string{"home", "field-team"}) {
+		t.Errorf("PeerGroups(peer-b) = %v", got)
+	}
+	if got := s.PeerGroups("peer-c"); got != nil {
+		t.Errorf("PeerGroups(peer-c) = %v, want none", got)
+	}
+
+	if !s.Group("home").RemoveMember("peer-a") || s.Group("home").RemoveMember("peer-a") {
+		t.Error("RemoveMember must report whether the peer was a member")
+	}
+	if !s.RemoveGroup("home") || s.RemoveGroup("home") || s.Group("field-team") == nil {
+		t.Errorf("RemoveGroup must delete only the named group, got %+v", s.Groups)
+	}
+}
+
+func TestAllowedPathsFor(t *testing.T) {
+	s := SyncConfig{Groups: []PeerGroup{
+		{Name: "home", Members: []string{"peer-a", "peer-b"}},
+		{Name: "field-team", Members: []string{"peer-b", "peer-c"}, AllowedPaths: []string{"maps/", "tag:field"}},
+		{Name: "docs", Members: []string{"peer-c"}, AllowedPaths: []string{"docs/", "maps/"}},
+	}}
+
+	tests := []struct {
+		peer TrustedPeer
+		want []string
+	}{
+		{TrustedPeer{ID: "peer-a"}, nil},
+		{TrustedPeer{ID: "peer-b"}, []string{"maps/", "tag:field"}},
+		{TrustedPeer{ID: "peer-c"}, []string{"maps/", "tag:field", "docs/"}},
+		{TrustedPeer{ID: "peer-c", AllowedPaths: []string{"private/"}}, []string{"private/"}},
+		{TrustedPeer{ID: "peer-d"}, nil},
+	}
+	for _, tc := range tests {
+		if got := s.AllowedPathsFor(tc.peer); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("AllowedPathsFor(%s, %v) = %v, want %v", tc.peer.ID, tc.peer.AllowedPaths, got, tc.want)
+		}
+	}
+}
+
+func TestValidateGroupName(t *testing.T) {
+	for _, name := range []string{"home", "field-team", "team_2", "a.b"} {
+		if err := ValidateGroupName(name); err != nil {
+			t.Errorf("ValidateGroupName(%q) failed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "-home", "field team", "a,b", "tag:x"} {
+		if err := ValidateGroupName(name); err == nil {
+			t.Errorf("ValidateGroupName(%q) should fail", name)
+		}
+	}
+}
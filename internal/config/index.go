@@ -0,0 +1,413 @@
+package config
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/yaml.v2"
+)
+
+// The manifest index is a bbolt database in .sietch caching every parsed YAML
+// manifest together with the modification time and size it was parsed at.
+// Listing only re-parses manifests whose file changed, so the YAML files stay
+// the source of truth and an index that is missing, stale or locked by another
+// process never produces wrong results. In vaults that encrypt their manifests
+// the cached records are sealed the same way as the YAML files.
+const (
+	manifestIndexFile    = "manifest_index.db"
+	manifestIndexVersion = "1"
+
+	// A manifest modified this close to the time it was indexed may be rewritten
+	// again within the same timestamp tick, so its record is not trusted
+	racyIndexWindow = 2 * time.Second
+)
+
+var (
+	indexManifestsBucket = []byte("manifests")
+	indexMetaBucket      = []byte("meta")
+	indexVersionKey      = []byte("version")
+)
+
+// indexRecord is a cached manifest keyed by its YAML file name
+type indexRecord struct {
+	ModTime   int64
+	Size      int64
+	IndexedAt int64
+	ChangedAt int64 // When the manifest last changed other than in its sync and verification times
+	Manifest  FileManifest
+}
+
+// changedAt returns when the record's manifest last changed. Records written
+// before ChangedAt was tracked fall back to the file's modification time.
+func (r *indexRecord) changedAt() time.Time {
+	if r.ChangedAt == 0 {
+		return time.Unix(0, r.ModTime)
+	}
+	return time.Unix(0, r.ChangedAt)
+}
+
+// sameContent reports whether a and b differ at most in the timestamps that
+// sync and reference rebuilds rewrite on every run
+func sameContent(a, b *FileManifest) bool {
+	x, y := *a, *b
+	x.LastSynced, y.LastSynced = time.Time{}, time.Time{}
+	x.LastVerified, y.LastVerified = time.Time{}, time.Time{}
+	// Compared as YAML, since the index decodes empty lists as nil
+	xData, xErr := yaml.Marshal(&x)
+	yData, yErr := yaml.Marshal(&y)
+	return xErr == nil && yErr == nil && bytes.Equal(xData, yData)
+}
+
+// manifestIndexPath returns the location of the manifest index database
+func (m *Manager) manifestIndexPath() string {
+	return filepath.Join(m.vaultRoot, ".sietch", manifestIndexFile)
+}
+
+// openManifestIndex opens the manifest index, creating it if needed. The short
+// timeout keeps a command from blocking while another sietch process holds it.
+func (m *Manager) openManifestIndex() (*bolt.DB, error) {
+	db, err := bolt.Open(m.manifestIndexPath(), 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(indexMetaBucket)
+		if err != nil {
+			return err
+		}
+		if string(meta.Get(indexVersionKey)) != manifestIndexVersion {
+			// Drop records written in an older format
+			if tx.Bucket(indexManifestsBucket) != nil {
+				if err := tx.DeleteBucket(indexManifestsBucket); err != nil {
+					return err
+				}
+			}
+			if err := meta.Put(indexVersionKey, []byte(manifestIndexVersion)); err != nil {
+				return err
+			}
+		}
+		_, err = tx.CreateBucketIfNotExists(indexManifestsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// loadManifestEntries returns every manifest in the manifests directory, in
+// directory order. Unchanged manifests come from the index; new or modified
+// ones are parsed from YAML and written back, and records for deleted
+// manifests are dropped. If the index cannot be used every manifest is parsed.
+func (m *Manager) loadManifestEntries() []*ManifestEntry {
+	manifestsDir := filepath.Join(m.vaultRoot, ".sietch", "manifests")
+	dirEntries, err := os.ReadDir(manifestsDir)
+	if err != nil {
+		return nil // No manifests directory means an empty vault
+	}
+
+	db, err := m.openManifestIndex()
+	if err != nil {
+		return m.scanManifests(manifestsDir, dirEntries, nil, nil)
+	}
+	defer db.Close()
+
+	cached := make(map[string]indexRecord)
+	_ = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(indexManifestsBucket).ForEach(func(k, v []byte) error {
+			if rec, ok := m.decodeIndexRecord(v); ok {
+				cached[string(k)] = rec
+			}
+			return nil
+		})
+	})
+
+	now := time.Now()
+	updates := make(map[string]indexRecord)
+	stale := make(map[string]indexRecord)
+	entries := m.scanManifests(manifestsDir, dirEntries, func(name string, info os.FileInfo) (*FileManifest, time.Time, bool) {
+		rec, ok := cached[name]
+		delete(cached, name)
+		if ok && rec.fresh(info) {
+			return &rec.Manifest, rec.changedAt(), true
+		}
+		if ok {
+			stale[name] = rec
+		}
+		return nil, time.Time{}, false
+	}, func(name string, info os.FileInfo, manifest *FileManifest) time.Time {
+		var prev *indexRecord
+		if rec, ok := stale[name]; ok {
+			prev = &rec
+		}
+		rec := newIndexRecord(info, manifest, prev, now)
+		updates[name] = rec
+		return rec.changedAt()
+	})
+
+	// Whatever is left in cached no longer has a YAML file
+	removed := make([]string, 0, len(cached))
+	for name := range cached {
+		removed = append(removed, name)
+	}
+	m.writeIndexRecords(db, updates, removed)
+	return entries
+}
+
+// walkBatchSize is how many directory entries WalkManifests reads at a time
+const walkBatchSize = 1024
+
+// WalkManifests calls fn with every manifest in the vault, in no particular
+// order, without holding them all in memory: the manifests directory is read
+// a batch at a time and index records are looked up one by one. fn may
+// return fs.SkipAll to stop early. Manifests that changed are indexed as
+// they are parsed; records of removed manifests are left for the next full
+// listing to drop.
+func (m *Manager) WalkManifests(fn func(entry *ManifestEntry) error) error {
+	manifestsDir := filepath.Join(m.vaultRoot, ".sietch", "manifests")
+	dir, err := os.Open(manifestsDir)
+	if os.IsNotExist(err) {
+		return nil // No manifests directory means an empty vault
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifests: %w", err)
+	}
+	defer dir.Close()
+
+	// Without the index every manifest is parsed
+	db, err := m.openManifestIndex()
+	if err == nil {
+		defer db.Close()
+	} else {
+		db = nil
+	}
+	now := time.Now()
+	updates := make(map[string]indexRecord)
+	defer func() { m.writeIndexRecords(db, updates, nil) }()
+
+	// Records are looked up one at a time rather than preloaded
+	var lookup func(name string, info os.FileInfo) (*FileManifest, time.Time, bool)
+	var store func(name string, info os.FileInfo, manifest *FileManifest) time.Time
+	stale := make(map[string]indexRecord)
+	if db != nil {
+		lookup = func(name string, info os.FileInfo) (*FileManifest, time.Time, bool) {
+			var rec indexRecord
+			var ok bool
+			_ = db.View(func(tx *bolt.Tx) error {
+				rec, ok = m.decodeIndexRecord(tx.Bucket(indexManifestsBucket).Get([]byte(name)))
+				return nil
+			})
+			if ok && rec.fresh(info) {
+				return &rec.Manifest, rec.changedAt(), true
+			}
+			if ok {
+				stale[name] = rec
+			}
+			return nil, time.Time{}, false
+		}
+		store = func(name string, info os.FileInfo, manifest *FileManifest) time.Time {
+			var prev *indexRecord
+			if rec, ok := stale[name]; ok {
+				prev = &rec
+				delete(stale, name)
+			}
+			rec := newIndexRecord(info, manifest, prev, now)
+			updates[name] = rec
+			return rec.changedAt()
+		}
+	}
+
+	for {
+		batch, readErr := dir.ReadDir(walkBatchSize)
+		for _, entry := range m.scanManifests(manifestsDir, batch, lookup, store) {
+			if err := fn(entry); err == fs.SkipAll {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		// Keep the pending index writes to one batch
+		m.writeIndexRecords(db, updates, nil)
+		clear(updates)
+		clear(stale)
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read manifests: %w", readErr)
+		}
+	}
+}
+
+// fresh reports whether the record can stand in for the manifest file
+// described by info
+func (r *indexRecord) fresh(info os.FileInfo) bool {
+	return r.ModTime == info.ModTime().UnixNano() && r.Size == info.Size() &&
+		r.ModTime < r.IndexedAt-int64(racyIndexWindow)
+}
+
+// newIndexRecord returns the record of manifest, just parsed from the file
+// described by info. prev is the record it replaces, if any: a manifest that
+// only changed in its sync times keeps the earlier change time.
+func newIndexRecord(info os.FileInfo, manifest *FileManifest, prev *indexRecord, now time.Time) indexRecord {
+	changedAt := info.ModTime()
+	if prev != nil && sameContent(&prev.Manifest, manifest) {
+		changedAt = prev.changedAt()
+	}
+	return indexRecord{
+		ModTime:   info.ModTime().UnixNano(),
+		Size:      info.Size(),
+		IndexedAt: now.UnixNano(),
+		ChangedAt: changedAt.UnixNano(),
+		Manifest:  *manifest,
+	}
+}
+
+// decodeIndexRecord decodes a stored index record. Records that cannot be
+// decrypted or decoded are re-read from their manifests.
+func (m *Manager) decodeIndexRecord(v []byte) (indexRecord, bool) {
+	var rec indexRecord
+	if v == nil {
+		return rec, false
+	}
+	data, err := OpenMetadata(m.vaultRoot, v)
+	if err != nil {
+		return rec, false
+	}
+	return rec, gob.NewDecoder(bytes.NewReader(data)).Decode(&rec) == nil
+}
+
+// writeIndexRecords stores updates in the index and drops the records of
+// the removed manifests. A nil db or a failed write is ignored, since the
+// YAML manifests stay the source of truth.
+func (m *Manager) writeIndexRecords(db *bolt.DB, updates map[string]indexRecord, removed []string) {
+	if db == nil || (len(updates) == 0 && len(removed) == 0) {
+		return
+	}
+	_ = db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(indexManifestsBucket)
+		for _, name := range removed {
+			if err := bucket.Delete([]byte(name)); err != nil {
+				return err
+			}
+		}
+		for name, rec := range updates {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+				return err
+			}
+			data, err := SealMetadata(m.vaultRoot, buf.Bytes())
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// scanManifests parses the YAML manifests among dirEntries. When lookup is set
+// it is consulted first and a hit skips parsing; freshly parsed manifests are
+// passed to store, which returns when their content last changed. Manifests
+// that fail to parse are reported and skipped.
+func (m *Manager) scanManifests(
+	manifestsDir string,
+	dirEntries []os.DirEntry,
+	lookup func(name string, info os.FileInfo) (*FileManifest, time.Time, bool),
+	store func(name string, info os.FileInfo, manifest *FileManifest) time.Time,
+) []*ManifestEntry {
+	var entries []*ManifestEntry
+	for _, entry := range dirEntries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		filePath := filepath.Join(manifestsDir, entry.Name())
+
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed while listing
+		}
+
+		if lookup != nil {
+			if manifest, changedAt, ok := lookup(entry.Name(), info); ok {
+				entries = append(entries, &ManifestEntry{Path: filePath, Manifest: *manifest, ChangedAt: changedAt})
+				continue
+			}
+		}
+
+		fileManifest, err := m.loadFileManifest(filePath)
+		if err != nil {
+			fmt.Printf("Warning: Failed to load manifest %s: %v\n", entry.Name(), err)
+			continue
+		}
+		changedAt := info.ModTime()
+		if store != nil {
+			changedAt = store(entry.Name(), info, fileManifest)
+		}
+
+		entries = append(entries, &ManifestEntry{Path: filePath, Manifest: *fileManifest, ChangedAt: changedAt})
+	}
+	return entries
+}
+
+// RefreshIndex brings the manifest index up to date with the YAML manifests.
+// Commands that write manifests call it after committing so that the next
+// listing is served from the index.
+func (m *Manager) RefreshIndex() {
+	m.loadManifestEntries()
+}
+
+// Reindex discards the manifest index and rebuilds it from the YAML manifests,
+// returning the number of manifests indexed
+func (m *Manager) Reindex() (int, error) {
+	if err := os.Remove(m.manifestIndexPath()); err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to remove manifest index: %v", err)
+	}
+
+	// Building requires the index to be writable; surface the error that a
+	// normal listing would silently fall back from
+	db, err := m.openManifestIndex()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create manifest index: %v", err)
+	}
+	db.Close()
+
+	return len(m.loadManifestEntries()), nil
+}
+
+// ContentIndex returns the manifests of stored files keyed by their
+// ContentHash, so a file with the same content can reuse their chunks.
+// Symlinks and manifests recorded without a content hash are left out.
+func (m *Manager) ContentIndex() map[string]FileManifest {
+	index := make(map[string]FileManifest)
+	for _, entry := range m.loadManifestEntries() {
+		if entry.Manifest.ContentHash == "" || entry.Manifest.Symlink != "" {
+			continue
+		}
+		if _, seen := index[entry.Manifest.ContentHash]; !seen {
+			index[entry.Manifest.ContentHash] = entry.Manifest
+		}
+	}
+	return index
+}
+
+// PathIndex returns the manifests of stored files keyed by their vault path,
+// Destination followed by FilePath
+func (m *Manager) PathIndex() map[string]FileManifest {
+	index := make(map[string]FileManifest)
+	for _, entry := range m.loadManifestEntries() {
+		index[entry.Manifest.Destination+entry.Manifest.FilePath] = entry.Manifest
+	}
+	return index
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestManifest(t *testing.T, dir, name string, m *FileManifest, modTime time.Time) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	manager := &Manager{vaultRoot: filepath.Dir(filepath.Dir(dir))}
+	if err := manager.saveFileManifest(path, m); err != nil {
+		t.Fatalf("save manifest: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func TestManifestIndex(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	writeTestManifest(t, manifestsDir, "a.yaml", &FileManifest{FilePath: "a.txt", Size: 1}, old)
+	writeTestManifest(t, manifestsDir, "b.yaml", &FileManifest{FilePath: "b.txt", Size: 2, Tags: []string{"x"}}, old)
+
+	manager, err := NewManager(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := manager.GetManifest()
+	if err != nil || len(manifest.Files) != 2 {
+		t.Fatalf("expected 2 files, got %v (%v)", manifest, err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultRoot, ".sietch", manifestIndexFile)); err != nil {
+		t.Fatalf("expected index to be created: %v", err)
+	}
+
+	// A corrupt YAML file with an unchanged timestamp and size is served from the index
+	path := filepath.Join(manifestsDir, "a.yaml")
+	info, _ := os.Stat(path)
+	if err := os.WriteFile(path, make([]byte, info.Size()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ = manager.GetManifest()
+	if len(manifest.Files) != 2 || manifest.Files[0].FilePath != "a.txt" {
+		t.Fatalf("expected a.txt from the index, got %+v", manifest.Files)
+	}
+
+	// Changed and removed manifests are picked up
+	writeTestManifest(t, manifestsDir, "a.yaml", &FileManifest{FilePath: "renamed.txt", Size: 1}, old.Add(time.Minute))
+	if err := os.Remove(filepath.Join(manifestsDir, "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ = manager.GetManifest()
+	if len(manifest.Files) != 1 || manifest.Files[0].FilePath != "renamed.txt" {
+		t.Fatalf("expected only renamed.txt, got %+v", manifest.Files)
+	}
+
+	// Recently modified manifests are always re-read
+	writeTestManifest(t, manifestsDir, "c.yaml", &FileManifest{FilePath: "c1.txt"}, time.Now())
+	if _, err := manager.GetManifest(); err != nil {
+		t.Fatal(err)
+	}
+	cPath := filepath.Join(manifestsDir, "c.yaml")
+	cInfo, _ := os.Stat(cPath)
+	writeTestManifest(t, manifestsDir, "c.yaml", &FileManifest{FilePath: "c2.txt"}, cInfo.ModTime())
+	manifest, _ = manager.GetManifest()
+	if len(manifest.Files) != 2 || manifest.Files[1].FilePath != "c2.txt" {
+		t.Fatalf("expected c2.txt to be re-read, got %+v", manifest.Files)
+	}
+
+	count, err := manager.Reindex()
+	if err != nil || count != 2 {
+		t.Fatalf("expected reindex of 2 manifests, got %d (%v)", count, err)
+	}
+}
+
+func TestManifestIndexChangedAt(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestManifest(t, manifestsDir, "a.yaml", &FileManifest{FilePath: "a.txt", Size: 1}, old)
+
+	manager, err := NewManager(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changedAt := func() time.Time {
+		t.Helper()
+		entries, _ := manager.GetManifestEntries()
+		if len(entries) != 1 {
+			t.Fatalf("expected one manifest, got %d", len(entries))
+		}
+		return entries[0].ChangedAt
+	}
+	if got := changedAt(); !got.Equal(old) {
+		t.Fatalf("ChangedAt = %v, want %v", got, old)
+	}
+
+	// Rewriting only the verification time, as every sync does, is not a change
+	writeTestManifest(t, manifestsDir, "a.yaml", &FileManifest{FilePath: "a.txt", Size: 1, LastVerified: time.Now()}, time.Now())
+	if got := changedAt(); !got.Equal(old) {
+		t.Errorf("ChangedAt after a verification = %v, want %v", got, old)
+	}
+
+	writeTestManifest(t, manifestsDir, "a.yaml", &FileManifest{FilePath: "a.txt", Size: 2}, time.Now())
+	if got := changedAt(); !got.After(old) {
+		t.Errorf("ChangedAt after a content change = %v, want later than %v", got, old)
+	}
+}
+
+func TestWalkManifests(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := NewManager(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty vault
+	if err := manager.WalkManifests(func(*ManifestEntry) error {
+		t.Fatal("unexpected manifest")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Spans more than one directory batch
+	old := time.Now().Add(-time.Hour)
+	total := walkBatchSize + 10
+	for i := 0; i < total; i++ {
+		writeTestManifest(t, manifestsDir, fmt.Sprintf("%04d.yaml", i), &FileManifest{FilePath: fmt.Sprintf("f%04d.txt", i)}, old)
+	}
+
+	seen := map[string]bool{}
+	if err := manager.WalkManifests(func(entry *ManifestEntry) error {
+		seen[entry.Manifest.FilePath] = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != total {
+		t.Fatalf("expected %d manifests, got %d", total, len(seen))
+	}
+
+	// The walk indexed every manifest, so a corrupt file with an unchanged
+	// timestamp and size is served from the index
+	path := filepath.Join(manifestsDir, "0000.yaml")
+	info, _ := os.Stat(path)
+	if err := os.WriteFile(path, make([]byte, info.Size()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	if err := manager.WalkManifests(func(entry *ManifestEntry) error {
+		found = found || entry.Manifest.FilePath == "f0000.txt"
+		return nil
+	}); err != nil || !found {
+		t.Fatalf("expected f0000.txt from the index (%v)", err)
+	}
+
+	// fs.SkipAll stops the walk without an error
+	count := 0
+	if err := manager.WalkManifests(func(*ManifestEntry) error {
+		count++
+		if count == 3 {
+			return fs.SkipAll
+		}
+		return nil
+	}); err != nil || count != 3 {
+		t.Fatalf("expected the walk to stop after 3 manifests, got %d (%v)", count, err)
+	}
+
+	// Other errors are returned
+	stop := fmt.Errorf("stop")
+	if err := manager.WalkManifests(func(*ManifestEntry) error { return stop }); err != stop {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+}
+
+func TestContentIndex(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	chunks := []ChunkRef{{Hash: "h1", Size: 4}}
+	writeTestManifest(t, manifestsDir, "a.yaml", &FileManifest{FilePath: "a.txt", Size: 4, ContentHash: "c1", Chunks: chunks}, old)
+	writeTestManifest(t, manifestsDir, "b.yaml", &FileManifest{FilePath: "b.txt", Size: 4, Chunks: chunks}, old)
+	writeTestManifest(t, manifestsDir, "c.yaml", &FileManifest{FilePath: "c.txt", ContentHash: "c2", Symlink: "a.txt"}, old)
+
+	manager, err := NewManager(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := manager.ContentIndex()
+	if len(index) != 1 || index["c1"].FilePath != "a.txt" || len(index["c1"].Chunks) != 1 {
+		t.Fatalf("expected only a.txt to be indexed by content, got %+v", index)
+	}
+
+	byPath := manager.PathIndex()
+	if len(byPath) != 3 || byPath["c.txt"].Symlink != "a.txt" {
+		t.Fatalf("expected every manifest to be indexed by path, got %+v", byPath)
+	}
+}
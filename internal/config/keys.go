@@ -0,0 +1,335 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multiformats/go-multiaddr"
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// keyRule constrains the values accepted by a settable configuration key
+type keyRule struct {
+	values   []string           // allowed values, if the key is an enumeration
+	validate func(string) error // additional check on the raw value
+}
+
+// settableKeys lists the vault.yaml keys that may be changed after init.
+// Identity, encryption and hashing settings are fixed because existing chunks
+// depend on them, and trusted peers are managed by sync.
+var settableKeys = map[string]keyRule{
+	"name":                         {validate: nonEmpty},
+	"replica":                      {},
+	"compression":                  {values: []string{constants.CompressionTypeNone, constants.CompressionTypeGzip, constants.CompressionTypeZstd}},
+	"chunking.strategy":            {values: []string{"fixed", "cdc"}},
+	"chunking.chunk_size":          {validate: positiveSize},
+	"deduplication.enabled":        {},
+	"deduplication.strategy":       {values: []string{"content"}},
+	"deduplication.min_chunk_size": {validate: positiveSize},
+	"deduplication.max_chunk_size": {validate: positiveSize},
+	"deduplication.gc_threshold":   {validate: nonNegativeInt},
+	"deduplication.index_enabled":  {},
+	"sync.mode":                    {values: []string{"manual", "auto"}},
+	"sync.enabled":                 {},
+	"sync.auto_sync":               {},
+	"sync.sync_interval":           {validate: positiveDuration},
+	"sync.tombstone_retention":     {validate: positiveDuration},
+	"sync.max_streams":             {validate: nonNegativeInt},
+	"sync.max_peer_streams":        {validate: nonNegativeInt},
+	"sync.peer_request_rate":       {validate: nonNegativeInt},
+	"sync.network_key":             {},
+	"sync.listen_addrs":            {validate: listenAddrs},
+	"sync.transport_compression":   {values: []string{constants.CompressionTypeNone, constants.CompressionTypeZstd}},
+	"sync.timeouts.handshake":      {validate: positiveDuration},
+	"sync.timeouts.manifest":       {validate: positiveDuration},
+	"sync.timeouts.chunk":          {validate: positiveDuration},
+	"sync.timeouts.sync":           {validate: positiveDuration},
+	"sync.known_peers":             {},
+	"sync.replication_factor":      {validate: nonNegativeInt},
+	"sync.accept_replicas":         {},
+	"metadata.author":              {},
+	"metadata.tags":                {},
+	"cache.memory_size":            {validate: nonNegativeSize},
+	"cache.disk_size":              {validate: nonNegativeSize},
+	"hooks.timeout":                {validate: positiveDuration},
+	"trash.retention":              {validate: positiveDuration},
+	"parity.data_shards":           {validate: nonNegativeInt},
+	"parity.parity_shards":         {validate: nonNegativeInt},
+	"quota.soft":                   {validate: nonNegativeSize},
+	"quota.hard":                   {validate: nonNegativeSize},
+	"scrub.percent":                {validate: percentage},
+}
+
+// SettableKeys returns the configuration keys accepted by SetValue, sorted
+func SettableKeys() []string {
+	keys := make([]string, 0, len(settableKeys))
+	for key := range settableKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetValue returns the value of a dotted vault.yaml key such as
+// "sync.auto_sync". Scalars are formatted as they appear in vault.yaml and
+// sections are returned as YAML.
+func GetValue(cfg *VaultConfig, key string) (string, error) {
+	field, err := lookupKey(reflect.ValueOf(cfg).Elem(), key)
+	if err != nil {
+		return "", err
+	}
+
+	switch field.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Ptr:
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			return "", nil
+		}
+		if t, ok := field.Interface().(time.Time); ok {
+			return t.Format(time.RFC3339), nil
+		}
+		data, err := yaml.Marshal(field.Interface())
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal %s: %v", key, err)
+		}
+		return strings.TrimSuffix(string(data), "\n"), nil
+	default:
+		return fmt.Sprint(field.Interface()), nil
+	}
+}
+
+// SetValue validates value against the schema and assigns it to the dotted
+// key in cfg. Lists are given as comma-separated values. Only keys returned by
+// SettableKeys may be changed.
+func SetValue(cfg *VaultConfig, key, value string) error {
+	field, err := lookupKey(reflect.ValueOf(cfg).Elem(), key)
+	if err != nil {
+		return err
+	}
+	rule, ok := settableKeys[key]
+	if !ok {
+		return fmt.Errorf("%s is read-only", key)
+	}
+
+	if len(rule.values) > 0 && !slices.Contains(rule.values, value) {
+		return fmt.Errorf("invalid value %q for %s (allowed: %s)", value, key, strings.Join(rule.values, ", "))
+	}
+	if rule.validate != nil {
+		if err := rule.validate(value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+		}
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: expected true or false", value, key)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for %s: expected an integer", value, key)
+		}
+		field.SetInt(int64(n))
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s cannot be set from the command line", key)
+	}
+	return nil
+}
+
+// lookupKey walks the yaml tags of v along the dotted key
+func lookupKey(v reflect.Value, key string) (reflect.Value, error) {
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, fmt.Errorf("%s is not set", key)
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct || v.Type() == reflect.TypeOf(time.Time{}) {
+			return reflect.Value{}, fmt.Errorf("unknown configuration key: %s", key)
+		}
+
+		next, found := reflect.Value{}, false
+		for i := 0; i < v.NumField(); i++ {
+			if yamlName(v.Type().Field(i)) == part {
+				next, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown configuration key: %s", key)
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// yamlName returns the key yaml.v2 uses for a struct field
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+func nonEmpty(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("value cannot be empty")
+	}
+	return nil
+}
+
+func positiveSize(value string) error {
+	size, err := util.ParseChunkSize(value)
+	if err != nil {
+		return err
+	}
+	if size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	return nil
+}
+
+func nonNegativeSize(value string) error {
+	_, err := util.ParseChunkSize(value)
+	return err
+}
+
+func nonNegativeInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("expected an integer")
+	}
+	if n < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+// percentage accepts 0, for the default, to 100
+func percentage(value string) error {
+	if err := nonNegativeInt(value); err != nil {
+		return err
+	}
+	if n, _ := strconv.Atoi(value); n > 100 {
+		return fmt.Errorf("must be at most 100")
+	}
+	return nil
+}
+
+// listenAddrs accepts a comma-separated list of multiaddrs, or NoListenAddrs on its own
+func listenAddrs(value string) error {
+	for _, addr := range strings.Split(value, ",") {
+		switch addr = strings.TrimSpace(addr); addr {
+		case "":
+		case NoListenAddrs:
+			if strings.TrimSpace(value) != NoListenAddrs {
+				return fmt.Errorf("%q cannot be combined with addresses", NoListenAddrs)
+			}
+		default:
+			if _, err := multiaddr.NewMultiaddr(addr); err != nil {
+				return fmt.Errorf("invalid multiaddr %q", addr)
+			}
+		}
+	}
+	return nil
+}
+
+func positiveDuration(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	return nil
+}
+
+// fixedKeys constrains the keys that are set once, when a vault is created
+var fixedKeys = map[string]keyRule{
+	"encryption.type":            {values: []string{constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20, constants.EncryptionTypeGPG, constants.EncryptionTypeNone}},
+	"encryption.aes_config.mode": {values: []string{constants.AESModeGCM, constants.AESModeCBC}},
+	"encryption.aes_config.kdf":  {values: []string{constants.KDFScrypt, constants.KDFPBKDF2}},
+	"chunking.hash_algorithm":    {values: []string{constants.HashAlgorithmSHA256, constants.HashAlgorithmSHA512, constants.HashAlgorithmSHA1, constants.HashAlgorithmBLAKE3}},
+	"sync.rsa.key_size":          {validate: rsaKeySize},
+}
+
+// ValidateValues checks every set key of cfg against the rules SetValue and
+// init apply to it. Empty values are left to the defaults and not checked.
+func ValidateValues(cfg *VaultConfig) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, rules := range []map[string]keyRule{settableKeys, fixedKeys} {
+		keys := make([]string, 0, len(rules))
+		for key := range rules {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field, err := lookupKey(v, key)
+			if err != nil {
+				continue // An unset section such as encryption.aes_config
+			}
+			var value string
+			switch field.Kind() {
+			case reflect.Slice:
+				items := make([]string, field.Len())
+				for i := range items {
+					items[i] = fmt.Sprint(field.Index(i).Interface())
+				}
+				value = strings.Join(items, ",")
+			case reflect.Bool:
+				continue
+			default:
+				value = fmt.Sprint(field.Interface())
+			}
+			if value == "" || (field.Kind() == reflect.Int && value == "0") {
+				continue
+			}
+
+			rule := rules[key]
+			if len(rule.values) > 0 && !slices.Contains(rule.values, value) {
+				return fmt.Errorf("invalid value %q for %s (allowed: %s)", value, key, strings.Join(rule.values, ", "))
+			}
+			if rule.validate != nil {
+				if err := rule.validate(value); err != nil {
+					return fmt.Errorf("invalid value %q for %s: %v", value, key, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func rsaKeySize(value string) error {
+	bits, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("expected an integer")
+	}
+	if bits < constants.MinRSAKeySize {
+		return fmt.Errorf("must be at least %d bits", constants.MinRSAKeySize)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestGetValue(t *testing.T) {
+	cfg := &VaultConfig{Name: "dune", Compression: "gzip"}
+	cfg.Sync.AutoSync = true
+	cfg.Deduplication.GCThreshold = 42
+	cfg.Metadata.Tags = []string{"a", "b"}
+
+	tests := map[string]string{
+		"name":                       "dune",
+		"sync.auto_sync":             "true",
+		"deduplication.gc_threshold": "42",
+		"metadata.tags":              "- a\n- b",
+	}
+	for key, want := range tests {
+		got, err := GetValue(cfg, key)
+		if err != nil || got != want {
+			t.Errorf("GetValue(%q) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+
+	if _, err := GetValue(cfg, "sync.nope"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	if _, err := GetValue(cfg, "encryption.aes_config.mode"); err == nil {
+		t.Error("expected an error for a key under an unset section")
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	cfg := &VaultConfig{Name: "dune"}
+
+	valid := []struct{ key, value, want string }{
+		{"sync.auto_sync", "true", "true"},
+		{"deduplication.gc_threshold", "7", "7"},
+		{"compression", "zstd", "zstd"},
+		{"chunking.chunk_size", "2MB", "2MB"},
+		{"sync.sync_interval", "1h", "1h"},
+		{"sync.tombstone_retention", "720h", "720h"},
+		{"sync.max_peer_streams", "4", "4"},
+		{"sync.timeouts.chunk", "10m", "10m"},
+		{"sync.network_key", ".sietch/sync/swarm.key", ".sietch/sync/swarm.key"},
+		{"sync.listen_addrs", "/ip4/0.0.0.0/tcp/4001, /ip6/::/tcp/4001", "- /ip4/0.0.0.0/tcp/4001\n- /ip6/::/tcp/4001"},
+		{"sync.listen_addrs", "none", "- none"},
+		{"replica", "true", "true"},
+		{"metadata.tags", "x, w,,z", "- x\n- w\n- z"},
+		{"cache.disk_size", "1GB", "1GB"},
+		{"cache.memory_size", "0", "0"},
+		{"hooks.timeout", "2m", "2m"},
+		{"trash.retention", "720h", "720h"},
+		{"parity.data_shards", "20", "20"},
+		{"sync.replication_factor", "3", "3"},
+		{"sync.accept_replicas", "true", "true"},
+		{"quota.hard", "8GB", "8GB"},
+		{"scrub.percent", "25", "25"},
+	}
+	for _, tc := range valid {
+		if err := SetValue(cfg, tc.key, tc.value); err != nil {
+			t.Errorf("SetValue(%q, %q) failed: %v", tc.key, tc.value, err)
+			continue
+		}
+		if got, _ := GetValue(cfg, tc.key); got != tc.want {
+			t.Errorf("after SetValue(%q, %q) got %q, want %q", tc.key, tc.value, got, tc.want)
+		}
+	}
+
+	invalid := []struct{ key, value, errPart string }{
+		{"sync.auto_sync", "maybe", "expected true or false"},
+		{"deduplication.gc_threshold", "-1", "must not be negative"},
+		{"compression", "lz4", "allowed"},
+		{"chunking.chunk_size", "0", "positive"},
+		{"cache.disk_size", "-1MB", "negative"},
+		{"sync.sync_interval", "soon", "invalid value"},
+		{"sync.tombstone_retention", "0s", "positive"},
+		{"sync.timeouts.handshake", "-1m", "positive"},
+		{"sync.peer_request_rate", "-5", "must not be negative"},
+		{"hooks.timeout", "0s", "positive"},
+		{"trash.retention", "forever", "invalid"},
+		{"parity.parity_shards", "-1", "must not be negative"},
+		{"quota.soft", "lots", "invalid"},
+		{"scrub.percent", "150", "at most 100"},
+		{"hooks.post_add", "echo", "read-only"},
+		{"sync.listen_addrs", "0.0.0.0:4001", "invalid multiaddr"},
+		{"sync.listen_addrs", "none,/ip4/0.0.0.0/tcp/4001", "cannot be combined"},
+		{"name", " ", "empty"},
+		{"vault_id", "x", "read-only"},
+		{"chunking.hash_algorithm", "sha1", "read-only"},
+		{"sync.bogus", "x", "unknown configuration key"},
+	}
+	for _, tc := range invalid {
+		err := SetValue(cfg, tc.key, tc.value)
+		if err == nil || !strings.Contains(err.Error(), tc.errPart) {
+			t.Errorf("SetValue(%q, %q) = %v; want error containing %q", tc.key, tc.value, err, tc.errPart)
+		}
+	}
+	if cfg.Sync.AutoSync != true || cfg.Compression != "zstd" {
+		t.Error("rejected values must leave the configuration unchanged")
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	cfg := &VaultConfig{Name: "dune"}
+	if err := CheckWritable(cfg); err != nil {
+		t.Errorf("expected a regular vault to be writable: %v", err)
+	}
+	cfg.Replica = true
+	if err := CheckWritable(cfg); !errors.Is(err, ErrReadOnlyReplica) {
+		t.Errorf("expected ErrReadOnlyReplica for a replica, got %v", err)
+	}
+}
+
+func TestParseVaultConfig(t *testing.T) {
+	cfg := BuildDefaultVaultConfig("id", "dune", "")
+	cfg.SchemaVersion = CurrentSchemaVersion
+	cfg.Cache.MemorySize = "32MB"
+	exported, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseVaultConfig(exported)
+	if err != nil {
+		t.Fatalf("ParseVaultConfig of an exported config: %v", err)
+	}
+	if parsed.Name != "dune" || parsed.Chunking.ChunkSize != "4MB" || parsed.Cache.MemorySize != "32MB" {
+		t.Errorf("settings were not parsed: %+v", parsed)
+	}
+
+	invalid := map[string]string{
+		"unknown key":     "name: dune\nchunking:\n  stratgy: cdc\n",
+		"newer schema":    "schema_version: 999\n",
+		"bad enumeration": "compression: lzma\n",
+		"bad size":        "chunking:\n  chunk_size: huge\n",
+		"bad cipher":      "encryption:\n  type: rot13\n",
+		"small rsa key":   "sync:\n  rsa:\n    key_size: 512\n",
+	}
+	for name, data := range invalid {
+		if _, err := ParseVaultConfig([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := ParseVaultConfig([]byte("schema_version: 999\n")); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("expected ErrUnsupportedSchema, got %v", err)
+	}
+}
@@ -36,5 +36,26 @@ func LoadVaultConfig(vaultPath string) (*VaultConfig, error) {
 		return nil, fmt.Errorf("error parsing vault configuration: %w", err)
 	}
 
+	if err := checkSchemaVersion(&config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// ParseVaultConfig parses a vault.yaml exported from another vault and
+// validates it against the current schema. Unknown keys, a newer schema
+// version and invalid values are errors.
+func ParseVaultConfig(data []byte) (*VaultConfig, error) {
+	var config VaultConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing vault configuration: %w", err)
+	}
+	if err := checkSchemaVersion(&config); err != nil {
+		return nil, err
+	}
+	if err := ValidateValues(&config); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"gopkg.in/yaml.v2"
@@ -13,17 +14,25 @@ import (
 // Manager handles operations on a Sietch vault
 type Manager struct {
 	vaultRoot string
+
+	chunkDirOnce sync.Once
+	chunkDir     string
+	chunkFanout  int
 }
 
 // Manifest represents the content of a vault
 type Manifest struct {
-	Files []FileManifest `json:"files"`
+	Files      []FileManifest `json:"files"`
+	Tombstones []Tombstone    `json:"tombstones,omitempty"`
 }
 
 // ManifestEntry represents a manifest file with its path
 type ManifestEntry struct {
 	Path     string
 	Manifest FileManifest
+	// When the manifest last changed, not counting the sync and verification
+	// times rewritten by every sync; the file's modification time without an index
+	ChangedAt time.Time
 }
 
 // NewManager creates a new vault manager
@@ -35,82 +44,23 @@ func NewManager(vaultRoot string) (*Manager, error) {
 
 // GetManifest returns the vault manifest
 func (m *Manager) GetManifest() (*Manifest, error) {
-	manifestsDir := filepath.Join(m.vaultRoot, ".sietch", "manifests")
 	manifest := &Manifest{
 		Files: []FileManifest{},
 	}
-
-	// Ensure directory exists
-	if _, err := os.Stat(manifestsDir); os.IsNotExist(err) {
-		return manifest, nil // Return empty manifest if directory doesn't exist
+	for _, entry := range m.loadManifestEntries() {
+		manifest.Files = append(manifest.Files, entry.Manifest)
 	}
-
-	// Read all manifest files
-	entries, err := os.ReadDir(manifestsDir)
-	if err != nil {
-		return manifest, nil // Return empty manifest if error reading directory
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
-			continue
-		}
-
-		// Load the file manifest
-		filePath := filepath.Join(manifestsDir, entry.Name())
-		fileManifest, err := loadFileManifest(filePath)
-		if err != nil {
-			fmt.Printf("Warning: Failed to load manifest %s: %v\n", entry.Name(), err)
-			continue
-		}
-
-		manifest.Files = append(manifest.Files, *fileManifest)
-	}
-
 	return manifest, nil
 }
 
 // GetManifestEntries returns all manifest entries with their paths
 func (m *Manager) GetManifestEntries() ([]*ManifestEntry, error) {
-	manifestsDir := filepath.Join(m.vaultRoot, ".sietch", "manifests")
-	var entries []*ManifestEntry
-
-	// Ensure directory exists
-	if _, err := os.Stat(manifestsDir); os.IsNotExist(err) {
-		return entries, nil // Return empty if directory doesn't exist
-	}
-
-	// Read all manifest files
-	dirEntries, err := os.ReadDir(manifestsDir)
-	if err != nil {
-		return entries, nil // Return empty if error reading directory
-	}
-
-	for _, entry := range dirEntries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
-			continue
-		}
-
-		// Load the file manifest
-		filePath := filepath.Join(manifestsDir, entry.Name())
-		fileManifest, err := loadFileManifest(filePath)
-		if err != nil {
-			fmt.Printf("Warning: Failed to load manifest %s: %v\n", entry.Name(), err)
-			continue
-		}
-
-		entries = append(entries, &ManifestEntry{
-			Path:     filePath,
-			Manifest: *fileManifest,
-		})
-	}
-
-	return entries, nil
+	return m.loadManifestEntries(), nil
 }
 
 // GetChunk retrieves a chunk by its hash
 func (m *Manager) GetChunk(hash string) ([]byte, error) {
-	chunkPath := filepath.Join(m.vaultRoot, ".sietch", "chunks", hash)
+	chunkPath := m.locateChunk(hash)
 	fmt.Printf("chunk path %v\n", chunkPath) // Added newline here
 
 	// Check if chunk exists
@@ -124,11 +74,15 @@ func (m *Manager) GetChunk(hash string) ([]byte, error) {
 
 // StoreChunk stores a chunk in the vault
 func (m *Manager) StoreChunk(hash string, data []byte) error {
-	chunkPath := filepath.Join(m.vaultRoot, ".sietch", "chunks", hash)
-
-	// Ensure chunks directory exists
-	chunksDir := filepath.Join(m.vaultRoot, ".sietch", "chunks")
-	if err := os.MkdirAll(chunksDir, 0o755); err != nil {
+	// Ensure chunks directory exists, unless it is on a disk that is missing
+	chunksDir := m.chunkDirectory()
+	if chunksDir != filepath.Join(m.vaultRoot, ".sietch", "chunks") {
+		if _, err := os.Stat(chunksDir); err != nil {
+			return fmt.Errorf("chunk store %s is not available, check that its disk is mounted: %w", chunksDir, err)
+		}
+	}
+	chunkPath := filepath.Join(chunksDir, filepath.FromSlash(ShardedChunkName(hash, m.chunkFanout)))
+	if err := os.MkdirAll(filepath.Dir(chunkPath), 0o755); err != nil {
 		return fmt.Errorf("failed to create chunks directory: %v", err)
 	}
 
@@ -138,7 +92,7 @@ func (m *Manager) StoreChunk(hash string, data []byte) error {
 
 // ChunkExists checks if a chunk exists in the vault
 func (m *Manager) ChunkExists(hash string) (bool, error) {
-	chunkPath := filepath.Join(m.vaultRoot, ".sietch", "chunks", hash)
+	chunkPath := m.locateChunk(hash)
 	_, err := os.Stat(chunkPath)
 	if err == nil {
 		return true, nil
@@ -149,6 +103,25 @@ func (m *Manager) ChunkExists(hash string) (bool, error) {
 	return false, err
 }
 
+// ChunkAliases maps the plaintext hash of every encrypted chunk the manifests
+// reference to the name it is stored under, the hash of its ciphertext.
+// Each chunk is stored once, under that name; the alias finds it for lookups
+// that only know the plaintext hash.
+func (m *Manager) ChunkAliases() map[string]string {
+	aliases := make(map[string]string)
+	for _, entry := range m.loadManifestEntries() {
+		for _, ref := range entry.Manifest.Chunks {
+			if ref.EncryptedHash == "" || ref.EncryptedHash == ref.Hash {
+				continue
+			}
+			if _, ok := aliases[ref.Hash]; !ok {
+				aliases[ref.Hash] = ref.EncryptedHash
+			}
+		}
+	}
+	return aliases
+}
+
 // RebuildReferences rebuilds file references from manifests
 func (m *Manager) RebuildReferences() error {
 	// Get all manifest entries
@@ -167,6 +140,15 @@ func (m *Manager) RebuildReferences() error {
 			if err != nil {
 				return fmt.Errorf("failed to check chunk %s: %v", chunk.Hash, err)
 			}
+			// Encrypted chunks are stored under the hash of their ciphertext
+			if chunk.EncryptedHash != "" {
+				referenced[chunk.EncryptedHash] = true
+				if !exists {
+					if exists, err = m.ChunkExists(chunk.EncryptedHash); err != nil {
+						return fmt.Errorf("failed to check chunk %s: %v", chunk.EncryptedHash, err)
+					}
+				}
+			}
 			if !exists {
 				missing = append(missing, chunk.Hash)
 			}
@@ -174,28 +156,22 @@ func (m *Manager) RebuildReferences() error {
 	}
 
 	// Check for orphaned chunks
-	chunksDir := filepath.Join(m.vaultRoot, ".sietch", "chunks")
 	var orphaned []string
-	if _, err := os.Stat(chunksDir); !os.IsNotExist(err) {
-		dirEntries, err := os.ReadDir(chunksDir)
-		if err != nil {
-			return fmt.Errorf("failed to read chunks directory: %v", err)
-		}
-		for _, entry := range dirEntries {
-			if !entry.IsDir() {
-				hash := entry.Name()
-				if !referenced[hash] {
-					orphaned = append(orphaned, hash)
-				}
-			}
+	err = WalkChunks(m.chunkDirectory(), func(hash, _ string, _ os.DirEntry) error {
+		if !referenced[hash] {
+			orphaned = append(orphaned, hash)
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read chunks directory: %v", err)
 	}
 
 	// Update manifest metadata
 	now := time.Now()
 	for _, entry := range entries {
 		entry.Manifest.LastVerified = now
-		if err := saveFileManifest(entry.Path, &entry.Manifest); err != nil {
+		if err := m.saveFileManifest(entry.Path, &entry.Manifest); err != nil {
 			return fmt.Errorf("failed to save manifest %s: %v", entry.Path, err)
 		}
 	}
@@ -215,18 +191,40 @@ func (m *Manager) RebuildReferences() error {
 	return nil
 }
 
+// chunkDirectory returns the directory the vault keeps its chunks in, read
+// from vault.yaml along with its fanout the first time it is needed
+func (m *Manager) chunkDirectory() string {
+	m.chunkDirOnce.Do(func() {
+		m.chunkDir = filepath.Join(m.vaultRoot, ".sietch", "chunks")
+		if cfg, err := LoadVaultConfig(m.vaultRoot); err == nil {
+			m.chunkDir = cfg.ChunkDirectory(m.vaultRoot)
+			m.chunkFanout = min(max(cfg.ChunkFanout, 0), MaxChunkFanout)
+		}
+	})
+	return m.chunkDir
+}
+
+// locateChunk returns the path of the chunk named hash in the chunk store
+func (m *Manager) locateChunk(hash string) string {
+	dir := m.chunkDirectory()
+	return LocateChunk(dir, m.chunkFanout, hash)
+}
+
 // VaultRoot returns the root directory of the vault.
 func (m *Manager) VaultRoot() string {
 	return m.vaultRoot
 }
 
 // Helper function to load a file manifest
-func loadFileManifest(path string) (*FileManifest, error) {
+func (m *Manager) loadFileManifest(path string) (*FileManifest, error) {
 	// Read manifest file
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read manifest file: %v", err)
 	}
+	if data, err = OpenMetadata(m.vaultRoot, data); err != nil {
+		return nil, err
+	}
 
 	// Parse YAML content
 	var manifest FileManifest
@@ -238,12 +236,15 @@ func loadFileManifest(path string) (*FileManifest, error) {
 }
 
 // Helper function to save a file manifest
-func saveFileManifest(path string, manifest *FileManifest) error {
+func (m *Manager) saveFileManifest(path string, manifest *FileManifest) error {
 	// Marshal to YAML
 	data, err := yaml.Marshal(manifest)
 	if err != nil {
 		return fmt.Errorf("failed to marshal manifest: %v", err)
 	}
+	if data, err = SealMetadata(m.vaultRoot, data); err != nil {
+		return err
+	}
 
 	// Write to file
 	return os.WriteFile(path, data, 0o644)
@@ -270,6 +271,10 @@ func (m *Manager) GetConfig() (*VaultConfig, error) {
 		return nil, fmt.Errorf("failed to parse configuration: %v", err)
 	}
 
+	if err := checkSchemaVersion(&config); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
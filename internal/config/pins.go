@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrustedPeer returns the trusted peer with the given ID, or nil
+func (r *RSAConfig) TrustedPeer(id string) *TrustedPeer {
+	if r == nil {
+		return nil
+	}
+	for i := range r.TrustedPeers {
+		if r.TrustedPeers[i].ID == id {
+			return &r.TrustedPeers[i]
+		}
+	}
+	return nil
+}
+
+// KeyChanged reports whether the peer presented a key other than its pinned one
+func (p *TrustedPeer) KeyChanged() bool {
+	return p.PendingFingerprint != ""
+}
+
+// Repin replaces the pinned key of the peer with the pending one. If
+// fingerprint is not empty, the pending key must have it.
+func (p *TrustedPeer) Repin(fingerprint string) error {
+	if !p.KeyChanged() {
+		return fmt.Errorf("peer %s has presented no other key than its pinned one", p.ID)
+	}
+	if fingerprint != "" && fingerprint != p.PendingFingerprint {
+		return fmt.Errorf("the new key of peer %s has fingerprint %s, not %s", p.ID, p.PendingFingerprint, fingerprint)
+	}
+	p.PublicKey = p.PendingPublicKey
+	p.Fingerprint = p.PendingFingerprint
+	p.PendingPublicKey = ""
+	p.PendingFingerprint = ""
+	p.KeyChangedAt = time.Time{}
+	return nil
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Vaults with encryption.encrypt_manifests set store their file manifests, the
+// manifest index and the deduplication index sealed with AES-256-GCM under a
+// key derived from the vault key. Manifest file names, a plain hash of each
+// file's path that would otherwise reveal which paths a vault holds, are
+// replaced by a keyed hash of that path.
+
+// sealedMagic prefixes every sealed file so plaintext files written before
+// manifests were encrypted can still be read
+var sealedMagic = []byte("SIETCH-SEALED-1\n")
+
+// ErrMetadataLocked is returned when a vault's metadata is encrypted and its key cannot be loaded
+var ErrMetadataLocked = errors.New("vault metadata is encrypted and the vault key is not available")
+
+// MetadataKeyLoader returns the encryption key of a vault that encrypts its
+// manifests. It is set by the command layer, which knows where keys are kept
+// and how to ask for a passphrase.
+var MetadataKeyLoader func(vaultRoot string, cfg *VaultConfig) ([]byte, error)
+
+// metadataSealer holds the derived keys of one vault. Disabled sealers pass
+// data through unchanged.
+type metadataSealer struct {
+	enabled bool
+	aead    cipher.AEAD
+	nameKey []byte
+	err     error
+}
+
+var (
+	sealersMu sync.Mutex
+	sealers   = make(map[string]*metadataSealer)
+)
+
+// sealerFor returns the sealer for the vault at vaultRoot, loading its key the
+// first time it is needed. Vaults whose configuration cannot be read are
+// treated as unencrypted and not cached, so a vault created later in the same
+// process is picked up.
+func sealerFor(vaultRoot string) *metadataSealer {
+	root := filepath.Clean(vaultRoot)
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+
+	sealersMu.Lock()
+	defer sealersMu.Unlock()
+	if s, ok := sealers[root]; ok {
+		return s
+	}
+
+	cfg, err := (&Manager{vaultRoot: root}).GetConfig()
+	if err != nil {
+		return &metadataSealer{}
+	}
+
+	s := &metadataSealer{enabled: cfg.Encryption.EncryptManifests}
+	if s.enabled {
+		if MetadataKeyLoader == nil {
+			s.err = ErrMetadataLocked
+		} else if key, err := MetadataKeyLoader(root, cfg); err != nil {
+			s.err = fmt.Errorf("%w: %v", ErrMetadataLocked, err)
+		} else {
+			s.aead, s.nameKey, s.err = deriveMetadataKeys(key)
+		}
+	}
+	sealers[root] = s
+	return s
+}
+
+// deriveMetadataKeys derives the metadata encryption key and the manifest name
+// key from the vault key, so neither is the key that encrypts chunks
+func deriveMetadataKeys(vaultKey []byte) (cipher.AEAD, []byte, error) {
+	if len(vaultKey) == 0 {
+		return nil, nil, fmt.Errorf("%w: empty vault key", ErrMetadataLocked)
+	}
+
+	kdf := hkdf.New(sha256.New, vaultKey, nil, []byte("sietch metadata v1"))
+	encKey := make([]byte, 32)
+	nameKey := make([]byte, 32)
+	if _, err := io.ReadFull(kdf, encKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(kdf, nameKey); err != nil {
+		return nil, nil, err
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, nameKey, nil
+}
+
+// MetadataEncrypted reports whether the vault at vaultRoot encrypts its manifests
+func MetadataEncrypted(vaultRoot string) bool {
+	return sealerFor(vaultRoot).enabled
+}
+
+// SealMetadata encrypts manifest or index data for storage in the vault at
+// vaultRoot. Data is returned unchanged for vaults that do not encrypt manifests.
+func SealMetadata(vaultRoot string, data []byte) ([]byte, error) {
+	s := sealerFor(vaultRoot)
+	if !s.enabled {
+		return data, nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return seal(s.aead, data)
+}
+
+// OpenMetadata decrypts data read from the vault at vaultRoot. Plaintext data
+// is returned unchanged, so vaults keep reading files written before their
+// manifests were encrypted.
+func OpenMetadata(vaultRoot string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, sealedMagic) {
+		return data, nil
+	}
+
+	s := sealerFor(vaultRoot)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if !s.enabled {
+		return nil, fmt.Errorf("%w: vault configuration does not enable encrypted manifests", ErrMetadataLocked)
+	}
+	return open(s.aead, data)
+}
+
+// SealWithKey seals data under the metadata key derived from vaultKey,
+// whether or not the vault encrypts its manifests. It protects metadata that
+// leaves the vault, such as bundles handed to a mule.
+func SealWithKey(vaultKey, data []byte) ([]byte, error) {
+	aead, _, err := deriveMetadataKeys(vaultKey)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, data)
+}
+
+// OpenWithKey decrypts data sealed by SealWithKey
+func OpenWithKey(vaultKey, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, sealedMagic) {
+		return nil, fmt.Errorf("data is not sealed")
+	}
+	aead, _, err := deriveMetadataKeys(vaultKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, data)
+}
+
+func seal(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	sealed := make([]byte, 0, len(sealedMagic)+len(nonce)+len(data)+aead.Overhead())
+	sealed = append(sealed, sealedMagic...)
+	sealed = append(sealed, nonce...)
+	return aead.Seal(sealed, nonce, data, sealedMagic), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	body := data[len(sealedMagic):]
+	if len(body) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed metadata is truncated")
+	}
+	nonce, ciphertext := body[:aead.NonceSize()], body[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, sealedMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt metadata: %v", err)
+	}
+	return plain, nil
+}
+
+// ManifestFileName returns the name of the manifest file for fileName stored
+// under destination in the vault at vaultRoot. Names are a hash of the
+// file's vault path, so distinct paths never share a manifest; the path
+// itself is recorded in the manifest, which the manifest index caches by
+// file name.
+func ManifestFileName(vaultRoot, destination, fileName string) (string, error) {
+	return manifestNameFor(vaultRoot, destination+fileName)
+}
+
+// manifestNameFor returns the manifest file name of vaultPath: its SHA-256,
+// or in vaults that encrypt their manifests a keyed hash of it
+func manifestNameFor(vaultRoot, vaultPath string) (string, error) {
+	s := sealerFor(vaultRoot)
+	if !s.enabled {
+		sum := sha256.Sum256([]byte(vaultPath))
+		return hex.EncodeToString(sum[:]) + ".yaml", nil
+	}
+	if s.err != nil {
+		return "", s.err
+	}
+
+	mac := hmac.New(sha256.New, s.nameKey)
+	mac.Write([]byte(vaultPath))
+	return hex.EncodeToString(mac.Sum(nil)) + ".yaml", nil
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSealedVault writes a vault configuration with encrypted manifests on or off
+func newSealedVault(t *testing.T, encrypt bool) string {
+	t.Helper()
+	root := t.TempDir()
+	cfg := "name: test\nencryption:\n  type: aes\n"
+	if encrypt {
+		cfg += "  encrypt_manifests: true\n"
+	}
+	if err := os.WriteFile(filepath.Join(root, "vault.yaml"), []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// setMetadataKeyLoader replaces MetadataKeyLoader for the duration of the test
+func setMetadataKeyLoader(t *testing.T, loader func(string, *VaultConfig) ([]byte, error)) {
+	t.Helper()
+	previous := MetadataKeyLoader
+	MetadataKeyLoader = loader
+	t.Cleanup(func() { MetadataKeyLoader = previous })
+}
+
+func TestSealMetadataRoundTrip(t *testing.T) {
+	setMetadataKeyLoader(t, func(string, *VaultConfig) ([]byte, error) {
+		return bytes.Repeat([]byte{7}, 32), nil
+	})
+	root := newSealedVault(t, true)
+
+	if !MetadataEncrypted(root) {
+		t.Fatal("expected vault to encrypt its manifests")
+	}
+
+	plain := []byte("file: docs/secret-plans.txt\n")
+	sealed, err := SealMetadata(root, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret-plans")) {
+		t.Error("sealed data contains the plaintext")
+	}
+
+	opened, err := OpenMetadata(root, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plain) {
+		t.Errorf("OpenMetadata() = %q, want %q", opened, plain)
+	}
+
+	// Files written before manifests were encrypted are still readable
+	if opened, err := OpenMetadata(root, plain); err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("expected plaintext to pass through, got %q (%v)", opened, err)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := OpenMetadata(root, tampered); err == nil {
+		t.Error("expected tampered data to fail to decrypt")
+	}
+
+	name, err := ManifestFileName(root, "docs/", "secret-plans.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name == "docs.secret-plans.txt.yaml" || filepath.Ext(name) != ".yaml" {
+		t.Errorf("expected an opaque manifest name, got %q", name)
+	}
+	if again, _ := ManifestFileName(root, "docs/", "secret-plans.txt"); again != name {
+		t.Errorf("manifest name is not stable: %q then %q", name, again)
+	}
+}
+
+func TestSealMetadataPlaintextVault(t *testing.T) {
+	setMetadataKeyLoader(t, func(string, *VaultConfig) ([]byte, error) {
+		t.Fatal("key should not be loaded for a vault that does not encrypt manifests")
+		return nil, nil
+	})
+	root := newSealedVault(t, false)
+
+	plain := []byte("file: a.txt\n")
+	if sealed, err := SealMetadata(root, plain); err != nil || !bytes.Equal(sealed, plain) {
+		t.Errorf("expected data to be stored unchanged, got %q (%v)", sealed, err)
+	}
+	name, err := ManifestFileName(root, "docs/", "a.txt")
+	if err != nil || len(name) != 64+len(".yaml") || filepath.Ext(name) != ".yaml" {
+		t.Errorf("ManifestFileName() = %q, %v, want a path hash", name, err)
+	}
+	// Joining the path with dots would give these the same name
+	a, _ := ManifestFileName(root, "a/b/", "c.txt")
+	b, _ := ManifestFileName(root, "a.b/", "c.txt")
+	if a == b {
+		t.Errorf("a/b/c.txt and a.b/c.txt share the manifest name %q", a)
+	}
+}
+
+func TestSealMetadataWithoutKey(t *testing.T) {
+	setMetadataKeyLoader(t, nil)
+	root := newSealedVault(t, true)
+
+	if _, err := SealMetadata(root, []byte("data")); !errors.Is(err, ErrMetadataLocked) {
+		t.Errorf("expected ErrMetadataLocked without a key loader, got %v", err)
+	}
+	if _, err := ManifestFileName(root, "", "a.txt"); !errors.Is(err, ErrMetadataLocked) {
+		t.Errorf("expected ErrMetadataLocked for manifest names, got %v", err)
+	}
+}
+
+func TestSealWithKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	plain := []byte(`{"manifest":{}}`)
+
+	sealed, err := SealWithKey(key, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("manifest")) {
+		t.Error("sealed data must not contain the plaintext")
+	}
+	if opened, err := OpenWithKey(key, sealed); err != nil || !bytes.Equal(opened, plain) {
+		t.Errorf("OpenWithKey() = %q, %v", opened, err)
+	}
+	if _, err := OpenWithKey(bytes.Repeat([]byte{8}, 32), sealed); err == nil {
+		t.Error("expected another key to fail to open the data")
+	}
+	if _, err := OpenWithKey(key, plain); err == nil {
+		t.Error("expected plaintext to be rejected")
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultTombstoneRetention is how long tombstones are kept when
+// sync.tombstone_retention is not set. A peer that has not synced for longer
+// than this can bring a deleted file back.
+const DefaultTombstoneRetention = 30 * 24 * time.Hour
+
+// Tombstone records that a file was deleted, so that syncing removes it from
+// peers instead of copying it back. Tombstones are kept in .sietch/tombstones
+// under the name of the manifest they replace.
+type Tombstone struct {
+	FilePath    string    `yaml:"file"`
+	Destination string    `yaml:"destination"`
+	Tags        []string  `yaml:"tags,omitempty"` // Tags of the deleted file, so access rules by tag still apply
+	DeletedAt   time.Time `yaml:"deleted_at"`     // When the file was deleted, on the vault that deleted it
+	RecordedAt  time.Time `yaml:"recorded_at"`    // When this vault stored the tombstone
+}
+
+// NewTombstone returns the tombstone for deleting file now
+func NewTombstone(file *FileManifest) *Tombstone {
+	now := time.Now().UTC()
+	return &Tombstone{
+		FilePath:    file.FilePath,
+		Destination: file.Destination,
+		Tags:        file.Tags,
+		DeletedAt:   now,
+		RecordedAt:  now,
+	}
+}
+
+// Covers reports whether the tombstone deletes file: it is at the same path
+// and was added no later than the deletion, so a file added again afterwards
+// is kept
+func (t *Tombstone) Covers(file *FileManifest) bool {
+	return file.Destination+file.FilePath == t.Destination+t.FilePath && !file.AddedAt.After(t.DeletedAt)
+}
+
+// TombstoneRelPath returns the vault-relative path of the tombstone for
+// fileName stored under destination
+func TombstoneRelPath(vaultRoot, destination, fileName string) (string, error) {
+	name, err := ManifestFileName(vaultRoot, destination, fileName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(filepath.Join(".sietch", "tombstones", name)), nil
+}
+
+// EncodeTombstone returns the file contents of a tombstone, sealed in vaults
+// that encrypt their manifests
+func EncodeTombstone(vaultRoot string, t *Tombstone) ([]byte, error) {
+	data, err := yaml.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tombstone: %v", err)
+	}
+	return SealMetadata(vaultRoot, data)
+}
+
+// Tombstones returns the tombstones recorded in the vault
+func (m *Manager) Tombstones() ([]Tombstone, error) {
+	dir := filepath.Join(m.vaultRoot, ".sietch", "tombstones")
+	dirEntries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tombstones: %v", err)
+	}
+
+	var tombstones []Tombstone
+	for _, entry := range dirEntries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		t, err := m.loadTombstone(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			fmt.Printf("Warning: Failed to load tombstone %s: %v\n", entry.Name(), err)
+			continue
+		}
+		tombstones = append(tombstones, *t)
+	}
+	return tombstones, nil
+}
+
+func (m *Manager) loadTombstone(path string) (*Tombstone, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = OpenMetadata(m.vaultRoot, data); err != nil {
+		return nil, err
+	}
+	var t Tombstone
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse tombstone: %v", err)
+	}
+	return &t, nil
+}
+
+// SaveTombstone records a tombstone received from another vault. An existing
+// tombstone for the same path is only replaced by a later deletion. It
+// reports whether the tombstone was stored.
+func (m *Manager) SaveTombstone(t *Tombstone) (bool, error) {
+	rel, err := TombstoneRelPath(m.vaultRoot, t.Destination, t.FilePath)
+	if err != nil {
+		return false, err
+	}
+	path := filepath.Join(m.vaultRoot, filepath.FromSlash(rel))
+	if existing, err := m.loadTombstone(path); err == nil && !t.DeletedAt.After(existing.DeletedAt) {
+		return false, nil
+	}
+
+	stored := *t
+	stored.RecordedAt = time.Now().UTC()
+	data, err := EncodeTombstone(m.vaultRoot, &stored)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, fmt.Errorf("failed to create tombstones directory: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return false, fmt.Errorf("failed to write tombstone: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("failed to write tombstone: %v", err)
+	}
+	return true, nil
+}
+
+// PruneTombstones removes tombstones of deletions older than retention and
+// returns how many were removed
+func (m *Manager) PruneTombstones(retention time.Duration) (int, error) {
+	dir := filepath.Join(m.vaultRoot, ".sietch", "tombstones")
+	dirEntries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read tombstones: %v", err)
+	}
+
+	pruned := 0
+	cutoff := time.Now().Add(-retention)
+	for _, entry := range dirEntries {
+		path := filepath.Join(dir, entry.Name())
+		t, err := m.loadTombstone(path)
+		if err != nil || !t.DeletedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return pruned, fmt.Errorf("failed to remove tombstone: %v", err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// TombstoneRetention returns how long tombstones are kept
+func (s *SyncConfig) TombstoneRetention() time.Duration {
+	if d, err := time.ParseDuration(s.TombstoneRetentionPeriod); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTombstoneRetention
+}
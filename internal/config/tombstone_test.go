@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTombstones(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manifestsDir := filepath.Join(vaultRoot, ".sietch", "manifests")
+	if err := os.MkdirAll(manifestsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestManifest(t, manifestsDir, "a.yaml", &FileManifest{FilePath: "a.txt", Destination: "docs/"}, time.Now())
+	manager, err := NewManager(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deletedAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	stone := &Tombstone{FilePath: "a.txt", Destination: "docs/", DeletedAt: deletedAt}
+	if saved, err := manager.SaveTombstone(stone); err != nil || !saved {
+		t.Fatalf("SaveTombstone = %v, %v", saved, err)
+	}
+	earlier := *stone
+	earlier.DeletedAt = deletedAt.Add(-time.Minute)
+	if saved, err := manager.SaveTombstone(&earlier); err != nil || saved {
+		t.Fatalf("an earlier deletion must not replace the tombstone: %v, %v", saved, err)
+	}
+
+	tombstones, err := manager.Tombstones()
+	if err != nil || len(tombstones) != 1 {
+		t.Fatalf("Tombstones = %v, %v", tombstones, err)
+	}
+	if !tombstones[0].DeletedAt.Equal(deletedAt) || tombstones[0].RecordedAt.IsZero() {
+		t.Fatalf("unexpected tombstone %+v", tombstones[0])
+	}
+
+	if !stone.Covers(&FileManifest{FilePath: "a.txt", Destination: "docs/", AddedAt: deletedAt.Add(-time.Hour)}) {
+		t.Error("tombstone should cover a file added before the deletion")
+	}
+	if stone.Covers(&FileManifest{FilePath: "a.txt", Destination: "docs/", AddedAt: deletedAt.Add(time.Second)}) {
+		t.Error("tombstone must not cover a file added again after the deletion")
+	}
+	if stone.Covers(&FileManifest{FilePath: "a.txt", Destination: "other/"}) {
+		t.Error("tombstone must not cover a file at another path")
+	}
+
+	if pruned, err := manager.PruneTombstones(2 * time.Hour); err != nil || pruned != 0 {
+		t.Fatalf("PruneTombstones kept within retention = %d, %v", pruned, err)
+	}
+	if pruned, err := manager.PruneTombstones(time.Minute); err != nil || pruned != 1 {
+		t.Fatalf("PruneTombstones past retention = %d, %v", pruned, err)
+	}
+	if tombstones, _ := manager.Tombstones(); len(tombstones) != 0 {
+		t.Fatalf("expected no tombstones after pruning, got %v", tombstones)
+	}
+}
+
+func TestTombstoneRetention(t *testing.T) {
+	if got := (&SyncConfig{}).TombstoneRetention(); got != DefaultTombstoneRetention {
+		t.Errorf("default retention = %v", got)
+	}
+	if got := (&SyncConfig{TombstoneRetentionPeriod: "48h"}).TombstoneRetention(); got != 48*time.Hour {
+		t.Errorf("retention = %v, want 48h", got)
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultTrashRetention is how long deleted files stay in the trash when
+// trash.retention is not set
+const DefaultTrashRetention = 7 * 24 * time.Hour
+
+// TrashEntry is a deleted file kept in .sietch/trash until it expires, so
+// that it can be restored. The chunks of entries that have not expired are
+// kept by garbage collection as if the file were still stored.
+type TrashEntry struct {
+	ID        string       `yaml:"id" json:"id"`
+	DeletedAt time.Time    `yaml:"deleted_at" json:"deleted_at"`
+	ExpiresAt time.Time    `yaml:"expires_at" json:"expires_at"`
+	Manifest  FileManifest `yaml:"manifest" json:"-"`
+}
+
+// NewTrashEntry returns the trash entry for deleting file now, kept for retention
+func NewTrashEntry(file *FileManifest, retention time.Duration) *TrashEntry {
+	now := time.Now().UTC()
+	sum := sha256.Sum256([]byte(file.Destination + file.FilePath + "\x00" + strconv.FormatInt(now.UnixNano(), 10)))
+	return &TrashEntry{
+		ID:        hex.EncodeToString(sum[:4]),
+		DeletedAt: now,
+		ExpiresAt: now.Add(retention),
+		Manifest:  *file,
+	}
+}
+
+// Path returns the vault path the entry's file was deleted from
+func (e *TrashEntry) Path() string {
+	return e.Manifest.Destination + e.Manifest.FilePath
+}
+
+// Expired reports whether the entry is past its retention at now
+func (e *TrashEntry) Expired(now time.Time) bool {
+	return !now.Before(e.ExpiresAt)
+}
+
+// TrashRelPath returns the vault-relative path of the trash entry with id
+func TrashRelPath(id string) string {
+	return filepath.ToSlash(filepath.Join(".sietch", "trash", id+".yaml"))
+}
+
+// EncodeTrashEntry returns the file contents of a trash entry, sealed in
+// vaults that encrypt their manifests
+func EncodeTrashEntry(vaultRoot string, e *TrashEntry) ([]byte, error) {
+	data, err := yaml.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal trash entry: %v", err)
+	}
+	return SealMetadata(vaultRoot, data)
+}
+
+// Trash returns the files in the vault's trash, most recently deleted first
+func (m *Manager) Trash() ([]TrashEntry, error) {
+	dir := filepath.Join(m.vaultRoot, ".sietch", "trash")
+	dirEntries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash: %v", err)
+	}
+
+	var entries []TrashEntry
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || filepath.Ext(dirEntry.Name()) != ".yaml" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, dirEntry.Name()))
+		if err == nil {
+			data, err = OpenMetadata(m.vaultRoot, data)
+		}
+		var e TrashEntry
+		if err == nil {
+			err = yaml.Unmarshal(data, &e)
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to load trash entry %s: %v\n", dirEntry.Name(), err)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DeletedAt.After(entries[j].DeletedAt) })
+	return entries, nil
+}
+
+// TrashedFiles returns the manifests of the files in the trash that have not
+// expired, whose chunks are kept
+func (m *Manager) TrashedFiles() ([]FileManifest, error) {
+	trash, err := m.Trash()
+	if err != nil {
+		return nil, err
+	}
+	var files []FileManifest
+	now := time.Now()
+	for _, e := range trash {
+		if !e.Expired(now) {
+			files = append(files, e.Manifest)
+		}
+	}
+	return files, nil
+}
+
+// ReferencingFiles returns the files whose chunks must be kept: every stored
+// file and every file in the trash that has not expired
+func (m *Manager) ReferencingFiles() ([]FileManifest, error) {
+	manifest, err := m.GetManifest()
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := m.TrashedFiles()
+	if err != nil {
+		return nil, err
+	}
+	return append(manifest.Files, trashed...), nil
+}
+
+// RetentionPeriod returns how long deleted files are kept in the trash
+func (t *TrashConfig) RetentionPeriod() time.Duration {
+	if d, err := time.ParseDuration(t.Retention); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTrashRetention
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestTrashEntry(t *testing.T, vaultRoot string, e *TrashEntry) {
+	t.Helper()
+	data, err := EncodeTrashEntry(vaultRoot, e)
+	if err != nil {
+		t.Fatalf("encode trash entry: %v", err)
+	}
+	path := filepath.Join(vaultRoot, filepath.FromSlash(TrashRelPath(e.ID)))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write trash entry: %v", err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	vaultRoot := t.TempDir()
+	manager := &Manager{vaultRoot: vaultRoot}
+
+	if entries, err := manager.Trash(); err != nil || len(entries) != 0 {
+		t.Fatalf("empty trash = %v, %v", entries, err)
+	}
+
+	kept := NewTrashEntry(&FileManifest{FilePath: "a.txt", Destination: "docs/", Chunks: []ChunkRef{{Hash: "h1"}}}, time.Hour)
+	expired := NewTrashEntry(&FileManifest{FilePath: "b.txt", Destination: "docs/", Chunks: []ChunkRef{{Hash: "h2"}}}, time.Hour)
+	expired.DeletedAt = kept.DeletedAt.Add(-2 * time.Hour)
+	expired.ExpiresAt = kept.DeletedAt.Add(-time.Hour)
+	writeTestTrashEntry(t, vaultRoot, kept)
+	writeTestTrashEntry(t, vaultRoot, expired)
+
+	if kept.Path() != "docs/a.txt" {
+		t.Errorf("Path = %q, want docs/a.txt", kept.Path())
+	}
+	if kept.Expired(time.Now()) || !expired.Expired(time.Now()) {
+		t.Errorf("Expired: kept %v, expired %v", kept.Expired(time.Now()), expired.Expired(time.Now()))
+	}
+
+	entries, err := manager.Trash()
+	if err != nil {
+		t.Fatalf("Trash: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != kept.ID || entries[1].ID != expired.ID {
+		t.Fatalf("Trash = %+v, want the kept entry then the expired one", entries)
+	}
+	if entries[0].Manifest.Chunks[0].Hash != "h1" {
+		t.Errorf("trashed manifest not read back: %+v", entries[0].Manifest)
+	}
+
+	files, err := manager.TrashedFiles()
+	if err != nil {
+		t.Fatalf("TrashedFiles: %v", err)
+	}
+	if len(files) != 1 || files[0].FilePath != "a.txt" {
+		t.Errorf("TrashedFiles = %+v, want only a.txt", files)
+	}
+}
+
+func TestTrashRetentionPeriod(t *testing.T) {
+	tests := []struct {
+		retention string
+		want      time.Duration
+	}{
+		{"", DefaultTrashRetention},
+		{"720h", 720 * time.Hour},
+		{"-1h", DefaultTrashRetention},
+		{"forever", DefaultTrashRetention},
+	}
+	for _, tt := range tests {
+		cfg := TrashConfig{Retention: tt.retention}
+		if got := cfg.RetentionPeriod(); got != tt.want {
+			t.Errorf("RetentionPeriod(%q) = %v, want %v", tt.retention, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"time"
@@ -8,12 +9,32 @@ import (
 	"github.com/substantialcattle5/sietch/internal/constants"
 )
 
+// CurrentSchemaVersion is the vault layout written by this build. Older vaults
+// are upgraded by the migrations in internal/migrate.
+const CurrentSchemaVersion = 4
+
+// ErrUnsupportedSchema is returned when a vault was written by a newer sietch
+var ErrUnsupportedSchema = errors.New("unsupported vault schema version")
+
+// ErrReadOnlyReplica is returned by commands that would change a replica vault
+var ErrReadOnlyReplica = errors.New("vault is a read-only replica")
+
+// CheckWritable returns ErrReadOnlyReplica if the vault is a replica, whose
+// content may only change by syncing from its source
+func CheckWritable(cfg *VaultConfig) error {
+	if cfg.Replica {
+		return fmt.Errorf("%w: make changes in the source vault and sync them here, or run 'sietch config set replica false'", ErrReadOnlyReplica)
+	}
+	return nil
+}
+
 // VaultConfig represents the structure for vault.yaml
 type VaultConfig struct {
 	Name          string    `yaml:"name"`
 	VaultID       string    `yaml:"vault_id"`
 	CreatedAt     time.Time `yaml:"created_at"`
 	SchemaVersion int       `yaml:"schema_version"`
+	Replica       bool      `yaml:"replica,omitempty"` // Read-only copy that only changes by syncing
 
 	Encryption    EncryptionConfig    `yaml:"encryption"`
 	Chunking      ChunkingConfig      `yaml:"chunking"`
@@ -21,6 +42,34 @@ type VaultConfig struct {
 	Deduplication DeduplicationConfig `yaml:"deduplication"`
 	Sync          SyncConfig          `yaml:"sync"`
 	Metadata      MetadataConfig      `yaml:"metadata"`
+	Cache         CacheConfig         `yaml:"cache,omitempty"`
+	Hooks         HooksConfig         `yaml:"hooks,omitempty"`
+	Trash         TrashConfig         `yaml:"trash,omitempty"`
+	Parity        ParityConfig        `yaml:"parity,omitempty"`
+	Quota         QuotaConfig         `yaml:"quota,omitempty"`
+	Scrub         ScrubConfig         `yaml:"scrub,omitempty"`
+
+	// Directory chunks are kept in instead of .sietch/chunks, such as on a
+	// larger disk; relative paths are relative to the vault. Set at init.
+	ChunkStore string `yaml:"chunk_store,omitempty"`
+
+	// Levels of two-character directories chunks are spread over, 0 to 2, so
+	// no directory holds more than a few thousand of them; 2 keeps the chunk
+	// abcdef... in ab/cd/abcdef.... Changed with 'sietch reshard'.
+	ChunkFanout int `yaml:"chunk_fanout,omitempty"`
+}
+
+// ChunkDirectory returns the directory the vault at vaultRoot keeps its
+// chunks in
+func (c *VaultConfig) ChunkDirectory(vaultRoot string) string {
+	switch {
+	case c.ChunkStore == "":
+		return filepath.Join(vaultRoot, ".sietch", "chunks")
+	case filepath.IsAbs(c.ChunkStore):
+		return c.ChunkStore
+	default:
+		return filepath.Join(vaultRoot, c.ChunkStore)
+	}
 }
 
 // EncryptionConfig contains encryption settings
@@ -29,18 +78,19 @@ type EncryptionConfig struct {
 	KeyPath             string        `yaml:"key_path"`
 	KeyHash             string        `yaml:"key_hash,omitempty"` // Fingerprint of the key
 	PassphraseProtected bool          `yaml:"passphrase_protected"`
-	KeyFile             bool          `yaml:"key_file,omitempty"`        // Whether key comes from file
-	KeyFilePath         string        `yaml:"key_file_path,omitempty"`   // Path to key file
-	RandomKey           bool          `yaml:"random_key,omitempty"`      // Whether key was randomly generated
-	KeyBackupPath       string        `yaml:"key_backup_path,omitempty"` // Where key is backed up
-	AESConfig           *AESConfig    `yaml:"aes_config,omitempty"`      // AES specific settings
-	GPGConfig           *GPGConfig    `yaml:"gpg_config,omitempty"`      // GPG specific settings
-	ChaChaConfig        *ChaChaConfig `yaml:"chacha_config,omitempty"`   // ChaCha20 specific settings
+	KeyFile             bool          `yaml:"key_file,omitempty"`          // Whether key comes from file
+	KeyFilePath         string        `yaml:"key_file_path,omitempty"`     // Path to key file
+	RandomKey           bool          `yaml:"random_key,omitempty"`        // Whether key was randomly generated
+	KeyBackupPath       string        `yaml:"key_backup_path,omitempty"`   // Where key is backed up
+	AESConfig           *AESConfig    `yaml:"aes_config,omitempty"`        // AES specific settings
+	GPGConfig           *GPGConfig    `yaml:"gpg_config,omitempty"`        // GPG specific settings
+	ChaChaConfig        *ChaChaConfig `yaml:"chacha_config,omitempty"`     // ChaCha20 specific settings
+	EncryptManifests    bool          `yaml:"encrypt_manifests,omitempty"` // Seal manifests and indexes with the vault key
 }
 
 // AESConfig contains AES-specific encryption settings
 type AESConfig struct {
-	Key      string
+	Key      string `yaml:"key,omitempty"`       // Only read from old vaults; key material lives in the key file
 	Mode     string `yaml:"mode,omitempty"`      // GCM or CBC
 	KDF      string `yaml:"kdf,omitempty"`       // scrypt or pbkdf2
 	Salt     string `yaml:"salt,omitempty"`      // Base64 encoded salt
@@ -64,7 +114,7 @@ type GPGConfig struct {
 
 // ChaChaConfig contains ChaCha20-specific encryption settings
 type ChaChaConfig struct {
-	Key      string `yaml:"key,omitempty"`       // Base64 encoded key
+	Key      string `yaml:"key,omitempty"`       // Only read from old vaults; key material lives in the key file
 	Mode     string `yaml:"mode,omitempty"`      // Currently only "poly1305" (authenticated encryption)
 	KDF      string `yaml:"kdf,omitempty"`       // Key derivation function (scrypt or pbkdf2)
 	Salt     string `yaml:"salt,omitempty"`      // Base64 encoded salt for KDF
@@ -102,8 +152,57 @@ type SyncConfig struct {
 	Enabled      bool       `yaml:"enabled"`
 	AutoSync     bool       `yaml:"auto_sync,omitempty"`
 	SyncInterval string     `yaml:"sync_interval,omitempty"`
+	// How long deletions are remembered so they reach peers, e.g. "720h"
+	TombstoneRetentionPeriod string `yaml:"tombstone_retention,omitempty"`
+	// Limits on the sync streams peers may open; 0 uses the built-in default
+	MaxStreams      int `yaml:"max_streams,omitempty"`       // Concurrent streams from all peers
+	MaxPeerStreams  int `yaml:"max_peer_streams,omitempty"`  // Concurrent streams from one peer
+	PeerRequestRate int `yaml:"peer_request_rate,omitempty"` // Streams per second one peer may open
+	// Swarm key file, relative to the vault root, of the private libp2p
+	// network this vault syncs in; empty for the public network
+	NetworkKey string `yaml:"network_key,omitempty"`
+	// Multiaddrs the sync node listens on, or NoListenAddrs for a node that
+	// only dials out; empty for all interfaces on a random TCP port
+	ListenAddrs []string `yaml:"listen_addrs,omitempty"`
+	// Named groups of trusted peers that can be synced with together
+	Groups []PeerGroup `yaml:"groups,omitempty"`
+	// Algorithm to ask peers to compress sync traffic with, when they
+	// support it; empty or "none" sends it as stored
+	TransportCompression string `yaml:"transport_compression,omitempty"`
+	// How long sync operations wait on peers; slow links such as satellite
+	// or HF radio need more than the built-in defaults
+	Timeouts SyncTimeouts `yaml:"timeouts,omitempty"`
+	// Copies of each file wanted across this vault and its trusted peers,
+	// reported by 'sietch status --replication'; 0 uses the default
+	ReplicationFactor int `yaml:"replication_factor,omitempty"`
+	// Let trusted peers running 'sietch sync --ensure-replicas' have this
+	// vault fetch copies of their files while its sync node runs
+	AcceptReplicas bool `yaml:"accept_replicas,omitempty"`
+}
+
+// DefaultReplicationFactor is the copies of each file wanted when
+// sync.replication_factor is not set
+const DefaultReplicationFactor = 2
+
+// Replicas returns the copies of each file wanted, counting this vault
+func (s *SyncConfig) Replicas() int {
+	if s.ReplicationFactor > 0 {
+		return s.ReplicationFactor
+	}
+	return DefaultReplicationFactor
+}
+
+// SyncTimeouts are durations such as "2m"; empty uses the built-in default
+type SyncTimeouts struct {
+	Handshake string `yaml:"handshake,omitempty"` // Each message of the handshake, key exchange and authentication
+	Manifest  string `yaml:"manifest,omitempty"`  // Each manifest, delta or have list exchange
+	Chunk     string `yaml:"chunk,omitempty"`     // Each chunk transfer
+	Sync      string `yaml:"sync,omitempty"`      // A whole sync with one or more peers
 }
 
+// NoListenAddrs is the sync.listen_addrs value of a client-only node
+const NoListenAddrs = "none"
+
 // RSAConfig contains RSA key configuration for sync operations
 type RSAConfig struct {
 	KeySize        int           `yaml:"key_size"`
@@ -120,6 +219,16 @@ type TrustedPeer struct {
 	PublicKey    string    `yaml:"public_key"`
 	Fingerprint  string    `yaml:"fingerprint"`
 	TrustedSince time.Time `yaml:"trusted_since"`
+	// AllowedPaths limits what the peer can fetch from this vault to files
+	// under these path prefixes or, for "tag:<name>" entries, carrying the tag.
+	// Empty falls back to the defaults of the peer's groups, and without any
+	// means the peer can fetch everything.
+	AllowedPaths []string `yaml:"allowed_paths,omitempty"`
+	// A key the peer presented that differs from the pinned one, kept until
+	// 'sietch peers repin' accepts it. Syncs with the peer are refused meanwhile.
+	PendingPublicKey   string    `yaml:"pending_public_key,omitempty"`
+	PendingFingerprint string    `yaml:"pending_fingerprint,omitempty"`
+	KeyChangedAt       time.Time `yaml:"key_changed_at,omitempty"`
 }
 
 // MetadataConfig contains user metadata
@@ -128,6 +237,81 @@ type MetadataConfig struct {
 	Tags   []string `yaml:"tags"`
 }
 
+// CacheConfig sizes the cache of decoded chunks used when reading files
+type CacheConfig struct {
+	MemorySize string `yaml:"memory_size,omitempty"` // Defaults to 64MB; 0 disables
+	DiskSize   string `yaml:"disk_size,omitempty"`   // Decrypted chunks kept in .sietch/cache; disabled unless set
+}
+
+// HooksConfig lists the hooks run around vault operations. Post hooks run
+// after the operation and only warn when they fail; a failing pre hook stops
+// the operation.
+type HooksConfig struct {
+	PostAdd  []Hook `yaml:"post_add,omitempty"`
+	PostSync []Hook `yaml:"post_sync,omitempty"`
+	PreGC    []Hook `yaml:"pre_gc,omitempty"`
+	Timeout  string `yaml:"timeout,omitempty"` // How long each hook may take; defaults to 30s
+}
+
+// TrashConfig sets how long deleted files are kept in the trash
+type TrashConfig struct {
+	Retention string `yaml:"retention,omitempty"` // Defaults to 168h (7 days)
+}
+
+// QuotaConfig limits the size of the chunk store, for vaults on small disks.
+// Sizes are given as in chunking.chunk_size; unset or 0 is no limit.
+type QuotaConfig struct {
+	Soft string `yaml:"soft,omitempty"` // Size past which add warns
+	Hard string `yaml:"hard,omitempty"` // Size add refuses to grow the store past without --force
+}
+
+// DefaultScrubPercent is the share of chunks 'sietch scrub' verifies per run
+// when scrub.percent is not set, so the whole vault is checked every ten runs
+const DefaultScrubPercent = 10
+
+// ScrubConfig sets how much of the vault each 'sietch scrub' run verifies
+type ScrubConfig struct {
+	Percent int `yaml:"percent,omitempty"` // Share of chunks verified per run, 1 to 100
+}
+
+// Share returns the percentage of chunks to verify per run
+func (s *ScrubConfig) Share() int {
+	if s.Percent > 0 {
+		return s.Percent
+	}
+	return DefaultScrubPercent
+}
+
+// Parity group shape used when parity.data_shards or parity.parity_shards is not set
+const (
+	DefaultParityDataShards = 10
+	DefaultParityShards     = 2
+)
+
+// ParityConfig sets the shape of the parity groups built by 'sietch parity build'
+type ParityConfig struct {
+	DataShards   int `yaml:"data_shards,omitempty"`   // Chunks per group
+	ParityShards int `yaml:"parity_shards,omitempty"` // Parity shards per group: how many of its chunks can be lost
+}
+
+// Shards returns the chunks and parity shards of each new parity group
+func (p *ParityConfig) Shards() (dataShards, parityShards int) {
+	dataShards, parityShards = p.DataShards, p.ParityShards
+	if dataShards <= 0 {
+		dataShards = DefaultParityDataShards
+	}
+	if parityShards <= 0 {
+		parityShards = DefaultParityShards
+	}
+	return dataShards, parityShards
+}
+
+// Hook runs a command or POSTs to a webhook, given a JSON description of the event
+type Hook struct {
+	Command string `yaml:"command,omitempty"` // Run by the shell in the vault root, with the event on stdin
+	URL     string `yaml:"url,omitempty"`     // Receives the event as the body of a POST
+}
+
 // KeyConfig is the internal structure returned by key generation functions
 type KeyConfig struct {
 	KeyHash      string        `yaml:"key_hash,omitempty"`
@@ -151,6 +335,43 @@ type FileManifest struct {
 	AddedAt      time.Time           `yaml:"added_at"`                // When file was added to vault
 	LastSynced   time.Time           `yaml:"last_synced,omitempty"`   // Last successful sync time
 	LastVerified time.Time           `yaml:"last_verified,omitempty"` // Last verification time
+	Mode         uint32              `yaml:"mode,omitempty"`          // POSIX permission bits (e.g. 0o644)
+	Owner        *FileOwner          `yaml:"owner,omitempty"`         // Numeric owner, recorded with --preserve-owner
+	Xattrs       map[string]string   `yaml:"xattrs,omitempty"`        // Extended attributes (base64 values), recorded with --xattrs
+	Holes        []HoleExtent        `yaml:"holes,omitempty"`         // Unallocated ranges of a sparse file, not stored as chunks
+	HardLink     string              `yaml:"hard_link,omitempty"`     // Vault path of the file this one is hard-linked to
+	Symlink      string              `yaml:"symlink,omitempty"`       // Link target, stored instead of chunks with --preserve-symlinks
+	Provenance   []SyncOrigin        `yaml:"provenance,omitempty"`    // Syncs that copied the file between vaults, oldest first; empty for files added here
+}
+
+// SyncOrigin records one sync that copied a file into a vault
+type SyncOrigin struct {
+	Kind     string    `yaml:"kind"`           // "peer", "vault" or "bundle"
+	Source   string    `yaml:"source"`         // Peer ID, vault path or bundle the file was copied from
+	Name     string    `yaml:"name,omitempty"` // Name of the trusted peer or vault, if known
+	Session  string    `yaml:"session"`        // ID of the sync, also recorded in the audit log
+	SyncedAt time.Time `yaml:"synced_at"`
+}
+
+// Origin returns the sync that copied the file into this vault, or nil if
+// it was added here
+func (m *FileManifest) Origin() *SyncOrigin {
+	if len(m.Provenance) == 0 {
+		return nil
+	}
+	return &m.Provenance[len(m.Provenance)-1]
+}
+
+// HoleExtent is a range of a sparse file that reads as zeros and has no chunk
+type HoleExtent struct {
+	Offset int64 `yaml:"offset"`
+	Length int64 `yaml:"length"`
+}
+
+// FileOwner stores the numeric owner and group of a file
+type FileOwner struct {
+	UID int `yaml:"uid"`
+	GID int `yaml:"gid"`
 }
 
 // FileEncryptionInfo contains per-file encryption details (if different from vault default)
@@ -169,6 +390,7 @@ type ChunkRef struct {
 	CompressedSize  int64  `yaml:"compressed_size,omitempty"`  // Size after compression but before encryption
 	EncryptedSize   int64  `yaml:"encrypted_size,omitempty"`   // Size after encryption
 	Index           int    `yaml:"index"`                      // Position in the file
+	Offset          int64  `yaml:"offset,omitempty"`           // Byte offset of the chunk within the file
 	Deduplicated    bool   `yaml:"deduplicated,omitempty"`     // Whether this chunk was deduplicated
 	Compressed      bool   `yaml:"compressed,omitempty"`       // Whether this chunk was compressed
 	CompressionType string `yaml:"compression_type,omitempty"` // Compression algorithm used (e.g., "gzip", "zstd", "none")
@@ -213,7 +435,7 @@ func BuildVaultConfigWithDeduplication(
 		VaultID:       vaultID,
 		Name:          vaultName,
 		CreatedAt:     time.Now().UTC(),
-		SchemaVersion: 1, // Set schema version to 1 for initial version
+		SchemaVersion: CurrentSchemaVersion,
 		Compression:   compression,
 	}
 
@@ -285,9 +507,28 @@ func BuildVaultConfigWithDeduplication(
 		}
 	}
 
+	// The key itself is written to the key file, never to vault.yaml
+	config.Encryption = WithoutKeyMaterial(config.Encryption)
+
 	return config
 }
 
+// WithoutKeyMaterial returns a copy of enc with any key material removed, so
+// that only key hashes, key checks and KDF parameters remain
+func WithoutKeyMaterial(enc EncryptionConfig) EncryptionConfig {
+	if enc.AESConfig != nil {
+		aes := *enc.AESConfig
+		aes.Key = ""
+		enc.AESConfig = &aes
+	}
+	if enc.ChaChaConfig != nil {
+		chacha := *enc.ChaChaConfig
+		chacha.Key = ""
+		enc.ChaChaConfig = &chacha
+	}
+	return enc
+}
+
 func BuildDefaultVaultConfig(vaultID, vaultName, keyPath string) VaultConfig {
 	config := BuildVaultConfig(
 		vaultID,
@@ -360,3 +601,12 @@ func IsPassphraseProtected(vaultPath string) (bool, error) {
 
 	return false, nil
 }
+
+// checkSchemaVersion refuses vaults whose schema is newer than this build understands
+func checkSchemaVersion(cfg *VaultConfig) error {
+	if cfg.SchemaVersion > CurrentSchemaVersion {
+		return fmt.Errorf("%w: vault uses schema v%d but this version of sietch supports up to v%d, please upgrade sietch",
+			ErrUnsupportedSchema, cfg.SchemaVersion, CurrentSchemaVersion)
+	}
+	return nil
+}
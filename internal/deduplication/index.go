@@ -43,6 +43,9 @@ func (idx *DeduplicationIndex) Load() error {
 	if err != nil {
 		return err
 	}
+	if data, err = config.OpenMetadata(idx.vaultRoot, data); err != nil {
+		return err
+	}
 
 	return json.Unmarshal(data, &idx.entries)
 }
@@ -66,6 +69,9 @@ func (idx *DeduplicationIndex) Save() error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal index: %w", err)
 	}
+	if data, err = config.SealMetadata(idx.vaultRoot, data); err != nil {
+		return fmt.Errorf("failed to encrypt index: %w", err)
+	}
 
 	if err := os.WriteFile(idx.indexPath, data, constants.StandardFilePerms); err != nil {
 		return fmt.Errorf("failed to write index file: %w", err)
@@ -161,9 +167,43 @@ func (idx *DeduplicationIndex) RemoveChunk(hash string) error {
 	return nil
 }
 
+// releaseChunk decrements the reference count of a chunk, dropping it from
+// the index at zero without touching its chunk file
+func (idx *DeduplicationIndex) releaseChunk(hash string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	entry, exists := idx.entries[hash]
+	if !exists {
+		return
+	}
+	entry.RefCount--
+	if entry.RefCount <= 0 {
+		delete(idx.entries, hash)
+	}
+	idx.dirty = true
+}
+
+// moveChunks updates the storage of entries stored under the old names in moved
+func (idx *DeduplicationIndex) moveChunks(moved map[string]config.ChunkRef) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	for _, entry := range idx.entries {
+		ref, ok := moved[entry.StorageHash]
+		if !ok || ref.Hash != entry.Hash {
+			continue
+		}
+		entry.StorageHash = storageHashOf(ref)
+		entry.Compressed = ref.Compressed
+		entry.Encrypted = ref.EncryptedHash != ""
+		idx.dirty = true
+	}
+}
+
 // removeChunkFile removes the physical chunk file from storage
 func (idx *DeduplicationIndex) removeChunkFile(storageHash string) error {
-	chunkPath := filepath.Join(fs.GetChunkDirectory(idx.vaultRoot), storageHash)
+	chunkPath := fs.LocateChunk(idx.vaultRoot, storageHash)
 	if err := os.Remove(chunkPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove chunk file %s: %w", storageHash, err)
 	}
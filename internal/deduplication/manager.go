@@ -2,7 +2,6 @@ package deduplication
 
 import (
 	"fmt"
-	"path/filepath"
 
 	"github.com/substantialcattle5/sietch/internal/atomic"
 	"github.com/substantialcattle5/sietch/internal/config"
@@ -69,6 +68,7 @@ func (m *Manager) ProcessChunk(chunkRef config.ChunkRef, chunkData []byte, stora
 	if deduplicated {
 		// Chunk already exists, no need to store it again
 		chunkRef.Deduplicated = true
+		chunkRef.EncryptedHash = storedEncryptedHash(chunkRef, entry)
 		if m.progressMgr != nil {
 			m.progressMgr.PrintVerbose("  └─ Deduplicated chunk %s (ref count: %d)\n",
 				chunkRef.Hash[:12], entry.RefCount)
@@ -88,6 +88,21 @@ func (m *Manager) ProcessChunk(chunkRef config.ChunkRef, chunkData []byte, stora
 	return chunkRef, deduplicated, nil
 }
 
+// storedEncryptedHash returns the encrypted hash a deduplicated chunk is
+// stored under. Encrypting the same data again gives other bytes, so the copy
+// just encrypted is not the one in the vault.
+func storedEncryptedHash(chunkRef config.ChunkRef, entry *ChunkIndexEntry) string {
+	if chunkRef.EncryptedHash == "" || entry.StorageHash == "" {
+		return chunkRef.EncryptedHash
+	}
+	return entry.StorageHash
+}
+
+// Deduplicates reports whether chunks of size bytes are deduplicated
+func (m *Manager) Deduplicates(size int64) bool {
+	return m.shouldDeduplicateChunk(size)
+}
+
 // shouldDeduplicateChunk checks if a chunk should be deduplicated based on configuration
 func (m *Manager) shouldDeduplicateChunk(chunkSize int64) bool {
 	if !m.config.Enabled {
@@ -114,7 +129,7 @@ func (m *Manager) storeChunk(storageHash string, chunkData []byte) error {
 
 // storeChunkTransactional stages a chunk into the active transaction instead of writing directly.
 func (m *Manager) storeChunkTransactional(txn *atomic.Transaction, storageHash string, chunkData []byte) error {
-	rel := filepath.ToSlash(filepath.Join(".sietch", "chunks", storageHash))
+	rel := fs.ChunkRelPath(m.vaultRoot, storageHash)
 	w, err := txn.StageCreate(rel)
 	if err != nil {
 		return fmt.Errorf("stage chunk %s: %w", storageHash, err)
@@ -146,6 +161,7 @@ func (m *Manager) ProcessChunkTransactional(txn *atomic.Transaction, chunkRef co
 	entry, deduplicated := m.index.AddChunk(chunkRef, storageHash)
 	if deduplicated {
 		chunkRef.Deduplicated = true
+		chunkRef.EncryptedHash = storedEncryptedHash(chunkRef, entry)
 		if m.progressMgr != nil {
 			m.progressMgr.PrintVerbose("  └─ Deduplicated chunk %s (ref count: %d)\n", chunkRef.Hash[:12], entry.RefCount)
 		}
@@ -161,6 +177,45 @@ func (m *Manager) ProcessChunkTransactional(txn *atomic.Transaction, chunkRef co
 	return chunkRef, false, nil
 }
 
+// ReferenceChunks records one more reference to each of chunks, which must
+// already be stored, as when a file reuses the chunks of an identical file or
+// an interrupted add resumes
+func (m *Manager) ReferenceChunks(chunks []config.ChunkRef) {
+	for _, chunkRef := range chunks {
+		if !m.shouldDeduplicateChunk(chunkRef.Size) {
+			continue
+		}
+		m.index.AddChunk(chunkRef, storageHashOf(chunkRef))
+	}
+}
+
+// ReleaseChunks records one fewer reference to each of chunks, as when a
+// file's chunks are replaced. Entries left without references are dropped
+// from the index; their chunk files are left for the caller to delete.
+func (m *Manager) ReleaseChunks(chunks []config.ChunkRef) {
+	for _, chunkRef := range chunks {
+		if !m.shouldDeduplicateChunk(chunkRef.Size) {
+			continue
+		}
+		m.index.releaseChunk(chunkRef.Hash)
+	}
+}
+
+// MoveChunks points index entries at the chunk files their chunks were
+// rewritten to. moved maps the old storage name of each chunk to its new
+// reference.
+func (m *Manager) MoveChunks(moved map[string]config.ChunkRef) {
+	m.index.moveChunks(moved)
+}
+
+// storageHashOf returns the name chunkRef is stored under in the chunk store
+func storageHashOf(chunkRef config.ChunkRef) string {
+	if chunkRef.EncryptedHash != "" {
+		return chunkRef.EncryptedHash
+	}
+	return chunkRef.Hash
+}
+
 // GetStats returns deduplication statistics
 func (m *Manager) GetStats() DeduplicationStats {
 	return m.index.GetStats()
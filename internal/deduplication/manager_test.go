@@ -240,3 +240,84 @@ func TestDeduplicationIndex(t *testing.T) {
 		}
 	})
 }
+
+func TestReferenceChunks(t *testing.T) {
+	vaultPath := testutil.TempDir(t, "dedup-reference-vault")
+	if err := os.MkdirAll(filepath.Join(vaultPath, ".sietch", "chunks"), 0o755); err != nil {
+		t.Fatalf("Failed to create vault structure: %v", err)
+	}
+	manager, err := NewManager(vaultPath, config.DeduplicationConfig{Enabled: true, MinChunkSize: "0", MaxChunkSize: "64"})
+	if err != nil {
+		t.Fatalf("Failed to create deduplication manager: %v", err)
+	}
+
+	data := []byte("chunk shared by identical files")
+	ref := config.ChunkRef{Hash: "shared", Size: int64(len(data)), EncryptedHash: "sealed"}
+	if _, _, err := manager.ProcessChunk(ref, data, "sealed"); err != nil {
+		t.Fatalf("Failed to process chunk: %v", err)
+	}
+
+	manager.ReferenceChunks([]config.ChunkRef{ref})
+	entry, ok := manager.index.GetChunk("shared")
+	if !ok || entry.RefCount != 2 || entry.StorageHash != "sealed" {
+		t.Fatalf("expected a second reference to the stored chunk, got %+v", entry)
+	}
+}
+
+func TestDeduplicatedChunkPointsAtStoredCopy(t *testing.T) {
+	vaultPath := testutil.TempDir(t, "dedup-encrypted-vault")
+	if err := os.MkdirAll(filepath.Join(vaultPath, ".sietch", "chunks"), 0o755); err != nil {
+		t.Fatalf("Failed to create vault structure: %v", err)
+	}
+	manager, err := NewManager(vaultPath, config.DeduplicationConfig{Enabled: true, MinChunkSize: "0", MaxChunkSize: "64"})
+	if err != nil {
+		t.Fatalf("Failed to create deduplication manager: %v", err)
+	}
+
+	// The same data encrypted twice, as by two files with the same content
+	data := []byte("chunk of two identical files")
+	first := config.ChunkRef{Hash: "plain", Size: int64(len(data)), EncryptedHash: "sealed-once"}
+	if _, _, err := manager.ProcessChunk(first, data, first.EncryptedHash); err != nil {
+		t.Fatalf("Failed to process chunk: %v", err)
+	}
+	second := config.ChunkRef{Hash: "plain", Size: int64(len(data)), EncryptedHash: "sealed-twice"}
+	ref, deduplicated, err := manager.ProcessChunk(second, data, second.EncryptedHash)
+	if err != nil {
+		t.Fatalf("Failed to process chunk: %v", err)
+	}
+	if !deduplicated || ref.EncryptedHash != "sealed-once" {
+		t.Fatalf("expected the duplicate to reference the stored copy, got %+v", ref)
+	}
+	if _, err := os.Stat(filepath.Join(vaultPath, ".sietch", "chunks", "sealed-twice")); !os.IsNotExist(err) {
+		t.Errorf("expected the duplicate not to be stored, got %v", err)
+	}
+}
+
+func TestReleaseChunksKeepsChunkFiles(t *testing.T) {
+	vaultPath := testutil.TempDir(t, "dedup-release")
+	manager, err := NewManager(vaultPath, config.DeduplicationConfig{Enabled: true, MinChunkSize: "0", MaxChunkSize: "64"})
+	if err != nil {
+		t.Fatalf("Failed to create deduplication manager: %v", err)
+	}
+	shared := config.ChunkRef{Hash: "shared", Size: 10}
+	single := config.ChunkRef{Hash: "single", Size: 10}
+	manager.ReferenceChunks([]config.ChunkRef{shared, shared, single})
+	if err := os.MkdirAll(filepath.Join(vaultPath, ".sietch", "chunks"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	chunkPath := filepath.Join(vaultPath, ".sietch", "chunks", "single")
+	if err := os.WriteFile(chunkPath, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.ReleaseChunks([]config.ChunkRef{shared, single, {Hash: "unknown", Size: 10}})
+	if entry, ok := manager.index.GetChunk("shared"); !ok || entry.RefCount != 1 {
+		t.Errorf("expected the shared chunk to keep one reference, got %+v", entry)
+	}
+	if manager.index.HasChunk("single") {
+		t.Error("expected a chunk without references to leave the index")
+	}
+	if _, err := os.Stat(chunkPath); err != nil {
+		t.Errorf("expected the chunk file to be left in place, got %v", err)
+	}
+}
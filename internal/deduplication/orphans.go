@@ -0,0 +1,114 @@
+package deduplication
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// OrphanedChunk is a file in the chunk store that nothing refers to
+type OrphanedChunk struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// CopyOf is set for a second copy of an encrypted chunk, kept under its
+	// plaintext hash by syncs of older releases, to the name of the copy
+	// that is used
+	CopyOf string `json:"copy_of,omitempty"`
+}
+
+// FindOrphanedChunks scans the chunk directory for files that are referenced
+// neither by the given manifests nor by the deduplication index, such as
+// leftovers from an interrupted add. Copies of encrypted chunks stored under
+// their plaintext hash are orphaned too, unless they are the only copy. The
+// result is sorted by name.
+func (m *Manager) FindOrphanedChunks(files []config.FileManifest) ([]OrphanedChunk, error) {
+	stored, aliases := m.index.storageNames()
+	for _, file := range files {
+		for _, c := range file.Chunks {
+			name := storageHashOf(c)
+			if name == "" {
+				continue
+			}
+			stored[name] = true
+			if c.Hash != "" && c.Hash != name {
+				aliases[c.Hash] = name
+			}
+		}
+	}
+
+	var entries []os.DirEntry
+	err := fs.WalkChunks(m.vaultRoot, func(_, _ string, entry os.DirEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk directory: %w", err)
+	}
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[entry.Name()] = true
+	}
+
+	var orphans []OrphanedChunk
+	for _, entry := range entries {
+		name := entry.Name()
+		if stored[name] {
+			continue
+		}
+		copyOf, isAlias := aliases[name]
+		if isAlias && !present[copyOf] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to stat chunk %s: %w", name, err)
+		}
+		orphans = append(orphans, OrphanedChunk{Name: name, Size: info.Size(), CopyOf: copyOf})
+	}
+
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Name < orphans[j].Name })
+	return orphans, nil
+}
+
+// RemoveOrphanedChunks deletes the given chunk files and returns how many were
+// removed and the number of bytes reclaimed. Files that already vanished are skipped.
+func (m *Manager) RemoveOrphanedChunks(orphans []OrphanedChunk) (int, int64, error) {
+	removed := 0
+	var reclaimed int64
+	for _, orphan := range orphans {
+		if err := os.Remove(fs.LocateChunk(m.vaultRoot, orphan.Name)); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return removed, reclaimed, fmt.Errorf("failed to remove chunk %s: %w", orphan.Name, err)
+		}
+		removed++
+		reclaimed += orphan.Size
+	}
+	return removed, reclaimed, nil
+}
+
+// storageNames returns the names of the chunk files the index refers to, and
+// the name each chunk stored under another name than its hash is stored by
+func (idx *DeduplicationIndex) storageNames() (map[string]bool, map[string]string) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	names := make(map[string]bool, len(idx.entries))
+	aliases := make(map[string]string)
+	for hash, entry := range idx.entries {
+		if entry.StorageHash == "" || entry.StorageHash == hash {
+			names[hash] = true
+			continue
+		}
+		names[entry.StorageHash] = true
+		aliases[hash] = entry.StorageHash
+	}
+	return names, aliases
+}
@@ -0,0 +1,114 @@
+package deduplication
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func TestOrphanedChunks(t *testing.T) {
+	vaultPath := testutil.TempDir(t, "dedup-orphans")
+	chunkDir := filepath.Join(vaultPath, ".sietch", "chunks")
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		t.Fatalf("Failed to create chunk directory: %v", err)
+	}
+
+	for name, data := range map[string]string{
+		"manifest-plain": "a",
+		"manifest-enc":   "bb",
+		"index-storage":  "ccc",
+		"leftover-1":     "dddd",
+		"leftover-2":     "eeeee",
+	} {
+		if err := os.WriteFile(filepath.Join(chunkDir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write chunk %s: %v", name, err)
+		}
+	}
+
+	manager, err := NewManager(vaultPath, config.DeduplicationConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("Failed to create deduplication manager: %v", err)
+	}
+	manager.index.AddChunk(config.ChunkRef{Hash: "index-plain"}, "index-storage")
+
+	files := []config.FileManifest{{
+		FilePath: "f.txt",
+		Chunks: []config.ChunkRef{
+			{Hash: "manifest-plain"},
+			{Hash: "other", EncryptedHash: "manifest-enc"},
+		},
+	}}
+
+	orphans, err := manager.FindOrphanedChunks(files)
+	if err != nil {
+		t.Fatalf("FindOrphanedChunks failed: %v", err)
+	}
+	if len(orphans) != 2 || orphans[0].Name != "leftover-1" || orphans[1].Name != "leftover-2" {
+		t.Fatalf("Expected the two leftovers to be orphaned, got %v", orphans)
+	}
+
+	removed, reclaimed, err := manager.RemoveOrphanedChunks(orphans)
+	if err != nil {
+		t.Fatalf("RemoveOrphanedChunks failed: %v", err)
+	}
+	if removed != 2 || reclaimed != 9 {
+		t.Errorf("Expected 2 chunks and 9 bytes reclaimed, got %d and %d", removed, reclaimed)
+	}
+
+	remaining, err := os.ReadDir(chunkDir)
+	if err != nil {
+		t.Fatalf("Failed to read chunk directory: %v", err)
+	}
+	if len(remaining) != 3 {
+		t.Errorf("Expected 3 referenced chunks to remain, got %d", len(remaining))
+	}
+
+	// Removing again is a no-op
+	if removed, _, err := manager.RemoveOrphanedChunks(orphans); err != nil || removed != 0 {
+		t.Errorf("Expected second removal to do nothing, got %d, %v", removed, err)
+	}
+}
+
+func TestOrphanedChunksIncludeSecondCopies(t *testing.T) {
+	vaultPath := testutil.TempDir(t, "dedup-copies")
+	chunkDir := filepath.Join(vaultPath, ".sietch", "chunks")
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		t.Fatalf("Failed to create chunk directory: %v", err)
+	}
+	// Synced chunks used to be stored under both hashes; plain-only lost its encrypted copy
+	for _, name := range []string{"synced-enc", "synced-plain", "plain-only", "indexed-enc", "indexed-plain"} {
+		if err := os.WriteFile(filepath.Join(chunkDir, name), []byte("data"), 0o644); err != nil {
+			t.Fatalf("Failed to write chunk %s: %v", name, err)
+		}
+	}
+
+	manager, err := NewManager(vaultPath, config.DeduplicationConfig{Enabled: true})
+	if err != nil {
+		t.Fatalf("Failed to create deduplication manager: %v", err)
+	}
+	manager.index.AddChunk(config.ChunkRef{Hash: "indexed-plain", EncryptedHash: "indexed-enc"}, "indexed-enc")
+
+	files := []config.FileManifest{{
+		FilePath: "f.txt",
+		Chunks: []config.ChunkRef{
+			{Hash: "synced-plain", EncryptedHash: "synced-enc"},
+			{Hash: "plain-only", EncryptedHash: "missing-enc"},
+		},
+	}}
+
+	orphans, err := manager.FindOrphanedChunks(files)
+	if err != nil {
+		t.Fatalf("FindOrphanedChunks failed: %v", err)
+	}
+	want := []OrphanedChunk{
+		{Name: "indexed-plain", Size: 4, CopyOf: "indexed-enc"},
+		{Name: "synced-plain", Size: 4, CopyOf: "synced-enc"},
+	}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("Expected the second copies to be orphaned, got %+v", orphans)
+	}
+}
@@ -0,0 +1,165 @@
+package deduplication
+
+import (
+	"sort"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Kinds of reference count drift between the index and the manifests
+const (
+	// DriftUndercounted means the index counts fewer references than the
+	// manifests hold, so gc or rm can delete a chunk that is still in use
+	DriftUndercounted = "undercounted"
+	// DriftOvercounted means the index counts more references than the
+	// manifests hold, so the chunk outlives its last file
+	DriftOvercounted = "overcounted"
+	// DriftUnreferenced means no manifest refers to an indexed chunk that
+	// still has references, so gc never removes it
+	DriftUnreferenced = "unreferenced"
+	// DriftUnindexed means manifests refer to a chunk the index does not
+	// know, so adding the same data stores it again
+	DriftUnindexed = "unindexed"
+	// DriftStorage means the index points at a chunk file no manifest uses
+	DriftStorage = "storage"
+)
+
+// RefCountDrift is a chunk whose index entry disagrees with the manifests
+type RefCountDrift struct {
+	Hash            string `json:"hash" yaml:"hash"`
+	Kind            string `json:"kind" yaml:"kind"`
+	Indexed         int    `json:"indexed" yaml:"indexed"`       // Reference count in the index
+	Referenced      int    `json:"referenced" yaml:"referenced"` // References held by manifests
+	StorageHash     string `json:"storage_hash,omitempty" yaml:"storage_hash,omitempty"`
+	WantStorageHash string `json:"want_storage_hash,omitempty" yaml:"want_storage_hash,omitempty"` // Chunk file the manifests use, if it differs
+}
+
+// chunkUsage is how the manifests use one chunk
+type chunkUsage struct {
+	ref   config.ChunkRef
+	count int
+	names map[string]int // References per storage name
+}
+
+// storageName returns the chunk file most references use, the
+// lexically smallest on a tie
+func (u *chunkUsage) storageName() string {
+	best, bestCount := "", 0
+	for name, count := range u.names {
+		if count > bestCount || (count == bestCount && name < best) {
+			best, bestCount = name, count
+		}
+	}
+	return best
+}
+
+// VerifyRefCounts recomputes the reference count of every chunk from files,
+// which must be every manifest in the vault, and returns where the index
+// disagrees, sorted by hash. Chunks outside the deduplication size range are
+// only compared if the index already tracks them.
+func (m *Manager) VerifyRefCounts(files []config.FileManifest) []RefCountDrift {
+	usage := make(map[string]*chunkUsage)
+	for _, file := range files {
+		for _, ref := range file.Chunks {
+			if ref.Hash == "" {
+				continue
+			}
+			u, ok := usage[ref.Hash]
+			if !ok {
+				u = &chunkUsage{ref: ref, names: make(map[string]int)}
+				usage[ref.Hash] = u
+			}
+			u.count++
+			u.names[storageHashOf(ref)]++
+		}
+	}
+
+	m.index.mutex.RLock()
+	defer m.index.mutex.RUnlock()
+
+	var drift []RefCountDrift
+	for hash, entry := range m.index.entries {
+		u, ok := usage[hash]
+		if !ok {
+			if entry.RefCount > 0 {
+				drift = append(drift, RefCountDrift{Hash: hash, Kind: DriftUnreferenced, Indexed: entry.RefCount, StorageHash: entry.StorageHash})
+			}
+			continue
+		}
+
+		d := RefCountDrift{Hash: hash, Indexed: entry.RefCount, Referenced: u.count, StorageHash: entry.StorageHash}
+		switch {
+		case entry.RefCount < u.count:
+			d.Kind = DriftUndercounted
+		case entry.RefCount > u.count:
+			d.Kind = DriftOvercounted
+		case u.names[entry.StorageHash] == 0:
+			d.Kind = DriftStorage
+		default:
+			continue
+		}
+		if u.names[entry.StorageHash] == 0 {
+			d.WantStorageHash = u.storageName()
+		}
+		drift = append(drift, d)
+	}
+
+	for hash, u := range usage {
+		if _, indexed := m.index.entries[hash]; indexed || !m.shouldDeduplicateChunk(u.ref.Size) {
+			continue
+		}
+		drift = append(drift, RefCountDrift{Hash: hash, Kind: DriftUnindexed, Referenced: u.count, WantStorageHash: u.storageName()})
+	}
+
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Hash < drift[j].Hash })
+	return drift
+}
+
+// RepairRefCounts rewrites the index entries of drift found by
+// VerifyRefCounts from files so that they match the manifests. Chunks no
+// manifest refers to drop to zero references, for gc to remove. The index
+// is not saved.
+func (m *Manager) RepairRefCounts(files []config.FileManifest, drift []RefCountDrift) {
+	refs := make(map[string]config.ChunkRef)
+	for _, file := range files {
+		for _, ref := range file.Chunks {
+			if _, ok := refs[ref.Hash]; !ok {
+				refs[ref.Hash] = ref
+			}
+		}
+	}
+
+	m.index.mutex.Lock()
+	defer m.index.mutex.Unlock()
+
+	now := time.Now()
+	for _, d := range drift {
+		entry, ok := m.index.entries[d.Hash]
+		if !ok {
+			ref := refs[d.Hash]
+			entry = &ChunkIndexEntry{
+				Hash:       d.Hash,
+				Size:       ref.Size,
+				FirstSeen:  now,
+				Compressed: ref.Compressed,
+				Encrypted:  ref.EncryptedHash != "",
+			}
+			m.index.entries[d.Hash] = entry
+		}
+		entry.RefCount = d.Referenced
+		if d.WantStorageHash != "" {
+			entry.StorageHash = d.WantStorageHash
+		}
+		if d.Referenced > 0 {
+			entry.LastReferenced = now
+		}
+		m.index.dirty = true
+	}
+}
+
+// Unsafe reports whether gc or rm could delete the chunk while manifests
+// still refer to it
+func (d RefCountDrift) Unsafe() bool {
+	return d.Kind == DriftUndercounted
+}
@@ -0,0 +1,90 @@
+package deduplication
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/testutil"
+)
+
+func TestVerifyAndRepairRefCounts(t *testing.T) {
+	vaultPath := testutil.TempDir(t, "dedup-refcount")
+	manager, err := NewManager(vaultPath, config.DeduplicationConfig{Enabled: true, MinChunkSize: "1", MaxChunkSize: "1MB"})
+	if err != nil {
+		t.Fatalf("Failed to create deduplication manager: %v", err)
+	}
+
+	// ok matches; under counts one of its two references; over counts three
+	// for one; stale is used by no file; moved points at the wrong chunk file
+	manager.index.AddChunk(config.ChunkRef{Hash: "ok", Size: 10}, "ok")
+	manager.index.AddChunk(config.ChunkRef{Hash: "under", Size: 10}, "under")
+	manager.index.entries["under"].RefCount = 0
+	for i := 0; i < 3; i++ {
+		manager.index.AddChunk(config.ChunkRef{Hash: "over", Size: 10}, "over")
+	}
+	manager.index.AddChunk(config.ChunkRef{Hash: "stale", Size: 10}, "stale")
+	manager.index.AddChunk(config.ChunkRef{Hash: "moved", Size: 10, EncryptedHash: "enc-old"}, "enc-old")
+
+	files := []config.FileManifest{
+		{FilePath: "a", Chunks: []config.ChunkRef{{Hash: "ok", Size: 10}, {Hash: "under", Size: 10}, {Hash: "over", Size: 10}}},
+		{FilePath: "b", Chunks: []config.ChunkRef{{Hash: "under", Size: 10}, {Hash: "new", Size: 10, EncryptedHash: "enc-new"}}},
+		{FilePath: "c", Chunks: []config.ChunkRef{{Hash: "moved", Size: 10, EncryptedHash: "enc-cur"}}},
+	}
+
+	drift := manager.VerifyRefCounts(files)
+	want := map[string]RefCountDrift{
+		"moved": {Hash: "moved", Kind: DriftStorage, Indexed: 1, Referenced: 1, StorageHash: "enc-old", WantStorageHash: "enc-cur"},
+		"new":   {Hash: "new", Kind: DriftUnindexed, Referenced: 1, WantStorageHash: "enc-new"},
+		"over":  {Hash: "over", Kind: DriftOvercounted, Indexed: 3, Referenced: 1, StorageHash: "over"},
+		"stale": {Hash: "stale", Kind: DriftUnreferenced, Indexed: 1, StorageHash: "stale"},
+		"under": {Hash: "under", Kind: DriftUndercounted, Indexed: 0, Referenced: 2, StorageHash: "under"},
+	}
+	if len(drift) != len(want) {
+		t.Fatalf("Expected %d drifted chunks, got %+v", len(want), drift)
+	}
+	for i, d := range drift {
+		if d != want[d.Hash] {
+			t.Errorf("Drift of %s = %+v, want %+v", d.Hash, d, want[d.Hash])
+		}
+		if i > 0 && drift[i-1].Hash > d.Hash {
+			t.Errorf("Expected drift sorted by hash, got %s before %s", drift[i-1].Hash, d.Hash)
+		}
+		if d.Unsafe() != (d.Kind == DriftUndercounted) {
+			t.Errorf("Unexpected Unsafe() for %+v", d)
+		}
+	}
+
+	manager.RepairRefCounts(files, drift)
+	if again := manager.VerifyRefCounts(files); len(again) != 0 {
+		t.Fatalf("Expected no drift after repair, got %+v", again)
+	}
+	if entry := manager.index.entries["stale"]; entry.RefCount != 0 {
+		t.Errorf("Expected the unreferenced chunk to drop to zero references, got %d", entry.RefCount)
+	}
+	if entry := manager.index.entries["new"]; entry.StorageHash != "enc-new" || !entry.Encrypted || entry.Size != 10 {
+		t.Errorf("Unexpected entry for the unindexed chunk: %+v", entry)
+	}
+
+	// The repaired index survives a reload
+	if err := manager.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	reloaded, err := NewManager(vaultPath, config.DeduplicationConfig{Enabled: true, MinChunkSize: "1", MaxChunkSize: "1MB"})
+	if err != nil {
+		t.Fatalf("Failed to reload deduplication manager: %v", err)
+	}
+	if again := reloaded.VerifyRefCounts(files); len(again) != 0 {
+		t.Errorf("Expected no drift after reload, got %+v", again)
+	}
+}
+
+func TestVerifyRefCountsSkipsChunksOutsideDedupRange(t *testing.T) {
+	manager, err := NewManager(testutil.TempDir(t, "dedup-refcount-range"), config.DeduplicationConfig{Enabled: true, MinChunkSize: "1KB", MaxChunkSize: "1MB"})
+	if err != nil {
+		t.Fatalf("Failed to create deduplication manager: %v", err)
+	}
+	files := []config.FileManifest{{FilePath: "small", Chunks: []config.ChunkRef{{Hash: "tiny", Size: 10}}}}
+	if drift := manager.VerifyRefCounts(files); len(drift) != 0 {
+		t.Errorf("Expected chunks too small to deduplicate to be ignored, got %+v", drift)
+	}
+}
@@ -128,7 +128,7 @@ func handleDiscoveredPeer(ctx context.Context, h host.Host, syncService *p2p.Syn
 
 	fmt.Printf("   Connecting and exchanging keys... ")
 
-	connectCtx, connectCancel := context.WithTimeout(ctx, 30*time.Second)
+	connectCtx, connectCancel := context.WithTimeout(ctx, syncService.Timeouts.Handshake)
 	defer connectCancel()
 
 	if err := h.Connect(connectCtx, p); err != nil {
@@ -83,6 +83,17 @@ func AesEncryptWithPassphrase(data string, vaultConfig config.VaultConfig, passp
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
 
+	// Determine encryption mode from config or default to GCM
+	mode := "gcm"
+	if vaultConfig.Encryption.AESConfig != nil && vaultConfig.Encryption.AESConfig.Mode != "" {
+		mode = vaultConfig.Encryption.AESConfig.Mode
+	}
+
+	return aesEncryptWithKey(data, keyData, mode)
+}
+
+// aesEncryptWithKey encrypts data with an AES key in mode and hex encodes it
+func aesEncryptWithKey(data string, keyData []byte, mode string) (string, error) {
 	plainText := []byte(data)
 
 	// Create cipher block using the key
@@ -91,12 +102,6 @@ func AesEncryptWithPassphrase(data string, vaultConfig config.VaultConfig, passp
 		return "", fmt.Errorf("error creating AES cipher block: %w", err)
 	}
 
-	// Determine encryption mode from config or default to GCM
-	mode := "gcm"
-	if vaultConfig.Encryption.AESConfig != nil && vaultConfig.Encryption.AESConfig.Mode != "" {
-		mode = vaultConfig.Encryption.AESConfig.Mode
-	}
-
 	switch mode {
 	case "gcm":
 		// Use GCM mode for authenticated encryption
@@ -218,6 +223,17 @@ func AesDecryptionWithPassphrase(encryptedData string, vaultPath string, passphr
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
 
+	// Determine decryption mode from config or default to GCM
+	mode := "gcm"
+	if vaultConfig.Encryption.AESConfig != nil && vaultConfig.Encryption.AESConfig.Mode != "" {
+		mode = vaultConfig.Encryption.AESConfig.Mode
+	}
+
+	return aesDecryptWithKey(encryptedData, keyData, mode)
+}
+
+// aesDecryptWithKey decrypts hex encoded data with an AES key in mode
+func aesDecryptWithKey(encryptedData string, keyData []byte, mode string) (string, error) {
 	// Decode the hex encoded ciphertext
 	decodedCipherText, err := hex.DecodeString(encryptedData)
 	if err != nil {
@@ -230,12 +246,6 @@ func AesDecryptionWithPassphrase(encryptedData string, vaultPath string, passphr
 		return "", fmt.Errorf("error creating AES cipher block: %w", err)
 	}
 
-	// Determine decryption mode from config or default to GCM
-	mode := "gcm"
-	if vaultConfig.Encryption.AESConfig != nil && vaultConfig.Encryption.AESConfig.Mode != "" {
-		mode = vaultConfig.Encryption.AESConfig.Mode
-	}
-
 	switch mode {
 	case "gcm":
 		// Use GCM mode for authenticated decryption
@@ -301,7 +311,11 @@ func loadEncryptionKeyWithPassphrase(keyPath string, passphrase string, encConfi
 	if err != nil {
 		return nil, fmt.Errorf("error reading key file: %w", err)
 	}
+	return unwrapKey(encryptedKey, passphrase, encConfig)
+}
 
+// unwrapKey decrypts the contents of a key file with passphrase
+func unwrapKey(encryptedKey []byte, passphrase string, encConfig config.EncryptionConfig) ([]byte, error) {
 	// If not passphrase protected, return the key as-is
 	if !encConfig.PassphraseProtected {
 		return encryptedKey, nil
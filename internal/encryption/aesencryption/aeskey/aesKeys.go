@@ -3,6 +3,7 @@ package aeskey
 import (
 	"encoding/base64"
 	"fmt"
+	"os"
 
 	"github.com/substantialcattle5/sietch/internal/config"
 )
@@ -10,7 +11,21 @@ import (
 // GenerateAESKey creates a key configuration based on vault settings
 // and optionally stores the key in memory rather than writing to file
 func GenerateAESKey(cfg *config.VaultConfig, passphrase string) (*config.KeyConfig, error) {
-	fmt.Printf("Vault Configuration: %+v\n", cfg)
+	return generateAESKey(cfg, passphrase, nil)
+}
+
+// GenerateAESKeyFromMaterial is like GenerateAESKey but protects and stores
+// an existing key, such as one restored from a mnemonic backup
+func GenerateAESKeyFromMaterial(cfg *config.VaultConfig, passphrase string, keyMaterial []byte) (*config.KeyConfig, error) {
+	if err := validateKeySize(keyMaterial); err != nil {
+		return nil, err
+	}
+	return generateAESKey(cfg, passphrase, keyMaterial)
+}
+
+// generateAESKey builds the key configuration for keyMaterial, generating or
+// loading the key as the vault settings ask when keyMaterial is nil
+func generateAESKey(cfg *config.VaultConfig, passphrase string, keyMaterial []byte) (*config.KeyConfig, error) {
 
 	// Initialize key configuration
 	keyConfig := InitializeKeyConfig()
@@ -27,9 +42,11 @@ func GenerateAESKey(cfg *config.VaultConfig, passphrase string) (*config.KeyConf
 	opts := BuildKeyGenerationOptions(cfg)
 
 	// Generate the raw key material
-	keyMaterial, err := GenerateKeyMaterial(opts)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate key material: %w", err)
+	if keyMaterial == nil {
+		var err error
+		if keyMaterial, err = GenerateKeyMaterial(opts); err != nil {
+			return nil, fmt.Errorf("failed to generate key material: %w", err)
+		}
 	}
 
 	// Process the key based on whether it's passphrase-protected or not
@@ -86,10 +103,10 @@ func LoadEncryptionKey(cfg *config.VaultConfig, passphrase string) ([]byte, erro
 		return nil, fmt.Errorf("failed to load encryption key: %w", err)
 	}
 
-	// Load and decrypt the key
-	encryptedKey, err := base64.StdEncoding.DecodeString(cfg.Encryption.AESConfig.Key)
+	// Load and decrypt the key; vault.yaml only holds its key check and KDF parameters
+	encryptedKey, err := os.ReadFile(cfg.Encryption.KeyPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode key: %w", err)
+		return nil, fmt.Errorf("failed to read key file: %w", err)
 	}
 
 	// Decrypt the key using GCM mode
@@ -0,0 +1,132 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// KeyBackupVersion is the format of key backups written by this version
+const KeyBackupVersion = 1
+
+// KeyBackup is a vault key saved to a file by 'sietch keys export --file'.
+// The key in it is always wrapped under a passphrase: the key file of a
+// passphrase protected vault is copied as it is, while the key of any other
+// vault is wrapped under a passphrase chosen for the backup.
+type KeyBackup struct {
+	Version   int       `yaml:"version"`
+	VaultID   string    `yaml:"vault_id"`
+	VaultName string    `yaml:"vault_name,omitempty"`
+	CreatedAt time.Time `yaml:"created_at"`
+	KeyType   string    `yaml:"key_type"`
+	KeyHash   string    `yaml:"key_hash,omitempty"`
+	// VaultProtected is whether the vault protects its key file with the
+	// passphrase of the backup; if not, the key is restored unprotected
+	VaultProtected bool                    `yaml:"vault_passphrase_protected"`
+	Encryption     config.EncryptionConfig `yaml:"encryption"` // Settings that unwrap Key
+	Key            string                  `yaml:"key"`        // Base64 encoded wrapped key
+}
+
+// NewKeyBackup backs up key, the vault key of vaultConfig as LoadVaultKey
+// returns it. Keys of vaults without a passphrase are wrapped under
+// passphrase, which is ignored for passphrase protected vaults.
+func NewKeyBackup(vaultConfig config.VaultConfig, key []byte, passphrase string) (*KeyBackup, error) {
+	enc := vaultConfig.Encryption
+	backup := &KeyBackup{
+		Version:        KeyBackupVersion,
+		VaultID:        vaultConfig.VaultID,
+		VaultName:      vaultConfig.Name,
+		CreatedAt:      time.Now().UTC(),
+		KeyType:        enc.Type,
+		KeyHash:        enc.KeyHash,
+		VaultProtected: enc.PassphraseProtected,
+	}
+
+	var wrapped []byte
+	var err error
+	if enc.PassphraseProtected {
+		if wrapped, err = os.ReadFile(enc.KeyPath); err != nil {
+			return nil, fmt.Errorf("error reading key file: %w", err)
+		}
+	} else if wrapped, enc, err = WrapVaultKey(enc, key, passphrase, ""); err != nil {
+		return nil, err
+	}
+	enc = config.WithoutKeyMaterial(enc)
+	enc.KeyPath, enc.KeyFilePath, enc.KeyBackupPath = "", "", ""
+	enc.EncryptManifests = false
+	backup.Encryption = enc
+	backup.Key = base64.StdEncoding.EncodeToString(wrapped)
+	return backup, nil
+}
+
+// ParseKeyBackup parses a key backup written by NewKeyBackup
+func ParseKeyBackup(data []byte) (*KeyBackup, error) {
+	var backup KeyBackup
+	if err := yaml.UnmarshalStrict(data, &backup); err != nil {
+		return nil, fmt.Errorf("not a key backup: %w", err)
+	}
+	switch {
+	case backup.Version == 0:
+		return nil, fmt.Errorf("not a key backup: missing version")
+	case backup.Version > KeyBackupVersion:
+		return nil, fmt.Errorf("key backup version %d is newer than this sietch supports (%d)", backup.Version, KeyBackupVersion)
+	case backup.KeyType != constants.EncryptionTypeAES && backup.KeyType != constants.EncryptionTypeChaCha20:
+		return nil, fmt.Errorf("key backup has unsupported key type %q", backup.KeyType)
+	case backup.Encryption.Type != backup.KeyType || !backup.Encryption.PassphraseProtected:
+		return nil, fmt.Errorf("key backup has no settings to unwrap its key")
+	}
+	if _, err := base64.StdEncoding.DecodeString(backup.Key); err != nil || backup.Key == "" {
+		return nil, fmt.Errorf("key backup has no valid key")
+	}
+	return &backup, nil
+}
+
+// Unwrap decrypts the key of the backup with passphrase
+func (b *KeyBackup) Unwrap(passphrase string) ([]byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(b.Key)
+	if err != nil {
+		return nil, fmt.Errorf("key backup has no valid key")
+	}
+	return UnwrapVaultKey(b.Encryption, wrapped, passphrase)
+}
+
+// RestoredKey is a vault key restored from a backup
+type RestoredKey struct {
+	Key        []byte                  // The vault key, as LoadVaultKey returns it
+	KeyFile    []byte                  // Contents of the key file
+	Encryption config.EncryptionConfig // Settings to save with the key file
+}
+
+// Restore returns the key file and the encryption settings that restore the
+// key of the backup in a vault currently encrypted with the settings enc,
+// checking first that passphrase unwraps it. The vault keeps its key path
+// and manifest encryption.
+func (b *KeyBackup) Restore(enc config.EncryptionConfig, passphrase string) (*RestoredKey, error) {
+	if enc.Type != b.KeyType {
+		return nil, fmt.Errorf("key backup holds a %s key but the vault uses %s encryption", b.KeyType, enc.Type)
+	}
+	key, err := b.Unwrap(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.VaultProtected {
+		restored := enc
+		restored.PassphraseProtected = false
+		restored.KeyHash = b.KeyHash
+		return &RestoredKey{Key: key, KeyFile: key, Encryption: restored}, nil
+	}
+	keyFile, err := base64.StdEncoding.DecodeString(b.Key)
+	if err != nil {
+		return nil, fmt.Errorf("key backup has no valid key")
+	}
+	restored := b.Encryption
+	restored.KeyPath, restored.EncryptManifests = enc.KeyPath, enc.EncryptManifests
+	return &RestoredKey{Key: key, KeyFile: keyFile, Encryption: restored}, nil
+}
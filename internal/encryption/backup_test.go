@@ -0,0 +1,104 @@
+package encryption
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// roundTrip marshals backup and parses it back
+func roundTrip(t *testing.T, backup *KeyBackup) *KeyBackup {
+	t.Helper()
+	data, err := yaml.Marshal(backup)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	parsed, err := ParseKeyBackup(data)
+	if err != nil {
+		t.Fatalf("ParseKeyBackup: %v", err)
+	}
+	return parsed
+}
+
+func TestKeyBackupOfProtectedVault(t *testing.T) {
+	cfg := newProtectedVaultConfig(t, constants.EncryptionTypeAES, "vault-passphrase")
+	key, err := LoadVaultKey(cfg, "vault-passphrase")
+	if err != nil {
+		t.Fatalf("LoadVaultKey: %v", err)
+	}
+	backup, err := NewKeyBackup(cfg, key, "ignored")
+	if err != nil {
+		t.Fatalf("NewKeyBackup: %v", err)
+	}
+	backup = roundTrip(t, backup)
+
+	if _, err := backup.Unwrap("ignored"); err == nil {
+		t.Error("expected the backup to be wrapped under the vault passphrase")
+	}
+	restored, err := backup.Restore(cfg.Encryption, "vault-passphrase")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	original, _ := os.ReadFile(cfg.Encryption.KeyPath)
+	if !bytes.Equal(restored.KeyFile, original) || !bytes.Equal(restored.Key, key) {
+		t.Error("restored key differs from the vault's")
+	}
+	if enc := restored.Encryption; enc.KeyPath != cfg.Encryption.KeyPath || !enc.PassphraseProtected || enc.AESConfig.Salt != cfg.Encryption.AESConfig.Salt {
+		t.Errorf("unexpected restored settings: %+v", enc)
+	}
+}
+
+func TestKeyBackupOfUnprotectedVault(t *testing.T) {
+	cfg := config.VaultConfig{VaultID: "vault-1", Encryption: config.EncryptionConfig{
+		Type:         constants.EncryptionTypeChaCha20,
+		KeyPath:      "/vault/.sietch/keys/secret.key",
+		ChaChaConfig: config.BuildDefaultChaChaConfig(),
+	}}
+	key := bytes.Repeat([]byte{0x42}, 32)
+	if _, err := NewKeyBackup(cfg, key, ""); err == nil {
+		t.Error("expected an error without a backup passphrase")
+	}
+	backup, err := NewKeyBackup(cfg, key, "backup-passphrase")
+	if err != nil {
+		t.Fatalf("NewKeyBackup: %v", err)
+	}
+	backup = roundTrip(t, backup)
+	if backup.VaultProtected || backup.VaultID != "vault-1" {
+		t.Errorf("unexpected backup: %+v", backup)
+	}
+
+	if _, err := backup.Restore(cfg.Encryption, "wrong-passphrase"); err == nil {
+		t.Error("expected an error for a wrong passphrase")
+	}
+	aesVault := cfg.Encryption
+	aesVault.Type = constants.EncryptionTypeAES
+	if _, err := backup.Restore(aesVault, "backup-passphrase"); err == nil {
+		t.Error("expected an error for a vault of another key type")
+	}
+	restored, err := backup.Restore(cfg.Encryption, "backup-passphrase")
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if !bytes.Equal(restored.KeyFile, key) || restored.Encryption.PassphraseProtected {
+		t.Error("expected the key to be restored unprotected")
+	}
+}
+
+func TestParseKeyBackupRejects(t *testing.T) {
+	for name, data := range map[string]string{
+		"not yaml":      "{",
+		"no version":    "key_type: aes\n",
+		"newer version": "version: 99\nkey_type: aes\n",
+		"unknown field": "version: 1\nkey_type: aes\nsurprise: true\n",
+		"no settings":   "version: 1\nkey_type: aes\nkey: AAAA\n",
+	} {
+		if _, err := ParseKeyBackup([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
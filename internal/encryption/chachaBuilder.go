@@ -69,6 +69,11 @@ func ChaCha20EncryptWithPassphrase(data string, vaultConfig config.VaultConfig,
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
 
+	return chacha20EncryptWithKey(data, keyData)
+}
+
+// chacha20EncryptWithKey encrypts data with a ChaCha20 key and hex encodes it
+func chacha20EncryptWithKey(data string, keyData []byte) (string, error) {
 	plainText := []byte(data)
 
 	// Create ChaCha20-Poly1305 AEAD cipher
@@ -158,6 +163,11 @@ func ChaCha20DecryptionWithPassphrase(encryptedData string, vaultPath string, pa
 		return "", fmt.Errorf("failed to load encryption key: %w", err)
 	}
 
+	return chacha20DecryptWithKey(encryptedData, keyData)
+}
+
+// chacha20DecryptWithKey decrypts hex encoded data with a ChaCha20 key
+func chacha20DecryptWithKey(encryptedData string, keyData []byte) (string, error) {
 	// Decode the hex encoded ciphertext
 	decodedCipherText, err := hex.DecodeString(encryptedData)
 	if err != nil {
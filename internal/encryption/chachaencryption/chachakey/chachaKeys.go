@@ -18,6 +18,21 @@ import (
 
 // GenerateChaCha20Key creates a key configuration for ChaCha20 encryption
 func GenerateChaCha20Key(cfg *config.VaultConfig, passphrase string) (*config.KeyConfig, error) {
+	// Generate a 32-byte key for ChaCha20
+	keyMaterial := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(rand.Reader, keyMaterial); err != nil {
+		return nil, fmt.Errorf("failed to generate random key: %w", err)
+	}
+	return GenerateChaCha20KeyFromMaterial(cfg, passphrase, keyMaterial)
+}
+
+// GenerateChaCha20KeyFromMaterial is like GenerateChaCha20Key but protects
+// and stores an existing key, such as one restored from a mnemonic backup
+func GenerateChaCha20KeyFromMaterial(cfg *config.VaultConfig, passphrase string, keyMaterial []byte) (*config.KeyConfig, error) {
+	if len(keyMaterial) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("invalid ChaCha20 key length: %d bytes, want %d", len(keyMaterial), chacha20poly1305.KeySize)
+	}
+
 	// Initialize key configuration
 	keyConfig := &config.KeyConfig{
 		ChaChaConfig: &config.ChaChaConfig{
@@ -30,12 +45,6 @@ func GenerateChaCha20Key(cfg *config.VaultConfig, passphrase string) (*config.Ke
 		cfg.Encryption.ChaChaConfig = config.BuildDefaultChaChaConfig()
 	}
 
-	// Generate a 32-byte key for ChaCha20
-	keyMaterial := make([]byte, chacha20poly1305.KeySize)
-	if _, err := io.ReadFull(rand.Reader, keyMaterial); err != nil {
-		return nil, fmt.Errorf("failed to generate random key: %w", err)
-	}
-
 	// Calculate key hash for verification
 	keyHash := sha256.Sum256(keyMaterial)
 	keyConfig.KeyHash = base64.StdEncoding.EncodeToString(keyHash[:])
@@ -1 +1,260 @@
 package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/aesencryption/aeskey"
+)
+
+// LoadVaultKey returns the key that encrypts the vault's chunks, decrypting
+// it with passphrase if the vault is passphrase protected
+func LoadVaultKey(vaultConfig config.VaultConfig, passphrase string) ([]byte, error) {
+	switch vaultConfig.Encryption.Type {
+	case constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20:
+		return loadEncryptionKeyWithPassphrase(vaultConfig.Encryption.KeyPath, passphrase, vaultConfig.Encryption)
+	default:
+		return nil, fmt.Errorf("%s encryption has no symmetric vault key", vaultConfig.Encryption.Type)
+	}
+}
+
+// RewrapVaultKey encrypts the vault key of a passphrase protected vault under
+// newPassphrase, using a fresh salt and the default parameters of kdf (the
+// vault's current KDF when kdf is empty). It returns the new contents of the
+// key file and the encryption settings to save with them. The vault key
+// itself is unchanged, so chunks need no re-encryption and key_hash stays the
+// same.
+func RewrapVaultKey(vaultConfig config.VaultConfig, oldPassphrase, newPassphrase, kdf string) ([]byte, config.EncryptionConfig, error) {
+	enc := vaultConfig.Encryption
+	if !enc.PassphraseProtected {
+		return nil, enc, fmt.Errorf("vault key is not passphrase protected")
+	}
+	key, err := LoadVaultKey(vaultConfig, oldPassphrase)
+	if err != nil {
+		return nil, enc, err
+	}
+	return WrapVaultKey(enc, key, newPassphrase, kdf)
+}
+
+// WrapVaultKey encrypts key, the vault key of a vault with the encryption
+// settings enc, under passphrase like RewrapVaultKey does. The settings
+// returned are enc made passphrase protected.
+func WrapVaultKey(enc config.EncryptionConfig, key []byte, passphrase, kdf string) ([]byte, config.EncryptionConfig, error) {
+	original := enc
+	if passphrase == "" {
+		return nil, enc, fmt.Errorf("new passphrase must not be empty")
+	}
+	switch enc.Type {
+	case constants.EncryptionTypeAES:
+		if enc.AESConfig == nil {
+			enc.AESConfig = &config.AESConfig{Mode: constants.AESModeGCM}
+		}
+	case constants.EncryptionTypeChaCha20:
+		if enc.ChaChaConfig == nil {
+			enc.ChaChaConfig = config.BuildDefaultChaChaConfig()
+		}
+	default:
+		return nil, enc, fmt.Errorf("%s encryption has no symmetric vault key", enc.Type)
+	}
+	enc.PassphraseProtected = true
+
+	if kdf == "" {
+		switch {
+		case enc.Type == constants.EncryptionTypeAES && enc.AESConfig != nil:
+			kdf = enc.AESConfig.KDF
+		case enc.Type == constants.EncryptionTypeChaCha20 && enc.ChaChaConfig != nil:
+			kdf = enc.ChaChaConfig.KDF
+		}
+		if kdf == "" {
+			kdf = constants.KDFScrypt
+		}
+	}
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, enc, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	kdfConfig := aeskey.KDFConfig{Algorithm: kdf, Salt: salt}
+	switch kdf {
+	case constants.KDFScrypt:
+		kdfConfig.ScryptN = constants.DefaultScryptN
+		kdfConfig.ScryptR = constants.DefaultScryptR
+		kdfConfig.ScryptP = constants.DefaultScryptP
+	case constants.KDFPBKDF2:
+		kdfConfig.PBKDF2Iterations = constants.DefaultPBKDF2Iters
+	default:
+		return nil, enc, fmt.Errorf("unsupported KDF algorithm: %q (use scrypt or pbkdf2)", kdf)
+	}
+	derivedKey, err := aeskey.DeriveKey(passphrase, kdfConfig)
+	if err != nil {
+		return nil, enc, fmt.Errorf("failed to derive key: %w", err)
+	}
+	keyCheck, err := aeskey.GenerateKeyCheck(derivedKey)
+	if err != nil {
+		return nil, enc, fmt.Errorf("failed to generate key check: %w", err)
+	}
+	encodedSalt := base64.StdEncoding.EncodeToString(salt)
+
+	var wrapped, unwrapped []byte
+	switch enc.Type {
+	case constants.EncryptionTypeAES:
+		aesConfig := *enc.AESConfig
+		// Let the wrap pick a new nonce or IV rather than reuse the old one
+		aesConfig.Nonce, aesConfig.IV = "", ""
+		if wrapped, err = aeskey.EncryptKeyWithDerivedKey(key, derivedKey, &aesConfig); err != nil {
+			return nil, enc, fmt.Errorf("failed to encrypt key material: %w", err)
+		}
+		aesConfig.KDF, aesConfig.Salt, aesConfig.KeyCheck = kdf, encodedSalt, keyCheck
+		aesConfig.ScryptN, aesConfig.ScryptR, aesConfig.ScryptP = kdfConfig.ScryptN, kdfConfig.ScryptR, kdfConfig.ScryptP
+		aesConfig.PBKDF2I = kdfConfig.PBKDF2Iterations
+		enc.AESConfig = &aesConfig
+		unwrapped, err = decryptKeyWithDerivedKey(wrapped, derivedKey, enc.AESConfig)
+	case constants.EncryptionTypeChaCha20:
+		aead, aeadErr := chacha20poly1305.New(derivedKey)
+		if aeadErr != nil {
+			return nil, enc, fmt.Errorf("failed to create ChaCha20-Poly1305 cipher: %w", aeadErr)
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, enc, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		wrapped = aead.Seal(nonce, nonce, key, nil)
+
+		chachaConfig := *enc.ChaChaConfig
+		chachaConfig.KDF, chachaConfig.Salt, chachaConfig.KeyCheck = kdf, encodedSalt, keyCheck
+		chachaConfig.ScryptN, chachaConfig.ScryptR, chachaConfig.ScryptP = kdfConfig.ScryptN, kdfConfig.ScryptR, kdfConfig.ScryptP
+		chachaConfig.PBKDF2I = kdfConfig.PBKDF2Iterations
+		enc.ChaChaConfig = &chachaConfig
+		unwrapped, err = decryptKeyWithDerivedKeyChaCha20(wrapped, derivedKey, enc.ChaChaConfig)
+	}
+	// Never hand back a key file that would lock the vault for good
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		return nil, original, fmt.Errorf("re-wrapped key failed verification")
+	}
+
+	return wrapped, config.WithoutKeyMaterial(enc), nil
+}
+
+// UnwrapVaultKey decrypts wrapped, the contents of a key file protected with
+// the encryption settings enc, with passphrase
+func UnwrapVaultKey(enc config.EncryptionConfig, wrapped []byte, passphrase string) ([]byte, error) {
+	switch enc.Type {
+	case constants.EncryptionTypeAES, constants.EncryptionTypeChaCha20:
+		return unwrapKey(wrapped, passphrase, enc)
+	default:
+		return nil, fmt.Errorf("%s encryption has no symmetric vault key", enc.Type)
+	}
+}
+
+// DecryptWithKey decrypts data encrypted for a vault with the encryption
+// settings enc, using key rather than the vault's key file
+func DecryptWithKey(encryptedData string, key []byte, enc config.EncryptionConfig) (string, error) {
+	switch enc.Type {
+	case constants.EncryptionTypeAES:
+		mode := "gcm"
+		if enc.AESConfig != nil && enc.AESConfig.Mode != "" {
+			mode = enc.AESConfig.Mode
+		}
+		return aesDecryptWithKey(encryptedData, key, mode)
+	case constants.EncryptionTypeChaCha20:
+		return chacha20DecryptWithKey(encryptedData, key)
+	default:
+		return "", fmt.Errorf("%s encryption has no symmetric vault key", enc.Type)
+	}
+}
+
+// EncryptWithKey encrypts data for a vault with the encryption settings enc,
+// using key rather than the vault's key file
+func EncryptWithKey(data string, key []byte, enc config.EncryptionConfig) (string, error) {
+	switch enc.Type {
+	case constants.EncryptionTypeAES:
+		mode := "gcm"
+		if enc.AESConfig != nil && enc.AESConfig.Mode != "" {
+			mode = enc.AESConfig.Mode
+		}
+		return aesEncryptWithKey(data, key, mode)
+	case constants.EncryptionTypeChaCha20:
+		return chacha20EncryptWithKey(data, key)
+	default:
+		return "", fmt.Errorf("%s encryption has no symmetric vault key", enc.Type)
+	}
+}
+
+// Ciphers vault chunks are encrypted with
+const (
+	CipherAESGCM   = "aes-gcm"
+	CipherAESCBC   = "aes-cbc"
+	CipherChaCha20 = "chacha20"
+)
+
+// CipherOf returns the cipher the encryption settings enc encrypt chunks
+// with, or an empty string for vaults without a symmetric vault key. AES
+// vaults without a passphrase always use GCM, whatever their mode says.
+func CipherOf(enc config.EncryptionConfig) string {
+	switch enc.Type {
+	case constants.EncryptionTypeAES:
+		if enc.PassphraseProtected && enc.AESConfig != nil && enc.AESConfig.Mode == constants.AESModeCBC {
+			return CipherAESCBC
+		}
+		return CipherAESGCM
+	case constants.EncryptionTypeChaCha20:
+		return CipherChaCha20
+	default:
+		return ""
+	}
+}
+
+// NewVaultKey generates a random vault key for cipher, aes-gcm or chacha20,
+// to replace the key of a vault with the encryption settings enc. The key is
+// wrapped under passphrase with the vault's current KDF if enc is passphrase
+// protected. It returns the key, the new contents of the key file and the
+// encryption settings to save with them; the vault keeps its key path and
+// manifest encryption.
+func NewVaultKey(enc config.EncryptionConfig, cipher, passphrase string) ([]byte, []byte, config.EncryptionConfig, error) {
+	next := config.EncryptionConfig{
+		KeyPath:             enc.KeyPath,
+		PassphraseProtected: enc.PassphraseProtected,
+		RandomKey:           true,
+		EncryptManifests:    enc.EncryptManifests,
+	}
+	switch cipher {
+	case CipherAESGCM:
+		next.Type = constants.EncryptionTypeAES
+		next.AESConfig = &config.AESConfig{Mode: constants.AESModeGCM}
+	case CipherChaCha20:
+		next.Type = constants.EncryptionTypeChaCha20
+		next.ChaChaConfig = &config.ChaChaConfig{Mode: "poly1305"}
+	default:
+		return nil, nil, enc, fmt.Errorf("cannot generate a vault key for cipher %q (use %s or %s)", cipher, CipherAESGCM, CipherChaCha20)
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize) // AES-256 keys have the same size
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, enc, fmt.Errorf("failed to generate random key: %w", err)
+	}
+	hash := sha256.Sum256(key)
+	next.KeyHash = base64.StdEncoding.EncodeToString(hash[:])
+
+	if !next.PassphraseProtected {
+		return key, key, next, nil
+	}
+	kdf := ""
+	switch {
+	case enc.AESConfig != nil && enc.Type == constants.EncryptionTypeAES:
+		kdf = enc.AESConfig.KDF
+	case enc.ChaChaConfig != nil && enc.Type == constants.EncryptionTypeChaCha20:
+		kdf = enc.ChaChaConfig.KDF
+	}
+	wrapped, next, err := WrapVaultKey(next, key, passphrase, kdf)
+	if err != nil {
+		return nil, nil, enc, err
+	}
+	return key, wrapped, next, nil
+}
@@ -0,0 +1,178 @@
+package encryption
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/aesencryption/aeskey"
+	"github.com/substantialcattle5/sietch/internal/encryption/chachaencryption/chachakey"
+)
+
+// newProtectedVaultConfig returns the configuration of a vault whose key of
+// keyType is protected by passphrase, with the key file written to a temp dir
+func newProtectedVaultConfig(t *testing.T, keyType, passphrase string) config.VaultConfig {
+	t.Helper()
+	cfg := config.VaultConfig{
+		Encryption: config.EncryptionConfig{
+			Type:                keyType,
+			KeyPath:             filepath.Join(t.TempDir(), "secret.key"),
+			PassphraseProtected: true,
+		},
+	}
+	switch keyType {
+	case constants.EncryptionTypeAES:
+		cfg.Encryption.AESConfig = config.BuildDefaultAESConfig()
+		keyConfig, err := aeskey.GenerateAESKey(&cfg, passphrase)
+		if err != nil {
+			t.Fatalf("GenerateAESKey: %v", err)
+		}
+		*cfg.Encryption.AESConfig = *keyConfig.AESConfig
+	case constants.EncryptionTypeChaCha20:
+		if _, err := chachakey.GenerateChaCha20Key(&cfg, passphrase); err != nil {
+			t.Fatalf("GenerateChaCha20Key: %v", err)
+		}
+	}
+	return cfg
+}
+
+func TestRewrapVaultKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyType string
+		kdf     string
+		wantKDF string
+	}{
+		{"aes keeps scrypt", constants.EncryptionTypeAES, "", constants.KDFScrypt},
+		{"aes switches to pbkdf2", constants.EncryptionTypeAES, constants.KDFPBKDF2, constants.KDFPBKDF2},
+		{"chacha20 keeps scrypt", constants.EncryptionTypeChaCha20, "", constants.KDFScrypt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newProtectedVaultConfig(t, tt.keyType, "old-passphrase")
+			key, err := LoadVaultKey(cfg, "old-passphrase")
+			if err != nil {
+				t.Fatalf("LoadVaultKey: %v", err)
+			}
+			oldKeyFile, _ := os.ReadFile(cfg.Encryption.KeyPath)
+
+			wrapped, enc, err := RewrapVaultKey(cfg, "old-passphrase", "new-passphrase", tt.kdf)
+			if err != nil {
+				t.Fatalf("RewrapVaultKey: %v", err)
+			}
+			if bytes.Equal(wrapped, oldKeyFile) {
+				t.Fatal("key file contents did not change")
+			}
+			if enc.KeyHash != cfg.Encryption.KeyHash {
+				t.Errorf("key_hash changed from %q to %q", cfg.Encryption.KeyHash, enc.KeyHash)
+			}
+
+			if err := os.WriteFile(cfg.Encryption.KeyPath, wrapped, constants.SecureFilePerms); err != nil {
+				t.Fatalf("write key file: %v", err)
+			}
+			rewrapped := cfg
+			rewrapped.Encryption = enc
+
+			got, err := LoadVaultKey(rewrapped, "new-passphrase")
+			if err != nil {
+				t.Fatalf("LoadVaultKey with new passphrase: %v", err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Fatal("re-wrapped vault key differs from the original")
+			}
+			if _, err := LoadVaultKey(rewrapped, "old-passphrase"); err == nil {
+				t.Error("old passphrase still unlocks the vault key")
+			}
+
+			var kdf, keyCheck string
+			if enc.AESConfig != nil {
+				kdf, keyCheck = enc.AESConfig.KDF, enc.AESConfig.KeyCheck
+			} else {
+				kdf, keyCheck = enc.ChaChaConfig.KDF, enc.ChaChaConfig.KeyCheck
+			}
+			if kdf != tt.wantKDF {
+				t.Errorf("KDF = %q, want %q", kdf, tt.wantKDF)
+			}
+			if keyCheck == "" {
+				t.Error("no key check was generated")
+			}
+		})
+	}
+}
+
+func TestRewrapVaultKeyErrors(t *testing.T) {
+	cfg := newProtectedVaultConfig(t, constants.EncryptionTypeAES, "old-passphrase")
+
+	if _, _, err := RewrapVaultKey(cfg, "wrong-passphrase", "new-passphrase", ""); err == nil {
+		t.Error("expected an error for a wrong current passphrase")
+	}
+	if _, _, err := RewrapVaultKey(cfg, "old-passphrase", "", ""); err == nil {
+		t.Error("expected an error for an empty new passphrase")
+	}
+	if _, _, err := RewrapVaultKey(cfg, "old-passphrase", "new-passphrase", "argon2"); err == nil {
+		t.Error("expected an error for an unsupported KDF")
+	}
+
+	unprotected := cfg
+	unprotected.Encryption.PassphraseProtected = false
+	if _, _, err := RewrapVaultKey(unprotected, "", "new-passphrase", ""); err == nil {
+		t.Error("expected an error for a vault without a passphrase")
+	}
+}
+
+func TestNewVaultKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyType   string
+		protected bool
+		cipher    string
+	}{
+		{"protected aes to chacha20", constants.EncryptionTypeAES, true, CipherChaCha20},
+		{"protected chacha20 to aes-gcm", constants.EncryptionTypeChaCha20, true, CipherAESGCM},
+		{"unprotected aes to chacha20", constants.EncryptionTypeAES, false, CipherChaCha20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newProtectedVaultConfig(t, tt.keyType, "passphrase")
+			cfg.Encryption.PassphraseProtected = tt.protected
+
+			key, keyFile, enc, err := NewVaultKey(cfg.Encryption, tt.cipher, "passphrase")
+			if err != nil {
+				t.Fatalf("NewVaultKey: %v", err)
+			}
+			if CipherOf(enc) != tt.cipher || enc.KeyPath != cfg.Encryption.KeyPath || enc.PassphraseProtected != tt.protected {
+				t.Errorf("unexpected encryption settings %+v", enc)
+			}
+			if enc.KeyHash == "" || enc.KeyHash == cfg.Encryption.KeyHash {
+				t.Errorf("expected a key_hash for the new key, got %q", enc.KeyHash)
+			}
+
+			if err := os.WriteFile(enc.KeyPath, keyFile, constants.SecureFilePerms); err != nil {
+				t.Fatalf("write key file: %v", err)
+			}
+			next := cfg
+			next.Encryption = enc
+			loaded, err := LoadVaultKey(next, "passphrase")
+			if err != nil || !bytes.Equal(loaded, key) {
+				t.Fatalf("expected the key file to load the new key (%v)", err)
+			}
+
+			encrypted, err := EncryptWithKey("chunk data", key, enc)
+			if err != nil {
+				t.Fatalf("EncryptWithKey: %v", err)
+			}
+			if decrypted, err := DecryptWithKey(encrypted, key, enc); err != nil || decrypted != "chunk data" {
+				t.Errorf("expected data to round trip under the new key, got %q (%v)", decrypted, err)
+			}
+		})
+	}
+
+	if _, _, _, err := NewVaultKey(config.EncryptionConfig{Type: constants.EncryptionTypeAES}, CipherAESCBC, ""); err == nil {
+		t.Error("expected an error for a cipher vaults cannot migrate to")
+	}
+}
@@ -0,0 +1,206 @@
+// Package mnemonic encodes a vault key as a list of words that can be kept as
+// a paper backup, and decodes it again.
+//
+// The words use the BIP39 English list, 11 bits per word. The encoded bits are
+// a header byte (format version, key type and KDF), the key itself and a
+// checksum made of the first bits of the SHA-256 of the header and key, long
+// enough to fill the last word and at least 8 bits. A 32-byte key takes 25
+// words.
+package mnemonic
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// formatVersion is the version stored in the header of every mnemonic
+const formatVersion = 1
+
+// bitsPerWord is the number of bits each word encodes
+const bitsPerWord = 11
+
+// ErrChecksum is returned by Decode when the words are all valid but do not
+// form a backup, usually because one was miscopied or two were swapped
+var ErrChecksum = errors.New("mnemonic checksum does not match; check the words and their order")
+
+// keySizes are the key lengths a mnemonic can hold
+var keySizes = []int{16, 24, 32}
+
+var keyTypeCodes = map[string]byte{
+	constants.EncryptionTypeAES:      1,
+	constants.EncryptionTypeChaCha20: 2,
+}
+
+var kdfCodes = map[string]byte{
+	"":                  0,
+	constants.KDFScrypt: 1,
+	constants.KDFPBKDF2: 2,
+}
+
+// Backup is what a mnemonic records
+type Backup struct {
+	KeyType string // aes or chacha20
+	KDF     string // KDF protecting the key in the vault it came from, empty without a passphrase
+	Key     []byte
+}
+
+// wordIndex maps every word, and the first four letters of every word, to its
+// position in the list
+var wordIndex = func() map[string]int {
+	index := make(map[string]int, 2*len(words))
+	for i, w := range words {
+		index[w] = i
+		if len(w) > 4 {
+			index[w[:4]] = i
+		}
+	}
+	return index
+}()
+
+// Encode returns the words recording b
+func Encode(b Backup) ([]string, error) {
+	typeCode, ok := keyTypeCodes[b.KeyType]
+	if !ok {
+		return nil, fmt.Errorf("cannot back up %s keys as a mnemonic", b.KeyType)
+	}
+	kdfCode, ok := kdfCodes[b.KDF]
+	if !ok {
+		return nil, fmt.Errorf("unsupported KDF %q", b.KDF)
+	}
+	if !validKeySize(b.KeyType, len(b.Key)) {
+		return nil, fmt.Errorf("invalid %s key length: %d bytes", b.KeyType, len(b.Key))
+	}
+
+	payload := append([]byte{formatVersion<<5 | typeCode<<3 | kdfCode}, b.Key...)
+	bits := appendBits(nil, payload, len(payload)*8)
+	sum := sha256.Sum256(payload)
+	bits = appendBits(bits, sum[:], checksumBits(len(b.Key)))
+
+	out := make([]string, 0, len(bits)/bitsPerWord)
+	for i := 0; i < len(bits); i += bitsPerWord {
+		index := 0
+		for _, bit := range bits[i : i+bitsPerWord] {
+			index = index<<1 | int(bit)
+		}
+		out = append(out, words[index])
+	}
+	return out, nil
+}
+
+// Decode reads the backup recorded by the words in text. Words may be
+// abbreviated to their first four letters, and numbers such as "7." written
+// before them are ignored.
+func Decode(text string) (Backup, error) {
+	var indexes []int
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		if isNumbering(field) {
+			continue
+		}
+		index, ok := wordIndex[field]
+		if !ok {
+			return Backup{}, fmt.Errorf("word %d (%q) is not in the word list", len(indexes)+1, field)
+		}
+		indexes = append(indexes, index)
+	}
+
+	keySize := 0
+	for _, n := range keySizes {
+		if wordCount(n) == len(indexes) {
+			keySize = n
+		}
+	}
+	if keySize == 0 {
+		return Backup{}, fmt.Errorf("a mnemonic has %d, %d or %d words, not %d",
+			wordCount(16), wordCount(24), wordCount(32), len(indexes))
+	}
+
+	bits := make([]byte, 0, len(indexes)*bitsPerWord)
+	for _, index := range indexes {
+		for shift := bitsPerWord - 1; shift >= 0; shift-- {
+			bits = append(bits, byte(index>>shift&1))
+		}
+	}
+	payload := make([]byte, 1+keySize)
+	for i := range payload {
+		for _, bit := range bits[i*8 : i*8+8] {
+			payload[i] = payload[i]<<1 | bit
+		}
+	}
+	sum := sha256.Sum256(payload)
+	want := appendBits(nil, sum[:], checksumBits(keySize))
+	if string(bits[len(payload)*8:]) != string(want) {
+		return Backup{}, ErrChecksum
+	}
+
+	header := payload[0]
+	if header>>5 != formatVersion {
+		return Backup{}, fmt.Errorf("unsupported mnemonic format version %d", header>>5)
+	}
+	b := Backup{Key: payload[1:]}
+	for name, code := range keyTypeCodes {
+		if code == header>>3&0x3 {
+			b.KeyType = name
+		}
+	}
+	kdfKnown := false
+	for name, code := range kdfCodes {
+		if code == header&0x7 {
+			b.KDF, kdfKnown = name, true
+		}
+	}
+	if b.KeyType == "" || !kdfKnown || !validKeySize(b.KeyType, keySize) {
+		return Backup{}, fmt.Errorf("mnemonic header %#02x is not valid", header)
+	}
+	return b, nil
+}
+
+// validKeySize reports whether a key of keyType can be n bytes long
+func validKeySize(keyType string, n int) bool {
+	if keyType == constants.EncryptionTypeChaCha20 {
+		return n == 32
+	}
+	return n == 16 || n == 24 || n == 32
+}
+
+// checksumBits returns the checksum length used with a key of keySize bytes:
+// the bits needed to complete the last word, plus another word if that is
+// fewer than 8
+func checksumBits(keySize int) int {
+	bits := 8 * (1 + keySize)
+	n := (bitsPerWord - bits%bitsPerWord) % bitsPerWord
+	for n < 8 {
+		n += bitsPerWord
+	}
+	return n
+}
+
+// wordCount returns the number of words recording a key of keySize bytes
+func wordCount(keySize int) int {
+	return (8*(1+keySize) + checksumBits(keySize)) / bitsPerWord
+}
+
+// appendBits appends the first n bits of data to bits, one bit per byte
+func appendBits(bits, data []byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		bits = append(bits, data[i/8]>>(7-i%8)&1)
+	}
+	return bits
+}
+
+// isNumbering reports whether field is a position such as "7." or "7)"
+func isNumbering(field string) bool {
+	field = strings.TrimRight(field, ".):")
+	if field == "" {
+		return false
+	}
+	for _, r := range field {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
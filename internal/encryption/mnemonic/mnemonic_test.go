@@ -0,0 +1,125 @@
+package mnemonic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+func TestWordList(t *testing.T) {
+	if len(words) != 1<<bitsPerWord {
+		t.Fatalf("word list has %d words, want %d", len(words), 1<<bitsPerWord)
+	}
+	prefixes := make(map[string]bool)
+	for i, w := range words {
+		if i > 0 && words[i-1] >= w {
+			t.Errorf("word list is not sorted at %q", w)
+		}
+		prefix := w
+		if len(prefix) > 4 {
+			prefix = prefix[:4]
+		}
+		if prefixes[prefix] {
+			t.Errorf("prefix %q is not unique", prefix)
+		}
+		prefixes[prefix] = true
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		backup Backup
+		words  int
+	}{
+		{"aes-256 with scrypt", Backup{constants.EncryptionTypeAES, constants.KDFScrypt, bytes.Repeat([]byte{0xa5}, 32)}, 25},
+		{"aes-192 with pbkdf2", Backup{constants.EncryptionTypeAES, constants.KDFPBKDF2, bytes.Repeat([]byte{0x01}, 24)}, 19},
+		{"aes-128 without passphrase", Backup{constants.EncryptionTypeAES, "", bytes.Repeat([]byte{0xff}, 16)}, 14},
+		{"chacha20", Backup{constants.EncryptionTypeChaCha20, constants.KDFScrypt, make([]byte, 32)}, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Encode(tt.backup)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if len(encoded) != tt.words {
+				t.Fatalf("got %d words, want %d", len(encoded), tt.words)
+			}
+
+			decoded, err := Decode(strings.Join(encoded, " "))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if decoded.KeyType != tt.backup.KeyType || decoded.KDF != tt.backup.KDF || !bytes.Equal(decoded.Key, tt.backup.Key) {
+				t.Fatalf("Decode = %+v, want %+v", decoded, tt.backup)
+			}
+		})
+	}
+}
+
+func TestDecodeFormats(t *testing.T) {
+	backup := Backup{constants.EncryptionTypeAES, constants.KDFScrypt, bytes.Repeat([]byte{0x3c}, 32)}
+	encoded, err := Encode(backup)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	// Numbered, upper case and abbreviated to four letters, as copied from paper
+	var numbered strings.Builder
+	for i, w := range encoded {
+		if len(w) > 4 {
+			w = w[:4]
+		}
+		fmt.Fprintf(&numbered, "%2d. %s\n", i+1, strings.ToUpper(w))
+	}
+
+	decoded, err := Decode(numbered.String())
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !bytes.Equal(decoded.Key, backup.Key) {
+		t.Fatal("decoded key differs")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	backup := Backup{constants.EncryptionTypeChaCha20, constants.KDFScrypt, bytes.Repeat([]byte{0x42}, 32)}
+	encoded, err := Encode(backup)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	swapped := append([]string(nil), encoded...)
+	swapped[3], swapped[4] = swapped[4], swapped[3]
+	if _, err := Decode(strings.Join(swapped, " ")); !errors.Is(err, ErrChecksum) {
+		t.Errorf("swapped words: got %v, want ErrChecksum", err)
+	}
+
+	unknown := append([]string(nil), encoded...)
+	unknown[0] = "sietch"
+	if _, err := Decode(strings.Join(unknown, " ")); err == nil || !strings.Contains(err.Error(), "word 1") {
+		t.Errorf("unknown word: got %v", err)
+	}
+
+	if _, err := Decode(strings.Join(encoded[:20], " ")); err == nil {
+		t.Error("expected an error for a short mnemonic")
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	if _, err := Encode(Backup{KeyType: constants.EncryptionTypeGPG, Key: make([]byte, 32)}); err == nil {
+		t.Error("expected an error for a gpg key")
+	}
+	if _, err := Encode(Backup{KeyType: constants.EncryptionTypeChaCha20, Key: make([]byte, 16)}); err == nil {
+		t.Error("expected an error for a short chacha20 key")
+	}
+	if _, err := Encode(Backup{KeyType: constants.EncryptionTypeAES, KDF: "argon2", Key: make([]byte, 32)}); err == nil {
+		t.Error("expected an error for an unknown KDF")
+	}
+}
@@ -0,0 +1,122 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// chunkStores caches the chunk store settings of each vault by the path of
+// its vault.yaml, so they are only read again when vault.yaml changes
+var chunkStores sync.Map
+
+type chunkStoreEntry struct {
+	modTime time.Time
+	size    int64
+	dir     string
+	fanout  int
+}
+
+// chunkStoreSettings returns the chunk store settings in the vault.yaml of
+// the vault at basePath
+func chunkStoreSettings(basePath string) chunkStoreEntry {
+	configPath := filepath.Join(basePath, "vault.yaml")
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return chunkStoreEntry{}
+	}
+	if cached, ok := chunkStores.Load(configPath); ok {
+		entry := cached.(chunkStoreEntry)
+		if entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+			return entry
+		}
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return chunkStoreEntry{}
+	}
+	var cfg struct {
+		ChunkStore  string `yaml:"chunk_store"`
+		ChunkFanout int    `yaml:"chunk_fanout"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return chunkStoreEntry{}
+	}
+	dir := cfg.ChunkStore
+	if dir != "" && !filepath.IsAbs(dir) {
+		dir = filepath.Join(basePath, dir)
+	}
+	entry := chunkStoreEntry{modTime: info.ModTime(), size: info.Size(), dir: dir, fanout: min(max(cfg.ChunkFanout, 0), config.MaxChunkFanout)}
+	chunkStores.Store(configPath, entry)
+	return entry
+}
+
+// ChunkStore returns the directory outside the vault that the vault at
+// basePath keeps its chunks in, as recorded by chunk_store in its vault.yaml,
+// or "" if chunks are kept in .sietch/chunks. A relative chunk_store is
+// relative to the vault.
+func ChunkStore(basePath string) string {
+	return chunkStoreSettings(basePath).dir
+}
+
+// ChunkFanout returns how many levels of directories the vault at basePath
+// spreads its chunks over, as recorded by chunk_fanout in its vault.yaml.
+// Each level is named by the next two characters of the chunk's name, so
+// with 2 the chunk abcdef... is kept in ab/cd/abcdef...; 0 keeps every chunk
+// in one directory.
+func ChunkFanout(basePath string) int {
+	return chunkStoreSettings(basePath).fanout
+}
+
+// ChunkPath returns the path the chunk name is written at in the chunk store
+// of the vault at basePath
+func ChunkPath(basePath, name string) string {
+	return filepath.Join(GetChunkDirectory(basePath), filepath.FromSlash(config.ShardedChunkName(name, ChunkFanout(basePath))))
+}
+
+// LocateChunk returns the path of the chunk name in the chunk store of the
+// vault at basePath, in whichever layout it is stored
+func LocateChunk(basePath, name string) string {
+	return config.LocateChunk(GetChunkDirectory(basePath), ChunkFanout(basePath), name)
+}
+
+// ChunkRelPath returns the vault-relative path of the chunk name, as
+// transactions stage chunks: where it is stored, or where it would be written
+func ChunkRelPath(basePath, name string) string {
+	rel, err := filepath.Rel(GetChunkDirectory(basePath), LocateChunk(basePath, name))
+	if err != nil {
+		rel = config.ShardedChunkName(name, ChunkFanout(basePath))
+	}
+	return ".sietch/chunks/" + filepath.ToSlash(rel)
+}
+
+// WalkChunks calls fn with the name and path of every chunk in the chunk
+// store of the vault at basePath
+func WalkChunks(basePath string, fn func(name, path string, entry os.DirEntry) error) error {
+	return config.WalkChunks(GetChunkDirectory(basePath), fn)
+}
+
+// CheckChunkStore fails if the vault at basePath keeps its chunks outside
+// the vault and that directory is missing, such as when its disk is not
+// mounted, so chunks are never written to the mount point instead
+func CheckChunkStore(basePath string) error {
+	dir := ChunkStore(basePath)
+	if dir == "" {
+		return nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("chunk store %s is not available, check that its disk is mounted: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("chunk store %s is not a directory", dir)
+	}
+	return nil
+}
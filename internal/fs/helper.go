@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 )
 
@@ -30,8 +31,12 @@ func IsVaultInitialized(basePath string) bool {
 		vaultErr == nil && !vaultInfo.IsDir()
 }
 
-// GetChunkDirectory returns the path to the chunks directory
+// GetChunkDirectory returns the path to the chunks directory: the chunk
+// store recorded in vault.yaml if there is one, otherwise .sietch/chunks
 func GetChunkDirectory(basePath string) string {
+	if dir := ChunkStore(basePath); dir != "" {
+		return dir
+	}
 	return filepath.Join(basePath, ".sietch", "chunks")
 }
 
@@ -151,3 +156,16 @@ func ShouldSkipHidden(name string, includeHidden bool) bool {
 	// Skip files/directories starting with '.' (hidden on Unix-like systems)
 	return strings.HasPrefix(name, ".")
 }
+
+// VaultPath converts a path inside the vault given on the command line to
+// the form manifests use, with forward slashes. Backslashes are separators
+// only on Windows; elsewhere they are valid in file names and kept.
+func VaultPath(p string) string {
+	return filepath.ToSlash(p)
+}
+
+// PermissionsEnforced reports whether the platform honours POSIX permission
+// bits. Windows only maps the owner write bit to the read-only attribute and
+// controls access with ACLs, so modes read there say nothing about who can
+// read a file.
+const PermissionsEnforced = runtime.GOOS != "windows"
@@ -3,6 +3,7 @@ package fs
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/substantialcattle5/sietch/testutil"
@@ -660,3 +661,16 @@ func TestShouldSkipHidden(t *testing.T) {
 		})
 	}
 }
+
+func TestVaultPath(t *testing.T) {
+	if got := VaultPath("docs/notes/a.txt"); got != "docs/notes/a.txt" {
+		t.Errorf("VaultPath kept %q as %q", "docs/notes/a.txt", got)
+	}
+	want := `docs\a.txt`
+	if runtime.GOOS == "windows" {
+		want = "docs/a.txt"
+	}
+	if got := VaultPath(`docs\a.txt`); got != want {
+		t.Errorf("VaultPath(%q) = %q, want %q", `docs\a.txt`, got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrMetadataUnsupported is returned when the platform cannot read or write the requested metadata
+var ErrMetadataUnsupported = errors.New("file metadata not supported on this platform")
+
+// POSIX special permission bits, which os.FileMode stores outside the permission range
+const (
+	posixSetuid = 0o4000
+	posixSetgid = 0o2000
+	posixSticky = 0o1000
+)
+
+// PosixMode converts the permission bits of an os.FileMode to the POSIX numeric form (e.g. 0o4755)
+func PosixMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= posixSetuid
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= posixSetgid
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= posixSticky
+	}
+	return bits
+}
+
+// FileModeFromPosix converts POSIX numeric permission bits back to an os.FileMode
+func FileModeFromPosix(bits uint32) os.FileMode {
+	mode := os.FileMode(bits & 0o777)
+	if bits&posixSetuid != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&posixSetgid != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&posixSticky != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// FileID identifies a file on disk independently of its path, so hard links
+// to the same inode compare equal
+type FileID struct {
+	Dev uint64
+	Ino uint64
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package fs
+
+import "os"
+
+// FileOwner returns the numeric owner and group recorded in info.
+// Ownership is not available on this platform.
+func FileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// FileIdentity returns the device/inode pair of info and its hard link count.
+// Inode identity is not available on this platform.
+func FileIdentity(info os.FileInfo) (id FileID, links uint64, ok bool) {
+	return FileID{}, 0, false
+}
@@ -0,0 +1,81 @@
+package fs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPosixModeRoundTrip(t *testing.T) {
+	tests := []struct {
+		mode os.FileMode
+		bits uint32
+	}{
+		{0o644, 0o644},
+		{0o755, 0o755},
+		{0o755 | os.ModeSetuid, 0o4755},
+		{0o775 | os.ModeSetgid, 0o2775},
+		{0o777 | os.ModeSticky, 0o1777},
+	}
+
+	for _, tt := range tests {
+		if got := PosixMode(tt.mode); got != tt.bits {
+			t.Errorf("PosixMode(%v) = %o, want %o", tt.mode, got, tt.bits)
+		}
+		if got := FileModeFromPosix(tt.bits); got != tt.mode {
+			t.Errorf("FileModeFromPosix(%o) = %v, want %v", tt.bits, got, tt.mode)
+		}
+	}
+
+	// Type bits are dropped
+	if got := PosixMode(os.ModeDir | 0o700); got != 0o700 {
+		t.Errorf("PosixMode should ignore type bits, got %o", got)
+	}
+}
+
+func TestFileOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "owned.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	uid, gid, ok := FileOwner(info)
+	if runtime.GOOS == "windows" {
+		if ok {
+			t.Error("ownership should not be reported on windows")
+		}
+		return
+	}
+	if !ok || uid != os.Getuid() || gid < 0 {
+		t.Errorf("FileOwner = %d, %d, %v; expected uid %d", uid, gid, ok, os.Getuid())
+	}
+}
+
+func TestXattrsRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "attrs.txt")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	attrs := map[string][]byte{"user.sietch.test": []byte("value")}
+	if err := SetXattrs(path, attrs); err != nil {
+		if errors.Is(err, ErrMetadataUnsupported) {
+			t.Skip("extended attributes not supported here")
+		}
+		t.Skipf("cannot set extended attributes on this filesystem: %v", err)
+	}
+
+	got, err := ListXattrs(path)
+	if err != nil {
+		t.Fatalf("ListXattrs: %v", err)
+	}
+	if string(got["user.sietch.test"]) != "value" {
+		t.Errorf("unexpected xattrs: %v", got)
+	}
+}
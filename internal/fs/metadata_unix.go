@@ -0,0 +1,27 @@
+//go:build unix
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileOwner returns the numeric owner and group recorded in info
+func FileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// FileIdentity returns the device/inode pair of info and its hard link count
+func FileIdentity(info os.FileInfo) (id FileID, links uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}, 0, false
+	}
+	// Field types vary by platform, hence the conversions
+	return FileID{Dev: uint64(stat.Dev), Ino: uint64(stat.Ino)}, uint64(stat.Nlink), true
+}
@@ -0,0 +1,16 @@
+package fs
+
+// Extent is a contiguous byte range of a file
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// fullExtent returns the single extent covering a file of the given size,
+// used when the filesystem cannot report holes
+func fullExtent(size int64) []Extent {
+	if size <= 0 {
+		return nil
+	}
+	return []Extent{{Offset: 0, Length: size}}
+}
@@ -0,0 +1,54 @@
+//go:build linux || darwin || freebsd
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// DataExtents returns the ranges of file that hold data, skipping holes of
+// sparse files via SEEK_DATA/SEEK_HOLE. Filesystems without hole reporting
+// yield a single extent covering the whole file.
+func DataExtents(file *os.File, size int64) ([]Extent, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	// Leave the read offset where callers expect it
+	defer func() { _, _ = file.Seek(0, io.SeekStart) }()
+
+	fd := int(file.Fd())
+	var extents []Extent
+	for pos := int64(0); pos < size; {
+		data, err := unix.Seek(fd, pos, unix.SEEK_DATA)
+		if err != nil {
+			if errors.Is(err, unix.ENXIO) {
+				// No data past pos, the rest of the file is a hole
+				break
+			}
+			if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOTSUP) {
+				return fullExtent(size), nil
+			}
+			return nil, fmt.Errorf("failed to find data in %s: %w", file.Name(), err)
+		}
+		if data >= size {
+			break
+		}
+
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find hole in %s: %w", file.Name(), err)
+		}
+		if hole > size {
+			hole = size
+		}
+
+		extents = append(extents, Extent{Offset: data, Length: hole - data})
+		pos = hole
+	}
+	return extents, nil
+}
@@ -8,7 +8,10 @@ import (
 
 // StoreChunk writes a chunk to the chunk storage with the given hash as filename
 func StoreChunk(basePath string, chunkHash string, data []byte) error {
-	chunkPath := filepath.Join(GetChunkDirectory(basePath), chunkHash)
+	chunkPath := ChunkPath(basePath, chunkHash)
+	if err := os.MkdirAll(filepath.Dir(chunkPath), 0o755); err != nil {
+		return fmt.Errorf("failed to write chunk %s: %w", chunkHash, err)
+	}
 
 	// Write the chunk data to file
 	if err := os.WriteFile(chunkPath, data, 0o644); err != nil {
@@ -20,14 +23,14 @@ func StoreChunk(basePath string, chunkHash string, data []byte) error {
 
 // ChunkExists checks if a chunk with the given hash exists
 func ChunkExists(basePath string, chunkHash string) bool {
-	chunkPath := filepath.Join(GetChunkDirectory(basePath), chunkHash)
+	chunkPath := LocateChunk(basePath, chunkHash)
 	_, err := os.Stat(chunkPath)
 	return err == nil
 }
 
 // GetChunk retrieves a chunk by its hash
 func GetChunk(basePath string, chunkHash string) ([]byte, error) {
-	chunkPath := filepath.Join(GetChunkDirectory(basePath), chunkHash)
+	chunkPath := LocateChunk(basePath, chunkHash)
 
 	data, err := os.ReadFile(chunkPath)
 	if err != nil {
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package fs
+
+// ListXattrs returns every extended attribute set on path.
+// Extended attributes are not supported on this platform.
+func ListXattrs(path string) (map[string][]byte, error) {
+	return nil, ErrMetadataUnsupported
+}
+
+// SetXattrs sets each extended attribute in attrs on path.
+// Extended attributes are not supported on this platform.
+func SetXattrs(path string, attrs map[string][]byte) error {
+	if len(attrs) == 0 {
+		return nil
+	}
+	return ErrMetadataUnsupported
+}
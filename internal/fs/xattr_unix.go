@@ -0,0 +1,64 @@
+//go:build linux || darwin
+
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// ListXattrs returns every extended attribute set on path
+func ListXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, ErrMetadataUnsupported
+		}
+		return nil, fmt.Errorf("failed to list xattrs of %s: %w", path, err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Listxattr(path, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list xattrs of %s: %w", path, err)
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		valueSize, err := unix.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read xattr %s of %s: %w", name, path, err)
+		}
+		value := make([]byte, valueSize)
+		if valueSize > 0 {
+			valueSize, err = unix.Getxattr(path, string(name), value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read xattr %s of %s: %w", name, path, err)
+			}
+		}
+		attrs[string(name)] = value[:valueSize]
+	}
+	return attrs, nil
+}
+
+// SetXattrs sets each extended attribute in attrs on path
+func SetXattrs(path string, attrs map[string][]byte) error {
+	for name, value := range attrs {
+		if err := unix.Setxattr(path, name, value, 0); err != nil {
+			if errors.Is(err, unix.ENOTSUP) {
+				return ErrMetadataUnsupported
+			}
+			return fmt.Errorf("failed to set xattr %s on %s: %w", name, path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Package hooks runs the commands and webhooks a vault configures around its
+// operations (hooks in vault.yaml), passing each a JSON description of the
+// event.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Events hooks can be configured for
+const (
+	PostAdd  = "post_add"
+	PostSync = "post_sync"
+	PreGC    = "pre_gc"
+)
+
+// DefaultTimeout is how long a hook may take when hooks.timeout is not set
+const DefaultTimeout = 30 * time.Second
+
+// Event is the JSON payload given to every hook: on stdin for commands, as
+// the request body for webhooks
+type Event struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Vault     string    `json:"vault"`
+	VaultID   string    `json:"vault_id"`
+	VaultRoot string    `json:"vault_root"`
+	Data      any       `json:"data,omitempty"` // What the operation did or is about to do
+}
+
+// Run runs the hooks configured for event in order and stops at the first
+// that fails, returning its error. Pre hooks use it so a failure can stop
+// the operation.
+func Run(vaultRoot string, cfg *config.VaultConfig, event string, data any) error {
+	list := configured(cfg, event)
+	if len(list) == 0 {
+		return nil
+	}
+	payload, err := newPayload(vaultRoot, cfg, event, data)
+	if err != nil {
+		return err
+	}
+	timeout := hookTimeout(cfg)
+	for i, hook := range list {
+		if err := runHook(vaultRoot, event, hook, payload, timeout); err != nil {
+			return fmt.Errorf("%s hook %d failed: %w", event, i+1, err)
+		}
+	}
+	return nil
+}
+
+// Notify runs every hook configured for an event that already happened. A
+// failing hook cannot undo the operation, so failures are printed as
+// warnings and the remaining hooks still run.
+func Notify(vaultRoot string, cfg *config.VaultConfig, event string, data any) {
+	list := configured(cfg, event)
+	if len(list) == 0 {
+		return
+	}
+	payload, err := newPayload(vaultRoot, cfg, event, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s hooks not run: %v\n", event, err)
+		return
+	}
+	timeout := hookTimeout(cfg)
+	for i, hook := range list {
+		if err := runHook(vaultRoot, event, hook, payload, timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s hook %d failed: %v\n", event, i+1, err)
+		}
+	}
+}
+
+// configured returns the hooks cfg lists for event
+func configured(cfg *config.VaultConfig, event string) []config.Hook {
+	if cfg == nil {
+		return nil
+	}
+	switch event {
+	case PostAdd:
+		return cfg.Hooks.PostAdd
+	case PostSync:
+		return cfg.Hooks.PostSync
+	case PreGC:
+		return cfg.Hooks.PreGC
+	}
+	return nil
+}
+
+// hookTimeout returns how long each hook may take. hooks.timeout is
+// validated when set, so a value that does not parse falls back to the default.
+func hookTimeout(cfg *config.VaultConfig) time.Duration {
+	if d, err := time.ParseDuration(cfg.Hooks.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTimeout
+}
+
+// newPayload encodes the event given to the hooks
+func newPayload(vaultRoot string, cfg *config.VaultConfig, event string, data any) ([]byte, error) {
+	payload, err := json.Marshal(Event{
+		Event:     event,
+		Time:      time.Now().UTC(),
+		Vault:     cfg.Name,
+		VaultID:   cfg.VaultID,
+		VaultRoot: vaultRoot,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", event, err)
+	}
+	return payload, nil
+}
+
+// runHook runs one hook with payload, giving up after timeout
+func runHook(vaultRoot, event string, hook config.Hook, payload []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	switch {
+	case hook.Command != "" && hook.URL != "":
+		return errors.New("a hook sets either command or url, not both")
+	case hook.Command != "":
+		err = runCommand(ctx, vaultRoot, event, hook.Command, payload)
+	case hook.URL != "":
+		err = postWebhook(ctx, event, hook.URL, payload)
+	default:
+		return errors.New("hook has neither command nor url")
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	return err
+}
+
+// runCommand runs command with the shell in vaultRoot, with payload on
+// stdin. Its output goes to stderr so that it never mixes with structured
+// output on stdout.
+func runCommand(ctx context.Context, vaultRoot, event, command string, payload []byte) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = vaultRoot
+	cmd.Env = append(os.Environ(), "SIETCH_EVENT="+event, "SIETCH_VAULT_ROOT="+vaultRoot)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	// Background processes the command starts may keep its output open
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command %q: %w", command, err)
+	}
+	return nil
+}
+
+// postWebhook POSTs payload to url and expects a 2xx response
+func postWebhook(ctx context.Context, event, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sietch")
+	req.Header.Set("X-Sietch-Event", event)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered %s", url, resp.Status)
+	}
+	return nil
+}
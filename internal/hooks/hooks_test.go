@@ -0,0 +1,128 @@
+package hooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func skipWithoutShell(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are tested with sh")
+	}
+}
+
+func TestCommandHookReceivesEvent(t *testing.T) {
+	skipWithoutShell(t)
+	vaultRoot := t.TempDir()
+	cfg := &config.VaultConfig{Name: "field", VaultID: "v1"}
+	cfg.Hooks.PostAdd = []config.Hook{{Command: `cat > event.json; echo "$SIETCH_EVENT" > name.txt`}}
+
+	Notify(vaultRoot, cfg, PostAdd, map[string]any{"files": []string{"docs/a.txt"}})
+
+	data, err := os.ReadFile(filepath.Join(vaultRoot, "event.json"))
+	if err != nil {
+		t.Fatalf("hook did not run in the vault root: %v", err)
+	}
+	var event struct {
+		Event, Vault string
+		VaultID      string `json:"vault_id"`
+		Data         struct{ Files []string }
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("hook got invalid JSON %q: %v", data, err)
+	}
+	if event.Event != PostAdd || event.Vault != "field" || event.VaultID != "v1" || len(event.Data.Files) != 1 {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if name, _ := os.ReadFile(filepath.Join(vaultRoot, "name.txt")); strings.TrimSpace(string(name)) != PostAdd {
+		t.Errorf("expected SIETCH_EVENT=%s, got %q", PostAdd, name)
+	}
+}
+
+func TestWebhookReceivesEvent(t *testing.T) {
+	var got []byte
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		header = r.Header.Get("X-Sietch-Event")
+		got, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	cfg := &config.VaultConfig{Name: "field"}
+	cfg.Hooks.PostSync = []config.Hook{{URL: server.URL}}
+	if err := Run(t.TempDir(), cfg, PostSync, map[string]int{"files": 3}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if header != PostSync || !strings.Contains(string(got), `"files":3`) {
+		t.Errorf("unexpected webhook request %q with event %q", got, header)
+	}
+}
+
+func TestRunStopsAtFailingHook(t *testing.T) {
+	skipWithoutShell(t)
+	vaultRoot := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := &config.VaultConfig{}
+	cfg.Hooks.PreGC = []config.Hook{{URL: server.URL}, {Command: "touch ran"}}
+	err := Run(vaultRoot, cfg, PreGC, nil)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected the webhook's status in the error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultRoot, "ran")); err == nil {
+		t.Error("expected the hooks after the failing one not to run")
+	}
+
+	cfg.Hooks.PreGC = []config.Hook{{Command: "exit 3"}}
+	if err := Run(vaultRoot, cfg, PreGC, nil); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("expected a failing command to stop gc, got %v", err)
+	}
+}
+
+func TestNotifyRunsEveryHook(t *testing.T) {
+	skipWithoutShell(t)
+	vaultRoot := t.TempDir()
+	cfg := &config.VaultConfig{}
+	cfg.Hooks.PostSync = []config.Hook{{Command: "exit 1"}, {}, {Command: "touch ran"}}
+
+	Notify(vaultRoot, cfg, PostSync, nil)
+	if _, err := os.Stat(filepath.Join(vaultRoot, "ran")); err != nil {
+		t.Error("expected the last hook to run after the others failed")
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	skipWithoutShell(t)
+	cfg := &config.VaultConfig{}
+	cfg.Hooks.Timeout = "100ms"
+	cfg.Hooks.PreGC = []config.Hook{{Command: "exec sleep 5"}}
+
+	err := Run(t.TempDir(), cfg, PreGC, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected the hook to time out, got %v", err)
+	}
+}
+
+func TestNoHooksConfigured(t *testing.T) {
+	if err := Run(t.TempDir(), &config.VaultConfig{}, PreGC, nil); err != nil {
+		t.Errorf("expected no error without hooks, got %v", err)
+	}
+	Notify(t.TempDir(), nil, PostAdd, nil)
+}
@@ -0,0 +1,241 @@
+// Package ignore implements .sietchignore files, which use gitignore syntax to
+// exclude paths when adding directory trees to a vault.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// FileName is the name of the ignore file looked up in every added directory
+const FileName = ".sietchignore"
+
+// rule is a single compiled pattern line
+type rule struct {
+	base    string // Slash-separated directory the rule is relative to ("" for the root)
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher evaluates gitignore-style rules collected from one or more ignore files.
+// Paths passed to Match are slash-separated and relative to the tree root.
+type Matcher struct {
+	rules []rule
+}
+
+// New returns an empty matcher that ignores nothing
+func New() *Matcher {
+	return &Matcher{}
+}
+
+// AddPatterns compiles pattern lines relative to base (a slash-separated directory
+// inside the tree, "" for the root). Blank lines and comments are skipped.
+func (m *Matcher) AddPatterns(base string, lines []string) error {
+	base = strings.Trim(path.Clean("/"+base), "/")
+	for i, line := range lines {
+		r, ok, err := compileRule(base, line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return nil
+}
+
+// Globs returns a matcher for patterns given on the command line. They use
+// ignore file syntax, except that a pattern matches at any depth unless it
+// starts with a slash, so 'node_modules/**' matches every node_modules tree.
+func Globs(patterns []string) (*Matcher, error) {
+	m := New()
+	for _, pattern := range patterns {
+		r, ok, err := compilePattern("", pattern, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if ok {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m, nil
+}
+
+// AddFile loads the ignore file at filePath with rules relative to base.
+// A missing file is not an error.
+func (m *Matcher) AddFile(filePath, base string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	if err := m.AddPatterns(base, lines); err != nil {
+		return fmt.Errorf("invalid pattern in %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Match reports whether rel should be ignored. As with gitignore, the last
+// matching rule wins, a negated rule re-includes a previously ignored path, and
+// anything inside an ignored directory is ignored as well.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	if m == nil || len(m.rules) == 0 {
+		return false
+	}
+	rel = strings.Trim(path.Clean("/"+rel), "/")
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.matchOne(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.matchOne(rel, isDir)
+}
+
+// matchOne evaluates the rules against a single path without considering its parents
+func (m *Matcher) matchOne(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+
+		target := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			target = strings.TrimPrefix(rel, r.base+"/")
+		}
+
+		if r.re.MatchString(target) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// compileRule turns one ignore-file line into a rule. ok is false for blank lines and comments.
+func compileRule(base, line string) (rule, bool, error) {
+	return compilePattern(base, line, false)
+}
+
+// compilePattern compiles a pattern into a rule. With floating set only a
+// leading slash anchors the pattern; otherwise a slash anywhere does.
+func compilePattern(base, line string, floating bool) (rule, bool, error) {
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimSuffix(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false, nil
+	}
+
+	r := rule{base: base}
+	switch {
+	case strings.HasPrefix(line, "!"):
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, "\\!"), strings.HasPrefix(line, "\\#"):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false, nil
+	}
+
+	// A slash at the start or in the middle anchors the pattern to base;
+	// otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	if floating {
+		anchored = strings.HasPrefix(line, "/")
+	}
+	line = strings.TrimPrefix(line, "/")
+
+	expr, err := globToRegexp(line)
+	if err != nil {
+		return rule{}, false, err
+	}
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return rule{}, false, err
+	}
+	r.re = re
+	return r, true, nil
+}
+
+// globToRegexp converts a gitignore glob (supporting *, ?, [...] and **) into a regular expression
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				atStart := i == 0 || glob[i-1] == '/'
+				atEnd := i+2 == len(glob) || glob[i+2] == '/'
+				if atStart && atEnd {
+					i++
+					if i+1 < len(glob) {
+						// "**/" matches zero or more directories
+						i++
+						b.WriteString("(?:.*/)?")
+					} else {
+						// trailing "**" matches everything inside
+						b.WriteString(".*")
+					}
+					continue
+				}
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class in %q", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
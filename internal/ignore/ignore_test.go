@@ -0,0 +1,142 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatcher_Patterns(t *testing.T) {
+	m := New()
+	err := m.AddPatterns("", []string{
+		"# build output",
+		"",
+		"*.o",
+		"build/",
+		"/TODO",
+		"docs/**/*.tmp",
+		"logs/**",
+		"*.log",
+		"!keep.log",
+		"\\#literal",
+		"cache?",
+		"[ab].bak",
+	})
+	if err != nil {
+		t.Fatalf("AddPatterns: %v", err)
+	}
+
+	tests := []struct {
+		rel      string
+		isDir    bool
+		expected bool
+	}{
+		{"main.o", false, true},
+		{"src/deep/main.o", false, true},
+		{"main.c", false, false},
+		{"build", true, true},
+		{"build", false, false}, // dir-only pattern does not match files
+		{"build/out/bin", false, true},
+		{"src/build/x.c", false, true},
+		{"TODO", false, true},
+		{"src/TODO", false, false}, // anchored to root
+		{"docs/a/b/c.tmp", false, true},
+		{"docs/c.tmp", false, true},
+		{"other/c.tmp", false, false},
+		{"logs/2024/app.txt", false, true},
+		{"app.log", false, true},
+		{"keep.log", false, false},
+		{"#literal", false, true},
+		{"cache1", false, true},
+		{"cache12", false, false},
+		{"a.bak", false, true},
+		{"c.bak", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := m.Match(tt.rel, tt.isDir); got != tt.expected {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMatcher_NestedBase(t *testing.T) {
+	m := New()
+	if err := m.AddPatterns("sub", []string{"*.tmp", "/only-here"}); err != nil {
+		t.Fatalf("AddPatterns: %v", err)
+	}
+
+	if !m.Match("sub/a.tmp", false) || !m.Match("sub/deeper/a.tmp", false) {
+		t.Error("nested rules should apply below their directory")
+	}
+	if m.Match("a.tmp", false) || m.Match("other/a.tmp", false) {
+		t.Error("nested rules must not apply outside their directory")
+	}
+	if !m.Match("sub/only-here", false) || m.Match("sub/x/only-here", false) {
+		t.Error("anchored nested rule should be relative to its directory")
+	}
+}
+
+func TestMatcher_AddFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, []byte("node_modules/\n*.cache   \n"), 0o644); err != nil {
+		t.Fatalf("write ignore file: %v", err)
+	}
+
+	m := New()
+	if err := m.AddFile(path, ""); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if !m.Match("web/node_modules/react/index.js", false) {
+		t.Error("expected files inside ignored directory to be ignored")
+	}
+	if !m.Match("x.cache", false) {
+		t.Error("trailing whitespace should be trimmed from patterns")
+	}
+
+	if err := m.AddFile(filepath.Join(dir, "missing"), ""); err != nil {
+		t.Errorf("missing ignore file should not be an error: %v", err)
+	}
+
+	var nilMatcher *Matcher
+	if nilMatcher.Match("anything", false) {
+		t.Error("nil matcher should ignore nothing")
+	}
+}
+
+func TestMatcher_InvalidPattern(t *testing.T) {
+	if err := New().AddPatterns("", []string{"[abc"}); err == nil {
+		t.Error("expected error for unterminated character class")
+	}
+}
+
+func TestGlobs(t *testing.T) {
+	m, err := Globs([]string{"node_modules/**", "*.o", "/dist"})
+	if err != nil {
+		t.Fatalf("Globs: %v", err)
+	}
+	tests := []struct {
+		rel      string
+		isDir    bool
+		expected bool
+	}{
+		{"node_modules/x/index.js", false, true},
+		{"app/node_modules/x/index.js", false, true}, // not anchored by its slash
+		{"src/main.o", false, true},
+		{"src/main.c", false, false},
+		{"dist", true, true},
+		{"web/dist", true, false}, // a leading slash anchors to the root
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.rel, tt.isDir); got != tt.expected {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.expected)
+		}
+	}
+
+	if _, err := Globs([]string{"[abc"}); err == nil {
+		t.Error("expected error for unterminated character class")
+	}
+}
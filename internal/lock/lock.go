@@ -0,0 +1,194 @@
+// Package lock serializes commands that change a vault. A command holds the
+// vault lock by owning .sietch/lock, which records the process that created
+// it so locks left behind by a crashed process can be detected and taken over.
+package lock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned when another process holds the vault lock
+var ErrLocked = errors.New("vault is locked by another sietch process")
+
+// pollInterval is how often a waiting Acquire checks the lock again
+const pollInterval = 200 * time.Millisecond
+
+// staleUnreadable is how long a lock file that cannot be parsed is assumed to
+// be in the middle of being written before it is treated as stale
+const staleUnreadable = 10 * time.Second
+
+// Owner describes the process holding a vault lock
+type Owner struct {
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	Command    string    `json:"command,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+func (o Owner) String() string {
+	command := o.Command
+	if command == "" {
+		command = "sietch"
+	}
+	return fmt.Sprintf("%s (pid %d on %s, since %s)", command, o.PID, o.Host, o.AcquiredAt.Local().Format(time.RFC3339))
+}
+
+// Stale reports whether the owner's process has exited. Only processes on
+// this host can be checked; locks from other hosts are never stale.
+func (o Owner) Stale() bool {
+	host, _ := os.Hostname()
+	if o.Host != host {
+		return false
+	}
+	return !ProcessRunning(o.PID)
+}
+
+// Options controls how Acquire behaves when the lock is held
+type Options struct {
+	// Command is recorded in the lock file to tell other processes who holds it
+	Command string
+	// Wait is how long to wait for the lock: 0 gives up immediately and a
+	// negative value waits until it is released
+	Wait time.Duration
+	// OnWait is called once, with the current holder, before waiting
+	OnWait func(Owner)
+}
+
+// Lock is a held vault lock
+type Lock struct {
+	path  string
+	owned bool
+}
+
+// Path returns the location of the lock file of the vault at vaultRoot
+func Path(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "lock")
+}
+
+// Acquire takes the lock of the vault at vaultRoot. Locks held by exited
+// processes on this host are taken over. A lock already held by this process
+// is returned as is, and releasing it leaves it to the outer holder.
+func Acquire(vaultRoot string, opts Options) (*Lock, error) {
+	path := Path(vaultRoot)
+	host, _ := os.Hostname()
+	me := Owner{PID: os.Getpid(), Host: host, Command: opts.Command}
+
+	var deadline time.Time
+	if opts.Wait > 0 {
+		deadline = time.Now().Add(opts.Wait)
+	}
+	notified := false
+
+	for {
+		me.AcquiredAt = time.Now().UTC()
+		err := create(path, me)
+		if err == nil {
+			return &Lock{path: path, owned: true}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %v", err)
+		}
+
+		data, holder, err := read(path)
+		switch {
+		case os.IsNotExist(err):
+			continue // released while we looked
+		case err != nil:
+			if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleUnreadable {
+				removeIfUnchanged(path, data)
+				continue
+			}
+		case holder.PID == me.PID && holder.Host == me.Host:
+			return &Lock{path: path}, nil
+		case holder.Stale():
+			removeIfUnchanged(path, data)
+			continue
+		}
+
+		if opts.Wait == 0 || (!deadline.IsZero() && time.Now().After(deadline)) {
+			if holder.PID == 0 {
+				return nil, fmt.Errorf("%w: %s is being created by another process", ErrLocked, path)
+			}
+			return nil, fmt.Errorf("%w: held by %s", ErrLocked, holder)
+		}
+		if !notified && opts.OnWait != nil && holder.PID != 0 {
+			opts.OnWait(holder)
+			notified = true
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Release gives up the lock
+func (l *Lock) Release() error {
+	if l == nil || !l.owned {
+		return nil
+	}
+	l.owned = false
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock file: %v", err)
+	}
+	return nil
+}
+
+// Holder returns the owner of the vault's lock, or nil if it is not locked
+func Holder(vaultRoot string) (*Owner, error) {
+	_, holder, err := read(Path(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &holder, nil
+}
+
+// create writes a new lock file for owner, failing if one exists
+func create(path string, owner Owner) error {
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// read returns the raw contents of the lock file and its parsed owner
+func read(path string) ([]byte, Owner, error) {
+	var owner Owner
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, owner, err
+	}
+	if err := json.Unmarshal(data, &owner); err != nil || owner.PID == 0 {
+		return data, Owner{}, fmt.Errorf("lock file %s is not valid", path)
+	}
+	return data, owner, nil
+}
+
+// removeIfUnchanged removes a stale lock file unless another process has
+// replaced it since it was read
+func removeIfUnchanged(path string, stale []byte) {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, stale) {
+		_ = os.Remove(path)
+	}
+}
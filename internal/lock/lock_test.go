@@ -0,0 +1,110 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestVault(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// writeOwner plants a lock file as if another process held the lock
+func writeOwner(t *testing.T, root string, owner Owner) {
+	t.Helper()
+	data, err := json.Marshal(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(Path(root), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	root := newTestVault(t)
+
+	l, err := Acquire(root, Options{Command: "add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := Holder(root)
+	if err != nil || holder == nil || holder.PID != os.Getpid() || holder.Command != "add" {
+		t.Fatalf("unexpected holder %+v (%v)", holder, err)
+	}
+
+	// The same process may take the lock again; only the outer holder releases it
+	inner, err := Acquire(root, Options{Command: "recover"})
+	if err != nil {
+		t.Fatalf("expected reentrant acquire to succeed: %v", err)
+	}
+	if err := inner.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if holder, _ := Holder(root); holder == nil {
+		t.Fatal("inner release should keep the lock held")
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if holder, err := Holder(root); holder != nil || err != nil {
+		t.Fatalf("expected lock to be released, got %+v (%v)", holder, err)
+	}
+}
+
+func TestAcquireHeldByRunningProcess(t *testing.T) {
+	root := newTestVault(t)
+	host, _ := os.Hostname()
+	// The test runner is running, so its lock is not stale
+	writeOwner(t, root, Owner{PID: os.Getppid(), Host: host, Command: "add", AcquiredAt: time.Now()})
+
+	if _, err := Acquire(root, Options{}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked without waiting, got %v", err)
+	}
+
+	waited := false
+	start := time.Now()
+	_, err := Acquire(root, Options{Wait: 300 * time.Millisecond, OnWait: func(Owner) { waited = true }})
+	if !errors.Is(err, ErrLocked) || !waited || time.Since(start) < 300*time.Millisecond {
+		t.Fatalf("expected to wait then give up, got %v after %v (waited %v)", err, time.Since(start), waited)
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = os.Remove(Path(root))
+	}()
+	l, err := Acquire(root, Options{Wait: -1})
+	if err != nil {
+		t.Fatalf("expected lock once released, got %v", err)
+	}
+	_ = l.Release()
+}
+
+func TestAcquireTakesOverStaleLock(t *testing.T) {
+	root := newTestVault(t)
+	host, _ := os.Hostname()
+
+	// A process ID far above any in use on the test machine
+	writeOwner(t, root, Owner{PID: 1 << 30, Host: host, Command: "add", AcquiredAt: time.Now()})
+	l, err := Acquire(root, Options{})
+	if err != nil {
+		t.Fatalf("expected stale lock to be taken over: %v", err)
+	}
+	_ = l.Release()
+
+	// Locks from other hosts cannot be checked and are never stale
+	writeOwner(t, root, Owner{PID: 1 << 30, Host: host + "-elsewhere", AcquiredAt: time.Now()})
+	if _, err := Acquire(root, Options{}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected lock from another host to be honoured, got %v", err)
+	}
+}
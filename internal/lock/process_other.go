@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd
+
+package lock
+
+import "os"
+
+// ProcessRunning reports whether a process with the given ID exists. On these
+// platforms finding a process fails once it has exited.
+func ProcessRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package lock
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ProcessRunning reports whether a process with the given ID exists
+func ProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
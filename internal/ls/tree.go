@@ -0,0 +1,107 @@
+package ls
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// TreeNode is a directory in the vault namespace, built from manifest Destination paths
+type TreeNode struct {
+	Name      string
+	Children  map[string]*TreeNode
+	Files     []config.FileManifest
+	TotalSize int64 // Aggregate size of all files at or below this node
+	FileCount int   // Aggregate number of files at or below this node
+}
+
+func newTreeNode(name string) *TreeNode {
+	return &TreeNode{Name: name, Children: make(map[string]*TreeNode)}
+}
+
+// BuildTree groups files into a directory tree keyed by their Destination path
+func BuildTree(files []config.FileManifest) *TreeNode {
+	root := newTreeNode(".")
+	for _, file := range files {
+		node := root
+		node.TotalSize += file.Size
+		node.FileCount++
+
+		for _, part := range strings.Split(file.Destination, "/") {
+			if part == "" || part == "." {
+				continue
+			}
+			child, ok := node.Children[part]
+			if !ok {
+				child = newTreeNode(part)
+				node.Children[part] = child
+			}
+			child.TotalSize += file.Size
+			child.FileCount++
+			node = child
+		}
+		node.Files = append(node.Files, file)
+	}
+	return root
+}
+
+// DisplayTree prints files as a directory tree with per-directory aggregate sizes and file counts
+func DisplayTree(files []config.FileManifest, showTags bool) {
+	root := BuildTree(files)
+	fmt.Printf("%s (%s)\n", root.Name, formatTreeSummary(root))
+	printTreeNode(root, "", showTags)
+}
+
+func printTreeNode(node *TreeNode, indent string, showTags bool) {
+	dirNames := make([]string, 0, len(node.Children))
+	for name := range node.Children {
+		dirNames = append(dirNames, name)
+	}
+	sort.Strings(dirNames)
+
+	files := append([]config.FileManifest{}, node.Files...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FilePath < files[j].FilePath
+	})
+
+	total := len(dirNames) + len(files)
+	i := 0
+
+	// Directories first, then files, each group alphabetically
+	for _, name := range dirNames {
+		i++
+		branch, nextIndent := treeBranch(indent, i == total)
+		child := node.Children[name]
+		fmt.Printf("%s%s/ (%s)\n", branch, child.Name, formatTreeSummary(child))
+		printTreeNode(child, nextIndent, showTags)
+	}
+
+	for _, file := range files {
+		i++
+		branch, _ := treeBranch(indent, i == total)
+		if showTags && len(file.Tags) > 0 {
+			fmt.Printf("%s%s (%s) [%s]\n", branch, file.FilePath, util.HumanReadableSize(file.Size), strings.Join(file.Tags, ", "))
+		} else {
+			fmt.Printf("%s%s (%s)\n", branch, file.FilePath, util.HumanReadableSize(file.Size))
+		}
+	}
+}
+
+// treeBranch returns the connector for an entry and the indent for its children
+func treeBranch(indent string, last bool) (string, string) {
+	if last {
+		return indent + "└── ", indent + "    "
+	}
+	return indent + "├── ", indent + "│   "
+}
+
+func formatTreeSummary(node *TreeNode) string {
+	noun := "files"
+	if node.FileCount == 1 {
+		noun = "file"
+	}
+	return fmt.Sprintf("%d %s, %s", node.FileCount, noun, util.HumanReadableSize(node.TotalSize))
+}
@@ -0,0 +1,60 @@
+package ls
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestBuildTree_Aggregates(t *testing.T) {
+	files := []config.FileManifest{
+		createTestManifest("a.txt", "docs/", 100, nil, nil),
+		createTestManifest("b.txt", "docs/sub/", 50, nil, nil),
+		createTestManifest("root.txt", "", 10, nil, nil),
+	}
+
+	root := BuildTree(files)
+	if root.FileCount != 3 || root.TotalSize != 160 {
+		t.Fatalf("root aggregates = %d files, %d bytes", root.FileCount, root.TotalSize)
+	}
+	if len(root.Files) != 1 || root.Files[0].FilePath != "root.txt" {
+		t.Fatalf("expected root.txt at root, got %+v", root.Files)
+	}
+
+	docs := root.Children["docs"]
+	if docs == nil || docs.FileCount != 2 || docs.TotalSize != 150 {
+		t.Fatalf("unexpected docs node: %+v", docs)
+	}
+	sub := docs.Children["sub"]
+	if sub == nil || sub.FileCount != 1 || sub.TotalSize != 50 {
+		t.Fatalf("unexpected sub node: %+v", sub)
+	}
+}
+
+func TestDisplayTree_Output(t *testing.T) {
+	files := []config.FileManifest{
+		createTestManifest("z.txt", "", 1, nil, nil),
+		createTestManifest("b.txt", "docs/", 1, []string{"work"}, nil),
+		createTestManifest("a.txt", "docs/", 1, nil, nil),
+	}
+
+	out := captureStdout(t, func() { DisplayTree(files, true) })
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+
+	expected := []string{
+		". (3 files, 3 B)",
+		"├── docs/ (2 files, 2 B)",
+		"│   ├── a.txt (1 B)",
+		"│   └── b.txt (1 B) [work]",
+		"└── z.txt (1 B)",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(expected), out)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], expected[i])
+		}
+	}
+}
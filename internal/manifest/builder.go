@@ -1,10 +1,10 @@
 package manifest
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"gopkg.in/yaml.v3"
 
@@ -12,23 +12,14 @@ import (
 	"github.com/substantialcattle5/sietch/util"
 )
 
-// WriteManifest writes the vault configuration to vault.yaml
-// ensuring that any encryption keys in the config are properly stored
+// WriteManifest writes the vault configuration to vault.yaml. Key material is
+// left out; it belongs in the key file at cfg.Encryption.KeyPath.
 func WriteManifest(basePath string, cfg config.VaultConfig) error {
 	manifestPath := filepath.Join(basePath, "vault.yaml")
+	cfg.Encryption = config.WithoutKeyMaterial(cfg.Encryption)
 
-	// Verify if the encryption key is present in the config
-	if cfg.Encryption.Type == "aes" && cfg.Encryption.AESConfig != nil {
-		// Log that we're storing a key in the manifest
-		if cfg.Encryption.AESConfig.Key != "" {
-			fmt.Println("Storing encryption key in vault configuration")
-		} else {
-			fmt.Println("Warning: No encryption key found in AESConfig")
-		}
-	}
-
-	// Create manifest file with restricted permissions (0600) to secure the key
-	// Only owner can read/write the file since it will contain sensitive key material
+	// Create manifest file with restricted permissions (0600), since it
+	// describes how the vault's keys are protected
 	manifestFile, err := os.OpenFile(manifestPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
 	if err != nil {
 		return fmt.Errorf("failed to create manifest file: %w", err)
@@ -56,12 +47,14 @@ func StoreFileManifest(vaultRoot string, fileName string, manifest *config.FileM
 	}
 
 	// Create manifest file path
-	destination := strings.ReplaceAll(manifest.Destination, "/", ".")
-	uniqueFileIdentifier := destination + fileName + ".yaml"
+	uniqueFileIdentifier, err := config.ManifestFileName(vaultRoot, manifest.Destination, fileName)
+	if err != nil {
+		return err
+	}
 	manifestPath := filepath.Join(manifestsDir, uniqueFileIdentifier)
 
 	// Check if file exists
-	_, err := os.Stat(manifestPath)
+	_, err = os.Stat(manifestPath)
 	if err == nil {
 		message := fmt.Sprintf("'%s' exists. Overwrite? ", manifest.Destination+fileName)
 		response, err := util.ConfirmOverwrite(message, os.Stdin, os.Stdout)
@@ -70,19 +63,22 @@ func StoreFileManifest(vaultRoot string, fileName string, manifest *config.FileM
 		}
 	}
 
-	// Create/Overwrite the file
-	file, err := os.Create(manifestPath)
-	if err != nil {
-		return fmt.Errorf("failed to create manifest file: %v", err)
-	}
-	defer file.Close()
-
 	// Encode the manifest to YAML
-	encoder := yaml.NewEncoder(file)
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
 	encoder.SetIndent(2)
 	if err := encoder.Encode(manifest); err != nil {
 		return fmt.Errorf("failed to encode manifest: %v", err)
 	}
+	data, err := config.SealMetadata(vaultRoot, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	// Create/Overwrite the file
+	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to create manifest file: %v", err)
+	}
 
 	return nil
 }
@@ -95,6 +91,9 @@ func LoadFileManifest(vaultRoot string, fileName string) (*config.FileManifest,
 	if err != nil {
 		return nil, fmt.Errorf("failed to read manifest file: %v", err)
 	}
+	if data, err = config.OpenMetadata(vaultRoot, data); err != nil {
+		return nil, err
+	}
 
 	var manifest config.FileManifest
 	if err := yaml.Unmarshal(data, &manifest); err != nil {
@@ -144,13 +143,6 @@ func LoadVaultConfig(vaultRoot string) (*config.VaultConfig, error) {
 		return nil, fmt.Errorf("failed to parse vault configuration: %w", err)
 	}
 
-	// Check if encryption key is present
-	if cfg.Encryption.Type == "aes" && cfg.Encryption.AESConfig != nil {
-		if cfg.Encryption.AESConfig.Key != "" {
-			fmt.Println("Found encryption key in vault configuration")
-		}
-	}
-
 	return &cfg, nil
 }
 
@@ -0,0 +1,98 @@
+// Package migrate upgrades vaults created by older versions of sietch to the
+// current schema. Each migration moves a vault forward by exactly one schema
+// version and migrations always run in order.
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Migration upgrades a vault from schema version From to From+1. Apply may
+// change cfg, which is saved after it returns, and must back up any other file
+// it rewrites with Backup.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(vaultRoot string, cfg *config.VaultConfig, backupDir string) error
+}
+
+// Result describes a completed migration run
+type Result struct {
+	FromVersion int
+	ToVersion   int
+	Applied     []Migration
+	BackupDir   string
+}
+
+// Pending returns the migrations needed to bring a vault at version up to
+// config.CurrentSchemaVersion, in the order they must run
+func Pending(version int) []Migration {
+	var pending []Migration
+	for _, m := range migrations {
+		if m.From >= version && m.From < config.CurrentSchemaVersion {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// Run applies every pending migration to the vault at vaultRoot. vault.yaml is
+// copied to a timestamped directory under .sietch/backups first, and the schema
+// version is saved after each step so an interrupted run resumes where it
+// stopped. Vaults with a newer schema than this build supports are refused.
+func Run(vaultRoot string) (*Result, error) {
+	cfg, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{FromVersion: cfg.SchemaVersion, ToVersion: cfg.SchemaVersion}
+	pending := Pending(cfg.SchemaVersion)
+	if len(pending) == 0 {
+		return result, nil
+	}
+
+	backupDir := filepath.Join(vaultRoot, ".sietch", "backups",
+		fmt.Sprintf("schema-v%d-%s", cfg.SchemaVersion, time.Now().UTC().Format("20060102T150405Z")))
+	if err := Backup(vaultRoot, "vault.yaml", backupDir); err != nil {
+		return nil, err
+	}
+	result.BackupDir = backupDir
+
+	for _, m := range pending {
+		if err := m.Apply(vaultRoot, cfg, backupDir); err != nil {
+			return result, fmt.Errorf("migration v%d → v%d (%s) failed: %v", m.From, m.From+1, m.Description, err)
+		}
+		cfg.SchemaVersion = m.From + 1
+		if err := config.SaveVaultConfig(vaultRoot, cfg); err != nil {
+			return result, fmt.Errorf("failed to save vault configuration after migration to v%d: %v", cfg.SchemaVersion, err)
+		}
+		result.Applied = append(result.Applied, m)
+		result.ToVersion = cfg.SchemaVersion
+	}
+	return result, nil
+}
+
+// Backup copies the vault file at rel (slash-separated, relative to vaultRoot)
+// into backupDir, keeping its relative path
+func Backup(vaultRoot, rel, backupDir string) error {
+	data, err := os.ReadFile(filepath.Join(vaultRoot, filepath.FromSlash(rel)))
+	if err != nil {
+		return fmt.Errorf("failed to read %s for backup: %v", rel, err)
+	}
+
+	dest := filepath.Join(backupDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dest), constants.StandardDirPerms); err != nil {
+		return fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	if err := os.WriteFile(dest, data, constants.StandardFilePerms); err != nil {
+		return fmt.Errorf("failed to back up %s: %v", rel, err)
+	}
+	return nil
+}
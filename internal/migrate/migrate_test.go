@@ -0,0 +1,277 @@
+package migrate
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/encryption/aesencryption/aeskey"
+)
+
+// legacyKeyCheck seals the validation string the way old vaults did: a 16-byte
+// nonce is stored but only its first 12 bytes are used
+func legacyKeyCheck(t *testing.T, key []byte) string {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, constants.LegacyNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	sealed := gcm.Seal(nil, nonce[:gcm.NonceSize()], []byte(constants.KeyValidationString), nil)
+	return base64.StdEncoding.EncodeToString(append(nonce, sealed...))
+}
+
+func TestUpgradeKeyCheck(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := legacyKeyCheck(t, key)
+	if err := aeskey.VerifyPassphrase(legacy, key); err == nil {
+		t.Fatal("expected the legacy key check to fail standard verification")
+	}
+
+	upgraded := upgradeKeyCheck(legacy)
+	if err := aeskey.VerifyPassphrase(upgraded, key); err != nil {
+		t.Fatalf("upgraded key check failed verification: %v", err)
+	}
+
+	// Current key checks and garbage are left alone
+	current, err := aeskey.GenerateKeyCheck(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, keyCheck := range []string{current, "", "not base64!"} {
+		if got := upgradeKeyCheck(keyCheck); got != keyCheck {
+			t.Errorf("upgradeKeyCheck(%q) = %q, want unchanged", keyCheck, got)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	if got := len(Pending(0)); got != config.CurrentSchemaVersion {
+		t.Errorf("expected %d migrations from v0, got %d", config.CurrentSchemaVersion, got)
+	}
+	if got := Pending(config.CurrentSchemaVersion); len(got) != 0 {
+		t.Errorf("expected no migrations at the current version, got %d", len(got))
+	}
+	for i, m := range Pending(0) {
+		if m.From != i {
+			t.Errorf("migration %d starts at v%d", i, m.From)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	vaultRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(vaultRoot, ".sietch"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.VaultConfig{Name: "old"}
+	cfg.Encryption.AESConfig = &config.AESConfig{KeyCheck: legacyKeyCheck(t, key)}
+	if err := config.SaveVaultConfig(vaultRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(vaultRoot)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.FromVersion != 0 || result.ToVersion != config.CurrentSchemaVersion || len(result.Applied) != config.CurrentSchemaVersion {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(result.BackupDir, "vault.yaml")); err != nil {
+		t.Errorf("expected vault.yaml backup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(vaultRoot, ".sietch", "manifests")); err != nil {
+		t.Errorf("expected manifests directory to be created: %v", err)
+	}
+
+	migrated, err := config.LoadVaultConfig(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := aeskey.VerifyPassphrase(migrated.Encryption.AESConfig.KeyCheck, key); err != nil {
+		t.Errorf("migrated key check does not verify: %v", err)
+	}
+
+	// A second run has nothing to do
+	again, err := Run(vaultRoot)
+	if err != nil || len(again.Applied) != 0 || again.BackupDir != "" {
+		t.Errorf("expected no-op second run, got %+v (%v)", again, err)
+	}
+
+	// Newer vaults are refused
+	migrated.SchemaVersion = config.CurrentSchemaVersion + 1
+	if err := config.SaveVaultConfig(vaultRoot, migrated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(vaultRoot); !errors.Is(err, config.ErrUnsupportedSchema) {
+		t.Errorf("expected ErrUnsupportedSchema, got %v", err)
+	}
+}
+
+func TestMoveKeyMaterialToKeyFile(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	other := make([]byte, 32)
+	if _, err := rand.Read(other); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		existing    []byte
+		wantKeyFile []byte
+		wantSideKey bool
+	}{
+		{"missing key file", nil, key, false},
+		{"matching key file", key, key, false},
+		{"different key file", other, other, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vaultRoot := t.TempDir()
+			keyPath := filepath.Join(vaultRoot, ".sietch", "keys", "secret.key")
+			if tt.existing != nil {
+				if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(keyPath, tt.existing, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg := &config.VaultConfig{Name: "old", SchemaVersion: 2}
+			cfg.Encryption.Type = constants.EncryptionTypeAES
+			cfg.Encryption.KeyPath = keyPath
+			cfg.Encryption.AESConfig = &config.AESConfig{Key: base64.StdEncoding.EncodeToString(key), Mode: "gcm"}
+			if err := config.SaveVaultConfig(vaultRoot, cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := Run(vaultRoot)
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+
+			migrated, err := config.LoadVaultConfig(vaultRoot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if migrated.Encryption.AESConfig.Key != "" || migrated.Encryption.AESConfig.Mode != "gcm" {
+				t.Errorf("expected key removed and other settings kept, got %+v", migrated.Encryption.AESConfig)
+			}
+			data, err := os.ReadFile(filepath.Join(vaultRoot, "vault.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), base64.StdEncoding.EncodeToString(key)) {
+				t.Error("vault.yaml still contains the key")
+			}
+
+			if got, err := os.ReadFile(keyPath); err != nil || !bytes.Equal(got, tt.wantKeyFile) {
+				t.Errorf("unexpected key file contents (%v)", err)
+			}
+			sideKey, err := os.ReadFile(keyPath + ".from-vault-yaml")
+			if tt.wantSideKey != (err == nil) || (tt.wantSideKey && !bytes.Equal(sideKey, key)) {
+				t.Errorf("expected key from vault.yaml kept aside: %v, got err %v", tt.wantSideKey, err)
+			}
+
+			info, err := os.Stat(filepath.Join(result.BackupDir, "vault.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != constants.SecureFilePerms {
+				t.Errorf("expected backup with key to be private, got %v", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestRenameByPathHash(t *testing.T) {
+	vaultRoot := t.TempDir()
+	cfg := &config.VaultConfig{Name: "old", SchemaVersion: 3}
+	if err := config.SaveVaultConfig(vaultRoot, cfg); err != nil {
+		t.Fatal(err)
+	}
+	manifests := filepath.Join(vaultRoot, ".sietch", "manifests")
+	tombstones := filepath.Join(vaultRoot, ".sietch", "tombstones")
+	for _, dir := range []string{manifests, tombstones} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(manifests, "docs.a.txt.yaml"), "file: a.txt\ndestination: docs/\n")
+	write(filepath.Join(manifests, "b.txt.yaml"), "file: b.txt\ndestination: \"\"\n")
+	// A second copy of b.txt under another old name
+	write(filepath.Join(manifests, "copy.yaml"), "file: b.txt\ndestination: \"\"\n")
+	write(filepath.Join(manifests, "broken.yaml"), "{")
+	write(filepath.Join(tombstones, "docs.gone.txt.yaml"), "file: gone.txt\ndestination: docs/\n")
+
+	result, err := Run(vaultRoot)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	for dir, files := range map[string][][2]string{
+		manifests:  {{"docs/", "a.txt"}, {"", "b.txt"}},
+		tombstones: {{"docs/", "gone.txt"}},
+	} {
+		for _, f := range files {
+			name, err := config.ManifestFileName(vaultRoot, f[0], f[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Errorf("expected %s%s under its new name: %v", f[0], f[1], err)
+			}
+		}
+	}
+	entries, err := os.ReadDir(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected two renamed manifests and the unreadable one, got %d files", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(manifests, "broken.yaml")); err != nil {
+		t.Errorf("expected an unreadable manifest to keep its name: %v", err)
+	}
+	// Whichever copy of b.txt was renamed, the other is in the backup
+	_, errBTxt := os.Stat(filepath.Join(result.BackupDir, ".sietch", "manifests", "b.txt.yaml"))
+	_, errCopy := os.Stat(filepath.Join(result.BackupDir, ".sietch", "manifests", "copy.yaml"))
+	if (errBTxt == nil) == (errCopy == nil) {
+		t.Errorf("expected exactly one copy of b.txt backed up (%v, %v)", errBTxt, errCopy)
+	}
+}
@@ -0,0 +1,191 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// migrations lists every schema upgrade, ordered by From
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "adopt versioned schema and create missing vault directories",
+		Apply: func(vaultRoot string, _ *config.VaultConfig, _ string) error {
+			return fs.CreateVaultStructure(vaultRoot)
+		},
+	},
+	{
+		From:        1,
+		Description: "convert legacy 16-byte nonce key checks to the standard format",
+		Apply: func(_ string, cfg *config.VaultConfig, _ string) error {
+			if cfg.Encryption.AESConfig != nil {
+				cfg.Encryption.AESConfig.KeyCheck = upgradeKeyCheck(cfg.Encryption.AESConfig.KeyCheck)
+			}
+			if cfg.Encryption.ChaChaConfig != nil {
+				cfg.Encryption.ChaChaConfig.KeyCheck = upgradeKeyCheck(cfg.Encryption.ChaChaConfig.KeyCheck)
+			}
+			return nil
+		},
+	},
+	{
+		From:        2,
+		Description: "move key material out of vault.yaml into the key file",
+		Apply:       moveKeyMaterialToKeyFile,
+	},
+	{
+		From:        3,
+		Description: "name manifests and tombstones by a hash of the file's path",
+		Apply:       renameByPathHash,
+	},
+}
+
+// moveKeyMaterialToKeyFile writes key material that older vaults kept in
+// vault.yaml to the vault's key file and removes it from cfg. The key file is
+// normally already there with the same contents; if it holds a different key,
+// the one from vault.yaml is kept next to it rather than discarded. The
+// vault.yaml backup still contains the key, so it is made readable by the
+// owner only, like the key file.
+func moveKeyMaterialToKeyFile(vaultRoot string, cfg *config.VaultConfig, backupDir string) error {
+	encoded := ""
+	if cfg.Encryption.AESConfig != nil && cfg.Encryption.AESConfig.Key != "" {
+		encoded = cfg.Encryption.AESConfig.Key
+	} else if cfg.Encryption.ChaChaConfig != nil && cfg.Encryption.ChaChaConfig.Key != "" {
+		encoded = cfg.Encryption.ChaChaConfig.Key
+	}
+	if encoded == "" {
+		return nil
+	}
+
+	keyMaterial, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to decode key stored in vault.yaml: %v", err)
+	}
+
+	if cfg.Encryption.KeyPath == "" {
+		cfg.Encryption.KeyPath = filepath.Join(vaultRoot, ".sietch", "keys", "secret.key")
+	}
+	keyPath := cfg.Encryption.KeyPath
+
+	existing, err := os.ReadFile(keyPath)
+	switch {
+	case os.IsNotExist(err):
+		if err := writeSecureFile(keyPath, keyMaterial); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("failed to read key file: %v", err)
+	case !bytes.Equal(existing, keyMaterial):
+		if err := writeSecureFile(keyPath+".from-vault-yaml", keyMaterial); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Chmod(filepath.Join(backupDir, "vault.yaml"), constants.SecureFilePerms); err != nil {
+		return fmt.Errorf("failed to restrict vault.yaml backup permissions: %v", err)
+	}
+
+	cfg.Encryption = config.WithoutKeyMaterial(cfg.Encryption)
+	return nil
+}
+
+// renameByPathHash renames the manifests and tombstones of the vault to the
+// names config.ManifestFileName gives them. Older names joined the
+// destination and file name with dots, so paths such as a/b.txt and
+// a.b/txt could share a name; where that happened only the file written last
+// is left to rename. A file whose new name is taken, by a copy of the same
+// path under another old name, is moved into the backup instead.
+func renameByPathHash(vaultRoot string, _ *config.VaultConfig, backupDir string) error {
+	for _, dir := range []string{"manifests", "tombstones"} {
+		entries, err := os.ReadDir(filepath.Join(vaultRoot, ".sietch", dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", dir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+				continue
+			}
+			if err := renameToPathHash(vaultRoot, dir, entry.Name(), backupDir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renameToPathHash renames one manifest or tombstone in .sietch/dir
+func renameToPathHash(vaultRoot, dir, name, backupDir string) error {
+	rel := filepath.ToSlash(filepath.Join(".sietch", dir, name))
+	path := filepath.Join(vaultRoot, ".sietch", dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", rel, err)
+	}
+	if data, err = config.OpenMetadata(vaultRoot, data); err != nil {
+		return fmt.Errorf("failed to open %s: %w", rel, err)
+	}
+	// Manifests and tombstones record the file's path the same way
+	var file struct {
+		FilePath    string `yaml:"file"`
+		Destination string `yaml:"destination"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil || file.FilePath == "" {
+		// Listing reports files it cannot parse; they keep their name
+		return nil
+	}
+
+	newName, err := config.ManifestFileName(vaultRoot, file.Destination, file.FilePath)
+	if err != nil || newName == name {
+		return err
+	}
+	newPath := filepath.Join(filepath.Dir(path), newName)
+	if _, err := os.Stat(newPath); err == nil {
+		if err := Backup(vaultRoot, rel, backupDir); err != nil {
+			return err
+		}
+		return os.Remove(path)
+	}
+	if err := os.Rename(path, newPath); err != nil {
+		return fmt.Errorf("failed to rename %s: %v", rel, err)
+	}
+	return nil
+}
+
+// writeSecureFile writes data to path, readable by the owner only
+func writeSecureFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), constants.SecureDirPerms); err != nil {
+		return fmt.Errorf("failed to create key directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, constants.SecureFilePerms); err != nil {
+		return fmt.Errorf("failed to write key to %s: %v", path, err)
+	}
+	return nil
+}
+
+// gcmTagSize is the authentication tag appended by AES-GCM and ChaCha20-Poly1305
+const gcmTagSize = 16
+
+// upgradeKeyCheck rewrites a key check stored with a 16-byte nonce, of which
+// only the first 12 bytes were used to seal it, into the 12-byte nonce layout
+// that passphrase verification expects. Other values are returned unchanged.
+func upgradeKeyCheck(keyCheck string) string {
+	data, err := base64.StdEncoding.DecodeString(keyCheck)
+	if err != nil || len(data) != constants.LegacyNonceSize+len(constants.KeyValidationString)+gcmTagSize {
+		return keyCheck
+	}
+
+	upgraded := append([]byte{}, data[:constants.GCMNonceSize]...)
+	upgraded = append(upgraded, data[constants.LegacyNonceSize:]...)
+	return base64.StdEncoding.EncodeToString(upgraded)
+}
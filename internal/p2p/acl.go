@@ -0,0 +1,104 @@
+package p2p
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// aclTagPrefix marks an allowed_paths entry that grants files by tag instead of by path
+const aclTagPrefix = "tag:"
+
+// noAccess is the rule list of peers that may see no file: an empty tag matches none
+var noAccess = []string{aclTagPrefix}
+
+// accessRules returns the allowed_paths configured for a trusted peer, or nil
+// if the peer may see every file in the vault. Peers a vault with sync keys
+// does not trust may see nothing, whatever identity they present.
+func (s *SyncService) accessRules(peerID peer.ID) []string {
+	if s.privateKey != nil && !s.trusted(peerID) {
+		return noAccess
+	}
+	return s.peerACLs[peerID]
+}
+
+// peerAllowsFile reports whether a peer restricted to rules may see file.
+// Rules are vault path prefixes such as "docs/" or "tag:<name>" to allow every
+// file carrying that tag. An empty rule list allows everything.
+func peerAllowsFile(rules []string, file *config.FileManifest) bool {
+	if len(rules) == 0 {
+		return true
+	}
+
+	fullPath := strings.TrimPrefix(file.Destination+file.FilePath, "/")
+	for _, rule := range rules {
+		if tag, ok := strings.CutPrefix(rule, aclTagPrefix); ok {
+			if tag != "" && slices.Contains(file.Tags, tag) {
+				return true
+			}
+			continue
+		}
+
+		prefix := strings.Trim(rule, "/")
+		if prefix == "" {
+			return true
+		}
+		if fullPath == prefix || strings.HasPrefix(fullPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// filterFilesForPeer returns the files a peer restricted to rules may see
+func filterFilesForPeer(rules []string, files []config.FileManifest) []config.FileManifest {
+	if len(rules) == 0 {
+		return files
+	}
+
+	var allowed []config.FileManifest
+	for _, file := range files {
+		if peerAllowsFile(rules, &file) {
+			allowed = append(allowed, file)
+		}
+	}
+	return allowed
+}
+
+// filterTombstonesForPeer returns the tombstones of the files a peer
+// restricted to rules may see, judged by the deleted file's path and tags
+func filterTombstonesForPeer(rules []string, tombstones []config.Tombstone) []config.Tombstone {
+	if len(rules) == 0 {
+		return tombstones
+	}
+
+	var allowed []config.Tombstone
+	for _, t := range tombstones {
+		file := config.FileManifest{FilePath: t.FilePath, Destination: t.Destination, Tags: t.Tags}
+		if peerAllowsFile(rules, &file) {
+			allowed = append(allowed, t)
+		}
+	}
+	return allowed
+}
+
+// chunkSharedWithPeer reports whether the chunk stored under hash or
+// encryptedHash belongs to a file the peer restricted to rules may see
+func chunkSharedWithPeer(rules []string, files []config.FileManifest, hash, encryptedHash string) bool {
+	for _, file := range filterFilesForPeer(rules, files) {
+		for _, chunk := range file.Chunks {
+			if chunkRefMatches(chunk, hash) || chunkRefMatches(chunk, encryptedHash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// chunkRefMatches reports whether name is one of the names a chunk is stored under
+func chunkRefMatches(chunk config.ChunkRef, name string) bool {
+	return name != "" && (chunk.Hash == name || chunk.EncryptedHash == name)
+}
@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestPeerAllowsFile(t *testing.T) {
+	report := &config.FileManifest{FilePath: "report.pdf", Destination: "docs/", Tags: []string{"work"}}
+	photo := &config.FileManifest{FilePath: "beach.jpg", Destination: "photos/2024/"}
+	docsecret := &config.FileManifest{FilePath: "plan.txt", Destination: "docsecret/"}
+
+	tests := []struct {
+		name  string
+		rules []string
+		file  *config.FileManifest
+		want  bool
+	}{
+		{"no rules allow everything", nil, photo, true},
+		{"matching prefix", []string{"docs/"}, report, true},
+		{"prefix without slash", []string{"docs"}, report, true},
+		{"prefix is a whole path component", []string{"docs"}, docsecret, false},
+		{"nested prefix", []string{"/photos/2024"}, photo, true},
+		{"other prefix", []string{"docs/"}, photo, false},
+		{"matching tag", []string{"tag:work"}, report, true},
+		{"missing tag", []string{"tag:work"}, photo, false},
+		{"empty tag matches nothing", []string{"tag:"}, report, false},
+		{"any rule may match", []string{"tag:work", "photos/"}, photo, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peerAllowsFile(tt.rules, tt.file); got != tt.want {
+				t.Errorf("peerAllowsFile(%v, %s%s) = %v, want %v", tt.rules, tt.file.Destination, tt.file.FilePath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessRulesDenyUnknownPeers(t *testing.T) {
+	server, client := newPairingPeers(t)
+	clientID := client.host.ID()
+	report := &config.FileManifest{FilePath: "report.pdf", Destination: "docs/"}
+
+	if rules := server.accessRules(clientID); peerAllowsFile(rules, report) {
+		t.Errorf("expected a peer the vault does not trust to see nothing, got rules %v", rules)
+	}
+	server.trustedPeers[clientID] = &PeerInfo{ID: clientID, PublicKey: client.publicKey}
+	if rules := server.accessRules(clientID); !peerAllowsFile(rules, report) {
+		t.Errorf("expected a trusted peer without allowed_paths to see every file, got rules %v", rules)
+	}
+	server.peerACLs[clientID] = []string{"photos/"}
+	if rules := server.accessRules(clientID); peerAllowsFile(rules, report) {
+		t.Errorf("expected allowed_paths to limit a trusted peer, got rules %v", rules)
+	}
+}
+
+func TestChunkSharedWithPeer(t *testing.T) {
+	files := []config.FileManifest{
+		{FilePath: "a.txt", Destination: "docs/", Chunks: []config.ChunkRef{{Hash: "h1", EncryptedHash: "e1"}, {Hash: "shared"}}},
+		{FilePath: "b.txt", Destination: "private/", Chunks: []config.ChunkRef{{Hash: "h2", EncryptedHash: "e2"}, {Hash: "shared"}}},
+	}
+	rules := []string{"docs/"}
+
+	if got := filterFilesForPeer(rules, files); len(got) != 1 || got[0].FilePath != "a.txt" {
+		t.Fatalf("expected only docs/a.txt to be visible, got %+v", got)
+	}
+	if !chunkSharedWithPeer(rules, files, "h1", "") || !chunkSharedWithPeer(rules, files, "", "e1") {
+		t.Error("expected chunks of an allowed file to be shared by either name")
+	}
+	if !chunkSharedWithPeer(rules, files, "shared", "") {
+		t.Error("expected a chunk used by an allowed file to be shared")
+	}
+	if chunkSharedWithPeer(rules, files, "h2", "e2") {
+		t.Error("expected chunks only used by hidden files to be refused")
+	}
+	if chunkSharedWithPeer(rules, files, "", "") {
+		t.Error("expected a request without hashes to be refused")
+	}
+}
+
+func TestFilterTombstonesForPeer(t *testing.T) {
+	tombstones := []config.Tombstone{
+		{FilePath: "a.txt", Destination: "docs/"},
+		{FilePath: "b.txt", Destination: "private/", Tags: []string{"work"}},
+		{FilePath: "c.txt", Destination: "private/"},
+	}
+	got := filterTombstonesForPeer([]string{"docs/", "tag:work"}, tombstones)
+	if len(got) != 2 || got[0].FilePath != "a.txt" || got[1].FilePath != "b.txt" {
+		t.Fatalf("expected the tombstones of docs/a.txt and the tagged file, got %+v", got)
+	}
+	if got := filterTombstonesForPeer(nil, tombstones); len(got) != 3 {
+		t.Fatalf("expected every tombstone without rules, got %+v", got)
+	}
+}
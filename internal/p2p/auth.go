@@ -0,0 +1,389 @@
+package p2p
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Authentication is mutual: the requesting peer sends a challenge, the
+// serving peer signs it and answers with a challenge of its own, and the
+// requesting peer signs that in turn. Peers that completed it may fetch
+// manifests and chunks from a vault that does not trust all peers.
+//
+// Each signature covers an authPayload naming the signing and the verifying
+// peer, the session the two challenges make and the time of signing, so it
+// cannot be replayed on another stream, to another peer or later on.
+//
+// Releases before mutual authentication sign the bare challenge and do not
+// challenge back; they are still answered and understood, but only for
+// challenges of their size, so that the bare signature of a longer payload
+// can never be obtained from this vault.
+
+// authVersion is the version of the signed payloads this release uses
+const authVersion = 2
+
+// authMaxSkew is how far the time of a signature may be from the time it is
+// verified at
+const authMaxSkew = 2 * time.Minute
+
+// legacyChallengeSize is the size of the challenges older releases send
+const legacyChallengeSize = 32
+
+type authChallenge struct {
+	Challenge []byte `json:"challenge"`
+	Sender    string `json:"sender"`
+	Version   int    `json:"version,omitempty"` // Unset by releases signing bare challenges
+}
+
+type authResponse struct {
+	Signature []byte `json:"signature"`
+	VaultID   string `json:"vault_id"`
+	Name      string `json:"name"`
+	Challenge []byte `json:"challenge,omitempty"` // For the requesting peer to sign
+	Timestamp int64  `json:"timestamp,omitempty"` // Unix nanoseconds the signature was made at
+}
+
+type authProof struct {
+	Signature []byte `json:"signature"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	// The transfer key the serving peer is to encrypt to; unset by releases
+	// before transfer keys, which have data encrypted to their identity key
+	TransferKey *TransferKeyCertificate `json:"transfer_key,omitempty"`
+}
+
+type authResult struct {
+	Ticket *sessionTicket `json:"ticket,omitempty"` // For resuming the session later
+	Error  string         `json:"error,omitempty"`
+}
+
+// errNotAuthenticated rejects requests for vault data from trusted peers
+// that have not completed mutual authentication
+const errNotAuthenticated = "Unauthorized: Peer not authenticated"
+
+// Roles of the signer of an authPayload, so that neither signature can be
+// passed off as the other
+const (
+	authRoleServer = "server"
+	authRoleClient = "client"
+)
+
+// authSession identifies one authentication exchange by both its challenges
+func authSession(clientChallenge, serverChallenge []byte) []byte {
+	h := sha256.New()
+	h.Write(clientChallenge)
+	h.Write(serverChallenge)
+	return h.Sum(nil)
+}
+
+// authPayload is what a peer signs to answer challenge
+func authPayload(role string, signer, verifier peer.ID, session []byte, timestamp int64, challenge []byte) []byte {
+	return []byte(strings.Join([]string{
+		"sietch auth v" + strconv.Itoa(authVersion),
+		role,
+		signer.String(),
+		verifier.String(),
+		hex.EncodeToString(session),
+		strconv.FormatInt(timestamp, 10),
+		hex.EncodeToString(challenge),
+	}, "\n"))
+}
+
+// handleAuthentication handles authentication requests from peers
+func (s *SyncService) handleAuthentication(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+
+	// Read challenge with timeout
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	dec := json.NewDecoder(stream)
+	var challenge authChallenge
+	if err := dec.Decode(&challenge); err != nil {
+		fmt.Printf("Error reading authentication challenge: %v\n", err)
+		return
+	}
+	enc := json.NewEncoder(stream)
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	response := authResponse{VaultID: s.vaultConfig.VaultID, Name: s.vaultConfig.Name}
+
+	if challenge.Version < authVersion {
+		// An older peer, which verifies a signature of the bare challenge
+		if len(challenge.Challenge) != legacyChallengeSize {
+			fmt.Printf("Rejecting authentication challenge of %d bytes from peer %s\n", len(challenge.Challenge), peerID.String())
+			return
+		}
+		signature, err := signChallenge(s.privateKey, challenge.Challenge)
+		if err != nil {
+			fmt.Printf("Error signing challenge: %v\n", err)
+			return
+		}
+		response.Signature = signature
+		if err := enc.Encode(response); err != nil {
+			fmt.Printf("Error sending authentication response: %v\n", err)
+		}
+		return
+	}
+
+	ours := make([]byte, 32)
+	if _, err := rand.Read(ours); err != nil {
+		fmt.Printf("Error generating challenge: %v\n", err)
+		return
+	}
+	session := authSession(challenge.Challenge, ours)
+	response.Challenge = ours
+	response.Timestamp = time.Now().UnixNano()
+	payload := authPayload(authRoleServer, s.host.ID(), peerID, session, response.Timestamp, challenge.Challenge)
+	signature, err := signChallenge(s.privateKey, payload)
+	if err != nil {
+		fmt.Printf("Error signing challenge: %v\n", err)
+		return
+	}
+	response.Signature = signature
+	if err := enc.Encode(response); err != nil {
+		fmt.Printf("Error sending authentication response: %v\n", err)
+		return
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	var proof authProof
+	if err := dec.Decode(&proof); err != nil {
+		if s.Verbose {
+			fmt.Printf("Peer %s did not answer our authentication challenge: %v\n", peerID.String(), err)
+		}
+		return
+	}
+
+	result := authResult{}
+	publicKey, err := s.peerPublicKey(stream.Conn())
+	if err == nil {
+		payload := authPayload(authRoleClient, peerID, s.host.ID(), session, proof.Timestamp, ours)
+		err = s.verifyAuthSignature(publicKey, payload, proof.Timestamp, proof.Signature)
+	}
+	var transfer *peerTransferKey
+	if err == nil && proof.TransferKey != nil {
+		transfer, err = verifyPeerTransferKey(publicKey, proof.TransferKey)
+	}
+	if err != nil {
+		fmt.Printf("Rejecting authentication of peer %s: %v\n", peerID.String(), err)
+		result.Error = "authentication failed"
+	} else {
+		result.Ticket = s.issueSessionTicket(peerID, publicKey, transfer)
+	}
+	s.setAuthenticated(peerID, err == nil)
+	s.setPeerTransferKey(peerID, transfer)
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	if err := enc.Encode(result); err != nil {
+		fmt.Printf("Error sending authentication result: %v\n", err)
+	}
+}
+
+// authenticatePeer verifies the identity of a peer with a challenge and
+// answers the peer's challenge to prove ours
+func (s *SyncService) authenticatePeer(ctx context.Context, peerID peer.ID) error {
+	// Create a context with timeout
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Handshake)
+	defer cancel()
+
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(AuthProtocol))
+	if err != nil {
+		return fmt.Errorf("failed to open authentication stream: %w", err)
+	}
+	defer stream.Close()
+
+	// Generate random challenge
+	challenge := make([]byte, 32)
+	_, err = rand.Read(challenge)
+	if err != nil {
+		return fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	// Send challenge with timeout
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	enc := json.NewEncoder(stream)
+	request := authChallenge{Challenge: challenge, Sender: s.vaultConfig.VaultID, Version: authVersion}
+	if err := enc.Encode(request); err != nil {
+		return fmt.Errorf("failed to send challenge: %w", err)
+	}
+
+	// Read response with timeout
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	dec := json.NewDecoder(stream)
+	var response authResponse
+	if err := dec.Decode(&response); err != nil {
+		return fmt.Errorf("failed to read auth response: %w", err)
+	}
+
+	// Get peer's public key
+	peerInfo, ok := s.peerKey(peerID)
+	if !ok {
+		return fmt.Errorf("no key known for peer")
+	}
+
+	// A peer running an older release signs the bare challenge and does
+	// not challenge us back
+	if len(response.Challenge) == 0 {
+		if err := verifyChallenge(peerInfo.PublicKey, challenge, response.Signature); err != nil {
+			return err
+		}
+		if s.Verbose {
+			fmt.Printf("Peer %s does not support mutual authentication\n", peerID.String())
+		}
+		peerInfo.Name = response.Name
+		s.setPresentedTransferKey(peerID, "")
+		return nil
+	}
+
+	session := authSession(challenge, response.Challenge)
+	payload := authPayload(authRoleServer, peerID, s.host.ID(), session, response.Timestamp, challenge)
+	if err := s.verifyAuthSignature(peerInfo.PublicKey, payload, response.Timestamp, response.Signature); err != nil {
+		return err
+	}
+
+	// Update peer info with vault details
+	peerInfo.Name = response.Name
+
+	proof := authProof{Timestamp: time.Now().UnixNano()}
+	presented := ""
+	if transfer := s.transferKey(); transfer != nil {
+		proof.TransferKey = &transfer.Certificate
+		presented = transfer.Certificate.Fingerprint()
+	}
+	payload = authPayload(authRoleClient, s.host.ID(), peerID, session, proof.Timestamp, response.Challenge)
+	if proof.Signature, err = signChallenge(s.privateKey, payload); err != nil {
+		return fmt.Errorf("failed to sign challenge: %w", err)
+	}
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	if err := enc.Encode(proof); err != nil {
+		return fmt.Errorf("failed to answer challenge: %w", err)
+	}
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	var result authResult
+	if err := dec.Decode(&result); err != nil {
+		return fmt.Errorf("failed to read auth result: %w", err)
+	}
+	if result.Error != "" {
+		return fmt.Errorf("peer rejected our authentication: %s", result.Error)
+	}
+	s.setPresentedTransferKey(peerID, presented)
+	s.acceptSessionTicket(peerID, result.Ticket)
+	return nil
+}
+
+// peerPublicKey returns the key the peer on conn must sign with: the one
+// learned in the key exchange or from the trusted peers, or else the RSA key
+// of its libp2p identity
+func (s *SyncService) peerPublicKey(conn network.Conn) (*rsa.PublicKey, error) {
+	if info, ok := s.peerKey(conn.RemotePeer()); ok && info.PublicKey != nil {
+		return info.PublicKey, nil
+	}
+	remote := conn.RemotePublicKey()
+	if remote == nil {
+		return nil, fmt.Errorf("public key of the peer is unknown")
+	}
+	std, err := libp2pcrypto.PubKeyToStdKey(remote)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := std.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("peer identity is not an RSA key")
+	}
+	return key, nil
+}
+
+// verifyAuthSignature checks a signature of payload made at timestamp,
+// rejecting it if it is stale or was accepted before
+func (s *SyncService) verifyAuthSignature(key *rsa.PublicKey, payload []byte, timestamp int64, signature []byte) error {
+	if err := checkAuthTime(timestamp, time.Now()); err != nil {
+		return err
+	}
+	if err := verifyChallenge(key, payload, signature); err != nil {
+		return err
+	}
+	return s.rememberAuth(signature)
+}
+
+// checkAuthTime rejects a signature made at timestamp that is too far from now
+func checkAuthTime(timestamp int64, now time.Time) error {
+	signed := time.Unix(0, timestamp)
+	if timestamp == 0 || signed.Before(now.Add(-authMaxSkew)) || signed.After(now.Add(authMaxSkew)) {
+		return fmt.Errorf("stale authentication signature from %s", signed.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// rememberAuth records an accepted signature or session proof, rejecting it
+// if it was accepted before
+func (s *SyncService) rememberAuth(signature []byte) error {
+	// A signature is only valid within the skew window, so only those
+	// seen within it need to be remembered
+	now := time.Now()
+	digest := sha256.Sum256(signature)
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if _, seen := s.authSeen[digest]; seen {
+		return fmt.Errorf("replayed authentication signature")
+	}
+	if s.authSeen == nil {
+		s.authSeen = make(map[[sha256.Size]byte]time.Time)
+	}
+	for d, at := range s.authSeen {
+		if now.Sub(at) > 2*authMaxSkew {
+			delete(s.authSeen, d)
+		}
+	}
+	s.authSeen[digest] = now
+	return nil
+}
+
+// setAuthenticated records whether peerID completed mutual authentication;
+// a failed attempt revokes an earlier success
+func (s *SyncService) setAuthenticated(peerID peer.ID, ok bool) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if !ok {
+		delete(s.authenticated, peerID)
+		return
+	}
+	if s.authenticated == nil {
+		s.authenticated = make(map[peer.ID]bool)
+	}
+	s.authenticated[peerID] = true
+}
+
+// peerAuthenticated reports whether peerID proved it holds its key
+func (s *SyncService) peerAuthenticated(peerID peer.ID) bool {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	return s.authenticated[peerID]
+}
+
+func signChallenge(key *rsa.PrivateKey, challenge []byte) ([]byte, error) {
+	if len(challenge) == 0 {
+		return nil, fmt.Errorf("empty challenge")
+	}
+	hash := sha256.Sum256(challenge)
+	return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+}
+
+func verifyChallenge(key *rsa.PublicKey, challenge, signature []byte) error {
+	hash := sha256.Sum256(challenge)
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestMutualAuthentication(t *testing.T) {
+	server, client := newPairingPeers(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+	if err := client.host.Connect(ctx, peer.AddrInfo{ID: serverID, Addrs: server.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A vault that only serves trusted peers, which trusts the client
+	server.trustAllPeers = false
+	server.trustedPeers[clientID] = &PeerInfo{ID: clientID, PublicKey: client.publicKey}
+
+	if _, err := client.getRemoteManifest(ctx, serverID); err == nil || !strings.Contains(err.Error(), "not authenticated") {
+		t.Fatalf("expected manifests to be refused before authentication, got %v", err)
+	}
+	if trusted, err := client.VerifyAndExchangeKeys(ctx, serverID); err != nil || !trusted {
+		t.Fatalf("VerifyAndExchangeKeys = %v, %v", trusted, err)
+	}
+	if !server.peerAuthenticated(clientID) {
+		t.Fatal("expected the server to have authenticated the client")
+	}
+	if _, err := client.getRemoteManifest(ctx, serverID); err != nil {
+		t.Fatalf("expected manifests after authentication, got %v", err)
+	}
+
+	// A client that cannot sign for the key the server knows is rejected
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.trustedPeers[clientID].PublicKey = &other.PublicKey
+	if err := client.authenticatePeer(ctx, serverID); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("expected the server to reject the client, got %v", err)
+	}
+	if server.peerAuthenticated(clientID) {
+		t.Error("a failed authentication must revoke the earlier one")
+	}
+}
+
+func TestUnknownPeerIsRefused(t *testing.T) {
+	server, stranger := newPairingPeers(t)
+	ctx := context.Background()
+	serverID, strangerID := server.host.ID(), stranger.host.ID()
+	if err := stranger.host.Connect(ctx, peer.AddrInfo{ID: serverID, Addrs: server.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exchanging keys and proving it holds its own does not make a peer trusted
+	if _, err := stranger.VerifyAndExchangeKeys(ctx, serverID); err != nil {
+		t.Fatalf("VerifyAndExchangeKeys failed: %v", err)
+	}
+	if !server.peerAuthenticated(strangerID) || server.trusted(strangerID) {
+		t.Fatal("expected the stranger to be authenticated but not trusted")
+	}
+	if _, err := stranger.getRemoteManifest(ctx, serverID); err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("expected the manifest to be refused, got %v", err)
+	}
+	if _, _, err := stranger.fetchChunk(ctx, serverID, hashA, ""); err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("expected the chunk to be refused, got %v", err)
+	}
+}
+
+func TestVerifyAuthSignatureRejectsStaleAndReplayed(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SyncService{}
+	signer, verifier := peer.ID("signer"), peer.ID("verifier")
+	session := authSession([]byte("client"), []byte("server"))
+	sign := func(payload []byte) []byte {
+		sig, err := signChallenge(key, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	now := time.Now().UnixNano()
+	payload := authPayload(authRoleClient, signer, verifier, session, now, []byte("challenge"))
+	sig := sign(payload)
+	if err := s.verifyAuthSignature(&key.PublicKey, payload, now, sig); err != nil {
+		t.Fatalf("expected a fresh signature to verify, got %v", err)
+	}
+	if err := s.verifyAuthSignature(&key.PublicKey, payload, now, sig); err == nil || !strings.Contains(err.Error(), "replayed") {
+		t.Errorf("expected a second use of the signature to be rejected, got %v", err)
+	}
+
+	old := time.Now().Add(-2 * authMaxSkew).UnixNano()
+	stale := authPayload(authRoleClient, signer, verifier, session, old, []byte("challenge"))
+	if err := s.verifyAuthSignature(&key.PublicKey, stale, old, sign(stale)); err == nil || !strings.Contains(err.Error(), "stale") {
+		t.Errorf("expected an old signature to be rejected, got %v", err)
+	}
+
+	// A signature is bound to its role, peers and session
+	for name, other := range map[string][]byte{
+		"role":     authPayload(authRoleServer, signer, verifier, session, now, []byte("challenge")),
+		"verifier": authPayload(authRoleClient, signer, peer.ID("other"), session, now, []byte("challenge")),
+		"session":  authPayload(authRoleClient, signer, verifier, authSession([]byte("a"), []byte("b")), now, []byte("challenge")),
+	} {
+		if err := s.verifyAuthSignature(&key.PublicKey, other, now, sign(payload)); err == nil {
+			t.Errorf("expected a signature to be rejected for another %s", name)
+		}
+	}
+}
+
+func TestAuthenticationRejectsReplayedProof(t *testing.T) {
+	server, client := newPairingPeers(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+	if err := client.host.Connect(ctx, peer.AddrInfo{ID: serverID, Addrs: server.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// exchange runs one authentication as the client would, answering with
+	// proof when given instead of signing the server's challenge
+	exchange := func(proof *authProof) (authProof, authResult) {
+		t.Helper()
+		stream, err := client.host.NewStream(ctx, serverID, protocol.ID(AuthProtocol))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		challenge := make([]byte, 32)
+		_, _ = rand.Read(challenge)
+		enc, dec := json.NewEncoder(stream), json.NewDecoder(stream)
+		if err := enc.Encode(authChallenge{Challenge: challenge, Version: authVersion}); err != nil {
+			t.Fatal(err)
+		}
+		var response authResponse
+		if err := dec.Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if proof == nil {
+			p := authProof{Timestamp: time.Now().UnixNano()}
+			payload := authPayload(authRoleClient, clientID, serverID, authSession(challenge, response.Challenge), p.Timestamp, response.Challenge)
+			if p.Signature, err = signChallenge(client.privateKey, payload); err != nil {
+				t.Fatal(err)
+			}
+			proof = &p
+		}
+		if err := enc.Encode(proof); err != nil {
+			t.Fatal(err)
+		}
+		var result authResult
+		if err := dec.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		return *proof, result
+	}
+
+	proof, result := exchange(nil)
+	if result.Error != "" || !server.peerAuthenticated(clientID) {
+		t.Fatalf("expected the genuine proof to be accepted, got %+v", result)
+	}
+	if _, result := exchange(&proof); result.Error == "" {
+		t.Error("expected a proof from an earlier session to be rejected")
+	}
+	if server.peerAuthenticated(clientID) {
+		t.Error("a replayed proof must revoke the authentication")
+	}
+
+	// Bare signatures are only given for challenges of the size older
+	// releases send, never for a payload of this release
+	stream, err := client.host.NewStream(ctx, serverID, protocol.ID(AuthProtocol))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	payload := authPayload(authRoleClient, clientID, serverID, nil, time.Now().UnixNano(), []byte("x"))
+	if err := json.NewEncoder(stream).Encode(authChallenge{Challenge: payload}); err != nil {
+		t.Fatal(err)
+	}
+	_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var response authResponse
+	if err := json.NewDecoder(stream).Decode(&response); err == nil {
+		t.Errorf("expected no signature of a long legacy challenge, got %+v", response)
+	}
+}
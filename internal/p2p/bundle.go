@@ -0,0 +1,607 @@
+package p2p
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// BundleVersion is the format version of have-lists and bundles
+const BundleVersion = 1
+
+// A bundle is a tar archive carrying a sync to a vault that cannot be
+// reached over the network, such as on a USB stick. Its first entry is
+// bundleHeaderName holding a BundleHeader in JSON; every other entry is a
+// stored chunk under bundleChunkDir, named as in the header. A sealed bundle,
+// written with a BundleKey, holds the header encrypted under the vault key in
+// bundleSealedName instead, so whoever carries it learns nothing of the
+// files in it: their chunks are already encrypted.
+const (
+	bundleHeaderName = "bundle.json"
+	bundleSealedName = "bundle.sealed"
+	bundleChunkDir   = "chunks/"
+)
+
+// maxBundleHeaderSize bounds the header read from a bundle
+const maxBundleHeaderSize = 1 << 28
+
+// HaveList records the files and chunks a vault holds, so that another vault
+// can build a bundle of only what it lacks without being connected to it
+type HaveList struct {
+	Version    int       `json:"version"`
+	VaultID    string    `json:"vault_id"`
+	VaultName  string    `json:"vault_name,omitempty"`
+	PeerID     string    `json:"peer_id,omitempty"` // Sync identity of the vault, when sync is configured
+	Encryption string    `json:"encryption"`
+	KeyHash    string    `json:"key_hash,omitempty"`
+	Created    time.Time `json:"created"`
+	Files      []string  `json:"files"`  // Files held, as recorded in their manifests
+	Chunks     []string  `json:"chunks"` // Chunks held under either of their names, sorted
+}
+
+// BundleHeader describes the contents of a bundle
+type BundleHeader struct {
+	Version    int       `json:"version"`
+	VaultID    string    `json:"vault_id"`
+	VaultName  string    `json:"vault_name,omitempty"`
+	Encryption string    `json:"encryption"`
+	KeyHash    string    `json:"key_hash,omitempty"`
+	For        string    `json:"for,omitempty"` // Vault ID of the have-list the bundle was built from
+	Created    time.Time `json:"created"`
+	// Since is set on a bundle that follows an earlier one for the same
+	// vault: older manifest changes and deletions were in earlier bundles
+	Since time.Time `json:"since,omitzero"`
+	// Manifest holds the files the bundle adds and the deletions it carries
+	Manifest config.Manifest `json:"manifest"`
+	Chunks   []BundleChunk   `json:"chunks"`
+
+	cursor string // Cursor recorded for the next bundle once this one is written
+}
+
+// BundleChunk is a chunk stored in a bundle
+type BundleChunk struct {
+	Name   string `json:"name"` // Name the chunk is stored under
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"` // Hash of the stored bytes, set when the bundle is written
+}
+
+// Bytes returns the total size of the chunks in the bundle
+func (h *BundleHeader) Bytes() int64 {
+	var total int64
+	for _, c := range h.Chunks {
+		total += c.Size
+	}
+	return total
+}
+
+// HaveList returns what this vault holds, for another vault to build a bundle from
+func (s *SyncService) HaveList() (*HaveList, error) {
+	cfg, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vault config: %v", err)
+	}
+	m, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+
+	have := &HaveList{
+		Version:    BundleVersion,
+		VaultID:    cfg.VaultID,
+		VaultName:  cfg.Name,
+		Encryption: cfg.Encryption.Type,
+		KeyHash:    cfg.Encryption.KeyHash,
+		Created:    time.Now().UTC(),
+		Files:      []string{},
+		Chunks:     localHaveSet(m),
+	}
+	for _, file := range m.Files {
+		have.Files = append(have.Files, file.FilePath)
+	}
+	slices.Sort(have.Files)
+	return have, nil
+}
+
+// Write encodes the have-list as JSON
+func (h *HaveList) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
+
+// ReadHaveList decodes a have-list written by HaveList.Write
+func ReadHaveList(r io.Reader) (*HaveList, error) {
+	var have HaveList
+	if err := json.NewDecoder(r).Decode(&have); err != nil {
+		return nil, fmt.Errorf("failed to read have-list: %w", err)
+	}
+	if have.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported have-list version %d", have.Version)
+	}
+	if have.VaultID == "" {
+		return nil, fmt.Errorf("have-list does not name its vault")
+	}
+	slices.Sort(have.Files)
+	have.Chunks = newHaveSet(have.Chunks)
+	return &have, nil
+}
+
+// BundleContents works out what a bundle for the vault described by have
+// holds: the files it lacks that a peer restricted to rules may see, the
+// chunks of those files it does not hold, and this vault's deletions. A nil
+// have-list builds a bundle of everything, for a vault starting empty.
+//
+// cursor is the one recorded by RecordBundleExport for the last bundle sent
+// to the same vault. When it is usable, only manifests and deletions recorded
+// since it are considered; an empty cursor, FullSync or a change of rules
+// considers all of them.
+func (s *SyncService) BundleContents(have *HaveList, cursor string, rules []string) (*BundleHeader, error) {
+	cfg, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vault config: %v", err)
+	}
+
+	// Take the cursor before listing, so a manifest written during the
+	// listing is bundled again next time
+	now := time.Now()
+	entries, err := s.vaultMgr.GetManifestEntries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+	tombstones, err := s.vaultMgr.Tombstones()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deletions: %v", err)
+	}
+
+	header := &BundleHeader{
+		Version:    BundleVersion,
+		VaultID:    cfg.VaultID,
+		VaultName:  cfg.Name,
+		Encryption: cfg.Encryption.Type,
+		KeyHash:    cfg.Encryption.KeyHash,
+		Created:    now.UTC(),
+		Manifest:   config.Manifest{Files: []config.FileManifest{}},
+		Chunks:     []BundleChunk{},
+		cursor:     issueCursor(now, rules),
+	}
+
+	var heldFiles []string
+	var heldChunks haveSet
+	if have != nil {
+		if have.VaultID == cfg.VaultID {
+			return nil, fmt.Errorf("the have-list is from this vault")
+		}
+		target := &config.VaultConfig{Encryption: config.EncryptionConfig{Type: have.Encryption, KeyHash: have.KeyHash}}
+		if err := checkLocalCompatible(cfg, target); err != nil {
+			return nil, err
+		}
+		header.For = have.VaultID
+		heldFiles, heldChunks = have.Files, have.Chunks
+	}
+
+	since, incremental := parseCursor(cursor, rules)
+	incremental = incremental && have != nil && !s.FullSync
+	if incremental {
+		header.Since = since.UTC()
+	}
+	changedSince := func(t time.Time) bool {
+		return !incremental || !t.Before(since.Add(-cursorSlack))
+	}
+
+	for _, t := range filterTombstonesForPeer(rules, tombstones) {
+		if changedSince(t.RecordedAt) {
+			header.Manifest.Tombstones = append(header.Manifest.Tombstones, t)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		file := entry.Manifest
+		if !changedSince(entry.ChangedAt) || !peerAllowsFile(rules, &file) {
+			continue
+		}
+		if _, held := slices.BinarySearch(heldFiles, file.FilePath); held {
+			continue
+		}
+		header.Manifest.Files = append(header.Manifest.Files, file)
+
+		for _, chunk := range file.Chunks {
+			if heldChunks.contains(chunk.Hash) || heldChunks.contains(chunk.EncryptedHash) {
+				continue
+			}
+			name, size, ok := s.storedChunk(chunk)
+			if !ok || seen[name] {
+				continue
+			}
+			seen[name] = true
+			header.Chunks = append(header.Chunks, BundleChunk{Name: name, Size: size})
+		}
+	}
+	return header, nil
+}
+
+// BundleExport is what this vault has bundled for another vault, so the
+// next bundle for it only holds what changed since
+type BundleExport struct {
+	// Have is the vault's have-list with every file and chunk bundled for it
+	// since added, as it will be once it applies those bundles
+	Have    HaveList  `json:"have"`
+	Cursor  string    `json:"cursor"`
+	Updated time.Time `json:"updated"`
+}
+
+// bundleExportsDir is where the exports to each vault are kept, one file per vault ID
+func bundleExportsDir(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync", "exports")
+}
+
+// LoadBundleExport returns what was last bundled for the vault with the
+// given name or ID
+func (s *SyncService) LoadBundleExport(nameOrID string) (*BundleExport, error) {
+	dir := bundleExportsDir(s.vaultMgr.VaultRoot())
+	names, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read bundle exports: %v", err)
+	}
+
+	var found *BundleExport
+	for _, entry := range names {
+		if filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle export: %v", err)
+		}
+		var export BundleExport
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, fmt.Errorf("failed to read bundle export %s: %v", entry.Name(), err)
+		}
+		if export.Have.VaultID == nameOrID {
+			found = &export
+			break
+		}
+		if export.Have.VaultName == nameOrID {
+			if found != nil {
+				return nil, fmt.Errorf("bundles were created for several vaults named %s; use its vault ID", nameOrID)
+			}
+			found = &export
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no bundle has been created for %s; give its have-list instead", nameOrID)
+	}
+	slices.Sort(found.Have.Files)
+	found.Have.Chunks = newHaveSet(found.Have.Chunks)
+	return found, nil
+}
+
+// RecordBundleExport notes that the bundle described by header was written
+// for the vault described by have, so the next bundle for it starts from
+// header's cursor and leaves out what this one carries
+func (s *SyncService) RecordBundleExport(have *HaveList, header *BundleHeader) error {
+	if have == nil || !validChunkName(have.VaultID) {
+		return fmt.Errorf("cannot record a bundle for vault %q", header.For)
+	}
+
+	next := *have
+	next.Files = slices.Clone(have.Files)
+	next.Chunks = slices.Clone(have.Chunks)
+	for _, file := range header.Manifest.Files {
+		next.Files = append(next.Files, file.FilePath)
+	}
+	bundled := make(map[string]bool, len(header.Chunks))
+	for _, c := range header.Chunks {
+		bundled[c.Name] = true
+	}
+	// Record the chunks of the bundled files under both their names, except
+	// those this vault could not bundle
+	held := newHaveSet(have.Chunks)
+	for _, file := range header.Manifest.Files {
+		for _, chunk := range file.Chunks {
+			names := []string{chunk.Hash, chunk.EncryptedHash}
+			if slices.ContainsFunc(names, func(n string) bool { return bundled[n] || held.contains(n) }) {
+				next.Chunks = append(next.Chunks, names...)
+			}
+		}
+	}
+	slices.Sort(next.Files)
+	next.Files = slices.Compact(next.Files)
+	next.Chunks = newHaveSet(next.Chunks)
+
+	data, err := json.MarshalIndent(BundleExport{Have: next, Cursor: header.cursor, Updated: header.Created}, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := bundleExportsDir(s.vaultMgr.VaultRoot())
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	p := filepath.Join(dir, have.VaultID+".json")
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// storedChunk returns the name and size of the file a chunk is stored in
+func (s *SyncService) storedChunk(chunk config.ChunkRef) (string, int64, bool) {
+	for _, name := range []string{chunk.Hash, chunk.EncryptedHash} {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(s.chunkPath(name)); err == nil && info.Mode().IsRegular() {
+			return name, info.Size(), true
+		}
+	}
+	return "", 0, false
+}
+
+func (s *SyncService) chunkPath(name string) string {
+	return fs.LocateChunk(s.vaultMgr.VaultRoot(), name)
+}
+
+// WriteBundle writes a bundle with the contents described by header to w,
+// filling in the hashes of its chunks
+func (s *SyncService) WriteBundle(w io.Writer, header *BundleHeader) error {
+	// The header comes first so the receiving vault can check it before
+	// reading any chunks, which means hashing the chunks before writing them
+	for i := range header.Chunks {
+		sum, size, err := hashFile(s.chunkPath(header.Chunks[i].Name))
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %s: %v", header.Chunks[i].Name, err)
+		}
+		header.Chunks[i].SHA256, header.Chunks[i].Size = sum, size
+	}
+
+	tw := tar.NewWriter(w)
+	data, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle header: %v", err)
+	}
+	name := bundleHeaderName
+	if s.BundleKey != nil {
+		if data, err = config.SealWithKey(s.BundleKey, data); err != nil {
+			return fmt.Errorf("failed to seal bundle header: %v", err)
+		}
+		name = bundleSealedName
+	}
+	if err := writeBundleEntry(tw, name, header.Created, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	for _, c := range header.Chunks {
+		f, err := os.Open(s.chunkPath(c.Name))
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %s: %v", c.Name, err)
+		}
+		err = writeBundleEntry(tw, bundleChunkDir+c.Name, header.Created, c.Size, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeBundleEntry(tw *tar.Writer, name string, modTime time.Time, size int64, r io.Reader) error {
+	hdr := &tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s to bundle: %v", name, err)
+	}
+	if _, err := io.CopyN(tw, r, size); err != nil {
+		return fmt.Errorf("failed to write %s to bundle: %v", name, err)
+	}
+	return nil
+}
+
+func hashFile(p string) (string, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// PlanBundle reads the header of a bundle and reports what ApplyBundle would
+// copy from it without writing anything
+func (s *SyncService) PlanBundle(r io.Reader) (*BundleHeader, *SyncPlan, error) {
+	header, _, err := s.openBundle(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	localManifest, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+	return header, s.planManifestDiff(localManifest, &header.Manifest), nil
+}
+
+// ApplyBundle copies the files, chunks and deletions of a bundle into this
+// vault. Chunks whose contents do not match the header are skipped along
+// with the files that use them, as chunks a peer fails to send are. source
+// names the bundle in the audit log.
+func (s *SyncService) ApplyBundle(r io.Reader, source string) (*BundleHeader, *SyncResult, error) {
+	startTime := time.Now()
+
+	header, tr, err := s.openBundle(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	localManifest, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+
+	// A tar archive can only be read in order, so chunks are unpacked next to
+	// the chunk store before the manifest diff asks for them
+	tmpDir, err := os.MkdirTemp(filepath.Join(s.vaultMgr.VaultRoot(), ".sietch"), "bundle-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := extractBundleChunks(tr, header, tmpDir); err != nil {
+		return nil, nil, err
+	}
+
+	fetch := func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		for _, name := range []string{chunkHash, encryptedHash} {
+			if name == "" || !validChunkName(name) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(tmpDir, name))
+			if err == nil {
+				return data, len(data), nil
+			}
+			if !os.IsNotExist(err) {
+				return nil, 0, err
+			}
+		}
+		return nil, 0, fmt.Errorf("chunk not in bundle")
+	}
+
+	result, err := s.applyManifestDiff(localManifest, &header.Manifest, fetch, fromSource("bundle", source, header.VaultName))
+	if err != nil {
+		return nil, nil, err
+	}
+	result.Duration = time.Since(startTime)
+	s.recordSync("bundle", source, result, nil)
+	return header, result, nil
+}
+
+// openBundle reads the header of a bundle and checks that its chunks can be
+// used by this vault, returning the archive positioned at the first chunk
+func (s *SyncService) openBundle(r io.Reader) (*BundleHeader, *tar.Reader, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a sietch bundle: %v", err)
+	}
+	if hdr.Name != bundleHeaderName && hdr.Name != bundleSealedName {
+		return nil, nil, fmt.Errorf("not a sietch bundle: first entry is %q", hdr.Name)
+	}
+	if hdr.Size > maxBundleHeaderSize {
+		return nil, nil, fmt.Errorf("bundle header of %d bytes exceeds the limit", hdr.Size)
+	}
+	data, err := io.ReadAll(io.LimitReader(tr, maxBundleHeaderSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle header: %v", err)
+	}
+	if hdr.Name == bundleSealedName {
+		if s.BundleKey == nil {
+			return nil, nil, fmt.Errorf("the bundle is sealed and the vault key is needed to open it")
+		}
+		if data, err = config.OpenWithKey(s.BundleKey, data); err != nil {
+			return nil, nil, fmt.Errorf("failed to open sealed bundle, it was not sealed for this vault's key: %v", err)
+		}
+	}
+
+	var header BundleHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle header: %v", err)
+	}
+	if header.Version != BundleVersion {
+		return nil, nil, fmt.Errorf("unsupported bundle version %d", header.Version)
+	}
+
+	cfg, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load vault config: %v", err)
+	}
+	if header.VaultID == cfg.VaultID {
+		return nil, nil, fmt.Errorf("the bundle was created by this vault")
+	}
+	sender := &config.VaultConfig{Encryption: config.EncryptionConfig{Type: header.Encryption, KeyHash: header.KeyHash}}
+	if err := checkLocalCompatible(cfg, sender); err != nil {
+		return nil, nil, err
+	}
+	return &header, tr, nil
+}
+
+// extractBundleChunks unpacks the chunk entries of a bundle into dir,
+// keeping only those whose size and hash match the header
+func extractBundleChunks(tr *tar.Reader, header *BundleHeader, dir string) error {
+	expected := make(map[string]BundleChunk, len(header.Chunks))
+	for _, c := range header.Chunks {
+		expected[c.Name] = c
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %v", err)
+		}
+
+		name, ok := cutChunkEntry(hdr.Name)
+		want, listed := expected[name]
+		if !ok || !listed || hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected entry %q in bundle", hdr.Name)
+		}
+		delete(expected, name)
+		if hdr.Size != want.Size {
+			fmt.Printf("Warning: skipping chunk %s: size %d does not match the bundle header\n", name, hdr.Size)
+			continue
+		}
+
+		if err := extractChunk(tr, filepath.Join(dir, name), want); err != nil {
+			fmt.Printf("Warning: skipping chunk %s: %v\n", name, err)
+		}
+	}
+}
+
+// extractChunk writes one chunk entry to p, removing it again if its hash
+// does not match
+func extractChunk(r io.Reader, p string, want BundleChunk) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(h.Sum(nil)) != want.SHA256 {
+		err = fmt.Errorf("contents do not match the bundle header")
+	}
+	if err != nil {
+		os.Remove(p)
+	}
+	return err
+}
+
+// cutChunkEntry returns the chunk name of a bundle entry under bundleChunkDir
+func cutChunkEntry(entry string) (string, bool) {
+	dir, name := path.Split(entry)
+	return name, dir == bundleChunkDir && validChunkName(name)
+}
+
+// validChunkName reports whether name can be used as a file name in a
+// directory of chunks
+func validChunkName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name && !filepath.IsAbs(name)
+}
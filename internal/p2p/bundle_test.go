@@ -0,0 +1,241 @@
+package p2p
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+)
+
+// newBundleTestVault creates a test vault with its own vault ID
+func newBundleTestVault(t *testing.T, id, fileName, chunkHash, chunkData string) *config.Manager {
+	t.Helper()
+	mgr := newTestVault(t, fileName, chunkHash, chunkData)
+	cfg, err := config.LoadVaultConfig(mgr.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.VaultID = id
+	if err := config.SaveVaultConfig(mgr.VaultRoot(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	mgr, err = config.NewManager(mgr.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mgr
+}
+
+// buildBundle writes a bundle from sender for the vault receiver describes
+func buildBundle(t *testing.T, sender, receiver *config.Manager, rules []string) []byte {
+	t.Helper()
+	var haveBuf bytes.Buffer
+	have, err := NewLocalSyncService(receiver).HaveList()
+	if err != nil {
+		t.Fatalf("HaveList failed: %v", err)
+	}
+	if err := have.Write(&haveBuf); err != nil {
+		t.Fatal(err)
+	}
+	if have, err = ReadHaveList(&haveBuf); err != nil {
+		t.Fatalf("ReadHaveList failed: %v", err)
+	}
+
+	s := NewLocalSyncService(sender)
+	header, err := s.BundleContents(have, "", rules)
+	if err != nil {
+		t.Fatalf("BundleContents failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := s.WriteBundle(&out, header); err != nil {
+		t.Fatalf("WriteBundle failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	sender := newBundleTestVault(t, "sender", "a.txt", hashA, "alpha")
+	receiver := newBundleTestVault(t, "receiver", "b.txt", hashB, "bravo")
+	bundle := buildBundle(t, sender, receiver, nil)
+
+	s := NewLocalSyncService(receiver)
+	header, plan, err := s.PlanBundle(bytes.NewReader(bundle))
+	if err != nil {
+		t.Fatalf("PlanBundle failed: %v", err)
+	}
+	if header.VaultID != "sender" || header.For != "receiver" {
+		t.Errorf("unexpected header %+v", header)
+	}
+	if len(plan.Files) != 1 || plan.Files[0] != "docs/a.txt" || plan.ChunksToTransfer != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	_, result, err := s.ApplyBundle(bytes.NewReader(bundle), "test.sietchbundle")
+	if err != nil {
+		t.Fatalf("ApplyBundle failed: %v", err)
+	}
+	if result.FileCount != 1 || result.ChunksTransferred != 1 || result.BytesTransferred != 5 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	data, err := receiver.GetChunk(hashA)
+	if err != nil || string(data) != "alpha" {
+		t.Errorf("expected chunk hash-a to be copied, got %q (%v)", data, err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(receiver.VaultRoot(), ".sietch"))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "bundle-") {
+			t.Errorf("temporary directory %s left behind", e.Name())
+		}
+	}
+
+	// The receiver now holds everything, so a new bundle is empty
+	again := buildBundle(t, sender, receiver, nil)
+	header, _, err = s.PlanBundle(bytes.NewReader(again))
+	if err != nil || len(header.Manifest.Files) != 0 || len(header.Chunks) != 0 {
+		t.Errorf("expected an empty bundle, got %+v (%v)", header, err)
+	}
+}
+
+func TestIncrementalBundle(t *testing.T) {
+	sender := newBundleTestVault(t, "sender", "a.txt", hashA, "alpha")
+	receiver := newBundleTestVault(t, "receiver", "b.txt", hashB, "bravo")
+	s := NewLocalSyncService(sender)
+
+	if _, err := s.LoadBundleExport("receiver"); err == nil {
+		t.Fatal("expected no export before the first bundle")
+	}
+	have, err := NewLocalSyncService(receiver).HaveList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := s.BundleContents(have, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteBundle(io.Discard, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordBundleExport(have, first); err != nil {
+		t.Fatalf("RecordBundleExport failed: %v", err)
+	}
+
+	// A file added after the first bundle is all the next one carries
+	if err := os.WriteFile(filepath.Join(sender.VaultRoot(), ".sietch", "chunks", hashC), []byte("charlie"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := &config.FileManifest{FilePath: "c.txt", Destination: "docs/", Size: 7, Chunks: []config.ChunkRef{{Hash: hashC, Size: 7}}}
+	if err := manifest.StoreFileManifest(sender.VaultRoot(), "c.txt", m); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := s.LoadBundleExport("test")
+	if err != nil {
+		t.Fatalf("LoadBundleExport by name failed: %v", err)
+	}
+	if export.Have.VaultID != "receiver" || export.Cursor == "" {
+		t.Fatalf("unexpected export %+v", export)
+	}
+	next, err := s.BundleContents(&export.Have, export.Cursor, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Since.IsZero() {
+		t.Error("expected the next bundle to be incremental")
+	}
+	if len(next.Manifest.Files) != 1 || next.Manifest.Files[0].FilePath != "c.txt" ||
+		len(next.Chunks) != 1 || next.Chunks[0].Name != hashC {
+		t.Errorf("expected only c.txt and its chunk, got %+v", next)
+	}
+
+	// Changed access rules invalidate the cursor
+	restricted, err := s.BundleContents(&export.Have, export.Cursor, []string{"docs/"})
+	if err != nil || !restricted.Since.IsZero() {
+		t.Errorf("expected a full listing after the rules changed, got %+v (%v)", restricted, err)
+	}
+}
+
+func TestBundleContentsHonoursAccessRules(t *testing.T) {
+	sender := newBundleTestVault(t, "sender", "a.txt", hashA, "alpha")
+	receiver := newBundleTestVault(t, "receiver", "b.txt", hashB, "bravo")
+
+	have, err := NewLocalSyncService(receiver).HaveList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := NewLocalSyncService(sender).BundleContents(have, "", []string{"photos/"})
+	if err != nil {
+		t.Fatalf("BundleContents failed: %v", err)
+	}
+	if len(header.Manifest.Files) != 0 || len(header.Chunks) != 0 {
+		t.Errorf("expected files outside the allowed paths to be left out, got %+v", header)
+	}
+
+	if _, err := NewLocalSyncService(sender).BundleContents(&HaveList{VaultID: "sender"}, "", nil); err == nil {
+		t.Error("expected a bundle for the vault itself to be refused")
+	}
+}
+
+func TestApplyBundleSkipsCorruptChunks(t *testing.T) {
+	sender := newBundleTestVault(t, "sender", "a.txt", hashA, "alpha")
+	receiver := newBundleTestVault(t, "receiver", "b.txt", hashB, "bravo")
+	bundle := buildBundle(t, sender, receiver, nil)
+
+	// Flip the chunk's contents without changing its size
+	corrupt := bytes.Replace(bundle, []byte("alpha"), []byte("alphA"), 1)
+	_, result, err := NewLocalSyncService(receiver).ApplyBundle(bytes.NewReader(corrupt), "corrupt")
+	if err != nil {
+		t.Fatalf("ApplyBundle failed: %v", err)
+	}
+	if len(result.FailedChunks) != 1 || len(result.IncompleteFiles) != 1 || result.FileCount != 0 {
+		t.Errorf("expected the corrupt chunk and its file to be skipped, got %+v", result)
+	}
+	if exists, _ := receiver.ChunkExists(hashA); exists {
+		t.Error("corrupt chunk must not be stored")
+	}
+}
+
+func TestApplyBundleRejectsBadArchives(t *testing.T) {
+	receiver := newBundleTestVault(t, "receiver", "b.txt", hashB, "bravo")
+	s := NewLocalSyncService(receiver)
+
+	if _, _, err := s.ApplyBundle(strings.NewReader("not a tar file"), "junk"); err == nil {
+		t.Error("expected a non-bundle to be rejected")
+	}
+
+	// A bundle from this very vault
+	own := buildBundle(t, receiver, newBundleTestVault(t, "other", "c.txt", hashC, "charlie"), nil)
+	if _, _, err := s.ApplyBundle(bytes.NewReader(own), "own"); err == nil {
+		t.Error("expected a bundle created by this vault to be rejected")
+	}
+
+	// An entry escaping the chunks directory
+	sender := newBundleTestVault(t, "sender", "a.txt", hashA, "alpha")
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	header, err := NewLocalSyncService(sender).BundleContents(nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headerBuf bytes.Buffer
+	if err := NewLocalSyncService(sender).WriteBundle(&headerBuf, header); err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(&headerBuf)
+	hdr, _ := tr.Next()
+	headerData, _ := io.ReadAll(tr)
+	_ = tw.WriteHeader(hdr)
+	_, _ = tw.Write(headerData)
+	_ = tw.WriteHeader(&tar.Header{Name: "chunks/../../evil", Mode: 0o600, Size: 5, Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte("alpha"))
+	_ = tw.Close()
+
+	if _, _, err := s.ApplyBundle(&buf, "evil"); err == nil {
+		t.Error("expected an entry outside the chunks directory to be rejected")
+	}
+}
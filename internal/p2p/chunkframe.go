@@ -0,0 +1,259 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Chunk requests and responses are exchanged in one of two encodings. Peers
+// speaking ChunkProtocolID use binary frames that carry chunk data as raw
+// bytes; ChunkProtocolIDv1 peers use JSON, which base64-encodes the data and
+// grows every transfer by a third.
+//
+// A binary request is the chunk hash and encrypted hash, each prefixed with
+// its length as a uvarint, followed by one flags byte. A binary response starts
+// with a status byte. An error response follows with the length-prefixed error
+// message; a chunk response follows with a flags byte, the chunk's size before
+// transport encryption as a uvarint, and the length-prefixed chunk data.
+// The chunkFlagZstd bit of the request flags asks for transport compression;
+// the same bit in the response flags says it was applied. The
+// chunkFlagTransferKey bit of the response flags says the data is encrypted
+// to the requester's transfer key rather than its identity key.
+
+const (
+	chunkStatusOK    byte = 0
+	chunkStatusError byte = 1
+
+	chunkFlagEncrypted byte = 1 << 0
+	// chunkFlagZstd asks for a zstd-compressed chunk in a request, and marks
+	// the chunk data as compressed in a response
+	chunkFlagZstd byte = 1 << 1
+	// chunkFlagTransferKey marks chunk data encrypted to the transfer key
+	// the requester presented when it authenticated
+	chunkFlagTransferKey byte = 1 << 2
+
+	// maxChunkFrameSize bounds the chunk data a peer may send, so a corrupt
+	// or hostile length prefix cannot make the reader allocate without limit
+	maxChunkFrameSize = 256 << 20
+	// maxChunkFrameString bounds hashes and error messages
+	maxChunkFrameString = 4096
+)
+
+// chunkRequest asks a peer for one chunk
+type chunkRequest struct {
+	Hash          string `json:"hash"`
+	EncryptedHash string `json:"encrypted_hash,omitempty"`
+	IsEncrypted   bool   `json:"is_encrypted"`
+	// Transport compression the requester can decode; "" for none
+	AcceptCompression string `json:"accept_compression,omitempty"`
+}
+
+// chunkResponse carries a chunk, or the reason it could not be sent
+type chunkResponse struct {
+	Error     string `json:"error,omitempty"`
+	Size      int    `json:"size,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+	Encrypted bool   `json:"encrypted"`
+	// Data is encrypted to the requester's transfer key, not its identity key
+	TransferKey bool `json:"transfer_key,omitempty"`
+	// Transport compression applied to Data before encryption; "" for none
+	Compression string `json:"compression,omitempty"`
+}
+
+// chunkCodec encodes chunk requests and responses for one protocol version
+type chunkCodec interface {
+	writeRequest(w io.Writer, req chunkRequest) error
+	readRequest(r io.Reader) (chunkRequest, error)
+	writeResponse(w io.Writer, resp chunkResponse) error
+	readResponse(r io.Reader) (chunkResponse, error)
+}
+
+// chunkCodecFor returns the codec of the negotiated chunk protocol
+func chunkCodecFor(id protocol.ID) chunkCodec {
+	if id == protocol.ID(ChunkProtocolIDv1) {
+		return jsonChunkCodec{}
+	}
+	return binaryChunkCodec{}
+}
+
+// jsonChunkCodec is the encoding of ChunkProtocolIDv1
+type jsonChunkCodec struct{}
+
+func (jsonChunkCodec) writeRequest(w io.Writer, req chunkRequest) error {
+	return json.NewEncoder(w).Encode(req)
+}
+
+func (jsonChunkCodec) readRequest(r io.Reader) (chunkRequest, error) {
+	var req chunkRequest
+	err := json.NewDecoder(r).Decode(&req)
+	return req, err
+}
+
+func (jsonChunkCodec) writeResponse(w io.Writer, resp chunkResponse) error {
+	return json.NewEncoder(w).Encode(resp)
+}
+
+func (jsonChunkCodec) readResponse(r io.Reader) (chunkResponse, error) {
+	var resp chunkResponse
+	err := json.NewDecoder(r).Decode(&resp)
+	return resp, err
+}
+
+// binaryChunkCodec is the length-prefixed framing of ChunkProtocolID
+type binaryChunkCodec struct{}
+
+func (binaryChunkCodec) writeRequest(w io.Writer, req chunkRequest) error {
+	var flags byte
+	if req.IsEncrypted {
+		flags |= chunkFlagEncrypted
+	}
+	if req.AcceptCompression == constants.CompressionTypeZstd {
+		flags |= chunkFlagZstd
+	}
+	buf := binary.AppendUvarint(nil, uint64(len(req.Hash)))
+	buf = append(buf, req.Hash...)
+	buf = binary.AppendUvarint(buf, uint64(len(req.EncryptedHash)))
+	buf = append(buf, req.EncryptedHash...)
+	buf = append(buf, flags)
+	_, err := w.Write(buf)
+	return err
+}
+
+func (binaryChunkCodec) readRequest(r io.Reader) (chunkRequest, error) {
+	br := bufio.NewReader(r)
+	var req chunkRequest
+	var err error
+	if req.Hash, err = readFrameString(br); err != nil {
+		return req, fmt.Errorf("failed to read hash: %w", err)
+	}
+	if req.EncryptedHash, err = readFrameString(br); err != nil {
+		return req, fmt.Errorf("failed to read encrypted hash: %w", err)
+	}
+	flags, err := br.ReadByte()
+	if err != nil {
+		return req, fmt.Errorf("failed to read flags: %w", err)
+	}
+	req.IsEncrypted = flags&chunkFlagEncrypted != 0
+	if flags&chunkFlagZstd != 0 {
+		req.AcceptCompression = constants.CompressionTypeZstd
+	}
+	return req, nil
+}
+
+func (binaryChunkCodec) writeResponse(w io.Writer, resp chunkResponse) error {
+	bw := bufio.NewWriter(w)
+	if resp.Error != "" {
+		header := append([]byte{chunkStatusError}, binary.AppendUvarint(nil, uint64(len(resp.Error)))...)
+		if _, err := bw.Write(append(header, resp.Error...)); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+
+	if len(resp.Data) > maxChunkFrameSize {
+		return fmt.Errorf("chunk of %d bytes exceeds the %d byte frame limit", len(resp.Data), maxChunkFrameSize)
+	}
+	var flags byte
+	if resp.Encrypted {
+		flags |= chunkFlagEncrypted
+	}
+	if resp.TransferKey {
+		flags |= chunkFlagTransferKey
+	}
+	switch resp.Compression {
+	case "":
+	case constants.CompressionTypeZstd:
+		flags |= chunkFlagZstd
+	default:
+		return fmt.Errorf("compression %q cannot be sent in a binary chunk frame", resp.Compression)
+	}
+	header := []byte{chunkStatusOK, flags}
+	header = binary.AppendUvarint(header, uint64(resp.Size))
+	header = binary.AppendUvarint(header, uint64(len(resp.Data)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	if _, err := bw.Write(resp.Data); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func (binaryChunkCodec) readResponse(r io.Reader) (chunkResponse, error) {
+	br := bufio.NewReader(r)
+	var resp chunkResponse
+
+	status, err := br.ReadByte()
+	if err != nil {
+		return resp, fmt.Errorf("failed to read status: %w", err)
+	}
+	switch status {
+	case chunkStatusError:
+		if resp.Error, err = readFrameString(br); err != nil {
+			return resp, fmt.Errorf("failed to read error: %w", err)
+		}
+		if resp.Error == "" {
+			resp.Error = "unknown error"
+		}
+		return resp, nil
+	case chunkStatusOK:
+	default:
+		return resp, fmt.Errorf("unknown response status %d", status)
+	}
+
+	flags, err := br.ReadByte()
+	if err != nil {
+		return resp, fmt.Errorf("failed to read flags: %w", err)
+	}
+	resp.Encrypted = flags&chunkFlagEncrypted != 0
+	resp.TransferKey = flags&chunkFlagTransferKey != 0
+	if flags&chunkFlagZstd != 0 {
+		resp.Compression = constants.CompressionTypeZstd
+	}
+
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return resp, fmt.Errorf("failed to read chunk size: %w", err)
+	}
+	if size > maxChunkFrameSize {
+		return resp, fmt.Errorf("chunk size %d exceeds the %d byte frame limit", size, maxChunkFrameSize)
+	}
+	resp.Size = int(size)
+
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return resp, fmt.Errorf("failed to read data length: %w", err)
+	}
+	if length > maxChunkFrameSize {
+		return resp, fmt.Errorf("chunk data of %d bytes exceeds the %d byte frame limit", length, maxChunkFrameSize)
+	}
+	resp.Data = make([]byte, length)
+	if _, err := io.ReadFull(br, resp.Data); err != nil {
+		return resp, fmt.Errorf("failed to read chunk data: %w", err)
+	}
+	return resp, nil
+}
+
+// readFrameString reads a uvarint length-prefixed string
+func readFrameString(br *bufio.Reader) (string, error) {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", err
+	}
+	if length > maxChunkFrameString {
+		return "", errors.New("string exceeds frame limit")
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
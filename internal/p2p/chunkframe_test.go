@@ -0,0 +1,140 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestChunkCodecsRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte{0, 1, 2, 0xff}, 4096)
+	requests := []chunkRequest{
+		{Hash: "abc123"},
+		{Hash: "abc123", EncryptedHash: "def456", IsEncrypted: true},
+		{Hash: "abc123", AcceptCompression: "zstd"},
+	}
+	responses := []chunkResponse{
+		{Size: len(data), Data: data, Encrypted: true},
+		{Size: len(data) * 2, Data: data, Compression: "zstd"},
+		{Size: 0, Data: []byte{}},
+		{Error: "Chunk not found"},
+	}
+
+	for _, id := range []string{ChunkProtocolID, ChunkProtocolIDv1} {
+		codec := chunkCodecFor(protocol.ID(id))
+		for _, want := range requests {
+			var buf bytes.Buffer
+			if err := codec.writeRequest(&buf, want); err != nil {
+				t.Fatalf("%s: writeRequest: %v", id, err)
+			}
+			got, err := codec.readRequest(&buf)
+			if err != nil || got != want {
+				t.Errorf("%s: request round trip = %+v (%v), want %+v", id, got, err, want)
+			}
+		}
+		for _, want := range responses {
+			var buf bytes.Buffer
+			if err := codec.writeResponse(&buf, want); err != nil {
+				t.Fatalf("%s: writeResponse: %v", id, err)
+			}
+			got, err := codec.readResponse(&buf)
+			if err != nil {
+				t.Fatalf("%s: readResponse: %v", id, err)
+			}
+			if len(want.Data) == 0 {
+				got.Data, want.Data = nil, nil
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: response round trip = %+v, want %+v", id, got, want)
+			}
+		}
+	}
+}
+
+func TestBinaryChunkFrameIsCompact(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1<<20)
+	resp := chunkResponse{Size: len(data), Data: data}
+
+	var binaryBuf, jsonBuf bytes.Buffer
+	if err := (binaryChunkCodec{}).writeResponse(&binaryBuf, resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := (jsonChunkCodec{}).writeResponse(&jsonBuf, resp); err != nil {
+		t.Fatal(err)
+	}
+	if overhead := binaryBuf.Len() - len(data); overhead > 16 {
+		t.Errorf("binary frame adds %d bytes to a 1MB chunk", overhead)
+	}
+	if jsonBuf.Len() < len(data)*4/3 {
+		t.Errorf("expected JSON to base64-encode the chunk, got %d bytes", jsonBuf.Len())
+	}
+}
+
+func TestBinaryChunkFrameRejectsOversizedData(t *testing.T) {
+	frame := []byte{chunkStatusOK, 0}
+	frame = binary.AppendUvarint(frame, 10)
+	frame = binary.AppendUvarint(frame, maxChunkFrameSize+1)
+
+	_, err := (binaryChunkCodec{}).readResponse(bytes.NewReader(frame))
+	if err == nil || !strings.Contains(err.Error(), "frame limit") {
+		t.Errorf("expected frame limit error, got %v", err)
+	}
+
+	_, err = (binaryChunkCodec{}).readResponse(bytes.NewReader([]byte{7}))
+	if err == nil || !strings.Contains(err.Error(), "unknown response status") {
+		t.Errorf("expected unknown status error, got %v", err)
+	}
+}
+
+func TestFetchChunkNegotiatesProtocol(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		remove []string // Protocols the serving peer does not support
+	}{
+		{"binary framing", nil},
+		{"older peer falls back to JSON", []string{ChunkProtocolID}},
+		{"peer without hello uses JSON", []string{ChunkProtocolID, HelloProtocolID}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, serverID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"), tt.remove...)
+
+			data, size, err := client.fetchChunk(context.Background(), serverID, hashA, "")
+			if err != nil || string(data) != "alpha" || size != 5 {
+				t.Fatalf("fetchChunk = %q, %d, %v", data, size, err)
+			}
+			if _, _, err := client.fetchChunk(context.Background(), serverID, "missing", ""); err == nil || !strings.Contains(err.Error(), "Chunk not found") {
+				t.Fatalf("expected remote error for a missing chunk, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChunkRequestRejectsTraversal(t *testing.T) {
+	server := newTestVault(t, "a.txt", hashA, "alpha")
+	keys := filepath.Join(server.VaultRoot(), ".sietch", "keys")
+	if err := os.MkdirAll(keys, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keys, "secret.key"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, serverID := newPeerPair(t, server)
+
+	for _, names := range [][2]string{
+		{"../keys/secret.key", ""},
+		{"../../vault.yaml", ""},
+		{hashA, "../keys/secret.key"},
+	} {
+		data, _, err := client.fetchChunk(context.Background(), serverID, names[0], names[1])
+		if err == nil || !strings.Contains(err.Error(), "Invalid chunk hash") {
+			t.Errorf("fetchChunk(%q, %q) = %q, %v, want an invalid chunk hash error", names[0], names[1], data, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// handleConfigRequest serves the vault configuration to trusted peers so they
+// can clone the vault. Key material and sync identity are never included.
+func (s *SyncService) handleConfigRequest(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+
+	var response struct {
+		Config *config.VaultConfig `json:"config,omitempty"`
+		Error  string              `json:"error,omitempty"`
+	}
+
+	if s.privateKey != nil {
+		if !s.trusted(peerID) {
+			fmt.Printf("Rejecting config request from untrusted peer: %s\n", peerID.String())
+			response.Error = "Unauthorized: Peer not trusted"
+			_ = json.NewEncoder(stream).Encode(response)
+			return
+		}
+	}
+
+	vaultConfig, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		fmt.Printf("Error getting vault config: %v\n", err)
+		response.Error = "Internal error getting vault config"
+		_ = json.NewEncoder(stream).Encode(response)
+		return
+	}
+	response.Config = ShareableConfig(vaultConfig)
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+	if err := json.NewEncoder(stream).Encode(response); err != nil {
+		fmt.Printf("Error sending vault config: %v\n", err)
+	}
+}
+
+// GetRemoteConfig fetches the shareable vault configuration of a remote peer
+func (s *SyncService) GetRemoteConfig(ctx context.Context, peerID peer.ID) (*config.VaultConfig, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Manifest)
+	defer cancel()
+
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(ConfigProtocolID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config stream: %w", err)
+	}
+	defer stream.Close()
+	defer resetOnCancel(timeoutCtx, stream)()
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
+	var response struct {
+		Config *config.VaultConfig `json:"config,omitempty"`
+		Error  string              `json:"error,omitempty"`
+	}
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode vault config: %w", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("remote error: %s", response.Error)
+	}
+	if response.Config == nil {
+		return nil, fmt.Errorf("remote sent no vault config")
+	}
+	return response.Config, nil
+}
+
+// ShareableConfig returns a copy of cfg that is safe to send to another vault:
+// encryption keys, key file locations, the sync identity and trusted peers are
+// removed, while the settings needed to read the vault's chunks are kept
+func ShareableConfig(cfg *config.VaultConfig) *config.VaultConfig {
+	shared := *cfg
+
+	shared.Encryption.KeyPath = ""
+	shared.Encryption.KeyFilePath = ""
+	shared.Encryption.KeyBackupPath = ""
+	if cfg.Encryption.AESConfig != nil {
+		aes := *cfg.Encryption.AESConfig
+		aes.Key = ""
+		shared.Encryption.AESConfig = &aes
+	}
+	if cfg.Encryption.ChaChaConfig != nil {
+		chacha := *cfg.Encryption.ChaChaConfig
+		chacha.Key = ""
+		shared.Encryption.ChaChaConfig = &chacha
+	}
+	if cfg.Encryption.GPGConfig != nil {
+		gpg := *cfg.Encryption.GPGConfig
+		gpg.PrivateKey = ""
+		shared.Encryption.GPGConfig = &gpg
+	}
+
+	shared.Sync.RSA = nil
+	shared.Sync.KnownPeers = nil
+	shared.Sync.NetworkKey = ""
+	shared.Sync.ListenAddrs = nil
+	shared.Metadata.Tags = append([]string(nil), cfg.Metadata.Tags...)
+	return &shared
+}
@@ -0,0 +1,44 @@
+package p2p
+
+import (
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// TestShareableConfig ensures key material and sync identity are stripped
+// without modifying the vault's own configuration
+func TestShareableConfig(t *testing.T) {
+	cfg := &config.VaultConfig{Name: "dune", VaultID: "id-1"}
+	cfg.Encryption.Type = "aes"
+	cfg.Encryption.KeyPath = "/vault/.sietch/keys/secret.key"
+	cfg.Encryption.AESConfig = &config.AESConfig{Key: "secret", Mode: "gcm", KeyCheck: "check"}
+	cfg.Encryption.ChaChaConfig = &config.ChaChaConfig{Key: "secret"}
+	cfg.Encryption.GPGConfig = &config.GPGConfig{KeyID: "ABC", PrivateKey: "/home/me/private.asc"}
+	cfg.Sync.RSA = &config.RSAConfig{PrivateKeyPath: ".sietch/sync/sync_private.pem"}
+	cfg.Sync.KnownPeers = []string{"peer"}
+	cfg.Sync.NetworkKey = ".sietch/sync/swarm.key"
+	cfg.Sync.ListenAddrs = []string{"/ip4/192.168.1.5/tcp/4001"}
+
+	shared := ShareableConfig(cfg)
+
+	if shared.Name != "dune" || shared.VaultID != "id-1" || shared.Encryption.Type != "aes" {
+		t.Errorf("vault identity and settings must be kept, got %+v", shared)
+	}
+	if shared.Encryption.AESConfig.Key != "" || shared.Encryption.ChaChaConfig.Key != "" || shared.Encryption.GPGConfig.PrivateKey != "" {
+		t.Error("expected key material to be removed")
+	}
+	if shared.Encryption.AESConfig.Mode != "gcm" || shared.Encryption.AESConfig.KeyCheck != "check" || shared.Encryption.GPGConfig.KeyID != "ABC" {
+		t.Error("expected encryption parameters to be kept")
+	}
+	if shared.Encryption.KeyPath != "" || shared.Sync.RSA != nil || shared.Sync.KnownPeers != nil {
+		t.Error("expected key paths and sync identity to be removed")
+	}
+	if shared.Sync.NetworkKey != "" || shared.Sync.ListenAddrs != nil {
+		t.Error("expected node-specific network settings to be removed")
+	}
+
+	if cfg.Encryption.AESConfig.Key != "secret" || cfg.Sync.RSA == nil || cfg.Encryption.KeyPath == "" {
+		t.Error("ShareableConfig must not modify its argument")
+	}
+}
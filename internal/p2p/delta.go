@@ -0,0 +1,252 @@
+package p2p
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// ManifestDeltaProtocolID serves only the file manifests that changed since a
+// sync cursor. The cursor is an opaque string issued by the serving peer with
+// every response; the requesting peer stores it and sends it back on its next
+// sync. A missing or unusable cursor gets the full manifest. A request may
+// ask for the response to be compressed with one of the serving peer's
+// transport compression algorithms.
+const ManifestDeltaProtocolID = "/sietch/manifest-delta/1.0.0"
+
+// cursorSlack widens the window of a delta request so that manifests written
+// within the serving peer's file timestamp resolution of the cursor are sent
+// again rather than missed. Resending a file the peer has is harmless.
+const cursorSlack = 2 * time.Second
+
+type manifestDeltaRequest struct {
+	Since string `json:"since,omitempty"`
+	// Transport compression to send the response with; "" for none
+	Compression string `json:"compression,omitempty"`
+}
+
+type manifestDeltaResponse struct {
+	Files      []*config.FileManifest `json:"files,omitempty"`
+	Tombstones []config.Tombstone     `json:"tombstones,omitempty"`
+	Cursor     string                 `json:"cursor,omitempty"`
+	Full       bool                   `json:"full"` // Files is the whole manifest rather than a delta
+	Error      string                 `json:"error,omitempty"`
+}
+
+// issueCursor returns the cursor for a listing taken at now. It records the
+// peer's access rules as well, since a change to them changes which files the
+// peer may see and requires a full listing.
+func issueCursor(now time.Time, rules []string) string {
+	return strconv.FormatInt(now.UnixNano(), 10) + "-" + rulesDigest(rules)
+}
+
+// parseCursor returns the time of a cursor issued for rules, or false if the
+// cursor is malformed or the rules have changed since
+func parseCursor(cursor string, rules []string) (time.Time, bool) {
+	nanos, digest, ok := strings.Cut(cursor, "-")
+	if !ok || digest != rulesDigest(rules) {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
+
+func rulesDigest(rules []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(rules, "\n")))
+	return hex.EncodeToString(sum[:4])
+}
+
+// handleManifestDeltaRequest sends the manifests changed since the request's cursor
+func (s *SyncService) handleManifestDeltaRequest(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
+	var request manifestDeltaRequest
+	if err := json.NewDecoder(stream).Decode(&request); err != nil {
+		fmt.Printf("Error decoding manifest delta request: %v\n", err)
+		return
+	}
+
+	compression := request.Compression
+	if !slices.Contains(transportCompression, compression) {
+		compression = ""
+	}
+	send := func(resp manifestDeltaResponse) {
+		_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+		w, err := compressedStreamWriter(stream, compression)
+		if err == nil {
+			if err = json.NewEncoder(w).Encode(resp); err == nil {
+				err = w.Close()
+			}
+		}
+		if err != nil {
+			fmt.Printf("Error sending manifest delta: %v\n", err)
+		}
+	}
+
+	if s.privateKey != nil {
+		if !s.trusted(peerID) {
+			fmt.Printf("Rejecting manifest request from untrusted peer: %s\n", peerID.String())
+			send(manifestDeltaResponse{Error: "Unauthorized: Peer not trusted"})
+			return
+		}
+		if !s.peerAuthenticated(peerID) {
+			fmt.Printf("Rejecting manifest request from unauthenticated peer: %s\n", peerID.String())
+			send(manifestDeltaResponse{Error: errNotAuthenticated})
+			return
+		}
+	}
+
+	// Take the cursor before listing, so a manifest written during the
+	// listing is sent again next time
+	rules := s.accessRules(peerID)
+	now := time.Now()
+	entries, err := s.vaultMgr.GetManifestEntries()
+	if err != nil {
+		fmt.Printf("Error getting manifest: %v\n", err)
+		send(manifestDeltaResponse{Error: "Internal error getting manifest"})
+		return
+	}
+
+	since, ok := parseCursor(request.Since, rules)
+	response := manifestDeltaResponse{Cursor: issueCursor(now, rules), Full: !ok, Files: []*config.FileManifest{}}
+	for _, entry := range entries {
+		if ok && entry.ChangedAt.Before(since.Add(-cursorSlack)) {
+			continue
+		}
+		if peerAllowsFile(rules, &entry.Manifest) {
+			response.Files = append(response.Files, &entry.Manifest)
+		}
+	}
+
+	tombstones, err := s.vaultMgr.Tombstones()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	for _, t := range filterTombstonesForPeer(rules, tombstones) {
+		if !ok || !t.RecordedAt.Before(since.Add(-cursorSlack)) {
+			response.Tombstones = append(response.Tombstones, t)
+		}
+	}
+	send(response)
+}
+
+// getRemoteManifestSince fetches the manifests the peer changed since cursor,
+// returning them with the cursor for the next sync. Peers without delta
+// support, or an empty cursor, give the full manifest and full is true.
+func (s *SyncService) getRemoteManifestSince(ctx context.Context, peerID peer.ID, cursor string) (m *config.Manifest, next string, full bool, err error) {
+	caps, err := s.PeerCapabilities(ctx, peerID)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !caps.Supports(ManifestDeltaProtocolID) {
+		m, err := s.getRemoteManifest(ctx, peerID)
+		return m, "", true, err
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Manifest)
+	defer cancel()
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(ManifestDeltaProtocolID))
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to open manifest stream: %w", err)
+	}
+	defer stream.Close()
+	defer resetOnCancel(timeoutCtx, stream)()
+
+	request := manifestDeltaRequest{Since: cursor, Compression: s.transportCompressionFor(ctx, peerID)}
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+	if err := json.NewEncoder(stream).Encode(request); err != nil {
+		return nil, "", false, fmt.Errorf("failed to send manifest request: %w", err)
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
+	r, closeReader, err := compressedStreamReader(stream, request.Compression)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer closeReader()
+	var response manifestDeltaResponse
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, "", false, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if response.Error != "" {
+		return nil, "", false, fmt.Errorf("remote error: %s", response.Error)
+	}
+
+	m = &config.Manifest{Files: make([]config.FileManifest, 0, len(response.Files)), Tombstones: response.Tombstones}
+	for _, file := range response.Files {
+		if file != nil {
+			m.Files = append(m.Files, *file)
+		}
+	}
+	return m, response.Cursor, response.Full, nil
+}
+
+// syncCursorsPath is where the cursors issued by each peer are kept
+func syncCursorsPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync", "cursors.json")
+}
+
+// loadSyncCursor returns the cursor peerID issued at the last complete sync,
+// or "" if there is none
+func (s *SyncService) loadSyncCursor(peerID peer.ID) string {
+	data, err := os.ReadFile(syncCursorsPath(s.vaultMgr.VaultRoot()))
+	if err != nil {
+		return ""
+	}
+	var cursors map[string]string
+	if json.Unmarshal(data, &cursors) != nil {
+		return ""
+	}
+	return cursors[peerID.String()]
+}
+
+// cursorFor returns the cursor to send peerID, or "" for a full sync
+func (s *SyncService) cursorFor(peerID peer.ID) string {
+	if s.FullSync {
+		return ""
+	}
+	return s.loadSyncCursor(peerID)
+}
+
+// saveSyncCursor records the cursor peerID issued for the next sync
+func (s *SyncService) saveSyncCursor(peerID peer.ID, cursor string) error {
+	path := syncCursorsPath(s.vaultMgr.VaultRoot())
+	cursors := make(map[string]string)
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &cursors)
+	}
+	cursors[peerID.String()] = cursor
+
+	data, err := json.MarshalIndent(cursors, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
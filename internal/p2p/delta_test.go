@@ -0,0 +1,78 @@
+package p2p
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestParseCursor(t *testing.T) {
+	now := time.Unix(1700000000, 123)
+	cursor := issueCursor(now, nil)
+	if got, ok := parseCursor(cursor, nil); !ok || !got.Equal(now) {
+		t.Errorf("parseCursor(%q) = %v, %v", cursor, got, ok)
+	}
+	if _, ok := parseCursor(cursor, []string{"docs/"}); ok {
+		t.Error("a cursor issued under other access rules must not be accepted")
+	}
+	for _, bad := range []string{"", "garbage", "x-" + rulesDigest(nil)} {
+		if _, ok := parseCursor(bad, nil); ok {
+			t.Errorf("expected cursor %q to be rejected", bad)
+		}
+	}
+}
+
+func TestGetRemoteManifestSince(t *testing.T) {
+	server := newTestVault(t, "a.txt", hashA, "alpha")
+	client, serverID := newPeerPair(t, server)
+
+	// Date the existing manifest back so it is outside the cursor slack
+	old := time.Now().Add(-time.Hour)
+	manifests := filepath.Join(server.VaultRoot(), ".sietch", "manifests")
+	entries, err := os.ReadDir(manifests)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one manifest, got %v (%v)", entries, err)
+	}
+	if err := os.Chtimes(filepath.Join(manifests, entries[0].Name()), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	m, cursor, full, err := client.getRemoteManifestSince(context.Background(), serverID, "")
+	if err != nil || !full || len(m.Files) != 1 || cursor == "" {
+		t.Fatalf("expected the full manifest and a cursor, got %+v, %q, %v (%v)", m, cursor, full, err)
+	}
+
+	m, _, full, err = client.getRemoteManifestSince(context.Background(), serverID, cursor)
+	if err != nil || full || len(m.Files) != 0 {
+		t.Fatalf("expected no changes since the cursor, got %+v, %v (%v)", m, full, err)
+	}
+
+	addTestFile(t, server, "b.txt", hashB, "bravo")
+	m, _, _, err = client.getRemoteManifestSince(context.Background(), serverID, cursor)
+	if err != nil || len(m.Files) != 1 || m.Files[0].FilePath != "b.txt" {
+		t.Fatalf("expected only b.txt to have changed, got %+v (%v)", m, err)
+	}
+}
+
+func TestSyncCursorStore(t *testing.T) {
+	s := NewLocalSyncService(newTestVault(t, "a.txt", hashA, "alpha"))
+	serverID := peer.ID("server")
+
+	if got := s.loadSyncCursor(serverID); got != "" {
+		t.Errorf("expected no cursor before the first sync, got %q", got)
+	}
+	if err := s.saveSyncCursor(serverID, "42-abc"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.cursorFor(serverID); got != "42-abc" {
+		t.Errorf("cursorFor = %q, want 42-abc", got)
+	}
+	s.FullSync = true
+	if got := s.cursorFor(serverID); got != "" {
+		t.Errorf("a full sync must not send a cursor, got %q", got)
+	}
+}
@@ -0,0 +1,263 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// HaveProtocolID exchanges have-lists before chunks are fetched. The dialing
+// peer sends the chunk hashes it already holds; the other side answers with
+// the chunks it holds and would offer that are not in that list, so the diff
+// is computed where the chunks are and chunks the peer manifest references
+// but does not hold are never requested.
+//
+// A have-list is a uvarint count followed by the hashes in sorted order. Each
+// hash is prefixed with a uvarint of its length shifted left by one; the low
+// bit is set when the hash is lowercase hex and sent as the bytes it encodes,
+// which halves the size of a list of SHA-256 hashes. A response starts with a
+// status byte as in the binary chunk framing.
+const HaveProtocolID = "/sietch/have/1.0.0"
+
+// maxHaveSetSize bounds the entries a peer may send in a have-list
+const maxHaveSetSize = 1 << 24
+
+// haveSet is a sorted set of chunk hashes
+type haveSet []string
+
+// newHaveSet returns the set of the given hashes, ignoring empty ones
+func newHaveSet(hashes []string) haveSet {
+	set := make(haveSet, 0, len(hashes))
+	for _, h := range hashes {
+		if h != "" {
+			set = append(set, h)
+		}
+	}
+	slices.Sort(set)
+	return slices.Compact(set)
+}
+
+// localHaveSet returns the chunks referenced by m under either of their names
+func localHaveSet(m *config.Manifest) haveSet {
+	var hashes []string
+	for _, file := range m.Files {
+		for _, chunk := range file.Chunks {
+			hashes = append(hashes, chunk.Hash, chunk.EncryptedHash)
+		}
+	}
+	return newHaveSet(hashes)
+}
+
+// contains reports whether hash is in the set
+func (h haveSet) contains(hash string) bool {
+	_, found := slices.BinarySearch(h, hash)
+	return hash != "" && found
+}
+
+func (h haveSet) encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	buf := binary.AppendUvarint(nil, uint64(len(h)))
+	for _, hash := range h {
+		if raw, err := hex.DecodeString(hash); err == nil && hex.EncodeToString(raw) == hash {
+			buf = binary.AppendUvarint(buf, uint64(len(raw))<<1|1)
+			buf = append(buf, raw...)
+		} else {
+			buf = binary.AppendUvarint(buf, uint64(len(hash))<<1)
+			buf = append(buf, hash...)
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func readHaveSet(br *bufio.Reader) (haveSet, error) {
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read have-list size: %w", err)
+	}
+	if count > maxHaveSetSize {
+		return nil, fmt.Errorf("have-list of %d entries exceeds the limit of %d", count, maxHaveSetSize)
+	}
+
+	set := make(haveSet, 0, min(count, 1<<16))
+	for range count {
+		header, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read have-list entry: %w", err)
+		}
+		length := header >> 1
+		if length > maxChunkFrameString {
+			return nil, fmt.Errorf("have-list entry exceeds frame limit")
+		}
+		raw := make([]byte, length)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return nil, fmt.Errorf("failed to read have-list entry: %w", err)
+		}
+		hash := string(raw)
+		if header&1 != 0 {
+			hash = hex.EncodeToString(raw)
+		}
+		if len(set) > 0 && hash <= set[len(set)-1] {
+			return nil, fmt.Errorf("have-list is not sorted")
+		}
+		set = append(set, hash)
+	}
+	return set, nil
+}
+
+// handleHaveRequest answers a have-list with the chunks this vault holds, of
+// the files the peer may see, that the peer does not
+func (s *SyncService) handleHaveRequest(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+	sendError := func(msg string) { rejectStatus(stream, msg) }
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
+	remote, err := readHaveSet(bufio.NewReader(stream))
+	if err != nil {
+		fmt.Printf("Error reading have-list: %v\n", err)
+		return
+	}
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+	if s.privateKey != nil {
+		if !s.trusted(peerID) {
+			fmt.Printf("Rejecting have-list from untrusted peer: %s\n", peerID.String())
+			sendError("Unauthorized: Peer not trusted")
+			return
+		}
+		if !s.peerAuthenticated(peerID) {
+			fmt.Printf("Rejecting have-list from unauthenticated peer: %s\n", peerID.String())
+			sendError(errNotAuthenticated)
+			return
+		}
+	}
+
+	manifest, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		fmt.Printf("Error getting manifest: %v\n", err)
+		sendError("Internal error getting manifest")
+		return
+	}
+
+	var offer []string
+	for _, file := range filterFilesForPeer(s.accessRules(peerID), manifest.Files) {
+		for _, chunk := range file.Chunks {
+			if remote.contains(chunk.Hash) || remote.contains(chunk.EncryptedHash) {
+				continue
+			}
+			if s.holdsChunk(chunk) {
+				offer = append(offer, chunk.Hash)
+			}
+		}
+	}
+
+	if _, err := stream.Write([]byte{chunkStatusOK}); err != nil {
+		fmt.Printf("Error sending have-list: %v\n", err)
+		return
+	}
+	if err := newHaveSet(offer).encode(stream); err != nil {
+		fmt.Printf("Error sending have-list: %v\n", err)
+	}
+}
+
+// holdsChunk reports whether the chunk is stored in this vault under either name
+func (s *SyncService) holdsChunk(chunk config.ChunkRef) bool {
+	if exists, _ := s.vaultMgr.ChunkExists(chunk.Hash); exists {
+		return true
+	}
+	if chunk.EncryptedHash == "" {
+		return false
+	}
+	exists, _ := s.vaultMgr.ChunkExists(chunk.EncryptedHash)
+	return exists
+}
+
+// exchangeHaves sends peerID the chunks local references and returns the
+// chunks the peer offers in return. It returns nil without error for peers
+// that predate the have-list exchange; their offer is unknown.
+func (s *SyncService) exchangeHaves(ctx context.Context, peerID peer.ID, local *config.Manifest) (haveSet, error) {
+	caps, err := s.PeerCapabilities(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if !caps.Supports(HaveProtocolID) {
+		return nil, nil
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Manifest)
+	defer cancel()
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(HaveProtocolID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open have-list stream: %w", err)
+	}
+	defer stream.Close()
+	defer resetOnCancel(timeoutCtx, stream)()
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+	if err := localHaveSet(local).encode(stream); err != nil {
+		return nil, fmt.Errorf("failed to send have-list: %w", err)
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
+	br := bufio.NewReader(stream)
+	status, err := br.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read have-list response: %w", err)
+	}
+	if status != chunkStatusOK {
+		msg, _ := readFrameString(br)
+		return nil, fmt.Errorf("remote error: %s", msg)
+	}
+	offered, err := readHaveSet(br)
+	if err != nil {
+		return nil, err
+	}
+	if s.Verbose {
+		fmt.Printf("Peer %s offers %d chunks this vault lacks\n", peerID.String(), len(offered))
+	}
+	return offered, nil
+}
+
+// onlyOffered limits fetch to the chunks a peer offered, failing the others
+// without a round trip. A nil offer leaves fetch unchanged.
+func onlyOffered(offered haveSet, fetch chunkFetcher) chunkFetcher {
+	if offered == nil {
+		return fetch
+	}
+	return func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		if !offered.contains(chunkHash) {
+			return nil, 0, fmt.Errorf("peer does not hold chunk %s", chunkHash)
+		}
+		return fetch(chunkHash, encryptedHash)
+	}
+}
+
+// chunksOf returns the set of chunk hashes referenced by m
+func chunksOf(m *config.Manifest) map[string]bool {
+	chunks := make(map[string]bool)
+	for _, file := range m.Files {
+		for _, chunk := range file.Chunks {
+			chunks[chunk.Hash] = true
+		}
+	}
+	return chunks
+}
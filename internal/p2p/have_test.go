@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestHaveSetRoundTrip(t *testing.T) {
+	var hashes []string
+	for i := range 1000 {
+		sum := sha256.Sum256([]byte(strconv.Itoa(i)))
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	set := newHaveSet(append(hashes, hashes[0], ""))
+	if len(set) != 1000 || !set.contains(hashes[10]) || set.contains("") || set.contains("missing") {
+		t.Fatalf("unexpected set of %d entries", len(set))
+	}
+
+	var buf bytes.Buffer
+	if err := set.encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// Hex hashes are sent as raw bytes, half the size of their JSON form
+	encoded := buf.Len()
+	jsonData, _ := json.Marshal([]string(set))
+	if encoded >= len(jsonData)*6/10 {
+		t.Errorf("have-list takes %d bytes, JSON %d", encoded, len(jsonData))
+	}
+
+	got, err := readHaveSet(bufio.NewReader(&buf))
+	if err != nil || !reflect.DeepEqual(got, set) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+
+	// An empty set is a known, empty offer rather than an unknown one
+	buf.Reset()
+	if err := newHaveSet(nil).encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readHaveSet(bufio.NewReader(&buf)); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("expected an empty set, got %v (%v)", got, err)
+	}
+}
+
+func TestExchangeHaves(t *testing.T) {
+	server := newTestVault(t, "a.txt", hashA, "alpha")
+	addTestFile(t, server, "b.txt", hashB, "bravo")
+	addTestFile(t, server, "gone.txt", hashGone, "lost")
+	if err := os.Remove(filepath.Join(server.VaultRoot(), ".sietch", "chunks", hashGone)); err != nil {
+		t.Fatal(err)
+	}
+	client, serverID := newPeerPair(t, server)
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	localManifest, err := local.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client holds hash-a and the server lacks hash-gone, so only hash-b is offered
+	offered, err := client.exchangeHaves(context.Background(), serverID, localManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(offered, haveSet{hashB}) {
+		t.Errorf("expected only hash-b to be offered, got %v", offered)
+	}
+
+	fetch := onlyOffered(offered, func(chunkHash, _ string) ([]byte, int, error) { return []byte(chunkHash), 1, nil })
+	if _, _, err := fetch(hashGone, ""); err == nil {
+		t.Error("expected a chunk the peer did not offer to fail without fetching")
+	}
+	if data, _, err := fetch(hashB, ""); err != nil || string(data) != hashB {
+		t.Errorf("expected an offered chunk to be fetched, got %q (%v)", data, err)
+	}
+}
+
+func TestExchangeHavesWithOlderPeer(t *testing.T) {
+	client, serverID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"), HaveProtocolID)
+
+	offered, err := client.exchangeHaves(context.Background(), serverID, &config.Manifest{})
+	if err != nil || offered != nil {
+		t.Errorf("expected an unknown offer from a peer without have-lists, got %v (%v)", offered, err)
+	}
+}
@@ -0,0 +1,187 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multistream"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// HelloProtocolID is the handshake peers run before syncing to learn which
+// protocol versions, compression algorithms and vault schema the other side
+// supports. Each side sends its Capabilities, the dialing peer first.
+const HelloProtocolID = "/sietch/hello/1.0.0"
+
+// Capabilities describes what a peer supports
+type Capabilities struct {
+	Protocols     []string `json:"protocols"`      // Sietch protocol IDs the peer serves
+	Compression   []string `json:"compression"`    // Compression algorithms the peer can read
+	SchemaVersion int      `json:"schema_version"` // Schema version of the peer's vault; 0 if unknown
+	Legacy        bool     `json:"-"`              // The peer predates the handshake and its capabilities are assumed
+	// Algorithms the peer can compress and decompress sync traffic with
+	TransportCompression []string `json:"transport_compression,omitempty"`
+}
+
+// Supports reports whether the peer serves protocol id
+func (c *Capabilities) Supports(id string) bool {
+	return slices.Contains(c.Protocols, id)
+}
+
+// supportedCompression lists the compression algorithms this release and every
+// release before the handshake can read
+var supportedCompression = []string{constants.CompressionTypeNone, constants.CompressionTypeGzip, constants.CompressionTypeZstd}
+
+// legacyCapabilities are assumed for peers that predate the hello handshake:
+// the protocols every such release served, with JSON chunk framing
+func legacyCapabilities() *Capabilities {
+	return &Capabilities{
+		Protocols: []string{
+			ManifestProtocolID, ManifestProtocolIDv0, ChunkProtocolIDv1,
+			ConfigProtocolID, KeyExchangeProtocolv1, AuthProtocol,
+		},
+		Compression: supportedCompression,
+		Legacy:      true,
+	}
+}
+
+// localCapabilities returns the capabilities this service announces: the
+// sietch protocols registered on its host and the schema of its vault
+func (s *SyncService) localCapabilities() *Capabilities {
+	caps := &Capabilities{Compression: supportedCompression, TransportCompression: transportCompression}
+	for _, id := range s.host.Mux().Protocols() {
+		if strings.HasPrefix(string(id), "/sietch/") {
+			caps.Protocols = append(caps.Protocols, string(id))
+		}
+	}
+	slices.Sort(caps.Protocols)
+	if vaultConfig, err := s.vaultMgr.GetConfig(); err == nil {
+		caps.SchemaVersion = vaultConfig.SchemaVersion
+	}
+	return caps
+}
+
+// handleHello answers a peer's handshake with this service's capabilities
+func (s *SyncService) handleHello(stream network.Stream) {
+	defer stream.Close()
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	var remote Capabilities
+	if err := json.NewDecoder(stream).Decode(&remote); err != nil {
+		fmt.Printf("Error reading hello: %v\n", err)
+		return
+	}
+	s.rememberCapabilities(stream.Conn().RemotePeer(), &remote)
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	if err := json.NewEncoder(stream).Encode(s.localCapabilities()); err != nil {
+		fmt.Printf("Error sending hello: %v\n", err)
+	}
+}
+
+// PeerCapabilities returns what peerID supports, running the hello handshake
+// the first time. Peers that do not know the handshake get legacyCapabilities.
+func (s *SyncService) PeerCapabilities(ctx context.Context, peerID peer.ID) (*Capabilities, error) {
+	s.capsMu.Lock()
+	caps, ok := s.peerCaps[peerID]
+	s.capsMu.Unlock()
+	if ok {
+		return caps, nil
+	}
+
+	caps, err := s.hello(ctx, peerID)
+	if errors.Is(err, multistream.ErrNotSupported[protocol.ID]{}) {
+		if s.Verbose {
+			fmt.Printf("Peer %s does not support the hello handshake, assuming an older release\n", peerID.String())
+		}
+		caps, err = legacyCapabilities(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("hello handshake failed: %w", err)
+	}
+	s.rememberCapabilities(peerID, caps)
+
+	if s.Verbose {
+		fmt.Printf("Peer %s supports schema %d, compression %v, protocols %v\n",
+			peerID.String(), caps.SchemaVersion, caps.Compression, caps.Protocols)
+	}
+	return caps, nil
+}
+
+// hello runs the handshake with peerID
+func (s *SyncService) hello(ctx context.Context, peerID peer.ID) (*Capabilities, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Handshake)
+	defer cancel()
+
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(HelloProtocolID))
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	if err := json.NewEncoder(stream).Encode(s.localCapabilities()); err != nil {
+		return nil, err
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	var remote Capabilities
+	if err := json.NewDecoder(stream).Decode(&remote); err != nil {
+		return nil, err
+	}
+	return &remote, nil
+}
+
+func (s *SyncService) rememberCapabilities(peerID peer.ID, caps *Capabilities) {
+	s.capsMu.Lock()
+	defer s.capsMu.Unlock()
+	if s.peerCaps == nil {
+		s.peerCaps = make(map[peer.ID]*Capabilities)
+	}
+	s.peerCaps[peerID] = caps
+}
+
+// selectProtocol returns the first of preferred that peerID supports
+func (s *SyncService) selectProtocol(ctx context.Context, peerID peer.ID, preferred ...string) (protocol.ID, error) {
+	caps, err := s.PeerCapabilities(ctx, peerID)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range preferred {
+		if caps.Supports(id) {
+			return protocol.ID(id), nil
+		}
+	}
+	return "", fmt.Errorf("peer %s supports none of %s", peerID.String(), strings.Join(preferred, ", "))
+}
+
+// checkPeerCompatible refuses peers whose vault uses a newer schema than this
+// release understands, since their manifests may carry fields it would drop
+func (s *SyncService) checkPeerCompatible(ctx context.Context, peerID peer.ID) error {
+	caps, err := s.PeerCapabilities(ctx, peerID)
+	if err != nil {
+		return err
+	}
+	if caps.SchemaVersion > config.CurrentSchemaVersion {
+		return fmt.Errorf("peer vault uses schema version %d but this version of sietch only understands up to %d; upgrade sietch to sync with it",
+			caps.SchemaVersion, config.CurrentSchemaVersion)
+	}
+
+	// The peer can still sync, but cannot read chunks it later fetches from us
+	if vaultConfig, err := s.vaultMgr.GetConfig(); err == nil {
+		if algo := vaultConfig.Compression; algo != "" && !slices.Contains(caps.Compression, algo) {
+			fmt.Printf("Warning: peer %s does not support %s compression used by this vault\n", peerID.String(), algo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package p2p
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// newPeerPair connects a client sync service to a peer serving server's vault.
+// Handlers for the remove protocols are dropped from the server before the
+// peers connect, as if it were an older release.
+func newPeerPair(t *testing.T, server *config.Manager, remove ...string) (*SyncService, peer.ID) {
+	t.Helper()
+	net, err := mocknet.FullMeshLinked(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	hosts := net.Hosts()
+
+	if _, err := NewSyncService(hosts[0], server); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range remove {
+		hosts[0].RemoveStreamHandler(protocol.ID(id))
+	}
+	client, err := NewSyncService(hosts[1], newTestVault(t, "b.txt", hashB, "bravo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	return client, hosts[0].ID()
+}
+
+func TestPeerCapabilities(t *testing.T) {
+	client, serverID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"))
+
+	caps, err := client.PeerCapabilities(context.Background(), serverID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Legacy || caps.SchemaVersion != config.CurrentSchemaVersion {
+		t.Errorf("unexpected capabilities %+v", caps)
+	}
+	for _, id := range []string{HelloProtocolID, ChunkProtocolID, ChunkProtocolIDv1, ManifestProtocolID} {
+		if !caps.Supports(id) {
+			t.Errorf("expected peer to announce %s, got %v", id, caps.Protocols)
+		}
+	}
+	if !strings.Contains(strings.Join(caps.Compression, ","), "zstd") {
+		t.Errorf("expected zstd in compression support, got %v", caps.Compression)
+	}
+
+	if got, err := client.selectProtocol(context.Background(), serverID, "/sietch/unknown/1.0.0"); err == nil {
+		t.Errorf("expected no protocol to be selected, got %s", got)
+	}
+}
+
+func TestPeerCapabilitiesOfOlderPeer(t *testing.T) {
+	client, serverID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"), HelloProtocolID, ChunkProtocolID)
+
+	caps, err := client.PeerCapabilities(context.Background(), serverID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.Legacy || caps.Supports(ChunkProtocolID) || !caps.Supports(ChunkProtocolIDv1) {
+		t.Errorf("expected legacy capabilities with JSON chunks, got %+v", caps)
+	}
+	if err := client.checkPeerCompatible(context.Background(), serverID); err != nil {
+		t.Errorf("an older peer must still be compatible: %v", err)
+	}
+}
+
+func TestCheckPeerCompatibleRejectsNewerSchema(t *testing.T) {
+	client, serverID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"))
+
+	// This release cannot open a newer vault, so stand in for a newer peer
+	client.rememberCapabilities(serverID, &Capabilities{SchemaVersion: config.CurrentSchemaVersion + 1})
+
+	err := client.checkPeerCompatible(context.Background(), serverID)
+	if err == nil || !strings.Contains(err.Error(), "upgrade sietch") {
+		t.Errorf("expected newer schema to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncRun is one sync recorded in the vault's sync history
+type SyncRun struct {
+	Time         time.Time      `json:"time" yaml:"time"`
+	Session      string         `json:"session" yaml:"session"`
+	Kind         string         `json:"kind" yaml:"kind"`                       // peer, peers, vault or bundle
+	Source       string         `json:"source" yaml:"source"`                   // Peer ID, comma-separated peer IDs, vault path or bundle path
+	Peers        []PeerTransfer `json:"peers,omitempty" yaml:"peers,omitempty"` // What each peer of a multi-peer sync sent
+	DurationMS   int64          `json:"duration_ms" yaml:"duration_ms"`
+	Files        int            `json:"files" yaml:"files"`
+	Chunks       int            `json:"chunks" yaml:"chunks"`
+	Deduplicated int            `json:"deduplicated" yaml:"deduplicated"`
+	Bytes        int64          `json:"bytes" yaml:"bytes"`
+	Deleted      int            `json:"deleted" yaml:"deleted"`
+	Failed       int            `json:"failed" yaml:"failed"`   // Chunks that could not be fetched
+	Corrupt      int            `json:"corrupt" yaml:"corrupt"` // Chunks rejected because their data did not match their hash
+	Incomplete   int            `json:"incomplete" yaml:"incomplete"`
+	Interrupted  bool           `json:"interrupted" yaml:"interrupted"`
+	Error        string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// PeerTransfer counts the chunks one peer sent during a sync
+type PeerTransfer struct {
+	Peer   string `json:"peer" yaml:"peer"`
+	Chunks int    `json:"chunks" yaml:"chunks"`
+	Bytes  int64  `json:"bytes" yaml:"bytes"`
+}
+
+// Duration returns how long the run took
+func (r SyncRun) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// Clean reports whether the run fetched everything it set out to
+func (r SyncRun) Clean() bool {
+	return !r.Interrupted && r.Failed == 0 && r.Error == ""
+}
+
+// Involves reports whether source took part in the run, as its source or as
+// one of the peers of a multi-peer sync
+func (r SyncRun) Involves(source string) bool {
+	if r.Source == source {
+		return true
+	}
+	for _, p := range r.Peers {
+		if p.Peer == source {
+			return true
+		}
+	}
+	return false
+}
+
+// syncHistoryPath is where the sync history of the vault at vaultRoot is kept,
+// one JSON encoded SyncRun per line
+func syncHistoryPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync", "history.jsonl")
+}
+
+// appendSyncHistory adds run to the end of the vault's sync history
+func appendSyncHistory(vaultRoot string, run SyncRun) error {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode sync run: %w", err)
+	}
+	path := syncHistoryPath(vaultRoot)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadSyncHistory returns the syncs recorded for the vault at vaultRoot,
+// oldest first. A line that cannot be decoded, as the last one may be after a
+// crash, is skipped.
+func ReadSyncHistory(vaultRoot string) ([]SyncRun, error) {
+	f, err := os.Open(syncHistoryPath(vaultRoot))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sync history: %w", err)
+	}
+	defer f.Close()
+
+	var runs []SyncRun
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var run SyncRun
+		if json.Unmarshal(scanner.Bytes(), &run) != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sync history: %w", err)
+	}
+	return runs, nil
+}
+
+// SyncTotals aggregates the runs of the sync history with one source
+type SyncTotals struct {
+	Kind     string    `json:"kind" yaml:"kind"` // peer, vault or bundle
+	Source   string    `json:"source" yaml:"source"`
+	Runs     int       `json:"runs" yaml:"runs"`
+	Failures int       `json:"failures" yaml:"failures"` // Runs that were interrupted or left chunks unfetched
+	Files    int       `json:"files" yaml:"files"`
+	Chunks   int       `json:"chunks" yaml:"chunks"`
+	Bytes    int64     `json:"bytes" yaml:"bytes"`
+	LastSync time.Time `json:"last_sync" yaml:"last_sync"`
+}
+
+// SummarizeSyncHistory totals runs by source, most bytes transferred first.
+// Every peer of a multi-peer sync is credited with the chunks it sent; the
+// files of such a sync are not attributed to any one of them.
+func SummarizeSyncHistory(runs []SyncRun) []SyncTotals {
+	bySource := make(map[string]*SyncTotals)
+	totalsFor := func(kind, source string) *SyncTotals {
+		key := kind + "\x00" + source
+		t, ok := bySource[key]
+		if !ok {
+			t = &SyncTotals{Kind: kind, Source: source}
+			bySource[key] = t
+		}
+		return t
+	}
+	add := func(t *SyncTotals, run SyncRun) {
+		t.Runs++
+		if !run.Clean() {
+			t.Failures++
+		}
+		if run.Time.After(t.LastSync) {
+			t.LastSync = run.Time
+		}
+	}
+
+	for _, run := range runs {
+		if run.Kind == "peers" {
+			for _, id := range strings.Split(run.Source, ",") {
+				add(totalsFor("peer", id), run)
+			}
+			for _, p := range run.Peers {
+				t := totalsFor("peer", p.Peer)
+				t.Chunks += p.Chunks
+				t.Bytes += p.Bytes
+			}
+			continue
+		}
+		t := totalsFor(run.Kind, run.Source)
+		add(t, run)
+		t.Files += run.Files
+		t.Chunks += run.Chunks
+		t.Bytes += run.Bytes
+	}
+
+	totals := make([]SyncTotals, 0, len(bySource))
+	for _, t := range bySource {
+		totals = append(totals, *t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Bytes != totals[j].Bytes {
+			return totals[i].Bytes > totals[j].Bytes
+		}
+		return totals[i].Kind+totals[i].Source < totals[j].Kind+totals[j].Source
+	})
+	return totals
+}
+
+// newSyncRun describes a sync with the given source for the sync history;
+// syncErr is why an interrupted sync stopped
+func newSyncRun(sourceKind, source string, result *SyncResult, syncErr error) SyncRun {
+	run := SyncRun{
+		Time:         time.Now().UTC(),
+		Session:      result.Session,
+		Kind:         sourceKind,
+		Source:       source,
+		Peers:        result.PeerTransfers,
+		DurationMS:   result.Duration.Milliseconds(),
+		Files:        result.FileCount,
+		Chunks:       result.ChunksTransferred,
+		Deduplicated: result.ChunksDeduplicated,
+		Bytes:        result.BytesTransferred,
+		Deleted:      len(result.FilesDeleted),
+		Failed:       len(result.FailedChunks),
+		Corrupt:      len(result.CorruptChunks),
+		Incomplete:   len(result.IncompleteFiles),
+		Interrupted:  result.Interrupted,
+	}
+	if syncErr != nil {
+		run.Error = syncErr.Error()
+	}
+	return run
+}
+
+// recordHistory appends run to the vault's sync history. The sync has
+// already happened, so a failure is reported without failing it.
+func (s *SyncService) recordHistory(run SyncRun) {
+	if err := appendSyncHistory(s.vaultMgr.VaultRoot(), run); err != nil {
+		fmt.Printf("Warning: failed to record sync in sync history: %v\n", err)
+	}
+}
@@ -0,0 +1,130 @@
+package p2p
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestSyncHistoryRecordsEachSync(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	other := newTestVault(t, "b.txt", hashB, "bravo")
+	s := NewLocalSyncService(local)
+
+	if runs, err := ReadSyncHistory(local.VaultRoot()); err != nil || len(runs) != 0 {
+		t.Fatalf("expected no history before syncing, got %+v (%v)", runs, err)
+	}
+	result, err := s.SyncWithVault(other.VaultRoot())
+	if err != nil {
+		t.Fatalf("SyncWithVault failed: %v", err)
+	}
+	if _, err := s.SyncWithVault(other.VaultRoot()); err != nil {
+		t.Fatalf("second SyncWithVault failed: %v", err)
+	}
+
+	runs, err := ReadSyncHistory(local.VaultRoot())
+	if err != nil {
+		t.Fatalf("ReadSyncHistory failed: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %+v", runs)
+	}
+	first := runs[0]
+	if first.Kind != "vault" || first.Source != other.VaultRoot() || first.Session != result.Session {
+		t.Errorf("unexpected source of run %+v", first)
+	}
+	if first.Files != 1 || first.Chunks != 1 || first.Bytes != 5 || !first.Clean() {
+		t.Errorf("unexpected counts in run %+v", first)
+	}
+	if runs[1].Files != 0 || runs[1].Chunks != 0 {
+		t.Errorf("expected the second run to copy nothing, got %+v", runs[1])
+	}
+
+	info, err := os.Stat(syncHistoryPath(local.VaultRoot()))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected history file with mode 0600, got %v (%v)", info, err)
+	}
+}
+
+func TestReadSyncHistorySkipsTruncatedLines(t *testing.T) {
+	root := t.TempDir()
+	if err := appendSyncHistory(root, SyncRun{Session: "s1", Kind: "peer", Source: "QmA"}); err != nil {
+		t.Fatalf("appendSyncHistory failed: %v", err)
+	}
+	f, err := os.OpenFile(syncHistoryPath(root), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"session":"s2","ki`)
+	f.Close()
+
+	runs, err := ReadSyncHistory(root)
+	if err != nil || len(runs) != 1 || runs[0].Session != "s1" {
+		t.Errorf("expected only the complete run, got %+v (%v)", runs, err)
+	}
+}
+
+func TestSummarizeSyncHistory(t *testing.T) {
+	day := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	runs := []SyncRun{
+		{Time: day, Kind: "peer", Source: "QmA", Files: 2, Chunks: 4, Bytes: 400},
+		{Time: day.Add(time.Hour), Kind: "peer", Source: "QmA", Files: 1, Chunks: 1, Bytes: 100, Failed: 1},
+		{Time: day.Add(2 * time.Hour), Kind: "peers", Source: "QmA,QmB", Files: 3, Chunks: 5, Bytes: 900,
+			Peers: []PeerTransfer{{Peer: "QmA", Chunks: 2, Bytes: 300}, {Peer: "QmB", Chunks: 3, Bytes: 600}}},
+		{Time: day, Kind: "bundle", Source: "/tmp/b.sietch", Files: 1, Chunks: 1, Bytes: 10, Interrupted: true},
+	}
+
+	totals := SummarizeSyncHistory(runs)
+	if len(totals) != 3 {
+		t.Fatalf("expected 3 sources, got %+v", totals)
+	}
+	a, b, bundle := totals[0], totals[1], totals[2]
+	if a.Source != "QmA" || a.Runs != 3 || a.Failures != 1 || a.Files != 3 || a.Chunks != 7 || a.Bytes != 800 || !a.LastSync.Equal(day.Add(2*time.Hour)) {
+		t.Errorf("unexpected totals for QmA: %+v", a)
+	}
+	if b.Source != "QmB" || b.Kind != "peer" || b.Runs != 1 || b.Files != 0 || b.Chunks != 3 || b.Bytes != 600 {
+		t.Errorf("unexpected totals for QmB: %+v", b)
+	}
+	if bundle.Kind != "bundle" || bundle.Failures != 1 || bundle.Bytes != 10 {
+		t.Errorf("unexpected totals for the bundle: %+v", bundle)
+	}
+}
+
+func TestSyncRunsPostSyncHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are tested with sh")
+	}
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	other := newTestVault(t, "b.txt", hashB, "bravo")
+	cfg, err := local.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Hooks.PostSync = []config.Hook{{Command: "cat > synced.json"}}
+	if err := config.SaveVaultConfig(local.VaultRoot(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewLocalSyncService(local).SyncWithVault(other.VaultRoot()); err != nil {
+		t.Fatalf("SyncWithVault failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(local.VaultRoot(), "synced.json"))
+	if err != nil {
+		t.Fatalf("post_sync hook did not run: %v", err)
+	}
+	var event struct {
+		Event string
+		Data  SyncRun
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("hook got invalid JSON %q: %v", data, err)
+	}
+	if event.Event != "post_sync" || event.Data.Kind != "vault" || event.Data.Files != 1 {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,344 @@
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+)
+
+// Peers exchange their PEM-encoded RSA sync keys over KeyExchangeProtocol in
+// one message each way. A message is a status byte followed by its body,
+// prefixed with its length as a uvarint: the PEM key when the status is
+// keyStatusOK, or the reason the exchange was refused. The requesting peer
+// sends its key first and the serving peer answers with its own.
+//
+// KeyExchangeProtocolv1 peers send bare PEM blocks, read until one parses.
+// They are still served, with the same bound on the size of the key.
+
+const (
+	keyStatusOK      byte = 0
+	keyStatusError   byte = 1 // Any other failure, including stream limits
+	keyStatusInvalid byte = 2 // The key sent is malformed, too large or not RSA
+	keyStatusRefused byte = 3 // The key is not accepted for the sending peer
+
+	// maxKeyExchangeSize bounds a key exchange message; a PEM-encoded
+	// 16384-bit RSA key takes under 3KB
+	maxKeyExchangeSize = 8 << 10
+	// maxKeyExchangeBits bounds the size of keys peers may use, since
+	// verifying signatures of larger keys costs more than they are worth
+	maxKeyExchangeBits = 16384
+)
+
+// keyExchangeRejection is a key exchange the other peer refused
+type keyExchangeRejection struct {
+	Status byte
+	Reason string
+}
+
+func (e *keyExchangeRejection) Error() string {
+	switch e.Status {
+	case keyStatusInvalid:
+		return fmt.Sprintf("peer rejected our key: %s", e.Reason)
+	case keyStatusRefused:
+		return fmt.Sprintf("peer refused our key: %s", e.Reason)
+	default:
+		return fmt.Sprintf("key exchange failed on the peer: %s", e.Reason)
+	}
+}
+
+// writeKeyMessage sends one key exchange message
+func writeKeyMessage(w io.Writer, status byte, body []byte) error {
+	if len(body) > maxKeyExchangeSize {
+		return fmt.Errorf("key exchange message of %d bytes exceeds the %d byte limit", len(body), maxKeyExchangeSize)
+	}
+	frame := append([]byte{status}, binary.AppendUvarint(nil, uint64(len(body)))...)
+	_, err := w.Write(append(frame, body...))
+	return err
+}
+
+// readKeyMessage reads one key exchange message
+func readKeyMessage(r io.Reader) (byte, []byte, error) {
+	br := bufio.NewReader(io.LimitReader(r, maxKeyExchangeSize+binary.MaxVarintLen64+1))
+	status, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read status: %w", err)
+	}
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read message length: %w", err)
+	}
+	if length > maxKeyExchangeSize {
+		return 0, nil, fmt.Errorf("key exchange message of %d bytes exceeds the %d byte limit", length, maxKeyExchangeSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(br, body); err != nil {
+		return 0, nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	return status, body, nil
+}
+
+// parseExchangedKey parses the PEM-encoded RSA key of a peer, returning it
+// with its fingerprint
+func parseExchangedKey(pemData []byte) (*rsa.PublicKey, string, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, "", fmt.Errorf("failed to decode peer's public key: empty block")
+	}
+
+	var key *rsa.PublicKey
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		k, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse PKCS1 public key: %w", err)
+		}
+		key = k
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse PKIX public key: %w", err)
+		}
+		k, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, "", fmt.Errorf("peer's key is not an RSA public key")
+		}
+		key = k
+	default:
+		return nil, "", fmt.Errorf("unknown key format: %s", block.Type)
+	}
+	if key.N.BitLen() > maxKeyExchangeBits {
+		return nil, "", fmt.Errorf("peer's key of %d bits exceeds the %d bit limit", key.N.BitLen(), maxKeyExchangeBits)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal peer's public key: %w", err)
+	}
+	hash := sha256.Sum256(der)
+	return key, base64.StdEncoding.EncodeToString(hash[:]), nil
+}
+
+// handleKeyExchange handles key exchange requests from peers
+func (s *SyncService) handleKeyExchange(stream network.Stream) {
+	defer stream.Close()
+
+	reject := func(status byte, reason string) {
+		_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+		_ = writeKeyMessage(stream, status, []byte(reason))
+	}
+	if s.publicKey == nil {
+		fmt.Println("Cannot perform key exchange: no public key available")
+		reject(keyStatusError, "no public key available")
+		return
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	status, body, err := readKeyMessage(stream)
+	if err != nil {
+		fmt.Printf("Error reading peer's public key: %v\n", err)
+		reject(keyStatusInvalid, err.Error())
+		return
+	}
+	if status != keyStatusOK {
+		fmt.Printf("Peer sent no public key: %s\n", body)
+		return
+	}
+
+	peerID := stream.Conn().RemotePeer()
+	peerPubKey, fingerprint, err := parseExchangedKey(body)
+	if err != nil {
+		fmt.Printf("Rejecting key of peer %s: %v\n", peerID.String(), err)
+		reject(keyStatusInvalid, err.Error())
+		return
+	}
+	if err := s.checkPinnedKey(peerID, peerPubKey, fingerprint); err != nil {
+		fmt.Printf("Refusing key exchange: %v\n", err)
+		reject(keyStatusRefused, "key does not match the key pinned for this peer")
+		return
+	}
+
+	ours, err := publicKeyPEM(s.publicKey)
+	if err != nil {
+		fmt.Printf("Failed to marshal our public key: %v\n", err)
+		reject(keyStatusError, "internal error")
+		return
+	}
+	s.storeExchangedKey(peerID, peerPubKey, fingerprint)
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	if err := writeKeyMessage(stream, keyStatusOK, []byte(ours)); err != nil {
+		fmt.Printf("Failed to send our public key: %v\n", err)
+	}
+}
+
+// handleKeyExchangeV1 serves KeyExchangeProtocolv1 peers
+func (s *SyncService) handleKeyExchangeV1(stream network.Stream) {
+	defer stream.Close()
+
+	if s.publicKey == nil {
+		fmt.Println("Cannot perform key exchange: no public key available")
+		return
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	pemData, err := readLegacyKey(stream)
+	if err != nil {
+		fmt.Printf("Error reading peer's public key: %v\n", err)
+		return
+	}
+
+	peerID := stream.Conn().RemotePeer()
+	peerPubKey, fingerprint, err := parseExchangedKey(pemData)
+	if err != nil {
+		fmt.Printf("Rejecting key of peer %s: %v\n", peerID.String(), err)
+		return
+	}
+	if err := s.checkPinnedKey(peerID, peerPubKey, fingerprint); err != nil {
+		fmt.Printf("Refusing key exchange: %v\n", err)
+		return
+	}
+
+	ours, err := publicKeyPEM(s.publicKey)
+	if err != nil {
+		fmt.Printf("Failed to marshal our public key: %v\n", err)
+		return
+	}
+	s.storeExchangedKey(peerID, peerPubKey, fingerprint)
+	if _, err := stream.Write([]byte(ours)); err != nil {
+		fmt.Printf("Failed to send our public key: %v\n", err)
+	}
+}
+
+// readLegacyKey reads a bare PEM block of at most maxKeyExchangeSize bytes
+func readLegacyKey(r io.Reader) ([]byte, error) {
+	var pemData []byte
+	buffer := make([]byte, 1024)
+	for {
+		n, err := r.Read(buffer)
+		pemData = append(pemData, buffer[:n]...)
+		if block, _ := pem.Decode(pemData); block != nil {
+			return pemData, nil
+		}
+		if len(pemData) > maxKeyExchangeSize {
+			return nil, fmt.Errorf("key exceeds the %d byte limit", maxKeyExchangeSize)
+		}
+		if err == io.EOF {
+			return pemData, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// storeExchangedKey keeps the key peerID sent for this session. It lets the
+// peer authenticate, but the vault only serves it if it is trusted.
+func (s *SyncService) storeExchangedKey(peerID peer.ID, key *rsa.PublicKey, fingerprint string) {
+	s.setSessionKey(peerID, key, fingerprint)
+	fmt.Printf("Key exchange completed with peer %s (fingerprint: %s)\n", peerID.String(), fingerprint)
+	s.recordAudit(audit.OpKeyExchange, map[string]string{"peer": peerID.String(), "fingerprint": fingerprint})
+}
+
+// setSessionKey records the key peerID presented in a key exchange
+func (s *SyncService) setSessionKey(peerID peer.ID, key *rsa.PublicKey, fingerprint string) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if s.sessionKeys == nil {
+		s.sessionKeys = make(map[peer.ID]*PeerInfo)
+	}
+	s.sessionKeys[peerID] = &PeerInfo{
+		ID:           peerID,
+		PublicKey:    key,
+		Fingerprint:  fingerprint,
+		TrustedSince: time.Now(),
+	}
+}
+
+// forgetSessionKey drops the key peerID presented in a key exchange
+func (s *SyncService) forgetSessionKey(peerID peer.ID) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	delete(s.sessionKeys, peerID)
+}
+
+// peerKey returns the key peerID signs with: its pinned key if it is
+// trusted, or else the one it presented in a key exchange
+func (s *SyncService) peerKey(peerID peer.ID) (*PeerInfo, bool) {
+	if info, ok := s.trustedPeers[peerID]; ok && info.PublicKey != nil {
+		return info, true
+	}
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	info, ok := s.sessionKeys[peerID]
+	return info, ok
+}
+
+// exchangeKeys sends our key to peerID and returns the key it answers with,
+// along with its fingerprint, refusing keys other than the one pinned for it
+func (s *SyncService) exchangeKeys(ctx context.Context, peerID peer.ID) (*rsa.PublicKey, string, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Handshake)
+	defer cancel()
+
+	protocolID, err := s.selectProtocol(timeoutCtx, peerID, KeyExchangeProtocol, KeyExchangeProtocolv1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to negotiate key exchange: %w", err)
+	}
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocolID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open key exchange stream: %w", err)
+	}
+	defer stream.Close()
+
+	ours, err := publicKeyPEM(s.publicKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	var pemData []byte
+	if protocolID == protocol.ID(KeyExchangeProtocolv1) {
+		if _, err := stream.Write([]byte(ours)); err != nil {
+			return nil, "", fmt.Errorf("failed to send public key: %w", err)
+		}
+		if pemData, err = readLegacyKey(stream); err != nil {
+			return nil, "", fmt.Errorf("failed reading key data: %w", err)
+		}
+	} else {
+		if err := writeKeyMessage(stream, keyStatusOK, []byte(ours)); err != nil {
+			return nil, "", fmt.Errorf("failed to send public key: %w", err)
+		}
+		status, body, err := readKeyMessage(stream)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed reading key data: %w", err)
+		}
+		if status != keyStatusOK {
+			return nil, "", &keyExchangeRejection{Status: status, Reason: string(bytes.TrimSpace(body))}
+		}
+		pemData = body
+	}
+
+	peerPubKey, fingerprint, err := parseExchangedKey(pemData)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.checkPinnedKey(peerID, peerPubKey, fingerprint); err != nil {
+		return nil, "", err
+	}
+	return peerPubKey, fingerprint, nil
+}
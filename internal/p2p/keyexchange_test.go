@@ -0,0 +1,118 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func TestKeyMessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeKeyMessage(&buf, keyStatusOK, []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	status, body, err := readKeyMessage(&buf)
+	if err != nil || status != keyStatusOK || string(body) != "key" {
+		t.Fatalf("readKeyMessage = %d, %q, %v", status, body, err)
+	}
+
+	if err := writeKeyMessage(io.Discard, keyStatusOK, make([]byte, maxKeyExchangeSize+1)); err == nil {
+		t.Error("expected an oversized message to be refused")
+	}
+	huge := append([]byte{keyStatusOK}, binary.AppendUvarint(nil, 1<<40)...)
+	if _, _, err := readKeyMessage(bytes.NewReader(huge)); err == nil {
+		t.Error("expected an oversized length prefix to be refused")
+	}
+	if _, _, err := readKeyMessage(bytes.NewReader([]byte{keyStatusOK, 10, 'a'})); err == nil {
+		t.Error("expected a truncated message to fail")
+	}
+}
+
+func TestKeyExchange(t *testing.T) {
+	server, client := newPairingPeers(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+	if err := client.host.Connect(ctx, peer.AddrInfo{ID: serverID, Addrs: server.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	key, fingerprint, err := client.exchangeKeys(ctx, serverID)
+	if err != nil {
+		t.Fatalf("exchangeKeys failed: %v", err)
+	}
+	if !key.Equal(server.publicKey) || fingerprint == "" {
+		t.Error("expected the server's key")
+	}
+	if info, ok := server.peerKey(clientID); !ok || !info.PublicKey.Equal(client.publicKey) {
+		t.Error("expected the server to have the client's key")
+	}
+	if server.trusted(clientID) {
+		t.Error("a key exchange must not make the client trusted")
+	}
+
+	exchange := func(id string, request []byte) []byte {
+		t.Helper()
+		stream, err := client.host.NewStream(ctx, serverID, protocol.ID(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		if _, err := stream.Write(request); err != nil {
+			t.Fatal(err)
+		}
+		_ = stream.CloseWrite()
+		response, _ := io.ReadAll(stream)
+		return response
+	}
+
+	// Malformed and oversized keys get a structured rejection
+	var garbage bytes.Buffer
+	_ = writeKeyMessage(&garbage, keyStatusOK, []byte("not a key"))
+	status, reason, err := readKeyMessage(bytes.NewReader(exchange(KeyExchangeProtocol, garbage.Bytes())))
+	if err != nil || status != keyStatusInvalid || len(reason) == 0 {
+		t.Errorf("expected an invalid key rejection, got %d %q %v", status, reason, err)
+	}
+	huge := append([]byte{keyStatusOK}, binary.AppendUvarint(nil, maxKeyExchangeSize+1)...)
+	if status, _, _ := readKeyMessage(bytes.NewReader(exchange(KeyExchangeProtocol, huge))); status != keyStatusInvalid {
+		t.Errorf("expected an oversized key to be rejected, got status %d", status)
+	}
+
+	// Older peers sending bare PEM are still answered with ours
+	ours, _ := publicKeyPEM(client.publicKey)
+	if got, _, err := parseExchangedKey(exchange(KeyExchangeProtocolv1, []byte(ours))); err != nil || !got.Equal(server.publicKey) {
+		t.Errorf("expected a legacy exchange to return the server's key, got %v", err)
+	}
+	if response := exchange(KeyExchangeProtocolv1, bytes.Repeat([]byte("A"), 3*maxKeyExchangeSize)); len(response) != 0 {
+		t.Error("expected an endless legacy key to get no answer")
+	}
+}
+
+func TestKeyExchangeRejection(t *testing.T) {
+	server, client := newPairingPeers(t)
+	ctx := context.Background()
+	serverID := server.host.ID()
+	if err := client.host.Connect(ctx, peer.AddrInfo{ID: serverID, Addrs: server.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key too large to verify signatures of cheaply is refused by the server
+	big, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big.PublicKey.N.Lsh(big.PublicKey.N, maxKeyExchangeBits)
+	client.publicKey = &big.PublicKey
+	_, _, err = client.exchangeKeys(ctx, serverID)
+	var rejected *keyExchangeRejection
+	if !errors.As(err, &rejected) || rejected.Status != keyStatusInvalid {
+		t.Fatalf("expected the server to reject the key, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// StreamLimits bounds the sync streams other peers may open to this vault. A
+// stream over a limit is answered with an error in the protocol's own format
+// rather than dropped, so the requesting peer backs off and retries.
+type StreamLimits struct {
+	MaxStreams        int     // Concurrent incoming streams from all peers; 0 means unlimited
+	MaxStreamsPerPeer int     // Concurrent incoming streams from one peer; 0 means unlimited
+	RequestsPerSecond float64 // Sustained streams a peer may open per second; 0 means unlimited
+	Burst             int     // Streams a peer may open at once before its rate applies
+}
+
+// DefaultStreamLimits are used unless the vault's sync settings change them
+var DefaultStreamLimits = StreamLimits{
+	MaxStreams:        64,
+	MaxStreamsPerPeer: 8,
+	RequestsPerSecond: 100,
+	Burst:             200,
+}
+
+// StreamLimitsFor returns the default limits with those set in cfg applied
+func StreamLimitsFor(cfg *config.SyncConfig) StreamLimits {
+	limits := DefaultStreamLimits
+	if cfg.MaxStreams > 0 {
+		limits.MaxStreams = cfg.MaxStreams
+	}
+	if cfg.MaxPeerStreams > 0 {
+		limits.MaxStreamsPerPeer = cfg.MaxPeerStreams
+	}
+	if cfg.PeerRequestRate > 0 {
+		limits.RequestsPerSecond = float64(cfg.PeerRequestRate)
+		limits.Burst = 2 * cfg.PeerRequestRate
+	}
+	return limits
+}
+
+// streamLimiter tracks the streams each peer has open and a token bucket of
+// the streams it may open next
+type streamLimiter struct {
+	mu      sync.Mutex
+	active  int
+	peers   map[peer.ID]*peerStreams
+	nowFunc func() time.Time // Replaced in tests
+}
+
+type peerStreams struct {
+	active int
+	tokens float64
+	last   time.Time
+}
+
+// acquire admits a stream from peerID under limits, returning a function that
+// releases it, or the reason it was refused
+func (l *streamLimiter) acquire(peerID peer.ID, limits StreamLimits) (func(), string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.nowFunc != nil {
+		now = l.nowFunc()
+	}
+	if l.peers == nil {
+		l.peers = make(map[peer.ID]*peerStreams)
+	}
+	if len(l.peers) >= maxTrackedPeers {
+		l.forgetIdle(now, limits)
+	}
+	p, ok := l.peers[peerID]
+	if !ok {
+		p = &peerStreams{tokens: float64(max(limits.Burst, 1)), last: now}
+		l.peers[peerID] = p
+	}
+
+	if limits.MaxStreams > 0 && l.active >= limits.MaxStreams {
+		return nil, "Busy: too many concurrent sync streams"
+	}
+	if limits.MaxStreamsPerPeer > 0 && p.active >= limits.MaxStreamsPerPeer {
+		return nil, "Busy: too many concurrent streams from this peer"
+	}
+	if limits.RequestsPerSecond > 0 {
+		p.tokens = min(p.tokens+now.Sub(p.last).Seconds()*limits.RequestsPerSecond, float64(max(limits.Burst, 1)))
+		p.last = now
+		if p.tokens < 1 {
+			return nil, "Busy: request rate limit exceeded"
+		}
+		p.tokens--
+	}
+
+	l.active++
+	p.active++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.active--
+		p.active--
+	}, ""
+}
+
+// maxTrackedPeers is how many peers the limiter tracks before it forgets idle ones
+const maxTrackedPeers = 1024
+
+// forgetIdle drops peers with no open streams whose bucket would be full by
+// now, since a fresh entry for them behaves the same
+func (l *streamLimiter) forgetIdle(now time.Time, limits StreamLimits) {
+	for id, p := range l.peers {
+		refilled := limits.RequestsPerSecond == 0 ||
+			p.tokens+now.Sub(p.last).Seconds()*limits.RequestsPerSecond >= float64(max(limits.Burst, 1))
+		if p.active == 0 && refilled {
+			delete(l.peers, id)
+		}
+	}
+}
+
+// limited wraps a stream handler so that streams over the limits are answered
+// by reject instead
+func (s *SyncService) limited(handler network.StreamHandler, reject func(network.Stream, string)) network.StreamHandler {
+	return func(stream network.Stream) {
+		peerID := stream.Conn().RemotePeer()
+		release, reason := s.streams.acquire(peerID, s.Limits)
+		if release == nil {
+			if s.Verbose {
+				fmt.Printf("Rejecting %s stream from peer %s: %s\n", stream.Protocol(), peerID.String(), reason)
+			}
+			_ = stream.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			reject(stream, reason)
+			_ = stream.Close()
+			return
+		}
+		defer release()
+		handler(stream)
+	}
+}
+
+// rejectJSON answers protocols whose responses are JSON objects with an error field
+func rejectJSON(stream network.Stream, reason string) {
+	_ = json.NewEncoder(stream).Encode(struct {
+		Error string `json:"error"`
+	}{reason})
+}
+
+// rejectChunk answers a chunk request in the framing the stream negotiated
+func rejectChunk(stream network.Stream, reason string) {
+	_ = chunkCodecFor(stream.Protocol()).writeResponse(stream, chunkResponse{Error: reason})
+}
+
+// rejectStatus answers protocols whose responses start with a status byte
+func rejectStatus(stream network.Stream, reason string) {
+	frame := append([]byte{chunkStatusError}, binary.AppendUvarint(nil, uint64(len(reason)))...)
+	_, _ = stream.Write(append(frame, reason...))
+}
@@ -0,0 +1,105 @@
+package p2p
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestStreamLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := &streamLimiter{nowFunc: func() time.Time { return now }}
+	limits := StreamLimits{MaxStreams: 3, MaxStreamsPerPeer: 2, RequestsPerSecond: 1, Burst: 3}
+
+	a, b := peer.ID("a"), peer.ID("b")
+	releaseA1, _ := l.acquire(a, limits)
+	releaseA2, _ := l.acquire(a, limits)
+	if releaseA1 == nil || releaseA2 == nil {
+		t.Fatal("expected the first two streams to be admitted")
+	}
+	if release, reason := l.acquire(a, limits); release != nil || !strings.Contains(reason, "from this peer") {
+		t.Fatalf("expected the per-peer limit, got %q", reason)
+	}
+	releaseB, _ := l.acquire(b, limits)
+	if releaseB == nil {
+		t.Fatal("expected another peer to be admitted")
+	}
+	if release, reason := l.acquire(peer.ID("c"), limits); release != nil || !strings.Contains(reason, "concurrent sync streams") {
+		t.Fatalf("expected the global limit, got %q", reason)
+	}
+	releaseA1()
+	releaseA2()
+	releaseB()
+
+	// Refused streams cost no tokens, so peer a has one of its three left
+	release, _ := l.acquire(a, limits)
+	if release == nil {
+		t.Fatal("expected the last token to admit a stream")
+	}
+	release()
+	release, reason := l.acquire(a, limits)
+	if release != nil || !strings.Contains(reason, "rate limit") {
+		t.Fatalf("expected the rate limit, got %q", reason)
+	}
+	now = now.Add(time.Second)
+	if release, _ = l.acquire(a, limits); release == nil {
+		t.Fatal("expected a stream to be admitted once the bucket refills")
+	}
+	release()
+}
+
+func TestStreamLimitsFor(t *testing.T) {
+	if got := StreamLimitsFor(&config.SyncConfig{}); got != DefaultStreamLimits {
+		t.Errorf("StreamLimitsFor(empty) = %+v", got)
+	}
+	got := StreamLimitsFor(&config.SyncConfig{MaxStreams: 10, MaxPeerStreams: 2, PeerRequestRate: 5})
+	want := StreamLimits{MaxStreams: 10, MaxStreamsPerPeer: 2, RequestsPerSecond: 5, Burst: 10}
+	if got != want {
+		t.Errorf("StreamLimitsFor = %+v, want %+v", got, want)
+	}
+}
+
+func TestLimitedHandlersRejectGracefully(t *testing.T) {
+	net, err := mocknet.FullMeshLinked(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	hosts := net.Hosts()
+
+	server, err := NewSyncService(hosts[0], newTestVault(t, "a.txt", hashA, "alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Limits = StreamLimits{RequestsPerSecond: 0.001, Burst: 2}
+	client, err := NewSyncService(hosts[1], newTestVault(t, "b.txt", hashB, "bravo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := client.getRemoteManifest(ctx, hosts[0].ID()); err != nil {
+		t.Fatalf("first request should be admitted: %v", err)
+	}
+	if _, _, err := client.fetchChunk(ctx, hosts[0].ID(), hashA, ""); err != nil {
+		t.Fatalf("second request should be admitted: %v", err)
+	}
+	if _, err := client.getRemoteManifest(ctx, hosts[0].ID()); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("expected a JSON rate limit error, got %v", err)
+	}
+	if _, _, err := client.fetchChunk(ctx, hosts[0].ID(), hashA, ""); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("expected a framed rate limit error, got %v", err)
+	}
+	if _, err := client.exchangeHaves(ctx, hosts[0].ID(), &config.Manifest{}); err == nil || !strings.Contains(err.Error(), "rate limit") {
+		t.Fatalf("expected a have-list rate limit error, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package p2p
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// NewLocalSyncService creates a sync service that copies from other vaults on
+// the same machine or a mounted drive. It has no libp2p host and is only used
+// with SyncWithVault and PlanSyncWithVault.
+func NewLocalSyncService(vm *config.Manager) *SyncService {
+	return &SyncService{vaultMgr: vm}
+}
+
+// SyncWithVault copies the chunks and file manifests that the vault at
+// otherRoot has and this vault lacks, reading chunk files directly from disk
+func (s *SyncService) SyncWithVault(otherRoot string) (*SyncResult, error) {
+	startTime := time.Now()
+
+	localManifest, otherManifest, err := s.localManifests(otherRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	fetch := func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		for _, name := range []string{chunkHash, encryptedHash} {
+			if name == "" {
+				continue
+			}
+			data, err := os.ReadFile(fs.LocateChunk(otherRoot, name))
+			if err == nil {
+				return data, len(data), nil
+			}
+			if !os.IsNotExist(err) {
+				return nil, 0, err
+			}
+		}
+		return nil, 0, fmt.Errorf("chunk not found in %s", otherRoot)
+	}
+
+	result, err := s.applyManifestDiff(localManifest, otherManifest, fetch, fromSource("vault", otherRoot, ""))
+	if err != nil {
+		return nil, err
+	}
+	result.Duration = time.Since(startTime)
+	s.recordSync("vault", otherRoot, result, nil)
+	return result, nil
+}
+
+// PlanSyncWithVault reports what SyncWithVault would copy without writing anything
+func (s *SyncService) PlanSyncWithVault(otherRoot string) (*SyncPlan, error) {
+	localManifest, otherManifest, err := s.localManifests(otherRoot)
+	if err != nil {
+		return nil, err
+	}
+	return s.planManifestDiff(localManifest, otherManifest), nil
+}
+
+// localManifests loads the manifests of this vault and the vault at otherRoot
+// after checking that chunks copied between them will be readable
+func (s *SyncService) localManifests(otherRoot string) (*config.Manifest, *config.Manifest, error) {
+	if !fs.IsVaultInitialized(otherRoot) {
+		return nil, nil, fmt.Errorf("%s is not a sietch vault", otherRoot)
+	}
+	if same, err := sameDirectory(s.vaultMgr.VaultRoot(), otherRoot); err != nil {
+		return nil, nil, err
+	} else if same {
+		return nil, nil, fmt.Errorf("cannot sync a vault with itself")
+	}
+
+	otherMgr, err := config.NewManager(otherRoot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open vault at %s: %v", otherRoot, err)
+	}
+
+	localCfg, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load local vault config: %v", err)
+	}
+	otherCfg, err := otherMgr.GetConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config of vault at %s: %v", otherRoot, err)
+	}
+	if err := checkLocalCompatible(localCfg, otherCfg); err != nil {
+		return nil, nil, err
+	}
+
+	localManifest, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+	otherManifest, err := otherMgr.GetManifest()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get manifest of vault at %s: %v", otherRoot, err)
+	}
+	if otherManifest.Tombstones, err = otherMgr.Tombstones(); err != nil {
+		return nil, nil, fmt.Errorf("failed to get deletions of vault at %s: %v", otherRoot, err)
+	}
+	return localManifest, otherManifest, nil
+}
+
+// checkLocalCompatible refuses to copy chunks between vaults that encrypt them
+// differently, since the copies could not be decrypted by the receiving vault
+func checkLocalCompatible(local, other *config.VaultConfig) error {
+	if local.Encryption.Type != other.Encryption.Type {
+		return fmt.Errorf("vaults use different encryption (%s and %s)", local.Encryption.Type, other.Encryption.Type)
+	}
+	if local.Encryption.KeyHash != "" && other.Encryption.KeyHash != "" && local.Encryption.KeyHash != other.Encryption.KeyHash {
+		return fmt.Errorf("vaults use different encryption keys")
+	}
+	return nil
+}
+
+// sameDirectory reports whether a and b refer to the same directory
+func sameDirectory(a, b string) (bool, error) {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(aInfo, bInfo), nil
+}
@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+)
+
+// Hashes of the test chunks, as the default hash algorithm names them
+var (
+	hashA    = testChunkHash("alpha")
+	hashB    = testChunkHash("bravo")
+	hashC    = testChunkHash("charlie")
+	hashD    = testChunkHash("delta")
+	hashE    = testChunkHash("echo")
+	hashGone = testChunkHash("lost")
+	hashM    = testChunkHash("mike")
+	hashS    = testChunkHash("shared")
+)
+
+func testChunkHash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// newTestVault creates an unencrypted vault holding one file with one chunk
+func newTestVault(t *testing.T, fileName, chunkHash, chunkData string) *config.Manager {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".sietch", "chunks"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.VaultConfig{Name: "test", SchemaVersion: config.CurrentSchemaVersion}
+	cfg.Encryption.Type = "none"
+	if err := config.SaveVaultConfig(root, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".sietch", "chunks", chunkHash), []byte(chunkData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := &config.FileManifest{
+		FilePath:    fileName,
+		Destination: "docs/",
+		Size:        int64(len(chunkData)),
+		Chunks:      []config.ChunkRef{{Hash: chunkHash, Size: int64(len(chunkData))}},
+	}
+	if err := manifest.StoreFileManifest(root, fileName, m); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr, err := config.NewManager(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mgr
+}
+
+func TestSyncWithVault(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	other := newTestVault(t, "b.txt", hashB, "bravo")
+	s := NewLocalSyncService(local)
+
+	plan, err := s.PlanSyncWithVault(other.VaultRoot())
+	if err != nil {
+		t.Fatalf("PlanSyncWithVault failed: %v", err)
+	}
+	if len(plan.Files) != 1 || plan.Files[0] != "docs/b.txt" || plan.ChunksToTransfer != 1 || plan.BytesToTransfer != 5 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	if exists, _ := local.ChunkExists(hashB); exists {
+		t.Fatal("planning must not copy chunks")
+	}
+
+	result, err := s.SyncWithVault(other.VaultRoot())
+	if err != nil {
+		t.Fatalf("SyncWithVault failed: %v", err)
+	}
+	if result.FileCount != 1 || result.ChunksTransferred != 1 || result.BytesTransferred != 5 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	data, err := os.ReadFile(filepath.Join(local.VaultRoot(), ".sietch", "chunks", hashB))
+	if err != nil || string(data) != "bravo" {
+		t.Errorf("expected chunk hash-b to be copied, got %q (%v)", data, err)
+	}
+	m, err := local.GetManifest()
+	if err != nil || len(m.Files) != 2 {
+		t.Fatalf("expected 2 files after sync, got %+v (%v)", m, err)
+	}
+
+	// A second sync has nothing left to copy
+	again, err := s.SyncWithVault(other.VaultRoot())
+	if err != nil || again.FileCount != 0 || again.ChunksTransferred != 0 {
+		t.Errorf("expected no-op second sync, got %+v (%v)", again, err)
+	}
+
+	if _, err := s.SyncWithVault(local.VaultRoot()); err == nil {
+		t.Error("expected syncing a vault with itself to fail")
+	}
+	if _, err := s.SyncWithVault(t.TempDir()); err == nil {
+		t.Error("expected syncing with a non-vault directory to fail")
+	}
+}
+
+func TestCheckLocalCompatible(t *testing.T) {
+	a := &config.VaultConfig{}
+	a.Encryption.Type = "aes"
+	a.Encryption.KeyHash = "k1"
+	b := &config.VaultConfig{}
+	b.Encryption.Type = "aes"
+	b.Encryption.KeyHash = "k1"
+
+	if err := checkLocalCompatible(a, b); err != nil {
+		t.Errorf("expected matching vaults to be compatible: %v", err)
+	}
+	b.Encryption.KeyHash = "k2"
+	if err := checkLocalCompatible(a, b); err == nil {
+		t.Error("expected different keys to be rejected")
+	}
+	b.Encryption.Type = "none"
+	if err := checkLocalCompatible(a, b); err == nil {
+		t.Error("expected different encryption types to be rejected")
+	}
+}
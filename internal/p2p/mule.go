@@ -0,0 +1,403 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+)
+
+// MuleProtocolID lets a vault act as a mule: a store-and-forward relay that
+// holds bundles addressed to other vaults until they come to collect them.
+// The bundles are sealed and their chunks encrypted, so the mule needs no
+// vault key and learns nothing of the files it carries beyond their sizes.
+//
+// Every request is a muleRequest in JSON. A push is followed by the bundle
+// and answered with a muleResponse; a fetch is answered with a muleResponse
+// followed by the bundle.
+const MuleProtocolID = "/sietch/mule/1.0.0"
+
+const (
+	muleOpPush  = "push"
+	muleOpList  = "list"
+	muleOpFetch = "fetch"
+	muleOpDrop  = "drop"
+)
+
+// maxMuleBundleSize bounds a single bundle a mule accepts
+const maxMuleBundleSize = 1 << 36
+
+// minMuleTransferRate is the slowest transfer of a bundle tolerated before
+// the stream times out
+const minMuleTransferRate = 64 << 10
+
+type muleRequest struct {
+	Op   string `json:"op"`
+	For  string `json:"for"`            // Vault ID the bundles are addressed to
+	ID   string `json:"id,omitempty"`   // Bundle to fetch or drop
+	Size int64  `json:"size,omitempty"` // Size of the bundle following a push
+}
+
+type muleResponse struct {
+	Bundles []MuleBundle `json:"bundles,omitempty"`
+	Size    int64        `json:"size,omitempty"` // Size of the bundle following a fetch
+	Error   string       `json:"error,omitempty"`
+}
+
+// MuleBundle is a bundle a mule holds for another vault
+type MuleBundle struct {
+	ID       string    `json:"id"`  // Ordered by arrival
+	For      string    `json:"for"` // Vault ID the bundle is addressed to
+	Size     int64     `json:"size"`
+	Received time.Time `json:"received"`
+}
+
+// EnableMule makes this vault hold bundles trusted peers push to it for
+// other vaults, and hand them to trusted peers collecting them. At most
+// quota bytes of bundles are held at once; 0 means no limit.
+func (s *SyncService) EnableMule(quota int64) {
+	s.muleQuota = quota
+	s.host.SetStreamHandler(protocol.ID(MuleProtocolID), s.limited(s.handleMuleRequest, rejectJSON))
+}
+
+// muleDir is where a mule keeps the bundles it holds, one directory per
+// destination vault
+func muleDir(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "mule")
+}
+
+// MuleBundles lists the bundles this vault holds as a mule for the vault
+// forVault, or for every vault if forVault is empty, oldest first
+func (s *SyncService) MuleBundles(forVault string) ([]MuleBundle, error) {
+	dir := muleDir(s.vaultMgr.VaultRoot())
+	vaults := []string{forVault}
+	if forVault == "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		vaults = vaults[:0]
+		for _, e := range entries {
+			if e.IsDir() {
+				vaults = append(vaults, e.Name())
+			}
+		}
+	} else if !validChunkName(forVault) {
+		return nil, fmt.Errorf("invalid vault ID %q", forVault)
+	}
+
+	bundles := []MuleBundle{}
+	for _, vault := range vaults {
+		entries, err := os.ReadDir(filepath.Join(dir, vault))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, e := range entries {
+			id, ok := strings.CutSuffix(e.Name(), ".sietchbundle")
+			if !ok || !e.Type().IsRegular() {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			b := MuleBundle{ID: id, For: vault, Size: info.Size(), Received: info.ModTime()}
+			if nanos, _, ok := strings.Cut(id, "-"); ok {
+				if n, err := strconv.ParseInt(nanos, 10, 64); err == nil {
+					b.Received = time.Unix(0, n)
+				}
+			}
+			bundles = append(bundles, b)
+		}
+	}
+	slices.SortFunc(bundles, func(a, b MuleBundle) int { return strings.Compare(a.ID, b.ID) })
+	return bundles, nil
+}
+
+// muleBundlePath returns the file holding a bundle, checking that neither
+// name can escape the mule directory
+func (s *SyncService) muleBundlePath(forVault, id string) (string, error) {
+	if !validChunkName(forVault) || !validChunkName(id) {
+		return "", fmt.Errorf("invalid bundle %s/%s", forVault, id)
+	}
+	return filepath.Join(muleDir(s.vaultMgr.VaultRoot()), forVault, id+".sietchbundle"), nil
+}
+
+// storeMuleBundle writes size bytes of a bundle for forVault from r,
+// returning the bundle once it is complete
+func (s *SyncService) storeMuleBundle(forVault string, r io.Reader, size int64) (*MuleBundle, error) {
+	if size <= 0 || size > maxMuleBundleSize {
+		return nil, fmt.Errorf("bundle of %d bytes is not accepted", size)
+	}
+	if s.muleQuota > 0 {
+		held, err := s.MuleBundles("")
+		if err != nil {
+			return nil, err
+		}
+		total := size
+		for _, b := range held {
+			total += b.Size
+		}
+		if total > s.muleQuota {
+			return nil, fmt.Errorf("mule is full")
+		}
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	b := &MuleBundle{ID: fmt.Sprintf("%d-%s", now.UnixNano(), hex.EncodeToString(suffix)), For: forVault, Size: size, Received: now}
+	p, err := s.muleBundlePath(forVault, b.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".incoming-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.CopyN(tmp, r, size); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to receive bundle: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// handleMuleRequest serves the mule protocol to trusted peers
+func (s *SyncService) handleMuleRequest(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
+	dec := json.NewDecoder(stream)
+	var request muleRequest
+	if err := dec.Decode(&request); err != nil {
+		fmt.Printf("Error decoding mule request: %v\n", err)
+		return
+	}
+	send := func(resp muleResponse) bool {
+		_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+		if err := json.NewEncoder(stream).Encode(resp); err != nil {
+			fmt.Printf("Error sending mule response: %v\n", err)
+			return false
+		}
+		return true
+	}
+
+	// Holding data for others is never extended to untrusted peers
+	if s.privateKey != nil {
+		if !s.trusted(peerID) {
+			fmt.Printf("Rejecting mule request from untrusted peer: %s\n", peerID.String())
+			send(muleResponse{Error: "Unauthorized: Peer not trusted"})
+			return
+		}
+	}
+	if !validChunkName(request.For) {
+		send(muleResponse{Error: "invalid vault ID"})
+		return
+	}
+
+	switch request.Op {
+	case muleOpPush:
+		_ = stream.SetReadDeadline(time.Now().Add(s.muleTransferTimeout(request.Size)))
+		b, err := s.storeMuleBundle(request.For, muleBody(dec, stream), request.Size)
+		if err != nil {
+			send(muleResponse{Error: err.Error()})
+			return
+		}
+		fmt.Printf("📥 Holding bundle %s (%d bytes) for vault %s from %s\n", b.ID, b.Size, b.For, peerID.String())
+		s.recordAudit(audit.OpMuleReceive, map[string]string{"peer": peerID.String(), "for": b.For, "bundle": b.ID})
+		send(muleResponse{Bundles: []MuleBundle{*b}})
+
+	case muleOpList:
+		bundles, err := s.MuleBundles(request.For)
+		if err != nil {
+			send(muleResponse{Error: "Internal error listing bundles"})
+			return
+		}
+		send(muleResponse{Bundles: bundles})
+
+	case muleOpFetch:
+		p, err := s.muleBundlePath(request.For, request.ID)
+		if err != nil {
+			send(muleResponse{Error: err.Error()})
+			return
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			send(muleResponse{Error: "no such bundle"})
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			send(muleResponse{Error: "Internal error reading bundle"})
+			return
+		}
+		if !send(muleResponse{Size: info.Size()}) {
+			return
+		}
+		_ = stream.SetWriteDeadline(time.Now().Add(s.muleTransferTimeout(info.Size())))
+		if _, err := io.Copy(stream, f); err != nil {
+			fmt.Printf("Error sending bundle %s: %v\n", request.ID, err)
+		}
+
+	case muleOpDrop:
+		p, err := s.muleBundlePath(request.For, request.ID)
+		if err != nil {
+			send(muleResponse{Error: err.Error()})
+			return
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			send(muleResponse{Error: "Internal error dropping bundle"})
+			return
+		}
+		fmt.Printf("📤 Delivered bundle %s for vault %s to %s\n", request.ID, request.For, peerID.String())
+		s.recordAudit(audit.OpMuleDeliver, map[string]string{"peer": peerID.String(), "for": request.For, "bundle": request.ID})
+		send(muleResponse{})
+
+	default:
+		send(muleResponse{Error: fmt.Sprintf("unknown operation %q", request.Op)})
+	}
+}
+
+// muleBody returns the data following a JSON value dec read from r, without
+// the newline json.Encoder writes after the value
+func muleBody(dec *json.Decoder, r io.Reader) io.Reader {
+	body := bufio.NewReader(io.MultiReader(dec.Buffered(), r))
+	if next, err := body.Peek(1); err == nil && next[0] == '\n' {
+		_, _ = body.Discard(1)
+	}
+	return body
+}
+
+// muleTransferTimeout is how long transferring a bundle of size bytes may take
+func (s *SyncService) muleTransferTimeout(size int64) time.Duration {
+	return s.timeouts().Manifest + time.Duration(size/minMuleTransferRate)*time.Second
+}
+
+// muleCall sends a request to a mule, followed by body when it is not nil,
+// and decodes the response. The stream and its decoder are returned so a
+// fetched bundle can be read after the response; the caller closes the stream.
+func (s *SyncService) muleCall(ctx context.Context, peerID peer.ID, request muleRequest, body io.Reader) (*muleResponse, *json.Decoder, network.Stream, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Manifest)
+	defer cancel()
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(MuleProtocolID))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open mule stream: %w", err)
+	}
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.muleTransferTimeout(request.Size)))
+	err = json.NewEncoder(stream).Encode(request)
+	if err == nil && body != nil {
+		_, err = io.CopyN(stream, body, request.Size)
+	}
+	// A mule refusing a push answers before reading the bundle, so its
+	// answer is more telling than the failed write
+	writeErr := err
+	_ = stream.CloseWrite()
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.muleTransferTimeout(request.Size)))
+	dec := json.NewDecoder(stream)
+	var response muleResponse
+	if err := dec.Decode(&response); err != nil {
+		stream.Close()
+		if writeErr != nil {
+			return nil, nil, nil, fmt.Errorf("failed to send mule request: %w", writeErr)
+		}
+		return nil, nil, nil, fmt.Errorf("failed to decode mule response: %w", err)
+	}
+	if response.Error != "" {
+		stream.Close()
+		return nil, nil, nil, fmt.Errorf("mule error: %s", response.Error)
+	}
+	if writeErr != nil {
+		stream.Close()
+		return nil, nil, nil, fmt.Errorf("failed to send mule request: %w", writeErr)
+	}
+	return &response, dec, stream, nil
+}
+
+// PushBundle hands size bytes of a bundle read from r to the mule peerID,
+// to hold for the vault forVault
+func (s *SyncService) PushBundle(ctx context.Context, peerID peer.ID, forVault string, r io.Reader, size int64) (*MuleBundle, error) {
+	response, _, stream, err := s.muleCall(ctx, peerID, muleRequest{Op: muleOpPush, For: forVault, Size: size}, r)
+	if err != nil {
+		return nil, err
+	}
+	stream.Close()
+	if len(response.Bundles) != 1 {
+		return nil, errors.New("mule did not confirm the bundle")
+	}
+	return &response.Bundles[0], nil
+}
+
+// ListMuleBundles lists the bundles the mule peerID holds for forVault
+func (s *SyncService) ListMuleBundles(ctx context.Context, peerID peer.ID, forVault string) ([]MuleBundle, error) {
+	response, _, stream, err := s.muleCall(ctx, peerID, muleRequest{Op: muleOpList, For: forVault}, nil)
+	if err != nil {
+		return nil, err
+	}
+	stream.Close()
+	return response.Bundles, nil
+}
+
+// FetchMuleBundle copies a bundle the mule peerID holds to w. The mule keeps
+// it until DropMuleBundle is called.
+func (s *SyncService) FetchMuleBundle(ctx context.Context, peerID peer.ID, bundle MuleBundle, w io.Writer) error {
+	response, dec, stream, err := s.muleCall(ctx, peerID, muleRequest{Op: muleOpFetch, For: bundle.For, ID: bundle.ID}, nil)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if response.Size <= 0 || response.Size > maxMuleBundleSize {
+		return fmt.Errorf("mule announced a bundle of %d bytes", response.Size)
+	}
+	_ = stream.SetReadDeadline(time.Now().Add(s.muleTransferTimeout(response.Size)))
+	if _, err := io.CopyN(w, muleBody(dec, stream), response.Size); err != nil {
+		return fmt.Errorf("failed to receive bundle: %w", err)
+	}
+	return nil
+}
+
+// DropMuleBundle tells the mule peerID that a bundle was delivered and can be deleted
+func (s *SyncService) DropMuleBundle(ctx context.Context, peerID peer.ID, bundle MuleBundle) error {
+	_, _, stream, err := s.muleCall(ctx, peerID, muleRequest{Op: muleOpDrop, For: bundle.For, ID: bundle.ID}, nil)
+	if err != nil {
+		return err
+	}
+	stream.Close()
+	return nil
+}
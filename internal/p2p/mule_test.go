@@ -0,0 +1,138 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func TestMuleRelaysSealedBundles(t *testing.T) {
+	net, err := mocknet.FullMeshLinked(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	hosts := net.Hosts()
+
+	muleVault := newBundleTestVault(t, "mule", "m.txt", hashM, "mike")
+	mule, err := NewSyncService(hosts[0], muleVault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mule.EnableMule(0)
+	sender, err := NewSyncService(hosts[1], newBundleTestVault(t, "sender", "secret-plans.txt", hashA, "alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewSyncService(hosts[2], newBundleTestVault(t, "receiver", "b.txt", hashB, "bravo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{7}, 32)
+
+	have, err := receiver.HaveList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := sender.BundleContents(have, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.BundleKey = key
+	var bundle bytes.Buffer
+	if err := sender.WriteBundle(&bundle, header); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(bundle.Bytes(), []byte("secret-plans")) {
+		t.Fatal("a sealed bundle must not reveal file names")
+	}
+	if _, err := sender.PushBundle(ctx, hosts[0].ID(), "receiver", bytes.NewReader(bundle.Bytes()), int64(bundle.Len())); err != nil {
+		t.Fatalf("PushBundle failed: %v", err)
+	}
+
+	held, err := mule.MuleBundles("")
+	if err != nil || len(held) != 1 || held[0].For != "receiver" || held[0].Size != int64(bundle.Len()) {
+		t.Fatalf("expected the mule to hold the bundle, got %+v (%v)", held, err)
+	}
+	if others, err := receiver.ListMuleBundles(ctx, hosts[0].ID(), "other"); err != nil || len(others) != 0 {
+		t.Errorf("expected no bundles for another vault, got %+v (%v)", others, err)
+	}
+
+	bundles, err := receiver.ListMuleBundles(ctx, hosts[0].ID(), "receiver")
+	if err != nil || len(bundles) != 1 {
+		t.Fatalf("ListMuleBundles = %+v (%v)", bundles, err)
+	}
+	var fetched bytes.Buffer
+	if err := receiver.FetchMuleBundle(ctx, hosts[0].ID(), bundles[0], &fetched); err != nil {
+		t.Fatalf("FetchMuleBundle failed: %v", err)
+	}
+	if !bytes.Equal(fetched.Bytes(), bundle.Bytes()) {
+		t.Fatal("fetched bundle differs from the pushed one")
+	}
+
+	// The mule itself cannot open what it holds
+	if _, _, err := NewLocalSyncService(muleVault).PlanBundle(bytes.NewReader(fetched.Bytes())); err == nil || !strings.Contains(err.Error(), "sealed") {
+		t.Errorf("expected a sealed bundle to need the vault key, got %v", err)
+	}
+
+	receiver.BundleKey = key
+	_, result, err := receiver.ApplyBundle(bytes.NewReader(fetched.Bytes()), "mule")
+	if err != nil || result.FileCount != 1 {
+		t.Fatalf("ApplyBundle = %+v (%v)", result, err)
+	}
+	if err := receiver.DropMuleBundle(ctx, hosts[0].ID(), bundles[0]); err != nil {
+		t.Fatalf("DropMuleBundle failed: %v", err)
+	}
+	if held, _ := mule.MuleBundles(""); len(held) != 0 {
+		t.Errorf("expected the delivered bundle to be dropped, got %+v", held)
+	}
+}
+
+func TestMuleRejectsBadRequests(t *testing.T) {
+	ctx := context.Background()
+
+	// Mule support is off unless enabled
+	client, muleID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"))
+	if _, err := client.ListMuleBundles(ctx, muleID, "receiver"); err == nil {
+		t.Error("expected a vault not serving as a mule to refuse")
+	}
+
+	net, err := mocknet.FullMeshLinked(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	hosts := net.Hosts()
+	mule, err := NewSyncService(hosts[0], newTestVault(t, "m.txt", hashM, "mike"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mule.EnableMule(4)
+	if client, err = NewSyncService(hosts[1], newTestVault(t, "b.txt", hashB, "bravo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	muleID = hosts[0].ID()
+
+	if _, err := client.PushBundle(ctx, muleID, "../escape", strings.NewReader("data"), 4); err == nil {
+		t.Error("expected a vault ID escaping the mule directory to be rejected")
+	}
+	if _, err := client.PushBundle(ctx, muleID, "receiver", strings.NewReader("too large"), 9); err == nil {
+		t.Error("expected a bundle over the quota to be rejected")
+	}
+	if err := client.FetchMuleBundle(ctx, muleID, MuleBundle{ID: "missing", For: "receiver"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected fetching an unknown bundle to fail")
+	}
+	if held, err := mule.MuleBundles(""); err != nil || len(held) != 0 {
+		t.Errorf("expected no bundles to be held, got %+v (%v)", held, err)
+	}
+}
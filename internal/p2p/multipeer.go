@@ -0,0 +1,264 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// peerSource is one of the peers a multi-peer sync fetches chunks from
+type peerSource struct {
+	id       peer.ID
+	manifest *config.Manifest // The files the peer offers
+	chunks   map[string]bool  // Chunks the peer can send
+	latency  time.Duration    // Round trip of the manifest request
+	rate     float64          // Bytes per second of chunk fetches so far; 0 before the first
+	failures int              // Failed fetches since the last successful one
+	fetched  int              // Chunks the peer sent
+	received int64            // Bytes the peer sent
+}
+
+// cost estimates how long fetching size bytes from the peer takes. Peers that
+// have not served a chunk yet are ranked by latency alone, so each gets tried.
+func (p *peerSource) cost(size int64) time.Duration {
+	cost := p.latency
+	if p.rate > 0 {
+		cost += time.Duration(float64(size) / p.rate * float64(time.Second))
+	}
+	return cost
+}
+
+// observe folds a completed fetch into the peer's transfer rate
+func (p *peerSource) observe(size int, elapsed time.Duration) {
+	p.failures = 0
+	if elapsed <= 0 || size <= 0 {
+		return
+	}
+	rate := float64(size) / elapsed.Seconds()
+	if p.rate == 0 {
+		p.rate = rate
+	} else {
+		p.rate = 0.7*p.rate + 0.3*rate
+	}
+}
+
+// SyncWithPeers syncs with several trusted peers at once. Their manifests are
+// merged, and every missing chunk is fetched once, from whichever peer that
+// has it is currently fastest. Peers that cannot be verified or reached are
+// skipped with a warning. Like SyncWithPeer, an interrupted sync returns its
+// partial result along with the error.
+func (s *SyncService) SyncWithPeers(ctx context.Context, peerIDs []peer.ID) (*SyncResult, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Sync)
+	defer cancel()
+
+	startTime := time.Now()
+
+	localManifest, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+	sources, merged, err := s.collectManifests(timeoutCtx, peerIDs, localManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	fetch := s.withRetry(timeoutCtx, s.Retry, s.multiPeerFetcher(timeoutCtx, sources, merged))
+	result, err := s.applyManifestDiff(localManifest, merged, fetch, s.fromFirstPeer(sources))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(sources))
+	for i, src := range sources {
+		ids[i] = src.id.String()
+		result.PeerTransfers = append(result.PeerTransfers, PeerTransfer{Peer: ids[i], Chunks: src.fetched, Bytes: src.received})
+	}
+	if result.Interrupted {
+		return s.interrupted(timeoutCtx, "peers", strings.Join(ids, ","), result, startTime)
+	}
+
+	result.Duration = time.Since(startTime)
+	if s.Verbose {
+		fmt.Printf("Sync with %d peers completed in %v: %d files, %d chunks transferred, %d chunks reused\n",
+			len(sources), result.Duration, result.FileCount, result.ChunksTransferred, result.ChunksDeduplicated)
+	}
+
+	s.recordSync("peers", strings.Join(ids, ","), result, nil)
+	return result, nil
+}
+
+// PlanSyncWithPeers reports what SyncWithPeers would fetch without
+// transferring chunks or writing manifests. Each chunk is counted against the
+// peer with the lowest round trip that has it, since transfer rates are only
+// learnt during the sync.
+func (s *SyncService) PlanSyncWithPeers(ctx context.Context, peerIDs []peer.ID) (*SyncPlan, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Sync)
+	defer cancel()
+
+	localManifest, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+	sources, merged, err := s.collectManifests(timeoutCtx, peerIDs, localManifest)
+	if err != nil {
+		return nil, err
+	}
+	plan := s.planManifestDiff(localManifest, merged)
+
+	peerPlans := make(map[peer.ID]*PeerPlan, len(sources))
+	for _, src := range sources {
+		peerPlan := &PeerPlan{Peer: src.id.String()}
+		peerPlan.FilesToUpload, peerPlan.ChunksToUpload, peerPlan.BytesToUpload = uploadPlan(localManifest, src.manifest)
+		peerPlans[src.id] = peerPlan
+	}
+	sanitized, _ := sanitizeRemoteManifest(merged)
+	local, remote, _ := s.planTombstones(localManifest, sanitized)
+	for _, chunkHash := range s.findMissingChunks(local, remote) {
+		if s.holdsChunk(chunkRefFor(remote, chunkHash)) {
+			continue
+		}
+		var best *peerSource
+		for _, src := range sources {
+			if src.chunks[chunkHash] && (best == nil || src.latency < best.latency) {
+				best = src
+			}
+		}
+		if best != nil {
+			peerPlans[best.id].ChunksToDownload++
+			peerPlans[best.id].BytesToDownload += storedChunkSize(remote, chunkHash)
+		}
+	}
+	for _, src := range sources {
+		plan.Peers = append(plan.Peers, *peerPlans[src.id])
+	}
+	return plan, nil
+}
+
+// collectManifests verifies each peer and fetches its manifest, returning the
+// peers that can be synced from and the union of their files and tombstones.
+// A file offered by several peers is taken from the first of them. Each peer
+// is asked which chunks it holds; for older peers, every chunk in their
+// manifest is assumed.
+func (s *SyncService) collectManifests(ctx context.Context, peerIDs []peer.ID, local *config.Manifest) ([]*peerSource, *config.Manifest, error) {
+	merged := &config.Manifest{}
+	seen := make(map[string]bool)
+	var sources []*peerSource
+
+	for _, peerID := range peerIDs {
+		trusted, err := s.VerifyAndExchangeKeys(ctx, peerID)
+		if err != nil || !trusted {
+			fmt.Printf("Warning: skipping peer %s: not trusted (%v)\n", peerID.String(), err)
+			continue
+		}
+		if err := s.checkPeerCompatible(ctx, peerID); err != nil {
+			fmt.Printf("Warning: skipping peer %s: %v\n", peerID.String(), err)
+			continue
+		}
+
+		start := time.Now()
+		remote, err := s.getRemoteManifest(ctx, peerID)
+		if err != nil {
+			fmt.Printf("Warning: skipping peer %s: failed to get manifest: %v\n", peerID.String(), err)
+			continue
+		}
+		src := &peerSource{id: peerID, manifest: remote, chunks: chunksOf(remote), latency: time.Since(start)}
+		offered, err := s.exchangeHaves(ctx, peerID, local)
+		if err != nil {
+			fmt.Printf("Warning: have-list exchange with peer %s failed: %v\n", peerID.String(), err)
+			offered = nil
+		} else if offered != nil {
+			src.chunks = make(map[string]bool, len(offered))
+			for _, hash := range offered {
+				src.chunks[hash] = true
+			}
+		}
+		s.recordPeerManifest(peerID, remote, local, offered, true)
+		for _, file := range remote.Files {
+			if !seen[file.FilePath] {
+				seen[file.FilePath] = true
+				merged.Files = append(merged.Files, file)
+			}
+		}
+		merged.Tombstones = append(merged.Tombstones, remote.Tombstones...)
+		sources = append(sources, src)
+
+		if s.Verbose {
+			fmt.Printf("Peer %s offers %d files (%v round trip)\n", peerID.String(), len(remote.Files), src.latency)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, nil, fmt.Errorf("none of the %d peers could be synced with", len(peerIDs))
+	}
+	return sources, merged, nil
+}
+
+// fromFirstPeer returns the originFunc of a multi-peer sync: collectManifests
+// takes each file from the first peer that offers it
+func (s *SyncService) fromFirstPeer(sources []*peerSource) originFunc {
+	return func(file *config.FileManifest) config.SyncOrigin {
+		for _, src := range sources {
+			for _, offered := range src.manifest.Files {
+				if offered.FilePath == file.FilePath {
+					return s.fromPeer(src.id)(file)
+				}
+			}
+		}
+		return config.SyncOrigin{Kind: "peer"}
+	}
+}
+
+// multiPeerFetcher fetches each chunk from the cheapest peer that has it,
+// falling back to the others in order of cost when a fetch fails
+func (s *SyncService) multiPeerFetcher(ctx context.Context, sources []*peerSource, merged *config.Manifest) chunkFetcher {
+	return func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		size := storedChunkSize(merged, chunkHash)
+
+		var candidates []*peerSource
+		for _, src := range sources {
+			if src.chunks[chunkHash] {
+				candidates = append(candidates, src)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].failures != candidates[j].failures {
+				return candidates[i].failures < candidates[j].failures
+			}
+			return candidates[i].cost(size) < candidates[j].cost(size)
+		})
+
+		var errs []string
+		for _, src := range candidates {
+			start := time.Now()
+			data, n, err := s.fetchChunk(ctx, src.id, chunkHash, encryptedHash)
+			if err != nil {
+				src.failures++
+				errs = append(errs, fmt.Sprintf("%s: %v", src.id.String(), err))
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+			src.observe(len(data), time.Since(start))
+			src.fetched++
+			src.received += int64(len(data))
+			if s.Verbose {
+				fmt.Printf("Fetched chunk %s from %s\n", chunkHash, src.id.String())
+			}
+			return data, n, nil
+		}
+		if len(errs) == 0 {
+			return nil, 0, fmt.Errorf("no peer has chunk %s", chunkHash)
+		}
+		return nil, 0, fmt.Errorf("all peers failed: %s", strings.Join(errs, "; "))
+	}
+}
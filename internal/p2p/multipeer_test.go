@@ -0,0 +1,108 @@
+package p2p
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+)
+
+// addTestFile stores another single-chunk file in a vault made by newTestVault
+func addTestFile(t *testing.T, mgr *config.Manager, fileName, chunkHash, chunkData string) {
+	t.Helper()
+	root := mgr.VaultRoot()
+	if err := os.WriteFile(filepath.Join(root, ".sietch", "chunks", chunkHash), []byte(chunkData), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := &config.FileManifest{
+		FilePath:    fileName,
+		Destination: "docs/",
+		Size:        int64(len(chunkData)),
+		Chunks:      []config.ChunkRef{{Hash: chunkHash, Size: int64(len(chunkData))}},
+	}
+	if err := manifest.StoreFileManifest(root, fileName, m); err != nil {
+		t.Fatal(err)
+	}
+	mgr.RefreshIndex()
+}
+
+func TestSyncWithPeersFetchesSharedChunksOnce(t *testing.T) {
+	first := newTestVault(t, "a.txt", hashA, "alpha")
+	addTestFile(t, first, "shared.txt", hashS, "shared")
+	second := newTestVault(t, "b.txt", hashB, "bravo")
+	addTestFile(t, second, "shared.txt", hashS, "shared")
+	local := newTestVault(t, "c.txt", hashC, "charlie")
+
+	// The first peer lost its copy of the shared chunk, so it must come from the second
+	if err := os.Remove(filepath.Join(first.VaultRoot(), ".sietch", "chunks", hashS)); err != nil {
+		t.Fatal(err)
+	}
+
+	net, err := mocknet.FullMeshLinked(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	hosts := net.Hosts()
+	for i, vault := range []*config.Manager{first, second} {
+		if _, err := NewSyncService(hosts[i], vault); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client, err := NewSyncService(hosts[2], local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Retry = RetryPolicy{}
+	if err := net.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	peers := []peer.ID{hosts[0].ID(), hosts[1].ID()}
+
+	plan, err := client.PlanSyncWithPeers(context.Background(), peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 3 || plan.ChunksToTransfer != 3 {
+		t.Fatalf("expected 3 files and 3 chunks in the plan, got %+v", plan)
+	}
+	if len(plan.Peers) != 2 || plan.Peers[0].ChunksToDownload+plan.Peers[1].ChunksToDownload != 3 {
+		t.Fatalf("expected the 3 chunks to be split between both peers, got %+v", plan.Peers)
+	}
+
+	result, err := client.SyncWithPeers(context.Background(), peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FileCount != 3 || result.ChunksTransferred != 3 || len(result.FailedChunks) != 0 {
+		t.Fatalf("expected every file once, got %+v", result)
+	}
+	data, err := os.ReadFile(filepath.Join(local.VaultRoot(), ".sietch", "chunks", hashS))
+	if err != nil || string(data) != "shared" {
+		t.Errorf("expected the shared chunk from the second peer, got %q (%v)", data, err)
+	}
+	if len(result.PeerTransfers) != 2 || result.PeerTransfers[0].Chunks+result.PeerTransfers[1].Chunks != 3 {
+		t.Errorf("expected the 3 chunks fetched to be credited to the peers, got %+v", result.PeerTransfers)
+	}
+}
+
+func TestPeerSourceCost(t *testing.T) {
+	fast := &peerSource{latency: 10 * time.Millisecond}
+	slow := &peerSource{latency: time.Millisecond}
+	fast.observe(1<<20, 10*time.Millisecond)   // 100MB/s
+	slow.observe(1<<20, 1000*time.Millisecond) // 1MB/s
+
+	if fast.cost(1<<20) >= slow.cost(1<<20) {
+		t.Errorf("expected the higher throughput peer to be cheaper for a 1MB chunk: %v vs %v", fast.cost(1<<20), slow.cost(1<<20))
+	}
+	if untried := (&peerSource{latency: 5 * time.Millisecond}); untried.cost(1<<20) >= slow.cost(1<<20) {
+		t.Error("expected a peer that has not been tried to rank ahead of a slow one")
+	}
+}
@@ -5,19 +5,21 @@ import (
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/multiformats/go-multiaddr"
+
+	"github.com/substantialcattle5/sietch/internal/config"
 )
 
 // CreateLibp2pHost creates a new libp2p host listening on the specified port.
-// If port is 0, the system will choose an available port.
-func CreateLibp2pHost(port int) (host.Host, error) {
+// If port is 0, the system will choose an available port. Extra options, such
+// as the ones from NetworkKeyOption and ListenOption, are applied after the
+// defaults.
+func CreateLibp2pHost(port int, extra ...libp2p.Option) (host.Host, error) {
 	if port < 0 || port > 65535 {
 		return nil, fmt.Errorf("invalid port: %d (must be 0-65535)", port)
 	}
 
-	opts := []libp2p.Option{
-		libp2p.DefaultSecurity,
-		libp2p.DefaultTransports,
-	}
+	opts := []libp2p.Option{libp2p.DefaultSecurity}
 
 	// Configure listening addresses
 	listenAddrs := []string{}
@@ -32,6 +34,37 @@ func CreateLibp2pHost(port int) (host.Host, error) {
 	}
 
 	opts = append(opts, libp2p.ListenAddrStrings(listenAddrs...))
+	for _, opt := range extra {
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+	}
 
 	return libp2p.New(opts...)
 }
+
+// ListenOption returns the libp2p option that makes a host listen on exactly
+// addrs, replacing the listen addresses of the options before it. A single
+// config.NoListenAddrs makes a client-only host, which dials peers but accepts
+// no connections. It returns nil when addrs is empty.
+func ListenOption(addrs []string) (libp2p.Option, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	if len(addrs) == 1 && addrs[0] == config.NoListenAddrs {
+		return libp2p.NoListenAddrs, nil
+	}
+
+	maddrs := make([]multiaddr.Multiaddr, 0, len(addrs))
+	for _, addr := range addrs {
+		maddr, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %v", addr, err)
+		}
+		maddrs = append(maddrs, maddr)
+	}
+	return func(cfg *libp2p.Config) error {
+		cfg.ListenAddrs = maddrs
+		return nil
+	}, nil
+}
@@ -0,0 +1,53 @@
+package p2p
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestListenOption(t *testing.T) {
+	if opt, err := ListenOption(nil); opt != nil || err != nil {
+		t.Errorf("ListenOption(nil) = %v, %v; want nil, nil", opt, err)
+	}
+	if _, err := ListenOption([]string{"127.0.0.1:4001"}); err == nil {
+		t.Error("expected an error for an invalid multiaddr")
+	}
+
+	opt, err := ListenOption([]string{"/ip4/127.0.0.1/tcp/0"})
+	if err != nil {
+		t.Fatalf("ListenOption failed: %v", err)
+	}
+	h, err := CreateLibp2pHost(0, opt)
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	defer h.Close()
+	if len(h.Addrs()) == 0 {
+		t.Fatal("expected the host to listen")
+	}
+	for _, addr := range h.Addrs() {
+		if !strings.HasPrefix(addr.String(), "/ip4/127.0.0.1/tcp/") {
+			t.Errorf("host listens on %s, want only /ip4/127.0.0.1/tcp", addr)
+		}
+	}
+
+	opt, err = ListenOption([]string{config.NoListenAddrs})
+	if err != nil {
+		t.Fatalf("ListenOption failed: %v", err)
+	}
+	client, err := CreateLibp2pHost(0, opt)
+	if err != nil {
+		t.Fatalf("failed to create client-only host: %v", err)
+	}
+	defer client.Close()
+	if addrs := client.Addrs(); len(addrs) != 0 {
+		t.Errorf("client-only host listens on %v", addrs)
+	}
+	if err := client.Connect(t.Context(), peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}); err != nil {
+		t.Errorf("client-only host failed to dial out: %v", err)
+	}
+}
@@ -0,0 +1,400 @@
+package p2p
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/multiformats/go-multiaddr"
+)
+
+// PairProtocolID is the protocol a peer holding an invitation pairs over
+const PairProtocolID = "/sietch/pair/1.0.0"
+
+// DefaultInvitationTTL is how long an invitation can be accepted
+const DefaultInvitationTTL = 10 * time.Minute
+
+// invitationPrefix starts every invitation token
+const invitationPrefix = "sietch-invite1:"
+
+// Invitation is a one-time offer to pair with this vault. Its token carries
+// the node's peer ID, addresses and a random secret, signed with the vault's
+// sync key. The first peer to present the secret before the invitation
+// expires is trusted without a prompt, and trusts this vault in return.
+type Invitation struct {
+	PeerID  peer.ID
+	Addrs   []multiaddr.Multiaddr
+	Name    string
+	Expires time.Time
+
+	secret   []byte
+	token    string
+	used     bool
+	accepted chan peer.ID
+}
+
+// invitationPayload is the signed part of an invitation token
+type invitationPayload struct {
+	PeerID  string   `json:"peer"`
+	Addrs   []string `json:"addrs"`
+	Name    string   `json:"name,omitempty"`
+	Secret  []byte   `json:"secret"`
+	Expires int64    `json:"exp"`
+}
+
+// pairMessage is sent each way over the pair protocol. Proof is an HMAC of
+// the sender's key and both peer IDs under the invitation secret.
+type pairMessage struct {
+	PublicKey string `json:"public_key,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Proof     []byte `json:"proof,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Invite creates an invitation valid for ttl that this service accepts until
+// it is used or expires
+func (s *SyncService) Invite(ttl time.Duration) (*Invitation, error) {
+	if s.privateKey == nil {
+		return nil, fmt.Errorf("pairing needs the vault's sync keys")
+	}
+	if len(s.host.Addrs()) == 0 {
+		return nil, fmt.Errorf("pairing needs a node that accepts connections")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate invitation secret: %w", err)
+	}
+	inv := &Invitation{
+		PeerID:   s.host.ID(),
+		Addrs:    s.host.Addrs(),
+		Expires:  time.Now().Add(ttl).Truncate(time.Second),
+		secret:   secret,
+		accepted: make(chan peer.ID, 1),
+	}
+	if s.vaultConfig != nil {
+		inv.Name = s.vaultConfig.Name
+	}
+
+	payload := invitationPayload{PeerID: inv.PeerID.String(), Name: inv.Name, Secret: secret, Expires: inv.Expires.Unix()}
+	for _, addr := range inv.Addrs {
+		payload.Addrs = append(payload.Addrs, addr.String())
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode invitation: %w", err)
+	}
+	digest := sha256.Sum256(data)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign invitation: %w", err)
+	}
+	inv.token = invitationPrefix + base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	s.pairMu.Lock()
+	s.invitations = append(s.invitations, inv)
+	s.pairMu.Unlock()
+	return inv, nil
+}
+
+// Token returns the invitation token to give to the peer
+func (inv *Invitation) Token() string {
+	return inv.token
+}
+
+// Wait blocks until a peer accepts the invitation, it expires or ctx is done
+func (inv *Invitation) Wait(ctx context.Context) (peer.ID, error) {
+	timer := time.NewTimer(time.Until(inv.Expires))
+	defer timer.Stop()
+	select {
+	case id := <-inv.accepted:
+		return id, nil
+	case <-timer.C:
+		return "", fmt.Errorf("invitation expired without being accepted")
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// ParseInvitation decodes an invitation token. Its signature can only be
+// checked once connected to the inviting peer, by AcceptInvitation.
+func ParseInvitation(token string) (*Invitation, error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(token), invitationPrefix)
+	if !ok {
+		return nil, fmt.Errorf("not a sietch invitation token")
+	}
+	payloadPart, sigPart, ok := strings.Cut(encoded, ".")
+	if !ok {
+		return nil, fmt.Errorf("invitation token is not signed")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return nil, fmt.Errorf("malformed invitation token: %w", err)
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(sigPart); err != nil {
+		return nil, fmt.Errorf("malformed invitation signature: %w", err)
+	}
+
+	var payload invitationPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("malformed invitation token: %w", err)
+	}
+	id, err := peer.Decode(payload.PeerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer ID in invitation: %w", err)
+	}
+	if len(payload.Secret) == 0 {
+		return nil, fmt.Errorf("invitation has no secret")
+	}
+	inv := &Invitation{
+		PeerID:  id,
+		Name:    payload.Name,
+		Expires: time.Unix(payload.Expires, 0),
+		secret:  payload.Secret,
+		token:   strings.TrimSpace(token),
+	}
+	for _, a := range payload.Addrs {
+		addr, err := multiaddr.NewMultiaddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address in invitation: %w", err)
+		}
+		inv.Addrs = append(inv.Addrs, addr)
+	}
+	if len(inv.Addrs) == 0 {
+		return nil, fmt.Errorf("invitation has no addresses")
+	}
+	return inv, nil
+}
+
+// verifySignature checks the token was signed by pub
+func (inv *Invitation) verifySignature(pub *rsa.PublicKey) error {
+	payloadPart, sigPart, _ := strings.Cut(strings.TrimPrefix(inv.token, invitationPrefix), ".")
+	data, _ := base64.RawURLEncoding.DecodeString(payloadPart)
+	signature, _ := base64.RawURLEncoding.DecodeString(sigPart)
+	digest := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("invitation signature does not match the peer's key")
+	}
+	return nil
+}
+
+// AcceptInvitation connects to the peer that issued the invitation, proves we
+// hold its secret and checks its proof in return. Both vaults then trust each
+// other. It returns the ID of the now trusted peer.
+func (s *SyncService) AcceptInvitation(ctx context.Context, inv *Invitation) (peer.ID, error) {
+	if s.privateKey == nil {
+		return "", fmt.Errorf("pairing needs the vault's sync keys")
+	}
+	if time.Now().After(inv.Expires) {
+		return "", fmt.Errorf("invitation expired at %s", inv.Expires.Format(time.RFC3339))
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Handshake)
+	defer cancel()
+	if err := s.host.Connect(timeoutCtx, peer.AddrInfo{ID: inv.PeerID, Addrs: inv.Addrs}); err != nil {
+		return "", fmt.Errorf("failed to connect to inviting peer: %w", err)
+	}
+	peerKey, err := s.peerIdentityKey(inv.PeerID)
+	if err != nil {
+		return "", err
+	}
+	if err := inv.verifySignature(peerKey); err != nil {
+		return "", err
+	}
+
+	stream, err := s.host.NewStream(timeoutCtx, inv.PeerID, protocol.ID(PairProtocolID))
+	if err != nil {
+		return "", fmt.Errorf("failed to open pair stream: %w", err)
+	}
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(s.timeouts().Handshake))
+
+	ourPEM, err := publicKeyPEM(s.publicKey)
+	if err != nil {
+		return "", err
+	}
+	request := pairMessage{
+		PublicKey: ourPEM,
+		Name:      s.vaultConfig.Name,
+		Proof:     pairProof(inv.secret, "accept", s.host.ID(), inv.PeerID, ourPEM),
+	}
+	if err := json.NewEncoder(stream).Encode(request); err != nil {
+		return "", fmt.Errorf("failed to send pair request: %w", err)
+	}
+
+	var response pairMessage
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to read pair response: %w", err)
+	}
+	if response.Error != "" {
+		return "", fmt.Errorf("remote error: %s", response.Error)
+	}
+	if !hmac.Equal(response.Proof, pairProof(inv.secret, "invite", inv.PeerID, s.host.ID(), response.PublicKey)) {
+		return "", fmt.Errorf("peer did not prove it issued the invitation")
+	}
+	if err := s.trustPairedPeer(inv.PeerID, response.PublicKey, response.Name); err != nil {
+		return "", err
+	}
+	return inv.PeerID, nil
+}
+
+// handlePairRequest trusts a peer presenting the secret of a pending
+// invitation and answers with our own proof
+func (s *SyncService) handlePairRequest(stream network.Stream) {
+	defer stream.Close()
+	_ = stream.SetDeadline(time.Now().Add(s.timeouts().Handshake))
+	peerID := stream.Conn().RemotePeer()
+
+	reply := func(msg pairMessage) {
+		if err := json.NewEncoder(stream).Encode(msg); err != nil {
+			fmt.Printf("Error sending pair response: %v\n", err)
+		}
+	}
+
+	var request pairMessage
+	if err := json.NewDecoder(stream).Decode(&request); err != nil {
+		fmt.Printf("Error reading pair request: %v\n", err)
+		return
+	}
+
+	inv := s.claimInvitation(peerID, request)
+	if inv == nil {
+		fmt.Printf("Rejecting pair request from peer %s: no matching invitation\n", peerID.String())
+		reply(pairMessage{Error: "Unauthorized: invalid, used or expired invitation"})
+		return
+	}
+	if err := s.trustPairedPeer(peerID, request.PublicKey, request.Name); err != nil {
+		fmt.Printf("Error trusting paired peer %s: %v\n", peerID.String(), err)
+		reply(pairMessage{Error: "Internal error trusting peer"})
+		return
+	}
+
+	ourPEM, err := publicKeyPEM(s.publicKey)
+	if err != nil {
+		reply(pairMessage{Error: "Internal error"})
+		return
+	}
+	reply(pairMessage{
+		PublicKey: ourPEM,
+		Name:      inv.Name,
+		Proof:     pairProof(inv.secret, "invite", s.host.ID(), peerID, ourPEM),
+	})
+	// Wait for the peer to read the reply before the inviting command exits
+	_ = stream.CloseWrite()
+	_, _ = io.Copy(io.Discard, stream)
+	inv.accepted <- peerID
+}
+
+// claimInvitation returns the pending invitation whose secret proves request
+// from peerID, marking it used, or nil if there is none
+func (s *SyncService) claimInvitation(peerID peer.ID, request pairMessage) *Invitation {
+	s.pairMu.Lock()
+	defer s.pairMu.Unlock()
+
+	now := time.Now()
+	var claimed *Invitation
+	pending := s.invitations[:0]
+	for _, inv := range s.invitations {
+		if inv.used || now.After(inv.Expires) {
+			continue
+		}
+		if claimed == nil && hmac.Equal(request.Proof, pairProof(inv.secret, "accept", peerID, s.host.ID(), request.PublicKey)) {
+			inv.used = true
+			claimed = inv
+			continue
+		}
+		pending = append(pending, inv)
+	}
+	s.invitations = pending
+	return claimed
+}
+
+// trustPairedPeer saves peerID as a trusted peer with the given key, which
+// must be the key of its libp2p identity
+func (s *SyncService) trustPairedPeer(peerID peer.ID, keyPEM, name string) error {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return fmt.Errorf("peer sent no public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse peer's public key: %w", err)
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("peer's key is not an RSA public key")
+	}
+	identityKey, err := s.peerIdentityKey(peerID)
+	if err != nil {
+		return err
+	}
+	if !rsaKey.Equal(identityKey) {
+		return fmt.Errorf("peer's sync key does not match its peer ID")
+	}
+
+	hash := sha256.Sum256(block.Bytes)
+	fingerprint := base64.StdEncoding.EncodeToString(hash[:])
+	if err := s.checkPinnedKey(peerID, rsaKey, fingerprint); err != nil {
+		return err
+	}
+	s.trustedPeers[peerID] = &PeerInfo{
+		ID:           peerID,
+		PublicKey:    rsaKey,
+		Fingerprint:  fingerprint,
+		Name:         name,
+		TrustedSince: time.Now(),
+	}
+	return s.AddTrustedPeer(context.Background(), peerID)
+}
+
+// peerIdentityKey returns the RSA key behind the libp2p identity of a
+// connected peer. Sync nodes use their vault's sync key as their identity.
+func (s *SyncService) peerIdentityKey(peerID peer.ID) (*rsa.PublicKey, error) {
+	pk := s.host.Peerstore().PubKey(peerID)
+	if pk == nil {
+		return nil, fmt.Errorf("no identity key known for peer %s", peerID.String())
+	}
+	std, err := libp2pcrypto.PubKeyToStdKey(pk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity key of peer %s: %w", peerID.String(), err)
+	}
+	rsaKey, ok := std.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("peer %s does not use an RSA sync key as its identity", peerID.String())
+	}
+	return rsaKey, nil
+}
+
+// pairProof binds a pair message to the invitation secret, the role of the
+// sender, both peer IDs and the sender's key
+func pairProof(secret []byte, role string, from, to peer.ID, keyPEM string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	for _, part := range []string{"sietch-pair", role, from.String(), to.String(), keyPEM} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return mac.Sum(nil)
+}
+
+func publicKeyPEM(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
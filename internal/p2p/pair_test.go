@@ -0,0 +1,188 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	libp2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multiaddr"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// newPairingPeers starts two secure sync services whose hosts use their sync
+// keys as identities, as sync nodes do, linked but not connected
+func newPairingPeers(t *testing.T) (inviter, accepter *SyncService) {
+	t.Helper()
+	net := mocknet.New()
+	t.Cleanup(func() { net.Close() })
+
+	services := make([]*SyncService, 2)
+	for i := range services {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identity, _, err := libp2pcrypto.KeyPairFromStdKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, _ := multiaddr.NewMultiaddr(fmt.Sprintf("/ip4/10.0.0.%d/tcp/4001", i+1))
+		h, err := net.AddPeer(identity, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vault := newTestVault(t, "a.txt", hashA, "alpha")
+		services[i], err = NewSecureSyncService(h, vault, key, &key.PublicKey, &config.RSAConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := net.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	return services[0], services[1]
+}
+
+func savedTrustedPeers(t *testing.T, s *SyncService) []config.TrustedPeer {
+	t.Helper()
+	cfg, err := config.LoadVaultConfig(s.vaultMgr.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sync.RSA == nil {
+		return nil
+	}
+	return cfg.Sync.RSA.TrustedPeers
+}
+
+func TestPairing(t *testing.T) {
+	inviter, accepter := newPairingPeers(t)
+	ctx := context.Background()
+
+	invitation, err := inviter.Invite(time.Minute)
+	if err != nil {
+		t.Fatalf("Invite failed: %v", err)
+	}
+	inv, err := ParseInvitation(invitation.Token())
+	if err != nil {
+		t.Fatalf("ParseInvitation failed: %v", err)
+	}
+	if inv.PeerID != inviter.host.ID() || len(inv.Addrs) == 0 || inv.Name != "test" {
+		t.Errorf("parsed invitation = %+v", inv)
+	}
+
+	peerID, err := accepter.AcceptInvitation(ctx, inv)
+	if err != nil {
+		t.Fatalf("AcceptInvitation failed: %v", err)
+	}
+	if peerID != inviter.host.ID() {
+		t.Errorf("paired with %s, want %s", peerID, inviter.host.ID())
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if got, err := invitation.Wait(waitCtx); err != nil || got != accepter.host.ID() {
+		t.Errorf("Wait = %s, %v; want %s", got, err, accepter.host.ID())
+	}
+
+	for _, tc := range []struct {
+		s    *SyncService
+		want string
+	}{{inviter, accepter.host.ID().String()}, {accepter, inviter.host.ID().String()}} {
+		trusted := savedTrustedPeers(t, tc.s)
+		if len(trusted) != 1 || trusted[0].ID != tc.want || trusted[0].PublicKey == "" || trusted[0].Fingerprint == "" {
+			t.Errorf("trusted peers of %s = %+v, want %s", tc.s.host.ID(), trusted, tc.want)
+		}
+	}
+
+	if _, err := accepter.AcceptInvitation(ctx, inv); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("expected a used invitation to be rejected, got %v", err)
+	}
+}
+
+func TestPairingRejectsWrongSecret(t *testing.T) {
+	inviter, accepter := newPairingPeers(t)
+
+	invitation, err := inviter.Invite(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := ParseInvitation(invitation.Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.secret = make([]byte, 32)
+
+	if _, err := accepter.AcceptInvitation(context.Background(), inv); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("expected a wrong secret to be rejected, got %v", err)
+	}
+	if trusted := savedTrustedPeers(t, inviter); len(trusted) != 0 {
+		t.Errorf("inviter trusted %+v after a failed pairing", trusted)
+	}
+}
+
+func TestPairingRejectsExpiredInvitation(t *testing.T) {
+	inviter, accepter := newPairingPeers(t)
+
+	invitation, err := inviter.Invite(-time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := ParseInvitation(invitation.Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accepter.AcceptInvitation(context.Background(), inv); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected an expired invitation to be refused, got %v", err)
+	}
+
+	// The inviter refuses it too, whatever the token claims
+	inv.Expires = time.Now().Add(time.Minute)
+	if _, err := accepter.AcceptInvitation(context.Background(), inv); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("expected the inviter to reject an expired invitation, got %v", err)
+	}
+}
+
+func TestPairingRejectsForgedToken(t *testing.T) {
+	inviter, accepter := newPairingPeers(t)
+
+	invitation, err := inviter.Invite(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Swap the inviter's signature for one made with another key
+	other, _ := newPairingPeers(t)
+	forged, err := other.Invite(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _, _ := strings.Cut(invitation.Token(), ".")
+	_, signature, _ := strings.Cut(forged.Token(), ".")
+	inv, err := ParseInvitation(payload + "." + signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accepter.AcceptInvitation(context.Background(), inv); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("expected a forged signature to be rejected, got %v", err)
+	}
+}
+
+func TestParseInvitationErrors(t *testing.T) {
+	for _, token := range []string{
+		"",
+		"not-a-token",
+		invitationPrefix + "e30",
+		invitationPrefix + "!!!.AAAA",
+		invitationPrefix + "e30.AAAA",
+	} {
+		if _, err := ParseInvitation(token); err == nil {
+			t.Errorf("ParseInvitation(%q) should fail", token)
+		}
+	}
+}
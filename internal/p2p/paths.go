@@ -0,0 +1,144 @@
+package p2p
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Manifests received from a peer are kept only if their paths stay inside
+// the vault. Vault paths are relative and use forward slashes; a peer is
+// free to send anything, so a path that is absolute, climbs out with "..",
+// or uses separators another platform would honour is rejected, as is a
+// chunk hash that is not a plain file name in the chunk store and a symlink
+// whose target is absolute or climbs out of the vault. Metadata a restore
+// would apply is neutralized rather than trusted: hard links to paths that
+// are not normalized are dropped, so the file is restored as a copy, modes
+// keep only their permission bits and only user.* extended attributes are
+// kept.
+
+// normalizeVaultPath returns the canonical destination and file name of the
+// vault path destination+fileName: the destination is empty or a directory
+// ending in "/", "." and empty elements are dropped and ".." is resolved
+func normalizeVaultPath(destination, fileName string) (string, string, error) {
+	if fileName == "" {
+		return "", "", fmt.Errorf("no file name")
+	}
+	full := fileName
+	if destination != "" {
+		full = strings.TrimSuffix(destination, "/") + "/" + fileName
+	}
+	switch {
+	case strings.ContainsRune(full, 0):
+		return "", "", fmt.Errorf("path contains a NUL byte")
+	case strings.ContainsRune(full, '\\'):
+		return "", "", fmt.Errorf("path contains a backslash")
+	case strings.HasPrefix(full, "/") || hasVolumeName(full):
+		return "", "", fmt.Errorf("path is absolute")
+	}
+
+	cleaned := path.Clean(full)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", "", fmt.Errorf("path leaves the vault")
+	}
+	dir, name := path.Split(cleaned)
+	return dir, name, nil
+}
+
+// hasVolumeName reports whether p starts with a Windows drive letter such as C:
+func hasVolumeName(p string) bool {
+	if len(p) < 2 || p[1] != ':' {
+		return false
+	}
+	c := p[0] | 0x20
+	return c >= 'a' && c <= 'z'
+}
+
+// checkChunkNames returns an error for the first chunk whose hashes are not
+// valid chunk names
+func checkChunkNames(chunks []config.ChunkRef) error {
+	for _, chunk := range chunks {
+		if !validChunkName(chunk.Hash) {
+			return fmt.Errorf("invalid chunk hash %q", chunk.Hash)
+		}
+		if chunk.EncryptedHash != "" && !validChunkName(chunk.EncryptedHash) {
+			return fmt.Errorf("invalid encrypted chunk hash %q", chunk.EncryptedHash)
+		}
+	}
+	return nil
+}
+
+// checkSymlinkTarget returns an error for a symlink target that is absolute
+// or leads out of the vault from dir, the normalized directory of the link
+func checkSymlinkTarget(dir, target string) error {
+	switch {
+	case strings.ContainsRune(target, 0):
+		return fmt.Errorf("symlink target contains a NUL byte")
+	case strings.ContainsRune(target, '\\'):
+		return fmt.Errorf("symlink target contains a backslash")
+	case strings.HasPrefix(target, "/") || hasVolumeName(target):
+		return fmt.Errorf("symlink target is absolute")
+	}
+	if cleaned := path.Clean(dir + target); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("symlink target leaves the vault")
+	}
+	return nil
+}
+
+// neutralizeMetadata drops the metadata of a remote file that a restore
+// could be tricked by: a hard link to a path that is not normalized, mode
+// bits beyond the permissions and extended attributes outside user.*
+func neutralizeMetadata(file *config.FileManifest) {
+	if file.HardLink != "" {
+		if dir, name, err := normalizeVaultPath("", file.HardLink); err != nil || dir+name != file.HardLink {
+			file.HardLink = ""
+		}
+	}
+	file.Mode &= 0o777
+	if len(file.Xattrs) > 0 {
+		kept := make(map[string]string, len(file.Xattrs))
+		for name, value := range file.Xattrs {
+			if strings.HasPrefix(name, "user.") {
+				kept[name] = value
+			}
+		}
+		file.Xattrs = kept
+	}
+}
+
+// sanitizeRemoteManifest returns a copy of m holding only the files and
+// tombstones whose paths, chunk hashes and symlink targets are safe, with
+// their paths normalized and their metadata neutralized, along with the
+// paths it dropped and why
+func sanitizeRemoteManifest(m *config.Manifest) (*config.Manifest, []string) {
+	sanitized := &config.Manifest{}
+	var rejected []string
+	for _, file := range m.Files {
+		dir, name, err := normalizeVaultPath(file.Destination, file.FilePath)
+		if err == nil {
+			err = checkChunkNames(file.Chunks)
+		}
+		if err == nil && file.Symlink != "" {
+			err = checkSymlinkTarget(dir, file.Symlink)
+		}
+		if err != nil {
+			rejected = append(rejected, fmt.Sprintf("%q: %v", file.Destination+file.FilePath, err))
+			continue
+		}
+		file.Destination, file.FilePath = dir, name
+		neutralizeMetadata(&file)
+		sanitized.Files = append(sanitized.Files, file)
+	}
+	for _, tombstone := range m.Tombstones {
+		dir, name, err := normalizeVaultPath(tombstone.Destination, tombstone.FilePath)
+		if err != nil {
+			rejected = append(rejected, fmt.Sprintf("%q (deleted): %v", tombstone.Destination+tombstone.FilePath, err))
+			continue
+		}
+		tombstone.Destination, tombstone.FilePath = dir, name
+		sanitized.Tombstones = append(sanitized.Tombstones, tombstone)
+	}
+	return sanitized, rejected
+}
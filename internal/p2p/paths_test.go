@@ -0,0 +1,148 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestNormalizeVaultPath(t *testing.T) {
+	tests := []struct {
+		destination, fileName string
+		wantDir, wantName     string
+	}{
+		{"", "a.txt", "", "a.txt"},
+		{"docs/", "a.txt", "docs/", "a.txt"},
+		{"docs", "a.txt", "docs/", "a.txt"},
+		{"./docs//notes/", "a.txt", "docs/notes/", "a.txt"},
+		{"docs/../misc/", "a.txt", "misc/", "a.txt"},
+		{"docs/", "notes/a.txt", "docs/notes/", "a.txt"},
+	}
+	for _, tt := range tests {
+		dir, name, err := normalizeVaultPath(tt.destination, tt.fileName)
+		if err != nil || dir != tt.wantDir || name != tt.wantName {
+			t.Errorf("normalizeVaultPath(%q, %q) = %q, %q, %v, want %q, %q", tt.destination, tt.fileName, dir, name, err, tt.wantDir, tt.wantName)
+		}
+	}
+
+	for _, hostile := range [][2]string{
+		{"", ""},
+		{"docs/", ""},
+		{"/etc/", "passwd"},
+		{"", "/etc/passwd"},
+		{"../../", "evil.sh"},
+		{"docs/../../", "evil.sh"},
+		{"docs/", "../../evil.sh"},
+		{"", ".."},
+		{"docs/", ".."},
+		{"..\\..\\", "evil.bat"},
+		{"C:/Windows/", "evil.dll"},
+		{"docs/", "a\x00.txt"},
+	} {
+		if dir, name, err := normalizeVaultPath(hostile[0], hostile[1]); err == nil {
+			t.Errorf("normalizeVaultPath(%q, %q) = %q, %q, want an error", hostile[0], hostile[1], dir, name)
+		}
+	}
+}
+
+func TestSyncIgnoresHostileManifests(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	s := NewLocalSyncService(local)
+	localManifest, err := local.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := []config.ChunkRef{{Hash: hashB, Size: 5}}
+	remote := &config.Manifest{
+		Files: []config.FileManifest{
+			{FilePath: "ok.txt", Destination: "./notes//", Chunks: chunk},
+			{FilePath: "passwd", Destination: "/etc/", Chunks: chunk},
+			{FilePath: "evil.sh", Destination: "docs/../../", Chunks: chunk},
+			{FilePath: "../evil.sh", Destination: "", Chunks: chunk},
+			{FilePath: "chunk.txt", Destination: "docs/", Chunks: []config.ChunkRef{{Hash: "../../escape", Size: 5}}},
+		},
+		Tombstones: []config.Tombstone{{FilePath: "a.txt", Destination: "../docs/"}},
+	}
+	var fetched []string
+	fetch := func(chunkHash, _ string) ([]byte, int, error) {
+		fetched = append(fetched, chunkHash)
+		return []byte("bravo"), 5, nil
+	}
+
+	plan := s.planManifestDiff(localManifest, remote)
+	if len(plan.Files) != 1 || plan.Files[0] != "notes/ok.txt" || len(plan.Rejected) != 5 || len(plan.Deletions) != 0 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	result, err := s.applyManifestDiff(localManifest, remote, fetch, fromSource("vault", "other", ""))
+	if err != nil {
+		t.Fatalf("applyManifestDiff failed: %v", err)
+	}
+	if result.FileCount != 1 || len(result.RejectedFiles) != 5 || len(result.FilesDeleted) != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(fetched) != 1 || fetched[0] != hashB {
+		t.Errorf("expected only the chunk of the safe file to be fetched, got %v", fetched)
+	}
+
+	m, err := local.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]bool{}
+	for _, file := range m.Files {
+		paths[file.Destination+file.FilePath] = true
+	}
+	if len(paths) != 2 || !paths["docs/a.txt"] || !paths["notes/ok.txt"] {
+		t.Errorf("expected docs/a.txt and notes/ok.txt, got %v", paths)
+	}
+	root := filepath.Dir(local.VaultRoot())
+	for _, escaped := range []string{"escape", "evil.sh", filepath.Join("etc", "passwd")} {
+		if _, err := os.Stat(filepath.Join(root, escaped)); err == nil {
+			t.Errorf("sync wrote %s outside the vault", escaped)
+		}
+	}
+}
+
+func TestSanitizeRemoteManifestLinksAndMetadata(t *testing.T) {
+	chunk := []config.ChunkRef{{Hash: hashB, Size: 5}}
+	remote := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "ok", Destination: "docs/", Symlink: "../notes/a.txt"},
+		{FilePath: "passwd", Destination: "docs/", Symlink: "/etc/passwd"},
+		{FilePath: "up", Destination: "docs/", Symlink: "../../outside"},
+		{FilePath: "win", Destination: "docs/", Symlink: "..\\..\\outside"},
+		{FilePath: "drive", Destination: "docs/", Symlink: "C:/Windows"},
+		{FilePath: "copy.txt", Destination: "docs/", Chunks: chunk, HardLink: "docs/../../etc/shadow"},
+		{FilePath: "link.txt", Destination: "docs/", Chunks: chunk, HardLink: "docs/a.txt"},
+		{FilePath: "suid", Destination: "bin/", Chunks: chunk, Mode: 0o4755,
+			Xattrs: map[string]string{"user.comment": "aGk=", "security.capability": "AQID", "trusted.x": "eA=="}},
+	}}
+
+	sanitized, rejected := sanitizeRemoteManifest(remote)
+	if len(rejected) != 4 {
+		t.Errorf("expected 4 hostile symlinks rejected, got %v", rejected)
+	}
+	files := map[string]config.FileManifest{}
+	for _, file := range sanitized.Files {
+		files[file.Destination+file.FilePath] = file
+	}
+	if len(files) != 4 || files["docs/ok"].Symlink != "../notes/a.txt" {
+		t.Fatalf("unexpected files %+v", files)
+	}
+	if files["docs/copy.txt"].HardLink != "" || files["docs/link.txt"].HardLink != "docs/a.txt" {
+		t.Errorf("expected only the normalized hard link kept, got %q and %q", files["docs/copy.txt"].HardLink, files["docs/link.txt"].HardLink)
+	}
+	suid := files["bin/suid"]
+	if suid.Mode != 0o755 {
+		t.Errorf("expected setuid dropped from the mode, got %o", suid.Mode)
+	}
+	if len(suid.Xattrs) != 1 || suid.Xattrs["user.comment"] != "aGk=" {
+		t.Errorf("expected only user.* xattrs kept, got %v", suid.Xattrs)
+	}
+	if len(remote.Files[7].Xattrs) != 3 {
+		t.Error("sanitizing changed the remote manifest")
+	}
+}
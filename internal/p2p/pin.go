@@ -0,0 +1,64 @@
+package p2p
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/audit"
+)
+
+// Trusted peers are pinned to the key they were first trusted with. A pinned
+// peer presenting another key is refused until the user accepts the new key
+// with 'sietch peers repin', so a changed key never silently re-pairs. The
+// key presented is kept with the peer so that repin can show and accept it.
+
+// ErrPinnedKeyChanged is returned when a trusted peer presents a key other
+// than the one pinned for it
+var ErrPinnedKeyChanged = errors.New("peer key does not match its pinned key")
+
+// checkPinnedKey refuses key, with the given fingerprint, for peerID if the
+// peer is pinned to another key, recording the key presented for repinning
+func (s *SyncService) checkPinnedKey(peerID peer.ID, key *rsa.PublicKey, fingerprint string) error {
+	pinned := s.rsaConfig.TrustedPeer(peerID.String())
+	if pinned == nil || pinned.Fingerprint == "" || pinned.Fingerprint == fingerprint {
+		return nil
+	}
+
+	label := peerID.String()
+	if pinned.Name != "" {
+		label = fmt.Sprintf("%s (%s)", pinned.Name, peerID.String())
+	}
+	banner := strings.Repeat("@", 64)
+	fmt.Printf("%s\n@  WARNING: THE KEY OF TRUSTED PEER %s HAS CHANGED\n%s\n", banner, label, banner)
+	fmt.Printf("Pinned fingerprint:    %s\nPresented fingerprint: %s\n", pinned.Fingerprint, fingerprint)
+	fmt.Println("Someone may be impersonating the peer, or it may have new keys.")
+	fmt.Printf("Syncs with it are refused until you verify the new fingerprint with the\npeer and run 'sietch peers repin %s'.\n", peerID.String())
+
+	if pinned.PendingFingerprint != fingerprint {
+		keyPEM, err := publicKeyPEM(key)
+		if err != nil {
+			return err
+		}
+		pinned.PendingPublicKey = keyPEM
+		pinned.PendingFingerprint = fingerprint
+		pinned.KeyChangedAt = time.Now()
+		if s.vaultConfig != nil {
+			s.vaultConfig.Sync.RSA = s.rsaConfig
+			if err := s.vaultMgr.SaveConfig(s.vaultConfig); err != nil {
+				fmt.Printf("Warning: failed to record the changed key: %v\n", err)
+			}
+		}
+		s.recordAudit(audit.OpTrust, map[string]string{
+			"action":      "key-changed",
+			"peer":        peerID.String(),
+			"fingerprint": fingerprint,
+			"pinned":      pinned.Fingerprint,
+		})
+	}
+	return fmt.Errorf("%w: peer %s presented %s, pinned %s", ErrPinnedKeyChanged, peerID.String(), fingerprint, pinned.Fingerprint)
+}
@@ -0,0 +1,62 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestPinnedKeyChangeIsRefused(t *testing.T) {
+	server, client := newPairingPeers(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+	if err := client.host.Connect(ctx, peer.AddrInfo{ID: serverID, Addrs: server.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both vaults pinned each other to keys the other no longer has
+	server.rsaConfig.TrustedPeers = []config.TrustedPeer{{ID: clientID.String(), Fingerprint: "old-client-key"}}
+	client.rsaConfig.TrustedPeers = []config.TrustedPeer{{ID: serverID.String(), Name: "laptop", Fingerprint: "old-server-key"}}
+
+	_, err := client.VerifyAndExchangeKeys(ctx, serverID)
+	if err == nil {
+		t.Fatal("expected the key exchange to be refused")
+	}
+	if _, ok := server.trustedPeers[clientID]; ok {
+		t.Error("the server must not trust a peer presenting a changed key")
+	}
+
+	// The client refuses the server's key in turn once the server accepts
+	server.rsaConfig.TrustedPeers = nil
+	_, err = client.VerifyAndExchangeKeys(ctx, serverID)
+	if !errors.Is(err, ErrPinnedKeyChanged) {
+		t.Fatalf("expected ErrPinnedKeyChanged, got %v", err)
+	}
+	if _, ok := client.trustedPeers[serverID]; ok {
+		t.Error("the client must not trust a peer presenting a changed key")
+	}
+
+	saved := savedTrustedPeers(t, client)
+	if len(saved) != 1 || !saved[0].KeyChanged() || saved[0].Fingerprint != "old-server-key" {
+		t.Fatalf("expected the new key to be recorded next to the pinned one, got %+v", saved)
+	}
+	if err := saved[0].Repin("not-the-new-key"); err == nil {
+		t.Error("expected repin to refuse an unexpected fingerprint")
+	}
+	if err := saved[0].Repin(saved[0].PendingFingerprint); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once repinned, the peer is trusted again
+	client.rsaConfig.TrustedPeers = saved
+	if trusted, err := client.VerifyAndExchangeKeys(ctx, serverID); err != nil || !trusted {
+		t.Fatalf("VerifyAndExchangeKeys after repin = %v, %v", trusted, err)
+	}
+	if err := saved[0].Repin(""); err == nil {
+		t.Error("expected repin without a key change to fail")
+	}
+}
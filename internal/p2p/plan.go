@@ -0,0 +1,73 @@
+package p2p
+
+import (
+	"slices"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// PeerPlan is the part of a sync plan that involves one peer. Uploads are
+// what the peer would fetch from this vault when it next syncs from it,
+// estimated from the files and chunks the peer lists.
+type PeerPlan struct {
+	Peer             string
+	ChunksToDownload int
+	BytesToDownload  int64
+	FilesToUpload    int
+	ChunksToUpload   int
+	BytesToUpload    int64
+}
+
+// HasChanges reports whether carrying out the plan would change the vault
+func (p *SyncPlan) HasChanges() bool {
+	return len(p.Files) > 0 || len(p.Deletions) > 0 || p.ChunksToTransfer > 0
+}
+
+// conflictingFiles returns the remote files that local also has, at the same
+// path, with different content. Sync keeps the local version of these.
+func conflictingFiles(local, remote *config.Manifest) []string {
+	var conflicts []string
+	for _, remoteFile := range remote.Files {
+		for _, localFile := range local.Files {
+			if localFile.FilePath != remoteFile.FilePath {
+				continue
+			}
+			if !sameFileContent(&localFile, &remoteFile) {
+				conflicts = append(conflicts, remoteFile.Destination+remoteFile.FilePath)
+			}
+			break
+		}
+	}
+	return conflicts
+}
+
+// sameFileContent compares two manifests of a file by content hash, or by
+// their chunks when either lacks one
+func sameFileContent(a, b *config.FileManifest) bool {
+	if a.ContentHash != "" && b.ContentHash != "" {
+		return a.ContentHash == b.ContentHash
+	}
+	return slices.EqualFunc(a.Chunks, b.Chunks, func(x, y config.ChunkRef) bool {
+		return x.Hash == y.Hash
+	})
+}
+
+// uploadPlan estimates what a peer listing remote would fetch from local: the
+// local files it neither lists nor has deleted, and the chunks of those files
+// it does not reference under either name
+func uploadPlan(local, remote *config.Manifest) (files, chunks int, bytes int64) {
+	missing, _ := withoutDeleted(newRemoteFiles(remote, local), remote.Tombstones)
+	remoteChunks := localHaveSet(remote)
+	seen := make(map[string]bool)
+	for _, file := range missing {
+		for _, chunk := range file.Chunks {
+			if seen[chunk.Hash] || remoteChunks.contains(chunk.Hash) || remoteChunks.contains(chunk.EncryptedHash) {
+				continue
+			}
+			seen[chunk.Hash] = true
+			chunks++
+			bytes += storedChunkSize(local, chunk.Hash)
+		}
+	}
+	return len(missing), chunks, bytes
+}
@@ -0,0 +1,70 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestConflictingFiles(t *testing.T) {
+	local := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "same.txt", Destination: "docs/", ContentHash: "c1"},
+		{FilePath: "edited.txt", Destination: "docs/", ContentHash: "c2"},
+		{FilePath: "chunks.txt", Destination: "docs/", Chunks: []config.ChunkRef{{Hash: "h1"}}},
+	}}
+	remote := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "same.txt", Destination: "docs/", ContentHash: "c1"},
+		{FilePath: "edited.txt", Destination: "docs/", ContentHash: "c3"},
+		{FilePath: "chunks.txt", Destination: "docs/", Chunks: []config.ChunkRef{{Hash: "h2"}}},
+		{FilePath: "new.txt", Destination: "docs/"},
+	}}
+	got := conflictingFiles(local, remote)
+	if len(got) != 2 || got[0] != "docs/edited.txt" || got[1] != "docs/chunks.txt" {
+		t.Fatalf("conflictingFiles = %v", got)
+	}
+}
+
+func TestUploadPlan(t *testing.T) {
+	local := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "shared.txt", Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}}},
+		{FilePath: "mine.txt", Chunks: []config.ChunkRef{{Hash: "h1", Size: 10}, {Hash: "h2", Size: 20}, {Hash: "h3", Size: 5, EncryptedHash: "e3"}}},
+		{FilePath: "gone.txt", Chunks: []config.ChunkRef{{Hash: "h4", Size: 40}}},
+	}}
+	remote := &config.Manifest{
+		Files:      []config.FileManifest{{FilePath: "shared.txt", Chunks: []config.ChunkRef{{Hash: "h1"}}}, {FilePath: "other.txt", Chunks: []config.ChunkRef{{Hash: "x", EncryptedHash: "e3"}}}},
+		Tombstones: []config.Tombstone{{FilePath: "gone.txt"}},
+	}
+
+	files, chunks, bytes := uploadPlan(local, remote)
+	if files != 1 || chunks != 1 || bytes != 20 {
+		t.Fatalf("uploadPlan = %d files, %d chunks, %d bytes; want 1, 1, 20", files, chunks, bytes)
+	}
+}
+
+func TestSyncPlanHasChanges(t *testing.T) {
+	if (&SyncPlan{Conflicts: []string{"docs/a.txt"}, ChunksDeduplicated: 2}).HasChanges() {
+		t.Error("conflicts and local chunks alone change nothing")
+	}
+	for _, plan := range []*SyncPlan{{Files: []string{"a"}}, {Deletions: []string{"a"}}, {ChunksToTransfer: 1}} {
+		if !plan.HasChanges() {
+			t.Errorf("expected %+v to change the vault", plan)
+		}
+	}
+}
+
+func TestPlanSyncWithPeer(t *testing.T) {
+	client, serverID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"))
+
+	plan, err := client.PlanSyncWithPeer(context.Background(), serverID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.HasChanges() || len(plan.Files) != 1 || plan.Files[0] != "docs/a.txt" || len(plan.Peers) != 1 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	want := PeerPlan{Peer: serverID.String(), ChunksToDownload: 1, BytesToDownload: 5, FilesToUpload: 1, ChunksToUpload: 1, BytesToUpload: 5}
+	if plan.Peers[0] != want {
+		t.Fatalf("peer plan = %+v, want %+v", plan.Peers[0], want)
+	}
+}
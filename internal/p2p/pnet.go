@@ -0,0 +1,85 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/pnet"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// DefaultNetworkKeyPath is where a generated swarm key is stored, relative to
+// the vault root
+var DefaultNetworkKeyPath = filepath.Join(".sietch", "sync", "swarm.key")
+
+// GenerateNetworkKey writes a new random 256-bit swarm key to path in the
+// libp2p v1 key file format, readable only by the owner
+func GenerateNetworkKey(path string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate network key: %v", err)
+	}
+	data := "/key/swarm/psk/1.0.0/\n/base16/\n" + hex.EncodeToString(key) + "\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create key directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		return fmt.Errorf("failed to write network key: %v", err)
+	}
+	return nil
+}
+
+// LoadNetworkKey reads a swarm key file
+func LoadNetworkKey(path string) (pnet.PSK, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network key: %v", err)
+	}
+	psk, err := pnet.DecodeV1PSK(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid network key %s: %v", path, err)
+	}
+	return psk, nil
+}
+
+// NetworkKeyFingerprint returns a short digest of a swarm key, so nodes can
+// check they hold the same key without showing it
+func NetworkKeyFingerprint(psk pnet.PSK) string {
+	sum := sha256.Sum256(psk)
+	return hex.EncodeToString(sum[:8])
+}
+
+// NetworkKeyPath returns the absolute path of the vault's swarm key, or ""
+// when sync.network_key is not set
+func NetworkKeyPath(vaultRoot string, cfg *config.SyncConfig) string {
+	if cfg.NetworkKey == "" {
+		return ""
+	}
+	if filepath.IsAbs(cfg.NetworkKey) {
+		return cfg.NetworkKey
+	}
+	return filepath.Join(vaultRoot, cfg.NetworkKey)
+}
+
+// NetworkKeyOption returns the libp2p option that makes a host join the
+// private network of the vault's swarm key. Hosts in a private network only
+// connect to peers holding the same key; the peer trust checks still apply
+// on top. It returns nil when no key is configured.
+func NetworkKeyOption(vaultRoot string, cfg *config.SyncConfig) (libp2p.Option, error) {
+	path := NetworkKeyPath(vaultRoot, cfg)
+	if path == "" {
+		return nil, nil
+	}
+	psk, err := LoadNetworkKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return libp2p.PrivateNetwork(psk), nil
+}
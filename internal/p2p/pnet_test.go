@@ -0,0 +1,115 @@
+package p2p
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestNetworkKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultNetworkKeyPath)
+	if err := GenerateNetworkKey(path); err != nil {
+		t.Fatalf("GenerateNetworkKey failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("key file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	psk, err := LoadNetworkKey(path)
+	if err != nil {
+		t.Fatalf("LoadNetworkKey failed: %v", err)
+	}
+	if len(psk) != 32 {
+		t.Errorf("key length = %d, want 32", len(psk))
+	}
+	again, _ := LoadNetworkKey(path)
+	if NetworkKeyFingerprint(psk) != NetworkKeyFingerprint(again) {
+		t.Error("fingerprints of the same key differ")
+	}
+
+	other := filepath.Join(dir, "other.key")
+	if err := GenerateNetworkKey(other); err != nil {
+		t.Fatalf("GenerateNetworkKey failed: %v", err)
+	}
+	otherPSK, _ := LoadNetworkKey(other)
+	if NetworkKeyFingerprint(psk) == NetworkKeyFingerprint(otherPSK) {
+		t.Error("fingerprints of different keys are equal")
+	}
+
+	bad := filepath.Join(dir, "bad.key")
+	if err := os.WriteFile(bad, []byte("not a key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadNetworkKey(bad); err == nil {
+		t.Error("expected an error for an invalid key file")
+	}
+
+	if opt, err := NetworkKeyOption(dir, &config.SyncConfig{}); opt != nil || err != nil {
+		t.Errorf("NetworkKeyOption without a key = %v, %v; want nil, nil", opt, err)
+	}
+	if _, err := NetworkKeyOption(dir, &config.SyncConfig{NetworkKey: "missing.key"}); err == nil {
+		t.Error("expected an error for a missing key file")
+	}
+	if got := NetworkKeyPath(dir, &config.SyncConfig{NetworkKey: DefaultNetworkKeyPath}); got != path {
+		t.Errorf("NetworkKeyPath = %q, want %q", got, path)
+	}
+	if got := NetworkKeyPath(dir, &config.SyncConfig{NetworkKey: other}); got != other {
+		t.Errorf("NetworkKeyPath of an absolute path = %q, want %q", got, other)
+	}
+}
+
+func TestPrivateNetworkConnections(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateNetworkKey(filepath.Join(dir, "a.key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateNetworkKey(filepath.Join(dir, "b.key")); err != nil {
+		t.Fatal(err)
+	}
+
+	newHost := func(keyFile string) host.Host {
+		opts := []libp2p.Option{libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0")}
+		if keyFile != "" {
+			opt, err := NetworkKeyOption(dir, &config.SyncConfig{NetworkKey: keyFile})
+			if err != nil {
+				t.Fatalf("NetworkKeyOption failed: %v", err)
+			}
+			opts = append(opts, opt)
+		}
+		h, err := libp2p.New(opts...)
+		if err != nil {
+			t.Fatalf("failed to create host: %v", err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	connect := func(a, b host.Host) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()})
+	}
+
+	server := newHost("a.key")
+	if err := connect(newHost("a.key"), server); err != nil {
+		t.Errorf("hosts with the same network key failed to connect: %v", err)
+	}
+	if err := connect(newHost("b.key"), server); err == nil {
+		t.Error("host with a different network key connected")
+	}
+	if err := connect(newHost(""), server); err == nil {
+		t.Error("host without a network key connected")
+	}
+}
@@ -0,0 +1,283 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// ProofProtocolID challenges a peer to prove it still holds chunks. The
+// dialing peer sends a random nonce and the chunks to prove; the other side
+// answers, for each chunk, with the SHA-256 of the chunk as stored followed by
+// the nonce, or an empty proof if it does not hold the chunk. A fresh nonce
+// per challenge means a peer cannot answer from proofs it kept instead of
+// the chunks.
+const ProofProtocolID = "/sietch/proof/1.0.0"
+
+// maxProofChunks bounds the chunks one challenge may ask a peer to prove, so
+// that hashing them fits in the chunk timeout
+const maxProofChunks = 64
+
+// proofNonceSize is the size of the nonce of a challenge
+const proofNonceSize = 32
+
+// proofRequest is a storage challenge
+type proofRequest struct {
+	Nonce  string         `json:"nonce"` // Hex encoded
+	Chunks []proofChunkID `json:"chunks"`
+}
+
+// proofChunkID names a chunk to prove by both its names
+type proofChunkID struct {
+	Hash          string `json:"hash"`
+	EncryptedHash string `json:"encrypted_hash,omitempty"`
+}
+
+// proofResponse answers a storage challenge with one proof per chunk asked
+type proofResponse struct {
+	Proofs []string `json:"proofs,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// storageProof returns the proof that data is held: the hex SHA-256 of data
+// followed by nonce
+func storageProof(data, nonce []byte) string {
+	h := sha256.New()
+	h.Write(data)
+	h.Write(nonce)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handleProofRequest answers a storage challenge for the chunks of the files
+// the peer may see
+func (s *SyncService) handleProofRequest(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+	respond := func(response proofResponse) {
+		_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Chunk))
+		if err := json.NewEncoder(stream).Encode(response); err != nil {
+			fmt.Printf("Error sending storage proofs: %v\n", err)
+		}
+	}
+
+	if s.privateKey != nil {
+		if !s.trusted(peerID) {
+			fmt.Printf("Rejecting storage challenge from untrusted peer: %s\n", peerID.String())
+			respond(proofResponse{Error: "Unauthorized: Peer not trusted"})
+			return
+		}
+		if !s.peerAuthenticated(peerID) {
+			fmt.Printf("Rejecting storage challenge from unauthenticated peer: %s\n", peerID.String())
+			respond(proofResponse{Error: errNotAuthenticated})
+			return
+		}
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Chunk))
+	var request proofRequest
+	if err := json.NewDecoder(stream).Decode(&request); err != nil {
+		fmt.Printf("Error reading storage challenge: %v\n", err)
+		return
+	}
+	nonce, err := hex.DecodeString(request.Nonce)
+	switch {
+	case err != nil || len(nonce) < proofNonceSize/2:
+		respond(proofResponse{Error: "Invalid challenge nonce"})
+		return
+	case len(request.Chunks) > maxProofChunks:
+		respond(proofResponse{Error: fmt.Sprintf("Challenge of %d chunks exceeds the limit of %d", len(request.Chunks), maxProofChunks)})
+		return
+	}
+
+	var files []config.FileManifest
+	rules := s.accessRules(peerID)
+	if len(rules) > 0 {
+		manifest, err := s.vaultMgr.GetManifest()
+		if err != nil {
+			respond(proofResponse{Error: "Internal error getting manifest"})
+			return
+		}
+		files = manifest.Files
+	}
+
+	proofs := make([]string, len(request.Chunks))
+	for i, id := range request.Chunks {
+		// Names are looked up in the chunk store, so one such as
+		// ../keys/secret.key would be proven from outside it
+		if !validChunkName(id.Hash) || (id.EncryptedHash != "" && !validChunkName(id.EncryptedHash)) {
+			continue
+		}
+		// Chunks of files the peer may not see are never proven, like they are never sent
+		if len(rules) > 0 && !chunkSharedWithPeer(rules, files, id.Hash, id.EncryptedHash) {
+			continue
+		}
+		if data, err := s.readStoredChunk(id.Hash, id.EncryptedHash); err == nil {
+			proofs[i] = storageProof(data, nonce)
+		}
+	}
+	respond(proofResponse{Proofs: proofs})
+}
+
+// challengeStorage asks peerID to prove it holds chunks, at most
+// maxProofChunks of them, and returns the nonce of the challenge and the
+// proofs in the order of chunks
+func (s *SyncService) challengeStorage(ctx context.Context, peerID peer.ID, chunks []config.ChunkRef) ([]byte, []string, error) {
+	nonce := make([]byte, proofNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate challenge nonce: %w", err)
+	}
+	request := proofRequest{Nonce: hex.EncodeToString(nonce)}
+	for _, ref := range chunks {
+		request.Chunks = append(request.Chunks, proofChunkID{Hash: ref.Hash, EncryptedHash: ref.EncryptedHash})
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Chunk)
+	defer cancel()
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(ProofProtocolID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open storage challenge stream: %w", err)
+	}
+	defer stream.Close()
+	defer resetOnCancel(timeoutCtx, stream)()
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Chunk))
+	if err := json.NewEncoder(stream).Encode(request); err != nil {
+		return nil, nil, fmt.Errorf("failed to send storage challenge: %w", err)
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Chunk))
+	var response proofResponse
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		return nil, nil, fmt.Errorf("failed to read storage proofs: %w", err)
+	}
+	if response.Error != "" {
+		return nil, nil, fmt.Errorf("remote error: %s", response.Error)
+	}
+	if len(response.Proofs) != len(chunks) {
+		return nil, nil, fmt.Errorf("peer sent %d proofs for %d chunks", len(response.Proofs), len(chunks))
+	}
+	return nonce, response.Proofs, nil
+}
+
+// StorageCheck is the outcome of challenging a peer to prove it holds a
+// sample of the chunks its manifest references
+type StorageCheck struct {
+	Peer         string   `json:"peer" yaml:"peer"`
+	Referenced   int      `json:"referenced" yaml:"referenced"`     // Chunks the peer's manifest references
+	Unverifiable int      `json:"unverifiable" yaml:"unverifiable"` // Referenced chunks this vault does not hold, so cannot check
+	Checked      int      `json:"checked" yaml:"checked"`
+	Held         int      `json:"held" yaml:"held"`
+	Missing      []string `json:"missing" yaml:"missing"` // Chunks the peer does not hold
+	Corrupt      []string `json:"corrupt" yaml:"corrupt"` // Chunks the peer holds with other content
+}
+
+// Healthy reports whether the peer proved it holds every chunk checked
+func (c *StorageCheck) Healthy() bool {
+	return len(c.Missing) == 0 && len(c.Corrupt) == 0
+}
+
+// CheckPeerStorage challenges peerID to prove it still holds up to sample of
+// the chunks its manifest references, chosen at random among those this
+// vault holds too and so can check. A sample of zero or less checks all of
+// them.
+func (s *SyncService) CheckPeerStorage(ctx context.Context, peerID peer.ID, sample int) (*StorageCheck, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Sync)
+	defer cancel()
+
+	trusted, err := s.VerifyAndExchangeKeys(timeoutCtx, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	if !trusted {
+		return nil, fmt.Errorf("peer %s is not trusted", peerID.String())
+	}
+	caps, err := s.PeerCapabilities(timeoutCtx, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if !caps.Supports(ProofProtocolID) {
+		return nil, fmt.Errorf("peer %s runs a release without storage challenges", peerID.String())
+	}
+
+	remote, _, _, err := s.getRemoteManifestSince(timeoutCtx, peerID, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote manifest: %w", err)
+	}
+
+	check := &StorageCheck{Peer: peerID.String(), Missing: []string{}, Corrupt: []string{}}
+	seen := make(map[string]bool)
+	var candidates []config.ChunkRef
+	for _, file := range remote.Files {
+		for _, ref := range file.Chunks {
+			if ref.Hash == "" || seen[ref.Hash] {
+				continue
+			}
+			seen[ref.Hash] = true
+			check.Referenced++
+			// The peer's manifest names the chunks, which must not lead the
+			// local lookup outside the chunk store
+			if !validChunkName(ref.Hash) || (ref.EncryptedHash != "" && !validChunkName(ref.EncryptedHash)) {
+				check.Unverifiable++
+				continue
+			}
+			if _, err := s.readStoredChunk(ref.Hash, ref.EncryptedHash); err != nil {
+				check.Unverifiable++
+				continue
+			}
+			candidates = append(candidates, ref)
+		}
+	}
+	if sample > 0 && len(candidates) > sample {
+		mrand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		candidates = candidates[:sample]
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Hash < candidates[j].Hash })
+
+	var held []string
+	defer func() {
+		// What the peer proved it holds, or not, is what it is known to hold
+		s.updateReplicas(func(r *ReplicaMap) {
+			r.record(peerID.String(), held, false)
+			r.forget(peerID.String(), check.Missing)
+			r.forget(peerID.String(), check.Corrupt)
+		})
+	}()
+	for start := 0; start < len(candidates); start += maxProofChunks {
+		batch := candidates[start:min(start+maxProofChunks, len(candidates))]
+		nonce, proofs, err := s.challengeStorage(timeoutCtx, peerID, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, ref := range batch {
+			check.Checked++
+			data, err := s.readStoredChunk(ref.Hash, ref.EncryptedHash)
+			switch {
+			case proofs[i] == "":
+				check.Missing = append(check.Missing, ref.Hash)
+			case err != nil:
+				// Removed here while the peer answered; nothing to compare with
+				check.Checked--
+				check.Unverifiable++
+			case proofs[i] != storageProof(data, nonce):
+				check.Corrupt = append(check.Corrupt, ref.Hash)
+			default:
+				check.Held++
+				held = append(held, ref.Hash)
+			}
+		}
+	}
+	return check, nil
+}
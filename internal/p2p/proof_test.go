@@ -0,0 +1,130 @@
+package p2p
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestCheckPeerStorage(t *testing.T) {
+	server := newTestVault(t, "a.txt", hashA, "alpha")
+	addTestFile(t, server, "b.txt", hashB, "bravo")
+	addTestFile(t, server, "c.txt", hashC, "charlie")
+	addTestFile(t, server, "d.txt", hashD, "delta")
+	addTestFile(t, server, "e.txt", hashE, "echo")
+	if err := os.Remove(filepath.Join(server.VaultRoot(), ".sietch", "chunks", hashC)); err != nil {
+		t.Fatal(err)
+	}
+	client, serverID := newPeerPair(t, server)
+
+	// The client holds hash-b already; hash-d differs and hash-e it lacks
+	chunks := filepath.Join(client.vaultMgr.VaultRoot(), ".sietch", "chunks")
+	for name, data := range map[string]string{hashA: "alpha", hashC: "charlie", hashD: "tampered"} {
+		if err := os.WriteFile(filepath.Join(chunks, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check, err := client.CheckPeerStorage(context.Background(), serverID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &StorageCheck{
+		Peer:         serverID.String(),
+		Referenced:   5,
+		Unverifiable: 1,
+		Checked:      4,
+		Held:         2,
+		Missing:      []string{hashC},
+		Corrupt:      []string{hashD},
+	}
+	if !reflect.DeepEqual(check, want) {
+		t.Errorf("unexpected check\ngot  %+v\nwant %+v", check, want)
+	}
+	if check.Healthy() {
+		t.Error("expected a peer missing chunks to be unhealthy")
+	}
+
+	sampled, err := client.CheckPeerStorage(context.Background(), serverID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampled.Checked != 2 || sampled.Referenced != 5 {
+		t.Errorf("expected 2 of 5 chunks to be checked, got %+v", sampled)
+	}
+}
+
+func TestStorageProofDependsOnNonce(t *testing.T) {
+	data := []byte("chunk")
+	if storageProof(data, []byte("nonce-1")) == storageProof(data, []byte("nonce-2")) {
+		t.Error("expected proofs under different nonces to differ")
+	}
+	if storageProof(data, []byte("nonce-1")) != storageProof([]byte("chunk"), []byte("nonce-1")) {
+		t.Error("expected proofs of the same data and nonce to match")
+	}
+}
+
+func TestCheckPeerStorageWithOlderPeer(t *testing.T) {
+	client, serverID := newPeerPair(t, newTestVault(t, "a.txt", hashA, "alpha"), ProofProtocolID)
+
+	if _, err := client.CheckPeerStorage(context.Background(), serverID, 0); err == nil {
+		t.Error("expected an error for a peer without storage challenges")
+	}
+}
+
+func TestStorageChallengeRejectsTraversal(t *testing.T) {
+	server := newTestVault(t, "a.txt", hashA, "alpha")
+	keys := filepath.Join(server.VaultRoot(), ".sietch", "keys")
+	if err := os.MkdirAll(keys, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(keys, "secret.key"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client, serverID := newPeerPair(t, server)
+
+	chunks := []config.ChunkRef{{Hash: "../keys/secret.key"}, {Hash: hashA, EncryptedHash: "../keys/secret.key"}, {Hash: hashA}}
+	nonce, proofs, err := client.challengeStorage(context.Background(), serverID, chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proofs[0] != "" || proofs[1] != "" {
+		t.Errorf("expected no proofs for names outside the chunk store, got %q", proofs[:2])
+	}
+	if proofs[2] != storageProof([]byte("alpha"), nonce) {
+		t.Errorf("expected a proof of %s, got %q", hashA, proofs[2])
+	}
+}
+
+func TestCheckPeerStorageSkipsTraversal(t *testing.T) {
+	server := newTestVault(t, "a.txt", hashA, "alpha")
+	if err := os.MkdirAll(filepath.Join(server.VaultRoot(), ".sietch", "keys"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	addTestFile(t, server, "secret.txt", "../keys/secret.key", "secret")
+	client, serverID := newPeerPair(t, server)
+
+	// The client holds hash-a and a key the peer's manifest points at
+	root := filepath.Join(client.vaultMgr.VaultRoot(), ".sietch")
+	if err := os.WriteFile(filepath.Join(root, "chunks", hashA), []byte("alpha"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "keys"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "keys", "secret.key"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	check, err := client.CheckPeerStorage(context.Background(), serverID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Referenced != 2 || check.Unverifiable != 1 || check.Checked != 1 || check.Held != 1 {
+		t.Errorf("expected the chunk named outside the chunk store to be unverifiable, got %+v", check)
+	}
+}
@@ -0,0 +1,57 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// maxProvenance bounds how many syncs a file manifest remembers; the oldest
+// entries are dropped first
+const maxProvenance = 16
+
+// originFunc returns where a sync copies file from. applyManifestDiff fills
+// in the session and time.
+type originFunc func(file *config.FileManifest) config.SyncOrigin
+
+// fromSource returns the originFunc of a sync whose files all come from one source
+func fromSource(kind, source, name string) originFunc {
+	return func(*config.FileManifest) config.SyncOrigin {
+		return config.SyncOrigin{Kind: kind, Source: source, Name: name}
+	}
+}
+
+// fromPeer returns the originFunc of a sync with peerID
+func (s *SyncService) fromPeer(peerID peer.ID) originFunc {
+	return fromSource("peer", peerID.String(), s.peerName(peerID))
+}
+
+// peerName returns the name a trusted peer was paired under, or ""
+func (s *SyncService) peerName(peerID peer.ID) string {
+	if info, ok := s.trustedPeers[peerID]; ok && info != nil {
+		return info.Name
+	}
+	return ""
+}
+
+// newSyncSession returns a random ID for one sync
+func newSyncSession() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// stampOrigin records in file that the sync session copied it here from origin
+func stampOrigin(file *config.FileManifest, origin config.SyncOrigin, session string, now time.Time) {
+	origin.Session, origin.SyncedAt = session, now
+	provenance := append(append([]config.SyncOrigin(nil), file.Provenance...), origin)
+	if len(provenance) > maxProvenance {
+		provenance = provenance[len(provenance)-maxProvenance:]
+	}
+	file.Provenance = provenance
+	file.LastSynced = now
+}
@@ -0,0 +1,73 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestSyncRecordsProvenance(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	other := newTestVault(t, "b.txt", hashB, "bravo")
+	s := NewLocalSyncService(local)
+
+	before := time.Now().UTC().Add(-time.Second)
+	result, err := s.SyncWithVault(other.VaultRoot())
+	if err != nil {
+		t.Fatalf("SyncWithVault failed: %v", err)
+	}
+	if result.Session == "" {
+		t.Fatal("expected the sync to have a session ID")
+	}
+
+	m, err := local.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range m.Files {
+		origin := file.Origin()
+		switch file.FilePath {
+		case "a.txt":
+			if origin != nil {
+				t.Errorf("expected the local file to have no origin, got %+v", origin)
+			}
+		case "b.txt":
+			if origin == nil || origin.Kind != "vault" || origin.Source != other.VaultRoot() || origin.Session != result.Session {
+				t.Fatalf("unexpected origin %+v of a synced file", origin)
+			}
+			if origin.SyncedAt.Before(before) || !file.LastSynced.Equal(origin.SyncedAt) {
+				t.Errorf("unexpected sync times %v, last synced %v", origin.SyncedAt, file.LastSynced)
+			}
+		}
+	}
+
+	// A third vault syncing from this one keeps the earlier hop
+	third := newTestVault(t, "c.txt", hashC, "charlie")
+	if _, err := NewLocalSyncService(third).SyncWithVault(local.VaultRoot()); err != nil {
+		t.Fatal(err)
+	}
+	m, err = third.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range m.Files {
+		if file.FilePath == "b.txt" && (len(file.Provenance) != 2 || file.Origin().Source != local.VaultRoot()) {
+			t.Errorf("expected two hops ending at this vault, got %+v", file.Provenance)
+		}
+	}
+}
+
+func TestStampOriginKeepsRecentHops(t *testing.T) {
+	file := &config.FileManifest{FilePath: "a.txt"}
+	now := time.Now().UTC()
+	for i := 0; i < maxProvenance+3; i++ {
+		stampOrigin(file, config.SyncOrigin{Kind: "peer", Source: string(rune('a' + i))}, "session", now)
+	}
+	if len(file.Provenance) != maxProvenance {
+		t.Fatalf("expected %d hops, got %d", maxProvenance, len(file.Provenance))
+	}
+	if file.Provenance[0].Source != string(rune('a'+3)) || file.Origin().Source != string(rune('a'+maxProvenance+2)) {
+		t.Errorf("expected the oldest hops dropped, got %+v", file.Provenance)
+	}
+}
@@ -0,0 +1,535 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/lock"
+)
+
+// ReplicateProtocolID asks a peer to hold copies of files. The dialing peer
+// sends the vault paths of the files; the other side fetches them from it
+// like a sync limited to those files would, and answers with the files it
+// holds afterwards. Only vaults that enable it with EnableReplicas accept.
+const ReplicateProtocolID = "/sietch/replicate/1.0.0"
+
+// maxReplicateFiles bounds the files one request may ask a peer to fetch
+const maxReplicateFiles = 1 << 16
+
+// ReplicaMap records which trusted peers are known to hold which chunks, as
+// learnt from the manifests and have-lists of syncs, storage challenges and
+// replicate requests. It is kept in .sietch/sync/replicas.json.
+type ReplicaMap struct {
+	Peers map[string]*PeerReplicas `json:"peers"`
+}
+
+// PeerReplicas are the chunks one peer is known to hold
+type PeerReplicas struct {
+	Updated time.Time `json:"updated"`
+	Chunks  haveSet   `json:"chunks"`
+}
+
+// FileReplicas is how many copies of a file are known to exist
+type FileReplicas struct {
+	Path   string   `json:"path" yaml:"path"`
+	Size   int64    `json:"size" yaml:"size"`
+	Copies int      `json:"copies" yaml:"copies"` // This vault and the peers in Peers
+	Peers  []string `json:"peers" yaml:"peers"`   // Peers holding every chunk of the file
+}
+
+// replicasPath is where the vault's replica map is kept
+func replicasPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync", "replicas.json")
+}
+
+// LoadReplicaMap returns the replica map of the vault at vaultRoot; a vault
+// that never synced has an empty one
+func LoadReplicaMap(vaultRoot string) (*ReplicaMap, error) {
+	r := &ReplicaMap{Peers: make(map[string]*PeerReplicas)}
+	data, err := os.ReadFile(replicasPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replica map: %w", err)
+	}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse replica map: %w", err)
+	}
+	if r.Peers == nil {
+		r.Peers = make(map[string]*PeerReplicas)
+	}
+	return r, nil
+}
+
+func (r *ReplicaMap) save(vaultRoot string) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	path := replicasPath(vaultRoot)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// record notes that peerID holds hashes; with replace, they are all it holds
+func (r *ReplicaMap) record(peerID string, hashes []string, replace bool) {
+	p := r.Peers[peerID]
+	if p == nil || replace {
+		p = &PeerReplicas{}
+		r.Peers[peerID] = p
+	}
+	p.Chunks = newHaveSet(append(hashes, p.Chunks...))
+	p.Updated = time.Now().UTC()
+}
+
+// forget notes that peerID no longer holds hashes
+func (r *ReplicaMap) forget(peerID string, hashes []string) {
+	p := r.Peers[peerID]
+	if p == nil {
+		return
+	}
+	gone := newHaveSet(hashes)
+	kept := p.Chunks[:0]
+	for _, h := range p.Chunks {
+		if !gone.contains(h) {
+			kept = append(kept, h)
+		}
+	}
+	p.Chunks = kept
+	p.Updated = time.Now().UTC()
+}
+
+// Holds reports whether peerID is known to hold every chunk of file
+func (r *ReplicaMap) Holds(peerID string, file *config.FileManifest) bool {
+	p := r.Peers[peerID]
+	if p == nil {
+		return false
+	}
+	for _, ref := range file.Chunks {
+		if !p.Chunks.contains(ref.Hash) {
+			return false
+		}
+	}
+	return true
+}
+
+// Replication returns the copies of each of files known to exist in this
+// vault and on peers, ordered by path
+func (r *ReplicaMap) Replication(files []config.FileManifest, peers []string) []FileReplicas {
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+	replicas := make([]FileReplicas, 0, len(files))
+	for i := range files {
+		file := &files[i]
+		fr := FileReplicas{Path: file.Destination + file.FilePath, Size: file.Size, Copies: 1, Peers: []string{}}
+		for _, id := range sorted {
+			if r.Holds(id, file) {
+				fr.Peers = append(fr.Peers, id)
+				fr.Copies++
+			}
+		}
+		replicas = append(replicas, fr)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].Path < replicas[j].Path })
+	return replicas
+}
+
+// UnderReplicated returns the entries of replicas with fewer than want copies
+func UnderReplicated(replicas []FileReplicas, want int) []FileReplicas {
+	var below []FileReplicas
+	for _, fr := range replicas {
+		if fr.Copies < want {
+			below = append(below, fr)
+		}
+	}
+	return below
+}
+
+// updateReplicas applies update to the vault's replica map. What peers hold
+// is only ever advisory, so a failure is reported without failing anything.
+func (s *SyncService) updateReplicas(update func(*ReplicaMap)) {
+	s.replicaMu.Lock()
+	defer s.replicaMu.Unlock()
+	root := s.vaultMgr.VaultRoot()
+	r, err := LoadReplicaMap(root)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return
+	}
+	update(r)
+	if err := r.save(root); err != nil {
+		fmt.Printf("Warning: failed to save replica map: %v\n", err)
+	}
+}
+
+// recordPeerManifest notes that peerID holds the chunks of the files of
+// remote. With a have-list, chunks local lacks that the peer did not offer
+// are ones it references without holding. A full manifest lists every file
+// the peer holds, so it replaces what was known before.
+func (s *SyncService) recordPeerManifest(peerID peer.ID, remote, local *config.Manifest, offered haveSet, full bool) {
+	var ours map[string]bool
+	if offered != nil {
+		ours = chunksOf(local)
+	}
+	var hashes []string
+	for _, file := range remote.Files {
+		for _, ref := range file.Chunks {
+			if offered == nil || ours[ref.Hash] || offered.contains(ref.Hash) {
+				hashes = append(hashes, ref.Hash)
+			}
+		}
+	}
+	s.updateReplicas(func(r *ReplicaMap) { r.record(peerID.String(), hashes, full) })
+}
+
+// replicaPeers returns the peers whose copies count towards replication
+func (s *SyncService) replicaPeers(r *ReplicaMap) []string {
+	var peers []string
+	for id := range r.Peers {
+		if s.privateKey == nil {
+			peers = append(peers, id)
+		} else if decoded, err := peer.Decode(id); err == nil && s.trustedPeers[decoded] != nil {
+			peers = append(peers, id)
+		}
+	}
+	return peers
+}
+
+// EnableReplicas makes this vault accept replicate requests from trusted
+// peers while its node runs. Only nodes whose own writes go through
+// SyncWithPeer or SyncWithPeers should enable it.
+func (s *SyncService) EnableReplicas() {
+	s.host.SetStreamHandler(protocol.ID(ReplicateProtocolID), s.limited(s.handleReplicateRequest, rejectJSON))
+}
+
+// replicateRequest asks a peer to hold copies of files
+type replicateRequest struct {
+	Files []string `json:"files"` // Vault paths
+}
+
+// replicateResponse answers a replicate request
+type replicateResponse struct {
+	Stored     []string `json:"stored,omitempty"` // Files asked for that the peer now holds
+	Chunks     int      `json:"chunks,omitempty"` // Chunks it fetched
+	Bytes      int64    `json:"bytes,omitempty"`
+	Incomplete []string `json:"incomplete,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// handleReplicateRequest fetches the files a trusted peer asks this vault to
+// hold copies of from that peer
+func (s *SyncService) handleReplicateRequest(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+	respond := func(response replicateResponse) {
+		_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+		if err := json.NewEncoder(stream).Encode(response); err != nil {
+			fmt.Printf("Error answering replicate request: %v\n", err)
+		}
+	}
+
+	if s.privateKey != nil {
+		if !s.trusted(peerID) {
+			fmt.Printf("Rejecting replicate request from untrusted peer: %s\n", peerID.String())
+			respond(replicateResponse{Error: "Unauthorized: Peer not trusted"})
+			return
+		}
+		if !s.peerAuthenticated(peerID) {
+			fmt.Printf("Rejecting replicate request from unauthenticated peer: %s\n", peerID.String())
+			respond(replicateResponse{Error: errNotAuthenticated})
+			return
+		}
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
+	var request replicateRequest
+	if err := json.NewDecoder(stream).Decode(&request); err != nil {
+		fmt.Printf("Error reading replicate request: %v\n", err)
+		return
+	}
+	if len(request.Files) > maxReplicateFiles {
+		respond(replicateResponse{Error: fmt.Sprintf("Request for %d files exceeds the limit of %d", len(request.Files), maxReplicateFiles)})
+		return
+	}
+
+	// The node may run for a command that does not hold the vault lock,
+	// and a sync of this node waits to finish first
+	l, err := lock.Acquire(s.vaultMgr.VaultRoot(), lock.Options{Command: "sietch replicate"})
+	if err != nil {
+		respond(replicateResponse{Error: "Busy: " + err.Error()})
+		return
+	}
+	defer func() { _ = l.Release() }()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeouts().Sync)
+	defer cancel()
+	fmt.Printf("📥 Peer %s asked this vault to hold %d file(s)\n", peerID.String(), len(request.Files))
+	response, err := s.replicateFrom(ctx, peerID, request.Files)
+	if err != nil {
+		fmt.Printf("Error replicating from %s: %v\n", peerID.String(), err)
+		respond(replicateResponse{Error: err.Error()})
+		return
+	}
+	respond(*response)
+}
+
+// replicateFrom fetches files from peerID as a sync would, leaving the rest
+// of the peer's files and its deletions alone
+func (s *SyncService) replicateFrom(ctx context.Context, peerID peer.ID, files []string) (*replicateResponse, error) {
+	trusted, err := s.VerifyAndExchangeKeys(ctx, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	if !trusted {
+		return nil, fmt.Errorf("peer %s is not trusted", peerID.String())
+	}
+	remote, _, _, err := s.getRemoteManifestSince(ctx, peerID, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote manifest: %w", err)
+	}
+	wanted := make(map[string]bool, len(files))
+	for _, f := range files {
+		wanted[f] = true
+	}
+	asked := &config.Manifest{}
+	for _, file := range remote.Files {
+		if wanted[file.Destination+file.FilePath] {
+			asked.Files = append(asked.Files, file)
+		}
+	}
+
+	local, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %w", err)
+	}
+	offered, err := s.exchangeHaves(ctx, peerID, local)
+	if err != nil {
+		fmt.Printf("Warning: have-list exchange with peer %s failed: %v\n", peerID.String(), err)
+		offered = nil
+	}
+	s.recordPeerManifest(peerID, remote, local, offered, true)
+
+	fetch := onlyOffered(offered, s.withRetry(ctx, s.Retry, func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		return s.fetchChunk(ctx, peerID, chunkHash, encryptedHash)
+	}))
+	start := time.Now()
+	result, err := s.applyManifestDiff(local, asked, fetch, s.fromPeer(peerID))
+	if err != nil {
+		return nil, err
+	}
+	result.Duration = time.Since(start)
+	s.recordSync("peer", peerID.String(), result, nil)
+
+	// Files kept with other content at the same path are not copies
+	held, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %w", err)
+	}
+	response := &replicateResponse{Chunks: result.ChunksTransferred, Bytes: result.BytesTransferred, Incomplete: result.IncompleteFiles}
+	for i := range asked.Files {
+		for j := range held.Files {
+			if held.Files[j].Destination+held.Files[j].FilePath == asked.Files[i].Destination+asked.Files[i].FilePath &&
+				sameFileContent(&held.Files[j], &asked.Files[i]) {
+				response.Stored = append(response.Stored, asked.Files[i].Destination+asked.Files[i].FilePath)
+				break
+			}
+		}
+	}
+	return response, nil
+}
+
+// ReplicaRequest is what sync --ensure-replicas asks one peer to hold, and
+// what came of it
+type ReplicaRequest struct {
+	Peer       string   `json:"peer" yaml:"peer"`
+	Files      []string `json:"files" yaml:"files"`
+	Size       int64    `json:"size" yaml:"size"` // Total size of Files
+	Stored     []string `json:"stored" yaml:"stored"`
+	Chunks     int      `json:"chunks" yaml:"chunks"` // Chunks the peer fetched
+	Bytes      int64    `json:"bytes" yaml:"bytes"`
+	Incomplete []string `json:"incomplete,omitempty" yaml:"incomplete,omitempty"`
+	Error      string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ReplicaPlan is how sync --ensure-replicas brings every file to Want copies
+type ReplicaPlan struct {
+	Want     int              `json:"want" yaml:"want"`
+	Files    int              `json:"files" yaml:"files"`       // Files in the vault
+	Below    []FileReplicas   `json:"below" yaml:"below"`       // Files with fewer copies than Want
+	Requests []ReplicaRequest `json:"requests" yaml:"requests"` // What each peer is asked to hold
+	// Files that cannot reach Want copies: too few of the peers reached
+	// accept replicas, may see the file and lack it
+	Short []string `json:"short" yaml:"short"`
+}
+
+// PlanReplicas asks each of peerIDs for its whole manifest to learn what it
+// holds, then picks which of them should hold copies of the files with fewer
+// than want copies. Each file goes to the peers that accept replicas and have
+// been asked to hold the fewest bytes so far.
+func (s *SyncService) PlanReplicas(ctx context.Context, peerIDs []peer.ID, want int) (*ReplicaPlan, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Sync)
+	defer cancel()
+	local, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %w", err)
+	}
+
+	var accepting []peer.ID
+	for _, peerID := range peerIDs {
+		trusted, err := s.VerifyAndExchangeKeys(timeoutCtx, peerID)
+		if err != nil || !trusted {
+			fmt.Printf("Warning: skipping peer %s: not trusted (%v)\n", peerID.String(), err)
+			continue
+		}
+		remote, _, _, err := s.getRemoteManifestSince(timeoutCtx, peerID, "")
+		if err != nil {
+			fmt.Printf("Warning: skipping peer %s: failed to get manifest: %v\n", peerID.String(), err)
+			continue
+		}
+		offered, err := s.exchangeHaves(timeoutCtx, peerID, local)
+		if err != nil {
+			fmt.Printf("Warning: have-list exchange with peer %s failed: %v\n", peerID.String(), err)
+			offered = nil
+		}
+		s.recordPeerManifest(peerID, remote, local, offered, true)
+
+		caps, err := s.PeerCapabilities(timeoutCtx, peerID)
+		if err == nil && caps.Supports(ReplicateProtocolID) {
+			accepting = append(accepting, peerID)
+		} else {
+			fmt.Printf("Peer %s does not accept replicas (sync.accept_replicas is off)\n", peerID.String())
+		}
+	}
+
+	replicas, err := LoadReplicaMap(s.vaultMgr.VaultRoot())
+	if err != nil {
+		return nil, err
+	}
+	plan := &ReplicaPlan{Want: want, Files: len(local.Files), Below: []FileReplicas{}, Requests: []ReplicaRequest{}, Short: []string{}}
+	plan.Below = append(plan.Below, UnderReplicated(replicas.Replication(local.Files, s.replicaPeers(replicas)), want)...)
+
+	byPath := make(map[string]*config.FileManifest, len(local.Files))
+	for i := range local.Files {
+		byPath[local.Files[i].Destination+local.Files[i].FilePath] = &local.Files[i]
+	}
+	requests := make(map[peer.ID]*ReplicaRequest, len(accepting))
+	for _, peerID := range accepting {
+		requests[peerID] = &ReplicaRequest{Peer: peerID.String(), Files: []string{}, Stored: []string{}}
+	}
+	for _, fr := range plan.Below {
+		file := byPath[fr.Path]
+		var candidates []peer.ID
+		for _, peerID := range accepting {
+			if !replicas.Holds(peerID.String(), file) && peerAllowsFile(s.accessRules(peerID), file) {
+				candidates = append(candidates, peerID)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return requests[candidates[i]].Size < requests[candidates[j]].Size
+		})
+		needed := want - fr.Copies
+		if len(candidates) < needed {
+			plan.Short = append(plan.Short, fr.Path)
+			needed = len(candidates)
+		}
+		for _, peerID := range candidates[:needed] {
+			requests[peerID].Files = append(requests[peerID].Files, fr.Path)
+			requests[peerID].Size += fr.Size
+		}
+	}
+	for _, peerID := range accepting {
+		if len(requests[peerID].Files) > 0 {
+			plan.Requests = append(plan.Requests, *requests[peerID])
+		}
+	}
+	return plan, nil
+}
+
+// EnsureReplicas sends the requests of plan, filling in what came of each,
+// and records the files each peer now holds
+func (s *SyncService) EnsureReplicas(ctx context.Context, plan *ReplicaPlan) error {
+	local, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return fmt.Errorf("failed to get local manifest: %w", err)
+	}
+	byPath := make(map[string]*config.FileManifest, len(local.Files))
+	for i := range local.Files {
+		byPath[local.Files[i].Destination+local.Files[i].FilePath] = &local.Files[i]
+	}
+
+	for i := range plan.Requests {
+		request := &plan.Requests[i]
+		peerID, err := peer.Decode(request.Peer)
+		if err != nil {
+			request.Error = err.Error()
+			continue
+		}
+		response, err := s.requestReplicas(ctx, peerID, request.Files)
+		if err != nil {
+			request.Error = err.Error()
+			continue
+		}
+		request.Stored = append(request.Stored, response.Stored...)
+		request.Chunks, request.Bytes, request.Incomplete = response.Chunks, response.Bytes, response.Incomplete
+
+		var hashes []string
+		for _, path := range response.Stored {
+			if file := byPath[path]; file != nil {
+				for _, ref := range file.Chunks {
+					hashes = append(hashes, ref.Hash)
+				}
+			}
+		}
+		s.updateReplicas(func(r *ReplicaMap) { r.record(request.Peer, hashes, false) })
+	}
+	return nil
+}
+
+// requestReplicas asks peerID to hold copies of files and waits until it has
+// fetched them
+func (s *SyncService) requestReplicas(ctx context.Context, peerID peer.ID, files []string) (*replicateResponse, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Sync)
+	defer cancel()
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(ReplicateProtocolID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replicate stream: %w", err)
+	}
+	defer stream.Close()
+	defer resetOnCancel(timeoutCtx, stream)()
+
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
+	if err := json.NewEncoder(stream).Encode(replicateRequest{Files: files}); err != nil {
+		return nil, fmt.Errorf("failed to send replicate request: %w", err)
+	}
+
+	// The peer answers once it has fetched the files
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Sync))
+	var response replicateResponse
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to read replicate response: %w", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("remote error: %s", response.Error)
+	}
+	return &response, nil
+}
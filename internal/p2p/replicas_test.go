@@ -0,0 +1,100 @@
+package p2p
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func TestEnsureReplicas(t *testing.T) {
+	net, err := mocknet.FullMeshLinked(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { net.Close() })
+	hosts := net.Hosts()
+
+	localVault := newTestVault(t, "a.txt", hashA, "alpha")
+	addTestFile(t, localVault, "c.txt", hashC, "charlie")
+	local, err := NewSyncService(hosts[0], localVault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder, err := NewSyncService(hosts[1], newTestVault(t, "b.txt", hashB, "bravo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder.EnableReplicas()
+	// Holds a copy of a.txt already but does not accept replicas
+	if _, err := NewSyncService(hosts[2], newTestVault(t, "a.txt", hashA, "alpha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := net.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	plan, err := local.PlanReplicas(ctx, []peer.ID{hosts[1].ID(), hosts[2].ID()}, 3)
+	if err != nil {
+		t.Fatalf("PlanReplicas failed: %v", err)
+	}
+	if len(plan.Below) != 2 || plan.Below[0].Path != "docs/a.txt" || plan.Below[0].Copies != 2 || plan.Below[1].Copies != 1 {
+		t.Fatalf("unexpected files below 3 copies: %+v", plan.Below)
+	}
+	if len(plan.Requests) != 1 || plan.Requests[0].Peer != hosts[1].ID().String() ||
+		!reflect.DeepEqual(plan.Requests[0].Files, []string{"docs/a.txt", "docs/c.txt"}) {
+		t.Fatalf("unexpected requests: %+v", plan.Requests)
+	}
+	// Only one peer accepts replicas, so c.txt cannot reach three copies
+	if !reflect.DeepEqual(plan.Short, []string{"docs/c.txt"}) {
+		t.Errorf("expected only docs/c.txt to fall short, got %v", plan.Short)
+	}
+
+	if err := local.EnsureReplicas(ctx, plan); err != nil {
+		t.Fatalf("EnsureReplicas failed: %v", err)
+	}
+	request := plan.Requests[0]
+	if request.Error != "" || len(request.Stored) != 2 || request.Chunks != 2 {
+		t.Fatalf("unexpected outcome: %+v", request)
+	}
+	held, err := holder.vaultMgr.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held.Files) != 3 {
+		t.Errorf("expected the holder to keep 3 files, got %d", len(held.Files))
+	}
+
+	replicas, err := LoadReplicaMap(localVault.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := localVault.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := replicas.Replication(files.Files, local.replicaPeers(replicas))
+	if got[0].Copies != 3 || got[1].Copies != 2 {
+		t.Errorf("expected 3 copies of a.txt and 2 of c.txt, got %+v", got)
+	}
+	if below := UnderReplicated(got, 2); len(below) != 0 {
+		t.Errorf("expected no file below 2 copies, got %+v", below)
+	}
+}
+
+func TestReplicaMapForget(t *testing.T) {
+	r := &ReplicaMap{Peers: make(map[string]*PeerReplicas)}
+	r.record("peer", []string{hashB, hashA}, false)
+	r.record("peer", []string{hashC}, false)
+	r.forget("peer", []string{hashB})
+	if want := (haveSet{hashA, hashC}); !reflect.DeepEqual(r.Peers["peer"].Chunks, want) {
+		t.Errorf("expected %v, got %v", want, r.Peers["peer"].Chunks)
+	}
+	r.record("peer", []string{hashD}, true)
+	if want := (haveSet{hashD}); !reflect.DeepEqual(r.Peers["peer"].Chunks, want) {
+		t.Errorf("a full listing should replace what was known; got %v", r.Peers["peer"].Chunks)
+	}
+}
@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how often a failed chunk fetch is retried
+type RetryPolicy struct {
+	Retries   int           // Attempts after the first one; 0 disables retries
+	BaseDelay time.Duration // Delay before the first retry, doubled for each one after
+	MaxDelay  time.Duration // Upper bound on the delay between attempts
+}
+
+// DefaultRetryPolicy is used by sync services unless changed
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:   3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  10 * time.Second,
+}
+
+// delay returns how long to wait before retry number attempt (starting at 1).
+// The exponential delay is jittered down by up to half, so peers that failed
+// together do not all retry at the same moment.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// withRetry wraps fetch so each chunk is retried according to policy. Retries
+// stop early once ctx is done, and the context error is returned so the sync
+// is aborted rather than the chunk skipped.
+func (s *SyncService) withRetry(ctx context.Context, policy RetryPolicy, fetch chunkFetcher) chunkFetcher {
+	return func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		var err error
+		for attempt := 0; ; attempt++ {
+			var data []byte
+			var size int
+			if data, size, err = fetch(chunkHash, encryptedHash); err == nil {
+				return data, size, nil
+			}
+			if ctx.Err() != nil {
+				return nil, 0, fmt.Errorf("%w: %v", ctx.Err(), err)
+			}
+			if attempt >= policy.Retries {
+				return nil, 0, fmt.Errorf("giving up after %d attempts: %v", attempt+1, err)
+			}
+
+			wait := policy.delay(attempt + 1)
+			if s.Verbose {
+				fmt.Printf("Fetching chunk %s failed (%v), retrying in %v\n", chunkHash, err, wait.Round(time.Millisecond))
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, 0, fmt.Errorf("%w: %v", ctx.Err(), err)
+			}
+		}
+	}
+}
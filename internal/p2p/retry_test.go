@@ -0,0 +1,171 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for range 20 {
+			if d := p.delay(attempt); d < want/2 || d > want {
+				t.Fatalf("delay(%d) = %v, want between %v and %v", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	s := &SyncService{}
+	policy := RetryPolicy{Retries: 2, BaseDelay: time.Millisecond}
+
+	calls := 0
+	flaky := func(string, string) ([]byte, int, error) {
+		if calls++; calls < 3 {
+			return nil, 0, errors.New("stream reset")
+		}
+		return []byte("ok"), 2, nil
+	}
+	if data, _, err := s.withRetry(context.Background(), policy, flaky)("h", ""); err != nil || string(data) != "ok" {
+		t.Fatalf("expected the third attempt to succeed, got %q, %v", data, err)
+	}
+
+	calls = 0
+	broken := func(string, string) ([]byte, int, error) {
+		calls++
+		return nil, 0, errors.New("stream reset")
+	}
+	_, _, err := s.withRetry(context.Background(), policy, broken)("h", "")
+	if err == nil || calls != 3 || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("expected to give up after 3 attempts, got %d calls and %v", calls, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	_, _, err = s.withRetry(ctx, policy, broken)("h", "")
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("expected a cancelled context to stop retrying, got %d calls and %v", calls, err)
+	}
+}
+
+func TestSyncSkipsFailedChunksAndResumes(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	other := newTestVault(t, "b.txt", hashB, "bravo")
+	s := NewLocalSyncService(local)
+
+	chunkPath := filepath.Join(other.VaultRoot(), ".sietch", "chunks", hashB)
+	if err := os.Rename(chunkPath, chunkPath+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.SyncWithVault(other.VaultRoot())
+	if err != nil {
+		t.Fatalf("a missing chunk must not abort the sync: %v", err)
+	}
+	if len(result.FailedChunks) != 1 || len(result.IncompleteFiles) != 1 || result.IncompleteFiles[0] != "docs/b.txt" || result.FileCount != 0 {
+		t.Fatalf("expected b.txt to be skipped, got %+v", result)
+	}
+	if m, err := local.GetManifest(); err != nil || len(m.Files) != 1 {
+		t.Fatalf("an incomplete file must not be saved, got %+v (%v)", m, err)
+	}
+
+	// Once the chunk is available again the next sync picks the file up
+	if err := os.Rename(chunkPath+".moved", chunkPath); err != nil {
+		t.Fatal(err)
+	}
+	result, err = s.SyncWithVault(other.VaultRoot())
+	if err != nil || result.FileCount != 1 || result.ChunksTransferred != 1 || len(result.FailedChunks) != 0 {
+		t.Fatalf("expected the skipped file to be synced, got %+v (%v)", result, err)
+	}
+}
+
+func TestInterruptedSyncKeepsCompletedFiles(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	other := newTestVault(t, "b.txt", hashB, "bravo")
+	if err := os.WriteFile(filepath.Join(other.VaultRoot(), ".sietch", "chunks", hashC), []byte("charlie"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.StoreFileManifest(other.VaultRoot(), "c.txt", &config.FileManifest{
+		FilePath:    "c.txt",
+		Destination: "docs/",
+		Size:        7,
+		Chunks:      []config.ChunkRef{{Hash: hashC, Size: 7}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s := NewLocalSyncService(local)
+
+	localManifest, otherManifest, err := s.localManifests(other.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	fetch := func(chunkHash, _ string) ([]byte, int, error) {
+		if calls++; calls > 1 {
+			return nil, 0, fmt.Errorf("failed to read chunk: %w", context.Canceled)
+		}
+		data, err := os.ReadFile(filepath.Join(other.VaultRoot(), ".sietch", "chunks", chunkHash))
+		return data, len(data), err
+	}
+	result, err := s.applyManifestDiff(localManifest, otherManifest, fetch, fromSource("vault", "other", ""))
+	if err != nil {
+		t.Fatalf("an interrupted transfer must keep its progress: %v", err)
+	}
+	if !result.Interrupted || result.ChunksRemaining != 1 || result.ChunksTransferred != 1 || calls != 2 {
+		t.Fatalf("expected the transfer to stop after one chunk, got %+v after %d fetches", result, calls)
+	}
+	if result.FileCount != 1 || len(result.IncompleteFiles) != 1 || len(result.FailedChunks) != 0 {
+		t.Fatalf("expected one file saved and one left for later, got %+v", result)
+	}
+	if m, err := local.GetManifest(); err != nil || len(m.Files) != 2 {
+		t.Fatalf("expected the completed file to be saved, got %+v (%v)", m, err)
+	}
+
+	// The next sync only fetches what was left
+	result, err = s.SyncWithVault(other.VaultRoot())
+	if err != nil || result.Interrupted || result.FileCount != 1 || result.ChunksTransferred != 1 {
+		t.Fatalf("expected the remaining file to be synced, got %+v (%v)", result, err)
+	}
+}
+
+func TestSyncRejectsCorruptChunks(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	other := newTestVault(t, "b.txt", hashB, "bravo")
+	addTestFile(t, other, "c.txt", hashC, "charlie")
+	s := NewLocalSyncService(local)
+
+	localManifest, otherManifest, err := s.localManifests(other.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetch := func(chunkHash, _ string) ([]byte, int, error) {
+		if chunkHash == hashB {
+			return []byte("tampered"), 8, nil
+		}
+		data, err := os.ReadFile(filepath.Join(other.VaultRoot(), ".sietch", "chunks", chunkHash))
+		return data, len(data), err
+	}
+	result, err := s.applyManifestDiff(localManifest, otherManifest, fetch, fromSource("vault", "other", ""))
+	if err != nil {
+		t.Fatalf("applyManifestDiff failed: %v", err)
+	}
+	if len(result.CorruptChunks) != 1 || result.CorruptChunks[0] != hashB || len(result.FailedChunks) != 1 {
+		t.Fatalf("expected the tampered chunk to be rejected, got %+v", result)
+	}
+	if result.ChunksTransferred != 1 || result.FileCount != 1 || len(result.IncompleteFiles) != 1 || result.IncompleteFiles[0] != "docs/b.txt" {
+		t.Fatalf("expected only the file with a good chunk to be saved, got %+v", result)
+	}
+	if exists, _ := local.ChunkExists(hashB); exists {
+		t.Error("a chunk that does not match its hash must not be stored")
+	}
+}
@@ -0,0 +1,317 @@
+package p2p
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// ResumeProtocolID resumes an authenticated session without a key exchange
+// or any RSA operation. After a mutual authentication the serving peer
+// issues a ticket: a random token naming the session and a secret encrypted
+// to the requesting peer's transfer key, or to its identity key if it
+// presented none. Until the ticket expires, the requesting
+// peer proves it holds the secret with an HMAC over a fresh nonce, bound to
+// both peers and the time like authentication signatures, and the serving
+// peer answers with an HMAC of its own.
+//
+// Serving peers keep sessions in memory, so a restart ends them; requesting
+// peers keep their tickets in the vault, so later syncs can use them.
+const ResumeProtocolID = "/sietch/auth-resume/1.0.0"
+
+// DefaultSessionTTL is how long sessions last unless changed
+const DefaultSessionTTL = 10 * time.Minute
+
+// sessionTicket is issued with a successful authentication
+type sessionTicket struct {
+	Token   []byte    `json:"token"`
+	Secret  []byte    `json:"secret"` // Encrypted to the requesting peer's key in transit
+	Expires time.Time `json:"expires"`
+	// Fingerprint of the transfer key the session encrypts to; "" for the
+	// identity key
+	TransferKey string `json:"transfer_key,omitempty"`
+}
+
+type resumeRequest struct {
+	Token     []byte `json:"token"`
+	Nonce     []byte `json:"nonce"`
+	Timestamp int64  `json:"timestamp"`
+	MAC       []byte `json:"mac"`
+}
+
+type resumeResponse struct {
+	MAC   []byte `json:"mac,omitempty"` // Proves the serving peer holds the session secret
+	Error string `json:"error,omitempty"`
+}
+
+// resumableSession is a session a serving peer issued a ticket for
+type resumableSession struct {
+	peer     peer.ID
+	secret   []byte
+	expires  time.Time
+	transfer *peerTransferKey // The peer's transfer key; nil for its identity key
+}
+
+// resumeMAC is what a peer computes to prove it holds a session's secret
+func resumeMAC(secret []byte, role string, signer, verifier peer.ID, nonce []byte, timestamp int64, token []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(authPayload(role, signer, verifier, nonce, timestamp, token))
+	return mac.Sum(nil)
+}
+
+// issueSessionTicket starts a session for peerID, returning its ticket with
+// the secret encrypted to transfer, the peer's transfer key, or to key, its
+// identity key, if it has none; nil if sessions are disabled
+func (s *SyncService) issueSessionTicket(peerID peer.ID, key *rsa.PublicKey, transfer *peerTransferKey) *sessionTicket {
+	if s.SessionTTL <= 0 {
+		return nil
+	}
+	token := make([]byte, 16)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil
+	}
+	ticket := &sessionTicket{Token: token}
+	if transfer != nil {
+		key, ticket.TransferKey = transfer.key, transfer.fingerprint
+	}
+	encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, secret, nil)
+	if err != nil {
+		fmt.Printf("Warning: failed to issue session ticket: %v\n", err)
+		return nil
+	}
+	now := time.Now()
+	expires := now.Add(s.SessionTTL)
+
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*resumableSession)
+	}
+	for id, session := range s.sessions {
+		if now.After(session.expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[hex.EncodeToString(token)] = &resumableSession{peer: peerID, secret: secret, expires: expires, transfer: transfer}
+	ticket.Secret, ticket.Expires = encrypted, expires
+	return ticket
+}
+
+// handleResume resumes a session issued to the requesting peer
+func (s *SyncService) handleResume(stream network.Stream) {
+	defer stream.Close()
+
+	peerID := stream.Conn().RemotePeer()
+	send := func(resp resumeResponse) {
+		_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+		if err := json.NewEncoder(stream).Encode(resp); err != nil {
+			fmt.Printf("Error sending resume response: %v\n", err)
+		}
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	var request resumeRequest
+	if err := json.NewDecoder(stream).Decode(&request); err != nil {
+		fmt.Printf("Error reading resume request: %v\n", err)
+		return
+	}
+
+	s.authMu.Lock()
+	session, ok := s.sessions[hex.EncodeToString(request.Token)]
+	s.authMu.Unlock()
+	if !ok || session.peer != peerID || time.Now().After(session.expires) {
+		send(resumeResponse{Error: "unknown or expired session"})
+		return
+	}
+
+	expected := resumeMAC(session.secret, authRoleClient, peerID, s.host.ID(), request.Nonce, request.Timestamp, request.Token)
+	err := checkAuthTime(request.Timestamp, time.Now())
+	if err == nil && !hmac.Equal(expected, request.MAC) {
+		err = fmt.Errorf("session proof does not match")
+	}
+	if err == nil {
+		err = s.rememberAuth(request.MAC)
+	}
+	if err != nil {
+		fmt.Printf("Rejecting session resumption from peer %s: %v\n", peerID.String(), err)
+		send(resumeResponse{Error: "session resumption failed"})
+		return
+	}
+
+	s.setAuthenticated(peerID, true)
+	s.setPeerTransferKey(peerID, session.transfer)
+	send(resumeResponse{MAC: resumeMAC(session.secret, authRoleServer, s.host.ID(), peerID, request.Nonce, request.Timestamp, request.Token)})
+}
+
+// resumeSession resumes the session of a ticket peerID issued earlier,
+// reporting whether both peers are authenticated again. A ticket that
+// fails is discarded, so the caller falls back to a full handshake.
+func (s *SyncService) resumeSession(ctx context.Context, peerID peer.ID) bool {
+	ticket := s.loadSessionTicket(peerID)
+	if ticket == nil {
+		return false
+	}
+	var err error
+	if ticket.TransferKey != "" && s.ownTransferKey(ticket.TransferKey) == nil {
+		err = fmt.Errorf("the session's transfer key is no longer kept")
+	} else {
+		err = s.resume(ctx, peerID, ticket)
+	}
+	if err != nil {
+		if s.Verbose {
+			fmt.Printf("Could not resume session with peer %s: %v\n", peerID.String(), err)
+		}
+		_ = s.saveSessionTicket(peerID, nil)
+		return false
+	}
+	s.setPresentedTransferKey(peerID, ticket.TransferKey)
+	if s.Verbose {
+		fmt.Printf("Resumed session with peer %s\n", peerID.String())
+	}
+	return true
+}
+
+func (s *SyncService) resume(ctx context.Context, peerID peer.ID, ticket *sessionTicket) error {
+	caps, err := s.PeerCapabilities(ctx, peerID)
+	if err != nil {
+		return err
+	}
+	if !caps.Supports(ResumeProtocolID) {
+		return fmt.Errorf("peer does not support session resumption")
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Handshake)
+	defer cancel()
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(ResumeProtocolID))
+	if err != nil {
+		return fmt.Errorf("failed to open resume stream: %w", err)
+	}
+	defer stream.Close()
+
+	request := resumeRequest{Token: ticket.Token, Nonce: make([]byte, 32), Timestamp: time.Now().UnixNano()}
+	if _, err := rand.Read(request.Nonce); err != nil {
+		return err
+	}
+	request.MAC = resumeMAC(ticket.Secret, authRoleClient, s.host.ID(), peerID, request.Nonce, request.Timestamp, ticket.Token)
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Handshake))
+	if err := json.NewEncoder(stream).Encode(request); err != nil {
+		return fmt.Errorf("failed to send resume request: %w", err)
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Handshake))
+	var response resumeResponse
+	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+		return fmt.Errorf("failed to read resume response: %w", err)
+	}
+	if response.Error != "" {
+		return fmt.Errorf("remote error: %s", response.Error)
+	}
+	expected := resumeMAC(ticket.Secret, authRoleServer, peerID, s.host.ID(), request.Nonce, request.Timestamp, ticket.Token)
+	if !hmac.Equal(expected, response.MAC) {
+		return fmt.Errorf("peer does not hold the session secret")
+	}
+	return nil
+}
+
+// acceptSessionTicket decrypts and keeps a ticket issued by peerID
+func (s *SyncService) acceptSessionTicket(peerID peer.ID, ticket *sessionTicket) {
+	if ticket == nil || s.SessionTTL <= 0 {
+		return
+	}
+	key, err := s.decryptionKey(peerID, ticket.TransferKey != "")
+	var secret []byte
+	if err == nil {
+		secret, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, ticket.Secret, nil)
+	}
+	if err != nil {
+		fmt.Printf("Warning: ignoring session ticket from peer %s: %v\n", peerID.String(), err)
+		return
+	}
+	// Never keep a ticket longer than this vault's own session lifetime
+	keep := *ticket
+	keep.Secret = secret
+	if limit := time.Now().Add(s.SessionTTL); keep.Expires.After(limit) {
+		keep.Expires = limit
+	}
+	if err := s.saveSessionTicket(peerID, &keep); err != nil {
+		fmt.Printf("Warning: failed to save session ticket: %v\n", err)
+	}
+}
+
+// sessionTicketsPath is where the tickets issued by each peer are kept
+func sessionTicketsPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync", "sessions.json")
+}
+
+func (s *SyncService) loadSessionTickets() map[string]*sessionTicket {
+	tickets := make(map[string]*sessionTicket)
+	if data, err := os.ReadFile(sessionTicketsPath(s.vaultMgr.VaultRoot())); err == nil {
+		_ = json.Unmarshal(data, &tickets)
+	}
+	return tickets
+}
+
+// loadSessionTicket returns the unexpired ticket peerID issued, or nil
+func (s *SyncService) loadSessionTicket(peerID peer.ID) *sessionTicket {
+	if s.SessionTTL <= 0 {
+		return nil
+	}
+	ticket := s.loadSessionTickets()[peerID.String()]
+	if ticket == nil || time.Now().After(ticket.Expires) {
+		return nil
+	}
+	return ticket
+}
+
+// saveSessionTicket records the ticket peerID issued, or removes it when
+// ticket is nil, dropping expired tickets of other peers
+func (s *SyncService) saveSessionTicket(peerID peer.ID, ticket *sessionTicket) error {
+	tickets := s.loadSessionTickets()
+	now := time.Now()
+	for id, t := range tickets {
+		if t == nil || now.After(t.Expires) {
+			delete(tickets, id)
+		}
+	}
+	if ticket != nil {
+		tickets[peerID.String()] = ticket
+	} else {
+		delete(tickets, peerID.String())
+	}
+
+	path := sessionTicketsPath(s.vaultMgr.VaultRoot())
+	if len(tickets) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(tickets, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
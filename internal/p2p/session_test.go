@@ -0,0 +1,126 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// authenticatedPair returns a server trusting only the client and a client
+// holding a session ticket from the server
+func authenticatedPair(t *testing.T) (server, client *SyncService) {
+	t.Helper()
+	server, client = newPairingPeers(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+	if err := client.host.Connect(ctx, peer.AddrInfo{ID: serverID, Addrs: server.host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	server.trustAllPeers = false
+	server.trustedPeers[clientID] = &PeerInfo{ID: clientID, PublicKey: client.publicKey}
+	client.trustedPeers[serverID] = &PeerInfo{ID: serverID, PublicKey: server.publicKey, Fingerprint: "known"}
+
+	if trusted, err := client.VerifyAndExchangeKeys(ctx, serverID); err != nil || !trusted {
+		t.Fatalf("VerifyAndExchangeKeys = %v, %v", trusted, err)
+	}
+	if client.loadSessionTicket(serverID) == nil {
+		t.Fatal("expected a session ticket after authentication")
+	}
+	return server, client
+}
+
+func TestSessionResumption(t *testing.T) {
+	server, client := authenticatedPair(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+
+	server.setAuthenticated(clientID, false)
+	if !client.resumeSession(ctx, serverID) {
+		t.Fatal("expected the session to resume")
+	}
+	if !server.peerAuthenticated(clientID) {
+		t.Fatal("expected the server to have authenticated the resumed session")
+	}
+	if _, err := client.getRemoteManifest(ctx, serverID); err != nil {
+		t.Fatalf("expected manifests after resumption, got %v", err)
+	}
+
+	// A restarted server no longer knows the session, so the client
+	// discards its ticket and authenticates again
+	server.sessions = nil
+	if client.resumeSession(ctx, serverID) {
+		t.Fatal("expected an unknown session not to resume")
+	}
+	if client.loadSessionTicket(serverID) != nil {
+		t.Fatal("expected the failed ticket to be discarded")
+	}
+	if trusted, err := client.VerifyAndExchangeKeys(ctx, serverID); err != nil || !trusted {
+		t.Fatalf("VerifyAndExchangeKeys = %v, %v", trusted, err)
+	}
+	if client.loadSessionTicket(serverID) == nil {
+		t.Fatal("expected a new ticket after authenticating again")
+	}
+}
+
+func TestSessionResumptionRejectsBadProofs(t *testing.T) {
+	server, client := authenticatedPair(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+	ticket := client.loadSessionTicket(serverID)
+
+	send := func(request resumeRequest) resumeResponse {
+		t.Helper()
+		stream, err := client.host.NewStream(ctx, serverID, protocol.ID(ResumeProtocolID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		if err := json.NewEncoder(stream).Encode(request); err != nil {
+			t.Fatal(err)
+		}
+		var response resumeResponse
+		if err := json.NewDecoder(stream).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+	proof := func(ts int64) resumeRequest {
+		request := resumeRequest{Token: ticket.Token, Nonce: []byte("nonce"), Timestamp: ts}
+		request.MAC = resumeMAC(ticket.Secret, authRoleClient, clientID, serverID, request.Nonce, ts, ticket.Token)
+		return request
+	}
+
+	server.setAuthenticated(clientID, false)
+	stale := proof(time.Now().Add(-time.Hour).UnixNano())
+	if response := send(stale); response.Error == "" {
+		t.Error("expected a stale proof to be rejected")
+	}
+	forged := proof(time.Now().UnixNano())
+	forged.MAC[0] ^= 1
+	if response := send(forged); response.Error == "" {
+		t.Error("expected a forged proof to be rejected")
+	}
+	if server.peerAuthenticated(clientID) {
+		t.Fatal("expected bad proofs not to authenticate the client")
+	}
+
+	fresh := proof(time.Now().UnixNano())
+	if response := send(fresh); response.Error != "" {
+		t.Fatalf("expected a fresh proof to be accepted, got %s", response.Error)
+	}
+	if response := send(fresh); response.Error == "" {
+		t.Error("expected a replayed proof to be rejected")
+	}
+
+	// Sessions expire
+	for _, session := range server.sessions {
+		session.expires = time.Now().Add(-time.Second)
+	}
+	if response := send(proof(time.Now().UnixNano())); response.Error == "" {
+		t.Error("expected an expired session to be rejected")
+	}
+}
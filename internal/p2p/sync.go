@@ -2,17 +2,17 @@ package p2p
 
 import (
 	"context"
-	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
-	"io"
 	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/host"
@@ -20,17 +20,23 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 
+	"github.com/substantialcattle5/sietch/internal/audit"
+	"github.com/substantialcattle5/sietch/internal/chunk"
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/hooks"
 	"github.com/substantialcattle5/sietch/internal/manifest" //golangci-lint error
 )
 
 const (
 	// Protocol IDs for different sync operations
-	ManifestProtocolID   = "/sietch/manifest/1.0.0"
-	ManifestProtocolIDv0 = "/sietch/manifest/0.9.0" // Fallback version
-	ChunkProtocolID      = "/sietch/chunk/1.0.0"
-	KeyExchangeProtocol  = "/sietch/key-exchange/1.0.0"
-	AuthProtocol         = "/sietch/auth/1.0.0"
+	ManifestProtocolID    = "/sietch/manifest/1.0.0"
+	ManifestProtocolIDv0  = "/sietch/manifest/0.9.0" // Fallback version
+	ChunkProtocolID       = "/sietch/chunk/2.0.0"
+	ChunkProtocolIDv1     = "/sietch/chunk/1.0.0" // JSON fallback for older peers
+	ConfigProtocolID      = "/sietch/config/1.0.0"
+	KeyExchangeProtocol   = "/sietch/key-exchange/2.0.0"
+	KeyExchangeProtocolv1 = "/sietch/key-exchange/1.0.0" // Unframed PEM for older peers
+	AuthProtocol          = "/sietch/auth/1.0.0"
 
 	// RSA encryption chunk size (must be smaller than key size to account for padding)
 	RSAChunkSize = 256 // For 2048-bit keys
@@ -43,10 +49,48 @@ type SyncService struct {
 	privateKey    *rsa.PrivateKey
 	publicKey     *rsa.PublicKey
 	rsaConfig     *config.RSAConfig
-	trustedPeers  map[peer.ID]*PeerInfo
+	trustedPeers  map[peer.ID]*PeerInfo // Peers the vault serves: configured, paired or trusted since
+	peerACLs      map[peer.ID][]string  // allowed_paths of trusted peers limited to part of the vault
 	vaultConfig   *config.VaultConfig
-	trustAllPeers bool // New flag to automatically trust all peers
-	Verbose       bool // Enable verbose debug output
+	trustAllPeers bool         // Keep the keys of peers we sync from even if they fail authentication
+	Verbose       bool         // Enable verbose debug output
+	Retry         RetryPolicy  // Retries of failed chunk fetches from peers
+	FullSync      bool         // Ignore sync cursors and request each peer's whole manifest
+	Limits        StreamLimits // Bounds on the streams peers may open to this vault
+	Timeouts      Timeouts     // How long sync operations wait on peers; unset ones use the defaults
+	// Algorithm to ask peers to compress manifests and chunks with; "" for none
+	TransportCompression string
+	// How long an authenticated session can be resumed without a new
+	// handshake; 0 disables resumption
+	SessionTTL time.Duration
+	// Vault key sealing the headers of bundles written, and opening sealed
+	// bundles read; nil writes plain bundles
+	BundleKey []byte
+
+	capsMu   sync.Mutex
+	peerCaps map[peer.ID]*Capabilities // Learned in the hello handshake
+	streams  streamLimiter
+
+	pairMu      sync.Mutex
+	invitations []*Invitation // Pending invitations from Invite
+
+	muleQuota int64 // Bytes of bundles held for other vaults, set by EnableMule
+
+	replicaMu sync.Mutex // Serializes updates of the replica map
+	// Held while a sync or a replicate request writes to the vault, since
+	// the vault lock does not keep them apart within one process
+	writeMu sync.Mutex
+
+	authMu        sync.Mutex
+	authenticated map[peer.ID]bool                // Peers that completed mutual authentication
+	sessionKeys   map[peer.ID]*PeerInfo           // Keys learned in key exchanges, which do not make a peer trusted
+	authSeen      map[[sha256.Size]byte]time.Time // Authentication signatures accepted recently
+	sessions      map[string]*resumableSession    // Sessions issued to peers, by token
+	peerTransfer  map[peer.ID]*peerTransferKey    // Transfer keys peers presented, which their data is encrypted to
+	presented     map[peer.ID]string              // Fingerprints of the transfer keys presented to peers
+
+	transferMu   sync.Mutex
+	transferKeys []*TransferKey // This vault's transfer keys, the current one first; loaded on first use
 }
 
 // PeerInfo contains information about a trusted peer
@@ -60,11 +104,36 @@ type PeerInfo struct {
 
 // SyncResult contains statistics about a sync operation
 type SyncResult struct {
+	Session            string // ID of the sync, recorded in the audit log and in the provenance of the files it copied
 	FileCount          int
 	ChunksTransferred  int
 	ChunksDeduplicated int
 	BytesTransferred   int64
 	Duration           time.Duration
+	FailedChunks       []string // Chunks that could not be fetched, even after retrying
+	CorruptChunks      []string // Chunks whose fetched data did not match their hash; also in FailedChunks
+	IncompleteFiles    []string // Files skipped because of FailedChunks; the next sync retries them
+	FilesDeleted       []string // Local files removed because the peer deleted them
+	RejectedFiles      []string // Remote files and deletions ignored because their path is unsafe, with the reason
+	// Interrupted is set when the sync was cancelled or timed out before
+	// all chunks were fetched. What was fetched is kept, the files still
+	// missing chunks are listed in IncompleteFiles, and the next sync
+	// resumes by fetching only ChunksRemaining.
+	Interrupted     bool
+	ChunksRemaining int
+	PeerTransfers   []PeerTransfer // What each peer sent, for syncs with several peers
+}
+
+// SyncPlan describes what a sync with a peer would fetch, computed without transferring anything
+type SyncPlan struct {
+	Files              []string // Remote files that would be added locally
+	Deletions          []string // Local files that would be removed because the peer deleted them
+	Conflicts          []string // Files both sides have with different content; the local version is kept
+	Rejected           []string // Remote files and deletions that would be ignored because their path is unsafe
+	ChunksToTransfer   int
+	ChunksDeduplicated int
+	BytesToTransfer    int64      // Stored size of the chunks that would be fetched
+	Peers              []PeerPlan // The transfers broken down by peer; empty for local syncs
 }
 
 // NewSyncService creates a new sync service
@@ -74,17 +143,39 @@ func NewSyncService(h host.Host, vm *config.Manager) (*SyncService, error) {
 		host:          h,
 		vaultMgr:      vm,
 		trustedPeers:  make(map[peer.ID]*PeerInfo),
+		sessionKeys:   make(map[peer.ID]*PeerInfo),
 		trustAllPeers: true, // Trust all peers by default
+		Retry:         DefaultRetryPolicy,
+		Limits:        DefaultStreamLimits,
+		Timeouts:      DefaultTimeouts,
+		SessionTTL:    DefaultSessionTTL,
+	}
+	if cfg, err := vm.GetConfig(); err == nil {
+		s.Limits = StreamLimitsFor(&cfg.Sync)
+		s.Timeouts = TimeoutsFor(&cfg.Sync)
+		s.TransportCompression = transportCompressionOf(cfg)
 	}
 
-	// Register basic protocol handlers
-	h.SetStreamHandler(protocol.ID(ManifestProtocolID), s.handleManifestRequest)
-	h.SetStreamHandler(protocol.ID(ManifestProtocolIDv0), s.handleManifestRequest) // Support fallback version
-	h.SetStreamHandler(protocol.ID(ChunkProtocolID), s.handleChunkRequest)
+	s.registerSyncHandlers()
 
 	return s, nil
 }
 
+// registerSyncHandlers sets up the handlers of the sync protocols. All but
+// the hello handshake, which does not touch the vault, are subject to the
+// stream limits.
+func (s *SyncService) registerSyncHandlers() {
+	s.host.SetStreamHandler(protocol.ID(HelloProtocolID), s.handleHello)
+	s.host.SetStreamHandler(protocol.ID(ManifestProtocolID), s.limited(s.handleManifestRequest, rejectJSON))
+	s.host.SetStreamHandler(protocol.ID(ManifestProtocolIDv0), s.limited(s.handleManifestRequest, rejectJSON)) // Support fallback version
+	s.host.SetStreamHandler(protocol.ID(ChunkProtocolID), s.limited(s.handleChunkRequest, rejectChunk))
+	s.host.SetStreamHandler(protocol.ID(ChunkProtocolIDv1), s.limited(s.handleChunkRequest, rejectChunk)) // Support fallback version
+	s.host.SetStreamHandler(protocol.ID(ConfigProtocolID), s.limited(s.handleConfigRequest, rejectJSON))
+	s.host.SetStreamHandler(protocol.ID(HaveProtocolID), s.limited(s.handleHaveRequest, rejectStatus))
+	s.host.SetStreamHandler(protocol.ID(ManifestDeltaProtocolID), s.limited(s.handleManifestDeltaRequest, rejectJSON))
+	s.host.SetStreamHandler(protocol.ID(ProofProtocolID), s.limited(s.handleProofRequest, rejectJSON))
+}
+
 // NewSecureSyncService creates a new secure sync service with RSA key support
 func NewSecureSyncService(
 	h host.Host,
@@ -106,8 +197,16 @@ func NewSecureSyncService(
 		publicKey:     publicKey,
 		rsaConfig:     rsaConfig,
 		trustedPeers:  make(map[peer.ID]*PeerInfo),
+		sessionKeys:   make(map[peer.ID]*PeerInfo),
+		peerACLs:      make(map[peer.ID][]string),
 		vaultConfig:   vaultConfig,
 		trustAllPeers: true, // Trust all peers by default
+		Retry:         DefaultRetryPolicy,
+		Limits:        StreamLimitsFor(&vaultConfig.Sync),
+		Timeouts:      TimeoutsFor(&vaultConfig.Sync),
+		SessionTTL:    DefaultSessionTTL,
+
+		TransportCompression: transportCompressionOf(vaultConfig),
 	}
 
 	// Load trusted peers from config
@@ -120,6 +219,11 @@ func NewSecureSyncService(
 				continue
 			}
 
+			// Access rules apply even if the peer's key fails to load below
+			if allowed := vaultConfig.Sync.AllowedPathsFor(trustedPeer); len(allowed) > 0 {
+				s.peerACLs[peerID] = allowed
+			}
+
 			// Parse the public key
 			block, _ := pem.Decode([]byte(trustedPeer.PublicKey))
 			if block == nil {
@@ -159,14 +263,15 @@ func NewSecureSyncService(
 // RegisterProtocols sets up all protocol handlers
 func (s *SyncService) RegisterProtocols(ctx context.Context) {
 	// Register basic protocol handlers
-	s.host.SetStreamHandler(protocol.ID(ManifestProtocolID), s.handleManifestRequest)
-	s.host.SetStreamHandler(protocol.ID(ManifestProtocolIDv0), s.handleManifestRequest) // Support fallback version
-	s.host.SetStreamHandler(protocol.ID(ChunkProtocolID), s.handleChunkRequest)
+	s.registerSyncHandlers()
 
 	// Register secure protocol handlers
 	if s.privateKey != nil {
-		s.host.SetStreamHandler(protocol.ID(KeyExchangeProtocol), s.handleKeyExchange)
+		s.host.SetStreamHandler(protocol.ID(KeyExchangeProtocol), s.limited(s.handleKeyExchange, rejectStatus))
+		s.host.SetStreamHandler(protocol.ID(KeyExchangeProtocolv1), s.limited(s.handleKeyExchangeV1, func(network.Stream, string) {}))
 		s.host.SetStreamHandler(protocol.ID(AuthProtocol), s.handleAuthentication)
+		s.host.SetStreamHandler(protocol.ID(ResumeProtocolID), s.limited(s.handleResume, rejectJSON))
+		s.host.SetStreamHandler(protocol.ID(PairProtocolID), s.limited(s.handlePairRequest, rejectJSON))
 	}
 }
 
@@ -176,169 +281,15 @@ func (s *SyncService) SetTrustAllPeers(trustAll bool) {
 	fmt.Printf("Trust all peers set to: %v\n", trustAll)
 }
 
-// handleKeyExchange handles key exchange requests from peers
-// handleKeyExchange handles key exchange requests from peers
-func (s *SyncService) handleKeyExchange(stream network.Stream) {
-	defer stream.Close()
-
-	if s.publicKey == nil {
-		fmt.Println("Cannot perform key exchange: no public key available")
-		return
-	}
-
-	// Use connection deadline instead of separate read/write deadlines
-	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
-	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
-	// Read peer's public key in chunks
-	var pemData []byte
-	buffer := make([]byte, 1024)
-	for {
-		n, err := stream.Read(buffer)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			fmt.Printf("Error reading peer's public key: %v\n", err)
-			return
-		}
-		pemData = append(pemData, buffer[:n]...)
-
-		// Check if we have a complete PEM block
-		if block, _ := pem.Decode(pemData); block != nil {
-			// If we got a complete block, we can stop reading
-			break
-		}
-	}
-
-	// Parse peer's public key
-	block, _ := pem.Decode(pemData)
-	if block == nil {
-		fmt.Println("Failed to decode peer's public key: empty block")
-		return
-	}
-
-	// Support different key formats
-	var peerPubKey *rsa.PublicKey
-	var err error
-
-	switch block.Type {
-	case "RSA PUBLIC KEY":
-		// Try PKCS1 format
-		directKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
-		if err != nil {
-			fmt.Printf("Failed to parse as PKCS1: %v\n", err)
-		} else {
-			peerPubKey = directKey
-		}
-	case "PUBLIC KEY":
-		// Try PKIX format
-		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
-		if err != nil {
-			fmt.Printf("Failed to parse peer's public key: %v\n", err)
-			return
-		}
-		var ok bool
-		peerPubKey, ok = pub.(*rsa.PublicKey)
-		if !ok {
-			fmt.Println("Peer's key is not an RSA public key")
-			return
-		}
-	default:
-		fmt.Printf("Unknown key format: %s\n", block.Type)
-		return
-	}
-
-	// Calculate fingerprint
-	publicKeyDER, err := x509.MarshalPKIXPublicKey(peerPubKey)
-	if err != nil {
-		fmt.Printf("Failed to marshal peer's public key: %v\n", err)
-		return
-	}
-
-	hash := sha256.Sum256(publicKeyDER)
-	fingerprint := base64.StdEncoding.EncodeToString(hash[:])
-
-	// Send our public key in response
-	ourPublicKeyDER, err := x509.MarshalPKIXPublicKey(s.publicKey)
-	if err != nil {
-		fmt.Printf("Failed to marshal our public key: %v\n", err)
-		return
-	}
-
-	ourPublicKeyBlock := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: ourPublicKeyDER,
-	}
-
-	ourPubKeyPEM := pem.EncodeToMemory(ourPublicKeyBlock)
-	_, err = stream.Write(ourPubKeyPEM)
-	if err != nil {
-		fmt.Printf("Failed to send our public key: %v\n", err)
-		return
-	}
-
-	// Store peer info automatically
-	peerID := stream.Conn().RemotePeer()
-	s.trustedPeers[peerID] = &PeerInfo{
-		ID:           peerID,
-		PublicKey:    peerPubKey,
-		Fingerprint:  fingerprint,
-		TrustedSince: time.Now(),
-	}
-
-	fmt.Printf("Key exchange completed with peer %s (fingerprint: %s)\n", peerID.String(), fingerprint)
-}
-
-// handleAuthentication handles authentication requests from peers
-func (s *SyncService) handleAuthentication(stream network.Stream) {
-	defer stream.Close()
-
-	// Read challenge with timeout
-	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
-	var challenge struct {
-		Challenge []byte `json:"challenge"`
-		Sender    string `json:"sender"`
-	}
-
-	if err := json.NewDecoder(stream).Decode(&challenge); err != nil {
-		fmt.Printf("Error reading authentication challenge: %v\n", err)
-		return
-	}
-
-	// Sign the challenge with our private key
-	challengeHash := sha256.Sum256(challenge.Challenge)
-	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, challengeHash[:])
-	if err != nil {
-		fmt.Printf("Error signing challenge: %v\n", err)
-		return
-	}
-
-	// Send response with timeout
-	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
-	response := struct {
-		Signature []byte `json:"signature"`
-		VaultID   string `json:"vault_id"`
-		Name      string `json:"name"`
-	}{
-		Signature: signature,
-		VaultID:   s.vaultConfig.VaultID,
-		Name:      s.vaultConfig.Name,
-	}
-
-	if err := json.NewEncoder(stream).Encode(response); err != nil {
-		fmt.Printf("Error sending authentication response: %v\n", err)
-	}
-}
-
 // handleManifestRequest processes requests for vault manifests
 func (s *SyncService) handleManifestRequest(stream network.Stream) {
 	defer stream.Close()
 
 	peerID := stream.Conn().RemotePeer()
 
-	// If we have RSA keys and not trusting all peers, verify the peer is trusted
-	if s.privateKey != nil && !s.trustAllPeers {
-		if _, ok := s.trustedPeers[peerID]; !ok {
+	// Vaults with sync keys only serve their trusted peers
+	if s.privateKey != nil {
+		if !s.trusted(peerID) {
 			fmt.Printf("Rejecting manifest request from untrusted peer: %s\n", peerID.String())
 			// Send error response
 			errorResponse := struct {
@@ -349,6 +300,11 @@ func (s *SyncService) handleManifestRequest(stream network.Stream) {
 			_ = json.NewEncoder(stream).Encode(errorResponse)
 			return
 		}
+		if !s.peerAuthenticated(peerID) {
+			fmt.Printf("Rejecting manifest request from unauthenticated peer: %s\n", peerID.String())
+			rejectJSON(stream, errNotAuthenticated)
+			return
+		}
 	}
 
 	// Get our vault manifest
@@ -366,22 +322,33 @@ func (s *SyncService) handleManifestRequest(stream network.Stream) {
 		return
 	}
 
+	tombstones, err := s.vaultMgr.Tombstones()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	// Only list the files this peer is allowed to see
+	rules := s.accessRules(peerID)
+	files := filterFilesForPeer(rules, manifest.Files)
+
 	// Prepare response with correct structure
 	response := struct {
-		Files []*config.FileManifest `json:"files"`
-		Error string                 `json:"error,omitempty"`
+		Files      []*config.FileManifest `json:"files"`
+		Tombstones []config.Tombstone     `json:"tombstones,omitempty"`
+		Error      string                 `json:"error,omitempty"`
 	}{
-		Files: make([]*config.FileManifest, len(manifest.Files)),
+		Files:      make([]*config.FileManifest, len(files)),
+		Tombstones: filterTombstonesForPeer(rules, tombstones),
 	}
 
 	// Convert from value to pointer slices
-	for i := range manifest.Files {
-		fileCopy := manifest.Files[i] // Create a copy to avoid aliasing issues
+	for i := range files {
+		fileCopy := files[i] // Create a copy to avoid aliasing issues
 		response.Files[i] = &fileCopy
 	}
 
 	// Encode and send the manifest with timeout
-	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Manifest))
 	if err := json.NewEncoder(stream).Encode(response); err != nil {
 		fmt.Printf("Error sending manifest: %v\n", err)
 	}
@@ -392,94 +359,95 @@ func (s *SyncService) handleChunkRequest(stream network.Stream) {
 	defer stream.Close()
 
 	peerID := stream.Conn().RemotePeer()
+	codec := chunkCodecFor(stream.Protocol())
 
-	// If we have RSA keys and not trusting all peers, verify the peer is trusted
+	// Vaults with sync keys only serve their trusted peers
 	var peerInfo *PeerInfo
-	if s.privateKey != nil && !s.trustAllPeers {
+	if s.privateKey != nil {
 		var ok bool
 		peerInfo, ok = s.trustedPeers[peerID]
 		if !ok {
 			fmt.Printf("Rejecting chunk request from untrusted peer: %s\n", peerID.String())
 
 			// Send error response
-			errorResponse := struct {
-				Error string `json:"error"`
-			}{
-				Error: "Unauthorized: Peer not trusted",
-			}
-			_ = json.NewEncoder(stream).Encode(errorResponse)
+			_ = codec.writeResponse(stream, chunkResponse{Error: "Unauthorized: Peer not trusted"})
+			return
+		}
+		if !s.peerAuthenticated(peerID) {
+			fmt.Printf("Rejecting chunk request from unauthenticated peer: %s\n", peerID.String())
+			_ = codec.writeResponse(stream, chunkResponse{Error: errNotAuthenticated})
 			return
 		}
 	}
 
 	// Read the chunk hash with timeout
-	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
-	var chunkRequest struct {
-		Hash          string `json:"hash"`
-		EncryptedHash string `json:"encrypted_hash,omitempty"`
-		IsEncrypted   bool   `json:"is_encrypted"`
-	}
-
-	if err := json.NewDecoder(stream).Decode(&chunkRequest); err != nil {
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Chunk))
+	request, err := codec.readRequest(stream)
+	if err != nil {
 		fmt.Printf("Error reading chunk request: %v\n", err)
 		return
 	}
 
-	// First try using the primary hash
-	chunkHash := chunkRequest.Hash
-	if s.Verbose {
-		fmt.Printf("Looking for chunk with hash: %s\n", chunkHash)
+	// Names are looked up in the chunk store, so one such as ../keys/secret.key
+	// would read outside it
+	if !validChunkName(request.Hash) || (request.EncryptedHash != "" && !validChunkName(request.EncryptedHash)) {
+		_ = codec.writeResponse(stream, chunkResponse{Error: "Invalid chunk hash"})
+		return
 	}
-	chunkData, err := s.vaultMgr.GetChunk(chunkHash)
 
-	// If that fails and we have an encrypted hash, try that
-	if err != nil && chunkRequest.EncryptedHash != "" {
-		if s.Verbose {
-			fmt.Printf("Chunk not found, trying encrypted hash: %s\n", chunkRequest.EncryptedHash)
-		}
-		chunkData, err = s.vaultMgr.GetChunk(chunkRequest.EncryptedHash)
-		if err == nil {
-			if s.Verbose {
-				fmt.Printf("Found chunk using encrypted hash\n")
-			}
+	// Peers limited by allowed_paths only get chunks of files they may see
+	if rules := s.accessRules(peerID); len(rules) > 0 {
+		manifest, err := s.vaultMgr.GetManifest()
+		if err != nil || !chunkSharedWithPeer(rules, manifest.Files, request.Hash, request.EncryptedHash) {
+			fmt.Printf("Rejecting chunk request outside allowed paths from peer: %s\n", peerID.String())
+			_ = codec.writeResponse(stream, chunkResponse{Error: "Unauthorized: Chunk not shared with this peer"})
+			return
 		}
 	}
 
-	// If still not found, return error
+	if s.Verbose {
+		fmt.Printf("Looking for chunk with hash: %s, encrypted hash: %s\n", request.Hash, request.EncryptedHash)
+	}
+	chunkData, err := s.readStoredChunk(request.Hash, request.EncryptedHash)
 	if err != nil {
 		if s.Verbose {
 			fmt.Printf("Chunk not found with either hash\n")
 		}
-		response := struct {
-			Error string `json:"error"`
-		}{
-			Error: "Chunk not found",
-		}
-		_ = json.NewEncoder(stream).Encode(response)
+		_ = codec.writeResponse(stream, chunkResponse{Error: "Chunk not found"})
 		return
 	}
 
-	// If using RSA encryption, encrypt the chunk for the recipient
+	// Compress before encrypting, if the peer asked and it helps
+	payload, compression := chunkData, ""
+	if request.AcceptCompression != "" && s.storesChunksUncompressed() {
+		payload, compression = compressChunkForTransport(chunkData, request.AcceptCompression)
+	}
+
+	// If using RSA encryption, encrypt the chunk for the recipient: to the
+	// transfer key it presented, or to its identity key if it has none
 	var encryptedData []byte
+	toTransferKey := false
 	if s.privateKey != nil && peerInfo != nil && peerInfo.PublicKey != nil {
-		encryptedData = s.encryptLargeData(chunkData, peerInfo.PublicKey)
+		key := peerInfo.PublicKey
+		if transfer := s.peerTransferKeyOf(peerID); transfer != nil {
+			key, toTransferKey = transfer.key, true
+		}
+		encryptedData = s.encryptLargeData(payload, key)
 	} else {
-		encryptedData = chunkData
+		encryptedData = payload
 	}
 
 	// Send the chunk data with timeout
-	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
-	response := struct {
-		Size      int    `json:"size"`
-		Data      []byte `json:"data"`
-		Encrypted bool   `json:"encrypted"`
-	}{
-		Size:      len(chunkData),
-		Data:      encryptedData,
-		Encrypted: (s.privateKey != nil && peerInfo != nil),
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Chunk))
+	response := chunkResponse{
+		Size:        len(chunkData),
+		Data:        encryptedData,
+		Encrypted:   (s.privateKey != nil && peerInfo != nil),
+		TransferKey: toTransferKey,
+		Compression: compression,
 	}
 
-	if err := json.NewEncoder(stream).Encode(response); err != nil {
+	if err := codec.writeResponse(stream, response); err != nil {
 		fmt.Printf("Error sending chunk: %v\n", err)
 	}
 }
@@ -512,12 +480,12 @@ func (s *SyncService) encryptLargeData(data []byte, publicKey *rsa.PublicKey) []
 	return result
 }
 
-// decryptLargeData decrypts data that was encrypted in chunks
-func (s *SyncService) decryptLargeData(data []byte) []byte {
+// decryptLargeData decrypts data that was encrypted in chunks to key
+func (s *SyncService) decryptLargeData(data []byte, key *rsa.PrivateKey) []byte {
 	result := []byte{}
 
 	// Process data in chunks based on key size
-	chunkSize := s.privateKey.Size()
+	chunkSize := key.Size()
 
 	for i := 0; i < len(data); i += chunkSize {
 		end := min(i+chunkSize, len(data))
@@ -528,7 +496,7 @@ func (s *SyncService) decryptLargeData(data []byte) []byte {
 			continue
 		}
 
-		decryptedChunk, err := rsa.DecryptPKCS1v15(rand.Reader, s.privateKey, chunk)
+		decryptedChunk, err := rsa.DecryptPKCS1v15(rand.Reader, key, chunk)
 		if err != nil {
 			fmt.Printf("Error decrypting chunk: %v\n", err)
 			continue
@@ -548,10 +516,10 @@ func (s *SyncService) VerifyAndExchangeKeys(ctx context.Context, peerID peer.ID)
 	autoTrust := s.trustAllPeers
 
 	// Check if already trusted
-	if _, ok := s.trustedPeers[peerID]; ok {
+	if info, ok := s.trustedPeers[peerID]; ok {
 		autoTrust = true
 		// We might still need to exchange keys if fingerprint is missing
-		if s.trustedPeers[peerID].Fingerprint != "" && s.trustedPeers[peerID].PublicKey != nil {
+		if info.Fingerprint != "" && info.PublicKey != nil {
 			needsKeyExchange = false
 		}
 	}
@@ -561,208 +529,48 @@ func (s *SyncService) VerifyAndExchangeKeys(ctx context.Context, peerID peer.ID)
 		return true, nil
 	}
 
+	// A recent session with a known peer spares the key exchange and the
+	// RSA operations of authentication
+	if !needsKeyExchange && s.resumeSession(ctx, peerID) {
+		return true, nil
+	}
+
 	// Do key exchange if needed
 	if needsKeyExchange {
-		// Create stream and exchange keys as in original code
-		timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-		defer cancel()
-
-		stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(KeyExchangeProtocol))
-		if err != nil {
-			// Check if we already have peer info from reverse connection
-			if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
-				fmt.Printf("Failed to open stream, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
-				return true, nil
-			}
-			return false, fmt.Errorf("failed to open key exchange stream: %w", err)
-		}
-		defer stream.Close()
-
-		// Use connection deadline instead of separate read/write deadlines
-		_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
-		_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
-		// Send our public key
-		publicKeyDER, err := x509.MarshalPKIXPublicKey(s.publicKey)
+		peerPubKey, fingerprint, err := s.exchangeKeys(ctx, peerID)
 		if err != nil {
-			return false, fmt.Errorf("failed to marshal public key: %w", err)
-		}
-
-		publicKeyBlock := &pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: publicKeyDER,
-		}
-
-		publicKeyPEM := pem.EncodeToMemory(publicKeyBlock)
-		_, err = stream.Write(publicKeyPEM)
-		if err != nil {
-			return false, fmt.Errorf("failed to send public key: %w", err)
-		}
-
-		// Read peer's public key in chunks
-		var pemData []byte
-		buffer := make([]byte, 1024)
-		for {
-			n, err := stream.Read(buffer)
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				// Check if we already have peer info from reverse connection
-				if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
-					fmt.Printf("Read error, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
+			// A transport failure is harmless if the peer's own exchange
+			// with us already delivered its key
+			var rejected *keyExchangeRejection
+			if !errors.As(err, &rejected) && !errors.Is(err, ErrPinnedKeyChanged) {
+				if peerInfo, ok := s.peerKey(peerID); ok && peerInfo.Fingerprint != "" {
+					fmt.Printf("Key exchange failed, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
 					return true, nil
 				}
-				return false, fmt.Errorf("failed reading key data: %w", err)
-			}
-			pemData = append(pemData, buffer[:n]...)
-
-			// Check if we have a complete PEM block
-			if block, _ := pem.Decode(pemData); block != nil {
-				// If we got a complete block, we can stop reading
-				break
-			}
-		}
-
-		// Parse peer's public key
-		block, _ := pem.Decode(pemData)
-		if block == nil {
-			// Check if we already have peer info from reverse connection
-			if peerInfo, ok := s.trustedPeers[peerID]; ok && peerInfo.Fingerprint != "" {
-				fmt.Printf("Failed to decode PEM block, but have fingerprint from reverse connection: %s\n", peerInfo.Fingerprint)
-				return true, nil
 			}
-			return false, fmt.Errorf("failed to decode peer's public key: empty block")
+			return false, err
 		}
 
-		// Support different key formats
-		var peerPubKey *rsa.PublicKey
-		var pub interface{}
-
-		switch block.Type {
-		case "RSA PUBLIC KEY":
-			// Try PKCS1 format
-			directKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
-			if err != nil {
-				fmt.Printf("Failed to parse as PKCS1: %v\n", err)
-			} else {
-				peerPubKey = directKey
-			}
-		case "PUBLIC KEY":
-			// Try PKIX format
-			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
-			if err != nil {
-				return false, fmt.Errorf("failed to parse PKIX public key: %w", err)
-			}
-			var ok bool
-			peerPubKey, ok = pub.(*rsa.PublicKey)
-			if !ok {
-				return false, fmt.Errorf("peer's key is not an RSA public key")
-			}
-		default:
-			return false, fmt.Errorf("unknown key format: %s", block.Type)
-		}
-
-		// Calculate fingerprint
-		peerKeyDER, err := x509.MarshalPKIXPublicKey(peerPubKey)
-		if err != nil {
-			return false, fmt.Errorf("failed to marshal peer's public key: %w", err)
-		}
-
-		hash := sha256.Sum256(peerKeyDER)
-		fingerprint := base64.StdEncoding.EncodeToString(hash[:])
-
-		// Store peer info
-		s.trustedPeers[peerID] = &PeerInfo{
-			ID:           peerID,
-			PublicKey:    peerPubKey,
-			Fingerprint:  fingerprint,
-			TrustedSince: time.Now(),
-		}
-	}
-
-	// Auto-trust if configured to do so
-	if autoTrust {
-		return true, nil
+		s.setSessionKey(peerID, peerPubKey, fingerprint)
+		s.recordAudit(audit.OpKeyExchange, map[string]string{"peer": peerID.String(), "fingerprint": fingerprint})
 	}
 
-	// Perform authentication challenge
+	// Both sides prove they hold their keys before any vault data flows
 	if err := s.authenticatePeer(ctx, peerID); err != nil {
-		delete(s.trustedPeers, peerID)
+		if !autoTrust {
+			s.forgetSessionKey(peerID)
+		}
 		return false, fmt.Errorf("authentication failed: %w", err)
 	}
 
 	return true, nil
 }
 
-// authenticatePeer sends an authentication challenge to verify peer identity
-func (s *SyncService) authenticatePeer(ctx context.Context, peerID peer.ID) error {
-	// Create a context with timeout
-	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(AuthProtocol))
-	if err != nil {
-		return fmt.Errorf("failed to open authentication stream: %w", err)
-	}
-	defer stream.Close()
-
-	// Generate random challenge
-	challenge := make([]byte, 32)
-	_, err = rand.Read(challenge)
-	if err != nil {
-		return fmt.Errorf("failed to generate challenge: %w", err)
-	}
-
-	// Send challenge with timeout
-	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
-	request := struct {
-		Challenge []byte `json:"challenge"`
-		Sender    string `json:"sender"`
-	}{
-		Challenge: challenge,
-		Sender:    s.vaultConfig.VaultID,
-	}
-
-	if err := json.NewEncoder(stream).Encode(request); err != nil {
-		return fmt.Errorf("failed to send challenge: %w", err)
-	}
-
-	// Read response with timeout
-	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
-	var response struct {
-		Signature []byte `json:"signature"`
-		VaultID   string `json:"vault_id"`
-		Name      string `json:"name"`
-	}
-
-	if err := json.NewDecoder(stream).Decode(&response); err != nil {
-		return fmt.Errorf("failed to read auth response: %w", err)
-	}
-
-	// Get peer's public key
-	peerInfo, ok := s.trustedPeers[peerID]
-	if !ok {
-		return fmt.Errorf("peer not found in trusted list")
-	}
-
-	// Verify signature
-	challengeHash := sha256.Sum256(challenge)
-	err = rsa.VerifyPKCS1v15(peerInfo.PublicKey, crypto.SHA256, challengeHash[:], response.Signature)
-	if err != nil {
-		return fmt.Errorf("signature verification failed: %w", err)
-	}
-
-	// Update peer info with vault details
-	peerInfo.Name = response.Name
-
-	return nil
-}
-
 // GetPeerFingerprint returns the fingerprint of a peer's public key
 func (s *SyncService) GetPeerFingerprint(peerID peer.ID) (string, error) {
-	peerInfo, ok := s.trustedPeers[peerID]
+	peerInfo, ok := s.peerKey(peerID)
 	if !ok {
-		return "", fmt.Errorf("peer not found in trusted list")
+		return "", fmt.Errorf("no key known for peer")
 	}
 
 	return peerInfo.Fingerprint, nil
@@ -770,10 +578,14 @@ func (s *SyncService) GetPeerFingerprint(peerID peer.ID) (string, error) {
 
 // AddTrustedPeer adds a peer to the trusted peers list and saves to config
 func (s *SyncService) AddTrustedPeer(ctx context.Context, peerID peer.ID) error {
-	peerInfo, ok := s.trustedPeers[peerID]
+	peerInfo, ok := s.peerKey(peerID)
 	if !ok {
-		return fmt.Errorf("peer not found in temporary trusted list")
+		return fmt.Errorf("no key exchanged with peer")
 	}
+	if err := s.checkPinnedKey(peerID, peerInfo.PublicKey, peerInfo.Fingerprint); err != nil {
+		return err
+	}
+	s.trustedPeers[peerID] = peerInfo
 
 	// Add to permanent trusted peers in config
 	if s.rsaConfig != nil && peerInfo.PublicKey != nil {
@@ -831,6 +643,11 @@ func (s *SyncService) AddTrustedPeer(ctx context.Context, peerID peer.ID) error
 		if err := s.vaultMgr.SaveConfig(s.vaultConfig); err != nil {
 			return fmt.Errorf("failed to save updated config: %w", err)
 		}
+		s.recordAudit(audit.OpTrust, map[string]string{
+			"action":      "trust",
+			"peer":        peerID.String(),
+			"fingerprint": peerInfo.Fingerprint,
+		})
 
 		// // Pretty print newly trusted peer
 		// data, err := yaml.Marshal(trustedPeer)
@@ -846,14 +663,18 @@ func (s *SyncService) AddTrustedPeer(ctx context.Context, peerID peer.ID) error
 	return nil
 }
 
-// SyncWithPeer performs a sync operation with a specific peer
+// SyncWithPeer performs a sync operation with a specific peer. If ctx is
+// cancelled while chunks are transferred, the partial result is returned
+// along with the error.
 func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncResult, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
 	// Create a context with timeout for the entire operation
-	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Sync)
 	defer cancel()
 
 	startTime := time.Now()
-	result := &SyncResult{}
 
 	// First verify and exchange keys with peer (will auto-trust if trustAllPeers is true)
 	if s.Verbose {
@@ -870,17 +691,24 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 	if s.Verbose {
 		fmt.Printf("Peer %s is trusted, proceeding with sync\n", peerID.String())
 	}
+	if err := s.checkPeerCompatible(timeoutCtx, peerID); err != nil {
+		return nil, err
+	}
 
-	// Step 1: Get remote manifest
+	// Step 1: Get the remote manifests changed since the last complete sync
 	if s.Verbose {
 		fmt.Printf("Retrieving manifest from peer %s...\n", peerID.String())
 	}
-	remoteManifest, err := s.getRemoteManifest(timeoutCtx, peerID)
+	remoteManifest, cursor, full, err := s.getRemoteManifestSince(timeoutCtx, peerID, s.cursorFor(peerID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get remote manifest: %v", err)
 	}
 	if s.Verbose {
-		fmt.Printf("Retrieved manifest from peer with %d files\n", len(remoteManifest.Files))
+		if full {
+			fmt.Printf("Retrieved manifest from peer with %d files\n", len(remoteManifest.Files))
+		} else {
+			fmt.Printf("Retrieved %d files changed on the peer since the last sync\n", len(remoteManifest.Files))
+		}
 	}
 
 	// Step 2: Get local manifest
@@ -889,6 +717,122 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 		return nil, fmt.Errorf("failed to get local manifest: %v", err)
 	}
 
+	// Let the peer work out which of its chunks we lack, so chunks it
+	// references but does not hold are not requested
+	offered, err := s.exchangeHaves(timeoutCtx, peerID, localManifest)
+	if err != nil {
+		fmt.Printf("Warning: have-list exchange with peer %s failed: %v\n", peerID.String(), err)
+		offered = nil
+	}
+	s.recordPeerManifest(peerID, remoteManifest, localManifest, offered, full)
+
+	// Steps 3-6: Fetch missing chunks, save manifests and rebuild references
+	fetch := onlyOffered(offered, s.withRetry(timeoutCtx, s.Retry, func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		return s.fetchChunk(timeoutCtx, peerID, chunkHash, encryptedHash)
+	}))
+	result, err := s.applyManifestDiff(localManifest, remoteManifest, fetch, s.fromPeer(peerID))
+	if err != nil {
+		return nil, err
+	}
+	if result.Interrupted {
+		return s.interrupted(timeoutCtx, "peer", peerID.String(), result, startTime)
+	}
+
+	// Skipped files must be listed again next time, so the cursor only
+	// advances past a sync that got everything
+	if cursor != "" && len(result.FailedChunks) == 0 {
+		if err := s.saveSyncCursor(peerID, cursor); err != nil {
+			fmt.Printf("Warning: failed to save sync cursor: %v\n", err)
+		}
+	}
+
+	result.Duration = time.Since(startTime)
+	if s.Verbose {
+		fmt.Printf("Sync completed in %v: %d files, %d chunks transferred, %d chunks reused\n",
+			result.Duration, result.FileCount, result.ChunksTransferred, result.ChunksDeduplicated)
+	}
+
+	s.recordSync("peer", peerID.String(), result, nil)
+	return result, nil
+}
+
+// recordSync adds a completed or interrupted sync with the given source to the
+// audit log and the sync history, then runs the post_sync hooks; syncErr is
+// why an interrupted sync stopped
+func (s *SyncService) recordSync(sourceKind, source string, result *SyncResult, syncErr error) {
+	details := map[string]string{
+		sourceKind: source,
+		"session":  result.Session,
+		"files":    strconv.Itoa(result.FileCount),
+		"chunks":   strconv.Itoa(result.ChunksTransferred),
+		"bytes":    strconv.FormatInt(result.BytesTransferred, 10),
+		"deleted":  strconv.Itoa(len(result.FilesDeleted)),
+	}
+	if result.Interrupted {
+		details["interrupted"] = strconv.Itoa(result.ChunksRemaining)
+	}
+	if len(result.CorruptChunks) > 0 {
+		details["corrupt_chunks"] = strconv.Itoa(len(result.CorruptChunks))
+	}
+	s.recordAudit(audit.OpSync, details)
+
+	run := newSyncRun(sourceKind, source, result, syncErr)
+	s.recordHistory(run)
+	if cfg, err := s.vaultMgr.GetConfig(); err == nil {
+		hooks.Notify(s.vaultMgr.VaultRoot(), cfg, hooks.PostSync, run)
+	}
+}
+
+// interrupted finishes a sync that ctx stopped before it fetched every
+// chunk, returning its partial result along with the reason
+func (s *SyncService) interrupted(ctx context.Context, sourceKind, source string, result *SyncResult, startTime time.Time) (*SyncResult, error) {
+	result.Duration = time.Since(startTime)
+	cause := ctx.Err()
+	if cause == nil {
+		cause = context.Canceled
+	}
+	err := fmt.Errorf("sync interrupted with %d chunks left to fetch: %w", result.ChunksRemaining, cause)
+	s.recordSync(sourceKind, source, result, err)
+	return result, err
+}
+
+// recordAudit appends an entry to the vault's audit log. The operation has
+// already happened, so a failure is reported without failing it.
+func (s *SyncService) recordAudit(operation string, details map[string]string) {
+	if err := audit.Record(s.vaultMgr.VaultRoot(), operation, details); err != nil {
+		fmt.Printf("Warning: failed to record %s in audit log: %v\n", operation, err)
+	}
+}
+
+// chunkFetcher retrieves the stored bytes of a chunk from the other side of a
+// sync, along with the size reported for it
+type chunkFetcher func(chunkHash, encryptedHash string) ([]byte, int, error)
+
+// applyManifestDiff copies the chunks and file manifests that remoteManifest has
+// and localManifest lacks into the local vault, reading chunk data through fetch.
+// Each saved manifest records the sync in its provenance, with the source from.
+// Fetched chunks are checked against the hashes the manifest records for them
+// before they are stored. A chunk that cannot be fetched or does not match is
+// skipped along with the files that use it; since those files are not saved,
+// the next sync fetches their chunks again.
+// A cancelled fetch stops the transfer the same way for all remaining chunks.
+// Deletions recorded in the remote tombstones are applied first. Files and
+// deletions with unsafe paths are dropped before anything is written.
+func (s *SyncService) applyManifestDiff(localManifest, remoteManifest *config.Manifest, fetch chunkFetcher, from originFunc) (*SyncResult, error) {
+	result := &SyncResult{Session: newSyncSession()}
+	remoteManifest, result.RejectedFiles = sanitizeRemoteManifest(remoteManifest)
+
+	localManifest, remoteManifest, deleted, err := s.applyTombstones(localManifest, remoteManifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply deletions: %v", err)
+	}
+	result.FilesDeleted = deleted
+
+	vaultConfig, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vault configuration: %v", err)
+	}
+
 	// Step 3: Find missing chunks
 	missingChunks := s.findMissingChunks(localManifest, remoteManifest)
 	if s.Verbose {
@@ -896,39 +840,41 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 	}
 
 	// Step 4: Fetch missing chunks
+	var remaining []string
 	for i, chunkHash := range missingChunks {
 		if s.Verbose && i%10 == 0 {
 			fmt.Printf("Fetching chunk %d of %d...\n", i+1, len(missingChunks))
 		}
 
-		exists, _ := s.vaultMgr.ChunkExists(chunkHash)
-		if exists {
+		ref := chunkRefFor(remoteManifest, chunkHash)
+		if s.holdsChunk(ref) {
 			result.ChunksDeduplicated++
 			continue
 		}
 
-		// Find associated encrypted hash if any
-		var encryptedHash string
-		for _, file := range remoteManifest.Files {
-			for _, chunk := range file.Chunks {
-				if chunk.Hash == chunkHash && chunk.EncryptedHash != "" {
-					encryptedHash = chunk.EncryptedHash
-					break
-				}
-			}
-			if encryptedHash != "" {
-				break
-			}
+		chunkData, size, err := fetch(chunkHash, ref.EncryptedHash)
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			// Keep what was fetched so far; files still missing chunks are
+			// skipped below like those with failed chunks
+			result.Interrupted = true
+			remaining = missingChunks[i:]
+			result.ChunksRemaining = len(remaining)
+			break
 		}
-
-		// Pass the encrypted hash directly to fetchChunk
-		chunkData, size, err := s.fetchChunk(timeoutCtx, peerID, chunkHash, encryptedHash)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch chunk %s: %v", chunkHash, err)
+			fmt.Printf("Warning: skipping chunk %s: %v\n", chunkHash, err)
+			result.FailedChunks = append(result.FailedChunks, chunkHash)
+			continue
+		}
+		if err := chunk.VerifyStored(chunkData, ref, *vaultConfig); err != nil {
+			fmt.Printf("Warning: rejecting chunk %s: %v\n", chunkHash, err)
+			result.FailedChunks = append(result.FailedChunks, chunkHash)
+			result.CorruptChunks = append(result.CorruptChunks, chunkHash)
+			continue
 		}
 
 		// Store the chunk with both hashes if needed
-		if err := s.StoreChunk(chunkHash, chunkData, encryptedHash); err != nil {
+		if err := s.StoreChunk(chunkHash, chunkData, ref.EncryptedHash); err != nil {
 			return nil, fmt.Errorf("failed to store chunk %s: %v", chunkHash, err)
 		}
 
@@ -941,34 +887,30 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 		fmt.Println("Saving file manifests...")
 	}
 	savedCount := 0
-	for _, remoteFile := range remoteManifest.Files {
-		// Check if this file already exists locally
-		exists := false
-		for _, localFile := range localManifest.Files {
-			if localFile.FilePath == remoteFile.FilePath {
-				exists = true
-				break
-			}
+	now := time.Now().UTC()
+	for _, remoteFile := range newRemoteFiles(localManifest, remoteManifest) {
+		// Create a copy of the file manifest to avoid pointer issues
+		fileManifest := remoteFile
+
+		if usesAnyChunk(&fileManifest, result.FailedChunks) || usesAnyChunk(&fileManifest, remaining) {
+			result.IncompleteFiles = append(result.IncompleteFiles, fileManifest.Destination+fileManifest.FilePath)
+			continue
 		}
+		stampOrigin(&fileManifest, from(&remoteFile), result.Session, now)
 
-		if !exists {
-			// Create a copy of the file manifest to avoid pointer issues
-			fileManifest := remoteFile
-
-			err := manifest.StoreFileManifest(
-				s.vaultMgr.VaultRoot(),
-				fileManifest.FilePath,
-				&fileManifest,
-			)
-			if err != nil {
-				return nil, fmt.Errorf("failed to save manifest for %s: %v",
-					fileManifest.FilePath, err)
-			}
-			if s.Verbose {
-				fmt.Printf("Saved manifest for: %s\n", fileManifest.FilePath)
-			}
-			savedCount++
+		err := manifest.StoreFileManifest(
+			s.vaultMgr.VaultRoot(),
+			fileManifest.FilePath,
+			&fileManifest,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save manifest for %s: %v",
+				fileManifest.FilePath, err)
+		}
+		if s.Verbose {
+			fmt.Printf("Saved manifest for: %s\n", fileManifest.FilePath)
 		}
+		savedCount++
 	}
 	if s.Verbose {
 		fmt.Printf("Saved %d file manifests\n", savedCount)
@@ -979,40 +921,171 @@ func (s *SyncService) SyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncRe
 	if err := s.vaultMgr.RebuildReferences(); err != nil {
 		return nil, fmt.Errorf("failed to rebuild references: %v", err)
 	}
+	s.vaultMgr.RefreshIndex()
 
-	result.Duration = time.Since(startTime)
-	if s.Verbose {
-		fmt.Printf("Sync completed in %v: %d files, %d chunks transferred, %d chunks reused\n",
-			result.Duration, result.FileCount, result.ChunksTransferred, result.ChunksDeduplicated)
+	if _, err := s.vaultMgr.PruneTombstones(s.tombstoneRetention()); err != nil {
+		fmt.Printf("Warning: failed to prune tombstones: %v\n", err)
 	}
 
 	return result, nil
 }
 
+// PlanSyncWithPeer runs the same key verification and manifest diff as SyncWithPeer
+// but only reports what would be fetched, without transferring chunks or writing manifests.
+// It also estimates what the peer would fetch from this vault when it syncs in turn.
+func (s *SyncService) PlanSyncWithPeer(ctx context.Context, peerID peer.ID) (*SyncPlan, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Sync)
+	defer cancel()
+
+	trusted, err := s.VerifyAndExchangeKeys(timeoutCtx, peerID)
+	if err != nil {
+		return nil, fmt.Errorf("key exchange failed: %w", err)
+	}
+	if !trusted {
+		return nil, fmt.Errorf("peer %s is not trusted", peerID.String())
+	}
+	if err := s.checkPeerCompatible(timeoutCtx, peerID); err != nil {
+		return nil, err
+	}
+
+	remoteManifest, _, full, err := s.getRemoteManifestSince(timeoutCtx, peerID, s.cursorFor(peerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote manifest: %v", err)
+	}
+	localManifest, err := s.vaultMgr.GetManifest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local manifest: %v", err)
+	}
+
+	plan := s.planManifestDiff(localManifest, remoteManifest)
+
+	// What the peer would fetch from us is judged against its whole listing
+	if !full {
+		if remoteManifest, err = s.getRemoteManifest(timeoutCtx, peerID); err != nil {
+			return nil, fmt.Errorf("failed to get remote manifest: %v", err)
+		}
+	}
+	peerPlan := PeerPlan{Peer: peerID.String(), ChunksToDownload: plan.ChunksToTransfer, BytesToDownload: plan.BytesToTransfer}
+	peerPlan.FilesToUpload, peerPlan.ChunksToUpload, peerPlan.BytesToUpload = uploadPlan(localManifest, remoteManifest)
+	plan.Peers = []PeerPlan{peerPlan}
+	return plan, nil
+}
+
+// planManifestDiff reports what applyManifestDiff would copy from remoteManifest
+func (s *SyncService) planManifestDiff(localManifest, remoteManifest *config.Manifest) *SyncPlan {
+	plan := &SyncPlan{}
+	remoteManifest, plan.Rejected = sanitizeRemoteManifest(remoteManifest)
+	localManifest, remoteManifest, plan.Deletions = s.planTombstones(localManifest, remoteManifest)
+	for _, chunkHash := range s.findMissingChunks(localManifest, remoteManifest) {
+		if s.holdsChunk(chunkRefFor(remoteManifest, chunkHash)) {
+			plan.ChunksDeduplicated++
+			continue
+		}
+		plan.ChunksToTransfer++
+		plan.BytesToTransfer += storedChunkSize(remoteManifest, chunkHash)
+	}
+	for _, file := range newRemoteFiles(localManifest, remoteManifest) {
+		plan.Files = append(plan.Files, file.Destination+file.FilePath)
+	}
+	plan.Conflicts = conflictingFiles(localManifest, remoteManifest)
+	return plan
+}
+
+// usesAnyChunk reports whether file references one of chunks
+func usesAnyChunk(file *config.FileManifest, chunks []string) bool {
+	for _, chunk := range file.Chunks {
+		if slices.Contains(chunks, chunk.Hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRemoteFiles returns the remote files that do not exist locally
+func newRemoteFiles(local, remote *config.Manifest) []config.FileManifest {
+	var files []config.FileManifest
+	for _, remoteFile := range remote.Files {
+		exists := false
+		for _, localFile := range local.Files {
+			if localFile.FilePath == remoteFile.FilePath {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			files = append(files, remoteFile)
+		}
+	}
+	return files
+}
+
+// storedChunkSize returns the on-disk size of a chunk as described by the manifest
+func storedChunkSize(m *config.Manifest, chunkHash string) int64 {
+	for _, file := range m.Files {
+		for _, chunk := range file.Chunks {
+			if chunk.Hash != chunkHash {
+				continue
+			}
+			switch {
+			case chunk.EncryptedSize > 0:
+				return chunk.EncryptedSize
+			case chunk.CompressedSize > 0:
+				return chunk.CompressedSize
+			default:
+				return chunk.Size
+			}
+		}
+	}
+	return 0
+}
+
+// chunkRefFor returns the reference m holds to chunkHash, preferring one with
+// an encrypted hash
+func chunkRefFor(m *config.Manifest, chunkHash string) config.ChunkRef {
+	ref := config.ChunkRef{Hash: chunkHash}
+	found := false
+	for _, file := range m.Files {
+		for _, chunk := range file.Chunks {
+			if chunk.Hash != chunkHash {
+				continue
+			}
+			if chunk.EncryptedHash != "" {
+				return chunk
+			}
+			if !found {
+				ref, found = chunk, true
+			}
+		}
+	}
+	return ref
+}
+
 // getRemoteManifest fetches the manifest from a remote peer
 func (s *SyncService) getRemoteManifest(ctx context.Context, peerID peer.ID) (*config.Manifest, error) {
 	// Create a context with timeout
-	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Manifest)
 	defer cancel()
 
-	// Try current protocol version first
-	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(ManifestProtocolID))
-	// If current version fails, try fallback
+	// Use the newest protocol version the peer announced
+	protocolID, err := s.selectProtocol(timeoutCtx, peerID, ManifestProtocolID, ManifestProtocolIDv0)
 	if err != nil {
-		stream, err = s.host.NewStream(timeoutCtx, peerID, protocol.ID(ManifestProtocolIDv0))
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect with any protocol version: %w", err)
-		}
+		return nil, err
+	}
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest stream: %w", err)
 	}
 	defer stream.Close()
+	defer resetOnCancel(timeoutCtx, stream)()
 
 	// Set read deadline
-	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Manifest))
 
 	// Read the manifest
 	var response struct {
-		Error string                 `json:"error,omitempty"`
-		Files []*config.FileManifest `json:"files,omitempty"`
+		Error      string                 `json:"error,omitempty"`
+		Files      []*config.FileManifest `json:"files,omitempty"`
+		Tombstones []config.Tombstone     `json:"tombstones,omitempty"`
 	}
 
 	if err := json.NewDecoder(stream).Decode(&response); err != nil {
@@ -1030,7 +1103,8 @@ func (s *SyncService) getRemoteManifest(ctx context.Context, peerID peer.ID) (*c
 		}
 	}
 	manifest := &config.Manifest{
-		Files: valueFiles,
+		Files:      valueFiles,
+		Tombstones: response.Tombstones,
 	}
 
 	return manifest, nil
@@ -1100,55 +1174,66 @@ func (s *SyncService) findMissingChunks(local, remote *config.Manifest) []string
 	return missingChunks
 }
 
+// FetchChunk downloads a single chunk referenced by a manifest from a remote peer
+func (s *SyncService) FetchChunk(ctx context.Context, peerID peer.ID, ref config.ChunkRef) ([]byte, error) {
+	data, _, err := s.fetchChunk(ctx, peerID, ref.Hash, ref.EncryptedHash)
+	return data, err
+}
+
+// resetOnCancel aborts stream as soon as ctx is done, so that a blocked
+// read or write returns at once instead of at its deadline and the peer sees
+// the stream end. The returned function stops watching ctx; it must be
+// called, before ctx is cancelled, once the stream is done with.
+func resetOnCancel(ctx context.Context, stream network.Stream) func() bool {
+	return context.AfterFunc(ctx, func() { _ = stream.Reset() })
+}
+
 // fetchChunk downloads a chunk from a remote peer
 func (s *SyncService) fetchChunk(ctx context.Context, peerID peer.ID, hash string, encryptedHash string) ([]byte, int, error) {
 	// Create a context with timeout
-	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.timeouts().Chunk)
 	defer cancel()
 
 	// Use the provided encrypted hash instead of looking it up
 	isEncrypted := encryptedHash != "" && s.privateKey != nil
 
-	// Open a stream to the peer
-	stream, err := s.host.NewStream(timeoutCtx, peerID, protocol.ID(ChunkProtocolID))
+	// Open a stream to the peer with the newest chunk framing it announced
+	protocolID, err := s.selectProtocol(timeoutCtx, peerID, ChunkProtocolID, ChunkProtocolIDv1)
+	if err != nil {
+		return nil, 0, err
+	}
+	stream, err := s.host.NewStream(timeoutCtx, peerID, protocolID)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to open chunk stream: %w", err)
 	}
 	defer stream.Close()
+	defer resetOnCancel(timeoutCtx, stream)()
+	codec := chunkCodecFor(stream.Protocol())
 
 	// Set write deadline
-	_ = stream.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	_ = stream.SetWriteDeadline(time.Now().Add(s.timeouts().Chunk))
 
 	// Send chunk request with both hash types
-	request := struct {
-		Hash          string `json:"hash"`
-		EncryptedHash string `json:"encrypted_hash,omitempty"`
-		IsEncrypted   bool   `json:"is_encrypted"`
-	}{
-		Hash:          hash,
-		EncryptedHash: encryptedHash,
-		IsEncrypted:   isEncrypted,
+	request := chunkRequest{
+		Hash:              hash,
+		EncryptedHash:     encryptedHash,
+		IsEncrypted:       isEncrypted,
+		AcceptCompression: s.transportCompressionFor(timeoutCtx, peerID),
 	}
 
 	if s.Verbose {
 		fmt.Printf("Requesting chunk with hash: %s, encrypted hash: %s\n", hash, encryptedHash)
 	}
-	if err := json.NewEncoder(stream).Encode(request); err != nil {
+	if err := codec.writeRequest(stream, request); err != nil {
 		return nil, 0, fmt.Errorf("failed to send chunk request: %w", err)
 	}
 
 	// Set read deadline
-	_ = stream.SetReadDeadline(time.Now().Add(30 * time.Second))
+	_ = stream.SetReadDeadline(time.Now().Add(s.timeouts().Chunk))
 
 	// Read response
-	var response struct {
-		Error     string `json:"error,omitempty"`
-		Size      int    `json:"size,omitempty"`
-		Data      []byte `json:"data,omitempty"`
-		Encrypted bool   `json:"encrypted"`
-	}
-
-	if err := json.NewDecoder(stream).Decode(&response); err != nil {
+	response, err := codec.readResponse(stream)
+	if err != nil {
 		return nil, 0, fmt.Errorf("failed to decode chunk response: %w", err)
 	}
 
@@ -1159,30 +1244,53 @@ func (s *SyncService) fetchChunk(ctx context.Context, peerID peer.ID, hash strin
 	// Decrypt data if necessary
 	var chunkData []byte
 	if response.Encrypted && s.privateKey != nil {
-		chunkData = s.decryptLargeData(response.Data)
+		key, err := s.decryptionKey(peerID, response.TransferKey)
+		if err != nil {
+			return nil, 0, err
+		}
+		chunkData = s.decryptLargeData(response.Data, key)
 	} else {
 		chunkData = response.Data
 	}
+	if response.Compression != "" {
+		if response.Compression != request.AcceptCompression {
+			return nil, 0, fmt.Errorf("peer compressed the chunk with %q, which was not asked for", response.Compression)
+		}
+		if chunkData, err = decompressChunkFromTransport(chunkData, response.Compression); err != nil {
+			return nil, 0, err
+		}
+	}
 
 	return chunkData, response.Size, nil
 }
 
-// StoreChunk stores a chunk and handles the relationship between regular and encrypted hashes
+// StoreChunk stores a chunk once, under the name chunk files of this vault
+// are stored by: the hash of its ciphertext if it has one. Lookups by its
+// plaintext hash find it through the vault's chunk aliases.
 func (s *SyncService) StoreChunk(hash string, data []byte, encryptedHash string) error {
-	// Store the chunk with the primary hash
-	if err := s.vaultMgr.StoreChunk(hash, data); err != nil {
-		return fmt.Errorf("failed to store chunk with regular hash: %w", err)
+	name := chunk.StorageName(config.ChunkRef{Hash: hash, EncryptedHash: encryptedHash})
+	if err := s.vaultMgr.StoreChunk(name, data); err != nil {
+		return fmt.Errorf("failed to store chunk %s: %w", name, err)
 	}
+	return nil
+}
 
-	// If we have an encrypted hash, store with that too
+// readStoredChunk reads a chunk of this vault under the name it is stored by,
+// then under its plaintext hash, where chunks synced by older releases kept a
+// second copy. Without an encrypted hash, the chunk aliases resolve it.
+func (s *SyncService) readStoredChunk(hash, encryptedHash string) ([]byte, error) {
 	if encryptedHash != "" {
-		if err := s.vaultMgr.StoreChunk(encryptedHash, data); err != nil {
-			fmt.Printf("Warning: Failed to store chunk with encrypted hash: %v\n", err)
-			// Continue anyway since we stored it with the regular hash
+		if data, err := s.vaultMgr.GetChunk(encryptedHash); err == nil {
+			return data, nil
 		}
 	}
-
-	return nil
+	data, err := s.vaultMgr.GetChunk(hash)
+	if err != nil && encryptedHash == "" {
+		if name, ok := s.vaultMgr.ChunkAliases()[hash]; ok {
+			return s.vaultMgr.GetChunk(name)
+		}
+	}
+	return data, err
 }
 
 // HasPeer returns true if peer is already in trustedPeers map
@@ -1190,6 +1298,13 @@ func (s *SyncService) HasPeer(id peer.ID) bool {
 	if s == nil {
 		return false
 	}
-	_, ok := s.trustedPeers[id]
+	return s.trusted(id)
+}
+
+// trusted reports whether the vault serves peerID: it is one of the trusted
+// peers of the vault's configuration, or was paired with or trusted since.
+// Completing a key exchange does not make a peer trusted.
+func (s *SyncService) trusted(peerID peer.ID) bool {
+	_, ok := s.trustedPeers[peerID]
 	return ok
 }
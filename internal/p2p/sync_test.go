@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
 )
 
 // TestHasPeer ensures HasPeer returns false for unknown peer and true after insertion
@@ -27,3 +29,70 @@ func TestHasPeer(t *testing.T) {
 		t.Fatalf("expected HasPeer to return true after insertion")
 	}
 }
+
+// TestNewRemoteFilesAndStoredChunkSize covers the manifest diff used by sync planning
+func TestNewRemoteFilesAndStoredChunkSize(t *testing.T) {
+	local := &config.Manifest{Files: []config.FileManifest{{FilePath: "a.txt"}}}
+	remote := &config.Manifest{Files: []config.FileManifest{
+		{FilePath: "a.txt"},
+		{FilePath: "b.txt", Chunks: []config.ChunkRef{
+			{Hash: "plain", Size: 100},
+			{Hash: "packed", Size: 100, CompressedSize: 40},
+			{Hash: "sealed", Size: 100, CompressedSize: 40, EncryptedSize: 60},
+		}},
+	}}
+
+	files := newRemoteFiles(local, remote)
+	if len(files) != 1 || files[0].FilePath != "b.txt" {
+		t.Fatalf("expected only b.txt to be new, got %v", files)
+	}
+
+	for hash, want := range map[string]int64{"plain": 100, "packed": 40, "sealed": 60, "missing": 0} {
+		if got := storedChunkSize(remote, hash); got != want {
+			t.Errorf("storedChunkSize(%s) = %d, want %d", hash, got, want)
+		}
+	}
+}
+
+func TestSyncStoresEncryptedChunksOnce(t *testing.T) {
+	local := newTestVault(t, "a.txt", hashA, "alpha")
+	s := NewLocalSyncService(local)
+	localManifest, err := local.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := testChunkHash("ciphertext")
+	remote := &config.Manifest{Files: []config.FileManifest{{
+		FilePath:    "s.txt",
+		Destination: "docs/",
+		Size:        9,
+		Chunks:      []config.ChunkRef{{Hash: "plain-hash", EncryptedHash: sealed, Size: 9, EncryptedSize: 10}},
+	}}}
+	fetches := 0
+	fetch := func(chunkHash, encryptedHash string) ([]byte, int, error) {
+		fetches++
+		return []byte("ciphertext"), 10, nil
+	}
+	if _, err := s.applyManifestDiff(localManifest, remote, fetch, fromSource("vault", "other", "")); err != nil {
+		t.Fatalf("applyManifestDiff failed: %v", err)
+	}
+
+	if exists, _ := local.ChunkExists(sealed); !exists {
+		t.Fatal("expected the chunk under the hash of its ciphertext")
+	}
+	if exists, _ := local.ChunkExists("plain-hash"); exists {
+		t.Error("expected no second copy under the plaintext hash")
+	}
+	if data, err := s.readStoredChunk("plain-hash", ""); err != nil || string(data) != "ciphertext" {
+		t.Errorf("expected the plaintext hash to resolve to the stored chunk, got %q (%v)", data, err)
+	}
+
+	// Held chunks no local file references yet, as after an interrupted
+	// sync, are recognized by their encrypted hash and not fetched again
+	remote.Files[0].FilePath = "copy.txt"
+	result, err := s.applyManifestDiff(localManifest, remote, fetch, fromSource("vault", "other", ""))
+	if err != nil || fetches != 1 || result.ChunksDeduplicated != 1 {
+		t.Errorf("expected the held chunk to be reused, got %+v after %d fetches (%v)", result, fetches, err)
+	}
+}
@@ -0,0 +1,60 @@
+package p2p
+
+import (
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// Timeouts bounds how long sync operations wait on a peer. The defaults suit
+// local networks and the internet; slow links such as satellite or HF radio
+// need larger values.
+type Timeouts struct {
+	Handshake time.Duration // Each message of the hello, key exchange, authentication and pairing protocols
+	Manifest  time.Duration // Each manifest, delta, have list, vault config or mule request
+	Chunk     time.Duration // Each chunk request and response
+	Sync      time.Duration // A whole sync or sync plan, with one peer or several
+}
+
+// DefaultTimeouts are used unless the vault's sync settings change them
+var DefaultTimeouts = Timeouts{
+	Handshake: 30 * time.Second,
+	Manifest:  30 * time.Second,
+	Chunk:     30 * time.Second,
+	Sync:      5 * time.Minute,
+}
+
+// TimeoutsFor returns the default timeouts with those set in cfg applied
+func TimeoutsFor(cfg *config.SyncConfig) Timeouts {
+	parse := func(value string) time.Duration {
+		d, _ := time.ParseDuration(value)
+		return max(d, 0)
+	}
+	return Timeouts{
+		Handshake: parse(cfg.Timeouts.Handshake),
+		Manifest:  parse(cfg.Timeouts.Manifest),
+		Chunk:     parse(cfg.Timeouts.Chunk),
+		Sync:      parse(cfg.Timeouts.Sync),
+	}.orDefaults()
+}
+
+// orDefaults returns t with each unset timeout replaced by its default
+func (t Timeouts) orDefaults() Timeouts {
+	or := func(d, def time.Duration) time.Duration {
+		if d > 0 {
+			return d
+		}
+		return def
+	}
+	return Timeouts{
+		Handshake: or(t.Handshake, DefaultTimeouts.Handshake),
+		Manifest:  or(t.Manifest, DefaultTimeouts.Manifest),
+		Chunk:     or(t.Chunk, DefaultTimeouts.Chunk),
+		Sync:      or(t.Sync, DefaultTimeouts.Sync),
+	}
+}
+
+// timeouts returns the timeouts of this service
+func (s *SyncService) timeouts() Timeouts {
+	return s.Timeouts.orDefaults()
+}
@@ -0,0 +1,28 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestTimeoutsFor(t *testing.T) {
+	if got := TimeoutsFor(&config.SyncConfig{}); got != DefaultTimeouts {
+		t.Errorf("TimeoutsFor(empty) = %+v, want the defaults", got)
+	}
+
+	cfg := &config.SyncConfig{Timeouts: config.SyncTimeouts{Chunk: "10m", Sync: "6h", Handshake: "bogus", Manifest: "-1s"}}
+	want := DefaultTimeouts
+	want.Chunk = 10 * time.Minute
+	want.Sync = 6 * time.Hour
+	if got := TimeoutsFor(cfg); got != want {
+		t.Errorf("TimeoutsFor = %+v, want %+v", got, want)
+	}
+
+	// Services built without a constructor still wait
+	s := &SyncService{Timeouts: Timeouts{Manifest: time.Hour}}
+	if got := s.timeouts(); got.Manifest != time.Hour || got.Chunk != DefaultTimeouts.Chunk {
+		t.Errorf("timeouts() = %+v", got)
+	}
+}
@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/atomic"
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+// tombstoneRetention returns how long this vault keeps tombstones. Tombstones
+// older than that are neither applied nor kept.
+func (s *SyncService) tombstoneRetention() time.Duration {
+	cfg, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return config.DefaultTombstoneRetention
+	}
+	return cfg.Sync.TombstoneRetention()
+}
+
+// liveTombstones returns the tombstones of deletions within retention
+func liveTombstones(tombstones []config.Tombstone, retention time.Duration) []config.Tombstone {
+	cutoff := time.Now().Add(-retention)
+	var live []config.Tombstone
+	for _, t := range tombstones {
+		if t.DeletedAt.After(cutoff) {
+			live = append(live, t)
+		}
+	}
+	return live
+}
+
+// withoutDeleted splits files into those no tombstone covers and those one does
+func withoutDeleted(files []config.FileManifest, tombstones []config.Tombstone) (kept, deleted []config.FileManifest) {
+	for _, file := range files {
+		covered := false
+		for i := range tombstones {
+			if tombstones[i].Covers(&file) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			deleted = append(deleted, file)
+		} else {
+			kept = append(kept, file)
+		}
+	}
+	return kept, deleted
+}
+
+// applyTombstones records the remote tombstones and removes the local files
+// they cover, returning the local manifest without them, the remote manifest
+// without the files this vault has deleted, and the paths removed. Removed
+// files are moved to the trash, as 'sietch rm' does, so their chunks are kept
+// until the trash expires and the files can be restored.
+func (s *SyncService) applyTombstones(localManifest, remoteManifest *config.Manifest) (*config.Manifest, *config.Manifest, []string, error) {
+	incoming := liveTombstones(remoteManifest.Tombstones, s.tombstoneRetention())
+	for i := range incoming {
+		if _, err := s.vaultMgr.SaveTombstone(&incoming[i]); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	kept, deleted := withoutDeleted(localManifest.Files, incoming)
+	if err := trashFiles(s.vaultMgr, deleted); err != nil {
+		return nil, nil, nil, err
+	}
+	var removed []string
+	for _, file := range deleted {
+		removed = append(removed, file.Destination+file.FilePath)
+		if s.Verbose {
+			fmt.Printf("Deleted %s, removed on the peer\n", file.Destination+file.FilePath)
+		}
+	}
+
+	tombstones, err := s.vaultMgr.Tombstones()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remoteFiles, _ := withoutDeleted(remoteManifest.Files, tombstones)
+	return &config.Manifest{Files: kept, Tombstones: tombstones},
+		&config.Manifest{Files: remoteFiles, Tombstones: remoteManifest.Tombstones},
+		removed, nil
+}
+
+// trashFiles removes the manifests of files and keeps them in the vault's
+// trash, in one transaction
+func trashFiles(vaultMgr *config.Manager, files []config.FileManifest) error {
+	if len(files) == 0 {
+		return nil
+	}
+	vaultRoot := vaultMgr.VaultRoot()
+	retention := config.DefaultTrashRetention
+	if cfg, err := vaultMgr.GetConfig(); err == nil {
+		retention = cfg.Trash.RetentionPeriod()
+	}
+	entries, err := vaultMgr.GetManifestEntries()
+	if err != nil {
+		return err
+	}
+	manifestPaths := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		manifestPaths[entry.Manifest.Destination+entry.Manifest.FilePath] = entry.Path
+	}
+
+	txn, err := atomic.Begin(vaultRoot, map[string]any{"command": "sync", "deleted": len(files)})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	for i := range files {
+		if err := stageTrash(txn, vaultRoot, manifestPaths, &files[i], retention); err != nil {
+			_ = txn.Rollback()
+			return fmt.Errorf("failed to delete %s: %w", files[i].Destination+files[i].FilePath, err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		_ = txn.Rollback()
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	vaultMgr.RefreshIndex()
+	return nil
+}
+
+// stageTrash stages the removal of file's manifest and its trash entry
+func stageTrash(txn *atomic.Transaction, vaultRoot string, manifestPaths map[string]string, file *config.FileManifest, retention time.Duration) error {
+	manifestPath, ok := manifestPaths[file.Destination+file.FilePath]
+	if !ok {
+		return fmt.Errorf("no manifest found")
+	}
+	rel, err := filepath.Rel(vaultRoot, manifestPath)
+	if err != nil {
+		return err
+	}
+	if err := txn.StageDelete(filepath.ToSlash(rel)); err != nil {
+		return err
+	}
+	entry := config.NewTrashEntry(file, retention)
+	data, err := config.EncodeTrashEntry(vaultRoot, entry)
+	if err != nil {
+		return err
+	}
+	w, err := txn.StageCreate(config.TrashRelPath(entry.ID))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// planTombstones reports what applyTombstones would do without writing anything
+func (s *SyncService) planTombstones(localManifest, remoteManifest *config.Manifest) (*config.Manifest, *config.Manifest, []string) {
+	incoming := liveTombstones(remoteManifest.Tombstones, s.tombstoneRetention())
+	kept, deleted := withoutDeleted(localManifest.Files, incoming)
+	var removed []string
+	for _, file := range deleted {
+		removed = append(removed, file.Destination+file.FilePath)
+	}
+
+	tombstones, err := s.vaultMgr.Tombstones()
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	remoteFiles, _ := withoutDeleted(remoteManifest.Files, append(tombstones, incoming...))
+	return &config.Manifest{Files: kept}, &config.Manifest{Files: remoteFiles}, removed
+}
@@ -0,0 +1,101 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/manifest"
+)
+
+// hasFile reports whether the vault lists docs/name
+func hasFile(t *testing.T, mgr *config.Manager, name string) bool {
+	t.Helper()
+	m, err := mgr.GetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range m.Files {
+		if file.Destination+file.FilePath == "docs/"+name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSyncPropagatesDeletions(t *testing.T) {
+	a := newTestVault(t, "a.txt", hashA, "alpha")
+	b := newTestVault(t, "b.txt", hashB, "bravo")
+	if _, err := NewLocalSyncService(b).SyncWithVault(a.VaultRoot()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete a.txt in a, the way the delete command does
+	deleted := config.NewTombstone(&config.FileManifest{FilePath: "a.txt", Destination: "docs/"})
+	if _, err := a.SaveTombstone(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := trashFiles(a, []config.FileManifest{{FilePath: "a.txt", Destination: "docs/"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Syncing from a peer that still has the file does not bring it back
+	if _, err := NewLocalSyncService(a).SyncWithVault(b.VaultRoot()); err != nil {
+		t.Fatal(err)
+	}
+	if hasFile(t, a, "a.txt") {
+		t.Fatal("deleted file was copied back from the peer")
+	}
+
+	s := NewLocalSyncService(b)
+	plan, err := s.PlanSyncWithVault(a.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Deletions) != 1 || plan.Deletions[0] != "docs/a.txt" || !hasFile(t, b, "a.txt") {
+		t.Fatalf("expected the plan to delete docs/a.txt without removing it, got %+v", plan)
+	}
+	result, err := s.SyncWithVault(a.VaultRoot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.FilesDeleted) != 1 || hasFile(t, b, "a.txt") {
+		t.Fatalf("expected docs/a.txt to be deleted, got %+v", result)
+	}
+	if tombstones, _ := b.Tombstones(); len(tombstones) != 1 {
+		t.Fatalf("expected the tombstone to be recorded, got %v", tombstones)
+	}
+	if trash, err := b.Trash(); err != nil || len(trash) != 1 || trash[0].Path() != "docs/a.txt" {
+		t.Fatalf("expected docs/a.txt kept in the trash, got %v (%v)", trash, err)
+	}
+
+	// A file added again after the deletion is synced as usual
+	readded := &config.FileManifest{
+		FilePath:    "a.txt",
+		Destination: "docs/",
+		Size:        5,
+		Chunks:      []config.ChunkRef{{Hash: hashA, Size: 5}},
+		AddedAt:     time.Now().UTC().Add(time.Second),
+	}
+	if err := manifest.StoreFileManifest(a.VaultRoot(), "a.txt", readded); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SyncWithVault(a.VaultRoot()); err != nil {
+		t.Fatal(err)
+	}
+	if !hasFile(t, b, "a.txt") {
+		t.Fatal("file added again after its deletion was not synced")
+	}
+}
+
+func TestLiveTombstones(t *testing.T) {
+	now := time.Now()
+	tombstones := []config.Tombstone{
+		{FilePath: "old.txt", DeletedAt: now.Add(-48 * time.Hour)},
+		{FilePath: "new.txt", DeletedAt: now.Add(-time.Hour)},
+	}
+	live := liveTombstones(tombstones, 24*time.Hour)
+	if len(live) != 1 || live[0].FilePath != "new.txt" {
+		t.Fatalf("liveTombstones = %v", live)
+	}
+}
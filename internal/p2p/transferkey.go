@@ -0,0 +1,343 @@
+package p2p
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Transfer keys separate the roles of a vault's RSA keys. The identity key,
+// the one peers pin when they pair, only signs: authentication payloads,
+// invitations and transfer key certificates. Chunks and session secrets are
+// encrypted to a short-lived transfer key instead, whose certificate, signed
+// by the identity key, the requesting peer hands over with its
+// authentication proof. Transfer keys can so be rotated at any time without
+// re-pairing: peers accept any transfer key the identity key they pinned
+// signed.
+//
+// A replaced transfer key is kept until it expires, as sessions resumed
+// with peers may still encrypt to it. Peers that send no certificate, older
+// releases among them, keep having data encrypted to their identity key.
+
+const (
+	// DefaultTransferKeyLifetime is how long a new transfer key is valid
+	DefaultTransferKeyLifetime = 7 * 24 * time.Hour
+	// TransferKeyBits is the size of transfer keys
+	TransferKeyBits = 2048
+
+	// transferKeyRenewal is how long before it expires a transfer key is
+	// replaced, so that none expires while a session with a peer uses it.
+	// Keys valid for less than four times as long are replaced once a
+	// quarter of their lifetime is left.
+	transferKeyRenewal = 24 * time.Hour
+	// transferCertVersion is the version of the signed certificate payload
+	transferCertVersion = 1
+)
+
+// TransferKeyCertificate is the public half of a transfer key, signed by the
+// identity key of its vault
+type TransferKeyCertificate struct {
+	PublicKey string    `json:"public_key"` // PEM encoded
+	Issued    time.Time `json:"issued"`
+	Expires   time.Time `json:"expires"`
+	Signature []byte    `json:"signature"`
+}
+
+// payload is what the identity key signs
+func (c *TransferKeyCertificate) payload() []byte {
+	return []byte(strings.Join([]string{
+		"sietch transfer key v" + strconv.Itoa(transferCertVersion),
+		strconv.FormatInt(c.Issued.UnixNano(), 10),
+		strconv.FormatInt(c.Expires.UnixNano(), 10),
+		c.PublicKey,
+	}, "\n"))
+}
+
+// Verify checks that identity signed the certificate and that it is valid
+// at now, returning the transfer key it certifies
+func (c *TransferKeyCertificate) Verify(identity *rsa.PublicKey, now time.Time) (*rsa.PublicKey, error) {
+	if identity == nil {
+		return nil, fmt.Errorf("identity key is unknown")
+	}
+	if err := verifyChallenge(identity, c.payload(), c.Signature); err != nil {
+		return nil, fmt.Errorf("transfer key is not signed by the identity key: %w", err)
+	}
+	if now.Before(c.Issued.Add(-authMaxSkew)) || !now.Before(c.Expires) {
+		return nil, fmt.Errorf("transfer key is only valid from %s to %s",
+			c.Issued.UTC().Format(time.RFC3339), c.Expires.UTC().Format(time.RFC3339))
+	}
+	key, _, err := parseExchangedKey([]byte(c.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer key: %w", err)
+	}
+	return key, nil
+}
+
+// Fingerprint identifies the certified transfer key, in the format of
+// identity key fingerprints
+func (c *TransferKeyCertificate) Fingerprint() string {
+	_, fingerprint, err := parseExchangedKey([]byte(c.PublicKey))
+	if err != nil {
+		return ""
+	}
+	return fingerprint
+}
+
+// TransferKey is a transfer key pair of this vault with its certificate
+type TransferKey struct {
+	PrivateKey  *rsa.PrivateKey
+	Certificate TransferKeyCertificate
+}
+
+// NewTransferKey generates a transfer key valid for lifetime, certified by
+// the identity key
+func NewTransferKey(identity *rsa.PrivateKey, lifetime time.Duration) (*TransferKey, error) {
+	if lifetime <= 0 {
+		return nil, fmt.Errorf("transfer key lifetime must be positive, got %s", lifetime)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, TransferKeyBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate transfer key: %w", err)
+	}
+	keyPEM, err := publicKeyPEM(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	cert := TransferKeyCertificate{PublicKey: keyPEM, Issued: now, Expires: now.Add(lifetime)}
+	if cert.Signature, err = signChallenge(identity, cert.payload()); err != nil {
+		return nil, fmt.Errorf("failed to sign transfer key: %w", err)
+	}
+	return &TransferKey{PrivateKey: key, Certificate: cert}, nil
+}
+
+// storedTransferKey is how a transfer key is saved in the vault
+type storedTransferKey struct {
+	PrivateKey  string                 `json:"private_key"` // PKCS#1 PEM
+	Certificate TransferKeyCertificate `json:"certificate"`
+}
+
+// transferKeysPath is where a vault keeps its transfer keys
+func transferKeysPath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "sync", "transfer_keys.json")
+}
+
+// LoadTransferKeys returns the unexpired transfer keys of the vault at
+// vaultRoot, the current one first, or none if it has none yet
+func LoadTransferKeys(vaultRoot string) ([]*TransferKey, error) {
+	data, err := os.ReadFile(transferKeysPath(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transfer keys: %w", err)
+	}
+	var stored []storedTransferKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse transfer keys: %w", err)
+	}
+
+	now := time.Now()
+	var loaded []*TransferKey
+	for _, entry := range stored {
+		if !now.Before(entry.Certificate.Expires) {
+			continue
+		}
+		block, _ := pem.Decode([]byte(entry.PrivateKey))
+		if block == nil {
+			return nil, fmt.Errorf("failed to decode transfer key")
+		}
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse transfer key: %w", err)
+		}
+		loaded = append(loaded, &TransferKey{PrivateKey: key, Certificate: entry.Certificate})
+	}
+	return loaded, nil
+}
+
+// RotateTransferKey replaces the current transfer key of the vault at
+// vaultRoot with a new one valid for lifetime, certified by identity. The
+// keys it replaces are kept until they expire. It returns the new key.
+func RotateTransferKey(vaultRoot string, identity *rsa.PrivateKey, lifetime time.Duration) (*TransferKey, error) {
+	current, err := LoadTransferKeys(vaultRoot)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewTransferKey(identity, lifetime)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveTransferKeys(vaultRoot, append([]*TransferKey{key}, current...)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func saveTransferKeys(vaultRoot string, transferKeys []*TransferKey) error {
+	stored := make([]storedTransferKey, len(transferKeys))
+	for i, key := range transferKeys {
+		stored[i] = storedTransferKey{
+			PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key.PrivateKey)})),
+			Certificate: key.Certificate,
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := transferKeysPath(vaultRoot)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save transfer keys: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// transferKey returns the current transfer key of the vault, replacing it
+// first if it is about to expire or was not signed by the identity key, or
+// nil if none could be made
+func (s *SyncService) transferKey() *TransferKey {
+	if s.privateKey == nil {
+		return nil
+	}
+	s.transferMu.Lock()
+	defer s.transferMu.Unlock()
+
+	if keys := s.loadedTransferKeys(); len(keys) > 0 {
+		current := keys[0]
+		renewal := min(transferKeyRenewal, current.Certificate.Expires.Sub(current.Certificate.Issued)/4)
+		if _, err := current.Certificate.Verify(s.publicKey, time.Now().Add(renewal)); err == nil {
+			return current
+		}
+	}
+
+	key, err := RotateTransferKey(s.vaultMgr.VaultRoot(), s.privateKey, DefaultTransferKeyLifetime)
+	if err != nil {
+		fmt.Printf("Warning: peers encrypt to the identity key, as no transfer key could be made: %v\n", err)
+		return nil
+	}
+	if s.Verbose {
+		fmt.Printf("Rotated transfer key, now %s\n", key.Certificate.Fingerprint())
+	}
+	if loaded, err := LoadTransferKeys(s.vaultMgr.VaultRoot()); err == nil && len(loaded) > 0 {
+		s.transferKeys = loaded
+	} else {
+		s.transferKeys = []*TransferKey{key}
+	}
+	return key
+}
+
+// loadedTransferKeys returns the transfer keys of the vault, loading them
+// on first use. s.transferMu must be held.
+func (s *SyncService) loadedTransferKeys() []*TransferKey {
+	if s.transferKeys == nil {
+		loaded, err := LoadTransferKeys(s.vaultMgr.VaultRoot())
+		if err != nil {
+			fmt.Printf("Warning: %v; a new transfer key is made\n", err)
+		}
+		s.transferKeys = loaded
+	}
+	return s.transferKeys
+}
+
+// ownTransferKey returns the transfer key of this vault with fingerprint,
+// or nil if it is not kept or has expired
+func (s *SyncService) ownTransferKey(fingerprint string) *rsa.PrivateKey {
+	s.transferMu.Lock()
+	defer s.transferMu.Unlock()
+	now := time.Now()
+	for _, key := range s.loadedTransferKeys() {
+		if now.Before(key.Certificate.Expires) && key.Certificate.Fingerprint() == fingerprint {
+			return key.PrivateKey
+		}
+	}
+	return nil
+}
+
+// peerTransferKey is a transfer key a peer presented when it authenticated
+type peerTransferKey struct {
+	key         *rsa.PublicKey
+	fingerprint string
+	expires     time.Time
+}
+
+// verifyPeerTransferKey checks the transfer key certificate a peer with the
+// identity key presented
+func verifyPeerTransferKey(identity *rsa.PublicKey, cert *TransferKeyCertificate) (*peerTransferKey, error) {
+	key, err := cert.Verify(identity, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &peerTransferKey{key: key, fingerprint: cert.Fingerprint(), expires: cert.Expires}, nil
+}
+
+// setPeerTransferKey records the transfer key that data for peerID is
+// encrypted to; a nil key reverts to its identity key
+func (s *SyncService) setPeerTransferKey(peerID peer.ID, key *peerTransferKey) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if key == nil {
+		delete(s.peerTransfer, peerID)
+		return
+	}
+	if s.peerTransfer == nil {
+		s.peerTransfer = make(map[peer.ID]*peerTransferKey)
+	}
+	s.peerTransfer[peerID] = key
+}
+
+// peerTransferKeyOf returns the unexpired transfer key peerID presented, or nil
+func (s *SyncService) peerTransferKeyOf(peerID peer.ID) *peerTransferKey {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	key := s.peerTransfer[peerID]
+	if key == nil || !time.Now().Before(key.expires) {
+		return nil
+	}
+	return key
+}
+
+// setPresentedTransferKey records the fingerprint of the transfer key this
+// vault presented to peerID, which the peer's data is encrypted to; "" for
+// the identity key
+func (s *SyncService) setPresentedTransferKey(peerID peer.ID, fingerprint string) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if fingerprint == "" {
+		delete(s.presented, peerID)
+		return
+	}
+	if s.presented == nil {
+		s.presented = make(map[peer.ID]string)
+	}
+	s.presented[peerID] = fingerprint
+}
+
+// decryptionKey returns the key that data from peerID is encrypted to: the
+// transfer key presented to it if toTransferKey is set, else the identity key
+func (s *SyncService) decryptionKey(peerID peer.ID, toTransferKey bool) (*rsa.PrivateKey, error) {
+	if !toTransferKey {
+		return s.privateKey, nil
+	}
+	s.authMu.Lock()
+	fingerprint := s.presented[peerID]
+	s.authMu.Unlock()
+	if key := s.ownTransferKey(fingerprint); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("data is encrypted to a transfer key that is no longer kept")
+}
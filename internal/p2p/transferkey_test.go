@@ -0,0 +1,159 @@
+package p2p
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+)
+
+func TestTransferKeyCertificate(t *testing.T) {
+	identity, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewTransferKey(identity, time.Hour)
+	if err != nil {
+		t.Fatalf("NewTransferKey: %v", err)
+	}
+
+	now := time.Now()
+	certified, err := key.Certificate.Verify(&identity.PublicKey, now)
+	if err != nil || !certified.Equal(&key.PrivateKey.PublicKey) {
+		t.Fatalf("Verify = %v, %v", certified, err)
+	}
+	if _, err := key.Certificate.Verify(&other.PublicKey, now); err == nil {
+		t.Error("expected a certificate to fail under another identity key")
+	}
+	if _, err := key.Certificate.Verify(&identity.PublicKey, now.Add(time.Hour)); err == nil {
+		t.Error("expected an expired certificate to fail")
+	}
+	extended := key.Certificate
+	extended.Expires = extended.Expires.Add(time.Hour)
+	if _, err := extended.Verify(&identity.PublicKey, now); err == nil {
+		t.Error("expected a certificate with a changed expiry to fail")
+	}
+}
+
+func TestRotateTransferKeyKeepsEarlierKeys(t *testing.T) {
+	identity, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	if keys, err := LoadTransferKeys(root); err != nil || len(keys) != 0 {
+		t.Fatalf("LoadTransferKeys of a new vault = %v, %v", keys, err)
+	}
+	first, err := RotateTransferKey(root, identity, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := RotateTransferKey(root, identity, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadTransferKeys(root)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("LoadTransferKeys = %d keys, %v", len(keys), err)
+	}
+	if keys[0].Certificate.Fingerprint() != second.Certificate.Fingerprint() ||
+		keys[1].Certificate.Fingerprint() != first.Certificate.Fingerprint() {
+		t.Error("expected the newest transfer key first")
+	}
+	if !keys[0].PrivateKey.Equal(second.PrivateKey) {
+		t.Error("loaded transfer key differs from the saved one")
+	}
+}
+
+func TestChunksAreEncryptedToTransferKey(t *testing.T) {
+	server, client := authenticatedPair(t)
+	ctx := context.Background()
+	serverID, clientID := server.host.ID(), client.host.ID()
+
+	current := client.transferKey()
+	if current == nil {
+		t.Fatal("expected the client to have a transfer key")
+	}
+	fingerprint := current.Certificate.Fingerprint()
+	if transfer := server.peerTransferKeyOf(clientID); transfer == nil || transfer.fingerprint != fingerprint {
+		t.Fatalf("server encrypts to %+v, want the client's transfer key %s", transfer, fingerprint)
+	}
+	if ticket := client.loadSessionTicket(serverID); ticket.TransferKey != fingerprint {
+		t.Errorf("ticket is for transfer key %q, want %q", ticket.TransferKey, fingerprint)
+	}
+	if data, _, err := client.fetchChunk(ctx, serverID, hashA, ""); err != nil || string(data) != "alpha" {
+		t.Fatalf("fetchChunk = %q, %v", data, err)
+	}
+
+	// A resumed session encrypts to the same transfer key
+	server.setAuthenticated(clientID, false)
+	server.setPeerTransferKey(clientID, nil)
+	if !client.resumeSession(ctx, serverID) {
+		t.Fatal("expected the session to resume")
+	}
+	if transfer := server.peerTransferKeyOf(clientID); transfer == nil || transfer.fingerprint != fingerprint {
+		t.Fatal("expected the resumed session to restore the client's transfer key")
+	}
+
+	// Once the client no longer holds the key, it cannot open the chunks
+	client.transferMu.Lock()
+	client.transferKeys = []*TransferKey{}
+	client.transferMu.Unlock()
+	if _, _, err := client.fetchChunk(ctx, serverID, hashA, ""); err == nil {
+		t.Error("expected a chunk encrypted to a discarded transfer key to fail")
+	}
+}
+
+func TestVerifyPeerTransferKeyRejectsOtherIdentity(t *testing.T) {
+	identity, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewTransferKey(other, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyPeerTransferKey(&identity.PublicKey, &key.Certificate); err == nil {
+		t.Error("expected a transfer key signed by another identity to be rejected")
+	}
+}
+
+func TestTransferKeyIsRenewedBeforeExpiry(t *testing.T) {
+	s, _ := newPairingPeers(t)
+	root := s.vaultMgr.VaultRoot()
+
+	// A key issued a week ago that expires within the renewal margin
+	expiring, err := NewTransferKey(s.privateKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &expiring.Certificate
+	cert.Issued, cert.Expires = cert.Issued.Add(-7*24*time.Hour), cert.Issued.Add(time.Hour)
+	if cert.Signature, err = signChallenge(s.privateKey, cert.payload()); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTransferKeys(root, []*TransferKey{expiring}); err != nil {
+		t.Fatal(err)
+	}
+
+	current := s.transferKey()
+	if current == nil || current.Certificate.Fingerprint() == cert.Fingerprint() {
+		t.Fatal("expected the expiring transfer key to be replaced")
+	}
+	if again := s.transferKey(); again.Certificate.Fingerprint() != current.Certificate.Fingerprint() {
+		t.Error("expected a fresh transfer key to be kept")
+	}
+	if s.ownTransferKey(cert.Fingerprint()) == nil {
+		t.Error("expected the replaced key to be kept until it expires")
+	}
+}
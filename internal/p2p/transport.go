@@ -0,0 +1,142 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+// Sync traffic can be compressed in transit, independently of how chunks are
+// stored. Peers announce the algorithms they can decode in the hello
+// handshake; a peer only asks for compression the other side announced, and
+// the other side only compresses when asked, so older releases never see it.
+//
+// Manifest delta responses are compressed as a whole. Chunks are compressed
+// one at a time, before transport encryption, and only when the vault stores
+// them uncompressed and compressing makes them smaller.
+
+// transportCompression lists the algorithms this release decodes on sync streams
+var transportCompression = []string{constants.CompressionTypeZstd}
+
+// maxTransportManifestSize bounds a decompressed manifest response
+const maxTransportManifestSize = 1 << 30
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxChunkFrameSize))
+		return dec
+	})
+)
+
+// transportCompressionFor returns the algorithm to ask peerID to compress
+// responses with, or "" if this service does not want compression or the
+// peer cannot provide it
+func (s *SyncService) transportCompressionFor(ctx context.Context, peerID peer.ID) string {
+	algorithm := s.TransportCompression
+	if algorithm == "" || algorithm == constants.CompressionTypeNone || !slices.Contains(transportCompression, algorithm) {
+		return ""
+	}
+	caps, err := s.PeerCapabilities(ctx, peerID)
+	if err != nil || !slices.Contains(caps.TransportCompression, algorithm) {
+		return ""
+	}
+	return algorithm
+}
+
+// storesChunksUncompressed reports whether this vault's chunks are worth
+// compressing in transit: stored without compression and in the clear, since
+// ciphertext does not compress
+func (s *SyncService) storesChunksUncompressed() bool {
+	cfg, err := s.vaultMgr.GetConfig()
+	if err != nil {
+		return false
+	}
+	return (cfg.Compression == "" || cfg.Compression == constants.CompressionTypeNone) &&
+		(cfg.Encryption.Type == "" || cfg.Encryption.Type == constants.EncryptionTypeNone)
+}
+
+// compressChunkForTransport returns data compressed with algorithm when that
+// makes it smaller, and the algorithm used, or data unchanged and ""
+func compressChunkForTransport(data []byte, algorithm string) ([]byte, string) {
+	if algorithm != constants.CompressionTypeZstd {
+		return data, ""
+	}
+	compressed := zstdEncoder().EncodeAll(data, make([]byte, 0, len(data)))
+	if len(compressed) >= len(data) {
+		return data, ""
+	}
+	return compressed, algorithm
+}
+
+// decompressChunkFromTransport reverses compressChunkForTransport
+func decompressChunkFromTransport(data []byte, algorithm string) ([]byte, error) {
+	switch algorithm {
+	case "":
+		return data, nil
+	case constants.CompressionTypeZstd:
+		out, err := zstdDecoder().DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress chunk: %w", err)
+		}
+		if len(out) > maxChunkFrameSize {
+			return nil, fmt.Errorf("decompressed chunk exceeds the %d byte frame limit", maxChunkFrameSize)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported transport compression %q", algorithm)
+	}
+}
+
+// compressedStreamWriter wraps w to compress what is written with algorithm.
+// Closing the result flushes it without closing w.
+func compressedStreamWriter(w io.Writer, algorithm string) (io.WriteCloser, error) {
+	switch algorithm {
+	case "":
+		return nopWriteCloser{w}, nil
+	case constants.CompressionTypeZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	default:
+		return nil, fmt.Errorf("unsupported transport compression %q", algorithm)
+	}
+}
+
+// compressedStreamReader wraps r to decompress a stream written by
+// compressedStreamWriter, reading at most maxTransportManifestSize bytes
+func compressedStreamReader(r io.Reader, algorithm string) (io.Reader, func(), error) {
+	switch algorithm {
+	case "":
+		return r, func() {}, nil
+	case constants.CompressionTypeZstd:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderMaxMemory(maxTransportManifestSize))
+		if err != nil {
+			return nil, nil, err
+		}
+		return io.LimitReader(dec, maxTransportManifestSize), dec.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported transport compression %q", algorithm)
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// transportCompressionOf returns the transport compression configured for a vault
+func transportCompressionOf(cfg *config.VaultConfig) string {
+	if cfg == nil || cfg.Sync.TransportCompression == constants.CompressionTypeNone {
+		return ""
+	}
+	return cfg.Sync.TransportCompression
+}
@@ -0,0 +1,66 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+)
+
+func TestCompressChunkForTransport(t *testing.T) {
+	text := bytes.Repeat([]byte("sietch "), 4096)
+	compressed, algorithm := compressChunkForTransport(text, constants.CompressionTypeZstd)
+	if algorithm != constants.CompressionTypeZstd || len(compressed) >= len(text) {
+		t.Fatalf("expected repetitive data to be compressed, got %d bytes with %q", len(compressed), algorithm)
+	}
+	out, err := decompressChunkFromTransport(compressed, algorithm)
+	if err != nil || !bytes.Equal(out, text) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+
+	random := make([]byte, 4096)
+	_, _ = rand.Read(random)
+	if data, algorithm := compressChunkForTransport(random, constants.CompressionTypeZstd); algorithm != "" || !bytes.Equal(data, random) {
+		t.Error("data that does not shrink must be sent as is")
+	}
+	if _, algorithm := compressChunkForTransport(text, "brotli"); algorithm != "" {
+		t.Error("unknown algorithms must not be applied")
+	}
+	if _, err := decompressChunkFromTransport(compressed, "brotli"); err == nil {
+		t.Error("expected an unknown algorithm to be rejected")
+	}
+}
+
+func TestSyncWithTransportCompression(t *testing.T) {
+	chunk := strings.Repeat("alpha ", 2048)
+	for _, tt := range []struct {
+		name   string
+		remove []string // Protocols the serving peer does not support
+	}{
+		{"compressing peer", nil},
+		{"peer without hello", []string{HelloProtocolID}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, serverID := newPeerPair(t, newTestVault(t, "a.txt", "hash-a", chunk), tt.remove...)
+			client.TransportCompression = constants.CompressionTypeZstd
+
+			data, size, err := client.fetchChunk(context.Background(), serverID, "hash-a", "")
+			if err != nil || string(data) != chunk || size != len(chunk) {
+				t.Fatalf("fetchChunk = %d bytes, %d, %v", len(data), size, err)
+			}
+		})
+	}
+
+	client, serverID := newPeerPair(t, newTestVault(t, "a.txt", "hash-a", chunk))
+	client.TransportCompression = constants.CompressionTypeZstd
+	if got := client.transportCompressionFor(context.Background(), serverID); got != constants.CompressionTypeZstd {
+		t.Fatalf("expected zstd to be negotiated, got %q", got)
+	}
+	m, _, _, err := client.getRemoteManifestSince(context.Background(), serverID, "")
+	if err != nil || len(m.Files) != 1 || m.Files[0].FilePath != "a.txt" {
+		t.Fatalf("compressed manifest delta = %+v (%v)", m, err)
+	}
+}
@@ -0,0 +1,232 @@
+// Package parity protects groups of stored chunks with Reed–Solomon parity
+// shards, so that a limited number of lost or corrupted chunks can be rebuilt
+// from the vault alone.
+package parity
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxShards is the most chunks and parity shards a group can have in GF(2^8)
+const MaxShards = 256
+
+// ErrTooFewShards is returned by Reconstruct when more shards are missing
+// than there are parity shards
+var ErrTooFewShards = errors.New("too few shards left to reconstruct")
+
+// Arithmetic in GF(2^8) with the polynomial x^8+x^4+x^3+x^2+1 (0x11d)
+var (
+	expTable [510]byte
+	logTable [256]byte
+	mulTable [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			mulTable[a][b] = expTable[int(logTable[a])+int(logTable[b])]
+		}
+	}
+}
+
+// gfInv returns the multiplicative inverse of a, which must not be 0
+func gfInv(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+// mulAdd adds c*src to dst, byte by byte
+func mulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	row := &mulTable[c]
+	for i, b := range src {
+		dst[i] ^= row[b]
+	}
+}
+
+// Codec is a systematic Reed–Solomon code: the data shards are kept as they
+// are and the parity shards are combinations of them given by a Cauchy
+// matrix, so that any dataShards of the shards rebuild all the others.
+type Codec struct {
+	dataShards   int
+	parityShards int
+	parity       [][]byte // parityShards rows of dataShards coefficients
+}
+
+// NewCodec returns the codec for groups of dataShards data shards and
+// parityShards parity shards
+func NewCodec(dataShards, parityShards int) (*Codec, error) {
+	if dataShards < 1 || parityShards < 1 {
+		return nil, fmt.Errorf("need at least one data and one parity shard, got %d and %d", dataShards, parityShards)
+	}
+	if dataShards+parityShards > MaxShards {
+		return nil, fmt.Errorf("%d data and %d parity shards exceed the limit of %d shards", dataShards, parityShards, MaxShards)
+	}
+	c := &Codec{dataShards: dataShards, parityShards: parityShards, parity: make([][]byte, parityShards)}
+	for i := range c.parity {
+		c.parity[i] = make([]byte, dataShards)
+		for j := range c.parity[i] {
+			// x_i = dataShards+i and y_j = j are distinct, so x_i+y_j is never 0
+			c.parity[i][j] = gfInv(byte(dataShards+i) ^ byte(j))
+		}
+	}
+	return c, nil
+}
+
+// row returns the coefficients giving shard i from the data shards
+func (c *Codec) row(i int) []byte {
+	if i >= c.dataShards {
+		return c.parity[i-c.dataShards]
+	}
+	r := make([]byte, c.dataShards)
+	r[i] = 1
+	return r
+}
+
+// shardSize checks shards and returns the size of its shards, which must all
+// be the same; nil shards are ignored
+func (c *Codec) shardSize(shards [][]byte) (int, error) {
+	if len(shards) != c.dataShards+c.parityShards {
+		return 0, fmt.Errorf("expected %d shards, got %d", c.dataShards+c.parityShards, len(shards))
+	}
+	size := -1
+	for i, s := range shards {
+		if s == nil {
+			continue
+		}
+		if size == -1 {
+			size = len(s)
+		} else if len(s) != size {
+			return 0, fmt.Errorf("shard %d is %d bytes, expected %d", i, len(s), size)
+		}
+	}
+	return size, nil
+}
+
+// Encode computes the parity shards of shards, which holds the data shards
+// followed by the parity shards. Nil parity shards are allocated.
+func (c *Codec) Encode(shards [][]byte) error {
+	size, err := c.shardSize(shards)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < c.dataShards; i++ {
+		if shards[i] == nil {
+			return fmt.Errorf("data shard %d is missing", i)
+		}
+	}
+	for i := 0; i < c.parityShards; i++ {
+		c.encodeShard(shards, c.dataShards+i, size)
+	}
+	return nil
+}
+
+// encodeShard computes shard i from the data shards of shards
+func (c *Codec) encodeShard(shards [][]byte, i, size int) {
+	out := shards[i]
+	if out == nil {
+		out = make([]byte, size)
+	} else {
+		clear(out)
+	}
+	for j, coef := range c.row(i) {
+		mulAdd(out, shards[j], coef)
+	}
+	shards[i] = out
+}
+
+// Reconstruct rebuilds the nil shards of shards from the others, as long as
+// no more shards are missing than there are parity shards
+func (c *Codec) Reconstruct(shards [][]byte) error {
+	size, err := c.shardSize(shards)
+	if err != nil {
+		return err
+	}
+	var present, missingData, missingParity []int
+	for i, s := range shards {
+		switch {
+		case s != nil:
+			present = append(present, i)
+		case i < c.dataShards:
+			missingData = append(missingData, i)
+		default:
+			missingParity = append(missingParity, i)
+		}
+	}
+	if len(present) < c.dataShards {
+		return ErrTooFewShards
+	}
+
+	if len(missingData) > 0 {
+		// The rows of the first dataShards shards present give them from the
+		// data shards; inverted, they give the data shards from them
+		used := present[:c.dataShards]
+		m := make([][]byte, c.dataShards)
+		for k, i := range used {
+			m[k] = c.row(i)
+		}
+		inv, err := invert(m)
+		if err != nil {
+			return err
+		}
+		for _, i := range missingData {
+			out := make([]byte, size)
+			for k, j := range used {
+				mulAdd(out, shards[j], inv[i][k])
+			}
+			shards[i] = out
+		}
+	}
+	for _, i := range missingParity {
+		c.encodeShard(shards, i, size)
+	}
+	return nil
+}
+
+// invert returns the inverse of the square matrix m by Gauss–Jordan elimination
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	work := make([][]byte, n)
+	for i := range m {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errors.New("matrix is singular")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		scale := gfInv(work[col][col])
+		for k := range work[col] {
+			work[col][k] = mulTable[scale][work[col][k]]
+		}
+		for r := 0; r < n; r++ {
+			if r != col && work[r][col] != 0 {
+				mulAdd(work[r], work[col], work[r][col])
+			}
+		}
+	}
+	inv := make([][]byte, n)
+	for i := range work {
+		inv[i] = work[i][n:]
+	}
+	return inv, nil
+}
@@ -0,0 +1,63 @@
+package parity
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestCodecReconstruct(t *testing.T) {
+	const dataShards, parityShards, size = 6, 3, 257
+	codec, err := NewCodec(dataShards, parityShards)
+	if err != nil {
+		t.Fatalf("NewCodec failed: %v", err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	shards := make([][]byte, dataShards+parityShards)
+	for i := 0; i < dataShards; i++ {
+		shards[i] = make([]byte, size)
+		rng.Read(shards[i])
+	}
+	if err := codec.Encode(shards); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	// Every way of losing up to parityShards shards must be recoverable
+	for mask := 0; mask < 1<<len(shards); mask++ {
+		lost := 0
+		damaged := make([][]byte, len(shards))
+		for i := range shards {
+			if mask&(1<<i) != 0 {
+				lost++
+			} else {
+				damaged[i] = bytes.Clone(shards[i])
+			}
+		}
+		if lost > parityShards {
+			if err := codec.Reconstruct(damaged); !errors.Is(err, ErrTooFewShards) {
+				t.Fatalf("losing %d shards (mask %b): got %v, want ErrTooFewShards", lost, mask, err)
+			}
+			continue
+		}
+		if err := codec.Reconstruct(damaged); err != nil {
+			t.Fatalf("Reconstruct (mask %b) failed: %v", mask, err)
+		}
+		for i := range shards {
+			if !bytes.Equal(damaged[i], shards[i]) {
+				t.Fatalf("mask %b: shard %d rebuilt wrongly", mask, i)
+			}
+		}
+	}
+}
+
+func TestNewCodecLimits(t *testing.T) {
+	for _, tc := range []struct{ data, parity int }{{0, 2}, {4, 0}, {250, 7}} {
+		if _, err := NewCodec(tc.data, tc.parity); err == nil {
+			t.Errorf("NewCodec(%d, %d) should fail", tc.data, tc.parity)
+		}
+	}
+	if _, err := NewCodec(250, 6); err != nil {
+		t.Errorf("NewCodec(250, 6) failed: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package parity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// Reasons a shard of a group can be reported as damaged
+const (
+	DamageMissing = "missing"
+	DamageCorrupt = "corrupt"
+)
+
+// Group is a set of stored chunks protected by parity shards. Any
+// len(Parity) of its chunks and parity shards can be lost or corrupted and
+// rebuilt from the rest. Groups are kept in .sietch/parity as <id>.yaml,
+// next to their parity shards <id>.p0, <id>.p1 and so on.
+type Group struct {
+	ID        string    `yaml:"id"`
+	CreatedAt time.Time `yaml:"created_at"`
+	ShardSize int64     `yaml:"shard_size"` // Size of the largest chunk; shorter ones are padded with zeros
+	Chunks    []Shard   `yaml:"chunks"`
+	Parity    []Shard   `yaml:"parity"`
+}
+
+// Shard is a chunk or parity shard of a group, identified by the size and
+// SHA-256 of its stored bytes so it can be checked without any vault key
+type Shard struct {
+	Name   string `yaml:"name"`
+	Size   int64  `yaml:"size"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// Damage is a shard of a group that is missing or does not match its hash
+type Damage struct {
+	Index  int // Position of the shard in the group, chunks first
+	Shard  Shard
+	Parity bool
+	Reason string
+}
+
+// Status is the result of checking a group, holding the intact shards read
+// so that the damaged ones can be rebuilt
+type Status struct {
+	Group  *Group
+	Damage []Damage
+	shards [][]byte
+}
+
+// Dir returns the directory parity groups are kept in
+func Dir(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "parity")
+}
+
+// GroupRelPath returns the vault-relative path of the group with id
+func GroupRelPath(id string) string {
+	return ".sietch/parity/" + id + ".yaml"
+}
+
+// ShardRelPath returns the vault-relative path of the parity shard name
+func ShardRelPath(name string) string {
+	return ".sietch/parity/" + name
+}
+
+// NewGroup computes the parity shards of the chunks stored under names, whose
+// stored bytes are chunks, and returns their group and the parity shards
+func NewGroup(names []string, chunks [][]byte, parityShards int) (*Group, [][]byte, error) {
+	if len(names) != len(chunks) {
+		return nil, nil, fmt.Errorf("%d chunk names for %d chunks", len(names), len(chunks))
+	}
+	codec, err := NewCodec(len(chunks), parityShards)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var size int
+	for _, c := range chunks {
+		size = max(size, len(c))
+	}
+	now := time.Now().UTC()
+	g := &Group{ID: groupID(names, now), CreatedAt: now, ShardSize: int64(size)}
+	shards := make([][]byte, len(chunks)+parityShards)
+	for i, c := range chunks {
+		g.Chunks = append(g.Chunks, newShard(names[i], c))
+		shards[i] = pad(c, size)
+	}
+	if err := codec.Encode(shards); err != nil {
+		return nil, nil, err
+	}
+	parity := shards[len(chunks):]
+	for i, p := range parity {
+		g.Parity = append(g.Parity, newShard(g.ID+".p"+strconv.Itoa(i), p))
+	}
+	return g, parity, nil
+}
+
+// groupID names the group of the chunks stored under names created at
+// created, so that regrouping the same chunks never reuses the name
+func groupID(names []string, created time.Time) string {
+	sum := sha256.Sum256([]byte(strings.Join(names, "\n") + "\x00" + strconv.FormatInt(created.UnixNano(), 10)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func newShard(name string, data []byte) Shard {
+	sum := sha256.Sum256(data)
+	return Shard{Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// pad returns data extended with zeros to size bytes
+func pad(data []byte, size int) []byte {
+	if len(data) == size {
+		return data
+	}
+	padded := make([]byte, size)
+	copy(padded, data)
+	return padded
+}
+
+// matches reports whether data is the stored bytes of s
+func (s Shard) matches(data []byte) bool {
+	sum := sha256.Sum256(data)
+	return int64(len(data)) == s.Size && hex.EncodeToString(sum[:]) == s.SHA256
+}
+
+// Marshal returns the YAML of g, as stored at GroupRelPath
+func (g *Group) Marshal() ([]byte, error) {
+	return yaml.Marshal(g)
+}
+
+// LoadGroups returns the parity groups of the vault, ordered by ID
+func LoadGroups(vaultRoot string) ([]*Group, error) {
+	entries, err := os.ReadDir(Dir(vaultRoot))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list parity groups: %w", err)
+	}
+	var groups []*Group
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(Dir(vaultRoot), entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parity group %s: %w", entry.Name(), err)
+		}
+		var g Group
+		if err := yaml.Unmarshal(data, &g); err != nil {
+			return nil, fmt.Errorf("failed to parse parity group %s: %w", entry.Name(), err)
+		}
+		if len(g.Chunks) == 0 || len(g.Parity) == 0 {
+			return nil, fmt.Errorf("parity group %s has no chunks or no parity shards", entry.Name())
+		}
+		for i := range len(g.Chunks) + len(g.Parity) {
+			if shard, isParity := g.shard(i); shard.Size > g.ShardSize || (isParity && shard.Size != g.ShardSize) {
+				return nil, fmt.Errorf("parity group %s: %s does not fit its shard size", entry.Name(), shard.Name)
+			}
+		}
+		groups = append(groups, &g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+// Check reads every chunk and parity shard of g and returns those that are
+// missing or do not match their recorded hash
+func (g *Group) Check(vaultRoot string) (*Status, error) {
+	status := &Status{Group: g, shards: make([][]byte, len(g.Chunks)+len(g.Parity))}
+	for i := range status.shards {
+		shard, isParity := g.shard(i)
+		path := fs.LocateChunk(vaultRoot, shard.Name)
+		if isParity {
+			path = filepath.Join(Dir(vaultRoot), shard.Name)
+		}
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			status.Damage = append(status.Damage, Damage{Index: i, Shard: shard, Parity: isParity, Reason: DamageMissing})
+		case err != nil:
+			return nil, fmt.Errorf("failed to read %s: %w", shard.Name, err)
+		case !shard.matches(data):
+			status.Damage = append(status.Damage, Damage{Index: i, Shard: shard, Parity: isParity, Reason: DamageCorrupt})
+		default:
+			status.shards[i] = pad(data, int(g.ShardSize))
+		}
+	}
+	return status, nil
+}
+
+// shard returns the shard at index i of g, chunks first
+func (g *Group) shard(i int) (Shard, bool) {
+	if i < len(g.Chunks) {
+		return g.Chunks[i], false
+	}
+	return g.Parity[i-len(g.Chunks)], true
+}
+
+// Recoverable reports whether the damaged shards of the group can be rebuilt
+func (s *Status) Recoverable() bool {
+	return len(s.Damage) <= len(s.Group.Parity)
+}
+
+// Rebuild reconstructs the damaged shards of the group and returns their
+// stored bytes, in the order of s.Damage
+func (s *Status) Rebuild() ([][]byte, error) {
+	if len(s.Damage) == 0 {
+		return nil, nil
+	}
+	if !s.Recoverable() {
+		return nil, fmt.Errorf("group %s: %d shards damaged, at most %d can be rebuilt: %w", s.Group.ID, len(s.Damage), len(s.Group.Parity), ErrTooFewShards)
+	}
+	codec, err := NewCodec(len(s.Group.Chunks), len(s.Group.Parity))
+	if err != nil {
+		return nil, err
+	}
+	shards := make([][]byte, len(s.shards))
+	copy(shards, s.shards)
+	if err := codec.Reconstruct(shards); err != nil {
+		return nil, fmt.Errorf("group %s: %w", s.Group.ID, err)
+	}
+
+	rebuilt := make([][]byte, len(s.Damage))
+	for k, d := range s.Damage {
+		data := shards[d.Index][:d.Shard.Size]
+		// Padding beyond the size of a chunk must come back as zeros
+		if !d.Shard.matches(data) || !allZero(shards[d.Index][d.Shard.Size:]) {
+			return nil, fmt.Errorf("group %s: rebuilt %s does not match its hash", s.Group.ID, d.Shard.Name)
+		}
+		rebuilt[k] = bytes.Clone(data)
+	}
+	return rebuilt, nil
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package parity
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupCheckAndRebuild(t *testing.T) {
+	vaultRoot := t.TempDir()
+	chunkDir := filepath.Join(vaultRoot, ".sietch", "chunks")
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"aaaa", "bbbb", "cccc", "dddd"}
+	chunks := [][]byte{[]byte("first chunk"), []byte("second, longer chunk"), []byte("3"), {}}
+	for i, name := range names {
+		if err := os.WriteFile(filepath.Join(chunkDir, name), chunks[i], 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g, parity, err := NewGroup(names, chunks, 2)
+	if err != nil {
+		t.Fatalf("NewGroup failed: %v", err)
+	}
+	data, err := g.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(Dir(vaultRoot), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vaultRoot, filepath.FromSlash(GroupRelPath(g.ID))), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range parity {
+		if err := os.WriteFile(filepath.Join(vaultRoot, filepath.FromSlash(ShardRelPath(g.Parity[i].Name))), p, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := LoadGroups(vaultRoot)
+	if err != nil || len(groups) != 1 || groups[0].ID != g.ID {
+		t.Fatalf("LoadGroups = %v, %v; want the group %s", groups, err, g.ID)
+	}
+	status, err := groups[0].Check(vaultRoot)
+	if err != nil || len(status.Damage) != 0 {
+		t.Fatalf("Check of an intact group = %+v, %v", status.Damage, err)
+	}
+
+	// Lose one chunk and corrupt another
+	if err := os.Remove(filepath.Join(chunkDir, "bbbb")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chunkDir, "cccc"), []byte("X"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	status, err = groups[0].Check(vaultRoot)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(status.Damage) != 2 || status.Damage[0].Reason != DamageMissing || status.Damage[1].Reason != DamageCorrupt {
+		t.Fatalf("Check damage = %+v, want bbbb missing and cccc corrupt", status.Damage)
+	}
+	rebuilt, err := status.Rebuild()
+	if err != nil {
+		t.Fatalf("Rebuild failed: %v", err)
+	}
+	if !bytes.Equal(rebuilt[0], chunks[1]) || !bytes.Equal(rebuilt[1], chunks[2]) {
+		t.Fatalf("Rebuild = %q, want %q and %q", rebuilt, chunks[1], chunks[2])
+	}
+
+	// A third damaged shard is more than two parity shards can rebuild
+	if err := os.Remove(filepath.Join(Dir(vaultRoot), g.Parity[0].Name)); err != nil {
+		t.Fatal(err)
+	}
+	status, err = groups[0].Check(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Recoverable() {
+		t.Fatal("a group with three damaged shards and two parity shards should not be recoverable")
+	}
+	if _, err := status.Rebuild(); err == nil {
+		t.Fatal("Rebuild of an unrecoverable group should fail")
+	}
+}
@@ -0,0 +1,94 @@
+// Package quota measures the chunk store of a vault against the soft and hard
+// size limits of its quota settings.
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// ErrHardLimit is returned when a change would grow the chunk store past its
+// hard quota
+var ErrHardLimit = errors.New("hard quota exceeded")
+
+// Usage is the size of a vault's chunk store and its limits
+type Usage struct {
+	Used   int64 `json:"used" yaml:"used"` // Bytes of the chunks stored
+	Chunks int   `json:"chunks" yaml:"chunks"`
+	Soft   int64 `json:"soft,omitempty" yaml:"soft,omitempty"` // 0 is no limit
+	Hard   int64 `json:"hard,omitempty" yaml:"hard,omitempty"` // 0 is no limit
+}
+
+// Limits returns the soft and hard limits of q in bytes, 0 for no limit
+func Limits(q config.QuotaConfig) (soft, hard int64, err error) {
+	if q.Soft != "" {
+		if soft, err = util.ParseChunkSize(q.Soft); err != nil {
+			return 0, 0, fmt.Errorf("invalid quota.soft %q: %w", q.Soft, err)
+		}
+	}
+	if q.Hard != "" {
+		if hard, err = util.ParseChunkSize(q.Hard); err != nil {
+			return 0, 0, fmt.Errorf("invalid quota.hard %q: %w", q.Hard, err)
+		}
+	}
+	return soft, hard, nil
+}
+
+// Measure returns the usage of the chunk store of the vault at vaultRoot
+// against the limits of q
+func Measure(vaultRoot string, q config.QuotaConfig) (*Usage, error) {
+	soft, hard, err := Limits(q)
+	if err != nil {
+		return nil, err
+	}
+	u := &Usage{Soft: soft, Hard: hard}
+	err = fs.WalkChunks(vaultRoot, func(_, _ string, entry os.DirEntry) error {
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			return nil // removed while we looked
+		}
+		if err != nil {
+			return err
+		}
+		u.Used += info.Size()
+		u.Chunks++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure chunk store: %w", err)
+	}
+	return u, nil
+}
+
+// Limited reports whether the quota sets a soft or a hard limit
+func (u *Usage) Limited() bool {
+	return u.Soft > 0 || u.Hard > 0
+}
+
+// OverSoft reports whether the chunk store is larger than its soft limit
+func (u *Usage) OverSoft() bool {
+	return u.Soft > 0 && u.Used > u.Soft
+}
+
+// OverHard reports whether the chunk store is larger than its hard limit
+func (u *Usage) OverHard() bool {
+	return u.Hard > 0 && u.Used > u.Hard
+}
+
+// Grow returns the usage after adding bytes of chunks to the store, and an
+// error wrapping ErrHardLimit if that is more than the hard limit allows.
+// Adding nothing is always allowed, even to a store over its limit.
+func (u *Usage) Grow(bytes int64) (*Usage, error) {
+	after := *u
+	after.Used += bytes
+	if bytes > 0 && after.OverHard() {
+		return &after, fmt.Errorf("%w: %s of new chunks would grow the chunk store to %s, over its hard quota of %s",
+			ErrHardLimit, util.HumanReadableSize(bytes), util.HumanReadableSize(after.Used), util.HumanReadableSize(u.Hard))
+	}
+	return &after, nil
+}
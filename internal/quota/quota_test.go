@@ -0,0 +1,53 @@
+package quota
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func TestMeasureAndGrow(t *testing.T) {
+	root := t.TempDir()
+	chunks := filepath.Join(root, ".sietch", "chunks")
+	if err := os.MkdirAll(filepath.Join(chunks, "ab"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"one": 600, filepath.Join("ab", "abcd"): 400} {
+		if err := os.WriteFile(filepath.Join(chunks, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := Measure(root, config.QuotaConfig{Soft: "1KB", Hard: "2KB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Used != 1000 || u.Chunks != 2 || u.Soft != 1024 || u.Hard != 2048 {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+	if u.OverSoft() || u.OverHard() {
+		t.Errorf("1000 bytes should be within both limits: %+v", u)
+	}
+
+	after, err := u.Grow(100)
+	if err != nil || !after.OverSoft() || after.OverHard() {
+		t.Errorf("growing past the soft limit = %+v, %v; want a usage over the soft limit only", after, err)
+	}
+	if _, err := u.Grow(1100); !errors.Is(err, ErrHardLimit) {
+		t.Errorf("growing past the hard limit should fail with ErrHardLimit, got %v", err)
+	}
+	full := &Usage{Used: 3000, Hard: 2048}
+	if _, err := full.Grow(0); err != nil {
+		t.Errorf("adding nothing to a store over its limit should be allowed, got %v", err)
+	}
+
+	if _, err := Measure(root, config.QuotaConfig{Hard: "lots"}); err == nil {
+		t.Error("an invalid quota.hard should fail")
+	}
+	if u, err := Measure(t.TempDir(), config.QuotaConfig{}); err != nil || u.Used != 0 || u.Limited() {
+		t.Errorf("a vault without a chunk store or quota = %+v, %v", u, err)
+	}
+}
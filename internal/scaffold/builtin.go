@@ -0,0 +1,124 @@
+package scaffold
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/substantialcattle5/sietch/internal/constants"
+	"github.com/substantialcattle5/sietch/util"
+)
+
+// builtInTemplates are compiled into sietch so they are available no matter
+// where the binary runs. A user template with the same name in
+// ~/.config/sietch/templates takes precedence.
+var builtInTemplates = map[string]Template{
+	"photo-vault": {
+		Name:        "photo-vault",
+		Description: "Large chunks for already-compressed photos, with deduplication for copies and exports",
+		Version:     "1.0.0",
+		Author:      "Sietch Team",
+		Tags:        []string{"photos", "media"},
+		Config: TemplateConfig{
+			ChunkingStrategy:  "fixed",
+			ChunkSize:         "8MB",
+			HashAlgorithm:     constants.HashAlgorithmSHA256,
+			Compression:       constants.CompressionTypeNone,
+			SyncMode:          "manual",
+			EnableDedup:       true,
+			DedupStrategy:     "content",
+			DedupMinSize:      "1MB",
+			DedupMaxSize:      "64MB",
+			DedupGCThreshold:  500,
+			DedupIndexEnabled: true,
+		},
+	},
+	"docs-archive": {
+		Name:        "docs-archive",
+		Description: "Small compressed chunks for documents and PDFs that are revised often",
+		Version:     "1.0.0",
+		Author:      "Sietch Team",
+		Tags:        []string{"documents", "archive"},
+		Config: TemplateConfig{
+			ChunkingStrategy:  "fixed",
+			ChunkSize:         "1MB",
+			HashAlgorithm:     constants.HashAlgorithmSHA256,
+			Compression:       constants.CompressionTypeZstd,
+			SyncMode:          "manual",
+			EnableDedup:       true,
+			DedupStrategy:     "content",
+			DedupMinSize:      "256KB",
+			DedupMaxSize:      "32MB",
+			DedupGCThreshold:  1500,
+			DedupIndexEnabled: true,
+		},
+	},
+	"code-backup": {
+		Name:        "code-backup",
+		Description: "Compressed chunks for source trees and build outputs with heavy duplication",
+		Version:     "1.0.0",
+		Author:      "Sietch Team",
+		Tags:        []string{"code", "backup"},
+		Config: TemplateConfig{
+			ChunkingStrategy:  "fixed",
+			ChunkSize:         "2MB",
+			HashAlgorithm:     constants.HashAlgorithmSHA256,
+			Compression:       constants.CompressionTypeZstd,
+			SyncMode:          "manual",
+			EnableDedup:       true,
+			DedupStrategy:     "content",
+			DedupMinSize:      "64KB",
+			DedupMaxSize:      "16MB",
+			DedupGCThreshold:  2000,
+			DedupIndexEnabled: true,
+		},
+	},
+}
+
+// BuiltInTemplate returns a copy of the built-in template with the given name
+func BuiltInTemplate(name string) (*Template, bool) {
+	t, ok := builtInTemplates[name]
+	if !ok {
+		return nil, false
+	}
+	t.Tags = slices.Clone(t.Tags)
+	return &t, true
+}
+
+// BuiltInTemplateNames returns the names of the built-in templates, sorted
+func BuiltInTemplateNames() []string {
+	names := make([]string, 0, len(builtInTemplates))
+	for name := range builtInTemplates {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Validate checks that the template's settings are ones a vault can use, so a
+// broken user template is rejected before any vault files are written
+func (t *Template) Validate() error {
+	c := t.Config
+	if c.ChunkSize != "" {
+		if size, err := util.ParseChunkSize(c.ChunkSize); err != nil || size <= 0 {
+			return fmt.Errorf("invalid chunk_size %q", c.ChunkSize)
+		}
+	}
+	for field, size := range map[string]string{"dedup_min_size": c.DedupMinSize, "dedup_max_size": c.DedupMaxSize} {
+		if size == "" {
+			continue
+		}
+		if n, err := util.ParseChunkSize(size); err != nil || n <= 0 {
+			return fmt.Errorf("invalid %s %q", field, size)
+		}
+	}
+	if c.Compression != "" && !slices.Contains([]string{constants.CompressionTypeNone, constants.CompressionTypeGzip, constants.CompressionTypeZstd}, c.Compression) {
+		return fmt.Errorf("unsupported compression %q", c.Compression)
+	}
+	if c.HashAlgorithm != "" && !slices.Contains([]string{constants.HashAlgorithmSHA256, constants.HashAlgorithmSHA512, constants.HashAlgorithmSHA1, constants.HashAlgorithmBLAKE3}, c.HashAlgorithm) {
+		return fmt.Errorf("unsupported hash_algorithm %q", c.HashAlgorithm)
+	}
+	if c.DedupGCThreshold < 0 {
+		return fmt.Errorf("dedup_gc_threshold must not be negative")
+	}
+	return nil
+}
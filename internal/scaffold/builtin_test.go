@@ -0,0 +1,64 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestBuiltInTemplatesAreValid(t *testing.T) {
+	for _, name := range BuiltInTemplateNames() {
+		template, ok := BuiltInTemplate(name)
+		if !ok {
+			t.Fatalf("BuiltInTemplate(%q) not found", name)
+		}
+		if err := template.Validate(); err != nil {
+			t.Errorf("built-in template %s is invalid: %v", name, err)
+		}
+	}
+}
+
+func TestLoadTemplatePrefersUserTemplates(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	template, err := LoadTemplate("photo-vault")
+	if err != nil || template.Config.ChunkSize != "8MB" {
+		t.Fatalf("expected built-in photo-vault, got %+v (%v)", template, err)
+	}
+
+	dir := filepath.Join(home, ".config", "sietch", "templates")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	custom := `{"name": "photo-vault", "config": {"chunk_size": "16MB", "compression": "gzip"}}`
+	if err := os.WriteFile(filepath.Join(dir, "photo-vault.json"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	broken := `{"name": "broken", "config": {"compression": "lz4"}}`
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(broken), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	template, err = ValidateTemplate("photo-vault")
+	if err != nil || template.Config.ChunkSize != "16MB" {
+		t.Fatalf("expected user photo-vault, got %+v (%v)", template, err)
+	}
+	if _, err := ValidateTemplate("broken"); err == nil {
+		t.Error("expected a template with unsupported compression to be rejected")
+	}
+	if _, err := LoadTemplate("missing"); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+
+	names, err := ListAvailableTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"broken", "code-backup", "docs-archive", "photo-vault"}
+	if !slices.Equal(names, want) {
+		t.Errorf("ListAvailableTemplates() = %v, want %v", names, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 
 	"github.com/substantialcattle5/sietch/internal/fs"
 )
@@ -53,7 +54,8 @@ func EnsureConfigDirectories() error {
 	return fs.EnsureDirectory(templatesDir)
 }
 
-// ListAvailableTemplates lists all available templates from config directory
+// ListAvailableTemplates lists the built-in templates and all templates from
+// the config directory, sorted and without duplicates
 // This function assumes EnsureDefaultTemplates() has been called first
 func ListAvailableTemplates() ([]string, error) {
 	templatesDir, err := GetTemplatesDirectory()
@@ -61,7 +63,7 @@ func ListAvailableTemplates() ([]string, error) {
 		return nil, err
 	}
 
-	var templates []string
+	templates := BuiltInTemplateNames()
 
 	// Read templates from user config directory
 	if _, err := os.Stat(templatesDir); !os.IsNotExist(err) {
@@ -78,7 +80,8 @@ func ListAvailableTemplates() ([]string, error) {
 		}
 	}
 
-	return templates, nil
+	slices.Sort(templates)
+	return slices.Compact(templates), nil
 }
 
 func GetBuiltInTemplates() []string {
@@ -101,7 +104,8 @@ func GetBuiltInTemplates() []string {
 	return templates
 }
 
-// LoadTemplate loads a template from user config directory
+// LoadTemplate loads a template from user config directory, falling back to
+// the built-in templates when there is no user template with that name
 // This function assumes EnsureDefaultTemplates() has been called first
 func LoadTemplate(templateName string) (*Template, error) {
 	// Load template from user config directory
@@ -112,11 +116,18 @@ func LoadTemplate(templateName string) (*Template, error) {
 
 	templatePath := filepath.Join(templatesDir, templateName+".json")
 	if _, err := os.Stat(templatePath); err != nil {
-		return nil, fmt.Errorf("template '%s' not found in user config directory (%s)", templateName, templatesDir)
+		if template, ok := BuiltInTemplate(templateName); ok {
+			return template, nil
+		}
+		return nil, fmt.Errorf("template '%s' not found in built-in templates or user config directory (%s)", templateName, templatesDir)
 	}
 
-	// Read and parse template file
-	data, err := os.ReadFile(templatePath)
+	return LoadTemplateFile(templatePath)
+}
+
+// LoadTemplateFile loads the template stored at path
+func LoadTemplateFile(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read template file: %v", err)
 	}
@@ -135,6 +146,9 @@ func ValidateTemplate(templateName string) (*Template, error) {
 	if err != nil {
 		return nil, fmt.Errorf("template validation failed: %v", err)
 	}
+	if err := template.Validate(); err != nil {
+		return nil, fmt.Errorf("template '%s' is invalid: %v", templateName, err)
+	}
 	return template, nil
 }
 
@@ -0,0 +1,214 @@
+// Package scrub verifies the stored chunks of a vault a share at a time, so
+// every chunk is checked regularly without reading the whole vault each run.
+// When each chunk was last verified is kept in .sietch/scrub/state.json, and
+// runs check the chunks that were never verified, or longest ago, first.
+package scrub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
+)
+
+// State records when each chunk was last verified
+type State struct {
+	LastRun time.Time            `json:"last_run,omitempty"`
+	Chunks  map[string]time.Time `json:"chunks"` // Storage name → last verified
+}
+
+// statePath is where the scrub state of the vault at vaultRoot is kept
+func statePath(vaultRoot string) string {
+	return filepath.Join(vaultRoot, ".sietch", "scrub", "state.json")
+}
+
+// LoadState reads the scrub state of the vault, empty if it was never scrubbed
+func LoadState(vaultRoot string) (*State, error) {
+	s := &State{Chunks: make(map[string]time.Time)}
+	data, err := os.ReadFile(statePath(vaultRoot))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scrub state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse scrub state: %w", err)
+	}
+	if s.Chunks == nil {
+		s.Chunks = make(map[string]time.Time)
+	}
+	return s, nil
+}
+
+// Save writes the scrub state of the vault, replacing the previous one
+func (s *State) Save(vaultRoot string) error {
+	path := statePath(vaultRoot)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create scrub directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode scrub state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write scrub state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save scrub state: %w", err)
+	}
+	return nil
+}
+
+// Target is a stored chunk to verify and the files that reference it
+type Target struct {
+	Ref   config.ChunkRef
+	Files []string // Vault paths
+}
+
+// Targets returns every chunk referenced by files, once each, ordered by
+// storage name. Chunks no file references any more are dropped from the state.
+func (s *State) Targets(files []config.FileManifest) []Target {
+	byName := make(map[string]*Target)
+	for _, file := range files {
+		filePath := file.Destination + file.FilePath
+		for _, ref := range file.Chunks {
+			name := chunk.StorageName(ref)
+			if name == "" {
+				continue
+			}
+			t, ok := byName[name]
+			if !ok {
+				t = &Target{Ref: ref}
+				byName[name] = t
+			}
+			if len(t.Files) == 0 || t.Files[len(t.Files)-1] != filePath {
+				t.Files = append(t.Files, filePath)
+			}
+		}
+	}
+	for name := range s.Chunks {
+		if _, ok := byName[name]; !ok {
+			delete(s.Chunks, name)
+		}
+	}
+
+	targets := make([]Target, 0, len(byName))
+	for _, t := range byName {
+		targets = append(targets, *t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return chunk.StorageName(targets[i].Ref) < chunk.StorageName(targets[j].Ref)
+	})
+	return targets
+}
+
+// Select returns the percent of targets, rounded up, to verify this run:
+// chunks never verified first, then those verified longest ago
+func (s *State) Select(targets []Target, percent int) []Target {
+	n := (len(targets)*percent + 99) / 100
+	if n >= len(targets) {
+		return targets
+	}
+	ordered := append([]Target(nil), targets...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return s.Chunks[chunk.StorageName(ordered[i].Ref)].Before(s.Chunks[chunk.StorageName(ordered[j].Ref)])
+	})
+	return ordered[:n]
+}
+
+// Result is the outcome of verifying a selection of chunks
+type Result struct {
+	Checked int                  // Chunks verified, damaged ones included
+	Bytes   int64                // Stored bytes read
+	Damaged []chunk.DamagedChunk // Missing or corrupt chunks, ordered by storage name
+}
+
+// Verify reads every target from the chunk store and checks it against its
+// recorded hashes. Chunks that pass are stamped with now; damaged chunks lose
+// their stamp, so the next run checks them again. It stops early when ctx is
+// cancelled, and the chunks verified until then are kept in the result and
+// the state.
+func (s *State) Verify(ctx context.Context, vaultRoot string, targets []Target, vaultConfig config.VaultConfig, now time.Time) (*Result, error) {
+	result := &Result{Damaged: []chunk.DamagedChunk{}}
+	for _, t := range targets {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		name := chunk.StorageName(t.Ref)
+		data, err := os.ReadFile(fs.LocateChunk(vaultRoot, name))
+		switch {
+		case os.IsNotExist(err):
+			result.Damaged = append(result.Damaged, chunk.DamagedChunk{Ref: t.Ref, Reason: chunk.DamageMissing, Files: t.Files})
+			delete(s.Chunks, name)
+		case err != nil:
+			return result, fmt.Errorf("failed to read chunk %s: %w", name, err)
+		case chunk.VerifyStored(data, t.Ref, vaultConfig) != nil:
+			result.Damaged = append(result.Damaged, chunk.DamagedChunk{Ref: t.Ref, Reason: chunk.DamageCorrupt, Files: t.Files})
+			delete(s.Chunks, name)
+		default:
+			s.Chunks[name] = now
+		}
+		result.Checked++
+		result.Bytes += int64(len(data))
+	}
+	sort.Slice(result.Damaged, func(i, j int) bool {
+		return chunk.StorageName(result.Damaged[i].Ref) < chunk.StorageName(result.Damaged[j].Ref)
+	})
+	return result, nil
+}
+
+// Verified returns when every chunk of file was last verified, the time of
+// the one verified longest ago, or false if any chunk has not been verified
+// since it was last found damaged
+func (s *State) Verified(file *config.FileManifest) (time.Time, bool) {
+	var oldest time.Time
+	for _, ref := range file.Chunks {
+		at, ok := s.Chunks[chunk.StorageName(ref)]
+		if !ok {
+			return time.Time{}, false
+		}
+		if oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+		}
+	}
+	return oldest, !oldest.IsZero()
+}
+
+// Stamp moves file's LastVerified forward to when all its chunks were last
+// verified and reports whether it changed
+func (s *State) Stamp(file *config.FileManifest) bool {
+	at, ok := s.Verified(file)
+	if !ok || !at.After(file.LastVerified) {
+		return false
+	}
+	file.LastVerified = at
+	return true
+}
+
+// Coverage returns how many targets have been verified and when the one
+// verified longest ago was, zero if some were never verified
+func (s *State) Coverage(targets []Target) (verified int, oldest time.Time) {
+	for _, t := range targets {
+		at, ok := s.Chunks[chunk.StorageName(t.Ref)]
+		if !ok {
+			continue
+		}
+		verified++
+		if oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+		}
+	}
+	if verified < len(targets) {
+		oldest = time.Time{}
+	}
+	return verified, oldest
+}
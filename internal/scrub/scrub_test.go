@@ -0,0 +1,107 @@
+package scrub
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/substantialcattle5/sietch/internal/chunk"
+	"github.com/substantialcattle5/sietch/internal/config"
+)
+
+func sha(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+func TestScrubRuns(t *testing.T) {
+	vaultRoot := t.TempDir()
+	chunkDir := filepath.Join(vaultRoot, ".sietch", "chunks")
+	if err := os.MkdirAll(chunkDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var refs []config.ChunkRef
+	for _, data := range []string{"one", "two", "three", "four"} {
+		if err := os.WriteFile(filepath.Join(chunkDir, sha([]byte(data))), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		refs = append(refs, config.ChunkRef{Hash: sha([]byte(data))})
+	}
+	files := []config.FileManifest{
+		{FilePath: "a", Destination: "x/", Chunks: refs[:2]},
+		{FilePath: "b", Destination: "x/", Chunks: refs[1:]},
+	}
+
+	state, err := LoadState(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Chunks["gone"] = time.Now() // No longer referenced
+	targets := state.Targets(files)
+	if len(targets) != 4 || len(state.Chunks) != 0 {
+		t.Fatalf("expected 4 targets and the unreferenced chunk dropped, got %d and %v", len(targets), state.Chunks)
+	}
+
+	// Half the chunks per run: two runs cover the vault
+	ctx := context.Background()
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	picked := state.Select(targets, 50)
+	if len(picked) != 2 {
+		t.Fatalf("expected 2 chunks selected, got %d", len(picked))
+	}
+	if _, err := state.Verify(ctx, vaultRoot, picked, config.VaultConfig{}, first); err != nil {
+		t.Fatal(err)
+	}
+	if verified, oldest := state.Coverage(targets); verified != 2 || !oldest.IsZero() {
+		t.Errorf("after one run expected 2 chunks verified, got %d (oldest %v)", verified, oldest)
+	}
+
+	second := first.Add(time.Hour)
+	picked = state.Select(targets, 50)
+	for _, p := range picked {
+		if _, ok := state.Chunks[chunk.StorageName(p.Ref)]; ok {
+			t.Errorf("chunk %s was verified already but selected before unverified ones", p.Ref.Hash)
+		}
+	}
+	if _, err := state.Verify(ctx, vaultRoot, picked, config.VaultConfig{}, second); err != nil {
+		t.Fatal(err)
+	}
+	if verified, oldest := state.Coverage(targets); verified != 4 || !oldest.Equal(first) {
+		t.Errorf("after two runs expected all chunks verified by %v, got %d by %v", first, verified, oldest)
+	}
+	for i := range files {
+		if !state.Stamp(&files[i]) || files[i].LastVerified.IsZero() {
+			t.Errorf("expected %s to be stamped", files[i].FilePath)
+		}
+	}
+
+	// Corrupt a chunk both files share and scrub everything
+	if err := os.WriteFile(filepath.Join(chunkDir, refs[1].Hash), []byte("bitrot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := state.Verify(ctx, vaultRoot, state.Select(targets, 100), config.VaultConfig{}, second.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Checked != 4 || len(result.Damaged) != 1 || result.Damaged[0].Reason != chunk.DamageCorrupt || len(result.Damaged[0].Files) != 2 {
+		t.Fatalf("expected one corrupt chunk shared by both files, got %+v", result)
+	}
+	before := files[0].LastVerified
+	if state.Stamp(&files[0]) || !files[0].LastVerified.Equal(before) {
+		t.Errorf("a file with a damaged chunk should keep its last verified time")
+	}
+
+	if err := state.Save(vaultRoot); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadState(vaultRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Chunks) != 3 {
+		t.Errorf("expected 3 verified chunks after reload, got %d", len(loaded.Chunks))
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
 )
 
 // DiscoverVaults scans for vaults in common locations
@@ -132,7 +133,7 @@ func IsValidVault(vaultPath string) bool {
 	}
 
 	// Check for chunks directory
-	chunksDir := filepath.Join(sietchDir, "chunks")
+	chunksDir := fs.GetChunkDirectory(vaultPath)
 	if chunksInfo, err := os.Stat(chunksDir); err != nil || !chunksInfo.IsDir() {
 		return false
 	}
@@ -1,6 +1,7 @@
 package sneakernet
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -319,8 +320,10 @@ func (st *SneakTransfer) writeFileManifest(manifestsDir string, fileManifest con
 		return fmt.Errorf("failed to create manifests directory: %v", err)
 	}
 
-	// Generate manifest filename (use a safe filename based on the file path)
-	manifestName := st.generateManifestFilename(fileManifest.FilePath)
+	manifestName, err := config.ManifestFileName(st.DestVault, fileManifest.Destination, fileManifest.FilePath)
+	if err != nil {
+		return err
+	}
 	manifestPath := filepath.Join(manifestsDir, manifestName)
 
 	// Write manifest file (this would need to be implemented to match the existing format)
@@ -399,30 +402,24 @@ func (st *SneakTransfer) generateRenameName(originalPath string) string {
 	return filepath.Join(dir, newName)
 }
 
-// generateManifestFilename creates a safe filename for manifest files
-func (st *SneakTransfer) generateManifestFilename(filePath string) string {
-	// Replace path separators and unsafe characters
-	safe := strings.ReplaceAll(filePath, "/", "_")
-	safe = strings.ReplaceAll(safe, "\\", "_")
-	safe = strings.ReplaceAll(safe, ":", "_")
-	return safe + ".yaml"
-}
-
 // saveFileManifest saves a file manifest
 func (st *SneakTransfer) saveFileManifest(manifestPath string, fileManifest config.FileManifest) error {
-	// Create the file
-	file, err := os.Create(manifestPath)
-	if err != nil {
-		return fmt.Errorf("failed to create manifest file: %v", err)
-	}
-	defer file.Close()
-
 	// Encode the manifest to YAML with proper indentation
-	encoder := yaml.NewEncoder(file)
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
 	encoder.SetIndent(2)
 	if err := encoder.Encode(fileManifest); err != nil {
 		return fmt.Errorf("failed to encode manifest: %v", err)
 	}
 
+	// Seal the manifest if the destination vault encrypts its manifests
+	data, err := config.SealMetadata(st.DestVault, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to create manifest file: %v", err)
+	}
+
 	return nil
 }
@@ -35,6 +35,9 @@ func PrintSuccessMessage(cfg *config.VaultConfig, vaultID, vaultPath string) {
 	fmt.Printf("  • Chunking:    %s (size: %s)\n", cfg.Chunking.Strategy, cfg.Chunking.ChunkSize)
 	fmt.Printf("  • Hash:        %s\n", cfg.Chunking.HashAlgorithm)
 	fmt.Printf("  • Compression: %s\n", cfg.Compression)
+	if cfg.ChunkStore != "" {
+		fmt.Printf("  • Chunks in:   %s\n", cfg.ChunkStore)
+	}
 
 	// Metadata
 	fmt.Println("\n📋 Metadata:")
@@ -9,13 +9,13 @@ import (
 	"io"
 	"os"
 	"strings"
-	"syscall"
+	"sync"
 
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 
 	"github.com/substantialcattle5/sietch/internal/config"
+	"github.com/substantialcattle5/sietch/internal/fs"
 	passphrasevalidation "github.com/substantialcattle5/sietch/internal/passphrase"
 )
 
@@ -40,8 +40,9 @@ func readPassphraseFromFile(filePath string) (string, error) {
 		return "", fmt.Errorf("failed to access passphrase file: %w", err)
 	}
 
-	// Warn if file permissions are too open (not strictly enforced, just a warning)
-	if fileInfo.Mode().Perm()&0o077 != 0 {
+	// Warn if file permissions are too open (not strictly enforced, just a warning).
+	// Windows reports every writable file as 0666, so there is nothing to check.
+	if fs.PermissionsEnforced && fileInfo.Mode().Perm()&0o077 != 0 {
 		fmt.Fprintf(os.Stderr, "Warning: passphrase file has overly permissive permissions (%v). Recommended: 0600\n", fileInfo.Mode().Perm())
 	}
 
@@ -60,6 +61,13 @@ func readPassphraseFromFile(filePath string) (string, error) {
 	return passphrase, nil
 }
 
+// vaultPassphrases caches passphrases by key path, so a command that needs a
+// vault's key more than once reads stdin or prompts only the first time
+var (
+	vaultPassphrasesMu sync.Mutex
+	vaultPassphrases   = make(map[string]string)
+)
+
 // GetPassphraseForVault retrieves the passphrase for an encrypted vault from multiple sources
 // in order of preference: stdin, file, environment variable, or interactive prompt.
 // It handles validation and ensures the passphrase meets security requirements.
@@ -69,6 +77,22 @@ func GetPassphraseForVault(cmd *cobra.Command, vaultConfig *config.VaultConfig)
 		return "", nil
 	}
 
+	vaultPassphrasesMu.Lock()
+	defer vaultPassphrasesMu.Unlock()
+	if passphrase, ok := vaultPassphrases[vaultConfig.Encryption.KeyPath]; ok {
+		return passphrase, nil
+	}
+
+	passphrase, err := readPassphraseForVault(cmd, vaultConfig)
+	if err != nil {
+		return "", err
+	}
+	vaultPassphrases[vaultConfig.Encryption.KeyPath] = passphrase
+	return passphrase, nil
+}
+
+// readPassphraseForVault reads the passphrase of a passphrase protected vault
+func readPassphraseForVault(cmd *cobra.Command, vaultConfig *config.VaultConfig) (string, error) {
 	passphrase := ""
 	var err error
 
@@ -130,7 +154,7 @@ func GetPassphraseForVault(cmd *cobra.Command, vaultConfig *config.VaultConfig)
 			// Use simple terminal prompt for non-interactive sessions
 			fmt.Printf("Vault uses %s encryption with passphrase protection.\n", vaultConfig.Encryption.Type)
 			fmt.Print("Enter passphrase: ")
-			bytePassphrase, err := term.ReadPassword(int(syscall.Stdin))
+			bytePassphrase, err := readPassword()
 			if err != nil {
 				return "", fmt.Errorf("error reading passphrase: %w", err)
 			}
@@ -214,6 +238,15 @@ func GetPassphraseForInitialization(cmd *cobra.Command, requireConfirmation bool
 		return passphraseEnv, nil
 	}
 
+	// Scripts get an error instead of a prompt they cannot answer
+	nonInteractive := false
+	if cmd.Flags().Lookup("non-interactive") != nil {
+		nonInteractive, _ = cmd.Flags().GetBool("non-interactive")
+	}
+	if nonInteractive || !stdinIsTerminal() {
+		return "", fmt.Errorf("passphrase required but cannot prompt for it: use --passphrase-stdin, --passphrase-file or SIETCH_PASSPHRASE")
+	}
+
 	// Check if interactive mode is enabled
 	interactiveMode, _ := cmd.Flags().GetBool("interactive")
 
@@ -260,7 +293,7 @@ func GetPassphraseForInitialization(cmd *cobra.Command, requireConfirmation bool
 	} else {
 		// Use simple terminal input for non-interactive mode
 		fmt.Print("Enter encryption passphrase (min 8 characters): ")
-		bytePassphrase, err := term.ReadPassword(int(syscall.Stdin))
+		bytePassphrase, err := readPassword()
 		if err != nil {
 			return "", fmt.Errorf("error reading passphrase: %w", err)
 		}
@@ -277,7 +310,7 @@ func GetPassphraseForInitialization(cmd *cobra.Command, requireConfirmation bool
 		// Add confirmation if required
 		if requireConfirmation {
 			fmt.Print("Confirm passphrase: ")
-			byteConfirmation, err := term.ReadPassword(int(syscall.Stdin))
+			byteConfirmation, err := readPassword()
 			if err != nil {
 				return "", fmt.Errorf("error reading passphrase confirmation: %w", err)
 			}
@@ -293,3 +326,57 @@ func GetPassphraseForInitialization(cmd *cobra.Command, requireConfirmation bool
 		return enteredPassphrase, nil
 	}
 }
+
+// GetNewPassphrase retrieves a replacement passphrase for a vault from the
+// --new-passphrase-file flag, the SIETCH_NEW_PASSPHRASE environment variable
+// or, failing both, a confirmed terminal prompt
+func GetNewPassphrase(cmd *cobra.Command) (string, error) {
+	passphrase := ""
+	source := ""
+	if cmd.Flags().Lookup("new-passphrase-file") != nil {
+		if passphraseFile, _ := cmd.Flags().GetString("new-passphrase-file"); passphraseFile != "" {
+			var err error
+			if passphrase, err = readPassphraseFromFile(passphraseFile); err != nil {
+				return "", err
+			}
+			source = "new passphrase from file"
+		}
+	}
+	if passphrase == "" {
+		if passphrase = os.Getenv("SIETCH_NEW_PASSPHRASE"); passphrase != "" {
+			source = "new passphrase from environment variable"
+		}
+	}
+
+	if passphrase == "" {
+		fmt.Print("Enter new passphrase: ")
+		bytePassphrase, err := readPassword()
+		if err != nil {
+			return "", fmt.Errorf("error reading passphrase: %w", err)
+		}
+		fmt.Println() // Add newline after password input
+		passphrase = string(bytePassphrase)
+
+		result := passphrasevalidation.ValidateHybrid(passphrase)
+		if !result.Valid || len(result.Warnings) > 0 {
+			return "", fmt.Errorf("%s", passphrasevalidation.GetHybridErrorMessage(result))
+		}
+
+		fmt.Print("Confirm new passphrase: ")
+		byteConfirmation, err := readPassword()
+		if err != nil {
+			return "", fmt.Errorf("error reading passphrase confirmation: %w", err)
+		}
+		fmt.Println() // Add newline after password input
+		if passphrase != string(byteConfirmation) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+		return passphrase, nil
+	}
+
+	result := passphrasevalidation.ValidateHybrid(passphrase)
+	if !result.Valid || len(result.Warnings) > 0 {
+		return "", fmt.Errorf("%s: %s", source, passphrasevalidation.GetHybridErrorMessage(result))
+	}
+	return passphrase, nil
+}
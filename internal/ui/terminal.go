@@ -0,0 +1,61 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package ui
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stdinFd returns the descriptor of stdin for the terminal functions. It is
+// taken from os.Stdin rather than syscall.Stdin, which on Windows is a
+// console handle of another type.
+func stdinFd() int {
+	return int(os.Stdin.Fd())
+}
+
+// stdinIsTerminal reports whether stdin is an interactive terminal that can
+// be prompted
+func stdinIsTerminal() bool {
+	return term.IsTerminal(stdinFd())
+}
+
+// readPassword reads a line from stdin without echoing it. Stdin that is not
+// a terminal, such as a pipe or the mintty console of Git for Windows (which
+// native programs see as a pipe), cannot hide input, so the line is read as
+// typed instead of failing.
+func readPassword() ([]byte, error) {
+	if stdinIsTerminal() {
+		return term.ReadPassword(stdinFd())
+	}
+	line, err := readLine(os.Stdin)
+	return []byte(line), err
+}
+
+// readLine reads r up to the next newline, without the line ending. It reads
+// a byte at a time so nothing after the line is consumed, leaving a piped
+// confirmation for the next read.
+func readLine(r io.Reader) (string, error) {
+	var line strings.Builder
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+			line.WriteByte(buf[0])
+		}
+		if err == io.EOF && line.Len() > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(line.String(), "\r"), nil
+}
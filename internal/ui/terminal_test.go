@@ -0,0 +1,24 @@
+/*
+Copyright © 2025 SubstantialCattle5, nilaysharan.com
+*/
+package ui
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLineLeavesTheNextLine(t *testing.T) {
+	r := strings.NewReader("first secret\r\nsecond secret\nlast")
+
+	for _, want := range []string{"first secret", "second secret", "last"} {
+		got, err := readLine(r)
+		if err != nil || got != want {
+			t.Fatalf("readLine() = %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := readLine(r); err != io.EOF {
+		t.Errorf("expected io.EOF once input is exhausted, got %v", err)
+	}
+}
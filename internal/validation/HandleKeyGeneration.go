@@ -26,6 +26,7 @@ type KeyGenParams struct {
 	ScryptR          int
 	ScryptP          int
 	PBKDF2Iterations int
+	KeyMaterial      []byte // Existing key to protect and store instead of generating one
 }
 
 // HandleKeyGeneration manages key generation or import for a vault
@@ -124,7 +125,13 @@ func generateAESKey(keyPath string, params KeyGenParams, userPassphrase string)
 	}
 
 	// Generate the key configuration
-	keyConfig, err := aeskey.GenerateAESKey(encConfig, userPassphrase)
+	var keyConfig *config.KeyConfig
+	var err error
+	if params.KeyMaterial != nil {
+		keyConfig, err = aeskey.GenerateAESKeyFromMaterial(encConfig, userPassphrase, params.KeyMaterial)
+	} else {
+		keyConfig, err = aeskey.GenerateAESKey(encConfig, userPassphrase)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate AES key: %w", err)
 	}
@@ -162,7 +169,13 @@ func generateChaCha20Key(keyPath string, params KeyGenParams, userPassphrase str
 	}
 
 	// Generate the key configuration
-	keyConfig, err := chachakey.GenerateChaCha20Key(encConfig, userPassphrase)
+	var keyConfig *config.KeyConfig
+	var err error
+	if params.KeyMaterial != nil {
+		keyConfig, err = chachakey.GenerateChaCha20KeyFromMaterial(encConfig, userPassphrase, params.KeyMaterial)
+	} else {
+		keyConfig, err = chachakey.GenerateChaCha20Key(encConfig, userPassphrase)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ChaCha20 key: %w", err)
 	}
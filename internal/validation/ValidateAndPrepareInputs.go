@@ -1,7 +1,6 @@
 package validation
 
 import (
-	"fmt"
 	"strings"
 )
 
@@ -12,17 +11,7 @@ func ValidateAndPrepareInputs(author string, tags []string, templateName string,
 	// Single-pass tags validation for efficiency
 	tags = validateTags(tags)
 
-	// Apply template configuration if specified
-	if templateName != "" {
-		fmt.Printf("Applying template: %s\n", templateName)
-		// TODO Implement template functionality
-	}
-
-	// Load configuration from file if specified
-	if configFile != "" {
-		fmt.Printf("Loading configuration from: %s\n", configFile)
-		// TODO Implement config loading functionality
-	}
+	// Templates and configuration files are applied by init before inputs are validated
 
 	return author, tags, nil
 }